@@ -0,0 +1,192 @@
+// Command gencases deterministically generates test cases in the test harness
+// input format. The same seed and profile always produce the same cases, and
+// each case is derived from (seed, index) alone, so a single reported case can
+// be regenerated directly:
+//
+//	gencases -seed 42 -n 2000 > cases.ndjson
+//	gencases -seed 42 -case 1337          # reproduce "seed 42 case 1337"
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/flitsinc/go-jsonpatch/internal/casegen"
+)
+
+const (
+	exitOK    = 0
+	exitFail  = 1
+	exitUsage = 2
+)
+
+// testCase matches the test harness input format.
+type testCase struct {
+	TestID      string           `json:"testId"`
+	OriginalDoc any              `json:"originalDoc"`
+	Operations  []map[string]any `json:"operations"`
+}
+
+// asciiStrings and unicodeStrings split casegen.Strings so -unicode can weight
+// them.
+var asciiStrings, unicodeStrings = func() ([]string, []string) {
+	var ascii, unicode []string
+	for _, s := range casegen.Strings {
+		if isASCII(s) {
+			ascii = append(ascii, s)
+		} else {
+			unicode = append(unicode, s)
+		}
+	}
+	return ascii, unicode
+}()
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("gencases", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	seed := fs.Uint64("seed", 1, "seed for the generator")
+	count := fs.Int("n", 100, "number of cases to generate")
+	only := fs.Int("case", -1, "generate only the case with this index")
+	depth := fs.Int("depth", casegen.DefaultConfig.MaxDepth, "maximum document nesting depth")
+	width := fs.Int("width", casegen.DefaultConfig.MaxWidth, "maximum members per object or array")
+	maxOps := fs.Int("max-ops", casegen.DefaultConfig.MaxOps, "maximum operations per patch")
+	unicode := fs.Float64("unicode", 0.5, "fraction of generated strings that contain non-ASCII text, 0 to 1")
+	mix := fs.String("ops", "", `op mix as weights, e.g. "add=3,remove=1,str_ins=2" (default: all ops equally)`)
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	cfg, err := profile(*depth, *width, *maxOps, *unicode, *mix)
+	if err == nil && fs.NArg() > 0 {
+		err = fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+	if err == nil && (*count < 0 || *only < -1) {
+		err = errors.New("-n and -case must not be negative")
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gencases: %v\n", err)
+		return exitUsage
+	}
+
+	first, last := 0, *count
+	if *only >= 0 {
+		first, last = *only, *only+1
+	}
+	w := bufio.NewWriter(stdout)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for i := first; i < last; i++ {
+		if err := enc.Encode(generate(cfg, *seed, i)); err != nil {
+			fmt.Fprintf(stderr, "gencases: %v\n", err)
+			return exitFail
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(stderr, "gencases: %v\n", err)
+		return exitFail
+	}
+	return exitOK
+}
+
+// generate builds case index of seed.
+func generate(cfg casegen.Config, seed uint64, index int) testCase {
+	src := casegen.NewRandSource(seed, uint64(index))
+	doc := cfg.Document(src)
+	return testCase{
+		TestID:      fmt.Sprintf("seed-%d-case-%d", seed, index),
+		OriginalDoc: doc,
+		Operations:  cfg.Patch(src, doc),
+	}
+}
+
+// profile turns the command-line knobs into a generator configuration.
+func profile(depth, width, maxOps int, unicode float64, mix string) (casegen.Config, error) {
+	if depth < 0 || width < 0 || maxOps < 1 {
+		return casegen.Config{}, errors.New("-depth and -width must not be negative and -max-ops must be at least 1")
+	}
+	if unicode < 0 || unicode > 1 || math.IsNaN(unicode) {
+		return casegen.Config{}, errors.New("-unicode must be between 0 and 1")
+	}
+	ops, err := parseMix(mix)
+	if err != nil {
+		return casegen.Config{}, err
+	}
+	return casegen.Config{
+		MaxDepth: depth,
+		MaxWidth: width,
+		MaxOps:   maxOps,
+		Strings:  weightedStrings(unicode),
+		Ops:      ops,
+	}, nil
+}
+
+// weightedStrings returns a pool of 20 strings in which roughly the given
+// fraction is non-ASCII.
+func weightedStrings(unicode float64) []string {
+	const size = 20
+	n := int(math.Round(unicode * size))
+	pool := make([]string, 0, size)
+	for i := 0; i < size; i++ {
+		if i < n {
+			pool = append(pool, unicodeStrings[i%len(unicodeStrings)])
+		} else {
+			pool = append(pool, asciiStrings[i%len(asciiStrings)])
+		}
+	}
+	return pool
+}
+
+// parseMix expands "add=3,remove=1" into a list where each op appears as many
+// times as its weight. An empty mix selects every op once.
+func parseMix(mix string) ([]string, error) {
+	if mix == "" {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(casegen.Ops))
+	for _, op := range casegen.Ops {
+		known[op] = true
+	}
+	var ops []string
+	for _, entry := range strings.Split(mix, ",") {
+		name, weightText, hasWeight := strings.Cut(strings.TrimSpace(entry), "=")
+		if !known[name] {
+			return nil, fmt.Errorf("unknown op %q in -ops", name)
+		}
+		weight := 1
+		if hasWeight {
+			w, err := strconv.Atoi(weightText)
+			if err != nil || w < 0 || w > 100 {
+				return nil, fmt.Errorf("invalid weight %q for op %q in -ops", weightText, name)
+			}
+			weight = w
+		}
+		for i := 0; i < weight; i++ {
+			ops = append(ops, name)
+		}
+	}
+	if len(ops) == 0 {
+		return nil, errors.New("-ops must give at least one op a positive weight")
+	}
+	return ops, nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func runGen(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestGenerationIsReproducible(t *testing.T) {
+	code, all, stderr := runGen("-seed", "42", "-n", "20")
+	if code != exitOK {
+		t.Fatalf("expected exit %d, got %d (stderr %q)", exitOK, code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(all), "\n")
+	if len(lines) != 20 {
+		t.Fatalf("expected 20 cases, got %d", len(lines))
+	}
+	if _, again, _ := runGen("-seed", "42", "-n", "20"); again != all {
+		t.Fatalf("same seed produced different output")
+	}
+	if _, other, _ := runGen("-seed", "43", "-n", "20"); other == all {
+		t.Fatalf("different seeds produced identical output")
+	}
+
+	_, single, _ := runGen("-seed", "42", "-case", "13")
+	if strings.TrimSpace(single) != lines[13] {
+		t.Fatalf("-case 13 did not reproduce case 13:\n%s\nwant:\n%s", single, lines[13])
+	}
+	var tc testCase
+	if err := json.Unmarshal([]byte(single), &tc); err != nil {
+		t.Fatalf("case is not valid JSON: %v", err)
+	}
+	if tc.TestID != "seed-42-case-13" || len(tc.Operations) == 0 {
+		t.Fatalf("unexpected case: %+v", tc)
+	}
+}
+
+func TestProfileControlsOpsAndStrings(t *testing.T) {
+	code, out, stderr := runGen("-seed", "7", "-n", "50", "-ops", "str_ins=2,inc", "-unicode", "0")
+	if code != exitOK {
+		t.Fatalf("expected exit %d, got %d (stderr %q)", exitOK, code, stderr)
+	}
+	decoder := json.NewDecoder(strings.NewReader(out))
+	for decoder.More() {
+		var tc testCase
+		if err := decoder.Decode(&tc); err != nil {
+			t.Fatal(err)
+		}
+		for _, op := range tc.Operations {
+			if op["op"] != "str_ins" && op["op"] != "inc" {
+				t.Fatalf("unexpected op %v outside the mix", op["op"])
+			}
+			if s, ok := op["str"].(string); ok && !isASCII(s) {
+				t.Fatalf("unexpected non-ASCII string %q with -unicode 0", s)
+			}
+		}
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"-ops", "bogus=1"},
+		{"-ops", "add=x"},
+		{"-ops", "add=0"},
+		{"-unicode", "2"},
+		{"-max-ops", "0"},
+		{"-n", "-1"},
+		{"extra"},
+		{"-unknown-flag"},
+	} {
+		if code, _, _ := runGen(args...); code != exitUsage {
+			t.Fatalf("run(%q) = %d, want %d", args, code, exitUsage)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/compact"
+)
+
+// Output formats accepted by -output.
+const (
+	formatPretty     = "pretty"
+	formatCompact    = "compact"
+	formatYAML       = "yaml"
+	formatCompactOps = "compact-ops"
+)
+
+// checkFormat validates an -output value. compact-ops only applies to
+// commands that print a JSON Patch.
+func checkFormat(format string, patchOutput bool) error {
+	switch format {
+	case formatPretty, formatCompact, formatYAML:
+		return nil
+	case formatCompactOps:
+		if patchOutput {
+			return nil
+		}
+		return fmt.Errorf("%w: -output %q is only available for patches", errUsage, format)
+	default:
+		return fmt.Errorf("%w: unknown output format %q", errUsage, format)
+	}
+}
+
+// writeOutput writes v to w in the given format. For compact-ops, v must be
+// a patch.
+func writeOutput(w io.Writer, v any, format string) error {
+	switch format {
+	case formatCompact:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	case formatCompactOps:
+		ops, ok := v.([]map[string]any)
+		if !ok {
+			return fmt.Errorf("compact-ops output requires a patch, got %T", v)
+		}
+		encoded, err := compact.Encode(ops)
+		if err != nil {
+			return err
+		}
+		return writeOutput(w, encoded, formatCompact)
+	case formatYAML:
+		var buf bytes.Buffer
+		if err := writeYAML(&buf, normalizeJSON(v), 0, false); err != nil {
+			return err
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	default:
+		return writeJSON(w, v)
+	}
+}
+
+// normalizeJSON round-trips v through encoding/json so the YAML writer only
+// sees maps, slices, strings, float64s, bools, and nil.
+func normalizeJSON(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+// plainKey matches keys that YAML reads back as the same string unquoted.
+var plainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// yamlReserved lists words YAML 1.1 parsers would read as booleans or null.
+var yamlReserved = map[string]bool{
+	"y": true, "n": true, "yes": true, "no": true, "on": true, "off": true,
+	"true": true, "false": true, "null": true,
+}
+
+// writeYAML writes a JSON value as block-style YAML at the given nesting
+// level. inline means the cursor already sits where the first line's content
+// belongs, after a "- " list marker. Strings are always double-quoted JSON
+// strings, which YAML reads back unchanged.
+func writeYAML(buf *bytes.Buffer, v any, indent int, inline bool) error {
+	pad := strings.Repeat("  ", indent)
+	switch val := v.(type) {
+	case map[string]any:
+		if len(val) == 0 {
+			buf.WriteString("{}\n")
+			return nil
+		}
+		for i, key := range sortedKeys(val) {
+			if i > 0 || !inline {
+				buf.WriteString(pad)
+			}
+			buf.WriteString(yamlKey(key))
+			buf.WriteByte(':')
+			if err := writeYAMLChild(buf, val[key], indent); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if len(val) == 0 {
+			buf.WriteString("[]\n")
+			return nil
+		}
+		for i, elem := range val {
+			if i > 0 || !inline {
+				buf.WriteString(pad)
+			}
+			buf.WriteString("- ")
+			if isContainer(elem) && !isEmptyContainer(elem) {
+				if err := writeYAML(buf, elem, indent+1, true); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := writeYAMLScalar(buf, elem); err != nil {
+				return err
+			}
+		}
+	default:
+		return writeYAMLScalar(buf, val)
+	}
+	return nil
+}
+
+func writeYAMLChild(buf *bytes.Buffer, v any, indent int) error {
+	if isContainer(v) && !isEmptyContainer(v) {
+		buf.WriteByte('\n')
+		return writeYAML(buf, v, indent+1, false)
+	}
+	buf.WriteByte(' ')
+	return writeYAMLScalar(buf, v)
+}
+
+func writeYAMLScalar(buf *bytes.Buffer, v any) error {
+	switch val := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(val))
+	case map[string]any:
+		buf.WriteString("{}")
+	case []any:
+		buf.WriteString("[]")
+	default:
+		data, err := marshalUnescaped(val)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte('\n')
+	return nil
+}
+
+// marshalUnescaped encodes v without escaping HTML characters.
+func marshalUnescaped(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func yamlKey(key string) string {
+	if plainKey.MatchString(key) && !yamlReserved[strings.ToLower(key)] {
+		return key
+	}
+	data, _ := marshalUnescaped(key)
+	return string(data)
+}
+
+func isContainer(v any) bool {
+	switch v.(type) {
+	case map[string]any, []any:
+		return true
+	default:
+		return false
+	}
+}
+
+func isEmptyContainer(v any) bool {
+	switch c := v.(type) {
+	case map[string]any:
+		return len(c) == 0
+	case []any:
+		return len(c) == 0
+	default:
+		return false
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteOutputYAML(t *testing.T) {
+	doc := map[string]any{
+		"name":  "demo",
+		"on":    true,
+		"a/b":   nil,
+		"count": 3,
+		"empty": map[string]any{},
+		"list": []any{
+			1,
+			"two",
+			map[string]any{"x": 1, "y": []any{true, []any{}}},
+			[]any{"nested", map[string]any{"z": "<tag>"}},
+		},
+		"obj": map[string]any{"inner": map[string]any{"deep": 1.5}},
+	}
+	var buf bytes.Buffer
+	if err := writeOutput(&buf, doc, formatYAML); err != nil {
+		t.Fatalf("writeOutput returned error: %v", err)
+	}
+	expected := `"a/b": null
+count: 3
+empty: {}
+list:
+  - 1
+  - "two"
+  - x: 1
+    "y":
+      - true
+      - []
+  - - "nested"
+    - z: "<tag>"
+name: "demo"
+obj:
+  inner:
+    deep: 1.5
+"on": true
+`
+	if buf.String() != expected {
+		t.Fatalf("unexpected YAML:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteOutputFormats(t *testing.T) {
+	ops := []map[string]any{{"op": "add", "path": "/a", "value": "<b>"}}
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{formatCompact, `[{"op":"add","path":"/a","value":"<b>"}]` + "\n"},
+		{formatCompactOps, `[[0,"/a","<b>"]]` + "\n"},
+		{formatPretty, "[\n  {\n    \"op\": \"add\",\n    \"path\": \"/a\",\n    \"value\": \"\\u003cb\\u003e\"\n  }\n]\n"},
+		{formatYAML, "- op: \"add\"\n  path: \"/a\"\n  value: \"<b>\"\n"},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		if err := writeOutput(&buf, ops, tc.format); err != nil {
+			t.Fatalf("%s: writeOutput returned error: %v", tc.format, err)
+		}
+		if buf.String() != tc.expected {
+			t.Fatalf("%s: got %q, want %q", tc.format, buf.String(), tc.expected)
+		}
+	}
+
+	if err := checkFormat(formatCompactOps, false); err == nil {
+		t.Fatalf("expected compact-ops to be rejected for documents")
+	}
+	if err := checkFormat("toml", true); err == nil {
+		t.Fatalf("expected unknown format to be rejected")
+	}
+}
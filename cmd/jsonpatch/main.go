@@ -0,0 +1,455 @@
+// Command jsonpatch applies, generates, and checks JSON Patch documents.
+//
+// Usage:
+//
+//	jsonpatch apply [-o out.json | -in-place [-backup .bak]] doc.json patch.json
+//	jsonpatch diff [-merge | -str] [-array-key id] before.json after.json
+//	jsonpatch test doc.json patch.json
+//	jsonpatch validate [--format=json] patch.json
+//	jsonpatch repl doc.json
+//	jsonpatch pipe < records.ndjson
+//	jsonpatch minimize [-error text | -check cmd] [-o dir] doc.json patch.json
+//
+// Any file argument may be "-" to read it from stdin. Every command accepts
+// -quiet and -fail-fast, and the exit status distinguishes parse errors,
+// invalid patches, failed test operations, and apply errors; see usage.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// Exit codes. Scripts can rely on them to tell kinds of failure apart.
+const (
+	exitOK         = 0
+	exitFail       = 1 // the patch could not be applied, or another error
+	exitUsage      = 2 // invalid command-line usage
+	exitParse      = 3 // a document or patch is not valid JSON
+	exitInvalid    = 4 // the patch is malformed (see validate)
+	exitTestFailed = 5 // a "test" operation did not match
+)
+
+const usage = `usage: jsonpatch <command> [flags] [args]
+
+commands:
+  apply [flags] doc.json patch.json         print the patched document
+      -o out.json     write to a file instead
+      -in-place       atomically replace doc.json
+      -backup .bak    with -in-place, keep the original as doc.json.bak
+      -output fmt     pretty (default), compact, or yaml
+  diff [flags] before.json after.json       print a patch turning before into after
+      -merge          print an RFC 7396 merge patch instead
+      -str            use str_del/str_ins for changed strings
+      -array-key id   match array elements by the "id" member
+      -output fmt     pretty (default), compact, yaml, or compact-ops
+  test doc.json patch.json                  check that the patch applies cleanly
+  validate [--format=json] patch.json       check the patch without a document
+  repl [-no-color] doc.json                 apply ops and query pointers interactively
+  pipe                                      apply {doc, patch} ndjson records from stdin
+  minimize [flags] doc.json patch.json      shrink a failing pair to a small reproducer
+      -error text     keep only failures whose error contains text
+      -check cmd      keep candidates for which "cmd doc.json patch.json" fails
+      -o dir          save the result as a corpus case
+
+Any file argument may be "-" to read it from stdin.
+
+Every command accepts -quiet (print nothing but results; usage errors are
+still reported) and -fail-fast (stop at the first problem in validate and
+pipe).
+
+exit codes:
+  0  success
+  1  the patch could not be applied, or another error
+  2  invalid command-line usage
+  3  a document or patch is not valid JSON
+  4  the patch is malformed
+  5  a "test" operation did not match
+`
+
+var (
+	// errUsage marks errors caused by invalid command-line usage.
+	errUsage = errors.New("usage error")
+	// errInvalid marks patches rejected by validation.
+	errInvalid = errors.New("invalid patch")
+)
+
+// parseError marks input that is not valid JSON. Its message is that of the
+// wrapped error.
+type parseError struct {
+	err error
+}
+
+func (e parseError) Error() string { return e.err.Error() }
+func (e parseError) Unwrap() error { return e.err }
+
+// options holds the flags shared by every command.
+type options struct {
+	quiet    bool
+	failFast bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the CLI with args and returns the process exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	opts := &options{}
+	var err error
+	switch args[0] {
+	case "apply":
+		err = runApply(args[1:], stdin, stdout, opts)
+	case "diff":
+		err = runDiff(args[1:], stdin, stdout, opts)
+	case "test":
+		err = runTest(args[1:], stdin, stdout, opts)
+	case "validate":
+		err = runValidate(args[1:], stdin, stdout, opts)
+	case "pipe":
+		err = runPipe(args[1:], stdin, stdout, opts)
+	case "repl":
+		err = runRepl(args[1:], stdin, stdout, opts)
+	case "minimize":
+		err = runMinimize(args[1:], stdin, stdout, opts)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		err = fmt.Errorf("%w: unknown command %q", errUsage, args[0])
+	}
+
+	code := exitCode(err)
+	switch {
+	case code == exitOK:
+	case code == exitUsage:
+		fmt.Fprintf(stderr, "jsonpatch: %v\n\n%s", err, usage)
+	case !opts.quiet:
+		fmt.Fprintf(stderr, "jsonpatch: %v\n", err)
+	}
+	return code
+}
+
+// exitCode classifies err into one of the exit codes.
+func exitCode(err error) int {
+	var parseErr parseError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		return exitUsage
+	case errors.As(err, &parseErr):
+		return exitParse
+	case errors.Is(err, errInvalid):
+		return exitInvalid
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		return exitTestFailed
+	default:
+		return exitFail
+	}
+}
+
+// newFlagSet returns a flag set for a subcommand with the shared flags bound
+// to opts.
+func newFlagSet(name string, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.quiet, "quiet", false, "print nothing but results")
+	fs.BoolVar(&opts.quiet, "q", false, "shorthand for -quiet")
+	fs.BoolVar(&opts.failFast, "fail-fast", false, "stop at the first problem")
+	return fs
+}
+
+// checkPatch validates ops before they are applied, so malformed patches are
+// reported as such rather than as apply failures.
+func checkPatch(name string, ops []map[string]any) error {
+	problems := validatePatch(ops)
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%w %q: %s", errInvalid, name, problems[0])
+	default:
+		return fmt.Errorf("%w %q: %s (and %d more problems)", errInvalid, name, problems[0], len(problems)-1)
+	}
+}
+
+// parseArgs parses flags for a subcommand and checks its positional argument count.
+func parseArgs(fs *flag.FlagSet, args []string, want int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() != want {
+		return nil, fmt.Errorf("%w: %q expects %d file arguments, got %d", errUsage, fs.Name(), want, fs.NArg())
+	}
+	files := fs.Args()
+	stdinUses := 0
+	for _, name := range files {
+		if name == "-" {
+			stdinUses++
+		}
+	}
+	if stdinUses > 1 {
+		return nil, fmt.Errorf("%w: only one argument may read from stdin", errUsage)
+	}
+	return files, nil
+}
+
+// readFile returns the contents of name, or of stdin when name is "-".
+func readFile(name string, stdin io.Reader) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// readDocument reads a document with any JSON root.
+func readDocument(name string, stdin io.Reader) (any, error) {
+	data, err := readFile(name, stdin)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse document %q: %w", name, parseError{err})
+	}
+	return doc, nil
+}
+
+func readPatch(name string, stdin io.Reader) ([]map[string]any, error) {
+	data, err := readFile(name, stdin)
+	if err != nil {
+		return nil, err
+	}
+	var ops []map[string]any
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, fmt.Errorf("parse patch %q: %w", name, parseError{err})
+	}
+	return ops, nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append(out, '\n')
+	_, err = w.Write(out)
+	return err
+}
+
+func runApply(args []string, stdin io.Reader, stdout io.Writer, opts *options) error {
+	fs := newFlagSet("apply", opts)
+	output := fs.String("o", "", "write the patched document to this file instead of stdout")
+	inPlace := fs.Bool("in-place", false, "replace the document file with the patched document")
+	backup := fs.String("backup", "", "with -in-place, keep the original document at its path plus this suffix")
+	format := fs.String("output", formatPretty, "output format: pretty, compact, or yaml")
+	files, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if err := checkFormat(*format, false); err != nil {
+		return err
+	}
+	switch {
+	case *inPlace && *output != "":
+		return fmt.Errorf("%w: -in-place cannot be combined with -o", errUsage)
+	case *inPlace && files[0] == "-":
+		return fmt.Errorf("%w: -in-place needs a document file, not stdin", errUsage)
+	case *backup != "" && !*inPlace:
+		return fmt.Errorf("%w: -backup requires -in-place", errUsage)
+	}
+	doc, err := readDocument(files[0], stdin)
+	if err != nil {
+		return err
+	}
+	ops, err := readPatch(files[1], stdin)
+	if err != nil {
+		return err
+	}
+	if err := checkPatch(files[1], ops); err != nil {
+		return err
+	}
+	if doc, err = jsonpatch.ApplyValue(doc, ops); err != nil {
+		return err
+	}
+	switch {
+	case *inPlace:
+		return replaceFile(files[0], *backup, doc, *format)
+	case *output != "":
+		return writeFile(*output, doc, *format)
+	default:
+		return writeOutput(stdout, doc, *format)
+	}
+}
+
+func writeFile(name string, v any, format string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := writeOutput(f, v, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replaceFile atomically replaces name with v: the new contents are written
+// to a temporary file in the same directory and renamed over name, so readers
+// see either the old or the new document. When backupSuffix is set, the old
+// contents are first copied to name+backupSuffix.
+func replaceFile(name, backupSuffix string, v any, format string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if backupSuffix != "" {
+		original, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(name+backupSuffix, original, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("write backup: %w", err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if err := writeOutput(tmp, v, format); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func runDiff(args []string, stdin io.Reader, stdout io.Writer, opts *options) error {
+	fs := newFlagSet("diff", opts)
+	merge := fs.Bool("merge", false, "print an RFC 7396 merge patch instead of a JSON Patch")
+	strOps := fs.Bool("str", false, "describe changed strings with str_del/str_ins ops")
+	arrayKey := fs.String("array-key", "", "match elements of arrays of objects by this member")
+	format := fs.String("output", formatPretty, "output format: pretty, compact, yaml, or compact-ops")
+	files, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if *merge && (*strOps || *arrayKey != "") {
+		return fmt.Errorf("%w: -merge cannot be combined with -str or -array-key", errUsage)
+	}
+	if err := checkFormat(*format, !*merge); err != nil {
+		return err
+	}
+	before, err := readDocument(files[0], stdin)
+	if err != nil {
+		return err
+	}
+	after, err := readDocument(files[1], stdin)
+	if err != nil {
+		return err
+	}
+	if *merge {
+		ops, err := jsonpatch.DiffValue(before, after)
+		if err != nil {
+			return err
+		}
+		patch, err := jsonpatch.PatchToMergePatch(before, ops)
+		if err != nil {
+			return err
+		}
+		return writeOutput(stdout, patch, *format)
+	}
+	ops, err := jsonpatch.DiffValueWithOptions(before, after, jsonpatch.DiffOptions{Strings: *strOps, ArrayKey: *arrayKey})
+	if err != nil {
+		return err
+	}
+	return writeOutput(stdout, ops, *format)
+}
+
+func runTest(args []string, stdin io.Reader, stdout io.Writer, opts *options) error {
+	files, err := parseArgs(newFlagSet("test", opts), args, 2)
+	if err != nil {
+		return err
+	}
+	doc, err := readDocument(files[0], stdin)
+	if err != nil {
+		return err
+	}
+	ops, err := readPatch(files[1], stdin)
+	if err != nil {
+		return err
+	}
+	if err := checkPatch(files[1], ops); err != nil {
+		return err
+	}
+	if _, err := jsonpatch.ApplyValue(doc, ops); err != nil {
+		return err
+	}
+	if !opts.quiet {
+		fmt.Fprintf(stdout, "ok: %d operations applied cleanly\n", len(ops))
+	}
+	return nil
+}
+
+func runValidate(args []string, stdin io.Reader, stdout io.Writer, opts *options) error {
+	fs := newFlagSet("validate", opts)
+	format := fs.String("format", "text", "output format: \"text\" or \"json\"")
+	files, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("%w: unknown format %q", errUsage, *format)
+	}
+	ops, err := readPatch(files[0], stdin)
+	if err != nil {
+		return err
+	}
+	problems := validatePatch(ops)
+	if opts.failFast && len(problems) > 1 {
+		problems = problems[:1]
+	}
+	switch {
+	case opts.quiet:
+	case *format == "json":
+		diagnostics := make([]diagnostic, len(problems))
+		for i, p := range problems {
+			diagnostics[i] = p.diagnostic()
+		}
+		if err := writeJSON(stdout, diagnostics); err != nil {
+			return err
+		}
+	default:
+		for _, p := range problems {
+			fmt.Fprintln(stdout, p)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w %q: %d problems", errInvalid, files[0], len(problems))
+	}
+	return nil
+}
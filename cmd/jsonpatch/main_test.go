@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/corpus"
+)
+
+func writeTemp(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func runCLI(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestApplyCommand(t *testing.T) {
+	doc := writeTemp(t, "doc.json", `{"greeting":"world","counter":1}`)
+	patch := `[{"op":"str_ins","path":"/greeting","pos":0,"str":"Hello "},{"op":"inc","path":"/counter","inc":2}]`
+
+	code, stdout, stderr := runCLI(patch, "apply", doc, "-")
+	if code != exitOK {
+		t.Fatalf("expected exit %d, got %d (stderr %q)", exitOK, code, stderr)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout)
+	}
+	expected := map[string]any{"greeting": "Hello world", "counter": float64(3)}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected output: %v", got)
+	}
+}
+
+func TestApplyCommandNonObjectRoots(t *testing.T) {
+	tests := []struct {
+		doc, patch, expected string
+	}{
+		{`[1,2]`, `[{"op":"add","path":"/-","value":3}]`, `[1,2,3]`},
+		{`"hi"`, `[{"op":"str_ins","path":"","pos":2,"str":"!"}]`, `"hi!"`},
+		{`null`, `[{"op":"replace","path":"","value":{"a":1}}]`, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		doc := writeTemp(t, "doc.json", tt.doc)
+		code, stdout, stderr := runCLI(tt.patch, "apply", "-output", "compact", doc, "-")
+		if code != exitOK {
+			t.Fatalf("apply to %s: expected exit %d, got %d (stderr %q)", tt.doc, exitOK, code, stderr)
+		}
+		if got := strings.TrimSpace(stdout); got != tt.expected {
+			t.Fatalf("apply to %s: expected %s, got %s", tt.doc, tt.expected, got)
+		}
+	}
+}
+
+func TestApplyCommandWritesOutputFile(t *testing.T) {
+	doc := writeTemp(t, "doc.json", `{"a":1}`)
+	patch := writeTemp(t, "patch.json", `[{"op":"remove","path":"/a"}]`)
+	out := filepath.Join(t.TempDir(), "out.json")
+
+	if code, _, stderr := runCLI("", "apply", "-o", out, doc, patch); code != exitOK {
+		t.Fatalf("expected exit %d, got %d (stderr %q)", exitOK, code, stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if strings.TrimSpace(string(data)) != "{}" {
+		t.Fatalf("unexpected output file contents: %q", data)
+	}
+}
+
+func TestDiffCommandRoundTrips(t *testing.T) {
+	before := writeTemp(t, "before.json", `{"a":1,"b":{"c":[1,2]},"x/y":2,"list":[1]}`)
+	after := writeTemp(t, "after.json", `{"a":2,"b":{"c":[1,3]},"d":true,"list":[1,2]}`)
+
+	code, patch, stderr := runCLI("", "diff", before, after)
+	if code != exitOK {
+		t.Fatalf("expected exit %d, got %d (stderr %q)", exitOK, code, stderr)
+	}
+	code, stdout, stderr := runCLI(patch, "apply", before, "-")
+	if code != exitOK {
+		t.Fatalf("applying generated patch failed with %d: %s", code, stderr)
+	}
+	var got, expected map[string]any
+	json.Unmarshal([]byte(stdout), &got)
+	json.Unmarshal([]byte(`{"a":2,"b":{"c":[1,3]},"d":true,"list":[1,2]}`), &expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("generated patch did not reproduce target.\nPatch: %s\nGot:   %v", patch, got)
+	}
+}
+
+func TestTestCommand(t *testing.T) {
+	doc := writeTemp(t, "doc.json", `{"a":1}`)
+
+	if code, _, stderr := runCLI(`[{"op":"test","path":"/a","value":1}]`, "test", doc, "-"); code != exitOK {
+		t.Fatalf("expected passing test op, got %d (stderr %q)", code, stderr)
+	}
+	code, _, stderr := runCLI(`[{"op":"test","path":"/a","value":2}]`, "test", doc, "-")
+	if code != exitTestFailed || !strings.Contains(stderr, "test operation failed") {
+		t.Fatalf("expected failing test op, got %d (stderr %q)", code, stderr)
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	code, stdout, _ := runCLI(`[{"op":"add","path":"/a","value":1},{"op":"copy","path":"/b"},{"op":"inc","path":"/a~2","inc":"1"}]`, "validate", "-")
+	if code != exitInvalid {
+		t.Fatalf("expected exit %d, got %d", exitInvalid, code)
+	}
+	expected := []string{
+		`op 1 ("copy"): "from" must be a string`,
+		`op 2 ("inc"): "path" is not a valid JSON Pointer: invalid JSON pointer "/a~2": invalid escape sequence "~2" in segment "a~2"`,
+		`op 2 ("inc"): "inc" must be a number`,
+	}
+	if got := strings.Split(strings.TrimSpace(stdout), "\n"); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected problems:\n%s", stdout)
+	}
+
+	if code, _, _ := runCLI(`[{"op":"remove","path":"/a~01"}]`, "validate", "-"); code != exitOK {
+		t.Fatalf("expected valid patch to pass, got %d", code)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	for _, args := range [][]string{{}, {"bogus"}, {"apply", "only-one"}, {"diff", "-", "-"}} {
+		if code, _, _ := runCLI("", args...); code != exitUsage {
+			t.Fatalf("run(%q) = %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	doc := writeTemp(t, "doc.json", `{"a":1}`)
+	tests := []struct {
+		name  string
+		patch string
+		args  []string
+		code  int
+	}{
+		{"applies", `[{"op":"add","path":"/b","value":2}]`, []string{"apply", doc, "-"}, exitOK},
+		{"apply error", `[{"op":"remove","path":"/missing"}]`, []string{"apply", doc, "-"}, exitFail},
+		{"unparsable patch", `[{"op":`, []string{"apply", doc, "-"}, exitParse},
+		{"unparsable document", `{`, []string{"apply", "-", doc}, exitParse},
+		{"invalid patch", `[{"op":"copy","path":"/b"}]`, []string{"apply", doc, "-"}, exitInvalid},
+		{"failed test op", `[{"op":"test","path":"/a","value":2}]`, []string{"apply", doc, "-"}, exitTestFailed},
+		{"invalid patch in test", `[{"op":"bogus","path":"/a"}]`, []string{"test", doc, "-"}, exitInvalid},
+		{"bad flag", ``, []string{"apply", "-bogus", doc, "-"}, exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, stderr := runCLI(tt.patch, tt.args...); code != tt.code {
+				t.Fatalf("expected exit %d, got %d (stderr %q)", tt.code, code, stderr)
+			}
+		})
+	}
+}
+
+func TestQuietAndFailFast(t *testing.T) {
+	doc := writeTemp(t, "doc.json", `{"a":1}`)
+	code, stdout, stderr := runCLI(`[{"op":"test","path":"/a","value":2}]`, "test", "-quiet", doc, "-")
+	if code != exitTestFailed || stdout != "" || stderr != "" {
+		t.Fatalf("expected a silent failure, got %d (stdout %q, stderr %q)", code, stdout, stderr)
+	}
+	if code, stdout, _ := runCLI(`[{"op":"test","path":"/a","value":1}]`, "test", "-q", doc, "-"); code != exitOK || stdout != "" {
+		t.Fatalf("expected a silent success, got %d (stdout %q)", code, stdout)
+	}
+	if code, stdout, _ := runCLI(`[{"op":"add","path":"/b","value":2}]`, "apply", "-quiet", doc, "-"); code != exitOK || !strings.Contains(stdout, `"b": 2`) {
+		t.Fatalf("-quiet must keep the patched document, got %d (stdout %q)", code, stdout)
+	}
+
+	code, stdout, _ = runCLI(`[{"op":"copy","path":"/b"},{"op":"bogus","path":""}]`, "validate", "-fail-fast", "-")
+	if code != exitInvalid || strings.Count(stdout, "\n") != 1 {
+		t.Fatalf("expected only the first problem, got %d:\n%s", code, stdout)
+	}
+
+	records := `{"id":1,"doc":{},"patch":[{"op":"add","path":"/a","value":1}]}
+{"id":2,"doc":{"a":1},"patch":[{"op":"test","path":"/a","value":2}]}
+{"id":3,"doc":{},"patch":[]}
+`
+	code, stdout, stderr = runCLI(records, "pipe", "-fail-fast")
+	if code != exitTestFailed || strings.Count(stdout, "\n") != 2 || !strings.Contains(stderr, "line 2:") {
+		t.Fatalf("expected pipe to stop at line 2, got %d (stdout %q, stderr %q)", code, stdout, stderr)
+	}
+}
+
+func TestValidateCommandJSONFormat(t *testing.T) {
+	patch := `[{"op":"copy","path":"/b"},{"op":"inc","path":"/a/b~2c","inc":"1"},{"op":"bogus","path":""}]`
+	code, stdout, _ := runCLI(patch, "validate", "--format=json", "-")
+	if code != exitInvalid {
+		t.Fatalf("expected exit %d, got %d", exitInvalid, code)
+	}
+	var got []map[string]any
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout)
+	}
+	expected := []map[string]any{
+		{"index": float64(0), "op": "copy", "field": "from", "code": "missing_field", "message": `"from" must be a string`},
+		{"index": float64(1), "op": "inc", "field": "path", "segment": float64(1), "code": "invalid_pointer_escape", "message": `"path" is not a valid JSON Pointer: invalid JSON pointer "/a/b~2c": invalid escape sequence "~2" in segment "b~2c"`},
+		{"index": float64(1), "op": "inc", "field": "inc", "code": "invalid_type", "message": `"inc" must be a number`},
+		{"index": float64(2), "op": "bogus", "field": "op", "code": "unknown_op", "message": `unknown type "bogus"`},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected diagnostics:\n%s", stdout)
+	}
+
+	if code, stdout, _ := runCLI(`[]`, "validate", "--format=json", "-"); code != exitOK || strings.TrimSpace(stdout) != "[]" {
+		t.Fatalf("expected empty diagnostics for a valid patch, got %d %q", code, stdout)
+	}
+	if code, _, _ := runCLI(`[]`, "validate", "--format=xml", "-"); code != exitUsage {
+		t.Fatalf("expected usage error for unknown format, got %d", code)
+	}
+}
+
+func TestReplCommand(t *testing.T) {
+	doc := writeTemp(t, "doc.json", `{"a":1,"list":["x"]}`)
+	input := strings.Join([]string{
+		`{"op":"replace","path":"/a","value":2}`,
+		`[{"op":"add","path":"/list/-","value":"y"},{"op":"remove","path":"/a"}]`,
+		`/list/1`,
+		`[{"op":"add","path":"/b","value":1},{"op":"remove","path":"/missing"}]`,
+		`undo`,
+		`get /a`,
+		`bogus`,
+		`quit`,
+		`show`,
+	}, "\n")
+
+	code, stdout, stderr := runCLI(input, "repl", doc)
+	if code != exitOK {
+		t.Fatalf("expected exit %d, got %d (stderr %q)", exitOK, code, stderr)
+	}
+	for _, want := range []string{
+		"op 0 (\"replace\"):\n  - /a: 1\n  + /a: 2\n",
+		"op 0 (\"add\"):\n  + /list/1: \"y\"\n",
+		"op 1 (\"remove\"):\n  - /a: 2\n",
+		"\"y\"\n",
+		"op 1 failed: path segment \"missing\" not found",
+		"document unchanged",
+		"undone:\n  + /a: 2\n  - /list/1: \"y\"\n",
+		"> 2\n",
+		"unknown command \"bogus\"",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, stdout)
+		}
+	}
+	if strings.Contains(stdout, "\x1b[") {
+		t.Fatalf("expected no color codes when not writing to a terminal")
+	}
+	if strings.Count(stdout, "\"list\"") != 0 {
+		t.Fatalf("expected commands after quit to be ignored, got:\n%s", stdout)
+	}
+}
+
+func TestPipeCommand(t *testing.T) {
+	input := strings.Join([]string{
+		`{"id":1,"doc":{"n":1},"patch":[{"op":"inc","path":"/n","inc":1}]}`,
+		``,
+		`{"id":"two","doc":[1],"patch":[{"op":"remove","path":"/5","id":"edit-7"}]}`,
+		`{not json`,
+		`{"doc":{"a":1},"patch":[{"op":"replace","path":"","value":null}]}`,
+		`{"doc":"<tag>","patch":[]}`,
+	}, "\n")
+
+	code, stdout, stderr := runCLI(input, "pipe")
+	if code != exitFail || !strings.Contains(stderr, "2 of 5 records failed") {
+		t.Fatalf("expected exit %d with a failure summary, got %d (stderr %q)", exitFail, code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 output lines, got %d:\n%s", len(lines), stdout)
+	}
+	if lines[0] != `{"id":1,"doc":{"n":2}}` {
+		t.Fatalf("unexpected first result: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], `{"id":"two","error":"line 3: `) || !strings.HasSuffix(lines[1], `,"op_id":"edit-7"}`) {
+		t.Fatalf("expected failing record to keep its id, line number and op id, got %s", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], `{"error":"line 4: parse record: `) {
+		t.Fatalf("expected parse error for malformed line, got %s", lines[2])
+	}
+	if lines[3] != `{"doc":null}` || lines[4] != `{"doc":"<tag>"}` {
+		t.Fatalf("unexpected results for scalar roots: %s / %s", lines[3], lines[4])
+	}
+}
+
+func TestDiffCommandFlags(t *testing.T) {
+	before := writeTemp(t, "before.json", `{"text":"Hello 🌍 world","items":[{"id":1,"v":"a"},{"id":2,"v":"b"},{"id":3,"v":"c"}],"gone":true}`)
+	afterJSON := `{"text":"Hello 🌎 big world","items":[{"id":3,"v":"c"},{"id":4,"v":"d"},{"id":1,"v":"A"}]}`
+	after := writeTemp(t, "after.json", afterJSON)
+
+	code, patch, stderr := runCLI("", "diff", "-str", "-array-key", "id", before, after)
+	if code != exitOK {
+		t.Fatalf("expected exit %d, got %d (stderr %q)", exitOK, code, stderr)
+	}
+	var ops []map[string]any
+	if err := json.Unmarshal([]byte(patch), &ops); err != nil {
+		t.Fatalf("output is not a patch: %v\n%s", err, patch)
+	}
+	counts := map[string]int{}
+	for _, op := range ops {
+		counts[op["op"].(string)]++
+	}
+	if counts["str_del"] != 2 || counts["str_ins"] != 2 || counts["move"] != 1 || counts["add"] != 1 || counts["remove"] != 2 || counts["replace"] != 0 {
+		t.Fatalf("unexpected op mix %v in patch:\n%s", counts, patch)
+	}
+
+	code, stdout, stderr := runCLI(patch, "apply", before, "-")
+	if code != exitOK {
+		t.Fatalf("applying generated patch failed with %d: %s\npatch: %s", code, stderr, patch)
+	}
+	var got, expected map[string]any
+	json.Unmarshal([]byte(stdout), &got)
+	json.Unmarshal([]byte(afterJSON), &expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("generated patch did not reproduce target.\nPatch: %s\nGot:   %v", patch, got)
+	}
+}
+
+func TestDiffCommandMergePatch(t *testing.T) {
+	before := writeTemp(t, "before.json", `{"a":1,"b":{"c":1,"d":2},"list":[1,2]}`)
+	after := writeTemp(t, "after.json", `{"a":1,"b":{"c":1,"e":{"f":3}},"list":[1]}`)
+
+	code, stdout, stderr := runCLI("", "diff", "-merge", before, after)
+	if code != exitOK {
+		t.Fatalf("expected exit %d, got %d (stderr %q)", exitOK, code, stderr)
+	}
+	var got, expected map[string]any
+	json.Unmarshal([]byte(stdout), &got)
+	json.Unmarshal([]byte(`{"b":{"d":null,"e":{"f":3}},"list":[1]}`), &expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected merge patch: %s", stdout)
+	}
+
+	withNull := writeTemp(t, "null.json", `{"a":null}`)
+	if code, _, stderr := runCLI("", "diff", "-merge", before, withNull); code != exitFail || !strings.Contains(stderr, `cannot set "/a" to null`) {
+		t.Fatalf("expected null member to be rejected, got %d (stderr %q)", code, stderr)
+	}
+	if code, _, _ := runCLI("", "diff", "-merge", "-str", before, after); code != exitUsage {
+		t.Fatalf("expected usage error when combining -merge and -str, got %d", code)
+	}
+}
+
+func TestApplyCommandInPlace(t *testing.T) {
+	doc := writeTemp(t, "doc.json", `{"a":1}`)
+	if err := os.Chmod(doc, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	patch := `[{"op":"replace","path":"/a","value":2}]`
+
+	if code, stdout, stderr := runCLI(patch, "apply", "--in-place", "--backup=.bak", doc, "-"); code != exitOK || stdout != "" {
+		t.Fatalf("expected silent success, got %d (stdout %q, stderr %q)", code, stdout, stderr)
+	}
+	data, err := os.ReadFile(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(strings.Fields(string(data)), "") != `{"a":2}` {
+		t.Fatalf("document not updated: %q", data)
+	}
+	backup, err := os.ReadFile(doc + ".bak")
+	if err != nil || string(backup) != `{"a":1}` {
+		t.Fatalf("expected backup of the original, got %q (err %v)", backup, err)
+	}
+	if info, err := os.Stat(doc); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected file mode to be preserved, got %v (err %v)", info.Mode(), err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(doc))
+	if len(entries) != 2 {
+		t.Fatalf("expected only the document and its backup, got %v", entries)
+	}
+
+	// A failing patch leaves the document untouched.
+	if code, _, _ := runCLI(`[{"op":"remove","path":"/missing"}]`, "apply", "--in-place", doc, "-"); code != exitFail {
+		t.Fatalf("expected failure, got %d", code)
+	}
+	if after, _ := os.ReadFile(doc); string(after) != string(data) {
+		t.Fatalf("document changed by failing patch: %q", after)
+	}
+}
+
+func TestApplyCommandInPlaceUsage(t *testing.T) {
+	doc := writeTemp(t, "doc.json", `{}`)
+	for _, args := range [][]string{
+		{"apply", "--in-place", "-o", "out.json", doc, "-"},
+		{"apply", "--in-place", "-", doc},
+		{"apply", "--backup=.bak", doc, "-"},
+	} {
+		if code, _, _ := runCLI("[]", args...); code != exitUsage {
+			t.Fatalf("run(%q) = %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestOutputFlag(t *testing.T) {
+	doc := writeTemp(t, "doc.json", `{"a":1}`)
+	after := writeTemp(t, "after.json", `{"a":2}`)
+
+	if code, stdout, stderr := runCLI("[]", "apply", "--output=yaml", doc, "-"); code != exitOK || stdout != "a: 1\n" {
+		t.Fatalf("unexpected yaml apply output %q (code %d, stderr %q)", stdout, code, stderr)
+	}
+	if code, stdout, stderr := runCLI("", "diff", "--output=compact-ops", doc, after); code != exitOK || stdout != `[[2,"/a",2]]`+"\n" {
+		t.Fatalf("unexpected compact-ops diff output %q (code %d, stderr %q)", stdout, code, stderr)
+	}
+	if code, stdout, stderr := runCLI("", "diff", "--merge", "--output=compact", doc, after); code != exitOK || stdout != `{"a":2}`+"\n" {
+		t.Fatalf("unexpected compact merge output %q (code %d, stderr %q)", stdout, code, stderr)
+	}
+	for _, args := range [][]string{
+		{"apply", "--output=compact-ops", doc, "-"},
+		{"diff", "--merge", "--output=compact-ops", doc, after},
+		{"diff", "--output=xml", doc, after},
+	} {
+		if code, _, _ := runCLI("[]", args...); code != exitUsage {
+			t.Fatalf("run(%q) = %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestMinimizeCommand(t *testing.T) {
+	doc := writeTemp(t, "doc.json", `{"a":{"b":[1,2,3]},"c":"long string value","d":[{"e":1}]}`)
+	patch := writeTemp(t, "patch.json", `[
+		{"op":"add","path":"/x","value":{"big":[1,2,3,4]}},
+		{"op":"replace","path":"/c","value":"other"},
+		{"op":"remove","path":"/a/b/7"},
+		{"op":"add","path":"/y","value":true}
+	]`)
+
+	code, stdout, stderr := runCLI("", "minimize", doc, patch)
+	if code != exitOK {
+		t.Fatalf("minimize failed with %d: %s", code, stderr)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout)
+	}
+	// Any error counts without -error, so the missing parent is enough.
+	want := map[string]any{
+		"doc":   map[string]any{},
+		"patch": []any{map[string]any{"op": "remove", "path": "/a/b/7"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %s", stdout)
+	}
+
+	dir := filepath.Join(t.TempDir(), "case")
+	if code, _, stderr := runCLI("", "minimize", "-error", "out of bounds", "-o", dir, doc, patch); code != exitOK {
+		t.Fatalf("minimize -o failed with %d: %s", code, stderr)
+	}
+	c, err := corpus.LoadCase(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDoc := map[string]any{"a": map[string]any{"b": []any{}}}
+	if !reflect.DeepEqual(c.Original, wantDoc) || len(c.Patch) != 1 || c.Error != "out of bounds" || c.Meta.Source != "minimize" {
+		t.Fatalf("unexpected corpus case %+v", c)
+	}
+
+	if code, _, _ := runCLI("", "minimize", "-error", "no such error", doc, patch); code != exitFail {
+		t.Fatalf("expected exit %d for a pair that does not reproduce, got %d", exitFail, code)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/corpus"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/minimize"
+)
+
+// runMinimize shrinks a failing document and patch to a small reproducer and
+// prints it as {"doc": ..., "patch": [...]}, or saves it as a corpus case.
+func runMinimize(args []string, stdin io.Reader, stdout io.Writer, opts *options) error {
+	fs := newFlagSet("minimize", opts)
+	errorText := fs.String("error", "", "keep candidates whose apply error contains this text")
+	check := fs.String("check", "", "keep candidates for which this command, given doc and patch files, exits non-zero")
+	output := fs.String("o", "", "save the result as a corpus case in this directory")
+	files, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if *check != "" && strings.TrimSpace(*check) == "" {
+		return fmt.Errorf("%w: -check needs a command", errUsage)
+	}
+	if *check != "" && *errorText != "" {
+		return fmt.Errorf("%w: -check cannot be combined with -error", errUsage)
+	}
+	doc, err := readDocument(files[0], stdin)
+	if err != nil {
+		return err
+	}
+	ops, err := readPatch(files[1], stdin)
+	if err != nil {
+		return err
+	}
+
+	interesting := minimize.Fails(*errorText)
+	if *check != "" {
+		dir, err := os.MkdirTemp("", "jsonpatch-minimize-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		interesting = checkCommand(*check, dir)
+	}
+	doc, ops, err = minimize.Minimize(doc, ops, interesting)
+	if errors.Is(err, minimize.ErrNotReproducible) && *check == "" {
+		return fmt.Errorf("patch %q applies to %q without an error matching %q", files[1], files[0], *errorText)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return writeJSON(stdout, map[string]any{"doc": doc, "patch": ops})
+	}
+	c := corpus.Case{
+		Name:     filepath.Base(*output),
+		Original: doc,
+		Patch:    ops,
+		Meta:     corpus.Meta{Description: fmt.Sprintf("minimized from %s and %s", files[0], files[1]), Source: "minimize"},
+	}
+	if *check == "" {
+		c.Error = *errorText
+		if c.Error == "" {
+			_, applyErr := jsonpatch.ApplyValue(cloneJSON(doc), ops)
+			c.Error = applyErr.Error()
+		}
+	}
+	return corpus.SaveCase(*output, c)
+}
+
+// checkCommand returns a predicate that writes each candidate to dir and runs
+// command with the document and patch paths appended, treating a non-zero
+// exit as a reproduction.
+func checkCommand(command, dir string) minimize.Predicate {
+	fields := strings.Fields(command)
+	docPath := filepath.Join(dir, corpus.OriginalFile)
+	patchPath := filepath.Join(dir, corpus.PatchFile)
+	return func(doc any, patch []map[string]any) bool {
+		if corpus.WriteJSON(docPath, doc) != nil || corpus.WriteJSON(patchPath, patch) != nil {
+			return false
+		}
+		cmd := exec.Command(fields[0], append(fields[1:], docPath, patchPath)...)
+		var exitErr *exec.ExitError
+		return errors.As(cmd.Run(), &exitErr)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// pipeRecord is one input line of "jsonpatch pipe".
+type pipeRecord struct {
+	ID    json.RawMessage  `json:"id,omitempty"`
+	Doc   any              `json:"doc"`
+	Patch []map[string]any `json:"patch"`
+}
+
+// pipeResult is one output line of "jsonpatch pipe". Records that fail carry
+// Error, and OpID when the failing operation has an "id"; all others carry
+// Doc.
+type pipeResult struct {
+	ID    json.RawMessage `json:"id,omitempty"`
+	Doc   any             `json:"doc,omitempty"`
+	Error string          `json:"error,omitempty"`
+	OpID  any             `json:"op_id,omitempty"`
+}
+
+// runPipe reads {doc, patch} records as ndjson from stdin and writes one
+// {doc} or {error} line per record, in order. Failing records do not stop
+// the stream unless -fail-fast is set; the command fails at the end if any
+// record failed.
+func runPipe(args []string, stdin io.Reader, stdout io.Writer, opts *options) error {
+	if _, err := parseArgs(newFlagSet("pipe", opts), args, 0); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(stdin, 64*1024)
+	writer := bufio.NewWriterSize(stdout, 64*1024)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+
+	records, failed := 0, 0
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			records++
+			result, err := applyRecord(line, lineNumber)
+			if encodeErr := encodePipeResult(encoder, result); encodeErr != nil {
+				return encodeErr
+			}
+			if err != nil {
+				failed++
+				if opts.failFast {
+					if flushErr := writer.Flush(); flushErr != nil {
+						return flushErr
+					}
+					return err
+				}
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d records failed", failed, records)
+	}
+	return nil
+}
+
+// applyRecord applies one input line. A failing record is returned both as
+// its output line and as an error that classifies the failure.
+func applyRecord(line []byte, lineNumber int) (pipeResult, error) {
+	var record pipeRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		err = fmt.Errorf("line %d: parse record: %w", lineNumber, parseError{err})
+		return pipeResult{Error: err.Error()}, err
+	}
+	doc, err := jsonpatch.ApplyValue(record.Doc, record.Patch)
+	if err != nil {
+		result := pipeResult{ID: record.ID}
+		var opErr *jsonpatch.OpError
+		if errors.As(err, &opErr) {
+			result.OpID = opErr.ID
+		}
+		err = fmt.Errorf("line %d: %w", lineNumber, err)
+		result.Error = err.Error()
+		return result, err
+	}
+	return pipeResult{ID: record.ID, Doc: doc}, nil
+}
+
+// encodePipeResult writes result, keeping a "doc" member for successful
+// records even when the patched document is null.
+func encodePipeResult(encoder *json.Encoder, result pipeResult) error {
+	if result.Error != "" || result.Doc != nil {
+		return encoder.Encode(result)
+	}
+	return encoder.Encode(struct {
+		ID  json.RawMessage `json:"id,omitempty"`
+		Doc any             `json:"doc"`
+	}{result.ID, nil})
+}
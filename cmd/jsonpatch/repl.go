@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/jsonpointer"
+)
+
+const replHelp = `Enter an operation object or an array of operations to apply them.
+An array is applied atomically and can be undone as a single step.
+
+commands:
+  /pointer      print the value at a JSON Pointer ("get /pointer" also works)
+  show          print the whole document
+  undo          revert the last applied input
+  help          show this help
+  quit          leave the REPL (also exit or end of input)
+`
+
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
+
+// repl holds the state of an interactive session.
+type repl struct {
+	doc     any
+	history []any
+	out     io.Writer
+	color   bool
+}
+
+func runRepl(args []string, stdin io.Reader, stdout io.Writer, opts *options) error {
+	fs := newFlagSet("repl", opts)
+	noColor := fs.Bool("no-color", false, "disable colored diffs")
+	files, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if files[0] == "-" {
+		return fmt.Errorf("%w: %q reads commands from stdin, so the document must be a file", errUsage, "repl")
+	}
+	data, err := readFile(files[0], stdin)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parse document %q: %w", files[0], parseError{err})
+	}
+
+	r := &repl{doc: doc, out: stdout, color: !*noColor && isTerminal(stdout) && os.Getenv("NO_COLOR") == ""}
+	fmt.Fprintf(stdout, "loaded %q; type \"help\" for commands\n", files[0])
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for {
+		fmt.Fprint(stdout, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(stdout)
+			return scanner.Err()
+		}
+		if !r.handle(strings.TrimSpace(scanner.Text())) {
+			return nil
+		}
+	}
+}
+
+// handle runs one line of input and reports whether the session continues.
+func (r *repl) handle(line string) bool {
+	switch {
+	case line == "":
+	case line == "quit" || line == "exit":
+		return false
+	case line == "help":
+		fmt.Fprint(r.out, replHelp)
+	case line == "show":
+		r.print(r.doc)
+	case line == "undo":
+		r.undo()
+	case line == "get" || strings.HasPrefix(line, "get "):
+		r.query(strings.TrimSpace(strings.TrimPrefix(line, "get")))
+	case strings.HasPrefix(line, "/"):
+		r.query(line)
+	case strings.HasPrefix(line, "{") || strings.HasPrefix(line, "["):
+		r.applyInput(line)
+	default:
+		fmt.Fprintf(r.out, "unknown command %q; type \"help\" for commands\n", line)
+	}
+	return true
+}
+
+func (r *repl) applyInput(line string) {
+	var ops []map[string]any
+	if strings.HasPrefix(line, "{") {
+		var op map[string]any
+		if err := json.Unmarshal([]byte(line), &op); err != nil {
+			fmt.Fprintf(r.out, "invalid operation: %v\n", err)
+			return
+		}
+		ops = []map[string]any{op}
+	} else if err := json.Unmarshal([]byte(line), &ops); err != nil {
+		fmt.Fprintf(r.out, "invalid patch: %v\n", err)
+		return
+	}
+
+	// Apply one operation at a time to a copy so each can be shown on its own
+	// and a failure leaves the session document untouched.
+	doc := cloneJSON(r.doc)
+	for i, op := range ops {
+		before := cloneJSON(doc)
+		next, err := jsonpatch.ApplyValue(doc, []map[string]any{op})
+		if err != nil {
+			// The operation is applied alone, so the error's own index and
+			// rendering of it add nothing.
+			var opErr *jsonpatch.OpError
+			if errors.As(err, &opErr) {
+				err = opErr.Err
+			}
+			fmt.Fprintf(r.out, "op %d failed: %v\ndocument unchanged\n", i, err)
+			return
+		}
+		doc = next
+		opType, _ := op["op"].(string)
+		fmt.Fprintf(r.out, "op %d (%q):\n", i, opType)
+		r.printChanges(before, doc)
+	}
+	r.history = append(r.history, r.doc)
+	r.doc = doc
+}
+
+func (r *repl) undo() {
+	if len(r.history) == 0 {
+		fmt.Fprintln(r.out, "nothing to undo")
+		return
+	}
+	before := r.doc
+	r.doc = r.history[len(r.history)-1]
+	r.history = r.history[:len(r.history)-1]
+	fmt.Fprintln(r.out, "undone:")
+	r.printChanges(before, r.doc)
+}
+
+func (r *repl) query(pointer string) {
+	value, err := jsonpointer.Get(r.doc, pointer)
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+		return
+	}
+	r.print(value)
+}
+
+func (r *repl) print(v any) {
+	if err := writeJSON(r.out, v); err != nil {
+		fmt.Fprintln(r.out, err)
+	}
+}
+
+// printChanges shows what changed between two versions of the document, with
+// removed values prefixed by "-" and added values by "+".
+func (r *repl) printChanges(before, after any) {
+	ops, err := jsonpatch.DiffValue(before, after)
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+		return
+	}
+	if len(ops) == 0 {
+		fmt.Fprintln(r.out, "  (no changes)")
+		return
+	}
+	// The paths of the diff refer to the document as patched by the
+	// operations before them, so old values are read from that.
+	current := cloneJSON(before)
+	for _, op := range ops {
+		path := op["path"].(string)
+		if op["op"] != "add" {
+			old, _ := jsonpointer.Get(current, path)
+			r.line(ansiRed, "-", path, old)
+		}
+		if op["op"] != "remove" {
+			r.line(ansiGreen, "+", path, op["value"])
+		}
+		current, _ = jsonpatch.ApplyValue(current, []map[string]any{op})
+	}
+}
+
+func (r *repl) line(color, sign, path string, value any) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded = []byte(fmt.Sprint(value))
+	}
+	if path == "" {
+		path = "(root)"
+	}
+	text := fmt.Sprintf("  %s %s: %s", sign, path, encoded)
+	if r.color {
+		text = color + text + ansiReset
+	}
+	fmt.Fprintln(r.out, text)
+}
+
+// cloneJSON deep-copies a decoded JSON value.
+func cloneJSON(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, child := range val {
+			out[k] = cloneJSON(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, child := range val {
+			out[i] = cloneJSON(child)
+		}
+		return out
+	default:
+		return val
+	}
+}
+
+// isTerminal reports whether w is a character device such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/jsonpointer"
+)
+
+// Diagnostic codes reported by validate. They are stable so tools can match
+// on them.
+const (
+	codeNotObject     = "not_object"
+	codeMissingField  = "missing_field"
+	codeInvalidType   = "invalid_type"
+	codeUnknownOp     = "unknown_op"
+	codeInvalidEscape = "invalid_pointer_escape"
+)
+
+// problem describes one issue found in a patch without applying it.
+type problem struct {
+	index int
+	op    string
+	// field is the operation member at fault, or "" for the operation itself.
+	field string
+	// segment is the zero-based index of the offending pointer segment, or -1
+	// when the problem is not within a pointer segment.
+	segment int
+	code    string
+	message string
+}
+
+func (p problem) String() string {
+	if p.op == "" {
+		return fmt.Sprintf("op %d: %s", p.index, p.message)
+	}
+	return fmt.Sprintf("op %d (%q): %s", p.index, p.op, p.message)
+}
+
+// diagnostic is the machine-readable form of a problem.
+type diagnostic struct {
+	Index   int    `json:"index"`
+	Op      string `json:"op,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Segment *int   `json:"segment,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (p problem) diagnostic() diagnostic {
+	d := diagnostic{Index: p.index, Op: p.op, Field: p.field, Code: p.code, Message: p.message}
+	if p.segment >= 0 {
+		segment := p.segment
+		d.Segment = &segment
+	}
+	return d
+}
+
+// validatePatch checks ops with jsonpatch.Validate and turns each problem it
+// finds into a problem with a diagnostic code.
+func validatePatch(ops []map[string]any) []problem {
+	var problems []problem
+	for _, e := range validationErrors(jsonpatch.Validate(ops), nil) {
+		p := problem{index: e.Index, op: e.Op, field: e.Member, segment: -1, message: e.Err.Error()}
+		op := ops[e.Index]
+		value, present := op[e.Member]
+		switch {
+		case e.Member == "":
+			p.code = codeNotObject
+		case !present:
+			p.code = codeMissingField
+		case e.Member == "op":
+			p.code = codeUnknownOp
+			if _, ok := value.(string); !ok {
+				p.code = codeInvalidType
+			}
+		case errors.Is(e.Err, jsonpointer.ErrInvalid):
+			p.code = codeInvalidEscape
+			p.segment = invalidSegment(value.(string))
+		default:
+			p.code = codeInvalidType
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// validationErrors appends the ValidationErrors joined in err to errs.
+func validationErrors(err error, errs []*jsonpatch.ValidationError) []*jsonpatch.ValidationError {
+	switch err := err.(type) {
+	case *jsonpatch.ValidationError:
+		return append(errs, err)
+	case interface{ Unwrap() []error }:
+		for _, e := range err.Unwrap() {
+			errs = validationErrors(e, errs)
+		}
+	}
+	return errs
+}
+
+// invalidSegment returns the zero-based index of the first segment of
+// pointer that is not valid, or -1.
+func invalidSegment(pointer string) int {
+	for i, segment := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if _, err := jsonpointer.Parse("/" + segment); err != nil {
+			return i
+		}
+	}
+	return -1
+}
@@ -1,107 +1,493 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/corpus"
 )
 
-// TestCase represents a single test case from JS
+// Patch types accepted in TestCase.PatchType.
+const (
+	patchTypeJSONPatch  = "json-patch"
+	patchTypeMergePatch = "merge-patch"
+)
+
+// TestCase represents a single test case from JS. Documents may have any JSON
+// root (object, array, or scalar).
 type TestCase struct {
-	OriginalDoc map[string]any   `json:"originalDoc"`
-	ExpectedDoc map[string]any   `json:"expectedDoc"`
+	OriginalDoc any              `json:"originalDoc"`
+	ExpectedDoc any              `json:"expectedDoc"`
 	Operations  []map[string]any `json:"operations"`
 	TestID      string           `json:"testId"`
+	// PatchType is "json-patch" (the default when empty) for cases carrying
+	// Operations, or "merge-patch" for RFC 7386 cases carrying MergePatch.
+	PatchType  string `json:"patchType,omitempty"`
+	MergePatch any    `json:"mergePatch,omitempty"`
 }
 
 // TestResult represents the result of applying operations
 type TestResult struct {
-	TestID    string         `json:"testId"`
-	Success   bool           `json:"success"`
-	ResultDoc map[string]any `json:"resultDoc,omitempty"`
-	Error     string         `json:"error,omitempty"`
+	TestID    string `json:"testId"`
+	Success   bool   `json:"success"`
+	ResultDoc any    `json:"resultDoc"`
+	Error     string `json:"error,omitempty"`
+
+	// Metrics, only reported with -metrics. DurationMs and AllocBytes cover
+	// the apply call alone; OpsApplied counts the operations that applied
+	// before the first failure.
+	DurationMs *float64 `json:"durationMs,omitempty"`
+	AllocBytes *uint64  `json:"allocBytes,omitempty"`
+	OpsApplied *int     `json:"opsApplied,omitempty"`
 }
 
-// deepCopy creates a deep copy of a map[string]any
-func deepCopy(original map[string]any) map[string]any {
-	if original == nil {
-		return nil
+// deepCopy creates a deep copy of a JSON value
+func deepCopy(original any) any {
+	switch val := original.(type) {
+	case map[string]any:
+		copy := make(map[string]any, len(val))
+		for k, v := range val {
+			copy[k] = deepCopy(v)
+		}
+		return copy
+	case []interface{}:
+		copy := make([]interface{}, len(val))
+		for i, v := range val {
+			copy[i] = deepCopy(v)
+		}
+		return copy
+	default:
+		return val
 	}
+}
 
-	copy := make(map[string]any)
-	for k, v := range original {
-		switch val := v.(type) {
-		case map[string]any:
-			copy[k] = deepCopy(val)
-		case []interface{}:
-			copy[k] = deepCopySlice(val)
-		default:
-			copy[k] = v
+// job is a decoded test case tagged with its position in the input stream.
+type job struct {
+	seq      int
+	testCase TestCase
+}
+
+// output is a finished result tagged with the position of its test case.
+type output struct {
+	seq    int
+	result TestResult
+}
+
+func main() {
+	workers := flag.Int("workers", runtime.NumCPU(), "number of test cases to apply concurrently")
+	bench := flag.Bool("bench", false, "measure apply latency and allocations and print a JSON summary instead of results")
+	iterations := flag.Int("bench-iterations", 100, "number of times each test case is applied in -bench mode")
+	corpusDir := flag.String("corpus", "", "read test cases from this corpus directory instead of stdin")
+	saveDir := flag.String("save-corpus", "", "also save every input test case to this corpus directory")
+	metrics := flag.Bool("metrics", false, "add durationMs, allocBytes, and opsApplied to every result; implies -workers 1")
+	flag.Parse()
+	if *metrics {
+		// Allocation counters are process-wide, so concurrent cases would
+		// be charged for each other's allocations.
+		workersSet := false
+		flag.Visit(func(f *flag.Flag) { workersSet = workersSet || f.Name == "workers" })
+		if workersSet && *workers != 1 {
+			fmt.Fprintln(os.Stderr, "-metrics requires -workers 1")
+			os.Exit(2)
+		}
+		*workers = 1
+	}
+	if *workers < 1 {
+		fmt.Fprintln(os.Stderr, "-workers must be at least 1")
+		os.Exit(2)
+	}
+	if *bench && *iterations < 1 {
+		fmt.Fprintln(os.Stderr, "-bench-iterations must be at least 1")
+		os.Exit(2)
+	}
+	var input io.Reader = os.Stdin
+	if *corpusDir != "" {
+		r, err := corpusReader(*corpusDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		input = r
+	}
+	if *saveDir != "" {
+		input = savingReader(input, *saveDir)
+	}
+
+	var err error
+	if *bench {
+		err = runBench(input, os.Stdout, *iterations)
+	} else {
+		err = run(input, os.Stdout, *workers, *metrics)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run reads newline-delimited test cases from r, applies them on a pool of
+// workers, and writes one result per case to w in input order. With metrics,
+// each result also reports timing and allocations.
+func run(r io.Reader, w io.Writer, workers int, metrics bool) error {
+	jobs := make(chan job, workers)
+	outputs := make(chan output, workers)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				result := runTestCase(j.testCase)
+				if metrics {
+					result = measureTestCase(j.testCase, result)
+				}
+				outputs <- output{seq: j.seq, result: result}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		decoder := json.NewDecoder(r)
+		for seq := 0; ; seq++ {
+			var testCase TestCase
+			if err := decoder.Decode(&testCase); err != nil {
+				if err == io.EOF {
+					return
+				}
+				// The decoder cannot recover from malformed input, so report
+				// it once and stop reading.
+				outputs <- output{seq: seq, result: TestResult{
+					TestID:  "unknown",
+					Success: false,
+					Error:   fmt.Sprintf("Failed to decode test case: %v", err),
+				}}
+				return
+			}
+			jobs <- job{seq: seq, testCase: testCase}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(outputs)
+	}()
+
+	// Results arrive in completion order; hold them back until every earlier
+	// test case has been written.
+	encoder := json.NewEncoder(w)
+	pending := make(map[int]TestResult)
+	next := 0
+	var writeErr error
+	for out := range outputs {
+		pending[out.seq] = out.result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if writeErr == nil {
+				writeErr = encoder.Encode(result)
+			}
 		}
 	}
-	return copy
+	return writeErr
 }
 
-func deepCopySlice(original []interface{}) []interface{} {
-	if original == nil {
-		return nil
+func runTestCase(testCase TestCase) TestResult {
+	operations, err := caseOperations(testCase)
+	if err != nil {
+		return TestResult{
+			TestID:  testCase.TestID,
+			Success: false,
+			Error:   err.Error(),
+		}
 	}
 
-	copy := make([]interface{}, len(original))
-	for i, v := range original {
-		switch val := v.(type) {
-		case map[string]any:
-			copy[i] = deepCopy(val)
-		case []interface{}:
-			copy[i] = deepCopySlice(val)
-		default:
-			copy[i] = v
+	// Apply the operations, leaving the original document untouched
+	resultDoc, err := jsonpatch.ApplyNew(testCase.OriginalDoc, operations)
+	if err != nil {
+		return TestResult{
+			TestID:  testCase.TestID,
+			Success: false,
+			Error:   fmt.Sprintf("Failed to apply operations: %v", err),
 		}
 	}
-	return copy
+
+	// Return the result
+	return TestResult{
+		TestID:    testCase.TestID,
+		Success:   true,
+		ResultDoc: resultDoc,
+	}
 }
 
-func main() {
-	decoder := json.NewDecoder(os.Stdin)
-	encoder := json.NewEncoder(os.Stdout)
+// caseOperations returns the operations testCase applies: its Operations,
+// or for merge patch cases the JSON Patch equivalent of its MergePatch.
+func caseOperations(testCase TestCase) ([]map[string]any, error) {
+	switch testCase.PatchType {
+	case "", patchTypeJSONPatch:
+		return testCase.Operations, nil
+	case patchTypeMergePatch:
+		operations, err := jsonpatch.MergePatchToPatch(testCase.OriginalDoc, testCase.MergePatch)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert merge patch: %v", err)
+		}
+		return operations, nil
+	default:
+		return nil, fmt.Errorf("Unknown patchType %q", testCase.PatchType)
+	}
+}
+
+// measureTestCase applies testCase again on a fresh copy to record the
+// metrics fields of result. Copying happens outside the measured section.
+func measureTestCase(testCase TestCase, result TestResult) TestResult {
+	// Cases whose operations cannot be built have nothing to measure.
+	operations, _ := caseOperations(testCase)
+	applied := len(operations)
+	if !result.Success {
+		applied = countApplied(testCase.OriginalDoc, operations)
+	}
+
+	doc := deepCopy(testCase.OriginalDoc)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	_, _ = jsonpatch.ApplyValue(doc, operations)
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	durationMs := float64(elapsed.Nanoseconds()) / 1e6
+	allocBytes := after.TotalAlloc - before.TotalAlloc
+	result.DurationMs, result.AllocBytes, result.OpsApplied = &durationMs, &allocBytes, &applied
+	return result
+}
+
+// countApplied returns how many leading operations of a failing case apply
+// to original before the first error.
+func countApplied(original any, operations []map[string]any) int {
+	doc := deepCopy(original)
+	for i, op := range operations {
+		next, err := jsonpatch.ApplyValue(doc, []map[string]any{op})
+		if err != nil {
+			return i
+		}
+		doc = next
+	}
+	return len(operations)
+}
+
+// CaseBenchmark reports how long one test case took to apply in -bench mode.
+type CaseBenchmark struct {
+	TestID         string  `json:"testId"`
+	Success        bool    `json:"success"`
+	Error          string  `json:"error,omitempty"`
+	Operations     int     `json:"operations"`
+	Iterations     int     `json:"iterations"`
+	NsPerApply     float64 `json:"nsPerApply"`
+	AllocsPerApply float64 `json:"allocsPerApply"`
+	BytesPerApply  float64 `json:"bytesPerApply"`
+	// OpsPerSecond counts patch operations, not whole patches.
+	OpsPerSecond float64 `json:"opsPerSecond"`
+}
+
+// BenchSummary is the JSON document printed in -bench mode.
+type BenchSummary struct {
+	Implementation string          `json:"implementation"`
+	Cases          []CaseBenchmark `json:"cases"`
+	Aggregate      BenchAggregate  `json:"aggregate"`
+}
+
+// BenchAggregate totals every successfully applied test case.
+type BenchAggregate struct {
+	Cases          int     `json:"cases"`
+	Failed         int     `json:"failed"`
+	Operations     int     `json:"operations"`
+	TotalNs        int64   `json:"totalNs"`
+	NsPerApply     float64 `json:"nsPerApply"`
+	AllocsPerApply float64 `json:"allocsPerApply"`
+	BytesPerApply  float64 `json:"bytesPerApply"`
+	OpsPerSecond   float64 `json:"opsPerSecond"`
+}
 
+// runBench applies every test case from r iterations times on a single
+// goroutine, so allocation counts are not skewed by other work, and writes a
+// BenchSummary to w.
+func runBench(r io.Reader, w io.Writer, iterations int) error {
+	summary := BenchSummary{Implementation: "go", Cases: []CaseBenchmark{}}
+	var totalNs time.Duration
+	var totalApplies, totalAllocs, totalBytes uint64
+
+	decoder := json.NewDecoder(r)
 	for {
 		var testCase TestCase
 		if err := decoder.Decode(&testCase); err != nil {
-			if err.Error() == "EOF" {
+			if err == io.EOF {
 				break
 			}
-			result := TestResult{
-				TestID:  "unknown",
-				Success: false,
-				Error:   fmt.Sprintf("Failed to decode test case: %v", err),
-			}
-			encoder.Encode(result)
+			return fmt.Errorf("Failed to decode test case: %v", err)
+		}
+
+		result, elapsed, allocs, bytes := benchTestCase(testCase, iterations)
+		summary.Cases = append(summary.Cases, result)
+		if !result.Success {
+			summary.Aggregate.Failed++
 			continue
 		}
+		summary.Aggregate.Cases++
+		summary.Aggregate.Operations += result.Operations
+		totalNs += elapsed
+		totalApplies += uint64(iterations)
+		totalAllocs += allocs
+		totalBytes += bytes
+	}
+
+	if totalApplies > 0 {
+		agg := &summary.Aggregate
+		agg.TotalNs = totalNs.Nanoseconds()
+		agg.NsPerApply = float64(totalNs.Nanoseconds()) / float64(totalApplies)
+		agg.AllocsPerApply = float64(totalAllocs) / float64(totalApplies)
+		agg.BytesPerApply = float64(totalBytes) / float64(totalApplies)
+		if totalNs > 0 {
+			agg.OpsPerSecond = float64(agg.Operations*iterations) / totalNs.Seconds()
+		}
+	}
 
-		// Create a deep copy of the original document
-		docCopy := deepCopy(testCase.OriginalDoc)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
+
+// benchTestCase applies testCase iterations times to fresh copies of its
+// document. Copies are made before measuring so only Apply is counted.
+func benchTestCase(testCase TestCase, iterations int) (CaseBenchmark, time.Duration, uint64, uint64) {
+	// A case that applies cleanly has valid operations.
+	operations, _ := caseOperations(testCase)
+	result := CaseBenchmark{
+		TestID:     testCase.TestID,
+		Operations: len(operations),
+		Iterations: iterations,
+	}
+	if check := runTestCase(testCase); !check.Success {
+		result.Error = check.Error
+		return result, 0, 0, 0
+	}
+
+	docs := make([]any, iterations)
+	for i := range docs {
+		docs[i] = deepCopy(testCase.OriginalDoc)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for _, doc := range docs {
+		// The case already applied cleanly above, so errors cannot occur.
+		_, _ = jsonpatch.ApplyValue(doc, operations)
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	allocs := after.Mallocs - before.Mallocs
+	bytes := after.TotalAlloc - before.TotalAlloc
+	result.Success = true
+	result.NsPerApply = float64(elapsed.Nanoseconds()) / float64(iterations)
+	result.AllocsPerApply = float64(allocs) / float64(iterations)
+	result.BytesPerApply = float64(bytes) / float64(iterations)
+	if elapsed > 0 {
+		result.OpsPerSecond = float64(result.Operations*iterations) / elapsed.Seconds()
+	}
+	return result, elapsed, allocs, bytes
+}
 
-		// Apply the operations
-		if err := jsonpatch.Apply(docCopy, testCase.Operations); err != nil {
-			result := TestResult{
-				TestID:  testCase.TestID,
-				Success: false,
-				Error:   fmt.Sprintf("Failed to apply operations: %v", err),
+// corpusReader loads a corpus directory and returns its cases in the stdin
+// test case format, named after their directories.
+func corpusReader(dir string) (io.Reader, error) {
+	cases, err := corpus.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, c := range cases {
+		testCase := TestCase{
+			TestID:      c.Name,
+			OriginalDoc: c.Original,
+			ExpectedDoc: c.Expected,
+			Operations:  c.Patch,
+		}
+		if err := encoder.Encode(testCase); err != nil {
+			return nil, err
+		}
+	}
+	return &buf, nil
+}
+
+// savingReader passes r through unchanged while saving every test case read
+// from it to the corpus directory dir. Cases with an expected document keep
+// it as expected.json. Malformed input is left for the consumer to report.
+func savingReader(r io.Reader, dir string) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		decoder := json.NewDecoder(io.TeeReader(r, pw))
+		for seq := 0; ; seq++ {
+			var testCase TestCase
+			if err := decoder.Decode(&testCase); err != nil {
+				// Whatever the decoder read has already been passed on; forward
+				// the rest so the consumer sees all input.
+				_, err = io.Copy(pw, r)
+				pw.CloseWithError(err)
+				return
+			}
+			if testCase.PatchType != "" && testCase.PatchType != patchTypeJSONPatch {
+				// The corpus format only holds JSON Patch operations.
+				continue
+			}
+			name := corpusName(testCase.TestID, seq)
+			err := corpus.SaveCase(filepath.Join(dir, name), corpus.Case{
+				Name:        name,
+				Original:    testCase.OriginalDoc,
+				Patch:       testCase.Operations,
+				Expected:    testCase.ExpectedDoc,
+				HasExpected: testCase.ExpectedDoc != nil,
+				Meta:        corpus.Meta{Source: "test-harness"},
+			})
+			if err != nil {
+				pw.CloseWithError(fmt.Errorf("save corpus case %q: %w", name, err))
+				return
 			}
-			encoder.Encode(result)
-			continue
 		}
+	}()
+	return pr
+}
 
-		// Return the result
-		result := TestResult{
-			TestID:    testCase.TestID,
-			Success:   true,
-			ResultDoc: docCopy,
+// corpusName turns a test ID into a directory name, falling back to the
+// input position when the ID is empty.
+func corpusName(testID string, seq int) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '-'
 		}
-		encoder.Encode(result)
+	}, testID)
+	if strings.Trim(name, ".") == "" {
+		return fmt.Sprintf("case-%d", seq)
 	}
+	return name
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRunPreservesInputOrder(t *testing.T) {
+	var input strings.Builder
+	const count = 200
+	for i := 0; i < count; i++ {
+		ops := `[{"op": "inc", "path": "/n", "inc": 1}]`
+		if i%7 == 0 {
+			ops = `[{"op": "remove", "path": "/missing"}]`
+		}
+		fmt.Fprintf(&input, `{"testId": "case-%d", "originalDoc": {"n": %d}, "operations": %s}`+"\n", i, i, ops)
+	}
+
+	var out bytes.Buffer
+	if err := run(strings.NewReader(input.String()), &out, 8, false); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+
+	decoder := json.NewDecoder(&out)
+	for i := 0; i < count; i++ {
+		var result TestResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatalf("decode result %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("case-%d", i); result.TestID != want {
+			t.Fatalf("result %d has testId %q, want %q", i, result.TestID, want)
+		}
+		if result.Success == (i%7 == 0) {
+			t.Fatalf("result %d has success %v: %+v", i, result.Success, result)
+		}
+	}
+	if decoder.More() {
+		t.Fatalf("unexpected extra output")
+	}
+}
+
+func TestRunReportsMalformedInput(t *testing.T) {
+	input := `{"testId": "ok", "originalDoc": {}, "operations": []}` + "\n{not json\n"
+	var out bytes.Buffer
+	if err := run(strings.NewReader(input), &out, 2, false); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 results, got %d: %q", len(lines), out.String())
+	}
+	if !strings.Contains(lines[1], "Failed to decode test case") {
+		t.Fatalf("expected decode failure, got %q", lines[1])
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	input := `{"testId": "a", "originalDoc": {"n": 0}, "operations": [{"op": "inc", "path": "/n", "inc": 1}, {"op": "add", "path": "/s", "value": "x"}]}
+{"testId": "b", "originalDoc": [], "operations": [{"op": "remove", "path": "/0"}]}
+`
+	var out bytes.Buffer
+	if err := runBench(strings.NewReader(input), &out, 5); err != nil {
+		t.Fatalf("runBench returned error: %v", err)
+	}
+
+	var summary BenchSummary
+	if err := json.Unmarshal(out.Bytes(), &summary); err != nil {
+		t.Fatalf("decode summary: %v\n%s", err, out.String())
+	}
+	if len(summary.Cases) != 2 {
+		t.Fatalf("expected 2 case results, got %+v", summary.Cases)
+	}
+	if c := summary.Cases[0]; !c.Success || c.Operations != 2 || c.Iterations != 5 || c.NsPerApply <= 0 {
+		t.Fatalf("unexpected benchmark for successful case: %+v", c)
+	}
+	if c := summary.Cases[1]; c.Success || c.Error == "" {
+		t.Fatalf("expected failing case to report its error: %+v", c)
+	}
+	if agg := summary.Aggregate; agg.Cases != 1 || agg.Failed != 1 || agg.Operations != 2 {
+		t.Fatalf("unexpected aggregate: %+v", agg)
+	}
+}
+
+func TestSaveAndReplayCorpus(t *testing.T) {
+	dir := t.TempDir()
+	input := `{"testId": "a/b", "originalDoc": {"n": 1}, "expectedDoc": {"n": 2}, "operations": [{"op": "inc", "path": "/n", "inc": 1}]}
+{"testId": "", "originalDoc": [], "operations": [{"op": "remove", "path": "/0"}]}
+`
+	var first bytes.Buffer
+	if err := run(savingReader(strings.NewReader(input), dir), &first, 2, false); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+
+	r, err := corpusReader(dir)
+	if err != nil {
+		t.Fatalf("corpusReader returned error: %v", err)
+	}
+	var replay bytes.Buffer
+	if err := run(r, &replay, 2, false); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	expected := `{"testId":"a-b","success":true,"resultDoc":{"n":2}}
+{"testId":"case-1","success":false,"resultDoc":null,"error":"Failed to apply operations: op 0 {\"op\": \"remove\", \"path\": \"/0\"}: index 0 out of bounds for \"remove\" op at path \"/0\" (slice len 0)"}
+`
+	if replay.String() != expected {
+		t.Fatalf("unexpected replay output:\n%s\nfirst run:\n%s", replay.String(), first.String())
+	}
+}
+
+func TestRunPatchTypes(t *testing.T) {
+	input := `{"testId": "default", "originalDoc": {}, "operations": [{"op": "add", "path": "/a", "value": 1}]}
+{"testId": "explicit", "patchType": "json-patch", "originalDoc": {}, "operations": [{"op": "add", "path": "/a", "value": 1}]}
+{"testId": "merge", "patchType": "merge-patch", "originalDoc": {"a": 1}, "mergePatch": {"a": null}}
+{"testId": "bogus", "patchType": "xml-patch", "originalDoc": {}}
+`
+	var out bytes.Buffer
+	if err := run(strings.NewReader(input), &out, 2, false); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	decoder := json.NewDecoder(&out)
+	for _, want := range []struct {
+		id      string
+		success bool
+		doc     string
+		err     string
+	}{
+		{"default", true, `{"a":1}`, ""},
+		{"explicit", true, `{"a":1}`, ""},
+		{"merge", true, `{}`, ""},
+		{"bogus", false, `null`, `Unknown patchType "xml-patch"`},
+	} {
+		var result TestResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatalf("decode result: %v", err)
+		}
+		if result.TestID != want.id || result.Success != want.success || !strings.Contains(result.Error, want.err) {
+			t.Fatalf("unexpected result for %q: %+v", want.id, result)
+		}
+		if doc, _ := json.Marshal(result.ResultDoc); string(doc) != want.doc {
+			t.Fatalf("unexpected document for %q: %s", want.id, doc)
+		}
+	}
+}
+
+func TestRunMetrics(t *testing.T) {
+	input := `{"testId": "ok", "originalDoc": {"n": 0}, "operations": [{"op": "inc", "path": "/n", "inc": 1}, {"op": "add", "path": "/s", "value": "x"}]}
+{"testId": "fails", "originalDoc": {"n": 0}, "operations": [{"op": "inc", "path": "/n", "inc": 1}, {"op": "remove", "path": "/missing"}, {"op": "inc", "path": "/n", "inc": 1}]}
+`
+	var out bytes.Buffer
+	if err := run(strings.NewReader(input), &out, 1, true); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	decoder := json.NewDecoder(&out)
+	for _, wantApplied := range []int{2, 1} {
+		var result TestResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		if result.DurationMs == nil || result.AllocBytes == nil || result.OpsApplied == nil {
+			t.Fatalf("expected metrics fields, got %+v", result)
+		}
+		if *result.OpsApplied != wantApplied {
+			t.Fatalf("%s: opsApplied = %d, want %d", result.TestID, *result.OpsApplied, wantApplied)
+		}
+	}
+
+	out.Reset()
+	if err := run(strings.NewReader(input), &out, 1, false); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	if strings.Contains(out.String(), "durationMs") {
+		t.Fatalf("expected no metrics without the flag, got %s", out.String())
+	}
+}
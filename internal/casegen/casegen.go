@@ -0,0 +1,230 @@
+// Package casegen generates random JSON documents and patches against them.
+// All choices are drawn from a Source, so the same source state always yields
+// the same case; fuzz inputs and seeded PRNGs can both drive it.
+package casegen
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Source supplies the random choices made by the generator.
+type Source interface {
+	// Intn returns a value in [0, n). n is always positive.
+	Intn(n int) int
+}
+
+// ByteSource draws choices from a byte slice, typically fuzzer input. Once
+// the bytes are exhausted every choice is 0, so generation always terminates.
+type ByteSource struct {
+	data []byte
+	pos  int
+}
+
+// NewByteSource returns a Source reading from data.
+func NewByteSource(data []byte) *ByteSource {
+	return &ByteSource{data: data}
+}
+
+// Intn implements Source.
+func (s *ByteSource) Intn(n int) int {
+	if n <= 1 || s.pos >= len(s.data) {
+		return 0
+	}
+	v := int(s.data[s.pos])
+	s.pos++
+	if n > 256 && s.pos < len(s.data) {
+		v = v<<8 | int(s.data[s.pos])
+		s.pos++
+	}
+	return v % n
+}
+
+// RandSource draws choices from a seeded PCG generator.
+type RandSource struct {
+	r *rand.Rand
+}
+
+// NewRandSource returns a Source seeded with (seed, stream). Distinct streams
+// give independent sequences, so case N of a seed can be generated without
+// generating the cases before it.
+func NewRandSource(seed, stream uint64) *RandSource {
+	return &RandSource{r: rand.New(rand.NewPCG(seed, stream))}
+}
+
+// Intn implements Source.
+func (s *RandSource) Intn(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	return s.r.IntN(n)
+}
+
+// Strings used for generated string values. They mix ASCII, characters
+// outside the BMP, and combining sequences to exercise UTF-16 offsets.
+var Strings = []string{
+	"",
+	"Hello World",
+	"Hello 🌍 World",
+	"こんにちは世界",
+	"Héllo Wörld",
+	"𝕳𝖊𝖑𝖑𝖔",
+	"🚀🌟💫",
+	"👨‍💻👩‍🔬",
+	"a/b~c",
+}
+
+// Keys used for generated object members, including ones that need escaping
+// in JSON Pointers.
+var Keys = []string{"a", "b", "text", "count", "list", "0", "a/b", "m~n", ""}
+
+// Ops lists the operations Patch chooses from.
+var Ops = []string{"add", "remove", "replace", "move", "copy", "test", "str_ins", "str_del", "inc"}
+
+// Config bounds the size of generated cases.
+type Config struct {
+	MaxDepth  int
+	MaxWidth  int
+	MaxOps    int
+	Strings   []string
+	Ops       []string
+	ObjectDoc bool // always generate an object at the root
+}
+
+// DefaultConfig is used by callers that do not need a specific profile.
+var DefaultConfig = Config{MaxDepth: 3, MaxWidth: 4, MaxOps: 6}
+
+func (c Config) strings() []string {
+	if len(c.Strings) > 0 {
+		return c.Strings
+	}
+	return Strings
+}
+
+func (c Config) ops() []string {
+	if len(c.Ops) > 0 {
+		return c.Ops
+	}
+	return Ops
+}
+
+// Value generates a JSON value no deeper than depth. Numbers are always
+// integers so results do not depend on floating-point formatting.
+func (c Config) Value(src Source, depth int) any {
+	kinds := 6
+	if depth <= 0 {
+		kinds = 4
+	}
+	switch src.Intn(kinds) {
+	case 0:
+		return src.Intn(200) - 100
+	case 1:
+		strs := c.strings()
+		return strs[src.Intn(len(strs))]
+	case 2:
+		return src.Intn(2) == 1
+	case 3:
+		return nil
+	case 4:
+		n := src.Intn(c.MaxWidth + 1)
+		arr := make([]any, n)
+		for i := range arr {
+			arr[i] = c.Value(src, depth-1)
+		}
+		return arr
+	default:
+		return c.Object(src, depth-1)
+	}
+}
+
+// Object generates a JSON object no deeper than depth.
+func (c Config) Object(src Source, depth int) map[string]any {
+	n := src.Intn(c.MaxWidth + 1)
+	obj := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		obj[Keys[src.Intn(len(Keys))]] = c.Value(src, depth)
+	}
+	return obj
+}
+
+// Document generates a document root.
+func (c Config) Document(src Source) any {
+	if c.ObjectDoc || src.Intn(4) != 0 {
+		return c.Object(src, c.MaxDepth)
+	}
+	return c.Value(src, c.MaxDepth)
+}
+
+// Patch generates operations targeting paths that exist in doc, with an
+// occasional path that does not so error handling is exercised too.
+func (c Config) Patch(src Source, doc any) []map[string]any {
+	paths := Paths(doc)
+	pick := func() string {
+		if src.Intn(8) == 0 {
+			return "/missing/" + strconv.Itoa(src.Intn(3))
+		}
+		return paths[src.Intn(len(paths))]
+	}
+	ops := c.ops()
+	n := 1 + src.Intn(c.MaxOps)
+	patch := make([]map[string]any, 0, n)
+	for i := 0; i < n; i++ {
+		name := ops[src.Intn(len(ops))]
+		path := pick()
+		op := map[string]any{"op": name, "path": path}
+		switch name {
+		case "add":
+			if src.Intn(3) == 0 {
+				op["path"] = path + "/" + escape(Keys[src.Intn(len(Keys))])
+			}
+			op["value"] = c.Value(src, 1)
+		case "replace", "test":
+			op["value"] = c.Value(src, 1)
+		case "move", "copy":
+			op["from"] = pick()
+		case "str_ins":
+			op["pos"] = src.Intn(12)
+			strs := c.strings()
+			op["str"] = strs[src.Intn(len(strs))]
+		case "str_del":
+			op["pos"] = src.Intn(12)
+			op["len"] = src.Intn(4)
+		case "inc":
+			op["inc"] = src.Intn(21) - 10
+		}
+		patch = append(patch, op)
+	}
+	return patch
+}
+
+// Paths lists the pointers of every value in doc, including the root.
+func Paths(doc any) []string {
+	paths := []string{""}
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		switch t := v.(type) {
+		case map[string]any:
+			for k, child := range t {
+				p := prefix + "/" + escape(k)
+				paths = append(paths, p)
+				walk(p, child)
+			}
+		case []any:
+			for i, child := range t {
+				p := prefix + "/" + strconv.Itoa(i)
+				paths = append(paths, p)
+				walk(p, child)
+			}
+		}
+	}
+	walk("", doc)
+	// Map iteration order is random; sort so a Source replays identically.
+	slices.Sort(paths)
+	return paths
+}
+
+func escape(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1")
+}
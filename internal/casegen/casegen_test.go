@@ -0,0 +1,120 @@
+package casegen
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerationIsDeterministic(t *testing.T) {
+	data := []byte("deterministic fuzz input with enough entropy for a few ops")
+	gen := func() (any, []map[string]any) {
+		src := NewByteSource(data)
+		doc := DefaultConfig.Document(src)
+		return doc, DefaultConfig.Patch(src, doc)
+	}
+
+	doc1, ops1 := gen()
+	doc2, ops2 := gen()
+	if !reflect.DeepEqual(doc1, doc2) || !reflect.DeepEqual(ops1, ops2) {
+		t.Fatalf("same input produced different cases:\n%v %v\n%v %v", doc1, ops1, doc2, ops2)
+	}
+	if len(ops1) == 0 {
+		t.Fatalf("expected at least one op")
+	}
+}
+
+func TestExhaustedSourceTerminates(t *testing.T) {
+	src := NewByteSource(nil)
+	doc := DefaultConfig.Document(src)
+	ops := DefaultConfig.Patch(src, doc)
+	if len(ops) != 1 {
+		t.Fatalf("expected a single op from an empty source, got %v", ops)
+	}
+}
+
+func TestPathsEscapesKeys(t *testing.T) {
+	paths := Paths(map[string]any{"a/b": []any{1}, "m~n": 2})
+	expected := []string{"", "/a~1b", "/a~1b/0", "/m~0n"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Paths = %q, want %q", paths, expected)
+	}
+	for _, p := range paths {
+		if strings.Contains(p, "//") {
+			t.Fatalf("unexpected empty segment in %q", p)
+		}
+	}
+}
+
+func TestMutateCopiesAndIsDeterministic(t *testing.T) {
+	doc := map[string]any{"text": "a😀b", "list": []any{1, 2}}
+	patch := []map[string]any{
+		{"op": "str_ins", "path": "/text", "pos": 1, "str": "x"},
+		{"op": "remove", "path": "/list/1"},
+	}
+	data := []byte("structured mutation input with plenty of choices to make")
+
+	first := DefaultConfig.Mutate(NewByteSource(data), doc, patch)
+	second := DefaultConfig.Mutate(NewByteSource(data), doc, patch)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("same input produced different mutations:\n%v\n%v", first, second)
+	}
+	if patch[0]["pos"] != 1 || patch[1]["path"] != "/list/1" || len(patch) != 2 {
+		t.Fatalf("Mutate modified its input: %v", patch)
+	}
+}
+
+func TestMutateReachesBoundaries(t *testing.T) {
+	doc := map[string]any{"text": "a😀b", "list": []any{1, 2}}
+	patch := []map[string]any{{"op": "str_ins", "path": "/text", "pos": 0, "str": "x"}}
+
+	surrogateMiddle, pastEnd := false, false
+	for seed := 0; seed < 4096 && !(surrogateMiddle && pastEnd); seed++ {
+		data := []byte{byte(seed), byte(seed >> 4), byte(seed >> 8), byte(seed * 7), byte(seed * 13)}
+		for _, op := range DefaultConfig.Mutate(NewByteSource(data), doc, patch) {
+			if op["op"] != "str_ins" || op["path"] != "/text" {
+				continue
+			}
+			switch op["pos"] {
+			case 2:
+				surrogateMiddle = true
+			case 5:
+				pastEnd = true
+			}
+		}
+	}
+	if !surrogateMiddle || !pastEnd {
+		t.Fatalf("expected offsets inside a surrogate pair and past the end, got %v and %v", surrogateMiddle, pastEnd)
+	}
+}
+
+func TestPerturbIndex(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 7; i++ {
+		seen[perturbIndex(NewByteSource([]byte{byte(i)}), "/list/3")] = true
+	}
+	for _, want := range []string{"/list/-", "/list/0", "/list/-1", "/list/01", "/list/2", "/list/4", "/list/1003"} {
+		if !seen[want] {
+			t.Fatalf("expected %q among perturbed indices, got %v", want, seen)
+		}
+	}
+	if got := perturbIndex(NewByteSource(nil), "/text"); got != "/text/0" {
+		t.Fatalf("expected an index to be appended to a key segment, got %q", got)
+	}
+}
+
+func TestRandSourceStreams(t *testing.T) {
+	gen := func(seed, stream uint64) any {
+		return DefaultConfig.Document(NewRandSource(seed, stream))
+	}
+	if !reflect.DeepEqual(gen(42, 7), gen(42, 7)) {
+		t.Fatalf("same seed and stream produced different documents")
+	}
+	differs := false
+	for stream := uint64(0); stream < 8 && !differs; stream++ {
+		differs = !reflect.DeepEqual(gen(42, stream), gen(42, stream+1))
+	}
+	if !differs {
+		t.Fatalf("expected different streams to produce different documents")
+	}
+}
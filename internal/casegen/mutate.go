@@ -0,0 +1,174 @@
+package casegen
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/jsonpointer"
+)
+
+// Mutate returns a copy of patch with a few structured changes applied: op
+// types toggled, array indices and UTF-16 offsets nudged across boundaries,
+// paths retargeted, and ops duplicated, dropped, or reordered. Choices come
+// from src, so when src reads fuzzer input the engine's byte-level mutations
+// turn into op-level ones while coverage guidance still applies. doc is the
+// document the patch targets and is only read.
+func (c Config) Mutate(src Source, doc any, patch []map[string]any) []map[string]any {
+	out := make([]map[string]any, len(patch))
+	for i, op := range patch {
+		out[i] = copyOp(op)
+	}
+	paths := Paths(doc)
+	n := 1 + src.Intn(4)
+	for i := 0; i < n; i++ {
+		if len(out) == 0 {
+			out = append(out, c.Patch(src, doc)...)
+			continue
+		}
+		idx := src.Intn(len(out))
+		op := out[idx]
+		switch src.Intn(8) {
+		case 0:
+			c.toggleOp(src, op, paths)
+		case 1:
+			field := "path"
+			if _, ok := op["from"]; ok && src.Intn(2) == 0 {
+				field = "from"
+			}
+			if p, ok := op[field].(string); ok {
+				op[field] = perturbIndex(src, p)
+			}
+		case 2:
+			op["pos"] = perturbOffset(src, doc, op)
+		case 3:
+			perturbAmount(src, op)
+		case 4:
+			retarget(src, op, paths)
+		case 5:
+			out = append(out[:idx+1], out[idx:]...)
+			out[idx+1] = copyOp(op)
+		case 6:
+			out = append(out[:idx], out[idx+1:]...)
+		default:
+			if idx+1 < len(out) {
+				out[idx], out[idx+1] = out[idx+1], out[idx]
+			}
+		}
+	}
+	return out
+}
+
+func copyOp(op map[string]any) map[string]any {
+	out := make(map[string]any, len(op))
+	for k, v := range op {
+		out[k] = v
+	}
+	return out
+}
+
+// toggleOp switches op to a different type and fills in the fields the new
+// type needs, keeping its path.
+func (c Config) toggleOp(src Source, op map[string]any, paths []string) {
+	ops := c.ops()
+	name := ops[src.Intn(len(ops))]
+	op["op"] = name
+	switch name {
+	case "add", "replace", "test":
+		if _, ok := op["value"]; !ok {
+			op["value"] = c.Value(src, 1)
+		}
+	case "move", "copy":
+		if _, ok := op["from"].(string); !ok {
+			op["from"] = paths[src.Intn(len(paths))]
+		}
+	case "str_ins":
+		if _, ok := op["pos"]; !ok {
+			op["pos"] = src.Intn(12)
+		}
+		if _, ok := op["str"].(string); !ok {
+			strs := c.strings()
+			op["str"] = strs[src.Intn(len(strs))]
+		}
+	case "str_del":
+		if _, ok := op["pos"]; !ok {
+			op["pos"] = src.Intn(12)
+		}
+		if _, ok := op["len"]; !ok {
+			op["len"] = src.Intn(4)
+		}
+	case "inc":
+		if _, ok := op["inc"]; !ok {
+			op["inc"] = src.Intn(21) - 10
+		}
+	}
+}
+
+// perturbIndex rewrites the last array-index-like segment of pointer to a
+// nearby or boundary value, or appends one when there is none.
+func perturbIndex(src Source, pointer string) string {
+	cut := strings.LastIndexByte(pointer, '/')
+	if cut < 0 {
+		return pointer
+	}
+	last := pointer[cut+1:]
+	index, err := strconv.Atoi(last)
+	if err != nil && last != "-" {
+		return pointer + []string{"/0", "/-", "/1"}[src.Intn(3)]
+	}
+	candidates := []string{"-", "0", "-1", "01", strconv.Itoa(index - 1), strconv.Itoa(index + 1), strconv.Itoa(index + 1000)}
+	return pointer[:cut+1] + candidates[src.Intn(len(candidates))]
+}
+
+// perturbOffset picks a UTF-16 position near an interesting point of the
+// string targeted by op: its ends, the middle of a surrogate pair, or just
+// past the end.
+func perturbOffset(src Source, doc any, op map[string]any) int {
+	current, _ := op["pos"].(int)
+	path, _ := op["path"].(string)
+	text, _ := lookup(doc, path).(string)
+	units := utf16.Encode([]rune(text))
+
+	candidates := []int{0, current - 1, current + 1, len(units), len(units) + 1, -1}
+	for i, u := range units {
+		if utf16.IsSurrogate(rune(u)) && i+1 < len(units) {
+			candidates = append(candidates, i+1)
+			break
+		}
+	}
+	return candidates[src.Intn(len(candidates))]
+}
+
+// perturbAmount changes the numeric len or inc field of op.
+func perturbAmount(src Source, op map[string]any) {
+	field := "len"
+	if op["op"] == "inc" {
+		field = "inc"
+	}
+	current, _ := op[field].(int)
+	candidates := []int{0, current - 1, current + 1, -current, 1 << 20}
+	op[field] = candidates[src.Intn(len(candidates))]
+}
+
+// retarget points op at another existing path, a child of one, or swaps its
+// path and from.
+func retarget(src Source, op map[string]any, paths []string) {
+	switch src.Intn(3) {
+	case 0:
+		if from, ok := op["from"]; ok {
+			op["from"], op["path"] = op["path"], from
+			return
+		}
+		fallthrough
+	case 1:
+		op["path"] = paths[src.Intn(len(paths))]
+	default:
+		op["path"] = paths[src.Intn(len(paths))] + "/" + escape(Keys[src.Intn(len(Keys))])
+	}
+}
+
+// lookup returns the value at pointer in doc, or nil if it does not exist.
+func lookup(doc any, pointer string) any {
+	value, _ := jsonpointer.Get(doc, pointer)
+	return value
+}
@@ -0,0 +1,71 @@
+package jsonpatch
+
+import (
+	"context"
+	"time"
+)
+
+// AuditLog is a trail of the field-level changes made by patches. Pass one
+// in Options.Audit to have entries appended to it, so that one log can
+// collect the changes of several patches.
+type AuditLog struct {
+	Entries []AuditEntry
+}
+
+// AuditEntry records one value a patch added, removed or replaced.
+type AuditEntry struct {
+	// Time is when the operation was applied.
+	Time time.Time
+	// Actor is who applied the patch, as set on its context by WithActor,
+	// or "" if it was not set.
+	Actor string
+	// Index is the position of the operation in the patch, and Op its
+	// type, such as "replace".
+	Index int
+	Op    string
+	// Path, Kind, Old and New describe the change as Change does.
+	Path     string
+	Kind     ChangeKind
+	Old, New any
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying actor, the user or service on
+// whose behalf a patch is applied, for ApplyContextWithOptions to record in
+// Options.Audit.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set on ctx by WithActor, or "".
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// audit appends the changes made by op, the operation at index i, to the
+// audit log.
+func (a *applier) audit(i int, op map[string]any, changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	now := time.Now()
+	var actor string
+	if a.ctx != nil {
+		actor = ActorFrom(a.ctx)
+	}
+	name, _ := op["op"].(string)
+	for _, c := range changes {
+		a.opts.Audit.Entries = append(a.opts.Audit.Entries, AuditEntry{
+			Time:  now,
+			Actor: actor,
+			Index: i,
+			Op:    name,
+			Path:  c.Path,
+			Kind:  c.Kind,
+			Old:   c.Old,
+			New:   c.New,
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package jsonpatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestApplyAudit(t *testing.T) {
+	doc := map[string]any{"name": "alice", "tags": []any{"a"}}
+	var log AuditLog
+	ctx := WithActor(context.Background(), "user-7")
+	start := time.Now()
+	err := ApplyContextWithOptions(ctx, doc, []map[string]any{
+		{"op": "replace", "path": "/name", "value": "bob"},
+		{"op": "test", "path": "/name", "value": "bob"},
+		{"op": "add", "path": "/tags/-", "value": "b"},
+		{"op": "replace", "path": "/name", "value": "bob"},
+	}, Options{Audit: &log})
+	if err != nil {
+		t.Fatalf("ApplyContextWithOptions returned error: %v", err)
+	}
+	if len(log.Entries) != 2 {
+		t.Fatalf("expected two entries, got %+v", log.Entries)
+	}
+	for _, e := range log.Entries {
+		if e.Actor != "user-7" || e.Time.Before(start) {
+			t.Fatalf("expected an entry by user-7 stamped now, got %+v", e)
+		}
+	}
+	first, second := log.Entries[0], log.Entries[1]
+	if first.Index != 0 || first.Op != "replace" || first.Path != "/name" || first.Kind != ChangeReplaced || first.Old != "alice" || first.New != "bob" {
+		t.Fatalf("unexpected first entry %+v", first)
+	}
+	if second.Index != 2 || second.Op != "add" || second.Path != "/tags/1" || second.Kind != ChangeAdded || second.New != "b" {
+		t.Fatalf("unexpected second entry %+v", second)
+	}
+
+	// Entries are appended, and a failed atomic patch or a dry run adds none.
+	if err := ApplyWithOptions(doc, []map[string]any{{"op": "remove", "path": "/tags/0"}}, Options{Audit: &log}); err != nil {
+		t.Fatalf("ApplyWithOptions returned error: %v", err)
+	}
+	if len(log.Entries) != 3 || log.Entries[2].Actor != "" || log.Entries[2].Kind != ChangeRemoved {
+		t.Fatalf("expected a third entry without an actor, got %+v", log.Entries)
+	}
+	failing := []map[string]any{{"op": "replace", "path": "/name", "value": "carol"}, {"op": "remove", "path": "/missing"}}
+	if err := ApplyWithOptions(doc, failing, Options{Audit: &log, Atomic: true}); !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("expected the patch to fail, got %v", err)
+	}
+	if err := ApplyWithOptions(doc, failing[:1], Options{Audit: &log, DryRun: true}); err != nil {
+		t.Fatalf("dry run returned error: %v", err)
+	}
+	if len(log.Entries) != 3 {
+		t.Fatalf("expected no new entries, got %+v", log.Entries[3:])
+	}
+}
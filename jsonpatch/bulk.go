@@ -0,0 +1,56 @@
+package jsonpatch
+
+import (
+	"runtime"
+	"sync"
+)
+
+// BulkOptions configures ApplyBulk.
+type BulkOptions struct {
+	// Options are used for every document. Index, Report and Audit belong
+	// to a single document and are ignored. Hooks such as Sanitize are called
+	// from several goroutines at once, and Documents may only be copied
+	// from, since a move would modify them concurrently.
+	Options
+	// Workers is the number of documents patched at once. Zero or less
+	// means runtime.GOMAXPROCS(0).
+	Workers int
+}
+
+// ApplyBulk applies the same operations to each of docs, in place, using a
+// pool of workers, as migration jobs patching many records do. It returns
+// one error per document, nil where the patch applied; a document whose
+// patch fails is left as far as the failing operation took it, as with
+// ApplyWithOptions. Each document gets its own copy of the values the
+// operations write, so the documents share no maps or slices afterwards.
+func ApplyBulk(docs []map[string]any, operations []map[string]any, opts BulkOptions) []error {
+	opts.Index, opts.Report, opts.Audit = nil, nil, nil
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(docs))
+
+	errs := make([]error, len(docs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				ops := make([]map[string]any, len(operations))
+				for j, op := range operations {
+					ops[j] = deepCopyValue(op).(map[string]any)
+				}
+				errs[i] = ApplyWithOptions(docs[i], ops, opts.Options)
+			}
+		}()
+	}
+	for i := range docs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,53 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApplyBulk(t *testing.T) {
+	docs := make([]map[string]any, 100)
+	for i := range docs {
+		docs[i] = map[string]any{"n": float64(i), "tags": []any{}}
+	}
+	docs[7] = map[string]any{"tags": []any{}}
+	ops := []map[string]any{
+		{"op": "add", "path": "/meta", "value": map[string]any{"version": float64(2)}},
+		{"op": "add", "path": "/tags/-", "value": "migrated"},
+		{"op": "inc", "path": "/n", "inc": float64(1)},
+	}
+	errs := ApplyBulk(docs, ops, BulkOptions{Workers: 4})
+	if len(errs) != len(docs) {
+		t.Fatalf("expected %d results, got %d", len(docs), len(errs))
+	}
+	for i, err := range errs {
+		if i == 7 {
+			var opErr *OpError
+			if !errors.As(err, &opErr) || opErr.Index != 2 || !errors.Is(err, ErrPathNotFound) {
+				t.Fatalf("expected the inc of document 7 to fail, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("document %d: %v", i, err)
+		}
+		expected := map[string]any{"n": i + 1, "tags": []any{"migrated"}, "meta": map[string]any{"version": float64(2)}}
+		if !reflect.DeepEqual(docs[i], expected) {
+			t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", docs[i], expected)
+		}
+	}
+
+	// Documents do not share the values the patch wrote.
+	docs[0]["meta"].(map[string]any)["version"] = float64(3)
+	if docs[1]["meta"].(map[string]any)["version"] != float64(2) {
+		t.Fatal("documents share values written by the patch")
+	}
+	if ops[0]["value"].(map[string]any)["version"] != float64(2) {
+		t.Fatal("the patch was modified")
+	}
+
+	if errs := ApplyBulk(nil, ops, BulkOptions{}); len(errs) != 0 {
+		t.Fatalf("expected no results for no documents, got %v", errs)
+	}
+}
@@ -0,0 +1,46 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// ApplyBytes applies a patch given as JSON to a document given as JSON and
+// returns the patched document as JSON, for callers holding both as bytes
+// from the wire. The document may have any root, as with ApplyValue.
+//
+// Numbers are decoded as json.Number, so those the patch does not touch are
+// written back exactly as they were, however large or precise, and inc adds
+// whole numbers exactly up to the int64 range. The output is compact, with
+// object members sorted by name and without HTML escaping, so equal
+// documents always encode to equal bytes.
+func ApplyBytes(doc, patch []byte) ([]byte, error) {
+	var value any
+	if err := decodeWithNumbers(doc, &value); err != nil {
+		return nil, err
+	}
+	var ops []map[string]any
+	if err := decodeWithNumbers(patch, &ops); err != nil {
+		return nil, err
+	}
+	value, err := ApplyValue(value, ops)
+	if err != nil {
+		return nil, err
+	}
+	return marshalNoEscape(value)
+}
+
+// decodeWithNumbers decodes a single JSON value from data into v, keeping
+// numbers as json.Number.
+func decodeWithNumbers(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
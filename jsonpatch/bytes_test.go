@@ -0,0 +1,65 @@
+package jsonpatch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestApplyBytes(t *testing.T) {
+	tests := []struct {
+		name          string
+		doc, patch    string
+		expected      string
+		expectedError string
+	}{
+		{
+			"sorted compact output",
+			`{"b": 1, "a": {"d": "<x>", "c": [1, 2]}}`,
+			`[{"op": "add", "path": "/a/c/-", "value": 3}]`,
+			`{"a":{"c":[1,2,3],"d":"<x>"},"b":1}`,
+			"",
+		},
+		{
+			"numbers kept exactly",
+			`{"id": 12345678901234567890, "price": 1.10, "n": 1}`,
+			`[{"op": "inc", "path": "/n", "inc": 2}, {"op": "test", "path": "/price", "value": 1.1}]`,
+			`{"id":12345678901234567890,"n":3,"price":1.10}`,
+			"",
+		},
+		{
+			"string positions",
+			`{"s": "hello"}`,
+			`[{"op": "str_ins", "path": "/s", "pos": 5, "str": "!"}, {"op": "str_del", "path": "/s", "pos": 0, "len": 1}]`,
+			`{"s":"ello!"}`,
+			"",
+		},
+		{"array root", `[1, 2]`, `[{"op": "remove", "path": "/0"}]`, `[2]`, ""},
+		{"failing op", `{"a": 1}`, `[{"op": "remove", "path": "/b"}]`, "", `path segment "b" not found`},
+		{"invalid document", `{"a": }`, `[]`, "", "invalid character"},
+		{"trailing data", `{"a": 1} {}`, `[]`, "", "after top-level value"},
+		{"invalid patch", `{}`, `{"op": "add"}`, "", "cannot unmarshal object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ApplyBytes([]byte(tt.doc), []byte(tt.patch))
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyBytes returned error: %v", err)
+			}
+			if string(out) != tt.expected {
+				t.Fatalf("Documents not equal.\nGot: %s\nExpected: %s", out, tt.expected)
+			}
+		})
+	}
+
+	_, err := ApplyBytes([]byte(`{"a": 1}`), []byte(`[{"op": "test", "path": "/a", "value": 2}]`))
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("expected ErrTestFailed, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package jsonpatch
+
+import "strings"
+
+// cachedContainer records a container reached while resolving a pointer along
+// with the container that owns it, so slice updates can be reassigned.
+type cachedContainer struct {
+	container   any
+	parent      any
+	parentKey   string
+	parentIndex int
+}
+
+// pathCache memoizes containers resolved during a single Apply call. Keys are
+// pointer prefixes without the leading "/" (e.g. "a/b" for "/a/b").
+type pathCache struct {
+	entries map[string]cachedContainer
+}
+
+func newPathCache() *pathCache {
+	return &pathCache{entries: make(map[string]cachedContainer)}
+}
+
+// lookup returns the deepest cached container owning a proper prefix of
+// trimmed, together with the offset of the "/" that ends that prefix.
+func (c *pathCache) lookup(trimmed string) (cachedContainer, int, bool) {
+	if len(c.entries) == 0 {
+		return cachedContainer{}, 0, false
+	}
+	end := len(trimmed)
+	for {
+		end = strings.LastIndexByte(trimmed[:end], '/')
+		if end < 0 {
+			return cachedContainer{}, 0, false
+		}
+		if entry, ok := c.entries[trimmed[:end]]; ok {
+			return entry, end, true
+		}
+	}
+}
+
+func (c *pathCache) store(prefix string, entry cachedContainer) {
+	switch entry.container.(type) {
+	case map[string]any, []any:
+		c.entries[prefix] = entry
+	}
+}
+
+// invalidate drops the cached container at pathRaw and everything below it.
+// The empty pointer clears the whole cache.
+func (c *pathCache) invalidate(pathRaw string) {
+	if c == nil || len(c.entries) == 0 {
+		return
+	}
+	prefix := strings.TrimPrefix(pathRaw, "/")
+	if pathRaw == "" {
+		clear(c.entries)
+		return
+	}
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) && (len(key) == len(prefix) || key[len(prefix)] == '/') {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// invalidateTarget drops cache entries affected by a mutation at pathRaw. When
+// the mutated container is a slice, the slice itself was reassigned and the
+// indices of its elements may have shifted, so its whole subtree is dropped.
+func (c *pathCache) invalidateTarget(pathRaw string, parentContainer any) {
+	if c == nil {
+		return
+	}
+	if _, isSlice := parentContainer.([]any); isSlice {
+		c.invalidate(parentPointer(pathRaw))
+		return
+	}
+	c.invalidate(pathRaw)
+}
+
+// parentPointer returns the pointer to the container owning the last segment.
+func parentPointer(pathRaw string) string {
+	idx := strings.LastIndexByte(pathRaw, '/')
+	if idx <= 0 {
+		return ""
+	}
+	return pathRaw[:idx]
+}
@@ -0,0 +1,116 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathCacheLookupAndInvalidate(t *testing.T) {
+	leaf := map[string]any{"x": 1}
+	doc := map[string]any{"a": map[string]any{"b": map[string]any{"c": leaf}}}
+	cache := newPathCache()
+
+	if _, _, _, _, _, _, err := resolvePathCached(doc, "/a/b/c/x", cache); err != nil {
+		t.Fatalf("resolvePathCached returned error: %v", err)
+	}
+	for _, key := range []string{"a", "a/b", "a/b/c"} {
+		if _, ok := cache.entries[key]; !ok {
+			t.Fatalf("expected cache entry for %q, got %v", key, cache.entries)
+		}
+	}
+
+	entry, end, ok := cache.lookup("a/b/c/y")
+	if !ok || end != len("a/b/c") {
+		t.Fatalf("expected hit ending at %d, got %d ok %v", len("a/b/c"), end, ok)
+	}
+	if !reflect.DeepEqual(entry.container, leaf) || entry.parentKey != "c" {
+		t.Fatalf("unexpected cache entry: %+v", entry)
+	}
+
+	cache.invalidate("/a/b")
+	if _, ok := cache.entries["a/b/c"]; ok {
+		t.Fatalf("expected %q to be invalidated", "a/b/c")
+	}
+	if _, ok := cache.entries["a"]; !ok {
+		t.Fatalf("expected %q to survive invalidation of a sibling subtree", "a")
+	}
+
+	cache.invalidate("")
+	if len(cache.entries) != 0 {
+		t.Fatalf("expected empty cache after root invalidation, got %v", cache.entries)
+	}
+}
+
+func TestPathCacheSkipsScalars(t *testing.T) {
+	cache := newPathCache()
+	cache.store("a", cachedContainer{container: "leaf"})
+	if len(cache.entries) != 0 {
+		t.Fatalf("expected scalar values not to be cached, got %v", cache.entries)
+	}
+}
+
+func TestApplyCacheInvalidation(t *testing.T) {
+	testCases := []struct {
+		name        string
+		initialDoc  map[string]any
+		ops         []map[string]any
+		expectedDoc map[string]any
+	}{
+		{
+			name:       "replace subtree then write below it",
+			initialDoc: map[string]any{"a": map[string]any{"b": map[string]any{"c": 1}}},
+			ops: []map[string]any{
+				{"op": "replace", "path": "/a/b/c", "value": 2},
+				{"op": "replace", "path": "/a/b", "value": map[string]any{"c": 10}},
+				{"op": "inc", "path": "/a/b/c", "inc": 1},
+			},
+			expectedDoc: map[string]any{"a": map[string]any{"b": map[string]any{"c": 11}}},
+		},
+		{
+			name:       "slice growth is visible to later ops",
+			initialDoc: map[string]any{"list": []any{map[string]any{"n": 0}}},
+			ops: []map[string]any{
+				{"op": "add", "path": "/list/0", "value": map[string]any{"n": 5}},
+				{"op": "inc", "path": "/list/1/n", "inc": 1},
+				{"op": "add", "path": "/list/-", "value": 7},
+				{"op": "replace", "path": "/list/0/n", "value": 6},
+			},
+			expectedDoc: map[string]any{"list": []any{map[string]any{"n": 6}, map[string]any{"n": 1}, 7}},
+		},
+		{
+			name: "move between nested slices",
+			initialDoc: map[string]any{
+				"m": []any{[]any{"a", "b"}, []any{"c"}},
+			},
+			ops: []map[string]any{
+				{"op": "move", "from": "/m/0/0", "path": "/m/1/-"},
+				{"op": "add", "path": "/m/0/-", "value": "d"},
+				{"op": "remove", "path": "/m/0"},
+				{"op": "add", "path": "/m/0/0", "value": "z"},
+			},
+			expectedDoc: map[string]any{"m": []any{[]any{"z", "c", "a"}}},
+		},
+		{
+			name:       "root replace clears cache",
+			initialDoc: map[string]any{"a": map[string]any{"b": 1}},
+			ops: []map[string]any{
+				{"op": "replace", "path": "/a/b", "value": 2},
+				{"op": "replace", "path": "", "value": map[string]any{"a": map[string]any{"b": 3}}},
+				{"op": "inc", "path": "/a/b", "inc": 1},
+			},
+			expectedDoc: map[string]any{"a": map[string]any{"b": 4}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := deepCopyDoc(tc.initialDoc)
+			if err := Apply(doc, tc.ops); err != nil {
+				t.Fatalf("Apply returned error: %v", err)
+			}
+			if !reflect.DeepEqual(doc, tc.expectedDoc) {
+				t.Fatalf("Documents not equal.\nGot:      %v\nExpected: %v", doc, tc.expectedDoc)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package collab
+
+import "slices"
+
+// Batch is a group of envelopes for one document, broadcast as a unit. After
+// lists the Seq of the batches that must be applied first: the batch
+// continues Doc from the previous batch for Doc, and it holds patches made
+// after patches in the other batches.
+type Batch struct {
+	Seq       uint64     `json:"seq"`
+	Doc       string     `json:"doc"`
+	After     []uint64   `json:"after,omitempty"`
+	Envelopes []Envelope `json:"envelopes"`
+}
+
+// Batcher groups outgoing envelopes by document between flushes without
+// breaking causal order across documents. Envelopes from the same origin are
+// taken to happen in the order they are added, whatever their document, and
+// envelopes for the same document stay in the order they are added. It is not
+// safe for concurrent use.
+type Batcher struct {
+	seq uint64
+	// batches holds the batches since the last flush, in the order they were
+	// sealed, followed by the open ones in the order they were started.
+	batches []*pendingBatch
+	// docs and origins map documents and origins to the batch holding their
+	// latest envelope since the last flush.
+	docs    map[string]*pendingBatch
+	origins map[string]*pendingBatch
+}
+
+type pendingBatch struct {
+	Batch
+	// sealed batches take no more envelopes. A batch is sealed before
+	// another batch links to it, so links always point to earlier batches.
+	sealed bool
+}
+
+// NewBatcher returns an empty batcher.
+func NewBatcher() *Batcher {
+	return &Batcher{docs: map[string]*pendingBatch{}, origins: map[string]*pendingBatch{}}
+}
+
+// Add queues e for doc.
+func (bt *Batcher) Add(doc string, e Envelope) {
+	prev := bt.origins[e.Origin]
+	if prev != nil && prev.Doc != doc && !prev.sealed {
+		bt.seal(prev)
+	}
+	b := bt.docs[doc]
+	if b == nil || b.sealed {
+		bt.seq++
+		next := &pendingBatch{Batch: Batch{Seq: bt.seq, Doc: doc}}
+		if b != nil {
+			next.After = append(next.After, b.Seq)
+		}
+		b = next
+		bt.batches = append(bt.batches, b)
+		bt.docs[doc] = b
+	}
+	if prev != nil && prev != b && !slices.Contains(b.After, prev.Seq) {
+		b.After = append(b.After, prev.Seq)
+	}
+	b.Envelopes = append(b.Envelopes, e)
+	bt.origins[e.Origin] = b
+}
+
+// Len returns the number of envelopes queued.
+func (bt *Batcher) Len() int {
+	n := 0
+	for _, b := range bt.batches {
+		n += len(b.Envelopes)
+	}
+	return n
+}
+
+// Flush returns the queued batches in an order that respects their After
+// links and empties the batcher. Batches from earlier flushes are assumed to
+// have been applied, so they are not linked to.
+func (bt *Batcher) Flush() []Batch {
+	batches := make([]Batch, len(bt.batches))
+	for i, b := range bt.batches {
+		batches[i] = b.Batch
+	}
+	bt.batches = nil
+	clear(bt.docs)
+	clear(bt.origins)
+	return batches
+}
+
+// seal closes b and moves it after the batches sealed before it.
+func (bt *Batcher) seal(b *pendingBatch) {
+	b.sealed = true
+	i := slices.Index(bt.batches, b)
+	bt.batches = slices.Delete(bt.batches, i, i+1)
+	j := slices.IndexFunc(bt.batches, func(p *pendingBatch) bool { return !p.sealed })
+	if j < 0 {
+		j = len(bt.batches)
+	}
+	bt.batches = slices.Insert(bt.batches, j, b)
+}
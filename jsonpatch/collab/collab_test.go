@@ -0,0 +1,403 @@
+package collab
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// network delivers updates to a server and commits back to sessions, one
+// message at a time, so tests control how they interleave.
+type network struct {
+	t        *testing.T
+	server   *Server
+	sessions []*Session
+	updates  []Update
+	inboxes  [][]Commit
+}
+
+func newNetwork(t *testing.T, doc any, clients int) *network {
+	n := &network{t: t, server: NewServer(doc), inboxes: make([][]Commit, clients)}
+	for i := range clients {
+		snapshot, version := n.server.Snapshot()
+		n.sessions = append(n.sessions, NewSession(fmt.Sprintf("client-%d", i), snapshot, version, func(u Update) error {
+			n.updates = append(n.updates, u)
+			return nil
+		}))
+	}
+	return n
+}
+
+// deliverUpdate submits the oldest update and queues the commit for every
+// session.
+func (n *network) deliverUpdate() {
+	u := n.updates[0]
+	n.updates = n.updates[1:]
+	c, err := n.server.Submit(u)
+	if err != nil {
+		n.t.Fatalf("submit: %v", err)
+	}
+	for i := range n.inboxes {
+		n.inboxes[i] = append(n.inboxes[i], c)
+	}
+}
+
+func (n *network) deliverCommit(i int) {
+	c := n.inboxes[i][0]
+	n.inboxes[i] = n.inboxes[i][1:]
+	if err := n.sessions[i].Receive(c); err != nil {
+		n.t.Fatalf("client %d receive %d: %v", i, c.Seq, err)
+	}
+}
+
+func (n *network) drain() {
+	for len(n.updates) > 0 || n.hasCommits() {
+		if len(n.updates) > 0 {
+			n.deliverUpdate()
+		}
+		for i := range n.inboxes {
+			for len(n.inboxes[i]) > 0 {
+				n.deliverCommit(i)
+			}
+		}
+	}
+}
+
+func (n *network) hasCommits() bool {
+	for _, inbox := range n.inboxes {
+		if len(inbox) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *network) checkConverged() {
+	n.t.Helper()
+	want, _ := n.server.Snapshot()
+	for i, s := range n.sessions {
+		if s.Pending() {
+			n.t.Fatalf("client %d still has pending patches", i)
+		}
+		if got := s.Document(); !reflect.DeepEqual(got, want) {
+			n.t.Fatalf("client %d diverged:\n got %v\nwant %v", i, got, want)
+		}
+	}
+}
+
+func TestSessionsConverge(t *testing.T) {
+	n := newNetwork(t, map[string]any{"text": "hello", "items": []any{}}, 2)
+	alice, bob := n.sessions[0], n.sessions[1]
+
+	if err := alice.Apply([]jsonpatch.Operation{{"op": "str_ins", "path": "/text", "pos": float64(5), "str": " world"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Apply([]jsonpatch.Operation{{"op": "str_ins", "path": "/text", "pos": float64(0), "str": "oh, "}}); err != nil {
+		t.Fatal(err)
+	}
+	// Buffered behind bob's in-flight update.
+	if err := bob.Apply([]jsonpatch.Operation{{"op": "add", "path": "/items/0", "value": "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := alice.Document().(map[string]any)["text"]; got != "hello world" {
+		t.Fatalf("local patch not applied optimistically: %q", got)
+	}
+	if len(n.updates) != 2 {
+		t.Fatalf("expected one update in flight per client, got %d", len(n.updates))
+	}
+
+	n.drain()
+	n.checkConverged()
+	want := map[string]any{"text": "oh, hello world", "items": []any{"b"}}
+	if doc, version := n.server.Snapshot(); !reflect.DeepEqual(doc, want) || version != 3 {
+		t.Fatalf("unexpected server state %v at version %d", doc, version)
+	}
+}
+
+func TestSessionsConvergeOnConcurrentReplace(t *testing.T) {
+	n := newNetwork(t, map[string]any{"k": "A"}, 2)
+	alice, bob := n.sessions[0], n.sessions[1]
+
+	if err := alice.Apply([]jsonpatch.Operation{{"op": "replace", "path": "/k", "value": "B"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Apply([]jsonpatch.Operation{{"op": "replace", "path": "/k", "value": "C"}}); err != nil {
+		t.Fatal(err)
+	}
+	n.drain()
+	n.checkConverged()
+	// Alice's replace was committed first, so Bob's is rebased onto it and
+	// loses.
+	if doc, _ := n.server.Snapshot(); !reflect.DeepEqual(doc, map[string]any{"k": "B"}) {
+		t.Fatalf("unexpected server document %v", doc)
+	}
+}
+
+func TestSessionsConvergeOnConcurrentArrayMoves(t *testing.T) {
+	n := newNetwork(t, map[string]any{"list": []any{"a", "b", "c", "d"}}, 2)
+	alice, bob := n.sessions[0], n.sessions[1]
+
+	if err := alice.Apply([]jsonpatch.Operation{{"op": "move", "from": "/list/1", "path": "/list/2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Apply([]jsonpatch.Operation{{"op": "move", "from": "/list/0", "path": "/list/3"}}); err != nil {
+		t.Fatal(err)
+	}
+	// Buffered behind each client's in-flight move.
+	if err := alice.Apply([]jsonpatch.Operation{{"op": "add", "path": "/list/3", "value": "v"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Apply([]jsonpatch.Operation{{"op": "remove", "path": "/list/3"}}); err != nil {
+		t.Fatal(err)
+	}
+	n.drain()
+	n.checkConverged()
+	want := map[string]any{"list": []any{"c", "b", "v", "d"}}
+	if doc, _ := n.server.Snapshot(); !reflect.DeepEqual(doc, want) {
+		t.Fatalf("unexpected server document %v", doc)
+	}
+}
+
+func TestSessionsConvergeRandomly(t *testing.T) {
+	for seed := range uint64(20) {
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			rng := rand.New(rand.NewPCG(seed, 0))
+			n := newNetwork(t, map[string]any{"text": "abc", "items": []any{"x", "y"}, "fields": map[string]any{"a": "x"}}, 3)
+			for step := 0; step < 200; step++ {
+				switch r := rng.IntN(4); {
+				case r == 0 && len(n.updates) > 0:
+					n.deliverUpdate()
+				case r == 1:
+					if i := rng.IntN(len(n.sessions)); len(n.inboxes[i]) > 0 {
+						n.deliverCommit(i)
+					}
+				default:
+					i := rng.IntN(len(n.sessions))
+					if err := n.sessions[i].Apply(randomEdit(rng, n.sessions[i].Document().(map[string]any))); err != nil {
+						t.Fatalf("client %d: %v", i, err)
+					}
+				}
+			}
+			n.drain()
+			n.checkConverged()
+		})
+	}
+}
+
+// randomEdit returns a patch that applies to doc: a string insertion or
+// deletion in "text", an insertion, replacement, removal or move in "items",
+// or an add, replace, removal or rename of a member of "fields".
+func randomEdit(rng *rand.Rand, doc map[string]any) []jsonpatch.Operation {
+	text := doc["text"].(string)
+	items := doc["items"].([]any)
+	fields := doc["fields"].(map[string]any)
+	names := slices.Sorted(maps.Keys(fields))
+	keys := []string{"a", "b", "c", "d"}
+	switch rng.IntN(10) {
+	case 0:
+		return []jsonpatch.Operation{{"op": "str_ins", "path": "/text", "pos": float64(rng.IntN(len(text) + 1)), "str": string(rune('a' + rng.IntN(26)))}}
+	case 1:
+		if len(text) > 0 {
+			pos := rng.IntN(len(text))
+			return []jsonpatch.Operation{{"op": "str_del", "path": "/text", "pos": float64(pos), "len": float64(1 + rng.IntN(len(text)-pos))}}
+		}
+	case 2:
+		if len(items) > 0 {
+			return []jsonpatch.Operation{{"op": "remove", "path": fmt.Sprintf("/items/%d", rng.IntN(len(items)))}}
+		}
+	case 3:
+		if len(items) > 0 {
+			return []jsonpatch.Operation{{"op": "replace", "path": fmt.Sprintf("/items/%d", rng.IntN(len(items))), "value": float64(rng.IntN(100))}}
+		}
+	case 4:
+		return []jsonpatch.Operation{{"op": "add", "path": "/fields/" + keys[rng.IntN(len(keys))], "value": float64(rng.IntN(100))}}
+	case 5:
+		if len(names) > 0 {
+			return []jsonpatch.Operation{{"op": "replace", "path": "/fields/" + names[rng.IntN(len(names))], "value": float64(rng.IntN(100))}}
+		}
+	case 6:
+		if len(names) > 0 {
+			return []jsonpatch.Operation{{"op": "remove", "path": "/fields/" + names[rng.IntN(len(names))]}}
+		}
+	case 7:
+		var free []string
+		for _, k := range keys {
+			if _, ok := fields[k]; !ok {
+				free = append(free, k)
+			}
+		}
+		if len(names) > 0 && len(free) > 0 {
+			return []jsonpatch.Operation{{"op": "move", "from": "/fields/" + names[rng.IntN(len(names))], "path": "/fields/" + free[rng.IntN(len(free))]}}
+		}
+	case 8:
+		if len(items) > 0 {
+			return []jsonpatch.Operation{{"op": "move", "from": fmt.Sprintf("/items/%d", rng.IntN(len(items))), "path": fmt.Sprintf("/items/%d", rng.IntN(len(items)))}}
+		}
+	}
+	return []jsonpatch.Operation{{"op": "add", "path": fmt.Sprintf("/items/%d", rng.IntN(len(items)+1)), "value": float64(rng.IntN(100))}}
+}
+
+func TestSessionReceive(t *testing.T) {
+	s := NewSession("a", map[string]any{}, 3, func(Update) error { return nil })
+	if err := s.Receive(Commit{Seq: 5, ClientID: "b", Patch: []jsonpatch.Operation{}}); !errors.Is(err, ErrMissedCommit) {
+		t.Fatalf("expected ErrMissedCommit, got %v", err)
+	}
+	if err := s.Receive(Commit{Seq: 3, ClientID: "b", Patch: []jsonpatch.Operation{{"op": "add", "path": "/x", "value": 1}}}); err != nil || s.Version() != 3 {
+		t.Fatalf("an old commit must be ignored, got %v at version %d", err, s.Version())
+	}
+}
+
+func TestSessionReject(t *testing.T) {
+	var sent []Update
+	s := NewSession("a", map[string]any{"n": float64(1)}, 0, func(u Update) error {
+		sent = append(sent, u)
+		return nil
+	})
+	if err := s.Apply([]jsonpatch.Operation{{"op": "replace", "path": "/n", "value": float64(2)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Apply([]jsonpatch.Operation{{"op": "add", "path": "/m", "value": float64(3)}}); err != nil {
+		t.Fatal(err)
+	}
+	s.Reject(sent[0].ID)
+	if got := s.Document(); !reflect.DeepEqual(got, map[string]any{"n": float64(1)}) || s.Pending() {
+		t.Fatalf("expected the confirmed document without pending patches, got %v", got)
+	}
+}
+
+func TestServerSubmit(t *testing.T) {
+	server := NewServer(map[string]any{"list": []any{"a", "b"}})
+	if _, err := server.Submit(Update{ClientID: "a", ID: 1, Base: 0, Patch: []jsonpatch.Operation{{"op": "remove", "path": "/list/0"}}}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := server.Submit(Update{ClientID: "b", ID: 1, Base: 0, Patch: []jsonpatch.Operation{{"op": "replace", "path": "/list/1", "value": "B"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Seq != 2 || !reflect.DeepEqual(c.Patch, []jsonpatch.Operation{{"op": "replace", "path": "/list/0", "value": "B"}}) {
+		t.Fatalf("unexpected commit %+v", c)
+	}
+	if _, err := server.Submit(Update{ClientID: "c", ID: 1, Base: 7}); err == nil {
+		t.Fatal("expected an error for an unknown base version")
+	}
+	if _, err := server.Submit(Update{ClientID: "c", ID: 2, Base: 2, Patch: []jsonpatch.Operation{{"op": "remove", "path": "/missing"}}}); err == nil {
+		t.Fatal("expected an error for a patch that does not apply")
+	}
+	if commits, err := server.Since(1); err != nil || len(commits) != 1 || commits[0].ClientID != "b" {
+		t.Fatalf("unexpected commits %v, %v", commits, err)
+	}
+}
+
+func TestServerDedupe(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := NewServerWithOptions(map[string]any{"n": 0}, ServerOptions{
+		Dedupe: DedupeWindow{Duration: time.Hour, MaxKeys: 2},
+		Now:    func() time.Time { return now },
+	})
+	inc := func(key string) Commit {
+		t.Helper()
+		_, version := server.Snapshot()
+		c, err := server.Submit(Update{ClientID: "a", ID: uint64(version + 1), Base: version, Key: key, Patch: []jsonpatch.Operation{{"op": "inc", "path": "/n", "inc": 1}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	count := func() any {
+		doc, _ := server.Snapshot()
+		return doc.(map[string]any)["n"]
+	}
+
+	first := inc("k1")
+	if retry := inc("k1"); retry.Seq != first.Seq || count() != 1 {
+		t.Fatalf("retry was applied again: commit %d, n = %v", retry.Seq, count())
+	}
+	inc("")
+	inc("")
+	if count() != 3 {
+		t.Fatalf("updates without a key must always apply, n = %v", count())
+	}
+
+	// k1 expires after an hour.
+	now = now.Add(time.Hour)
+	if c := inc("k1"); c.Seq != 4 || count() != 4 {
+		t.Fatalf("expired key was deduplicated: commit %d, n = %v", c.Seq, count())
+	}
+
+	// Only the two newest keys are remembered.
+	inc("k2")
+	inc("k3")
+	if c := inc("k2"); c.Seq != 5 {
+		t.Fatalf("expected the commit of k2, got %d", c.Seq)
+	}
+	if c := inc("k1"); c.Seq != 7 || count() != 7 {
+		t.Fatalf("evicted key was deduplicated: commit %d, n = %v", c.Seq, count())
+	}
+}
+
+func TestSessionReconnect(t *testing.T) {
+	server := NewServer(map[string]any{"items": []any{"x"}})
+	var online bool
+	a := NewSession("a", map[string]any{"items": []any{"x"}}, 0, func(u Update) error {
+		if !online {
+			return errors.New("offline")
+		}
+		_, err := server.Submit(u)
+		return err
+	})
+	var b *Session
+	b = NewSession("b", map[string]any{"items": []any{"x"}}, 0, func(u Update) error {
+		c, err := server.Submit(u)
+		if err != nil {
+			return err
+		}
+		return b.Receive(c)
+	})
+
+	// The first update is lost with the connection; the others queue up.
+	if err := a.Apply([]jsonpatch.Operation{{"op": "add", "path": "/items/0", "value": "a1"}}); err == nil {
+		t.Fatal("expected the first send to fail")
+	}
+	a.Disconnect()
+	for _, v := range []string{"a2", "a3"} {
+		if err := a.Apply([]jsonpatch.Operation{{"op": "add", "path": "/items/-", "value": v}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Apply([]jsonpatch.Operation{{"op": "add", "path": "/items/0", "value": "b1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	online = true
+	if err := a.Reconnect(server.Since); err != nil {
+		t.Fatal(err)
+	}
+	// The in-flight update was resent; deliver its commit and the queued
+	// patches sent after it.
+	for a.Pending() {
+		commits, err := server.Since(a.Version())
+		if err != nil || len(commits) == 0 {
+			t.Fatalf("expected commits for the pending patches, got %v, %v", commits, err)
+		}
+		for _, c := range commits {
+			if err := a.Receive(c); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	expected := map[string]any{"items": []any{"b1", "a1", "x", "a2", "a3"}}
+	doc, version := server.Snapshot()
+	if !reflect.DeepEqual(doc, expected) || version != 3 {
+		t.Fatalf("unexpected server document %v at %d", doc, version)
+	}
+	if got := a.Document(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("session did not converge: %v", got)
+	}
+}
@@ -0,0 +1,193 @@
+package collab
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrStaleUpdate is returned by Hub.Submit for an update older than the last
+// one committed for its client.
+var ErrStaleUpdate = errors.New("stale update")
+
+// Hub delivers a Server's commits to sessions at least once over unreliable
+// connections. It keeps a position in the commit log for every client:
+// commits after the client's cumulative acknowledgement stay queued and are
+// sent again when the client reconnects or on Resend, and a retried update
+// is committed only once. Client IDs must not be reused by new sessions,
+// since the hub recognizes retries by their update IDs. It is safe for
+// concurrent use.
+type Hub struct {
+	server *Server
+
+	mu      sync.Mutex
+	clients map[string]*hubClient
+}
+
+type hubClient struct {
+	send func(Commit) error // nil while disconnected
+	// conn counts connects and disconnects, so a delivery can tell that the
+	// connection it was using was replaced.
+	conn int
+	// acked is the Seq the client acknowledged having received everything
+	// up to, and next the Seq of the next commit to send on the current
+	// connection.
+	acked, next int64
+	// delivering is set while a goroutine sends commits to the client. Other
+	// goroutines, including sends made from within send, leave the commits
+	// to it.
+	delivering bool
+	// lastID and lastSeq identify the client's last committed update.
+	lastID  uint64
+	lastSeq int64
+}
+
+// NewHub returns a hub delivering the commits of server.
+func NewHub(server *Server) *Hub {
+	return &Hub{server: server, clients: map[string]*hubClient{}}
+}
+
+// Connect attaches a connection to the client, which has received every
+// commit up to version (see Session.Version), and sends it the commits after
+// that. Later commits are sent as they are made. A send error is taken to
+// mean the connection is gone: the client is disconnected until it connects
+// again.
+func (h *Hub) Connect(clientID string, version int64, send func(Commit) error) error {
+	if _, latest := h.server.Snapshot(); version < 0 || version > latest {
+		return fmt.Errorf("client %q resumes from unknown version %d (latest is %d)", clientID, version, latest)
+	}
+	h.mu.Lock()
+	c := h.client(clientID)
+	c.send = send
+	c.conn++
+	c.acked = max(c.acked, version)
+	c.next = version + 1
+	h.mu.Unlock()
+	h.deliver(clientID)
+	return nil
+}
+
+// Disconnect detaches the client's connection. Its unacknowledged commits
+// stay queued.
+func (h *Hub) Disconnect(clientID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c, ok := h.clients[clientID]; ok {
+		c.send = nil
+		c.conn++
+	}
+}
+
+// Ack records that the client has received every commit up to seq.
+func (h *Hub) Ack(clientID string, seq int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.client(clientID)
+	c.acked = max(c.acked, seq)
+	c.next = max(c.next, seq+1)
+}
+
+// Unacked returns the commits the client has not acknowledged yet.
+func (h *Hub) Unacked(clientID string) ([]Commit, error) {
+	h.mu.Lock()
+	acked := h.client(clientID).acked
+	h.mu.Unlock()
+	return h.server.Since(acked)
+}
+
+// Resend sends the client's unacknowledged commits again, for a client that
+// has not acknowledged them in time.
+func (h *Hub) Resend(clientID string) {
+	h.mu.Lock()
+	c := h.client(clientID)
+	c.next = c.acked + 1
+	c.conn++ // a delivery in progress starts over
+	h.mu.Unlock()
+	h.deliver(clientID)
+}
+
+// Submit commits u through the server and sends the commit to every
+// connected client. A retry of the client's last committed update returns
+// the original commit without committing again; older updates fail with
+// ErrStaleUpdate. Rejected updates are handled as for Server.Submit.
+func (h *Hub) Submit(u Update) (Commit, error) {
+	h.mu.Lock()
+	c := h.client(u.ClientID)
+	switch {
+	case u.ID == c.lastID && c.lastSeq > 0:
+		seq := c.lastSeq
+		h.mu.Unlock()
+		commits, err := h.server.Since(seq - 1)
+		if err != nil {
+			return Commit{}, err
+		}
+		return commits[0], nil
+	case u.ID < c.lastID:
+		h.mu.Unlock()
+		return Commit{}, fmt.Errorf("%w: update %d from %q (last committed is %d)", ErrStaleUpdate, u.ID, u.ClientID, c.lastID)
+	}
+	// The lock is held across Server.Submit so that a retry racing the
+	// original update is not committed twice.
+	commit, err := h.server.Submit(u)
+	if err != nil {
+		h.mu.Unlock()
+		return Commit{}, err
+	}
+	c.lastID, c.lastSeq = u.ID, commit.Seq
+	ids := make([]string, 0, len(h.clients))
+	for id, client := range h.clients {
+		if client.send != nil {
+			ids = append(ids, id)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, id := range ids {
+		h.deliver(id)
+	}
+	return commit, nil
+}
+
+func (h *Hub) client(clientID string) *hubClient {
+	c, ok := h.clients[clientID]
+	if !ok {
+		c = &hubClient{next: 1}
+		h.clients[clientID] = c
+	}
+	return c
+}
+
+// deliver sends the client the commits from its next position on, unless
+// another call is already doing so. It is called with h.mu unlocked.
+func (h *Hub) deliver(clientID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.clients[clientID]
+	if c.delivering {
+		return
+	}
+	c.delivering = true
+	defer func() { c.delivering = false }()
+	for c.send != nil {
+		commits, err := h.server.Since(c.next - 1)
+		if err != nil || len(commits) == 0 {
+			return
+		}
+		send, conn := c.send, c.conn
+		for _, commit := range commits {
+			h.mu.Unlock()
+			err := send(commit)
+			h.mu.Lock()
+			if c.conn != conn {
+				// The client reconnected meanwhile and starts over.
+				break
+			}
+			if err != nil {
+				c.send = nil
+				c.conn++
+				return
+			}
+			c.next = max(c.next, commit.Seq+1)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package collab
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// flakyNetwork connects sessions to a hub over connections that lose and
+// duplicate messages.
+type flakyNetwork struct {
+	t        *testing.T
+	rng      *rand.Rand
+	reliable bool
+	hub      *Hub
+	server   *Server
+	sessions []*Session
+	updates  []Update
+	inboxes  [][]Commit
+}
+
+func newFlakyNetwork(t *testing.T, rng *rand.Rand, doc any, clients int) *flakyNetwork {
+	n := &flakyNetwork{t: t, rng: rng, server: NewServer(doc), inboxes: make([][]Commit, clients)}
+	n.hub = NewHub(n.server)
+	for i := range clients {
+		snapshot, version := n.server.Snapshot()
+		n.sessions = append(n.sessions, NewSession(n.clientID(i), snapshot, version, func(u Update) error {
+			if n.lossy() {
+				return nil // lost on the way
+			}
+			n.updates = append(n.updates, u)
+			if n.lossy() {
+				n.updates = append(n.updates, u)
+			}
+			return nil
+		}))
+		n.connect(i)
+	}
+	return n
+}
+
+func (n *flakyNetwork) clientID(i int) string {
+	return fmt.Sprintf("client-%d", i)
+}
+
+func (n *flakyNetwork) lossy() bool {
+	return !n.reliable && n.rng.IntN(8) == 0
+}
+
+// connect (re)connects client i and resends its in-flight update.
+func (n *flakyNetwork) connect(i int) {
+	err := n.hub.Connect(n.clientID(i), n.sessions[i].Version(), func(c Commit) error {
+		if n.lossy() {
+			return errors.New("connection lost")
+		}
+		n.inboxes[i] = append(n.inboxes[i], c)
+		return nil
+	})
+	if err != nil {
+		n.t.Fatalf("connect %d: %v", i, err)
+	}
+	if err := n.sessions[i].Resend(); err != nil {
+		n.t.Fatalf("resend %d: %v", i, err)
+	}
+}
+
+func (n *flakyNetwork) deliverUpdate() {
+	u := n.updates[0]
+	n.updates = n.updates[1:]
+	if _, err := n.hub.Submit(u); err != nil && !errors.Is(err, ErrStaleUpdate) {
+		n.t.Fatalf("submit: %v", err)
+	}
+}
+
+func (n *flakyNetwork) deliverCommit(i int) {
+	c := n.inboxes[i][0]
+	n.inboxes[i] = n.inboxes[i][1:]
+	if err := n.sessions[i].Receive(c); err != nil {
+		n.t.Fatalf("client %d receive %d: %v", i, c.Seq, err)
+	}
+	if !n.lossy() {
+		n.hub.Ack(n.clientID(i), n.sessions[i].Version())
+	}
+}
+
+func TestHubDeliversOverFlakyConnections(t *testing.T) {
+	for seed := range uint64(20) {
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			rng := rand.New(rand.NewPCG(seed, 1))
+			n := newFlakyNetwork(t, rng, map[string]any{"text": "abc", "items": []any{"x", "y"}, "fields": map[string]any{"a": "x"}}, 3)
+			for step := 0; step < 300; step++ {
+				i := rng.IntN(len(n.sessions))
+				switch r := rng.IntN(6); {
+				case r == 0 && len(n.updates) > 0:
+					n.deliverUpdate()
+				case r == 1 && len(n.inboxes[i]) > 0:
+					n.deliverCommit(i)
+				case r == 2:
+					n.connect(i)
+				case r == 3:
+					n.hub.Resend(n.clientID(i))
+				default:
+					if err := n.sessions[i].Apply(randomEdit(rng, n.sessions[i].Document().(map[string]any))); err != nil {
+						t.Fatalf("client %d: %v", i, err)
+					}
+				}
+			}
+
+			// Once the connections recover, everything gets through.
+			n.reliable = true
+			for range 10 {
+				for i := range n.sessions {
+					n.connect(i)
+				}
+				for len(n.updates) > 0 {
+					n.deliverUpdate()
+				}
+				for i := range n.sessions {
+					for len(n.inboxes[i]) > 0 {
+						n.deliverCommit(i)
+					}
+				}
+			}
+			want, version := n.server.Snapshot()
+			for i, s := range n.sessions {
+				if s.Pending() {
+					t.Fatalf("client %d still has pending patches", i)
+				}
+				if got := s.Document(); !reflect.DeepEqual(got, want) {
+					t.Fatalf("client %d diverged:\n got %v\nwant %v", i, got, want)
+				}
+				if unacked, err := n.hub.Unacked(n.clientID(i)); err != nil || len(unacked) != 0 {
+					t.Fatalf("client %d has unacked commits %v, %v (version %d)", i, unacked, err, version)
+				}
+			}
+		})
+	}
+}
+
+func TestHubSubmitDeduplicates(t *testing.T) {
+	server := NewServer(map[string]any{"n": 0})
+	hub := NewHub(server)
+	var received []int64
+	if err := hub.Connect("a", 0, func(c Commit) error {
+		received = append(received, c.Seq)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	u := Update{ClientID: "a", ID: 1, Patch: []jsonpatch.Operation{{"op": "inc", "path": "/n", "inc": 1}}}
+	first, err := hub.Submit(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry, err := hub.Submit(u)
+	if err != nil || retry.Seq != first.Seq {
+		t.Fatalf("expected the original commit, got %+v, %v", retry, err)
+	}
+	if doc, _ := server.Snapshot(); doc.(map[string]any)["n"] != 1 {
+		t.Fatalf("retry was applied again: %v", doc)
+	}
+	if _, err := hub.Submit(Update{ClientID: "a", ID: 2, Base: 1, Patch: []jsonpatch.Operation{{"op": "inc", "path": "/n", "inc": 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hub.Submit(u); !errors.Is(err, ErrStaleUpdate) {
+		t.Fatalf("expected ErrStaleUpdate, got %v", err)
+	}
+
+	if fmt.Sprint(received) != "[1 2]" {
+		t.Fatalf("unexpected deliveries %v", received)
+	}
+	hub.Resend("a")
+	hub.Ack("a", 2)
+	hub.Resend("a")
+	if fmt.Sprint(received) != "[1 2 1 2]" {
+		t.Fatalf("unexpected deliveries %v", received)
+	}
+	if err := hub.Connect("a", 5, nil); err == nil {
+		t.Fatal("expected an error for an unknown version")
+	}
+}
@@ -0,0 +1,145 @@
+package collab
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// Envelope carries a patch between replicas of a document, together with the
+// version vector of its origin when the patch was made. Clock includes the
+// patch itself: Clock[Origin] is the patch's number among the patches of
+// Origin, starting at 1.
+type Envelope struct {
+	Origin string                `json:"origin"`
+	Clock  VersionVector         `json:"clock"`
+	Patch  []jsonpatch.Operation `json:"patch"`
+}
+
+// Delivery is an envelope ready to apply, along with the envelopes delivered
+// earlier that its origin had not seen. Those were made concurrently and may
+// conflict with it.
+type Delivery struct {
+	Envelope
+	Concurrent []Envelope
+}
+
+var (
+	// ErrDuplicate is returned for an envelope that was already received.
+	ErrDuplicate = errors.New("duplicate envelope")
+	// ErrInvalidEnvelope is returned for an envelope without an origin or
+	// whose clock does not count the envelope itself.
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+)
+
+// Reconciler delivers patches from many replicas in causal order: a patch is
+// held back until every patch its origin had seen when making it has been
+// delivered. It is not safe for concurrent use.
+type Reconciler struct {
+	replica   string
+	delivered VersionVector
+	// history holds delivered envelopes that later envelopes may still be
+	// concurrent with; see Prune.
+	history []Envelope
+	held    []Envelope
+}
+
+// NewReconciler returns a reconciler for the replica with the given ID.
+func NewReconciler(replica string) *Reconciler {
+	return &Reconciler{replica: replica, delivered: VersionVector{}}
+}
+
+// Clock returns a copy of the version vector of delivered patches.
+func (r *Reconciler) Clock() VersionVector {
+	return r.delivered.Clone()
+}
+
+// Local stamps a patch made on this replica, which is assumed to be applied
+// already, and returns the envelope to send to the other replicas.
+func (r *Reconciler) Local(patch []jsonpatch.Operation) Envelope {
+	r.delivered[r.replica]++
+	e := Envelope{Origin: r.replica, Clock: r.delivered.Clone(), Patch: patch}
+	r.history = append(r.history, e)
+	return e
+}
+
+// Receive accepts an envelope from another replica and returns the envelopes
+// that became deliverable, in an order that respects causality. It returns
+// nothing while e waits for patches it depends on.
+func (r *Reconciler) Receive(e Envelope) ([]Delivery, error) {
+	n := e.Clock[e.Origin]
+	if e.Origin == "" || n == 0 {
+		return nil, fmt.Errorf("%w: origin %q with clock %v", ErrInvalidEnvelope, e.Origin, e.Clock)
+	}
+	if n <= r.delivered[e.Origin] {
+		return nil, fmt.Errorf("%w: patch %d from %q", ErrDuplicate, n, e.Origin)
+	}
+	for _, h := range r.held {
+		if h.Origin == e.Origin && h.Clock[h.Origin] == n {
+			return nil, fmt.Errorf("%w: patch %d from %q", ErrDuplicate, n, e.Origin)
+		}
+	}
+	r.held = append(r.held, e)
+
+	var deliveries []Delivery
+	for progress := true; progress; {
+		progress = false
+		for i, h := range r.held {
+			if !r.deliverable(h) {
+				continue
+			}
+			deliveries = append(deliveries, r.deliver(h))
+			r.held = append(r.held[:i], r.held[i+1:]...)
+			progress = true
+			break
+		}
+	}
+	return deliveries, nil
+}
+
+// Held returns how many envelopes are waiting for patches they depend on.
+func (r *Reconciler) Held() int {
+	return len(r.held)
+}
+
+// Prune forgets delivered envelopes that every replica has seen, given the
+// merged clocks of all replicas. Nothing can be concurrent with them anymore.
+func (r *Reconciler) Prune(stable VersionVector) {
+	kept := r.history[:0]
+	for _, h := range r.history {
+		if h.Clock[h.Origin] > stable[h.Origin] {
+			kept = append(kept, h)
+		}
+	}
+	clear(r.history[len(kept):])
+	r.history = kept
+}
+
+// deliverable reports whether e is the next patch from its origin and every
+// patch it depends on has been delivered.
+func (r *Reconciler) deliverable(e Envelope) bool {
+	for id, n := range e.Clock {
+		if id == e.Origin {
+			if n != r.delivered[id]+1 {
+				return false
+			}
+		} else if n > r.delivered[id] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Reconciler) deliver(e Envelope) Delivery {
+	d := Delivery{Envelope: e}
+	for _, h := range r.history {
+		// h happened before e exactly when e's origin had seen it.
+		if h.Clock[h.Origin] > e.Clock[h.Origin] {
+			d.Concurrent = append(d.Concurrent, h)
+		}
+	}
+	r.delivered[e.Origin]++
+	r.history = append(r.history, e)
+	return d
+}
@@ -0,0 +1,240 @@
+package collab
+
+import (
+	"errors"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+func TestVersionVectorCompare(t *testing.T) {
+	tests := []struct {
+		a, b     VersionVector
+		expected Ordering
+	}{
+		{VersionVector{}, VersionVector{}, Equal},
+		{VersionVector{"a": 1}, VersionVector{"a": 1, "b": 0}, Equal},
+		{VersionVector{"a": 1}, VersionVector{"a": 2}, Before},
+		{VersionVector{"a": 1}, VersionVector{"a": 1, "b": 1}, Before},
+		{VersionVector{"a": 2, "b": 1}, VersionVector{"a": 1}, After},
+		{VersionVector{"a": 2}, VersionVector{"a": 1, "b": 1}, Concurrent},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Compare(tt.b); got != tt.expected {
+			t.Errorf("%v.Compare(%v) = %v, want %v", tt.a, tt.b, got, tt.expected)
+		}
+	}
+
+	v := VersionVector{"a": 1, "b": 3}
+	v.Merge(VersionVector{"a": 2, "c": 1})
+	if v.Compare(VersionVector{"a": 2, "b": 3, "c": 1}) != Equal {
+		t.Fatalf("unexpected merge result %v", v)
+	}
+}
+
+func TestReconcilerCausalOrder(t *testing.T) {
+	us, eu := NewReconciler("us"), NewReconciler("eu")
+	patch := []jsonpatch.Operation{{"op": "add", "path": "/a", "value": 1}}
+
+	first := us.Local(patch)
+	if _, err := eu.Receive(first); err != nil {
+		t.Fatal(err)
+	}
+	second := eu.Local(patch) // depends on first
+	third := us.Local(patch)  // concurrent with second
+
+	asia := NewReconciler("asia")
+	// second arrives before the patch it depends on and is held back.
+	if got, err := asia.Receive(second); err != nil || len(got) != 0 || asia.Held() != 1 {
+		t.Fatalf("expected second to be held, got %v, %v", got, err)
+	}
+	got, err := asia.Receive(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Origin != "us" || got[1].Origin != "eu" || asia.Held() != 0 {
+		t.Fatalf("expected first then second, got %+v", got)
+	}
+	if len(got[1].Concurrent) != 0 {
+		t.Fatalf("second saw first, so nothing is concurrent: %+v", got[1].Concurrent)
+	}
+
+	got, err = asia.Receive(third)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0].Concurrent) != 1 || got[0].Concurrent[0].Origin != "eu" {
+		t.Fatalf("expected third to be concurrent with second, got %+v", got)
+	}
+	if asia.Clock().Compare(VersionVector{"us": 2, "eu": 1}) != Equal {
+		t.Fatalf("unexpected clock %v", asia.Clock())
+	}
+
+	if _, err := asia.Receive(first); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
+	}
+	if _, err := asia.Receive(Envelope{Origin: "x", Clock: VersionVector{"y": 1}}); !errors.Is(err, ErrInvalidEnvelope) {
+		t.Fatalf("expected ErrInvalidEnvelope, got %v", err)
+	}
+}
+
+func TestReconcilerPrune(t *testing.T) {
+	r := NewReconciler("a")
+	r.Local(nil)
+	r.Local(nil)
+	r.Prune(VersionVector{"a": 1})
+
+	// Only the patch not yet known to be stable is still compared against.
+	got, err := r.Receive(Envelope{Origin: "b", Clock: VersionVector{"b": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0].Concurrent) != 1 || got[0].Concurrent[0].Clock["a"] != 2 {
+		t.Fatalf("unexpected deliveries %+v", got)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	resolver := NewResolver(nil)
+	resolver.Handle("/title", LastWriterWins)
+	resolver.Handle("/owner", FirstWriterWins)
+	resolver.Handle("/counters/*", NumericMerge)
+	resolver.Handle("/tags", func(c Conflict) ([]jsonpatch.Operation, error) {
+		// Appends never conflict.
+		return []jsonpatch.Operation{c.IncomingOp}, nil
+	})
+
+	base := func() any {
+		return map[string]any{"title": "t", "owner": "o", "counters": map[string]any{"views": 0}, "tags": []any{}, "locked": false}
+	}
+	patches := map[string][]jsonpatch.Operation{
+		"us": {
+			{"op": "replace", "path": "/title", "value": "us title"},
+			{"op": "replace", "path": "/owner", "value": "us"},
+			{"op": "inc", "path": "/counters/views", "inc": 1},
+			{"op": "add", "path": "/tags/-", "value": "us"},
+		},
+		"eu": {
+			{"op": "replace", "path": "/title", "value": "eu title"},
+			{"op": "replace", "path": "/owner", "value": "eu"},
+			{"op": "inc", "path": "/counters/views", "inc": 2},
+			{"op": "add", "path": "/tags/-", "value": "eu"},
+			{"op": "test", "path": "/locked", "value": false},
+		},
+	}
+
+	// Each replica applies its own patch, then the other's as resolved.
+	docs := map[string]any{}
+	envelopes := map[string]Envelope{}
+	reconcilers := map[string]*Reconciler{}
+	for _, id := range []string{"us", "eu"} {
+		reconcilers[id] = NewReconciler(id)
+		doc, err := jsonpatch.ApplyValue(base(), patches[id])
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs[id] = doc
+		envelopes[id] = reconcilers[id].Local(patches[id])
+	}
+	for id, other := range map[string]string{"us": "eu", "eu": "us"} {
+		deliveries, err := reconcilers[id].Receive(envelopes[other])
+		if err != nil || len(deliveries) != 1 {
+			t.Fatalf("%s: unexpected deliveries %v, %v", id, deliveries, err)
+		}
+		patch, err := resolver.Resolve(deliveries[0])
+		if err != nil {
+			t.Fatalf("%s: resolve: %v", id, err)
+		}
+		if docs[id], err = jsonpatch.ApplyValue(docs[id], patch); err != nil {
+			t.Fatalf("%s: apply %v: %v", id, patch, err)
+		}
+	}
+
+	us := docs["us"].(map[string]any)
+	if !reflect.DeepEqual(us["title"], docs["eu"].(map[string]any)["title"]) ||
+		!reflect.DeepEqual(us["owner"], docs["eu"].(map[string]any)["owner"]) ||
+		!reflect.DeepEqual(us["counters"], docs["eu"].(map[string]any)["counters"]) {
+		t.Fatalf("replicas diverged:\nus: %v\neu: %v", docs["us"], docs["eu"])
+	}
+	// Both clocks sum to 1, so origins break the tie: "us" is later.
+	if us["title"] != "us title" || us["owner"] != "eu" {
+		t.Fatalf("unexpected winners: %v", us)
+	}
+	if us["counters"].(map[string]any)["views"] != 3 || len(us["tags"].([]any)) != 2 {
+		t.Fatalf("expected merged counters and tags, got %v", us)
+	}
+
+	// Without a strategy for the path, the conflict is rejected.
+	_, err := NewResolver(nil).Resolve(Delivery{Envelope: envelopes["eu"], Concurrent: []Envelope{envelopes["us"]}})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+}
+
+func TestBatcher(t *testing.T) {
+	env := func(origin string, n uint64) Envelope {
+		return Envelope{Origin: origin, Clock: VersionVector{origin: n}}
+	}
+	bt := NewBatcher()
+	bt.Add("user", env("a", 1))
+	bt.Add("user", env("b", 1))
+	bt.Add("index", env("a", 2)) // after a's edit to user: seals user's batch
+	bt.Add("user", env("b", 2))  // starts a new user batch
+	bt.Add("index", env("c", 1))
+	if bt.Len() != 5 {
+		t.Fatalf("expected 5 queued envelopes, got %d", bt.Len())
+	}
+	batches := bt.Flush()
+	type summary struct {
+		Seq     uint64
+		Doc     string
+		After   []uint64
+		Origins []string
+	}
+	var got []summary
+	for _, b := range batches {
+		s := summary{Seq: b.Seq, Doc: b.Doc, After: b.After}
+		for _, e := range b.Envelopes {
+			s.Origins = append(s.Origins, e.Origin)
+		}
+		got = append(got, s)
+	}
+	expected := []summary{
+		{Seq: 1, Doc: "user", Origins: []string{"a", "b"}},
+		{Seq: 2, Doc: "index", After: []uint64{1}, Origins: []string{"a", "c"}},
+		{Seq: 3, Doc: "user", After: []uint64{1}, Origins: []string{"b"}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected batches\ngot:      %+v\nexpected: %+v", got, expected)
+	}
+	if bt.Len() != 0 || len(bt.Flush()) != 0 {
+		t.Fatal("expected Flush to empty the batcher")
+	}
+
+	// Ping-ponging between documents never links a batch to a later one.
+	rng := rand.New(rand.NewPCG(1, 2))
+	clocks := map[string]uint64{}
+	for range 200 {
+		origin := []string{"a", "b", "c"}[rng.IntN(3)]
+		clocks[origin]++
+		bt.Add([]string{"x", "y", "z"}[rng.IntN(3)], env(origin, clocks[origin]))
+	}
+	seen := map[uint64]bool{}
+	last := map[string]uint64{}
+	for _, b := range bt.Flush() {
+		for _, dep := range b.After {
+			if !seen[dep] {
+				t.Fatalf("batch %d is flushed before batch %d it depends on", b.Seq, dep)
+			}
+		}
+		seen[b.Seq] = true
+		for _, e := range b.Envelopes {
+			if n := e.Clock[e.Origin]; n != last[e.Origin]+1 {
+				t.Fatalf("envelope %d from %q flushed after %d", n, e.Origin, last[e.Origin])
+			}
+			last[e.Origin]++
+		}
+	}
+}
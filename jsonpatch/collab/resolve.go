@@ -0,0 +1,205 @@
+package collab
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// ErrConflict is returned by the Reject strategy.
+var ErrConflict = errors.New("conflicting concurrent patches")
+
+// Conflict is an operation of a delivered patch that writes to the same
+// value as an operation of a concurrent patch applied before it, or to a
+// value inside or containing it.
+type Conflict struct {
+	// Path is the path of IncomingOp.
+	Path       string
+	IncomingOp jsonpatch.Operation
+	Incoming   Envelope
+	AppliedOp  jsonpatch.Operation
+	Applied    Envelope
+}
+
+// Strategy resolves a conflict by returning the operations to apply instead
+// of IncomingOp: IncomingOp itself to keep it, or nothing to drop it. Every
+// replica must resolve a conflict the same way whichever of the two patches
+// it received first, or the replicas diverge.
+type Strategy func(c Conflict) ([]jsonpatch.Operation, error)
+
+// Reject fails the delivery with ErrConflict.
+func Reject(c Conflict) ([]jsonpatch.Operation, error) {
+	return nil, fmt.Errorf("%w: %q from %q and %q from %q at %q", ErrConflict, c.IncomingOp["op"], c.Incoming.Origin, c.AppliedOp["op"], c.Applied.Origin, c.Path)
+}
+
+// LastWriterWins keeps the operation of the later patch. Concurrent patches
+// are ordered by the sum of their clocks, then by origin.
+func LastWriterWins(c Conflict) ([]jsonpatch.Operation, error) {
+	if later(c.Incoming, c.Applied) {
+		return []jsonpatch.Operation{c.IncomingOp}, nil
+	}
+	return nil, nil
+}
+
+// FirstWriterWins keeps the operation of the earlier patch, in the order
+// LastWriterWins uses.
+func FirstWriterWins(c Conflict) ([]jsonpatch.Operation, error) {
+	if later(c.Applied, c.Incoming) {
+		return []jsonpatch.Operation{c.IncomingOp}, nil
+	}
+	return nil, nil
+}
+
+// NumericMerge keeps both operations when both are inc, so concurrent
+// increments add up. Other conflicts fall back to LastWriterWins.
+func NumericMerge(c Conflict) ([]jsonpatch.Operation, error) {
+	if c.IncomingOp["op"] == "inc" && c.AppliedOp["op"] == "inc" {
+		return []jsonpatch.Operation{c.IncomingOp}, nil
+	}
+	return LastWriterWins(c)
+}
+
+// later reports whether a comes after b in the order LastWriterWins uses.
+func later(a, b Envelope) bool {
+	sa, sb := a.Clock.sum(), b.Clock.sum()
+	if sa != sb {
+		return sa > sb
+	}
+	return a.Origin > b.Origin
+}
+
+func (v VersionVector) sum() uint64 {
+	var n uint64
+	for _, c := range v {
+		n += c
+	}
+	return n
+}
+
+// Resolver picks a Strategy for each conflict in a Delivery by the path of
+// the incoming operation. It is not safe for concurrent use while strategies
+// are being registered.
+type Resolver struct {
+	fallback Strategy
+	rules    []rule
+}
+
+type rule struct {
+	pattern  []string
+	strategy Strategy
+}
+
+// NewResolver returns a resolver that uses fallback for paths without a
+// strategy of their own. A nil fallback is Reject.
+func NewResolver(fallback Strategy) *Resolver {
+	if fallback == nil {
+		fallback = Reject
+	}
+	return &Resolver{fallback: fallback}
+}
+
+// Handle uses strategy for operations whose path is at or below pattern. A
+// "*" segment in pattern matches any single key or index. The first matching
+// pattern registered wins.
+func (r *Resolver) Handle(pattern string, strategy Strategy) {
+	r.rules = append(r.rules, rule{pattern: splitPath(pattern), strategy: strategy})
+}
+
+// Resolve returns the patch to apply for d: its operations, with each one
+// that conflicts with an operation of a concurrent patch replaced by what
+// the strategy for its path returns.
+func (r *Resolver) Resolve(d Delivery) ([]jsonpatch.Operation, error) {
+	var patch []jsonpatch.Operation
+	for _, op := range d.Patch {
+		ops := []jsonpatch.Operation{op}
+		for _, applied := range d.Concurrent {
+			for _, appliedOp := range applied.Patch {
+				var next []jsonpatch.Operation
+				for _, incoming := range ops {
+					if !overlaps(incoming, appliedOp) {
+						next = append(next, incoming)
+						continue
+					}
+					path, _ := incoming["path"].(string)
+					resolved, err := r.strategy(path)(Conflict{
+						Path:       path,
+						IncomingOp: incoming,
+						Incoming:   d.Envelope,
+						AppliedOp:  appliedOp,
+						Applied:    applied,
+					})
+					if err != nil {
+						return nil, err
+					}
+					next = append(next, resolved...)
+				}
+				ops = next
+			}
+		}
+		patch = append(patch, ops...)
+	}
+	return patch, nil
+}
+
+func (r *Resolver) strategy(path string) Strategy {
+	segments := splitPath(path)
+	for _, rule := range r.rules {
+		if len(segments) < len(rule.pattern) {
+			continue
+		}
+		matched := true
+		for i, p := range rule.pattern {
+			if p != "*" && p != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return rule.strategy
+		}
+	}
+	return r.fallback
+}
+
+// overlaps reports whether two operations write to the same value or one
+// writes inside the other's. test operations write nothing.
+func overlaps(a, b jsonpatch.Operation) bool {
+	for _, pa := range writtenPaths(a) {
+		for _, pb := range writtenPaths(b) {
+			n := min(len(pa), len(pb))
+			if slices.Equal(pa[:n], pb[:n]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func writtenPaths(op jsonpatch.Operation) [][]string {
+	var paths [][]string
+	switch op["op"] {
+	case "test", "less", "more", "in", "defined", "undefined", "type", "contains", "starts", "ends", "matches":
+		return nil
+	case "move":
+		if from, ok := op["from"].(string); ok {
+			paths = append(paths, splitPath(from))
+		}
+	}
+	if path, ok := op["path"].(string); ok {
+		paths = append(paths, splitPath(path))
+	}
+	return paths
+}
+
+// splitPath splits a JSON Pointer into its raw segments; escapes are kept,
+// which is enough to compare pointers. Like Apply, it accepts pointers
+// without the leading "/".
+func splitPath(pointer string) []string {
+	if pointer == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+}
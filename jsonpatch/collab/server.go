@@ -0,0 +1,145 @@
+package collab
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// DedupeWindow bounds how long a server remembers the idempotency keys of
+// the updates it committed. The zero value remembers every key.
+type DedupeWindow struct {
+	// Duration is how long a key is remembered after its update was
+	// committed. Zero means no time limit.
+	Duration time.Duration
+	// MaxKeys is the number of keys remembered; the oldest are forgotten
+	// first. Zero means no limit.
+	MaxKeys int
+}
+
+// ServerOptions configures a Server. The zero value is what NewServer uses.
+type ServerOptions struct {
+	Dedupe DedupeWindow
+	// Now returns the time used for the dedupe window. It defaults to
+	// time.Now.
+	Now func() time.Time
+}
+
+// Server holds the canonical document and the log of commits that produced
+// it. It is safe for concurrent use.
+type Server struct {
+	mu   sync.Mutex
+	opts ServerOptions
+	doc  any
+	log  []Commit // log[i] has Seq i+1
+	// keys maps the idempotency keys in the dedupe window to the Seq of
+	// their commits. keyOrder lists them oldest first.
+	keys     map[string]committedKey
+	keyOrder []string
+}
+
+type committedKey struct {
+	seq int64
+	at  time.Time
+}
+
+// NewServer returns a server for doc at version 0.
+func NewServer(doc any) *Server {
+	return NewServerWithOptions(doc, ServerOptions{})
+}
+
+// NewServerWithOptions is like NewServer but accepts ServerOptions.
+func NewServerWithOptions(doc any, opts ServerOptions) *Server {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Server{opts: opts, doc: cloneValue(doc), keys: map[string]committedKey{}}
+}
+
+// Submit rebases u onto the commits made since u.Base, applies it, and
+// returns the resulting commit, which the caller delivers to every session,
+// including the author, in Seq order. An update that no longer applies is
+// rejected with an error and leaves the document unchanged; the caller
+// should pass its ID to the author's Session.Reject.
+//
+// An update whose Key matches one committed within the dedupe window is not
+// applied again; Submit returns the earlier commit instead.
+func (s *Server) Submit(u Update) (Commit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.opts.Now()
+	s.forgetKeys(now)
+	if k, ok := s.keys[u.Key]; ok && u.Key != "" {
+		c := s.log[k.seq-1]
+		c.Patch = clonePatch(c.Patch)
+		return c, nil
+	}
+
+	version := int64(len(s.log))
+	if u.Base < 0 || u.Base > version {
+		return Commit{}, fmt.Errorf("update %d from %q is based on unknown version %d (latest is %d)", u.ID, u.ClientID, u.Base, version)
+	}
+	patch := clonePatch(u.Patch)
+	for _, c := range s.log[u.Base:] {
+		var err error
+		if patch, err = jsonpatch.Rebase(patch, c.Patch); err != nil {
+			return Commit{}, fmt.Errorf("rebase update %d from %q: %w", u.ID, u.ClientID, err)
+		}
+	}
+	doc, err := jsonpatch.ApplyValue(cloneValue(s.doc), clonePatch(patch))
+	if err != nil {
+		return Commit{}, fmt.Errorf("apply update %d from %q: %w", u.ID, u.ClientID, err)
+	}
+	s.doc = doc
+	c := Commit{Seq: version + 1, ClientID: u.ClientID, ID: u.ID, Patch: patch}
+	s.log = append(s.log, c)
+	if u.Key != "" {
+		s.keys[u.Key] = committedKey{seq: c.Seq, at: now}
+		s.keyOrder = append(s.keyOrder, u.Key)
+		s.forgetKeys(now)
+	}
+	c.Patch = clonePatch(patch)
+	return c, nil
+}
+
+// forgetKeys drops the keys that fell out of the dedupe window.
+func (s *Server) forgetKeys(now time.Time) {
+	window := s.opts.Dedupe
+	n := 0
+	for n < len(s.keyOrder) {
+		expired := window.Duration > 0 && now.Sub(s.keys[s.keyOrder[n]].at) >= window.Duration
+		full := window.MaxKeys > 0 && len(s.keyOrder)-n > window.MaxKeys
+		if !expired && !full {
+			break
+		}
+		delete(s.keys, s.keyOrder[n])
+		n++
+	}
+	s.keyOrder = s.keyOrder[n:]
+}
+
+// Snapshot returns a copy of the current document and its version, the
+// starting point for a new session.
+func (s *Server) Snapshot() (any, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return cloneValue(s.doc), int64(len(s.log))
+}
+
+// Since returns the commits after version, for catching up a session that
+// missed some.
+func (s *Server) Since(version int64) ([]Commit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if version < 0 || version > int64(len(s.log)) {
+		return nil, fmt.Errorf("unknown version %d (latest is %d)", version, len(s.log))
+	}
+	commits := append([]Commit(nil), s.log[version:]...)
+	for i := range commits {
+		commits[i].Patch = clonePatch(commits[i].Patch)
+	}
+	return commits, nil
+}
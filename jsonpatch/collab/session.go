@@ -0,0 +1,301 @@
+// Package collab keeps several writers of one JSON document in sync.
+//
+// A Server orders the patches it receives into a log of numbered commits,
+// rebasing each onto the commits its author had not seen yet. A Session is
+// the client half: it applies local patches optimistically, sends them to the
+// server one at a time, and rebases the ones still waiting for an
+// acknowledgement over commits from other writers. Neither half does any I/O;
+// Updates and Commits are plain values (with JSON tags) that the caller moves
+// over whatever transport it uses.
+package collab
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// Update is a patch sent from a Session to the Server.
+type Update struct {
+	ClientID string `json:"clientId"`
+	// ID numbers the updates of one client, starting at 1.
+	ID uint64 `json:"id"`
+	// Base is the version of the document the patch was written against.
+	Base  int64                 `json:"base"`
+	Patch []jsonpatch.Operation `json:"patch"`
+	// Key is an optional idempotency key. A server configured with a
+	// DedupeWindow commits an update only once per key, so a retried
+	// delivery does not apply operations such as inc or str_ins twice.
+	Key string `json:"key,omitempty"`
+}
+
+// Commit is an Update as accepted by the Server. Seq is the version of the
+// document after the commit, and Patch has been rebased to apply to the
+// version before it. Commits are delivered to every Session, including the
+// author, for whom the commit acknowledges its update.
+type Commit struct {
+	Seq      int64                 `json:"seq"`
+	ClientID string                `json:"clientId"`
+	ID       uint64                `json:"id"`
+	Patch    []jsonpatch.Operation `json:"patch"`
+}
+
+// ErrMissedCommit is returned by Receive when a commit arrives before the
+// commits preceding it. The session must be caught up (see Server.Since)
+// before it can continue.
+var ErrMissedCommit = errors.New("commit received out of order")
+
+// Session is one client's view of a shared document. It is safe for
+// concurrent use.
+type Session struct {
+	mu       sync.Mutex
+	clientID string
+	send     func(Update) error
+
+	confirmed any   // the document at version
+	version   int64 // Seq of the last commit received
+	doc       any   // confirmed with inflight and buffered applied
+	nextID    uint64
+
+	// inflight is the update sent and not acknowledged yet, if any. Local
+	// patches made meanwhile wait in buffered and are sent together when it
+	// is acknowledged, so the server never sees a patch based on one it has
+	// not committed.
+	inflight *Update
+	buffered []jsonpatch.Operation
+	// offline is set between Disconnect and Reconnect. Nothing is sent
+	// meanwhile, and local patches accumulate in buffered.
+	offline bool
+}
+
+// NewSession returns a session for clientID starting from doc at version,
+// typically obtained from Server.Snapshot. send is called with each update to
+// deliver to the server; it is never called while the session is locked, so
+// it may deliver synchronously.
+func NewSession(clientID string, doc any, version int64, send func(Update) error) *Session {
+	return &Session{
+		clientID:  clientID,
+		send:      send,
+		confirmed: cloneValue(doc),
+		version:   version,
+		doc:       cloneValue(doc),
+		nextID:    1,
+	}
+}
+
+// Document returns a copy of the optimistic document: the last confirmed
+// version with every local patch applied.
+func (s *Session) Document() any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return cloneValue(s.doc)
+}
+
+// Version returns the Seq of the last commit received.
+func (s *Session) Version() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// Pending reports whether local patches are waiting for acknowledgement.
+func (s *Session) Pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inflight != nil || len(s.buffered) > 0
+}
+
+// Apply applies patch to the local document and queues it for the server. A
+// patch that fails to apply leaves the session unchanged.
+func (s *Session) Apply(patch []jsonpatch.Operation) error {
+	s.mu.Lock()
+	doc, err := jsonpatch.ApplyValue(cloneValue(s.doc), clonePatch(patch))
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.doc = doc
+	s.buffered = append(s.buffered, clonePatch(patch)...)
+	update := s.flush()
+	s.mu.Unlock()
+	return s.sendUpdate(update)
+}
+
+// Receive handles a commit from the server. Commits the session has already
+// seen are ignored.
+func (s *Session) Receive(c Commit) error {
+	s.mu.Lock()
+	switch {
+	case c.Seq <= s.version:
+		s.mu.Unlock()
+		return nil
+	case c.Seq != s.version+1:
+		err := fmt.Errorf("%w: expected seq %d, got %d", ErrMissedCommit, s.version+1, c.Seq)
+		s.mu.Unlock()
+		return err
+	}
+
+	confirmed, err := jsonpatch.ApplyValue(s.confirmed, clonePatch(c.Patch))
+	if err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("apply commit %d: %w", c.Seq, err)
+	}
+	s.confirmed = confirmed
+	s.version = c.Seq
+
+	if s.inflight != nil && c.ClientID == s.clientID && c.ID == s.inflight.ID {
+		// Our own update came back; the local document already reflects it.
+		s.inflight = nil
+		update := s.flush()
+		s.mu.Unlock()
+		return s.sendUpdate(update)
+	}
+
+	// The buffered patches follow the in-flight one, so they are rebased
+	// over the commit as it would apply after the in-flight patch, and the
+	// local document gets the commit as it applies after both.
+	remote := c.Patch
+	if s.inflight != nil {
+		if s.inflight.Patch, remote, err = jsonpatch.Transform(s.inflight.Patch, remote); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	if s.buffered, remote, err = jsonpatch.Transform(s.buffered, remote); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	if s.doc, err = jsonpatch.ApplyValue(s.doc, clonePatch(remote)); err != nil {
+		err = fmt.Errorf("apply commit %d over local patches: %w", c.Seq, err)
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// Reject tells the session that the server refused its in-flight update with
+// the given ID. The update is discarded along with the local patches made
+// after it, which were written on top of it, and the document reverts to the
+// last confirmed version.
+func (s *Session) Reject(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inflight == nil || s.inflight.ID != id {
+		return
+	}
+	s.inflight = nil
+	s.buffered = nil
+	s.doc = cloneValue(s.confirmed)
+}
+
+// Resend sends the in-flight update again, for example after reconnecting,
+// when it may have been lost. It does nothing if no update is in flight or
+// the session is offline. The update keeps its ID but is based on the latest
+// version received, since its patch has been rebased over the commits
+// received since it was first sent.
+func (s *Session) Resend() error {
+	s.mu.Lock()
+	var update *Update
+	if s.inflight != nil && !s.offline {
+		u := *s.inflight
+		u.Base = s.version
+		u.Patch = clonePatch(u.Patch)
+		update = &u
+	}
+	s.mu.Unlock()
+	return s.sendUpdate(update)
+}
+
+// Disconnect takes the session offline. Local patches are still applied to
+// the document and queued, but no update is sent until Reconnect.
+func (s *Session) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offline = true
+}
+
+// Reconnect brings the session back online. It calls fetch with the
+// session's version to get the commits it missed, such as with Server.Since,
+// and receives them, which rebases the queued local patches over them. Then
+// it sends the queue: the in-flight update again if the missed commits do not
+// include it, and the patches made offline after it is acknowledged. If
+// fetching or receiving fails, the session stays offline and Reconnect may
+// be called again.
+func (s *Session) Reconnect(fetch func(version int64) ([]Commit, error)) error {
+	s.mu.Lock()
+	s.offline = true
+	version := s.version
+	s.mu.Unlock()
+
+	missed, err := fetch(version)
+	if err != nil {
+		return fmt.Errorf("fetch commits after %d: %w", version, err)
+	}
+	for _, c := range missed {
+		if err := s.Receive(c); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.offline = false
+	if s.inflight != nil {
+		s.mu.Unlock()
+		return s.Resend()
+	}
+	update := s.flush()
+	s.mu.Unlock()
+	return s.sendUpdate(update)
+}
+
+// flush moves the buffered patches into a new in-flight update if none is
+// in flight. The caller sends the returned update after unlocking.
+func (s *Session) flush() *Update {
+	if s.offline || s.inflight != nil || len(s.buffered) == 0 {
+		return nil
+	}
+	s.inflight = &Update{ClientID: s.clientID, ID: s.nextID, Base: s.version, Patch: s.buffered}
+	s.nextID++
+	s.buffered = nil
+	u := *s.inflight
+	u.Patch = clonePatch(u.Patch)
+	return &u
+}
+
+func (s *Session) sendUpdate(u *Update) error {
+	if u == nil {
+		return nil
+	}
+	return s.send(*u)
+}
+
+func clonePatch(patch []jsonpatch.Operation) []jsonpatch.Operation {
+	if patch == nil {
+		return nil
+	}
+	out := make([]jsonpatch.Operation, len(patch))
+	for i, op := range patch {
+		out[i] = cloneValue(op).(map[string]any)
+	}
+	return out
+}
+
+func cloneValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, child := range v {
+			m[k] = cloneValue(child)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, child := range v {
+			s[i] = cloneValue(child)
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -0,0 +1,84 @@
+package collab
+
+// VersionVector maps replica IDs to the number of patches from that replica
+// that have been seen. Missing entries count as zero.
+type VersionVector map[string]uint64
+
+// Ordering is the causal relation between two version vectors.
+type Ordering int
+
+const (
+	// Equal vectors have seen the same patches.
+	Equal Ordering = iota
+	// Before means every patch the first vector has seen, the second has too,
+	// and more.
+	Before
+	// After is the reverse of Before.
+	After
+	// Concurrent vectors have each seen patches the other has not.
+	Concurrent
+)
+
+func (o Ordering) String() string {
+	switch o {
+	case Equal:
+		return "equal"
+	case Before:
+		return "before"
+	case After:
+		return "after"
+	default:
+		return "concurrent"
+	}
+}
+
+// Clone returns a copy of v.
+func (v VersionVector) Clone() VersionVector {
+	c := make(VersionVector, len(v))
+	for id, n := range v {
+		c[id] = n
+	}
+	return c
+}
+
+// Merge raises every entry of v to at least the matching entry of other.
+func (v VersionVector) Merge(other VersionVector) {
+	for id, n := range other {
+		if n > v[id] {
+			v[id] = n
+		}
+	}
+}
+
+// Compare returns how v relates to other.
+func (v VersionVector) Compare(other VersionVector) Ordering {
+	less, greater := false, false
+	for id, n := range v {
+		if m := other[id]; n < m {
+			less = true
+		} else if n > m {
+			greater = true
+		}
+	}
+	for id, m := range other {
+		if _, ok := v[id]; !ok && m > 0 {
+			less = true
+		}
+	}
+	switch {
+	case less && greater:
+		return Concurrent
+	case less:
+		return Before
+	case greater:
+		return After
+	default:
+		return Equal
+	}
+}
+
+// Descends reports whether v has seen everything other has.
+func (v VersionVector) Descends(other VersionVector) bool {
+	o := v.Compare(other)
+	return o == Equal || o == After
+}
@@ -0,0 +1,249 @@
+// Package compact converts JSON Patch operations to and from the compact array
+// encoding used by json-joy, where each operation is an array starting with a
+// numeric opcode:
+//
+//	{"op": "add", "path": "/a", "value": 1}                -> [0, "/a", 1]
+//	{"op": "str_ins", "path": "/s", "pos": 2, "str": "x"}  -> [6, "/s", 2, "x"]
+//
+// Paths stay JSON Pointer strings. Decode also accepts opcode names in place
+// of numbers and paths given as arrays of segments. The encoding has no room
+// for other members, so Encode drops members such as "comment".
+package compact
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Opcodes of the supported operations.
+const (
+	OpAdd     = 0
+	OpRemove  = 1
+	OpReplace = 2
+	OpCopy    = 3
+	OpMove    = 4
+	OpTest    = 5
+	OpStrIns  = 6
+	OpStrDel  = 7
+	OpInc     = 9
+)
+
+var opcodes = map[string]int{
+	"add":     OpAdd,
+	"remove":  OpRemove,
+	"replace": OpReplace,
+	"copy":    OpCopy,
+	"move":    OpMove,
+	"test":    OpTest,
+	"str_ins": OpStrIns,
+	"str_del": OpStrDel,
+	"inc":     OpInc,
+}
+
+var opNames = func() map[int]string {
+	names := make(map[int]string, len(opcodes))
+	for name, code := range opcodes {
+		names[code] = name
+	}
+	return names
+}()
+
+// Encode converts operations to their compact form.
+func Encode(ops []map[string]any) ([]any, error) {
+	out := make([]any, len(ops))
+	for i, op := range ops {
+		name, _ := op["op"].(string)
+		code, ok := opcodes[name]
+		if !ok {
+			return nil, fmt.Errorf("op %d: unsupported op %q", i, name)
+		}
+		path, ok := op["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("op %d: missing or non-string %q field", i, "path")
+		}
+		encoded := []any{code, path}
+		need := func(field string) (any, error) {
+			v, ok := op[field]
+			if !ok {
+				return nil, fmt.Errorf("op %d (%q): missing %q field", i, name, field)
+			}
+			return v, nil
+		}
+		var fields []string
+		switch code {
+		case OpAdd, OpReplace, OpTest:
+			fields = []string{"value"}
+		case OpCopy, OpMove:
+			fields = []string{"from"}
+		case OpStrIns:
+			fields = []string{"pos", "str"}
+		case OpInc:
+			fields = []string{"inc"}
+		case OpStrDel:
+			// str_del carries either the deleted text or, after a 0
+			// placeholder, its length.
+			pos, err := need("pos")
+			if err != nil {
+				return nil, err
+			}
+			if str, ok := op["str"].(string); ok {
+				encoded = append(encoded, pos, str)
+			} else {
+				length, err := need("len")
+				if err != nil {
+					return nil, err
+				}
+				encoded = append(encoded, pos, 0, length)
+			}
+		}
+		for _, field := range fields {
+			v, err := need(field)
+			if err != nil {
+				return nil, err
+			}
+			encoded = append(encoded, v)
+		}
+		if code == OpTest {
+			if not, ok := op["not"].(bool); ok && not {
+				encoded = append(encoded, 1)
+			}
+		}
+		out[i] = encoded
+	}
+	return out, nil
+}
+
+// Decode converts compact operations, as decoded by encoding/json, back to
+// operation objects.
+func Decode(encoded []any) ([]map[string]any, error) {
+	ops := make([]map[string]any, len(encoded))
+	for i, raw := range encoded {
+		arr, ok := raw.([]any)
+		if !ok || len(arr) < 2 {
+			return nil, fmt.Errorf("op %d: expected an array of at least 2 elements", i)
+		}
+		name, err := decodeOpcode(arr[0])
+		if err != nil {
+			return nil, fmt.Errorf("op %d: %w", i, err)
+		}
+		path, err := decodePath(arr[1])
+		if err != nil {
+			return nil, fmt.Errorf("op %d: %w", i, err)
+		}
+		op := map[string]any{"op": name, "path": path}
+		args := arr[2:]
+		need := func(n int) error {
+			if len(args) < n {
+				return fmt.Errorf("op %d (%q): expected %d arguments, got %d", i, name, n, len(args))
+			}
+			return nil
+		}
+		switch name {
+		case "add", "replace", "test":
+			if err := need(1); err != nil {
+				return nil, err
+			}
+			op["value"] = args[0]
+			if name == "test" && len(args) > 1 && truthy(args[1]) {
+				op["not"] = true
+			}
+		case "copy", "move":
+			if err := need(1); err != nil {
+				return nil, err
+			}
+			from, err := decodePath(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("op %d: %w", i, err)
+			}
+			op["from"] = from
+		case "str_ins":
+			if err := need(2); err != nil {
+				return nil, err
+			}
+			op["pos"], op["str"] = args[0], args[1]
+		case "str_del":
+			if err := need(2); err != nil {
+				return nil, err
+			}
+			op["pos"] = args[0]
+			if str, ok := args[1].(string); ok {
+				op["str"] = str
+			} else {
+				if err := need(3); err != nil {
+					return nil, err
+				}
+				op["len"] = args[2]
+			}
+		case "inc":
+			if err := need(1); err != nil {
+				return nil, err
+			}
+			op["inc"] = args[0]
+		}
+		ops[i] = op
+	}
+	return ops, nil
+}
+
+func decodeOpcode(v any) (string, error) {
+	switch c := v.(type) {
+	case string:
+		if _, ok := opcodes[c]; ok {
+			return c, nil
+		}
+		return "", fmt.Errorf("unsupported op %q", c)
+	case float64:
+		if name, ok := opNames[int(c)]; ok && float64(int(c)) == c {
+			return name, nil
+		}
+	case int:
+		if name, ok := opNames[c]; ok {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported opcode %v", v)
+}
+
+// decodePath accepts a JSON Pointer or an array of string and integer
+// segments.
+func decodePath(v any) (string, error) {
+	switch p := v.(type) {
+	case string:
+		return p, nil
+	case []any:
+		var b strings.Builder
+		for _, segment := range p {
+			b.WriteByte('/')
+			switch s := segment.(type) {
+			case string:
+				b.WriteString(strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1"))
+			case float64:
+				if s < 0 || float64(int(s)) != s {
+					return "", fmt.Errorf("invalid path segment %v", s)
+				}
+				b.WriteString(strconv.Itoa(int(s)))
+			case int:
+				b.WriteString(strconv.Itoa(s))
+			default:
+				return "", fmt.Errorf("invalid path segment %v", segment)
+			}
+		}
+		return b.String(), nil
+	default:
+		return "", fmt.Errorf("path must be a string or an array, got %T", v)
+	}
+}
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case int:
+		return t != 0
+	default:
+		return false
+	}
+}
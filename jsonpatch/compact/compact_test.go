@@ -0,0 +1,92 @@
+package compact
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	ops := []map[string]any{
+		{"op": "add", "path": "/a", "value": map[string]any{"b": 1.0}},
+		{"op": "remove", "path": "/a/b"},
+		{"op": "replace", "path": "/c", "value": "x"},
+		{"op": "copy", "from": "/c", "path": "/d"},
+		{"op": "move", "from": "/d", "path": "/e"},
+		{"op": "test", "path": "/e", "value": "x"},
+		{"op": "test", "path": "/e", "value": "y", "not": true},
+		{"op": "str_ins", "path": "/e", "pos": 1.0, "str": "🌍"},
+		{"op": "str_del", "path": "/e", "pos": 0.0, "str": "x"},
+		{"op": "str_del", "path": "/e", "pos": 0.0, "len": 2.0},
+		{"op": "inc", "path": "/n", "inc": -3.0},
+	}
+	encoded, err := Encode(ops)
+	if err != nil {
+		t.Fatalf("Encode returned error: %v", err)
+	}
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[[0,"/a",{"b":1}],[1,"/a/b"],[2,"/c","x"],[3,"/d","/c"],[4,"/e","/d"],[5,"/e","x"],[5,"/e","y",1],` +
+		`[6,"/e",1,"🌍"],[7,"/e",0,"x"],[7,"/e",0,0,2],[9,"/n",-3]]`
+	if string(data) != want {
+		t.Fatalf("unexpected encoding:\n%s\nwant:\n%s", data, want)
+	}
+
+	var raw []any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(raw)
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, ops) {
+		t.Fatalf("round trip mismatch.\nGot:      %v\nExpected: %v", decoded, ops)
+	}
+}
+
+func TestDecodeAlternateForms(t *testing.T) {
+	var raw []any
+	json.Unmarshal([]byte(`[["add", ["a/b", 0, "m~n"], 1], [4, ["x"], ["y", 2]]]`), &raw)
+	decoded, err := Decode(raw)
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	expected := []map[string]any{
+		{"op": "add", "path": "/a~1b/0/m~0n", "value": 1.0},
+		{"op": "move", "path": "/x", "from": "/y/2"},
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("Decode = %v, want %v", decoded, expected)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := Encode([]map[string]any{{"op": "flip", "path": "/a"}}); err == nil || !strings.Contains(err.Error(), `unsupported op "flip"`) {
+		t.Fatalf("expected unsupported op error, got %v", err)
+	}
+	if _, err := Encode([]map[string]any{{"op": "add", "path": "/a"}}); err == nil || !strings.Contains(err.Error(), `missing "value"`) {
+		t.Fatalf("expected missing value error, got %v", err)
+	}
+
+	testCases := []struct {
+		input         string
+		expectedError string
+	}{
+		{`[{"op": "add"}]`, "expected an array"},
+		{`[[99, "/a"]]`, "unsupported opcode 99"},
+		{`[[6, "/a", 1]]`, "expected 2 arguments"},
+		{`[[0, 5, 1]]`, "path must be a string or an array"},
+		{`[[1, ["a", 1.5]]]`, "invalid path segment 1.5"},
+	}
+	for _, tc := range testCases {
+		var raw []any
+		json.Unmarshal([]byte(tc.input), &raw)
+		if _, err := Decode(raw); err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+			t.Fatalf("Decode(%s): expected error containing %q, got %v", tc.input, tc.expectedError, err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package jsonpatch
+
+import "maps"
+
+// CompiledPatch is a patch checked and prepared once by Compile, for
+// applying the same patch to many documents.
+type CompiledPatch struct {
+	ops     []compiledOp
+	appends map[string]int
+}
+
+type compiledOp struct {
+	op Operation
+	// path is the op's path split into decoded segments.
+	path []pathSegment
+	// copyMember names the member holding the objects or arrays the op
+	// writes, which each document gets its own copy of: "value" for add
+	// and replace, and "props" for extend.
+	copyMember string
+}
+
+// pathSegment is a decoded segment of a JSON Pointer, with the array index
+// it stands for, or -1 if it is not one.
+type pathSegment struct {
+	key   string
+	index int
+}
+
+// Compile checks operations and prepares them for CompiledPatch.Apply, so
+// that a patch applied to many documents is validated and has its pointers
+// split and decoded only once. Members are checked like Patch.UnmarshalJSON
+// does, so a patch Apply would reject only once it reaches a bad operation
+// is rejected up front. The operations are copied, and the caller may
+// modify them afterwards.
+func Compile(operations []Operation) (*CompiledPatch, error) {
+	p := &CompiledPatch{ops: make([]compiledOp, len(operations))}
+	for i, op := range operations {
+		if _, err := parseOp(i, op); err != nil {
+			return nil, err
+		}
+		op = deepCopyValue(op).(map[string]any)
+		path, _ := decodeSegments(op["path"].(string))
+		c := compiledOp{op: op, path: path}
+		switch op["op"] {
+		case "add", "replace":
+			switch op["value"].(type) {
+			case map[string]any, []any:
+				c.copyMember = "value"
+			}
+		case "extend":
+			c.copyMember = "props"
+		}
+		p.ops[i] = c
+	}
+	if len(operations) > 1 {
+		p.appends = countAppends(operations)
+	}
+	return p, nil
+}
+
+// Apply applies the compiled patch to doc in place, like Apply. Values the
+// patch writes are copied, so documents patched with it share no objects
+// or arrays with each other or with the patch. It is safe to apply a
+// compiled patch to several documents concurrently.
+func (p *CompiledPatch) Apply(doc map[string]any) error {
+	a := &applier{root: doc, mapRoot: doc}
+	if p.appends != nil {
+		a.appends = maps.Clone(p.appends)
+	}
+	for i, c := range p.ops {
+		op := c.op
+		if c.copyMember != "" {
+			op = maps.Clone(op)
+			op[c.copyMember] = deepCopyValue(op[c.copyMember])
+		}
+		a.segments = c.path
+		if err := a.applyOp(op); err != nil {
+			return newOpError(i, c.op, err)
+		}
+	}
+	return nil
+}
+
+// decodeSegments splits pathRaw into decoded segments for resolveSegments.
+func decodeSegments(pathRaw string) ([]pathSegment, error) {
+	segments, err := splitPointer(pathRaw)
+	if err != nil {
+		return nil, err
+	}
+	path := make([]pathSegment, len(segments))
+	for i, segment := range segments {
+		path[i] = pathSegment{key: segment, index: -1}
+		if index, err := parseArrayIndex(segment); err == nil {
+			path[i].index = index
+		}
+	}
+	return path, nil
+}
+
+// resolveSegments is resolvePathCached for a path already split by
+// Compile.
+func resolveSegments(doc any, pathRaw string, segments []pathSegment) (parentContainer any, finalKey string, finalIndex int, containerParent any, containerParentKey string, containerParentIndex int, err error) {
+	current := doc
+	var prevContainer any
+	var prevKey string
+	var prevIndex int
+	last := len(segments) - 1
+	for _, segment := range segments[:last] {
+		switch container := current.(type) {
+		case map[string]any:
+			val, exists := container[segment.key]
+			if !exists {
+				err = errorf(ErrPathNotFound, "path segment %q not found in map for path %q", segment.key, pathRaw)
+				return
+			}
+			prevContainer, prevKey, prevIndex = current, segment.key, -1
+			current = val
+		case []any:
+			if segment.index < 0 {
+				err = errorf(ErrInvalidPointer, "path segment %q is not a valid integer index for slice in path %q", segment.key, pathRaw)
+				return
+			}
+			if segment.index >= len(container) {
+				err = errorf(ErrOutOfBounds, "index %d out of bounds for slice (len %d) at segment %q in path %q", segment.index, len(container), segment.key, pathRaw)
+				return
+			}
+			prevContainer, prevKey, prevIndex = current, "", segment.index
+			current = container[segment.index]
+		default:
+			err = errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) at segment %q (value type: %T)", pathRaw, segment.key, current)
+			return
+		}
+	}
+
+	containerParent, containerParentKey, containerParentIndex = prevContainer, prevKey, prevIndex
+	parentContainer = current
+	leaf := segments[last]
+	switch container := current.(type) {
+	case map[string]any:
+		finalKey = leaf.key
+	case []any:
+		switch {
+		case leaf.key == "-":
+			finalIndex = len(container)
+		case leaf.index < 0:
+			err = errorf(ErrInvalidPointer, "path segment %q is not a valid integer index for slice in path %q", leaf.key, pathRaw)
+		default:
+			finalIndex = leaf.index
+		}
+	default:
+		err = errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, current)
+	}
+	return
+}
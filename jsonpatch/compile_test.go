@@ -0,0 +1,106 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompiledPatch(t *testing.T) {
+	const src = `{"a": {"b": [1, 2, 3], "x/y": {"~": "hello"}}, "n": 1, "list": [{"id": 1}]}`
+	patches := []struct {
+		name string
+		ops  []Operation
+	}{
+		{"nested edits", []Operation{
+			{"op": "add", "path": "/a/b/1", "value": 9},
+			{"op": "remove", "path": "/a/b/0"},
+			{"op": "replace", "path": "/a/x~1y/~0", "value": "bye"},
+			{"op": "test", "path": "/a/b", "value": []any{9, 2, 3}},
+		}},
+		{"appends", []Operation{
+			{"op": "add", "path": "/a/b/-", "value": map[string]any{"k": 1}},
+			{"op": "add", "path": "/a/b/-", "value": []any{1}},
+			{"op": "add", "path": "/list/0/tags", "value": []any{}},
+			{"op": "add", "path": "/list/0/tags/-", "value": "t"},
+		}},
+		{"moves and strings", []Operation{
+			{"op": "move", "from": "/a/b/0", "path": "/a/b/2"},
+			{"op": "copy", "from": "/a/x~1y", "path": "/copy"},
+			{"op": "str_ins", "path": "/copy/~0", "pos": 5, "str": "!"},
+			{"op": "str_del", "path": "/a/x~1y/~0", "pos": 0, "len": 1},
+			{"op": "inc", "path": "/n", "inc": 2},
+		}},
+		{"root", []Operation{{"op": "replace", "path": "", "value": map[string]any{"fresh": true}}}},
+		{"missing member", []Operation{{"op": "add", "path": "/a/c", "value": 1}, {"op": "remove", "path": "/missing/x"}}},
+		{"bad index", []Operation{{"op": "replace", "path": "/a/b/01", "value": 1}}},
+		{"past the end", []Operation{{"op": "remove", "path": "/list/1/id"}}},
+		{"through a number", []Operation{{"op": "add", "path": "/n/x", "value": 1}}},
+		{"failed test", []Operation{{"op": "test", "path": "/n", "value": 2}}},
+	}
+	for _, tt := range patches {
+		t.Run(tt.name, func(t *testing.T) {
+			var expected, got map[string]any
+			if err := json.Unmarshal([]byte(src), &expected); err != nil {
+				t.Fatal(err)
+			}
+			got = deepCopyValue(expected).(map[string]any)
+			compiled, err := Compile(tt.ops)
+			if err != nil {
+				t.Fatalf("Compile returned error: %v", err)
+			}
+			expectedErr := Apply(expected, deepCopyValue(tt.ops).([]Operation))
+			err = compiled.Apply(got)
+			if (err == nil) != (expectedErr == nil) || (err != nil && err.Error() != expectedErr.Error()) {
+				t.Fatalf("expected error %v, got %v", expectedErr, err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", got, expected)
+			}
+		})
+	}
+}
+
+func TestCompiledPatchCopiesValues(t *testing.T) {
+	ops := []Operation{
+		{"op": "add", "path": "/meta", "value": map[string]any{"v": 1}},
+		{"op": "extend", "path": "", "props": map[string]any{"tags": []any{"a"}}},
+	}
+	compiled, err := Compile(ops)
+	if err != nil {
+		t.Fatalf("Compile returned error: %v", err)
+	}
+	ops[0]["path"] = "/other"
+	first, second := map[string]any{}, map[string]any{}
+	for _, doc := range []map[string]any{first, second} {
+		if err := compiled.Apply(doc); err != nil {
+			t.Fatalf("Apply returned error: %v", err)
+		}
+	}
+	first["meta"].(map[string]any)["v"] = 2
+	first["tags"].([]any)[0] = "b"
+	if second["meta"].(map[string]any)["v"] != 1 || second["tags"].([]any)[0] != "a" {
+		t.Fatal("documents share values written by the patch")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []Operation
+	}{
+		{"unknown op", []Operation{{"op": "frobnicate", "path": "/a"}}},
+		{"missing value", []Operation{{"op": "add", "path": "/a"}}},
+		{"bad pointer", []Operation{{"op": "remove", "path": "/a~2"}}},
+		{"negative pos", []Operation{{"op": "str_ins", "path": "/s", "pos": -1, "str": "x"}}},
+		{"missing from", []Operation{{"op": "remove", "path": "/a"}, {"op": "move", "path": "/b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compile(tt.ops); !errors.Is(err, ErrInvalidOperation) {
+				t.Fatalf("expected ErrInvalidOperation, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Package conformance runs the json-patch-tests suite
+// (https://github.com/json-patch/json-patch-tests) against jsonpatch.ApplyValue.
+//
+// Suite files are JSON arrays of cases. Each case has a document, a patch, and
+// either the expected document or an error description. Cases marked
+// "disabled" upstream are skipped, as are cases listed in a skip list because
+// this package intentionally behaves differently.
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/corpus"
+)
+
+// Case is a single entry of a json-patch-tests suite file.
+type Case struct {
+	Comment  string           `json:"comment,omitempty"`
+	Doc      any              `json:"doc"`
+	Patch    []map[string]any `json:"patch"`
+	Expected any              `json:"expected,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Disabled bool             `json:"disabled,omitempty"`
+
+	// HasExpected distinguishes an expected document of null from a case that
+	// does not specify one.
+	HasExpected bool `json:"-"`
+}
+
+// UnmarshalJSON records whether the "expected" member was present.
+func (c *Case) UnmarshalJSON(data []byte) error {
+	type plain Case
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	_, c.HasExpected = fields["expected"]
+	return nil
+}
+
+// Name returns a label for the case, falling back to its position in the file.
+func (c Case) Name(index int) string {
+	if c.Comment != "" {
+		return c.Comment
+	}
+	return fmt.Sprintf("case %d", index)
+}
+
+// Load reads a suite file.
+func Load(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("parse %q: %w", path, err)
+	}
+	return cases, nil
+}
+
+// LoadCorpus reads a corpus directory (see package corpus) as suite cases, so
+// cases checked in from other implementations run through the same checks.
+// Case directory names become comments.
+func LoadCorpus(dir string) ([]Case, error) {
+	entries, err := corpus.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	cases := make([]Case, len(entries))
+	for i, e := range entries {
+		cases[i] = Case{
+			Comment:     e.Name,
+			Doc:         e.Original,
+			Patch:       e.Patch,
+			Expected:    e.Expected,
+			HasExpected: e.HasExpected,
+			Error:       e.Error,
+			Disabled:    e.Meta.Disabled,
+		}
+	}
+	return cases, nil
+}
+
+// Outcome classifies the result of running a case.
+type Outcome int
+
+const (
+	Passed Outcome = iota
+	Failed
+	Skipped
+)
+
+// Result describes the outcome of running one case.
+type Result struct {
+	Outcome Outcome
+	// Reason explains a failure or skip.
+	Reason string
+	// Got is the patched document when the patch applied successfully.
+	Got any
+	// Err is the error returned by ApplyValue, if any.
+	Err error
+}
+
+// Run applies a case and compares the outcome with the suite's expectation.
+// When skip contains the case's comment, the case is skipped with that reason.
+func Run(c Case, skip map[string]string) Result {
+	if c.Disabled {
+		return Result{Outcome: Skipped, Reason: "disabled upstream"}
+	}
+	if reason, ok := skip[c.Comment]; ok {
+		return Result{Outcome: Skipped, Reason: reason}
+	}
+
+	got, err := jsonpatch.ApplyValue(cloneValue(c.Doc), c.Patch)
+	switch {
+	case c.Error != "":
+		if err == nil {
+			return Result{Outcome: Failed, Got: got, Reason: fmt.Sprintf("expected error (%s), but the patch applied", c.Error)}
+		}
+		return Result{Outcome: Passed, Err: err}
+	case err != nil:
+		return Result{Outcome: Failed, Err: err, Reason: fmt.Sprintf("unexpected error: %v", err)}
+	case c.HasExpected && !jsonEqual(got, c.Expected):
+		return Result{Outcome: Failed, Got: got, Reason: fmt.Sprintf("got %s, expected %s", encode(got), encode(c.Expected))}
+	default:
+		return Result{Outcome: Passed, Got: got}
+	}
+}
+
+func cloneValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, child := range v {
+			out[k] = cloneValue(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = cloneValue(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// jsonEqual compares documents by their JSON encoding, which normalizes the
+// numeric types produced by operations such as inc.
+func jsonEqual(a, b any) bool {
+	return encode(a) == encode(b)
+}
+
+func encode(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
@@ -0,0 +1,62 @@
+package conformance
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// skipped lists cases where this package intentionally differs from the suite.
+var skipped = map[string]string{
+	"invalid JSON Pointer token": "paths without a leading \"/\" are accepted and resolved from the root",
+}
+
+func TestSuites(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no suite files found in testdata")
+	}
+
+	for _, file := range files {
+		cases, err := Load(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			for i, c := range cases {
+				t.Run(c.Name(i), func(t *testing.T) {
+					result := Run(c, skipped)
+					switch result.Outcome {
+					case Skipped:
+						t.Skip(result.Reason)
+					case Failed:
+						t.Fatal(result.Reason)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	cases, err := LoadCorpus(filepath.Join("testdata", "corpus"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatal("no corpus cases found in testdata/corpus")
+	}
+	for i, c := range cases {
+		t.Run(c.Name(i), func(t *testing.T) {
+			result := Run(c, skipped)
+			switch result.Outcome {
+			case Skipped:
+				t.Skip(result.Reason)
+			case Failed:
+				t.Fatal(result.Reason)
+			}
+		})
+	}
+}
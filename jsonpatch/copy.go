@@ -0,0 +1,261 @@
+package jsonpatch
+
+import (
+	"context"
+	"maps"
+	"reflect"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// ApplyNew applies operations to a copy of doc, which may have any JSON
+// root, and returns the copy, leaving doc untouched. Only the objects and
+// arrays the operations write into are copied: the result shares every
+// subtree the patch leaves alone with doc, so patching a large document
+// costs little more than the patch itself. Modifying the result in place
+// afterwards can therefore change doc, and, as with Apply, the values the
+// operations write are stored as they are. If an operation fails, the
+// error is returned with a nil document.
+func ApplyNew(doc any, operations []map[string]any) (any, error) {
+	result, err := applyCopy(context.Background(), doc, operations, Options{}, false)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// applyCopy applies operations to a copy of doc, copying the containers
+// the operations write into as they go, and returns the copy. keepRoot
+// keeps a map root a map, as Apply does.
+func applyCopy(ctx context.Context, doc any, operations []map[string]any, opts Options, keepRoot bool) (any, error) {
+	opts.Index = nil
+	a, err := newApplier(ctx, shallowCopy(doc), opts, operations)
+	if err != nil {
+		return nil, err
+	}
+	var audited int
+	if opts.Audit != nil {
+		audited = len(opts.Audit.Entries)
+	}
+	a.cow = &copyOnWrite{a: a, owned: map[unsafe.Pointer]bool{}}
+	a.cow.mark(a.root)
+	if keepRoot {
+		a.mapRoot = a.root.(map[string]any)
+	}
+	err = a.apply(operations)
+	if err != nil && !opts.DryRun {
+		// Nothing the patch did is kept.
+		if opts.Report != nil {
+			opts.Report.Changes = nil
+		}
+		if opts.Audit != nil {
+			opts.Audit.Entries = opts.Audit.Entries[:audited]
+		}
+	}
+	return a.root, err
+}
+
+// dryRun applies operations to a copy of doc, and of the documents a move
+// could take values from, and discards the result.
+func dryRun(ctx context.Context, doc any, operations []map[string]any, opts Options, keepRoot bool) error {
+	// Nothing is changed, so there is nothing to audit.
+	opts.Audit = nil
+	if opts.Documents != nil {
+		documents := make(map[string]any, len(opts.Documents))
+		for name, d := range opts.Documents {
+			documents[name] = deepCopyValue(d)
+		}
+		opts.Documents = documents
+	}
+	_, err := applyCopy(ctx, doc, operations, opts, keepRoot)
+	return err
+}
+
+// applyAtomic applies operations to a copy of doc and, once they have all
+// succeeded, moves the result into doc.
+func applyAtomic(ctx context.Context, doc map[string]any, operations []map[string]any, opts Options) error {
+	if opts.Index != nil {
+		if _, err := opts.Index.cacheFor(doc); err != nil {
+			return err
+		}
+	}
+	result, err := applyCopy(ctx, doc, operations, opts, true)
+	if err != nil {
+		return err
+	}
+	clear(doc)
+	maps.Copy(doc, result.(map[string]any))
+	if opts.Index != nil {
+		// The containers the patch wrote into were replaced by copies.
+		opts.Index.Reset()
+	}
+	return nil
+}
+
+// copyOnWrite tracks which containers of a copied document belong to it
+// rather than to the original.
+type copyOnWrite struct {
+	a     *applier
+	owned map[unsafe.Pointer]bool
+}
+
+// before copies the containers op is about to write into.
+func (c *copyOnWrite) before(op map[string]any) {
+	if isPredicate(op["op"]) {
+		return
+	}
+	pathRaw, _ := op["path"].(string)
+	pathRaw = absolutePointer(pathRaw)
+	switch op["op"] {
+	case "move":
+		fromRaw, _ := op["from"].(string)
+		if _, _, ok := c.a.documentRef(fromRaw); !ok {
+			fromRaw = absolutePointer(fromRaw)
+			c.own(fromRaw)
+			pathRaw = c.shiftedByRemoval(fromRaw, pathRaw)
+		}
+		c.own(pathRaw)
+	case "extend":
+		// extend writes into the object at the path itself.
+		c.own(pathRaw + "/")
+	default:
+		c.own(pathRaw)
+	}
+}
+
+// after records the containers along the path of op, which it may have
+// reallocated, as belonging to the copy. Predicates leave the containers
+// they read as the original's.
+func (c *copyOnWrite) after(op map[string]any) {
+	if isPredicate(op["op"]) {
+		return
+	}
+	pathRaw, _ := op["path"].(string)
+	c.markPath(absolutePointer(pathRaw))
+}
+
+// absolutePointer adds the leading "/" that Apply lets pointers omit.
+func absolutePointer(pathRaw string) string {
+	if pathRaw == "" || strings.HasPrefix(pathRaw, "/") {
+		return pathRaw
+	}
+	return "/" + pathRaw
+}
+
+func shallowCopy(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return maps.Clone(v)
+	case []any:
+		return append([]any(nil), v...)
+	}
+	return v
+}
+
+// identity returns what identifies a container, or nil for values that are
+// not containers and for empty slices, which are cheap to copy again.
+func identity(v any) unsafe.Pointer {
+	switch v := v.(type) {
+	case map[string]any:
+		return reflect.ValueOf(v).UnsafePointer()
+	case []any:
+		if len(v) > 0 {
+			return unsafe.Pointer(unsafe.SliceData(v))
+		}
+	}
+	return nil
+}
+
+func (c *copyOnWrite) mark(v any) {
+	if id := identity(v); id != nil {
+		c.owned[id] = true
+	}
+}
+
+// own copies the containers along pathRaw, not counting the value it points
+// to, that still belong to the original, so that the op can write into
+// them. It stops where the path does not resolve, leaving the op to fail.
+func (c *copyOnWrite) own(pathRaw string) {
+	if !strings.HasPrefix(pathRaw, "/") {
+		return
+	}
+	current := c.a.root
+	segments := strings.Split(pathRaw[1:], "/")
+	for i, segment := range segments[:len(segments)-1] {
+		var child any
+		switch container := current.(type) {
+		case map[string]any:
+			key, err := decodePointerSegment(segment)
+			if err != nil {
+				return
+			}
+			var ok bool
+			if child, ok = container[key]; !ok {
+				return
+			}
+			if id := identity(child); id != nil && !c.owned[id] {
+				child = shallowCopy(child)
+				container[key] = child
+			}
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(container) {
+				return
+			}
+			child = container[index]
+			if id := identity(child); id != nil && !c.owned[id] {
+				child = shallowCopy(child)
+				container[index] = child
+			}
+		default:
+			return
+		}
+		c.mark(child)
+		c.a.cache.invalidate("/" + strings.Join(segments[:i+1], "/"))
+		current = child
+	}
+}
+
+// markPath records the containers along pathRaw after an op, when they all
+// belong to the copy.
+func (c *copyOnWrite) markPath(pathRaw string) {
+	for end := strings.IndexByte(pathRaw, '/'); end >= 0; {
+		if v, err := c.a.valueAt(pathRaw[:end]); err == nil {
+			c.mark(v)
+		}
+		next := strings.IndexByte(pathRaw[end+1:], '/')
+		if next < 0 {
+			return
+		}
+		end += next + 1
+	}
+}
+
+// shiftedByRemoval returns the pointer that, before a move removes the
+// value at fromRaw, leads to the container the move then writes into at
+// pathRaw. Removing an array element shifts the elements after it down.
+func (c *copyOnWrite) shiftedByRemoval(fromRaw, pathRaw string) string {
+	if fromRaw == "" {
+		return pathRaw
+	}
+	parentRaw := parentPointer(fromRaw)
+	parent, err := c.a.valueAt(parentRaw)
+	if _, isArray := parent.([]any); err != nil || !isArray {
+		return pathRaw
+	}
+	removed, err := strconv.Atoi(fromRaw[len(parentRaw)+1:])
+	if err != nil {
+		return pathRaw
+	}
+	rest, ok := strings.CutPrefix(pathRaw, parentRaw+"/")
+	if !ok {
+		return pathRaw
+	}
+	segment, tail, deeper := strings.Cut(rest, "/")
+	index, err := strconv.Atoi(segment)
+	if !deeper || err != nil || index < removed {
+		return pathRaw
+	}
+	return parentRaw + "/" + strconv.Itoa(index+1) + "/" + tail
+}
@@ -0,0 +1,104 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApplyNew(t *testing.T) {
+	const src = `{
+		"a": {"b": {"c": 1}, "s": "hello", "n": 1},
+		"list": [{"x": 1}, {"x": 2}, {"x": 3}],
+		"big": {"untouched": [1, 2, 3]}
+	}`
+	tests := []struct {
+		name string
+		ops  []map[string]any
+	}{
+		{"replace nested", []map[string]any{{"op": "replace", "path": "/a/b/c", "value": 2}}},
+		{"add and remove", []map[string]any{{"op": "add", "path": "/a/b/d", "value": 1}, {"op": "remove", "path": "/list/1/x"}}},
+		{"array inserts", []map[string]any{{"op": "add", "path": "/list/0", "value": 0}, {"op": "add", "path": "/list/-", "value": 4}, {"op": "add", "path": "/list/-", "value": 5}}},
+		{"string and number edits", []map[string]any{{"op": "str_ins", "path": "/a/s", "pos": 5, "str": "!"}, {"op": "inc", "path": "/a/n", "inc": 1}}},
+		{"copy then edit the copy", []map[string]any{{"op": "copy", "from": "/a/b", "path": "/copied"}, {"op": "replace", "path": "/copied/c", "value": 9}}},
+		{"move shifting the target", []map[string]any{{"op": "move", "from": "/list/0", "path": "/list/1/y"}, {"op": "replace", "path": "/list/1/x", "value": 0}}},
+		{"move out of an object", []map[string]any{{"op": "move", "from": "/a/b/c", "path": "/list/2/c"}}},
+		{"pointers without a slash", []map[string]any{{"op": "replace", "path": "a/b/c", "value": 2}}},
+		{"edit a written value", []map[string]any{{"op": "add", "path": "/v", "value": map[string]any{"k": 1}}, {"op": "add", "path": "/v/l", "value": 2}}},
+		{"extend", []map[string]any{{"op": "extend", "path": "/list/1", "props": map[string]any{"x": nil, "y": 2}, "deleteNull": true}, {"op": "extend", "path": "", "props": map[string]any{"big": 0}}}},
+		{"remove and test", []map[string]any{{"op": "remove", "path": "/big"}, {"op": "test", "path": "/a/n", "value": 1}}},
+		// Predicates read the containers along their paths without copying
+		// them, so the writes after them still need to.
+		{"test then write", []map[string]any{{"op": "test", "path": "/a/b/c", "value": 1}, {"op": "add", "path": "/a/b/d", "value": 2}}},
+		{"less then write", []map[string]any{{"op": "less", "path": "/a/b/c", "value": 5}, {"op": "add", "path": "/a/b/d", "value": 2}}},
+		{"more then write", []map[string]any{{"op": "more", "path": "/a/b/c", "value": 0}, {"op": "add", "path": "/a/b/d", "value": 2}}},
+		{"in then write", []map[string]any{{"op": "in", "path": "/a/b/c", "value": []any{1, 2}}, {"op": "add", "path": "/a/b/d", "value": 2}}},
+		{"defined then write", []map[string]any{{"op": "defined", "path": "/list/1/x"}, {"op": "add", "path": "/list/1/y", "value": 2}}},
+		{"undefined then write", []map[string]any{{"op": "undefined", "path": "/list/1/y"}, {"op": "add", "path": "/list/1/y", "value": 2}}},
+		{"type then write", []map[string]any{{"op": "type", "path": "/a/b/c", "value": "number"}, {"op": "remove", "path": "/a/b/c"}}},
+		{"contains then write", []map[string]any{{"op": "contains", "path": "/a/s", "value": "ell"}, {"op": "add", "path": "/a/b/d", "value": 2}}},
+		{"starts then write", []map[string]any{{"op": "starts", "path": "/a/s", "value": "he"}, {"op": "add", "path": "/a/b/d", "value": 2}}},
+		{"ends then write", []map[string]any{{"op": "ends", "path": "/a/s", "value": "lo"}, {"op": "add", "path": "/a/b/d", "value": 2}}},
+		{"matches then write", []map[string]any{{"op": "matches", "path": "/a/s", "value": "^h"}, {"op": "add", "path": "/a/b/d", "value": 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc, expected any
+			if err := json.Unmarshal([]byte(src), &doc); err != nil {
+				t.Fatal(err)
+			}
+			original := deepCopyValue(doc)
+			ops := deepCopyValue(tt.ops).([]map[string]any)
+			expected, err := ApplyValue(deepCopyValue(doc), deepCopyValue(tt.ops).([]map[string]any))
+			if err != nil {
+				t.Fatalf("ApplyValue returned error: %v", err)
+			}
+
+			result, err := ApplyNew(doc, ops)
+			if err != nil {
+				t.Fatalf("ApplyNew returned error: %v", err)
+			}
+			if !reflect.DeepEqual(result, expected) {
+				t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", result, expected)
+			}
+			if !reflect.DeepEqual(doc, original) {
+				t.Fatalf("ApplyNew modified its input: %v", doc)
+			}
+			if !reflect.DeepEqual(ops, tt.ops) {
+				t.Fatalf("ApplyNew modified the operations: %v", ops)
+			}
+		})
+	}
+}
+
+func TestApplyNewSharesUntouchedSubtrees(t *testing.T) {
+	untouched := []any{1, 2, 3}
+	doc := map[string]any{"a": map[string]any{"b": 1}, "big": map[string]any{"list": untouched}}
+	result, err := ApplyNew(doc, []map[string]any{{"op": "replace", "path": "/a/b", "value": 2}})
+	if err != nil {
+		t.Fatalf("ApplyNew returned error: %v", err)
+	}
+	got := result.(map[string]any)
+	if identity(got["big"]) != identity(doc["big"]) {
+		t.Fatal("an untouched subtree was copied")
+	}
+	if identity(got["a"]) == identity(doc["a"]) {
+		t.Fatal("a written subtree was not copied")
+	}
+}
+
+func TestApplyNewError(t *testing.T) {
+	doc := map[string]any{"a": map[string]any{"b": 1}}
+	result, err := ApplyNew(doc, []map[string]any{
+		{"op": "replace", "path": "/a/b", "value": 2},
+		{"op": "remove", "path": "/missing"},
+	})
+	var opErr *OpError
+	if result != nil || !errors.As(err, &opErr) || opErr.Index != 1 {
+		t.Fatalf("expected a nil document and an error for op 1, got %v, %v", result, err)
+	}
+	if doc["a"].(map[string]any)["b"] != 1 {
+		t.Fatalf("ApplyNew modified its input: %v", doc)
+	}
+}
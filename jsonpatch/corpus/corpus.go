@@ -0,0 +1,194 @@
+// Package corpus reads and writes directories of JSON Patch test cases.
+//
+// A corpus is a directory with one subdirectory per case:
+//
+//	<corpus>/<case>/original.json   document the patch is applied to
+//	<corpus>/<case>/patch.json      array of operations
+//	<corpus>/<case>/expected.json   patched document (optional)
+//	<corpus>/<case>/error.txt       substring of the expected error (optional)
+//	<corpus>/<case>/meta.json       Meta describing the case (optional)
+//
+// A case has at most one of expected.json and error.txt. The format is plain
+// files so corpora produced by other implementations can be checked in and
+// replayed by the test harness, the conformance runner, and golden tests.
+package corpus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File names inside a case directory.
+const (
+	OriginalFile = "original.json"
+	PatchFile    = "patch.json"
+	ExpectedFile = "expected.json"
+	ErrorFile    = "error.txt"
+	MetaFile     = "meta.json"
+)
+
+// Meta holds optional information about where a case came from.
+type Meta struct {
+	Description string `json:"description,omitempty"`
+	// Source names the tool or implementation that produced the case, such as
+	// "json-joy" or "fuzz".
+	Source   string   `json:"source,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Disabled bool     `json:"disabled,omitempty"`
+}
+
+// Case is one corpus entry.
+type Case struct {
+	// Name is the case directory name.
+	Name     string
+	Original any
+	Patch    []map[string]any
+	Expected any
+	// HasExpected distinguishes an expected document of null from a case
+	// without expected.json.
+	HasExpected bool
+	// Error is the expected error substring, or "" when the patch must apply.
+	Error string
+	Meta  Meta
+}
+
+// Load reads every case directory directly below dir, in name order.
+// Subdirectories without an original.json are ignored.
+func Load(dir string) ([]Case, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		caseDir := filepath.Join(dir, entry.Name())
+		if _, err := os.Stat(filepath.Join(caseDir, OriginalFile)); err != nil {
+			continue
+		}
+		c, err := LoadCase(caseDir)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+// LoadCase reads a single case directory.
+func LoadCase(dir string) (Case, error) {
+	c := Case{Name: filepath.Base(dir)}
+	if err := readJSON(filepath.Join(dir, OriginalFile), &c.Original); err != nil {
+		return c, err
+	}
+	if err := readJSON(filepath.Join(dir, PatchFile), &c.Patch); err != nil {
+		return c, err
+	}
+	if err := readJSON(filepath.Join(dir, MetaFile), &c.Meta); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return c, err
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, ErrorFile)); err == nil {
+		c.Error = strings.TrimSpace(string(data))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return c, err
+	}
+	switch err := readJSON(filepath.Join(dir, ExpectedFile), &c.Expected); {
+	case err == nil:
+		c.HasExpected = true
+	case !errors.Is(err, os.ErrNotExist):
+		return c, err
+	}
+	if c.HasExpected && c.Error != "" {
+		return c, fmt.Errorf("case %q has both %s and %s", dir, ExpectedFile, ErrorFile)
+	}
+	return c, nil
+}
+
+// Save writes each case to its own directory below dir, creating dir if
+// needed. Existing files of a case are overwritten; files the case no longer
+// has (such as a stale expected.json) are removed.
+func Save(dir string, cases []Case) error {
+	for _, c := range cases {
+		if err := SaveCase(filepath.Join(dir, c.Name), c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveCase writes c to dir, creating it if needed.
+func SaveCase(dir string, c Case) error {
+	if c.HasExpected && c.Error != "" {
+		return fmt.Errorf("case %q cannot have both an expected document and an expected error", c.Name)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := WriteJSON(filepath.Join(dir, OriginalFile), c.Original); err != nil {
+		return err
+	}
+	patch := c.Patch
+	if patch == nil {
+		patch = []map[string]any{}
+	}
+	if err := WriteJSON(filepath.Join(dir, PatchFile), patch); err != nil {
+		return err
+	}
+
+	if c.HasExpected {
+		if err := WriteJSON(filepath.Join(dir, ExpectedFile), c.Expected); err != nil {
+			return err
+		}
+	} else if err := removeIfExists(filepath.Join(dir, ExpectedFile)); err != nil {
+		return err
+	}
+	if c.Error != "" {
+		if err := os.WriteFile(filepath.Join(dir, ErrorFile), []byte(c.Error+"\n"), 0o644); err != nil {
+			return err
+		}
+	} else if err := removeIfExists(filepath.Join(dir, ErrorFile)); err != nil {
+		return err
+	}
+	if c.Meta.Description != "" || c.Meta.Source != "" || len(c.Meta.Tags) > 0 || c.Meta.Disabled {
+		return WriteJSON(filepath.Join(dir, MetaFile), c.Meta)
+	}
+	return removeIfExists(filepath.Join(dir, MetaFile))
+}
+
+// WriteJSON writes v to path as indented JSON followed by a newline, the
+// layout used for every JSON file in a corpus.
+func WriteJSON(path string, v any) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %q: %w", path, err)
+	}
+	return nil
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
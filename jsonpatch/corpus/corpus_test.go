@@ -0,0 +1,115 @@
+package corpus
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	cases := []Case{
+		{
+			Name:        "applies",
+			Original:    map[string]any{"a": "x"},
+			Patch:       []map[string]any{{"op": "str_ins", "path": "/a", "pos": float64(1), "str": "🌍"}},
+			Expected:    map[string]any{"a": "x🌍"},
+			HasExpected: true,
+			Meta:        Meta{Description: "emoji append", Source: "json-joy", Tags: []string{"unicode"}},
+		},
+		{
+			Name:     "fails",
+			Original: []any{},
+			Patch:    []map[string]any{{"op": "remove", "path": "/0"}},
+			Error:    "out of bounds",
+		},
+		{
+			Name:        "null result",
+			Original:    float64(1),
+			Patch:       []map[string]any{{"op": "replace", "path": "", "value": nil}},
+			HasExpected: true,
+		},
+	}
+	if err := Save(dir, cases); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fails", MetaFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected no %s for a case without metadata, got %v", MetaFile, err)
+	}
+
+	loaded, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, cases) {
+		t.Fatalf("round trip mismatch.\nGot:      %+v\nExpected: %+v", loaded, cases)
+	}
+
+	// Saving a case again without an expectation removes the stale file.
+	cases[0].HasExpected, cases[0].Expected = false, nil
+	if err := SaveCase(filepath.Join(dir, "applies"), cases[0]); err != nil {
+		t.Fatalf("SaveCase returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "applies", ExpectedFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected stale %s to be removed, got %v", ExpectedFile, err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		files         map[string]string
+		expectedError string
+	}{
+		{
+			name:          "missing patch",
+			files:         map[string]string{OriginalFile: "{}"},
+			expectedError: PatchFile,
+		},
+		{
+			name:          "malformed meta",
+			files:         map[string]string{OriginalFile: "{}", PatchFile: "[]", MetaFile: "{"},
+			expectedError: "parse",
+		},
+		{
+			name:          "both expected and error",
+			files:         map[string]string{OriginalFile: "{}", PatchFile: "[]", ExpectedFile: "{}", ErrorFile: "boom"},
+			expectedError: "has both",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			caseDir := filepath.Join(dir, "case")
+			if err := os.Mkdir(caseDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range tc.files {
+				if err := os.WriteFile(filepath.Join(caseDir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := Load(dir)
+			if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Fatalf("expected error containing %q, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestLoadIgnoresOtherEntries(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("notes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "scratch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cases, err := Load(dir)
+	if err != nil || len(cases) != 0 {
+		t.Fatalf("expected no cases, got %v (err %v)", cases, err)
+	}
+}
@@ -0,0 +1,240 @@
+package crdt
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+func TestLocal(t *testing.T) {
+	tests := []struct {
+		name          string
+		patch         []jsonpatch.Operation
+		expected      string
+		expectedEdits int
+		expectedError string
+	}{
+		{
+			name: "insert and delete",
+			patch: []jsonpatch.Operation{
+				{"op": "str_ins", "path": "/doc/text", "pos": 5, "str": ", dear"},
+				{"op": "str_del", "path": "/doc/text", "pos": float64(0), "len": float64(1)},
+				{"op": "str_ins", "path": "/doc/text", "pos": 0, "str": "H"},
+			},
+			expected:      "Hello, dear world",
+			expectedEdits: 3,
+		},
+		{
+			name:          "delete by text counts characters",
+			patch:         []jsonpatch.Operation{{"op": "str_del", "path": "/doc/text", "pos": 6, "str": "world"}},
+			expected:      "hello ",
+			expectedEdits: 1,
+		},
+		{
+			name: "operations elsewhere are ignored",
+			patch: []jsonpatch.Operation{
+				{"op": "replace", "path": "/doc/title", "value": "x"},
+				{"op": "test", "path": "/doc/text", "value": "hello world"},
+			},
+			expected: "hello world",
+		},
+		{
+			name:          "path without leading slash",
+			patch:         []jsonpatch.Operation{{"op": "str_ins", "path": "doc/text", "pos": 11, "str": "!"}},
+			expected:      "hello world!",
+			expectedEdits: 1,
+		},
+		{
+			name: "replacing a text field",
+			patch: []jsonpatch.Operation{
+				{"op": "str_ins", "path": "/doc/text", "pos": 0, "str": "x"},
+				{"op": "replace", "path": "/doc/text", "value": "x"},
+			},
+			expected:      "hello world",
+			expectedError: "would overwrite a text field",
+		},
+		{
+			name:          "removing a container of a text field",
+			patch:         []jsonpatch.Operation{{"op": "remove", "path": "/doc"}},
+			expected:      "hello world",
+			expectedError: "would overwrite text field \"/doc/text\"",
+		},
+		{
+			name:          "moving a text field away",
+			patch:         []jsonpatch.Operation{{"op": "move", "from": "/doc/text", "path": "/other"}},
+			expected:      "hello world",
+			expectedError: "would overwrite text field",
+		},
+		{
+			name:          "insert past the end",
+			patch:         []jsonpatch.Operation{{"op": "str_ins", "path": "/doc/text", "pos": 12, "str": "x"}},
+			expected:      "hello world",
+			expectedError: "invalid \"pos\" 12",
+		},
+		{
+			name:          "delete without len or str",
+			patch:         []jsonpatch.Operation{{"op": "str_del", "path": "/doc/text", "pos": 1}},
+			expected:      "hello world",
+			expectedError: "str or len required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{"doc": map[string]any{"text": "hello world", "title": "t"}}
+			f, err := NewFields("a", doc, "/doc/text")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			edits, err := f.Local(tt.patch)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(edits) != tt.expectedEdits {
+				t.Fatalf("expected %d edits, got %v", tt.expectedEdits, edits)
+			}
+			if got, _ := f.Text("/doc/text"); got != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewFields(t *testing.T) {
+	doc := map[string]any{"n": 1}
+	if _, err := NewFields("a", doc, "/n"); err == nil || !strings.Contains(err.Error(), "is not a string") {
+		t.Fatalf("expected a type error, got %v", err)
+	}
+	if _, err := NewFields("a", doc, "/missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected a missing field error, got %v", err)
+	}
+}
+
+func TestRemoteHoldsEditsUntilReady(t *testing.T) {
+	doc := func() map[string]any { return map[string]any{"s": "ab"} }
+	a, _ := NewFields("a", doc(), "/s")
+	b, _ := NewFields("b", doc(), "/s")
+
+	first, _ := a.Local([]jsonpatch.Operation{{"op": "str_ins", "path": "/s", "pos": 1, "str": "x"}})
+	second, _ := a.Local([]jsonpatch.Operation{{"op": "str_ins", "path": "/s", "pos": 2, "str": "y"}})
+
+	ops, err := b.Remote(second)
+	if err != nil || len(ops) != 0 || b.Held() != 1 {
+		t.Fatalf("expected the edit to be held, got %v, %v, %d held", ops, err, b.Held())
+	}
+	ops, err = b.Remote(append(first, first...))
+	if err != nil || b.Held() != 0 {
+		t.Fatalf("expected both edits to apply, got %v, %d held", err, b.Held())
+	}
+	d := doc()
+	if err := jsonpatch.Apply(d, ops); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if d["s"] != "axyb" {
+		t.Fatalf("expected %q, got %q", "axyb", d["s"])
+	}
+}
+
+// TestConverges edits a text field concurrently on several replicas and
+// delivers the edits to each replica in a different random order, with
+// duplicates, then checks that every replica ends with the same document.
+func TestConverges(t *testing.T) {
+	const replicas = 3
+	alphabet := []string{"a", "b", "c", "😀", "é"}
+	for seed := int64(0); seed < 20; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			rng := rand.New(rand.NewSource(seed))
+			docs := make([]any, replicas)
+			fields := make([]*Fields, replicas)
+			inboxes := make([][]Edit, replicas)
+			for i := range replicas {
+				docs[i] = map[string]any{"title": "héllo 😀 world"}
+				var err error
+				if fields[i], err = NewFields(fmt.Sprintf("r%d", i), docs[i], "/title"); err != nil {
+					t.Fatalf("new fields: %v", err)
+				}
+			}
+
+			deliver := func(i int) {
+				inbox := inboxes[i]
+				rng.Shuffle(len(inbox), func(a, b int) { inbox[a], inbox[b] = inbox[b], inbox[a] })
+				n := rng.Intn(len(inbox) + 1)
+				ops, err := fields[i].Remote(inbox[:n])
+				if err != nil {
+					t.Fatalf("remote: %v", err)
+				}
+				if docs[i], err = jsonpatch.ApplyValue(docs[i], ops); err != nil {
+					t.Fatalf("apply remote ops %v: %v", ops, err)
+				}
+				// Some delivered edits are delivered again later.
+				inboxes[i] = append(inbox[n:], inbox[:n/3]...)
+			}
+
+			for step := 0; step < 60; step++ {
+				i := rng.Intn(replicas)
+				if rng.Intn(3) == 0 {
+					deliver(i)
+					continue
+				}
+				text, _ := fields[i].Text("/title")
+				length := utf16Len(text)
+				var op jsonpatch.Operation
+				if length > 0 && rng.Intn(2) == 0 {
+					pos := rng.Intn(length)
+					op = jsonpatch.Operation{"op": "str_del", "path": "/title", "pos": pos, "len": 1 + rng.Intn(min(3, length-pos))}
+				} else {
+					op = jsonpatch.Operation{"op": "str_ins", "path": "/title", "pos": rng.Intn(length + 1), "str": alphabet[rng.Intn(len(alphabet))]}
+				}
+				patch := []jsonpatch.Operation{op}
+				var err error
+				if docs[i], err = jsonpatch.ApplyValue(docs[i], patch); err != nil {
+					t.Fatalf("apply local %v: %v", op, err)
+				}
+				edits, err := fields[i].Local(patch)
+				if err != nil {
+					t.Fatalf("local %v: %v", op, err)
+				}
+				for j := range replicas {
+					if j != i {
+						inboxes[j] = append(inboxes[j], edits...)
+					}
+				}
+			}
+
+			var want string
+			for i := range replicas {
+				ops, err := fields[i].Remote(inboxes[i])
+				if err != nil {
+					t.Fatalf("remote: %v", err)
+				}
+				if docs[i], err = jsonpatch.ApplyValue(docs[i], ops); err != nil {
+					t.Fatalf("apply remote ops: %v", err)
+				}
+				got := docs[i].(map[string]any)["title"].(string)
+				if text, _ := fields[i].Text("/title"); text != got {
+					t.Fatalf("replica %d: fields hold %q, document holds %q", i, text, got)
+				}
+				if i == 0 {
+					want = got
+				} else if got != want {
+					t.Fatalf("replica %d diverged: %q, replica 0 has %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16Units(r)
+	}
+	return n
+}
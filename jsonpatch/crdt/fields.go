@@ -0,0 +1,258 @@
+package crdt
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/jsonpointer"
+)
+
+// Fields holds the designated text fields of one replica's document. The
+// replica applies its own patches to its document as usual and passes them to
+// Local, which returns the edits to broadcast; edits from other replicas go
+// through Remote, which returns str_ins and str_del operations to apply to the
+// document. Only the text fields are kept in sync this way; the rest of the
+// document is left to the caller. Fields is safe for concurrent use.
+type Fields struct {
+	mu    sync.Mutex
+	texts map[string]*Text
+	// held holds remote edits waiting for the edits they depend on.
+	held []Edit
+}
+
+// NewFields returns the fields at paths in doc for the replica with the given
+// ID. Each path must hold a string, and every replica must start from the
+// same strings. Paths are fixed, so fields should not sit inside arrays that
+// other patches insert into or remove from.
+func NewFields(replica string, doc any, paths ...string) (*Fields, error) {
+	f := &Fields{texts: map[string]*Text{}}
+	for _, path := range paths {
+		path = normalize(path)
+		value, ok := lookup(doc, path)
+		if !ok {
+			return nil, fmt.Errorf("text field %q not found", path)
+		}
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("text field %q is not a string (type %T)", path, value)
+		}
+		f.texts[path] = NewText(replica, s)
+	}
+	return f, nil
+}
+
+// Text returns the content of the text field at path.
+func (f *Fields) Text(path string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.texts[normalize(path)]
+	if !ok {
+		return "", false
+	}
+	return t.String(), true
+}
+
+// Held returns the number of remote edits waiting for edits they depend on.
+func (f *Fields) Held() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.held)
+}
+
+// Local records a patch made on this replica and returns the edits to send to
+// the other replicas for its str_ins and str_del operations on text fields.
+// Operations elsewhere in the document are ignored, but operations that would
+// replace or remove a text field are rejected. A patch that fails leaves the
+// fields unchanged.
+func (f *Fields) Local(patch []jsonpatch.Operation) ([]Edit, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	saved := map[string]*Text{}
+	edits, err := f.local(patch, saved)
+	if err != nil {
+		for path, t := range saved {
+			f.texts[path] = t
+		}
+		return nil, err
+	}
+	return edits, nil
+}
+
+func (f *Fields) local(patch []jsonpatch.Operation, saved map[string]*Text) ([]Edit, error) {
+	var edits []Edit
+	for _, op := range patch {
+		name, _ := op["op"].(string)
+		raw, _ := op["path"].(string)
+		path := normalize(raw)
+		t, ok := f.texts[path]
+		if !ok {
+			if err := f.checkOverwrite(op); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, ok := saved[path]; !ok {
+			saved[path] = t.clone()
+		}
+
+		switch name {
+		case "test", "less", "more", "in", "defined", "undefined", "type", "contains", "starts", "ends", "matches":
+		case "str_ins":
+			pos, posOk := number(op["pos"])
+			s, strOk := op["str"].(string)
+			if !posOk || !strOk {
+				return nil, fmt.Errorf("invalid %q op parameters (pos/str missing or wrong type) for path %q", "str_ins", raw)
+			}
+			if s == "" {
+				continue
+			}
+			ins, err := t.InsertAt(pos, s)
+			if err != nil {
+				return nil, fmt.Errorf("%w on path %q", err, raw)
+			}
+			edits = append(edits, Edit{Path: path, Insert: &ins})
+		case "str_del":
+			pos, ok := number(op["pos"])
+			if !ok {
+				return nil, fmt.Errorf("invalid %q op parameters (pos missing or wrong type) for path %q", "str_del", raw)
+			}
+			end, err := deleteEnd(t.String(), pos, op)
+			if err != nil {
+				return nil, fmt.Errorf("%w for path %q", err, raw)
+			}
+			ids, err := t.DeleteAt(pos, end)
+			if err != nil {
+				return nil, fmt.Errorf("%w on path %q", err, raw)
+			}
+			if len(ids) > 0 {
+				edits = append(edits, Edit{Path: path, Delete: ids})
+			}
+		default:
+			return nil, fmt.Errorf("op %q on path %q would overwrite a text field", name, raw)
+		}
+	}
+	return edits, nil
+}
+
+// checkOverwrite rejects an operation that replaces or removes a container
+// holding a text field, or moves a text field away.
+func (f *Fields) checkOverwrite(op jsonpatch.Operation) error {
+	name, _ := op["op"].(string)
+	switch name {
+	case "test", "less", "more", "in", "defined", "undefined", "type", "contains", "starts", "ends", "matches":
+		return nil
+	}
+	keys := []string{"path"}
+	if name == "move" {
+		keys = append(keys, "from")
+	}
+	for _, key := range keys {
+		raw, ok := op[key].(string)
+		if !ok {
+			continue
+		}
+		prefix := normalize(raw)
+		for path := range f.texts {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				return fmt.Errorf("op %q on path %q would overwrite text field %q", name, raw, path)
+			}
+		}
+	}
+	return nil
+}
+
+// Remote integrates edits from other replicas and returns the str_ins and
+// str_del operations that bring this replica's document up to date, in the
+// order they must be applied. Edits that depend on edits not received yet are
+// held until those arrive. Edits received more than once are ignored.
+func (f *Fields) Remote(edits []Edit) ([]jsonpatch.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, e := range edits {
+		if _, ok := f.texts[e.Path]; !ok {
+			return nil, fmt.Errorf("edit for unknown text field %q", e.Path)
+		}
+	}
+	f.held = append(f.held, edits...)
+
+	var ops []jsonpatch.Operation
+	for progress := true; progress; {
+		progress = false
+		held := f.held[:0]
+		for _, e := range f.held {
+			t := f.texts[e.Path]
+			if !t.Ready(e) {
+				held = append(held, e)
+				continue
+			}
+			applied, err := t.Apply(e)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, applied...)
+			progress = true
+		}
+		f.held = held
+	}
+	return ops, nil
+}
+
+// deleteEnd returns the UTF-16 offset where a str_del at pos ends, counting
+// "str" in characters and "len" in UTF-16 code units like Apply does.
+func deleteEnd(content string, pos int, op jsonpatch.Operation) (int, error) {
+	if s, ok := op["str"].(string); ok {
+		runes := []rune(content)
+		start := 0
+		offset := 0
+		for start < len(runes) && offset+utf16Units(runes[start]) <= pos {
+			offset += utf16Units(runes[start])
+			start++
+		}
+		n := len([]rune(s))
+		if start+n > len(runes) {
+			return 0, fmt.Errorf("invalid %q %d or %q %d for %q (string len %d)", "pos", start, "len", n, "str_del", len(runes))
+		}
+		for _, r := range runes[start : start+n] {
+			offset += utf16Units(r)
+		}
+		return offset, nil
+	}
+	if _, ok := op["len"]; !ok {
+		return 0, fmt.Errorf("invalid %q op parameters (str or len required)", "str_del")
+	}
+	length, ok := number(op["len"])
+	if !ok {
+		return 0, fmt.Errorf("invalid %q op parameters (len wrong type)", "str_del")
+	}
+	return pos + length, nil
+}
+
+func number(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	default:
+		return 0, false
+	}
+}
+
+// normalize returns pointer with a leading "/", which Apply does not require.
+func normalize(pointer string) string {
+	if pointer != "" && !strings.HasPrefix(pointer, "/") {
+		return "/" + pointer
+	}
+	return pointer
+}
+
+func lookup(doc any, pointer string) (any, bool) {
+	value, err := jsonpointer.Get(doc, pointer)
+	return value, err == nil
+}
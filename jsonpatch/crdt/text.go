@@ -0,0 +1,317 @@
+// Package crdt lets replicas edit designated string fields of a document
+// concurrently, without a server transforming their edits.
+//
+// Each designated field is backed by a replicated growable array (RGA): every
+// character gets a unique ID and remembers the character it was inserted
+// after, and removed characters stay behind as tombstones. Replicas that have
+// received the same edits hold the same text, in whatever order the edits
+// arrived. Fields translates str_ins and str_del operations to and from these
+// edits, so the rest of the application keeps using the usual operation
+// format.
+package crdt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// ID identifies one character of a text. Seq is a Lamport timestamp, so a
+// character's ID is greater than the ID of the character it was inserted
+// after. The characters of the initial text have an empty Replica.
+type ID struct {
+	Replica string `json:"replica"`
+	Seq     uint64 `json:"seq"`
+}
+
+// IsZero reports whether id is the zero ID, which stands for the start of the
+// text.
+func (id ID) IsZero() bool {
+	return id == ID{}
+}
+
+// Less orders IDs by Seq and then by Replica.
+func (id ID) Less(other ID) bool {
+	if id.Seq != other.Seq {
+		return id.Seq < other.Seq
+	}
+	return id.Replica < other.Replica
+}
+
+func (id ID) String() string {
+	return fmt.Sprintf("%s@%d", id.Replica, id.Seq)
+}
+
+// Insert inserts Text after the character After, or at the start of the text
+// when After is zero. The characters of Text get the IDs ID, ID+1, and so on
+// (counting in Seq).
+type Insert struct {
+	ID    ID     `json:"id"`
+	After ID     `json:"after"`
+	Text  string `json:"text"`
+}
+
+// Edit is a change to the text field at Path, made on one replica and
+// integrated by the others: an insertion, deletions, or both.
+type Edit struct {
+	Path   string  `json:"path"`
+	Insert *Insert `json:"insert,omitempty"`
+	Delete []ID    `json:"delete,omitempty"`
+}
+
+// ErrNotReady is returned when an edit refers to characters whose insertion
+// has not been received yet.
+var ErrNotReady = errors.New("edit depends on edits not received yet")
+
+// Text is one replicated string. It is not safe for concurrent use.
+type Text struct {
+	replica string
+	clock   uint64
+	// chars holds every character ever inserted in document order,
+	// including the deleted ones.
+	chars []char
+}
+
+type char struct {
+	id      ID
+	r       rune
+	deleted bool
+}
+
+// NewText returns the text with the given initial content on the replica with
+// the given ID. Every replica must start from the same initial content.
+func NewText(replica, initial string) *Text {
+	t := &Text{replica: replica}
+	for _, r := range initial {
+		t.clock++
+		t.chars = append(t.chars, char{id: ID{Seq: t.clock}, r: r})
+	}
+	return t
+}
+
+// String returns the current content.
+func (t *Text) String() string {
+	var b strings.Builder
+	for _, c := range t.chars {
+		if !c.deleted {
+			b.WriteRune(c.r)
+		}
+	}
+	return b.String()
+}
+
+// Len returns the length of the content in UTF-16 code units, the unit of
+// str_ins and str_del positions.
+func (t *Text) Len() int {
+	n := 0
+	for _, c := range t.chars {
+		if !c.deleted {
+			n += utf16Units(c.r)
+		}
+	}
+	return n
+}
+
+// InsertAt inserts s at the UTF-16 offset pos and returns the edit to send to
+// the other replicas.
+func (t *Text) InsertAt(pos int, s string) (Insert, error) {
+	if pos < 0 || pos > t.Len() {
+		return Insert{}, fmt.Errorf("invalid %q %d for %q (string len %d)", "pos", pos, "str_ins", t.Len())
+	}
+	var after ID
+	if i := t.visibleIndex(pos); i > 0 {
+		after = t.chars[i-1].id
+	}
+	ins := Insert{ID: ID{Replica: t.replica, Seq: t.clock + 1}, After: after, Text: s}
+	if s == "" {
+		return ins, nil
+	}
+	if _, err := t.integrate(ins); err != nil {
+		return Insert{}, err
+	}
+	return ins, nil
+}
+
+// DeleteAt deletes the characters between the UTF-16 offsets pos and end and
+// returns their IDs to send to the other replicas. Offsets inside a surrogate
+// pair round down, as they do for str_del.
+func (t *Text) DeleteAt(pos, end int) ([]ID, error) {
+	if pos < 0 || end < pos || pos > t.Len() {
+		return nil, fmt.Errorf("invalid %q %d or %q %d for %q (string len %d)", "pos", pos, "len", end-pos, "str_del", t.Len())
+	}
+	var ids []ID
+	offset := 0
+	for i := range t.chars {
+		c := &t.chars[i]
+		if c.deleted {
+			continue
+		}
+		offset += utf16Units(c.r)
+		if offset > pos && offset <= end {
+			c.deleted = true
+			ids = append(ids, c.id)
+		}
+	}
+	return ids, nil
+}
+
+// Apply integrates an edit from another replica and returns the equivalent
+// str_ins and str_del operations on e.Path, in the order they must be applied
+// to the content before the edit. Edits already integrated produce no
+// operations. Apply fails without changing anything when the edit refers to
+// characters that have not been received yet.
+func (t *Text) Apply(e Edit) ([]jsonpatch.Operation, error) {
+	if !t.Ready(e) {
+		return nil, fmt.Errorf("%w: edit for %q", ErrNotReady, e.Path)
+	}
+	var ops []jsonpatch.Operation
+	if e.Insert != nil && e.Insert.Text != "" {
+		pos, err := t.integrate(*e.Insert)
+		if err != nil {
+			return nil, err
+		}
+		if pos >= 0 {
+			ops = append(ops, jsonpatch.Operation{"op": "str_ins", "path": e.Path, "pos": pos, "str": e.Insert.Text})
+		}
+	}
+	return append(ops, t.delete(e.Path, e.Delete)...), nil
+}
+
+// Ready reports whether every character e refers to has been received, so
+// Apply can integrate it.
+func (t *Text) Ready(e Edit) bool {
+	if ins := e.Insert; ins != nil && !ins.After.IsZero() && t.find(ins.After) < 0 {
+		return false
+	}
+	for _, id := range e.Delete {
+		if t.find(id) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// integrate places the characters of ins and returns the UTF-16 offset of the
+// first one, or -1 if ins was integrated before.
+func (t *Text) integrate(ins Insert) (int, error) {
+	if t.find(ins.ID) >= 0 {
+		return -1, nil
+	}
+	i := 0
+	if !ins.After.IsZero() {
+		if i = t.find(ins.After); i < 0 {
+			return 0, fmt.Errorf("character %v not found", ins.After)
+		}
+		i++
+	}
+	first := -1
+	id := ins.ID
+	for _, r := range ins.Text {
+		// Characters inserted concurrently after the same one are ordered by
+		// descending ID. Everything inserted after such a character has a
+		// greater ID still, so skipping greater IDs skips whole subtrees.
+		for i < len(t.chars) && id.Less(t.chars[i].id) {
+			i++
+		}
+		t.chars = append(t.chars, char{})
+		copy(t.chars[i+1:], t.chars[i:])
+		t.chars[i] = char{id: id, r: r}
+		if first < 0 {
+			first = i
+		}
+		i++
+		id.Seq++
+	}
+	t.clock = max(t.clock, id.Seq-1)
+	return t.offset(first), nil
+}
+
+// delete marks the characters with the given IDs deleted and returns the
+// str_del operations removing them, last first so that earlier positions stay
+// valid.
+func (t *Text) delete(path string, ids []ID) []jsonpatch.Operation {
+	remove := map[ID]bool{}
+	for _, id := range ids {
+		remove[id] = true
+	}
+	type run struct{ pos, length int }
+	var runs []run
+	offset := 0
+	adjacent := false
+	for i := range t.chars {
+		c := &t.chars[i]
+		if c.deleted {
+			continue
+		}
+		units := utf16Units(c.r)
+		if remove[c.id] {
+			c.deleted = true
+			if adjacent {
+				runs[len(runs)-1].length += units
+			} else {
+				runs = append(runs, run{pos: offset, length: units})
+			}
+			adjacent = true
+		} else {
+			adjacent = false
+		}
+		offset += units
+	}
+	ops := make([]jsonpatch.Operation, 0, len(runs))
+	for i := len(runs) - 1; i >= 0; i-- {
+		ops = append(ops, jsonpatch.Operation{"op": "str_del", "path": path, "pos": runs[i].pos, "len": runs[i].length})
+	}
+	return ops
+}
+
+func (t *Text) find(id ID) int {
+	for i, c := range t.chars {
+		if c.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// visibleIndex returns the index in chars where text inserted at the UTF-16
+// offset pos goes: before the visible character containing or following pos,
+// like str_ins rounds an offset inside a surrogate pair down.
+func (t *Text) visibleIndex(pos int) int {
+	offset := 0
+	for i, c := range t.chars {
+		if c.deleted {
+			continue
+		}
+		if offset+utf16Units(c.r) > pos {
+			return i
+		}
+		offset += utf16Units(c.r)
+	}
+	return len(t.chars)
+}
+
+// offset returns the UTF-16 offset of chars[i] in the content.
+func (t *Text) offset(i int) int {
+	offset := 0
+	for _, c := range t.chars[:i] {
+		if !c.deleted {
+			offset += utf16Units(c.r)
+		}
+	}
+	return offset
+}
+
+func (t *Text) clone() *Text {
+	c := *t
+	c.chars = append([]char(nil), t.chars...)
+	return &c
+}
+
+func utf16Units(r rune) int {
+	if r > 0xFFFF {
+		return 2
+	}
+	return 1
+}
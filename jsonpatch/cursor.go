@@ -0,0 +1,93 @@
+package jsonpatch
+
+import "slices"
+
+// Cursor is a caret in the string at Path. Pos is a UTF-16 offset, like the
+// pos of str_ins and str_del.
+type Cursor struct {
+	Path string
+	Pos  int
+}
+
+// Selection is a range of the string at Path between the UTF-16 offsets
+// Anchor, where the selection started, and Head, where the caret is. Head is
+// before Anchor for a selection made backwards.
+type Selection struct {
+	Path   string
+	Anchor int
+	Head   int
+}
+
+// TransformCursor moves c through the operations of patch, in order, so that
+// it stays at the same place in the text: text inserted before the cursor or
+// at it shifts it forward, and deleting a range containing it moves it to
+// the start of the range. The cursor follows its string when patch moves it
+// or shifts the array holding it. It returns false when patch replaces or
+// removes the string.
+func TransformCursor(c Cursor, patch []Operation) (Cursor, bool, error) {
+	s, ok, err := TransformSelection(Selection{Path: c.Path, Anchor: c.Pos, Head: c.Pos}, patch)
+	return Cursor{Path: s.Path, Pos: s.Head}, ok, err
+}
+
+// TransformSelection is like TransformCursor for a selection. Text inserted
+// at the start of a selection goes before it and text inserted at its end
+// goes after it, so the selection does not grow.
+func TransformSelection(s Selection, patch []Operation) (Selection, bool, error) {
+	path, err := splitPointer(s.Path)
+	if err != nil {
+		return Selection{}, false, err
+	}
+	start, end := &s.Anchor, &s.Head
+	if s.Head < s.Anchor {
+		start, end = end, start
+	}
+	for _, op := range patch {
+		info, err := parseTransformInfo(op)
+		if err != nil {
+			return Selection{}, false, err
+		}
+		if info.isStringOp() && slices.Equal(info.path, path) {
+			pos, length, err := stringRange(op)
+			if err != nil {
+				return Selection{}, false, err
+			}
+			collapsed := *start == *end
+			if info.op == "str_ins" {
+				*start = afterStringInsert(*start, pos, length, true)
+				*end = afterStringInsert(*end, pos, length, collapsed)
+			} else {
+				*start = afterStringDelete(*start, pos, length)
+				*end = afterStringDelete(*end, pos, length)
+			}
+			continue
+		}
+		var keep bool
+		if path, keep = transformPointer(path, pointerUse{edits: true}, info, false); !keep {
+			return Selection{}, false, nil
+		}
+	}
+	s.Path = joinPointer(path)
+	return s, true, nil
+}
+
+// afterStringInsert returns offset x after length units were inserted at pos.
+// atPos decides whether an offset equal to pos moves past the insertion.
+func afterStringInsert(x, pos, length int, atPos bool) int {
+	if x > pos || (x == pos && atPos) {
+		return x + length
+	}
+	return x
+}
+
+// afterStringDelete returns offset x after length units were deleted at pos.
+// Offsets inside the deleted range collapse to its start.
+func afterStringDelete(x, pos, length int) int {
+	switch {
+	case x <= pos:
+		return x
+	case x < pos+length:
+		return pos
+	default:
+		return x - length
+	}
+}
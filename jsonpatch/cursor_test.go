@@ -0,0 +1,140 @@
+package jsonpatch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransformSelection(t *testing.T) {
+	tests := []struct {
+		name          string
+		selection     Selection
+		patch         []Operation
+		expected      Selection
+		lost          bool
+		expectedError string
+	}{
+		{
+			name:      "insert before shifts",
+			selection: Selection{Path: "/s", Anchor: 4, Head: 6},
+			patch:     []Operation{{"op": "str_ins", "path": "/s", "pos": 1, "str": "abc"}},
+			expected:  Selection{Path: "/s", Anchor: 7, Head: 9},
+		},
+		{
+			name:      "insert after is ignored",
+			selection: Selection{Path: "/s", Anchor: 4, Head: 6},
+			patch:     []Operation{{"op": "str_ins", "path": "/s", "pos": 7, "str": "abc"}},
+			expected:  Selection{Path: "/s", Anchor: 4, Head: 6},
+		},
+		{
+			name:      "insert at the edges does not grow the selection",
+			selection: Selection{Path: "/s", Anchor: 4, Head: 6},
+			patch: []Operation{
+				{"op": "str_ins", "path": "/s", "pos": 6, "str": "x"},
+				{"op": "str_ins", "path": "/s", "pos": 4, "str": "y"},
+			},
+			expected: Selection{Path: "/s", Anchor: 5, Head: 7},
+		},
+		{
+			name:      "insert inside grows the selection",
+			selection: Selection{Path: "/s", Anchor: 6, Head: 4},
+			patch:     []Operation{{"op": "str_ins", "path": "/s", "pos": 5, "str": "xy"}},
+			expected:  Selection{Path: "/s", Anchor: 8, Head: 4},
+		},
+		{
+			name:      "insert at a collapsed selection moves it",
+			selection: Selection{Path: "/s", Anchor: 4, Head: 4},
+			patch:     []Operation{{"op": "str_ins", "path": "/s", "pos": 4, "str": "xy"}},
+			expected:  Selection{Path: "/s", Anchor: 6, Head: 6},
+		},
+		{
+			name:      "offsets count UTF-16 units",
+			selection: Selection{Path: "/s", Anchor: 2, Head: 2},
+			patch:     []Operation{{"op": "str_ins", "path": "/s", "pos": float64(0), "str": "😀"}},
+			expected:  Selection{Path: "/s", Anchor: 4, Head: 4},
+		},
+		{
+			name:      "delete overlapping the start",
+			selection: Selection{Path: "/s", Anchor: 4, Head: 8},
+			patch:     []Operation{{"op": "str_del", "path": "/s", "pos": 2, "len": 4}},
+			expected:  Selection{Path: "/s", Anchor: 2, Head: 4},
+		},
+		{
+			name:      "delete by text",
+			selection: Selection{Path: "/s", Anchor: 8, Head: 8},
+			patch:     []Operation{{"op": "str_del", "path": "/s", "pos": 0, "str": "abc"}},
+			expected:  Selection{Path: "/s", Anchor: 5, Head: 5},
+		},
+		{
+			name:      "delete around the selection collapses it",
+			selection: Selection{Path: "/s", Anchor: 4, Head: 6},
+			patch:     []Operation{{"op": "str_del", "path": "/s", "pos": 3, "len": 5}},
+			expected:  Selection{Path: "/s", Anchor: 3, Head: 3},
+		},
+		{
+			name:      "edits to other strings are ignored",
+			selection: Selection{Path: "/s", Anchor: 4, Head: 6},
+			patch:     []Operation{{"op": "str_ins", "path": "/t", "pos": 0, "str": "abc"}},
+			expected:  Selection{Path: "/s", Anchor: 4, Head: 6},
+		},
+		{
+			name:      "follows array shifts and moves",
+			selection: Selection{Path: "/items/1/text", Anchor: 1, Head: 1},
+			patch: []Operation{
+				{"op": "remove", "path": "/items/0"},
+				{"op": "str_ins", "path": "/items/0/text", "pos": 0, "str": "ab"},
+				{"op": "move", "from": "/items/0", "path": "/archived"},
+			},
+			expected: Selection{Path: "/archived/text", Anchor: 3, Head: 3},
+		},
+		{
+			name:      "replaced string is lost",
+			selection: Selection{Path: "/s", Anchor: 1, Head: 1},
+			patch:     []Operation{{"op": "replace", "path": "/s", "value": "new"}},
+			lost:      true,
+		},
+		{
+			name:      "removed parent is lost",
+			selection: Selection{Path: "/items/1/text", Anchor: 1, Head: 1},
+			patch:     []Operation{{"op": "remove", "path": "/items/1"}},
+			lost:      true,
+		},
+		{
+			name:          "invalid operation",
+			selection:     Selection{Path: "/s", Anchor: 1, Head: 1},
+			patch:         []Operation{{"op": "str_ins", "path": "/s", "str": "x"}},
+			expectedError: "pos missing or wrong type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := TransformSelection(tt.selection, tt.patch)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok == tt.lost {
+				t.Fatalf("expected lost = %v, got %v", tt.lost, !ok)
+			}
+			if ok && got != tt.expected {
+				t.Fatalf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTransformCursor(t *testing.T) {
+	c, ok, err := TransformCursor(Cursor{Path: "/s", Pos: 3}, []Operation{
+		{"op": "str_ins", "path": "/s", "pos": 3, "str": "ab"},
+		{"op": "str_del", "path": "/s", "pos": 0, "len": 1},
+	})
+	if err != nil || !ok || c != (Cursor{Path: "/s", Pos: 4}) {
+		t.Fatalf("unexpected cursor %+v, %v, %v", c, ok, err)
+	}
+}
@@ -0,0 +1,95 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// DecodeOptions configures DecodePatch.
+type DecodeOptions struct {
+	// Strict rejects patches in which an object, at any depth of an
+	// operation, has the same member twice, such as two "value" fields. JSON
+	// parsers disagree on which duplicate wins, so such a patch can be
+	// applied differently by clients written in other languages.
+	Strict bool
+}
+
+// DecodePatch parses a JSON array of operations. Values are decoded like
+// json.Unmarshal does, with numbers as float64. Members that Apply does not
+// use, such as a "comment" or vendor extensions, are kept in the operations.
+// Apply leaves them untouched and Transform and Rebase carry them over to the
+// operations they return, so an annotated patch survives a round trip.
+func DecodePatch(data []byte, opts DecodeOptions) ([]Operation, error) {
+	var ops []Operation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, err
+	}
+	if opts.Strict {
+		if err := checkDuplicateMembers(data); err != nil {
+			return nil, err
+		}
+	}
+	return ops, nil
+}
+
+// checkDuplicateMembers scans a patch that is known to be valid JSON for
+// objects with repeated member names.
+func checkDuplicateMembers(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil { // [
+		return err
+	}
+	for i := 0; dec.More(); i++ {
+		duplicate, err := findDuplicate(dec, nil)
+		if err != nil {
+			return err
+		}
+		if duplicate != nil {
+			return errorf(ErrInvalidOperation, "op %d has duplicate member %q", i, joinPointer(duplicate))
+		}
+	}
+	return nil
+}
+
+// findDuplicate consumes the next value from dec and returns the path, from
+// the value, of the first member name repeated within an object, or nil.
+func findDuplicate(dec *json.Decoder, path []string) ([]string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		seen := map[string]bool{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := tok.(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected token %v", tok)
+			}
+			member := append(path[:len(path):len(path)], key)
+			if seen[key] {
+				return member, nil
+			}
+			seen[key] = true
+			if duplicate, err := findDuplicate(dec, member); duplicate != nil || err != nil {
+				return duplicate, err
+			}
+		}
+		_, err = dec.Token() // }
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			element := append(path[:len(path):len(path)], strconv.Itoa(i))
+			if duplicate, err := findDuplicate(dec, element); duplicate != nil || err != nil {
+				return duplicate, err
+			}
+		}
+		_, err = dec.Token() // ]
+	}
+	return nil, err
+}
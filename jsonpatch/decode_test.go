@@ -0,0 +1,82 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodePatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expected      []Operation
+		expectedError string
+	}{
+		{"plain patch", `[{"op":"add","path":"/a","value":{"b":[1,{"c":2}]}}]`, []Operation{{"op": "add", "path": "/a", "value": map[string]any{"b": []any{float64(1), map[string]any{"c": float64(2)}}}}}, ""},
+		{"duplicate value", `[{"op":"test","path":"/a","value":1},{"op":"replace","path":"/a","value":1,"value":2}]`, nil, "op 1 has duplicate member \"/value\""},
+		{"nested duplicate", `[{"op":"add","path":"/a","value":[{"k":1,"k":2}]}]`, nil, "op 0 has duplicate member \"/value/0/k\""},
+		{"same key in sibling objects", `[{"op":"add","path":"/a","value":{"x":{"k":1},"y":{"k":1}}}]`, []Operation{{"op": "add", "path": "/a", "value": map[string]any{"x": map[string]any{"k": float64(1)}, "y": map[string]any{"k": float64(1)}}}}, ""},
+		{"malformed", `[{"op":"add"`, nil, "unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := DecodePatch([]byte(tt.input), DecodeOptions{Strict: true})
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodePatch returned error: %v", err)
+			}
+			if !reflect.DeepEqual(ops, tt.expected) {
+				t.Fatalf("Patches not equal.\nGot:      %v\nExpected: %v", ops, tt.expected)
+			}
+		})
+	}
+
+	// Without Strict the last duplicate wins, as with json.Unmarshal.
+	input := []byte(`[{"op":"replace","path":"/a","value":1,"value":2}]`)
+	ops, err := DecodePatch(input, DecodeOptions{})
+	if err != nil || ops[0]["value"] != float64(2) {
+		t.Fatalf("expected the last value to win, got %v (%v)", ops, err)
+	}
+	if _, err := DecodePatch(input, DecodeOptions{Strict: true}); !errors.Is(err, ErrInvalidOperation) {
+		t.Fatalf("expected ErrInvalidOperation, got %v", err)
+	}
+}
+
+func TestUnknownMembersRoundTrip(t *testing.T) {
+	input := `[{"op":"str_ins","path":"/s","pos":1,"str":"x","comment":"fix typo","x-vendor":{"trace":[1,2]}}]`
+	ops, err := DecodePatch([]byte(input), DecodeOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("DecodePatch returned error: %v", err)
+	}
+	if _, err := ApplyValue(map[string]any{"s": "ab"}, ops); err != nil {
+		t.Fatalf("ApplyValue returned error: %v", err)
+	}
+	rebased, err := Rebase(ops, []Operation{{"op": "str_ins", "path": "/s", "pos": 0, "str": "!"}})
+	if err != nil {
+		t.Fatalf("Rebase returned error: %v", err)
+	}
+	if rebased[0]["pos"] != float64(2) {
+		t.Fatalf("expected the rebased op to move, got %v", rebased[0])
+	}
+	rebased[0]["pos"] = float64(1)
+	for _, patch := range [][]Operation{ops, rebased} {
+		encoded, err := json.Marshal(patch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, expected any
+		json.Unmarshal(encoded, &got)
+		json.Unmarshal([]byte(input), &expected)
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("members were lost.\nGot:      %s\nExpected: %s", encoded, input)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// maxDiffCells bounds the table used to align the elements of two arrays.
+// Arrays whose changed middles are larger are compared index by index.
+const maxDiffCells = 1 << 22
+
+// Diff returns a patch that turns before into after. Objects are compared
+// member by member. Arrays are aligned with the fewest element removals,
+// additions and in-place changes, so an element inserted or removed in the
+// middle of an array costs one operation rather than a replace of
+// everything after it, and elements changed in place are diffed
+// recursively. Other values that
+// differ are replaced. Leaves are compared like test compares them, and
+// the values in the patch are copies that share nothing with after.
+//
+// Values must be JSON values as decoded by encoding/json, or json.Marshaler
+// leaves; anything else is an error wrapping ErrTypeMismatch.
+func Diff(before, after map[string]any) ([]map[string]any, error) {
+	return DiffWithOptions(before, after, DiffOptions{})
+}
+
+// DiffOptions tunes the patches DiffWithOptions returns. The zero value
+// diffs like Diff.
+type DiffOptions struct {
+	// Strings describes a changed string with a str_del of the text between
+	// the prefix and suffix the old and new strings share and a str_ins of
+	// the new text there, instead of replacing it. Offsets are UTF-16 code
+	// units and never split a character.
+	Strings bool
+	// ArrayKey, when set, matches the elements of arrays of objects that
+	// all have a distinct string or number under this member by that
+	// member, so that reordered elements are moved, elements missing from
+	// after are removed and new ones added, and matched elements are diffed
+	// recursively.
+	ArrayKey string
+}
+
+// DiffWithOptions is Diff with options.
+func DiffWithOptions(before, after map[string]any, opts DiffOptions) ([]map[string]any, error) {
+	return opts.diffValue("", before, after, []map[string]any{})
+}
+
+// DiffValue is like Diff but takes documents whose root is any JSON value,
+// as ApplyValue does. Roots of different types are replaced.
+func DiffValue(before, after any) ([]map[string]any, error) {
+	return DiffValueWithOptions(before, after, DiffOptions{})
+}
+
+// DiffValueWithOptions is DiffValue with options.
+func DiffValueWithOptions(before, after any, opts DiffOptions) ([]map[string]any, error) {
+	return opts.diffValue("", before, after, []map[string]any{})
+}
+
+// diffValue appends to ops the operations that turn before into after at
+// pathRaw.
+func (o DiffOptions) diffValue(pathRaw string, before, after any, ops []map[string]any) ([]map[string]any, error) {
+	for _, v := range []any{before, after} {
+		if !isDiffable(v) {
+			return nil, errorf(ErrTypeMismatch, "cannot diff value of type %T at path %q", v, pathRaw)
+		}
+	}
+	switch b := before.(type) {
+	case map[string]any:
+		if a, ok := after.(map[string]any); ok {
+			return o.diffObject(pathRaw, b, a, ops)
+		}
+	case []any:
+		if a, ok := after.([]any); ok {
+			if o.ArrayKey != "" && o.keyed(b) && o.keyed(a) {
+				return o.diffKeyedArray(pathRaw, b, a, ops)
+			}
+			return o.diffArray(pathRaw, b, a, ops)
+		}
+	case string:
+		if a, ok := after.(string); ok && o.Strings && pathRaw != "" {
+			return diffString(pathRaw, b, a, ops), nil
+		}
+	}
+	if jsonEqual(before, after) {
+		return ops, nil
+	}
+	if err := checkDiffable(pathRaw, after); err != nil {
+		return nil, err
+	}
+	return append(ops, map[string]any{"op": "replace", "path": pathRaw, "value": deepCopyValue(after)}), nil
+}
+
+func (o DiffOptions) diffObject(pathRaw string, before, after map[string]any, ops []map[string]any) ([]map[string]any, error) {
+	keys := make([]string, 0, len(before)+len(after))
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var err error
+	for _, k := range keys {
+		child := pathRaw + "/" + pointerEscaper.Replace(k)
+		b, inBefore := before[k]
+		a, inAfter := after[k]
+		switch {
+		case !inAfter:
+			ops = append(ops, map[string]any{"op": "remove", "path": child})
+		case !inBefore:
+			if err := checkDiffable(child, a); err != nil {
+				return nil, err
+			}
+			ops = append(ops, map[string]any{"op": "add", "path": child, "value": deepCopyValue(a)})
+		default:
+			if ops, err = o.diffValue(child, b, a, ops); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ops, nil
+}
+
+func (o DiffOptions) diffArray(pathRaw string, before, after []any, ops []map[string]any) ([]map[string]any, error) {
+	// Equal elements at both ends need no alignment.
+	start := 0
+	for start < len(before) && start < len(after) && jsonEqual(before[start], after[start]) {
+		start++
+	}
+	endB, endA := len(before), len(after)
+	for endB > start && endA > start && jsonEqual(before[endB-1], after[endA-1]) {
+		endB--
+		endA--
+	}
+	b, a := before[start:endB], after[start:endA]
+	n, m := len(b), len(a)
+
+	element := func(pos int) string { return pathRaw + "/" + strconv.Itoa(pos) }
+	var err error
+	if n*m > maxDiffCells {
+		for i := range min(n, m) {
+			if ops, err = o.diffValue(element(start+i), b[i], a[i], ops); err != nil {
+				return nil, err
+			}
+		}
+		for i := n - 1; i >= m; i-- {
+			ops = append(ops, map[string]any{"op": "remove", "path": element(start + i)})
+		}
+		for i := n; i < m; i++ {
+			if err := checkDiffable(element(start+i), a[i]); err != nil {
+				return nil, err
+			}
+			ops = append(ops, map[string]any{"op": "add", "path": element(start + i), "value": deepCopyValue(a[i])})
+		}
+		return ops, nil
+	}
+
+	// dist[i][j] is the number of removals, additions and in-place changes
+	// that turn b[i:] into a[j:].
+	dist := make([][]int, n+1)
+	for i := range dist {
+		dist[i] = make([]int, m+1)
+		dist[i][m] = n - i
+	}
+	for j := range m + 1 {
+		dist[n][j] = m - j
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if jsonEqual(b[i], a[j]) {
+				dist[i][j] = dist[i+1][j+1]
+			} else {
+				dist[i][j] = 1 + min(dist[i+1][j+1], dist[i+1][j], dist[i][j+1])
+			}
+		}
+	}
+
+	// pos is the index in the array as patched so far.
+	i, j, pos := 0, 0, start
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && jsonEqual(b[i], a[j]):
+			i, j, pos = i+1, j+1, pos+1
+		case i < n && j < m && dist[i][j] == dist[i+1][j+1]+1:
+			// One element becomes the other in place.
+			if ops, err = o.diffValue(element(pos), b[i], a[j], ops); err != nil {
+				return nil, err
+			}
+			i, j, pos = i+1, j+1, pos+1
+		case i < n && (j == m || dist[i][j] == dist[i+1][j]+1):
+			ops = append(ops, map[string]any{"op": "remove", "path": element(pos)})
+			i++
+		default:
+			if err := checkDiffable(element(pos), a[j]); err != nil {
+				return nil, err
+			}
+			ops = append(ops, map[string]any{"op": "add", "path": element(pos), "value": deepCopyValue(a[j])})
+			j, pos = j+1, pos+1
+		}
+	}
+	return ops, nil
+}
+
+// keyed reports whether every element of arr is an object with a distinct
+// string or number under o.ArrayKey.
+func (o DiffOptions) keyed(arr []any) bool {
+	seen := make(map[any]bool, len(arr))
+	for _, elem := range arr {
+		key, ok := o.elementKey(elem)
+		if !ok || seen[key] {
+			return false
+		}
+		seen[key] = true
+	}
+	return true
+}
+
+// elementKey returns the member of elem under o.ArrayKey, with numbers of
+// any type as float64 so that equal ones match.
+func (o DiffOptions) elementKey(elem any) (any, bool) {
+	obj, ok := elem.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	switch key := obj[o.ArrayKey].(type) {
+	case string:
+		return key, true
+	default:
+		return getNumericValue(key)
+	}
+}
+
+// diffKeyedArray matches the elements of before and after, which are
+// keyed, by key: elements missing from after are removed, the rest are
+// moved into place, new ones are added, and matched elements are diffed
+// recursively.
+func (o DiffOptions) diffKeyedArray(pathRaw string, before, after []any, ops []map[string]any) ([]map[string]any, error) {
+	element := func(pos int) string { return pathRaw + "/" + strconv.Itoa(pos) }
+	wanted := make(map[any]bool, len(after))
+	for _, elem := range after {
+		key, _ := o.elementKey(elem)
+		wanted[key] = true
+	}
+	// current mirrors the array as patched so far.
+	current := make([]any, 0, len(before))
+	for i := len(before) - 1; i >= 0; i-- {
+		if key, _ := o.elementKey(before[i]); !wanted[key] {
+			ops = append(ops, map[string]any{"op": "remove", "path": element(i)})
+		}
+	}
+	for _, elem := range before {
+		if key, _ := o.elementKey(elem); wanted[key] {
+			current = append(current, elem)
+		}
+	}
+	var err error
+	for i, elem := range after {
+		key, _ := o.elementKey(elem)
+		index := slices.IndexFunc(current, func(v any) bool {
+			k, _ := o.elementKey(v)
+			return k == key
+		})
+		if index < 0 {
+			if err := checkDiffable(element(i), elem); err != nil {
+				return nil, err
+			}
+			ops = append(ops, map[string]any{"op": "add", "path": element(i), "value": deepCopyValue(elem)})
+			current = slices.Insert(current, i, elem)
+			continue
+		}
+		if index != i {
+			ops = append(ops, map[string]any{"op": "move", "from": element(index), "path": element(i)})
+			moved := current[index]
+			current = slices.Insert(slices.Delete(current, index, index+1), i, moved)
+		}
+		if ops, err = o.diffValue(element(i), current[i], elem, ops); err != nil {
+			return nil, err
+		}
+	}
+	return ops, nil
+}
+
+// diffString appends a str_del and a str_ins turning before into after,
+// the strings at pathRaw.
+func diffString(pathRaw, before, after string, ops []map[string]any) []map[string]any {
+	if before == after {
+		return ops
+	}
+	b, a := []rune(before), []rune(after)
+	prefix := 0
+	for prefix < len(b) && prefix < len(a) && b[prefix] == a[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(b)-prefix && suffix < len(a)-prefix && b[len(b)-1-suffix] == a[len(a)-1-suffix] {
+		suffix++
+	}
+	pos := utf16Length(string(b[:prefix]))
+	if deleted := b[prefix : len(b)-suffix]; len(deleted) > 0 {
+		ops = append(ops, map[string]any{"op": "str_del", "path": pathRaw, "pos": pos, "len": utf16Length(string(deleted))})
+	}
+	if inserted := a[prefix : len(a)-suffix]; len(inserted) > 0 {
+		ops = append(ops, map[string]any{"op": "str_ins", "path": pathRaw, "pos": pos, "str": string(inserted)})
+	}
+	return ops
+}
+
+// isDiffable reports whether v, not counting what it contains, is a value
+// Diff can compare.
+func isDiffable(v any) bool {
+	switch v.(type) {
+	case nil, bool, string, json.Marshaler, map[string]any, []any:
+		return true
+	}
+	return isNumber(v)
+}
+
+// checkDiffable checks every value inside v, which is about to be copied
+// into a patch.
+func checkDiffable(pathRaw string, v any) error {
+	if !isDiffable(v) {
+		return errorf(ErrTypeMismatch, "cannot diff value of type %T at path %q", v, pathRaw)
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if err := checkDiffable(pathRaw+"/"+pointerEscaper.Replace(k), child); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for i, child := range v {
+			if err := checkDiffable(pathRaw+"/"+strconv.Itoa(i), child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		expected      []map[string]any
+	}{
+		{"equal", `{"a": [1, {"b": 2}]}`, `{"a": [1, {"b": 2}]}`, []map[string]any{}},
+		{
+			"members",
+			`{"a": 1, "b": {"c": "x", "d": true}, "e/f": null}`,
+			`{"a": 2, "b": {"c": "x"}, "g": [1]}`,
+			[]map[string]any{
+				{"op": "replace", "path": "/a", "value": float64(2)},
+				{"op": "remove", "path": "/b/d"},
+				{"op": "remove", "path": "/e~1f"},
+				{"op": "add", "path": "/g", "value": []any{float64(1)}},
+			},
+		},
+		{
+			"insert in the middle",
+			`{"a": [1, 2, 3, 4, 5]}`,
+			`{"a": [1, 2, 9, 3, 4, 5]}`,
+			[]map[string]any{{"op": "add", "path": "/a/2", "value": float64(9)}},
+		},
+		{
+			"remove in the middle",
+			`{"a": [1, 2, 3, 4, 5]}`,
+			`{"a": [1, 3, 4, 5]}`,
+			[]map[string]any{{"op": "remove", "path": "/a/1"}},
+		},
+		{
+			"element changed in place",
+			`{"a": [{"id": 1, "n": "x"}, {"id": 2, "n": "y"}]}`,
+			`{"a": [{"id": 1, "n": "x"}, {"id": 2, "n": "z"}]}`,
+			[]map[string]any{{"op": "replace", "path": "/a/1/n", "value": "z"}},
+		},
+		{
+			"mixed edits",
+			`{"a": ["a", "b", "c", "d"]}`,
+			`{"a": ["b", "x", "d", "e"]}`,
+			[]map[string]any{
+				{"op": "remove", "path": "/a/0"},
+				{"op": "replace", "path": "/a/1", "value": "x"},
+				{"op": "add", "path": "/a/3", "value": "e"},
+			},
+		},
+		{"type change", `{"a": [1]}`, `{"a": {"0": 1}}`, []map[string]any{{"op": "replace", "path": "/a", "value": map[string]any{"0": float64(1)}}}},
+		{"numbers by value", `{"a": 1}`, `{"a": 1.0}`, []map[string]any{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after map[string]any
+			if err := json.Unmarshal([]byte(tt.before), &before); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.after), &after); err != nil {
+				t.Fatal(err)
+			}
+			patch, err := Diff(before, after)
+			if err != nil {
+				t.Fatalf("Diff returned error: %v", err)
+			}
+			if !reflect.DeepEqual(patch, tt.expected) {
+				t.Fatalf("Patches not equal.\nGot: %v\nExpected: %v", patch, tt.expected)
+			}
+			if err := Apply(before, patch); err != nil {
+				t.Fatalf("Apply returned error: %v", err)
+			}
+			if !jsonEqual(before, after) {
+				t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", before, after)
+			}
+		})
+	}
+}
+
+func TestDiffRandomArrays(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomArray := func() []any {
+		a := make([]any, rng.Intn(12))
+		for i := range a {
+			a[i] = float64(rng.Intn(5))
+		}
+		return a
+	}
+	for i := range 500 {
+		before := map[string]any{"a": randomArray()}
+		after := map[string]any{"a": randomArray()}
+		patch, err := Diff(before, after)
+		if err != nil {
+			t.Fatalf("case %d: Diff returned error: %v", i, err)
+		}
+		if len(patch) > max(len(before["a"].([]any)), len(after["a"].([]any))) {
+			t.Fatalf("case %d: patch of %d ops for arrays %v and %v", i, len(patch), before["a"], after["a"])
+		}
+		if err := Apply(before, patch); err != nil || !reflect.DeepEqual(before, after) {
+			t.Fatalf("case %d: patch %v gives %v (%v), expected %v", i, patch, before, err, after)
+		}
+	}
+}
+
+func TestDiffCopiesValues(t *testing.T) {
+	after := map[string]any{"a": map[string]any{"b": []any{"c"}}}
+	patch, err := Diff(map[string]any{}, after)
+	if err != nil {
+		t.Fatalf("Diff returned error: %v", err)
+	}
+	after["a"].(map[string]any)["b"].([]any)[0] = "changed"
+	if patch[0]["value"].(map[string]any)["b"].([]any)[0] != "c" {
+		t.Fatal("patch shares values with after")
+	}
+}
+
+func TestDiffUnsupportedValue(t *testing.T) {
+	_, err := Diff(map[string]any{}, map[string]any{"a": []any{struct{}{}}})
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch, got %v", err)
+	}
+}
+
+func TestDiffWithOptions(t *testing.T) {
+	var before, after map[string]any
+	json.Unmarshal([]byte(`{"text": "Hello 🌍 world", "items": [{"id": 1, "v": "a"}, {"id": 2, "v": "b"}, {"id": 3, "v": "c"}]}`), &before)
+	json.Unmarshal([]byte(`{"text": "Hello 🌎 big world", "items": [{"id": 3, "v": "c"}, {"id": 4, "v": "d"}, {"id": 1, "v": "A"}]}`), &after)
+	ops, err := DiffWithOptions(before, after, DiffOptions{Strings: true, ArrayKey: "id"})
+	if err != nil {
+		t.Fatalf("DiffWithOptions returned error: %v", err)
+	}
+	expected := []map[string]any{
+		{"op": "remove", "path": "/items/1"},
+		{"op": "move", "from": "/items/1", "path": "/items/0"},
+		{"op": "add", "path": "/items/1", "value": map[string]any{"id": float64(4), "v": "d"}},
+		{"op": "str_del", "path": "/items/2/v", "pos": 0, "len": 1},
+		{"op": "str_ins", "path": "/items/2/v", "pos": 0, "str": "A"},
+		{"op": "str_del", "path": "/text", "pos": 6, "len": 2},
+		{"op": "str_ins", "path": "/text", "pos": 6, "str": "🌎 big"},
+	}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Fatalf("Operations not equal.\nGot: %v\nExpected: %v", ops, expected)
+	}
+	if err := Apply(before, ops); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("Documents not equal.\nGot: %v\nExpected: %v", before, after)
+	}
+}
+
+func TestDiffValue(t *testing.T) {
+	before, after := []any{"a", "b"}, []any{"b"}
+	ops, err := DiffValue(before, after)
+	if err != nil {
+		t.Fatalf("DiffValue returned error: %v", err)
+	}
+	expected := []map[string]any{{"op": "remove", "path": "/0"}}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Errorf("Operations not equal.\nGot: %v\nExpected: %v", ops, expected)
+	}
+}
@@ -0,0 +1,231 @@
+package jsonpatch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flitsinc/go-jsonpatch/internal/casegen"
+)
+
+// referenceEnv names the environment variable pointing at fuzz/reference.mjs.
+// Differential fuzzing is skipped unless it is set, because it needs Node.js
+// and the npm dependencies installed in the fuzz directory.
+const referenceEnv = "JSONPATCH_REFERENCE"
+
+type referenceResult struct {
+	TestID    string `json:"testId"`
+	Success   bool   `json:"success"`
+	ResultDoc any    `json:"resultDoc"`
+	Error     string `json:"error"`
+}
+
+// referenceProcess is a long-running node process applying patches with json-joy.
+type referenceProcess struct {
+	mu     sync.Mutex
+	stdin  io.WriteCloser
+	stdout *bufio.Scanner
+	next   int
+}
+
+var (
+	referenceOnce sync.Once
+	reference     *referenceProcess
+	referenceErr  error
+)
+
+func startReference(script string) (*referenceProcess, error) {
+	cmd := exec.Command("node", script)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &referenceProcess{stdin: stdin, stdout: scanner}, nil
+}
+
+func (p *referenceProcess) apply(doc any, ops []map[string]any) (referenceResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.next++
+	testID := strconv.Itoa(p.next)
+	line, err := json.Marshal(map[string]any{"testId": testID, "originalDoc": doc, "operations": ops})
+	if err != nil {
+		return referenceResult{}, err
+	}
+	if _, err := p.stdin.Write(append(line, '\n')); err != nil {
+		return referenceResult{}, err
+	}
+	if !p.stdout.Scan() {
+		return referenceResult{}, fmt.Errorf("reference process exited: %v", p.stdout.Err())
+	}
+	var result referenceResult
+	if err := json.Unmarshal(p.stdout.Bytes(), &result); err != nil {
+		return referenceResult{}, err
+	}
+	if result.TestID != testID {
+		return referenceResult{}, fmt.Errorf("reference answered %q, expected %q", result.TestID, testID)
+	}
+	return result, nil
+}
+
+// canonicalJSON re-encodes v so that numeric types and key order do not matter.
+func canonicalJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<unencodable %T: %v>", v, err)
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return string(data)
+	}
+	data, _ = json.Marshal(decoded)
+	return string(data)
+}
+
+// failureKind is the kind of failure a patch ran into, in terms both this
+// package and json-joy can report.
+type failureKind int
+
+const (
+	failNone failureKind = iota
+	failPathNotFound
+	failOutOfBounds
+	failTest
+	failInvalidOp
+	failTypeMismatch
+	failOther
+)
+
+func (k failureKind) String() string {
+	switch k {
+	case failNone:
+		return "none"
+	case failPathNotFound:
+		return "path-not-found"
+	case failOutOfBounds:
+		return "out-of-bounds"
+	case failTest:
+		return "test-failed"
+	case failInvalidOp:
+		return "invalid-op"
+	case failTypeMismatch:
+		return "type-mismatch"
+	}
+	return "other"
+}
+
+// goFailureKind classifies an error returned by ApplyValue.
+func goFailureKind(err error) failureKind {
+	switch {
+	case err == nil:
+		return failNone
+	case errors.Is(err, ErrPathNotFound):
+		return failPathNotFound
+	case errors.Is(err, ErrOutOfBounds):
+		return failOutOfBounds
+	case errors.Is(err, ErrTestFailed):
+		return failTest
+	case errors.Is(err, ErrInvalidOperation), errors.Is(err, ErrUnsupportedOp), errors.Is(err, ErrInvalidPointer):
+		return failInvalidOp
+	case errors.Is(err, ErrTypeMismatch):
+		return failTypeMismatch
+	}
+	return failOther
+}
+
+// referenceFailureKind classifies a json-joy result by its error code.
+func referenceFailureKind(result referenceResult) failureKind {
+	switch {
+	case result.Success:
+		return failNone
+	case result.Error == "NOT_FOUND":
+		return failPathNotFound
+	case result.Error == "INVALID_INDEX":
+		return failOutOfBounds
+	case result.Error == "TEST":
+		return failTest
+	case result.Error == "NOT_A_STRING":
+		return failTypeMismatch
+	case strings.HasPrefix(result.Error, "OP_"):
+		return failInvalidOp
+	}
+	return failOther
+}
+
+// sameFailureKind reports whether kinds reported by this package and by
+// json-joy agree. Unclassified errors never agree, so that new json-joy
+// codes get mapped. json-joy has no out-of-bounds or type-mismatch error for
+// values it cannot find: a missing array element, or a path through a
+// scalar, is NOT_FOUND.
+func sameFailureKind(got, want failureKind) bool {
+	if got == want {
+		return got != failOther
+	}
+	return want == failPathNotFound && (got == failOutOfBounds || got == failTypeMismatch)
+}
+
+// FuzzDifferential generates (doc, patch) pairs and fails whenever this
+// package and json-joy disagree on whether the patch applies, on the kind of
+// error when it does not, or on the resulting document. Only integer numbers are generated because inc
+// intentionally stores integer results.
+//
+//	JSONPATCH_REFERENCE=$PWD/fuzz/reference.mjs go test -fuzz FuzzDifferential
+func FuzzDifferential(f *testing.F) {
+	script := os.Getenv(referenceEnv)
+	if script == "" {
+		f.Skipf("set %s to fuzz/reference.mjs to enable differential fuzzing", referenceEnv)
+	}
+	referenceOnce.Do(func() {
+		reference, referenceErr = startReference(script)
+	})
+	if referenceErr != nil {
+		f.Fatalf("start reference: %v", referenceErr)
+	}
+
+	f.Add([]byte("seed"))
+	f.Add([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+	f.Add([]byte("\xff\x10\x80\x07str_ins\x03\x02\x01"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		src := casegen.NewByteSource(data)
+		doc := casegen.DefaultConfig.Document(src)
+		ops := casegen.DefaultConfig.Patch(src, doc)
+
+		want, err := reference.apply(doc, ops)
+		if err != nil {
+			t.Fatalf("reference: %v", err)
+		}
+		got, applyErr := ApplyValue(cloneValue(doc), ops)
+
+		if gotKind, wantKind := goFailureKind(applyErr), referenceFailureKind(want); !sameFailureKind(gotKind, wantKind) {
+			t.Fatalf("error kind differs: go %v, js %v\ndoc: %s\nops: %s\ngo error: %v\njs error: %s",
+				gotKind, wantKind, canonicalJSON(doc), canonicalJSON(ops), applyErr, want.Error)
+		}
+		if applyErr != nil {
+			return
+		}
+		if canonicalJSON(got) != canonicalJSON(want.ResultDoc) {
+			t.Fatalf("results differ\ndoc: %s\nops: %s\ngo: %s\njs: %s",
+				canonicalJSON(doc), canonicalJSON(ops), canonicalJSON(got), canonicalJSON(want.ResultDoc))
+		}
+	})
+}
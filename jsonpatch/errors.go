@@ -0,0 +1,265 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/jsonpointer"
+)
+
+// Errors returned by Apply and its variants wrap one of these, so that
+// callers can tell failures apart with errors.Is. The pointer errors are
+// those of the jsonpointer package.
+var (
+	// ErrPathNotFound is returned when a path refers to a member or a
+	// document that does not exist.
+	ErrPathNotFound = jsonpointer.ErrNotFound
+	// ErrTestFailed is returned when a test operation does not match.
+	ErrTestFailed = errors.New("test operation failed")
+	// ErrOutOfBounds is returned for array indices and string positions
+	// outside the value they refer to.
+	ErrOutOfBounds = jsonpointer.ErrOutOfBounds
+	// ErrInvalidPointer is returned for malformed JSON Pointers, including
+	// array segments that are not indices.
+	ErrInvalidPointer = jsonpointer.ErrInvalid
+	// ErrUnsupportedOp is returned for unknown operations and for
+	// operations the target does not support.
+	ErrUnsupportedOp = errors.New("unsupported operation")
+	// ErrInvalidOperation is returned for operations with missing or
+	// malformed members.
+	ErrInvalidOperation = errors.New("invalid operation")
+	// ErrTypeMismatch is returned when a path traverses or targets a value
+	// of the wrong type, such as str_ins on a number.
+	ErrTypeMismatch = jsonpointer.ErrTypeMismatch
+	// ErrStringTooLong is returned when a str_ins would exceed the limit set
+	// by Options.MaxStringLength or Options.MaxStringLengths.
+	ErrStringTooLong = errors.New("string too long")
+	// ErrLimitExceeded is returned when a patch exceeds one of the limits
+	// set by Options.MaxOps, MaxPathDepth, MaxInsertLength or
+	// MaxArrayLength.
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// ErrOpRejected is returned when Options.BeforeOp rejects an operation.
+	ErrOpRejected = errors.New("operation rejected")
+	// ErrValueRejected is returned when Options.Sanitize rejects a value.
+	ErrValueRejected = errors.New("value rejected")
+	// ErrInvalidDocument is returned when Options.ValidateDocument rejects
+	// the document a patch produces.
+	ErrInvalidDocument = errors.New("invalid document")
+	// ErrNotMergeable is returned when a patch makes a change a merge patch
+	// cannot express, such as setting a member to null.
+	ErrNotMergeable = errors.New("not expressible as a merge patch")
+	// ErrNotTransformable is returned when the way two concurrent
+	// operations combine depends on the document they apply to, which
+	// TransformOp and its variants do not see.
+	ErrNotTransformable = errors.New("operations cannot be transformed")
+)
+
+// patchError is an error wrapping one of the sentinel errors above. Its
+// message is that of err alone, so the sentinel does not show up in it.
+type patchError struct {
+	kind error
+	err  error
+}
+
+func (e *patchError) Error() string   { return e.err.Error() }
+func (e *patchError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// errorf formats an error like fmt.Errorf and wraps kind in it.
+func errorf(kind error, format string, args ...any) error {
+	return &patchError{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// OpError is the error returned when an operation of a patch fails. It
+// wraps the error describing the failure, and its message names the
+// operation by index along with a rendering of it in which values and
+// inserted strings are redacted, so that it can be logged safely.
+type OpError struct {
+	// Index is the zero-based position of the operation in the patch.
+	Index int
+	// ID is the operation's "id" member, or nil. Apply ignores the member,
+	// so clients can use it to correlate failures with their own edits.
+	ID any
+	// Op is the operation as it was passed in.
+	Op Operation
+	// Path is the operation's "path" member, or "" if it has none.
+	Path string
+	// Kind is the sentinel error Err wraps, such as ErrPathNotFound or
+	// ErrTestFailed, or nil if it wraps none, so that callers can switch on
+	// the kind of failure.
+	Kind error
+	Err  error
+}
+
+// ValidationError is a problem with a malformed operation, found without a
+// document by Validate, Compile or Patch.UnmarshalJSON. It wraps
+// ErrInvalidOperation.
+type ValidationError struct {
+	// Index is the zero-based position of the operation in the patch.
+	Index int
+	// Op is the operation's "op" member, or "" if it is not a string.
+	Op string
+	// Member is the member at fault, such as "path", "op" for an unknown
+	// type, or "" when the operation is not an object.
+	Member string
+	// Err describes the problem.
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	switch e.Member {
+	case "":
+		return fmt.Sprintf("op %d is %v", e.Index, e.Err)
+	case "op":
+		return fmt.Sprintf("op %d has %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("op %d (%q): %v", e.Index, e.Op, e.Err)
+}
+
+func (e *ValidationError) Unwrap() []error { return []error{ErrInvalidOperation, e.Err} }
+
+// PartialError is the error returned by a patch applied with
+// Options.ContinueOnError when some of its operations failed. It wraps
+// every OpError, so errors.Is finds the sentinels of all the failures.
+type PartialError struct {
+	// Errors are the failures, in the order of the operations.
+	Errors []*OpError
+	// Applied are the indices of the operations that succeeded, in order.
+	Applied []int
+	// Total is the number of operations in the patch.
+	Total int
+}
+
+func (e *PartialError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d operations failed", len(e.Errors), e.Total)
+	for _, err := range e.Errors {
+		b.WriteString("\n")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+func (e *PartialError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// newOpError returns the OpError for err, the failure of op, the operation
+// at index i.
+func newOpError(i int, op Operation, err error) *OpError {
+	path, _ := op["path"].(string)
+	return &OpError{Index: i, ID: op["id"], Op: op, Path: path, Kind: errorKind(err), Err: err}
+}
+
+// errorKinds are the sentinels errorKind looks for, the more specific
+// first.
+var errorKinds = []error{
+	ErrTestFailed,
+	ErrPathNotFound,
+	ErrOutOfBounds,
+	ErrInvalidPointer,
+	ErrInvalidOperation,
+	ErrUnsupportedOp,
+	ErrTypeMismatch,
+	ErrStringTooLong,
+	ErrLimitExceeded,
+	ErrOpRejected,
+	ErrValueRejected,
+	ErrNotMergeable,
+	ErrNotTransformable,
+}
+
+// errorKind returns the sentinel err wraps, or nil.
+func errorKind(err error) error {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("op %d %s: %v", e.Index, redact(e.Op), e.Err)
+}
+
+func (e *OpError) Unwrap() error { return e.Err }
+
+// redact renders op with op, path, from and a string or numeric id
+// verbatim, the numeric pos, len and inc as they are, and other members
+// reduced to their type and size.
+func redact(op Operation) string {
+	keys := make([]string, 0, len(op))
+	for k := range op {
+		keys = append(keys, k)
+	}
+	rank := func(k string) int {
+		switch k {
+		case "op":
+			return 0
+		case "path":
+			return 1
+		case "from":
+			return 2
+		case "id":
+			return 3
+		}
+		return 4
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if ri, rj := rank(keys[i]), rank(keys[j]); ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(strconv.Quote(k))
+		b.WriteString(": ")
+		v := op[k]
+		s, isString := v.(string)
+		n, isNumber := getNumericValue(v)
+		switch {
+		case isString && rank(k) < 4:
+			b.WriteString(strconv.Quote(s))
+		case isNumber && (k == "id" || k == "pos" || k == "len" || k == "inc"):
+			b.WriteString(strconv.FormatFloat(n, 'g', -1, 64))
+		default:
+			b.WriteString(redactValue(v))
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func redactValue(v any) string {
+	if _, ok := getNumericValue(v); ok {
+		return "<number>"
+	}
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "<bool>"
+	case string:
+		return fmt.Sprintf("<string, %d chars>", utf8.RuneCountInString(v))
+	case map[string]any:
+		return fmt.Sprintf("<object, %d keys>", len(v))
+	case []any:
+		return fmt.Sprintf("<array, %d items>", len(v))
+	default:
+		return fmt.Sprintf("<%T>", v)
+	}
+}
@@ -0,0 +1,44 @@
+package jsonpatch
+
+// extend shallow-merges the "props" object of an extend op into target, the
+// object at pathRaw. A null prop is stored as null, or deletes the member
+// when the op's "deleteNull" member is true. Every value is sanitized before
+// any is written, so a rejected value leaves target as it was.
+func (a *applier) extend(target map[string]any, pathRaw string, op map[string]any) error {
+	props, deleteNull, err := extendMembers(pathRaw, op)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]any, len(props))
+	for k, v := range props {
+		if v == nil && deleteNull {
+			continue
+		}
+		if values[k], err = a.sanitize(pathRaw+"/"+pointerEscaper.Replace(k), v); err != nil {
+			return err
+		}
+	}
+	for k := range props {
+		if v, ok := values[k]; ok {
+			target[k] = v
+		} else {
+			delete(target, k)
+		}
+	}
+	return nil
+}
+
+// extendMembers returns the props and deleteNull members of an extend op.
+func extendMembers(pathRaw string, op map[string]any) (map[string]any, bool, error) {
+	props, ok := op["props"].(map[string]any)
+	if !ok {
+		return nil, false, errorf(ErrInvalidOperation, "op %q %q field must be an object for path %q", "extend", "props", pathRaw)
+	}
+	deleteNull := false
+	if v, present := op["deleteNull"]; present {
+		if deleteNull, ok = v.(bool); !ok {
+			return nil, false, errorf(ErrInvalidOperation, "op %q %q field must be a boolean for path %q", "extend", "deleteNull", pathRaw)
+		}
+	}
+	return props, deleteNull, nil
+}
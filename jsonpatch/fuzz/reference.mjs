@@ -0,0 +1,46 @@
+// Reference implementation process for differential fuzzing.
+//
+// Reads newline-delimited test cases ({testId, originalDoc, operations}) from
+// stdin, applies them with json-joy, and writes one result per line in the
+// same shape as cmd/test-harness ({testId, success, resultDoc, error}).
+import { createInterface } from "node:readline";
+import { applyPatch } from "json-joy/lib/json-patch/index.js";
+
+function write(result) {
+	process.stdout.write(`${JSON.stringify(result)}\n`);
+}
+
+const lines = createInterface({ input: process.stdin, crlfDelay: Infinity });
+
+for await (const line of lines) {
+	if (line.trim() === "") continue;
+
+	let testCase;
+	try {
+		testCase = JSON.parse(line);
+	} catch (error) {
+		write({
+			testId: "unknown",
+			success: false,
+			error: `Failed to decode test case: ${error.message}`,
+		});
+		continue;
+	}
+
+	try {
+		const { doc } = applyPatch(testCase.originalDoc, testCase.operations, {
+			mutate: false,
+		});
+		write({
+			testId: testCase.testId,
+			success: true,
+			resultDoc: doc === undefined ? null : doc,
+		});
+	} catch (error) {
+		write({
+			testId: testCase.testId,
+			success: false,
+			error: error instanceof Error ? error.message : String(error),
+		});
+	}
+}
@@ -29,6 +29,18 @@ if [ ! -d "node_modules" ]; then
     npm install
 fi
 
+# Differential mode: Go native fuzzing compared against json-joy
+if [ "$1" = "--differential" ]; then
+    FUZZ_TIME=${2:-60s}
+    echo "🔀 Running differential fuzzing against json-joy for $FUZZ_TIME..."
+    export JSONPATCH_REFERENCE="$(pwd)/reference.mjs"
+    cd ..
+    go test -run '^$' -fuzz '^FuzzDifferential$' -fuzztime "$FUZZ_TIME" .
+    echo ""
+    echo "✅ Differential fuzzing complete!"
+    exit 0
+fi
+
 # Build the Go test harness
 echo "🔨 Building Go test harness..."
 TEMP_HARNESS=$(mktemp -t test-harness-XXXXXX)
@@ -1,5 +1,7 @@
 import { spawn } from "node:child_process";
 import crypto from "node:crypto";
+import fs from "node:fs";
+import path from "node:path";
 import { diffLines } from "diff";
 import { enablePatches, produceWithPatches } from "immer";
 import {
@@ -322,7 +324,11 @@ async function runSingleFuzzTest(testId) {
 			operations,
 		};
 
-		return await testWithGo(testCase);
+		const result = await testWithGo(testCase);
+		if (!result.success && !result.jsError && process.env.CORPUS_DIR) {
+			saveCorpusCase(process.env.CORPUS_DIR, testCase, result.error);
+		}
+		return result;
 	} catch (error) {
 		return {
 			testId,
@@ -333,6 +339,26 @@ async function runSingleFuzzTest(testId) {
 	}
 }
 
+// saveCorpusCase writes a failing case in the directory format of the Go
+// corpus package so it can be checked in and replayed.
+function saveCorpusCase(corpusDir, testCase, reason) {
+	const caseDir = path.join(corpusDir, testCase.testId);
+	fs.mkdirSync(caseDir, { recursive: true });
+	const write = (name, value) =>
+		fs.writeFileSync(
+			path.join(caseDir, name),
+			`${JSON.stringify(value, null, 2)}\n`,
+		);
+	write("original.json", testCase.originalDoc);
+	write("patch.json", testCase.operations);
+	write("expected.json", testCase.expectedDoc);
+	write("meta.json", {
+		description: String(reason).split("\n")[0],
+		source: "json-joy",
+		tags: ["fuzz"],
+	});
+}
+
 async function testWithGo(testCase) {
 	return new Promise((resolve) => {
 		const harnessPath =
@@ -0,0 +1,93 @@
+package jsonpatch
+
+import "strings"
+
+// WithGuards returns ops preceded by test operations that check the values
+// doc currently has at every path ops write to, so that the patch fails
+// instead of overwriting changes made since doc was read. A path is guarded
+// by testing its value when it exists in doc; an insert into an array is
+// guarded by testing the whole array, since it shifts the elements after
+// it. A new object key cannot be guarded, as test cannot check that a value
+// is absent. Paths inside a guarded value are not tested again, and ops
+// that cannot be resolved are left for Apply to reject.
+func WithGuards(doc any, ops []Operation) []Operation {
+	var guarded []string
+	covers := func(g, path string) bool {
+		return g == "" || g == path || strings.HasPrefix(path, g+"/")
+	}
+	guard := func(path string) {
+		for _, g := range guarded {
+			if covers(g, path) {
+				return
+			}
+		}
+		// A guard on a parent replaces the guards inside it.
+		kept := guarded[:0]
+		for _, g := range guarded {
+			if !covers(path, g) {
+				kept = append(kept, g)
+			}
+		}
+		guarded = append(kept, path)
+	}
+
+	a := &applier{root: doc}
+	for _, op := range ops {
+		var paths []string
+		if !isPredicate(op["op"]) {
+			if path, ok := op["path"].(string); ok {
+				paths = append(paths, path)
+			}
+		}
+		if from, ok := op["from"].(string); ok && op["op"] == "move" {
+			paths = append(paths, from)
+		}
+		for _, path := range paths {
+			if inserts := op["op"] == "add" || op["op"] == "copy" || op["op"] == "move"; inserts && path == op["path"] {
+				// Inserting into an array shifts its elements.
+				if i := strings.LastIndexByte(path, '/'); i >= 0 {
+					if parent, err := a.valueAt(path[:i]); err == nil {
+						if _, isArray := parent.([]any); isArray {
+							guard(path[:i])
+							continue
+						}
+					}
+				}
+			}
+			if _, err := a.valueAt(path); err == nil {
+				guard(path)
+			}
+		}
+	}
+
+	out := make([]Operation, 0, len(guarded)+len(ops))
+	for _, path := range guarded {
+		value, _ := a.valueAt(path)
+		out = append(out, Operation{"op": "test", "path": path, "value": deepCopyValue(value)})
+	}
+	return append(out, ops...)
+}
+
+// SnapshotGuards returns test operations that check the values doc
+// currently has at pointers, in the order given. Prepended to a patch from
+// elsewhere, they make it fail if any of those values changed since doc was
+// read, whatever the patch itself touches. Repeated pointers are tested
+// once. A pointer that does not resolve in doc is an error, as test cannot
+// check that a value is absent.
+func SnapshotGuards(doc any, pointers []string) ([]Operation, error) {
+	a := &applier{root: doc}
+	seen := map[string]bool{}
+	guards := make([]Operation, 0, len(pointers))
+	for _, path := range pointers {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		value, err := a.valueAt(path)
+		if err != nil {
+			return nil, err
+		}
+		guards = append(guards, Operation{"op": "test", "path": path, "value": deepCopyValue(value)})
+	}
+	return guards, nil
+}
@@ -0,0 +1,104 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWithGuards(t *testing.T) {
+	doc := func() map[string]any {
+		return map[string]any{
+			"title": "Draft",
+			"tags":  []any{"a", "b"},
+			"meta":  map[string]any{"views": float64(3), "owner": "ann"},
+		}
+	}
+	tests := []struct {
+		name     string
+		ops      []Operation
+		expected []Operation
+	}{
+		{
+			name: "replace and remove",
+			ops: []Operation{
+				{"op": "replace", "path": "/title", "value": "Final"},
+				{"op": "remove", "path": "/meta/owner"},
+			},
+			expected: []Operation{
+				{"op": "test", "path": "/title", "value": "Draft"},
+				{"op": "test", "path": "/meta/owner", "value": "ann"},
+			},
+		},
+		{
+			name:     "array insert guards the array",
+			ops:      []Operation{{"op": "add", "path": "/tags/0", "value": "z"}, {"op": "replace", "path": "/tags/1", "value": "y"}},
+			expected: []Operation{{"op": "test", "path": "/tags", "value": []any{"a", "b"}}},
+		},
+		{
+			name:     "new keys cannot be guarded",
+			ops:      []Operation{{"op": "add", "path": "/meta/editor", "value": "bob"}, {"op": "test", "path": "/title", "value": "Draft"}},
+			expected: []Operation{},
+		},
+		{
+			name: "a parent guard replaces its children",
+			ops: []Operation{
+				{"op": "inc", "path": "/meta/views", "inc": 1},
+				{"op": "move", "from": "/meta", "path": "/old"},
+			},
+			expected: []Operation{{"op": "test", "path": "/meta", "value": map[string]any{"views": float64(3), "owner": "ann"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guarded := WithGuards(doc(), tt.ops)
+			expected := append(tt.expected, tt.ops...)
+			if !reflect.DeepEqual(guarded, expected) {
+				t.Fatalf("expected %v, got %v", expected, guarded)
+			}
+			if err := Apply(doc(), guarded); err != nil {
+				t.Fatalf("guarded patch does not apply to the original document: %v", err)
+			}
+		})
+	}
+
+	// The guards fail once the document has changed.
+	changed := doc()
+	changed["title"] = "Edited"
+	guarded := WithGuards(doc(), []Operation{{"op": "replace", "path": "/title", "value": "Final"}})
+	if err := Apply(changed, guarded); !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("expected the guard to fail, got %v", err)
+	}
+}
+
+func TestSnapshotGuards(t *testing.T) {
+	doc := map[string]any{
+		"owner": "ann",
+		"meta":  map[string]any{"plan": "pro", "seats": float64(5)},
+	}
+	guards, err := SnapshotGuards(doc, []string{"/owner", "/meta/plan", "/owner"})
+	if err != nil {
+		t.Fatalf("SnapshotGuards returned error: %v", err)
+	}
+	expected := []Operation{
+		{"op": "test", "path": "/owner", "value": "ann"},
+		{"op": "test", "path": "/meta/plan", "value": "pro"},
+	}
+	if !reflect.DeepEqual(guards, expected) {
+		t.Fatalf("expected %v, got %v", expected, guards)
+	}
+
+	// The guarded patch applies until a protected field changes.
+	patch := []Operation{{"op": "replace", "path": "/meta/seats", "value": 6}}
+	if err := Apply(doc, append(guards, patch...)); err != nil {
+		t.Fatalf("guarded patch failed: %v", err)
+	}
+	doc["owner"] = "carol"
+	if err := Apply(doc, append(guards, patch...)); !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("expected the guard to fail, got %v", err)
+	}
+
+	if _, err := SnapshotGuards(doc, []string{"/missing"}); !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("expected ErrPathNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package jsonpatch
+
+import (
+	"strconv"
+	"strings"
+)
+
+// OpEvent describes an operation to Options.BeforeOp and Options.AfterOp.
+// Old and New are the values in the document, not copies, and must not be
+// modified.
+type OpEvent struct {
+	// Index is the position of the operation in the patch.
+	Index int
+	// Op is the operation as it was passed in, or, for an op with a
+	// JSONPath path, a copy with the path of the value it applies to.
+	Op Operation
+	// Path is the operation's path as a JSON Pointer, "" for the root or
+	// starting with "/", with a trailing "-" resolved to the index the
+	// value is appended at.
+	Path string
+	// Old is the value at Path before the operation, or nil if there was
+	// none. It is nil for inserts into arrays, which shift the element at
+	// Path along rather than replace it.
+	Old any
+	// New is the value at Path after the operation, or nil if there is
+	// none, such as after a remove. It is only set for AfterOp.
+	New any
+}
+
+// opEvent describes op, the operation at index i, before it is applied.
+func (a *applier) opEvent(i int, op map[string]any) OpEvent {
+	pathRaw, _ := op["path"].(string)
+	event := OpEvent{Index: i, Op: op, Path: absolutePointer(pathRaw)}
+	if slash := strings.LastIndexByte(event.Path, '/'); slash >= 0 {
+		parent, err := a.valueAt(event.Path[:slash])
+		if s, ok := parent.([]any); err == nil && ok {
+			if event.Path[slash+1:] == "-" {
+				event.Path = event.Path[:slash+1] + strconv.Itoa(len(s))
+			}
+			switch op["op"] {
+			case "add", "copy", "move":
+				return event
+			}
+		}
+	}
+	event.Old, _ = a.valueAt(event.Path)
+	return event
+}
@@ -0,0 +1,62 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyOpHooks(t *testing.T) {
+	doc := map[string]any{"n": float64(1), "list": []any{"a"}, "o": map[string]any{"k": "v"}}
+	var before, after []OpEvent
+	opts := Options{
+		BeforeOp: func(event OpEvent) error {
+			before = append(before, event)
+			return nil
+		},
+		AfterOp: func(event OpEvent) { after = append(after, event) },
+	}
+	ops := []map[string]any{
+		{"op": "replace", "path": "/n", "value": float64(2)},
+		{"op": "add", "path": "/list/-", "value": "b"},
+		{"op": "add", "path": "/list/0", "value": "c"},
+		{"op": "remove", "path": "o/k"},
+		{"op": "remove", "path": "/missing"},
+	}
+	if err := ApplyWithOptions(doc, ops, opts); !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("expected the last op to fail, got %v", err)
+	}
+	expected := []OpEvent{
+		{Index: 0, Op: ops[0], Path: "/n", Old: float64(1), New: float64(2)},
+		{Index: 1, Op: ops[1], Path: "/list/1", New: "b"},
+		{Index: 2, Op: ops[2], Path: "/list/0", New: "c"},
+		{Index: 3, Op: ops[3], Path: "/o/k", Old: "v"},
+	}
+	if !reflect.DeepEqual(after, expected) {
+		t.Fatalf("Events not equal.\nGot:      %v\nExpected: %v", after, expected)
+	}
+	if len(before) != len(ops) || before[0].New != nil || before[3].Old != "v" {
+		t.Fatalf("expected an event before every op without New, got %v", before)
+	}
+
+	// An error from BeforeOp rejects the operation.
+	denied := errors.New("not allowed")
+	doc = map[string]any{"public": 1, "secret": 2}
+	opts = Options{BeforeOp: func(event OpEvent) error {
+		if strings.HasPrefix(event.Path, "/secret") {
+			return denied
+		}
+		return nil
+	}}
+	err := ApplyWithOptions(doc, []map[string]any{
+		{"op": "replace", "path": "/public", "value": 3},
+		{"op": "remove", "path": "/secret"},
+	}, opts)
+	if !errors.Is(err, ErrOpRejected) || !errors.Is(err, denied) {
+		t.Fatalf("expected the hook's error as ErrOpRejected, got %v", err)
+	}
+	if doc["secret"] != 2 || doc["public"] != 3 {
+		t.Fatalf("expected only the allowed op to apply, got %v", doc)
+	}
+}
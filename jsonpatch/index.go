@@ -0,0 +1,41 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Index remembers the containers reached while resolving pointers in a
+// document so that repeated patches against deeply nested documents skip
+// walking from the root. Entries are recorded lazily as paths are resolved and
+// are invalidated by the mutations ApplyWithOptions performs.
+//
+// An Index is bound to the document it was created for and is not safe for
+// concurrent use. If the document is modified other than through
+// ApplyWithOptions with this Index, call Reset before the next apply.
+type Index struct {
+	doc   map[string]any
+	cache *pathCache
+}
+
+// NewIndex returns an empty Index for doc.
+func NewIndex(doc map[string]any) *Index {
+	return &Index{doc: doc, cache: newPathCache()}
+}
+
+// Reset discards every recorded container.
+func (idx *Index) Reset() {
+	clear(idx.cache.entries)
+}
+
+// Len reports how many containers are currently recorded.
+func (idx *Index) Len() int {
+	return len(idx.cache.entries)
+}
+
+func (idx *Index) cacheFor(doc map[string]any) (*pathCache, error) {
+	if reflect.ValueOf(idx.doc).UnsafePointer() != reflect.ValueOf(doc).UnsafePointer() {
+		return nil, errors.New("index was built for a different document")
+	}
+	return idx.cache, nil
+}
@@ -0,0 +1,85 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func deepDoc(depth int) (map[string]any, string) {
+	leaf := map[string]any{"count": 0, "name": "leaf"}
+	doc := leaf
+	for i := depth - 1; i >= 0; i-- {
+		doc = map[string]any{"l" + strconv.Itoa(i): doc}
+	}
+	var path strings.Builder
+	for i := 0; i < depth; i++ {
+		path.WriteString("/l" + strconv.Itoa(i))
+	}
+	return doc, path.String()
+}
+
+func TestIndexReusedAcrossApplies(t *testing.T) {
+	doc, path := deepDoc(24)
+	idx := NewIndex(doc)
+	opts := Options{Index: idx}
+
+	for i := 0; i < 3; i++ {
+		ops := []map[string]any{{"op": "inc", "path": path + "/count", "inc": 1}}
+		if err := ApplyWithOptions(doc, ops, opts); err != nil {
+			t.Fatalf("ApplyWithOptions returned error: %v", err)
+		}
+	}
+	if idx.Len() != 24 {
+		t.Fatalf("expected 24 indexed containers, got %d", idx.Len())
+	}
+
+	got, _ := doc["l0"].(map[string]any)
+	for i := 1; i < 24; i++ {
+		got = got["l"+strconv.Itoa(i)].(map[string]any)
+	}
+	if got["count"] != 3 {
+		t.Fatalf("expected count 3, got %v", got["count"])
+	}
+}
+
+func TestIndexInvalidatedByMutations(t *testing.T) {
+	doc := map[string]any{"a": map[string]any{"b": map[string]any{"c": 1}}, "list": []any{map[string]any{"v": 1}}}
+	idx := NewIndex(doc)
+	opts := Options{Index: idx}
+
+	steps := [][]map[string]any{
+		{{"op": "replace", "path": "/a/b/c", "value": 2}},
+		{{"op": "replace", "path": "/a/b", "value": map[string]any{"c": 5}}},
+		{{"op": "inc", "path": "/a/b/c", "inc": 1}},
+		{{"op": "add", "path": "/list/0", "value": map[string]any{"v": 0}}},
+		{{"op": "inc", "path": "/list/1/v", "inc": 1}},
+	}
+	for _, ops := range steps {
+		if err := ApplyWithOptions(doc, ops, opts); err != nil {
+			t.Fatalf("ApplyWithOptions(%v) returned error: %v", ops, err)
+		}
+	}
+
+	expected := map[string]any{
+		"a":    map[string]any{"b": map[string]any{"c": 6}},
+		"list": []any{map[string]any{"v": 0}, map[string]any{"v": 2}},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("Documents not equal.\nGot:      %v\nExpected: %v", doc, expected)
+	}
+
+	idx.Reset()
+	if idx.Len() != 0 {
+		t.Fatalf("expected empty index after Reset, got %d entries", idx.Len())
+	}
+}
+
+func TestIndexRejectsOtherDocument(t *testing.T) {
+	idx := NewIndex(map[string]any{})
+	err := ApplyWithOptions(map[string]any{"a": 1}, []map[string]any{{"op": "remove", "path": "/a"}}, Options{Index: idx})
+	if err == nil || !strings.Contains(err.Error(), "different document") {
+		t.Fatalf("expected different document error, got %v", err)
+	}
+}
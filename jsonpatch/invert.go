@@ -0,0 +1,226 @@
+package jsonpatch
+
+import (
+	"errors"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Invert returns the patch that undoes ops when applied to the document
+// ops produce from doc, for undo and rollback without keeping snapshots.
+// doc is not modified. Each operation is inverted against the document as
+// it was just before it, and the inverses come in reverse order:
+//
+//   - add and copy become remove, or replace with the value they
+//     overwrote in an object;
+//   - remove becomes add of the removed value;
+//   - replace becomes replace with the old value;
+//   - move becomes a move back, followed by an add of the value it
+//     overwrote, if any; a move out of a value inside the one at its path
+//     becomes replace with the value it overwrote in an object, or remove
+//     of the moved value and add of it back where it was in an array;
+//   - str_ins becomes str_del of the inserted text, and str_del becomes
+//     str_ins of the deleted text;
+//   - inc becomes inc by the negated amount, so that it still undoes the
+//     increment after other increments; as the default IncInteger typing
+//     truncates the sum, an inc by or of a fractional number becomes
+//     replace with the old value, which undoes it under any IncTyping;
+//   - test, less and more need no undoing.
+//
+// String positions are counted in UTF-16 code units. A patch that does not
+// apply to doc returns the error Apply would.
+func Invert(doc any, ops []Operation) ([]Operation, error) {
+	var inverse []Operation
+	current := doc
+	for i, op := range ops {
+		undo, err := invertOp(current, op)
+		if err == nil {
+			current, err = ApplyNew(current, []map[string]any{op})
+		}
+		if err != nil {
+			var opErr *OpError
+			if errors.As(err, &opErr) {
+				err = opErr.Err
+			}
+			return nil, newOpError(i, op, err)
+		}
+		// Appends only know where the value went once applied.
+		resolveAppend(current, op, undo)
+		inverse = append(undo, inverse...)
+	}
+	return inverse, nil
+}
+
+// invertOp returns the operations that undo op on doc, the document before
+// op. Ops it cannot make sense of are left for ApplyNew to reject.
+func invertOp(doc any, op Operation) ([]Operation, error) {
+	a := &applier{root: doc}
+	name, _ := op["op"].(string)
+	pathRaw, ok := op["path"].(string)
+	if !ok {
+		return nil, nil
+	}
+	switch name {
+	case "add", "copy":
+		return undoWrite(a, pathRaw, true), nil
+	case "replace":
+		return undoWrite(a, pathRaw, false), nil
+	case "remove":
+		old, err := a.valueAt(pathRaw)
+		if err != nil {
+			return nil, nil
+		}
+		return []Operation{{"op": "add", "path": pathRaw, "value": deepCopyValue(old)}}, nil
+	case "move":
+		fromRaw, _ := op["from"].(string)
+		if fromRaw == pathRaw {
+			return nil, nil
+		}
+		if strings.HasPrefix(fromRaw, pathRaw+"/") {
+			// The value moved out of one of the values holding it, so moving
+			// it back would move it into itself.
+			return undoMoveOut(a, fromRaw, pathRaw), nil
+		}
+		undo := []Operation{{"op": "move", "from": pathRaw, "path": fromRaw}}
+		if parent, err := a.valueAt(parentPointer(pathRaw)); err == nil {
+			if m, ok := parent.(map[string]any); ok {
+				key, _ := decodePointerSegment(pathRaw[strings.LastIndexByte(pathRaw, '/')+1:])
+				if old, exists := m[key]; exists {
+					undo = append(undo, Operation{"op": "add", "path": pathRaw, "value": deepCopyValue(old)})
+				}
+			}
+		}
+		return undo, nil
+	case "str_ins":
+		str, _ := op["str"].(string)
+		return []Operation{{"op": "str_del", "path": pathRaw, "pos": op["pos"], "str": str}}, nil
+	case "str_del":
+		if str, ok := op["str"].(string); ok {
+			return []Operation{{"op": "str_ins", "path": pathRaw, "pos": op["pos"], "str": str}}, nil
+		}
+		current, err := a.valueAt(pathRaw)
+		s, isString := current.(string)
+		pos, posOk := getNumericValue(op["pos"])
+		length, lenOk := getNumericValue(op["len"])
+		if err != nil || !isString || !posOk || !lenOk {
+			return nil, nil
+		}
+		start := UTF16Indexing.Offset(s, int(pos))
+		end := max(start, UTF16Indexing.Offset(s, int(pos)+int(length)))
+		return []Operation{{"op": "str_ins", "path": pathRaw, "pos": op["pos"], "str": s[start:end]}}, nil
+	case "inc":
+		inc, incOk := getNumericValue(op["inc"])
+		current, err := a.valueAt(pathRaw)
+		value, valueOk := getNumericValue(current)
+		if err != nil || !incOk || !valueOk {
+			return nil, nil
+		}
+		if inc != math.Trunc(inc) || value != math.Trunc(value) {
+			// IncInteger truncates the sum, so only the old value undoes it.
+			return []Operation{{"op": "replace", "path": pathRaw, "value": current}}, nil
+		}
+		if whole, ok := getIntegerValue(op["inc"]); ok && (whole > 1<<53 || whole < -1<<53) && whole != math.MinInt64 {
+			// Beyond 2^53, float64 cannot hold the negated amount exactly.
+			return []Operation{{"op": "inc", "path": pathRaw, "inc": -whole}}, nil
+		}
+		return []Operation{{"op": "inc", "path": pathRaw, "inc": -inc}}, nil
+	case "extend":
+		props, _, err := extendMembers(pathRaw, op)
+		target, _ := a.valueAt(pathRaw)
+		object, ok := target.(map[string]any)
+		if err != nil || !ok {
+			return nil, nil
+		}
+		// Members that were null are put back with add, as a null prop
+		// would delete them.
+		restore := map[string]any{}
+		var undo []Operation
+		for _, k := range slices.Sorted(maps.Keys(props)) {
+			old, exists := object[k]
+			switch {
+			case exists && old == nil:
+				undo = append(undo, Operation{"op": "add", "path": pathRaw + "/" + pointerEscaper.Replace(k), "value": nil})
+			case exists:
+				restore[k] = deepCopyValue(old)
+			default:
+				restore[k] = nil
+			}
+		}
+		return append([]Operation{{"op": "extend", "path": pathRaw, "props": restore, "deleteNull": true}}, undo...), nil
+	}
+	if isPredicate(name) {
+		return nil, nil
+	}
+	return nil, errorf(ErrInvalidOperation, "cannot invert op %q", name)
+}
+
+// undoWrite undoes a write at pathRaw: inserts is set for ops that insert
+// into arrays rather than overwrite elements.
+func undoWrite(a *applier, pathRaw string, inserts bool) []Operation {
+	if pathRaw == "" {
+		return []Operation{{"op": "replace", "path": "", "value": deepCopyValue(a.root)}}
+	}
+	parent, err := a.valueAt(parentPointer(pathRaw))
+	if err != nil {
+		return nil
+	}
+	segment := pathRaw[strings.LastIndexByte(pathRaw, '/')+1:]
+	switch parent := parent.(type) {
+	case map[string]any:
+		key, _ := decodePointerSegment(segment)
+		if old, exists := parent[key]; exists {
+			return []Operation{{"op": "replace", "path": pathRaw, "value": deepCopyValue(old)}}
+		}
+		return []Operation{{"op": "remove", "path": pathRaw}}
+	case []any:
+		if inserts {
+			return []Operation{{"op": "remove", "path": pathRaw}}
+		}
+		if index, err := strconv.Atoi(segment); err == nil && index >= 0 && index < len(parent) {
+			return []Operation{{"op": "replace", "path": pathRaw, "value": deepCopyValue(parent[index])}}
+		}
+	}
+	return nil
+}
+
+// undoMoveOut undoes a move from fromRaw to pathRaw, which holds fromRaw. In
+// an object, or at the root, the move overwrote the value at pathRaw, which
+// is put back whole. In an array, it inserted the moved value before that
+// value, so the moved value is removed and added back at fromRaw.
+func undoMoveOut(a *applier, fromRaw, pathRaw string) []Operation {
+	if parent, err := a.valueAt(parentPointer(pathRaw)); err == nil && pathRaw != "" {
+		if _, ok := parent.([]any); ok {
+			moved, err := a.valueAt(fromRaw)
+			if err != nil {
+				return nil
+			}
+			return []Operation{
+				{"op": "remove", "path": pathRaw},
+				{"op": "add", "path": fromRaw, "value": deepCopyValue(moved)},
+			}
+		}
+	}
+	return undoWrite(a, pathRaw, false)
+}
+
+// resolveAppend rewrites undo, the inverse of op, to name the index op
+// appended at, now that doc holds the result of op.
+func resolveAppend(doc any, op Operation, undo []Operation) {
+	pathRaw, _ := op["path"].(string)
+	parentRaw, appended := strings.CutSuffix(pathRaw, "/-")
+	if !appended || len(undo) == 0 {
+		return
+	}
+	parent, err := (&applier{root: doc}).valueAt(parentRaw)
+	if s, ok := parent.([]any); ok && err == nil {
+		resolved := parentRaw + "/" + strconv.Itoa(len(s)-1)
+		if op["op"] == "move" {
+			undo[0]["from"] = resolved
+		} else {
+			undo[0]["path"] = resolved
+		}
+	}
+}
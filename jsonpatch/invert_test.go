@@ -0,0 +1,86 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestInvert(t *testing.T) {
+	const src = `{"a": {"b": 1, "c": [1, 2, 3]}, "s": "h🌍llo", "n": 5, "list": ["x", "y"]}`
+	tests := []struct {
+		name string
+		ops  []Operation
+	}{
+		{"add new key", []Operation{{"op": "add", "path": "/a/d", "value": map[string]any{"e": 1}}}},
+		{"add over a key", []Operation{{"op": "add", "path": "/a/b", "value": 2}}},
+		{"array inserts", []Operation{{"op": "add", "path": "/a/c/1", "value": 9}, {"op": "add", "path": "/a/c/-", "value": 10}}},
+		{"remove", []Operation{{"op": "remove", "path": "/a/c/0"}, {"op": "remove", "path": "/a"}}},
+		{"replace", []Operation{{"op": "replace", "path": "/a/c/2", "value": "z"}, {"op": "replace", "path": "/n", "value": nil}}},
+		{"replace root", []Operation{{"op": "replace", "path": "", "value": map[string]any{"only": true}}}},
+		{"copy", []Operation{{"op": "copy", "from": "/a", "path": "/list/-"}, {"op": "copy", "from": "/n", "path": "/a/b"}}},
+		{"move within an array", []Operation{{"op": "move", "from": "/list/0", "path": "/list/-"}, {"op": "move", "from": "/a/c/2", "path": "/a/c/0"}}},
+		{"move over a key", []Operation{{"op": "move", "from": "/n", "path": "/a/b"}}},
+		{"move out of the overwritten value", []Operation{{"op": "move", "from": "/a/c", "path": "/a"}}},
+		{"move out of an array element", []Operation{{"op": "add", "path": "/list/0", "value": map[string]any{"y": []any{1}}}, {"op": "move", "from": "/list/0/y", "path": "/list/0"}}},
+		{"move to the root", []Operation{{"op": "move", "from": "/a", "path": ""}}},
+		{"string edits", []Operation{{"op": "str_ins", "path": "/s", "pos": 3, "str": "ab"}, {"op": "str_del", "path": "/s", "pos": 1, "len": 3}, {"op": "str_del", "path": "/s", "pos": 0, "str": "h"}}},
+		{"inc", []Operation{{"op": "inc", "path": "/n", "inc": 2.5}, {"op": "inc", "path": "/a/c/0", "inc": -1}}},
+		{"extend", []Operation{{"op": "extend", "path": "/a", "props": map[string]any{"b": nil, "d": 1}}, {"op": "extend", "path": "", "props": map[string]any{"n": nil, "s": "x"}, "deleteNull": true}}},
+		{"tests", []Operation{{"op": "test", "path": "/n", "value": 5}, {"op": "less", "path": "/n", "value": 6}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc any
+			if err := json.Unmarshal([]byte(src), &doc); err != nil {
+				t.Fatal(err)
+			}
+			original := deepCopyValue(doc)
+			inverse, err := Invert(doc, tt.ops)
+			if err != nil {
+				t.Fatalf("Invert returned error: %v", err)
+			}
+			if !reflect.DeepEqual(doc, original) {
+				t.Fatalf("Invert modified its input: %v", doc)
+			}
+			patched, err := ApplyValue(doc, deepCopyValue(tt.ops).([]Operation))
+			if err != nil {
+				t.Fatalf("ApplyValue returned error: %v", err)
+			}
+			restored, err := ApplyValue(patched, inverse)
+			if err != nil {
+				t.Fatalf("inverse %v does not apply: %v", inverse, err)
+			}
+			if !jsonEqual(restored, original) {
+				t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v\nInverse: %v", restored, original, inverse)
+			}
+		})
+	}
+}
+
+func TestInvertOps(t *testing.T) {
+	doc := map[string]any{"s": "hello", "n": float64(1), "list": []any{"a"}}
+	inverse, err := Invert(doc, []Operation{
+		{"op": "add", "path": "/list/-", "value": "b"},
+		{"op": "str_del", "path": "/s", "pos": 1, "len": 3},
+		{"op": "inc", "path": "/n", "inc": 2},
+	})
+	if err != nil {
+		t.Fatalf("Invert returned error: %v", err)
+	}
+	expected := []Operation{
+		{"op": "inc", "path": "/n", "inc": float64(-2)},
+		{"op": "str_ins", "path": "/s", "pos": 1, "str": "ell"},
+		{"op": "remove", "path": "/list/1"},
+	}
+	if !reflect.DeepEqual(inverse, expected) {
+		t.Fatalf("Patches not equal.\nGot: %v\nExpected: %v", inverse, expected)
+	}
+
+	_, err = Invert(doc, []Operation{{"op": "test", "path": "/n", "value": 1}, {"op": "remove", "path": "/missing"}})
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Index != 1 || !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("expected ErrPathNotFound for op 1, got %v", err)
+	}
+}
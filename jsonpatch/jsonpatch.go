@@ -1,9 +1,22 @@
 package jsonpatch
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/jsonpointer"
 )
 
 // getNumericValue safely converts an any to float64 if it's a known numeric type.
@@ -17,65 +30,157 @@ func getNumericValue(val any) (float64, bool) {
 		return float64(v), true
 	case int64:
 		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
 	default:
 		return 0, false
 	}
 }
 
-// decodePointerSegment unescapes "~0" and "~1" according to RFC 6901.
-func decodePointerSegment(segment string) (string, error) {
-	if strings.IndexByte(segment, '~') == -1 {
-		return segment, nil
+// getIntegerValue returns val as an int64 if it is a whole number that fits
+// one, so that integers beyond 2^53, as kept by json.Number, are handled
+// without rounding.
+func getIntegerValue(val any) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case json.Number:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		return n, err == nil
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return int64(v), true
+		}
 	}
+	return 0, false
+}
 
-	var builder strings.Builder
-	builder.Grow(len(segment))
-	for i := 0; i < len(segment); i++ {
-		ch := segment[i]
-		if ch != '~' {
-			builder.WriteByte(ch)
-			continue
+// compareNumbers orders two numbers, exactly when both are whole numbers
+// that fit an int64 and by float64 value otherwise.
+func compareNumbers(a, b any) (int, bool) {
+	if ai, ok := getIntegerValue(a); ok {
+		if bi, ok := getIntegerValue(b); ok {
+			return cmp.Compare(ai, bi), true
+		}
+	}
+	af, aok := getNumericValue(a)
+	bf, bok := getNumericValue(b)
+	if !aok || !bok {
+		return 0, false
+	}
+	return cmp.Compare(af, bf), true
+}
+
+// addIntegers returns a+b, unless it overflows an int64.
+func addIntegers(a, b int64) (int64, bool) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, false
+	}
+	return a + b, true
+}
+
+// incSum returns the result of incrementing current by inc, whose sum as
+// float64 is sum, with the type typing asks for.
+func incSum(current, inc any, sum float64, typing IncTyping) any {
+	// Whole numbers are added exactly, beyond what float64 holds.
+	exact, isExact := int64(0), false
+	if c, ok := getIntegerValue(current); ok {
+		if i, ok := getIntegerValue(inc); ok {
+			exact, isExact = addIntegers(c, i)
 		}
-		if i+1 >= len(segment) {
-			return "", fmt.Errorf("invalid escape sequence \"~\" at end of segment %q", segment)
+	}
+	switch typing {
+	case IncFloat:
+		return sum
+	case IncKeepType:
+		switch current.(type) {
+		case float64:
+			return sum
+		case int32:
+			return int32(sum)
+		case int64:
+			if isExact {
+				return exact
+			}
+			return int64(sum)
+		case json.Number:
+			if isExact {
+				return json.Number(strconv.FormatInt(exact, 10))
+			}
+			return json.Number(strconv.FormatFloat(sum, 'g', -1, 64))
 		}
-		switch segment[i+1] {
-		case '0':
-			builder.WriteByte('~')
-		case '1':
-			builder.WriteByte('/')
-		default:
-			return "", fmt.Errorf("invalid escape sequence \"~%c\" in segment %q", segment[i+1], segment)
+	}
+	if isExact {
+		if int64(int(exact)) != exact {
+			return exact
 		}
-		i++
+		return int(exact)
 	}
+	return int(sum)
+}
+
+// decodePointerSegment unescapes "~0" and "~1" according to RFC 6901.
+func decodePointerSegment(segment string) (string, error) {
+	return jsonpointer.Unescape(segment)
+}
 
-	return builder.String(), nil
+// parseArrayIndex parses an array index segment. RFC 6901 only allows "0" or
+// digits without a leading zero, so forms like "01" or "+1" are rejected.
+func parseArrayIndex(segment string) (int, error) {
+	return jsonpointer.ParseIndex(segment)
 }
 
 // resolvePath walks doc using a JSON Pointer and returns the container that owns
 // the final segment along with the leaf key/index plus its parent container info.
 func resolvePath(doc map[string]any, pathRaw string) (parentContainer any, finalKey string, finalIndex int, containerParent any, containerParentKey string, containerParentIndex int, err error) {
+	return resolvePathCached(doc, pathRaw, nil)
+}
+
+// resolvePathCached is resolvePath with an optional cache of intermediate
+// containers. When cache is non-nil, traversal starts from the deepest cached
+// prefix of pathRaw and every container visited on the way is recorded.
+func resolvePathCached(doc any, pathRaw string, cache *pathCache) (parentContainer any, finalKey string, finalIndex int, containerParent any, containerParentKey string, containerParentIndex int, err error) {
 	if pathRaw == "" {
 		parentContainer = doc
 		return
 	}
 
-	pathSegments := strings.Split(strings.TrimPrefix(pathRaw, "/"), "/")
+	trimmed := strings.TrimPrefix(pathRaw, "/")
+	rest := trimmed
 	traversalCurrent := any(doc)
 	var prevContainer any
 	var prevKey string
 	var prevIndex int
-	last := len(pathSegments) - 1
 
-	for i, rawSegment := range pathSegments {
+	if cache != nil {
+		if entry, end, ok := cache.lookup(trimmed); ok {
+			traversalCurrent = entry.container
+			prevContainer = entry.parent
+			prevKey = entry.parentKey
+			prevIndex = entry.parentIndex
+			rest = trimmed[end+1:]
+		}
+	}
+
+	for {
+		rawSegment := rest
+		slash := strings.IndexByte(rest, '/')
+		isLast := slash < 0
+		if !isLast {
+			rawSegment = rest[:slash]
+		}
 		segment, decErr := decodePointerSegment(rawSegment)
 		if decErr != nil {
-			err = fmt.Errorf("invalid JSON pointer %q: %w", pathRaw, decErr)
+			err = errorf(ErrInvalidPointer, "invalid JSON pointer %q: %w", pathRaw, decErr)
 			return
 		}
 
-		if i == last {
+		if isLast {
 			containerParent = prevContainer
 			containerParentKey = prevKey
 			containerParentIndex = prevIndex
@@ -88,15 +193,15 @@ func resolvePath(doc map[string]any, pathRaw string) (parentContainer any, final
 				if leaf == "-" {
 					finalIndex = len(current)
 				} else {
-					idx, convErr := strconv.Atoi(leaf)
+					idx, convErr := parseArrayIndex(leaf)
 					if convErr != nil {
-						err = fmt.Errorf("path segment %q is not a valid integer index for slice in path %q", leaf, pathRaw)
+						err = errorf(ErrInvalidPointer, "path segment %q is not a valid integer index for slice in path %q", leaf, pathRaw)
 						return
 					}
 					finalIndex = idx
 				}
 			default:
-				err = fmt.Errorf("path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+				err = errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
 			}
 			return
 		}
@@ -105,7 +210,7 @@ func resolvePath(doc map[string]any, pathRaw string) (parentContainer any, final
 		case map[string]any:
 			val, exists := current[segment]
 			if !exists {
-				err = fmt.Errorf("path segment %q not found in map for path %q", segment, pathRaw)
+				err = errorf(ErrPathNotFound, "path segment %q not found in map for path %q", segment, pathRaw)
 				return
 			}
 			prevContainer = current
@@ -113,13 +218,13 @@ func resolvePath(doc map[string]any, pathRaw string) (parentContainer any, final
 			prevIndex = -1
 			traversalCurrent = val
 		case []any:
-			idx, convErr := strconv.Atoi(segment)
+			idx, convErr := parseArrayIndex(segment)
 			if convErr != nil {
-				err = fmt.Errorf("path segment %q is not a valid integer index for slice in path %q", segment, pathRaw)
+				err = errorf(ErrInvalidPointer, "path segment %q is not a valid integer index for slice in path %q", segment, pathRaw)
 				return
 			}
 			if idx < 0 || idx >= len(current) {
-				err = fmt.Errorf("index %d out of bounds for slice (len %d) at segment %q in path %q", idx, len(current), segment, pathRaw)
+				err = errorf(ErrOutOfBounds, "index %d out of bounds for slice (len %d) at segment %q in path %q", idx, len(current), segment, pathRaw)
 				return
 			}
 			prevContainer = current
@@ -127,11 +232,41 @@ func resolvePath(doc map[string]any, pathRaw string) (parentContainer any, final
 			prevIndex = idx
 			traversalCurrent = current[idx]
 		default:
-			err = fmt.Errorf("path %q traverses a non-container (neither map nor slice) at segment %q (value type: %T)", pathRaw, segment, traversalCurrent)
+			err = errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) at segment %q (value type: %T)", pathRaw, segment, traversalCurrent)
 			return
 		}
+
+		if cache != nil {
+			cache.store(trimmed[:len(trimmed)-len(rest)+slash], cachedContainer{
+				container:   traversalCurrent,
+				parent:      prevContainer,
+				parentKey:   prevKey,
+				parentIndex: prevIndex,
+			})
+		}
+		rest = rest[slash+1:]
+	}
+}
+
+// deepCopyValue returns a copy of a JSON value that shares no maps or slices
+// with the original.
+func deepCopyValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, child := range v {
+			out[k] = deepCopyValue(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = deepCopyValue(child)
+		}
+		return out
+	default:
+		return v
 	}
-	return
 }
 
 func insertValueIntoSlice(slice []any, index int, value any) []any {
@@ -144,6 +279,47 @@ func insertValueIntoSlice(slice []any, index int, value any) []any {
 	return slice
 }
 
+// countAppends counts the "add" ops appending with "-" to each slice pointer,
+// returning nil unless some slice receives more than one append.
+func countAppends(operations []map[string]any) map[string]int {
+	var counts map[string]int
+	repeated := false
+	for _, op := range operations {
+		if op["op"] != "add" {
+			continue
+		}
+		pathRaw, ok := op["path"].(string)
+		if !ok || !strings.HasSuffix(pathRaw, "/-") {
+			continue
+		}
+		if counts == nil {
+			counts = make(map[string]int)
+		}
+		key := strings.TrimSuffix(pathRaw, "/-")
+		counts[key]++
+		repeated = repeated || counts[key] > 1
+	}
+	if !repeated {
+		return nil
+	}
+	return counts
+}
+
+// reserveAppends grows slice once to fit every remaining append counted for
+// the slice at pathRaw, so a run of "-" appends reallocates at most once.
+func reserveAppends(slice []any, appends map[string]int, pathRaw string) []any {
+	if appends == nil || !strings.HasSuffix(pathRaw, "/-") {
+		return slice
+	}
+	key := strings.TrimSuffix(pathRaw, "/-")
+	remaining := appends[key]
+	if remaining <= 0 {
+		return slice
+	}
+	appends[key] = remaining - 1
+	return slices.Grow(slice, remaining)
+}
+
 func removeValueFromSlice(slice []any, index int) ([]any, any) {
 	val := slice[index]
 	copy(slice[index:], slice[index+1:])
@@ -170,16 +346,43 @@ func assignSliceToParent(parent any, key string, index int, updated []any, op st
 
 // jsonEqual compares two values according to JSON Patch "test" semantics.
 func jsonEqual(a, b any) bool {
-	if af, aok := getNumericValue(a); aok {
-		if bf, bok := getNumericValue(b); bok {
-			return af == bf
+	return equality{}.equal(a, b)
+}
+
+// equality holds the options that change how test compares values.
+type equality struct {
+	// timestamps makes two strings that both parse as RFC 3339 timestamps
+	// equal if they name the same instant.
+	timestamps bool
+	numbers    NumberComparison
+}
+
+func (e equality) equal(a, b any) bool {
+	a, b = jsonForm(a), jsonForm(b)
+	if e.numbers != NumbersByValue && (isNumber(a) || isNumber(b)) {
+		if !isNumber(a) || !isNumber(b) {
+			return false
+		}
+		if e.numbers == NumbersByText {
+			return numberText(a) == numberText(b)
+		}
+		if reflect.TypeOf(a) != reflect.TypeOf(b) {
+			return false
 		}
-		return false
+	}
+	if _, aok := getNumericValue(a); aok {
+		order, ok := compareNumbers(a, b)
+		return ok && order == 0
 	}
 
 	switch av := a.(type) {
 	case string:
 		bv, ok := b.(string)
+		if ok && e.timestamps {
+			if at, bt, ok := parseTimestamps(av, bv); ok {
+				return at.Equal(bt)
+			}
+		}
 		return ok && av == bv
 	case bool:
 		bv, ok := b.(bool)
@@ -193,7 +396,7 @@ func jsonEqual(a, b any) bool {
 		}
 		for k, v := range av {
 			bv, exists := bm[k]
-			if !exists || !jsonEqual(v, bv) {
+			if !exists || !e.equal(v, bv) {
 				return false
 			}
 		}
@@ -211,7 +414,7 @@ func jsonEqual(a, b any) bool {
 			return false
 		}
 		for i := range av {
-			if !jsonEqual(av[i], bs[i]) {
+			if !e.equal(av[i], bs[i]) {
 				return false
 			}
 		}
@@ -221,6 +424,126 @@ func jsonEqual(a, b any) bool {
 	}
 }
 
+// jsonForm returns leaves of types implementing json.Marshaler, such as
+// decimals or time.Time, as the value their JSON decodes to, so that they
+// compare like the JSON they stand for. Other values are returned as they
+// are, and so are leaves that fail to marshal.
+func jsonForm(v any) any {
+	m, ok := v.(json.Marshaler)
+	if !ok {
+		return v
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		// encoding/json writes nil pointers as null.
+		return nil
+	}
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return v
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return v
+	}
+	return decoded
+}
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case float64, float32, int, int32, int64, json.Number:
+		return true
+	}
+	return false
+}
+
+// isJSONType reports whether name is a type the type op accepts.
+func isJSONType(name string) bool {
+	switch name {
+	case "string", "number", "integer", "boolean", "object", "array", "null":
+		return true
+	}
+	return false
+}
+
+// jsonType returns the JSON type of v: "string", "number", "boolean",
+// "object", "array" or "null". Leaves implementing json.Marshaler have the
+// type of the JSON they marshal to.
+func jsonType(v any) string {
+	switch v := jsonForm(v).(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		if isNumber(v) {
+			return "number"
+		}
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// isWholeNumber reports whether the number v has no fractional part.
+func isWholeNumber(v any) bool {
+	v = jsonForm(v)
+	if _, ok := getIntegerValue(v); ok {
+		return true
+	}
+	if f, ok := v.(float32); ok {
+		v = float64(f)
+	}
+	f, ok := getNumericValue(v)
+	return ok && f == math.Trunc(f) && !math.IsInf(f, 0)
+}
+
+// numberText returns the JSON text of a number.
+func numberText(v any) string {
+	if n, ok := v.(json.Number); ok {
+		return n.String()
+	}
+	text, _ := json.Marshal(v)
+	return string(text)
+}
+
+// compareValues orders a before, equal to, or after b for the less and more
+// ops. Numbers compare numerically and strings lexically, or
+// chronologically when timestamps is set and both are RFC 3339 timestamps.
+// Other values cannot be ordered.
+func compareValues(a, b any, timestamps bool) (int, bool) {
+	a, b = jsonForm(a), jsonForm(b)
+	if _, ok := getNumericValue(a); ok {
+		return compareNumbers(a, b)
+	}
+	as, ok := a.(string)
+	if !ok {
+		return 0, false
+	}
+	bs, ok := b.(string)
+	if !ok {
+		return 0, false
+	}
+	if timestamps {
+		if at, bt, ok := parseTimestamps(as, bs); ok {
+			return at.Compare(bt), true
+		}
+	}
+	return strings.Compare(as, bs), true
+}
+
+func parseTimestamps(a, b string) (time.Time, time.Time, bool) {
+	at, err := time.Parse(time.RFC3339Nano, a)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	bt, err := time.Parse(time.RFC3339Nano, b)
+	return at, bt, err == nil
+}
+
 // utf16OffsetToRuneIndex converts a JavaScript UTF-16 offset to a Go rune index.
 func utf16OffsetToRuneIndex(text string, jsOffset int) int {
 	if jsOffset <= 0 {
@@ -265,393 +588,1119 @@ func utf16Length(text string) int {
 	return l
 }
 
-// Apply applies a slice of JSON Patch operations to a document represented as a map.
-// The operations should conform to RFC 6902.
-// Supported operations: "replace", "str_ins", "str_del", "inc".
-// "add" and "remove" on the root are supported. Other ops like "test", "move", "copy" are not.
+// Apply applies a slice of JSON Patch operations to a document represented
+// as a map, in place. It supports the RFC 6902 operations add, remove,
+// replace, move, copy and test, the predicates less, more, in, defined,
+// undefined, type, contains, starts, ends and matches, and the extensions
+// str_ins, str_del, inc and extend; constants such as OpStrIns name them
+// all. The root stays the same map: add and replace on "" swap in the
+// members of another object, remove empties it, and extend merges into it.
+// Apply stops at the first operation that fails, with an *OpError, and the
+// operations before it stay applied; Options.Atomic and the other options
+// change that and more.
 func Apply(doc map[string]any, operations []map[string]any) error {
-	for _, op := range operations {
-		opType, opTypeOk := op["op"].(string)
-		pathRaw, pathRawOk := op["path"].(string)
+	return ApplyWithOptions(doc, operations, Options{})
+}
+
+// ApplyContext is like Apply but stops when ctx is done, so that a long
+// patch can be abandoned when the request it serves times out. ctx is
+// checked before each operation, and before each value an op with a
+// JSONPath path is applied to. The work an operation does on one value,
+// such as an insert into a huge string or array, is a single pass that runs
+// to completion. The error is then an *OpError for the operation that was
+// not applied, wrapping ctx.Err(), and the document is left as the
+// operations before it changed it, except that a JSONPath op may have been
+// applied to some of the values it selects.
+func ApplyContext(ctx context.Context, doc map[string]any, operations []map[string]any) error {
+	return ApplyContextWithOptions(ctx, doc, operations, Options{})
+}
 
-		if !opTypeOk || !pathRawOk {
-			return fmt.Errorf("invalid op format: op missing or not a string, or path missing or not a string: %+v", op)
+// ApplyWithOptions is like Apply but accepts Options that tune how the patch
+// is applied.
+func ApplyWithOptions(doc map[string]any, operations []map[string]any, opts Options) error {
+	return ApplyContextWithOptions(context.Background(), doc, operations, opts)
+}
+
+// ApplyContextWithOptions is like ApplyContext but accepts Options. ctx
+// also carries the actor recorded by Options.Audit; see WithActor.
+func ApplyContextWithOptions(ctx context.Context, doc map[string]any, operations []map[string]any, opts Options) error {
+	if opts.DryRun {
+		return dryRun(ctx, doc, operations, opts, true)
+	}
+	if opts.Atomic {
+		return applyAtomic(ctx, doc, operations, opts)
+	}
+	a, err := newApplier(ctx, doc, opts, operations)
+	if err != nil {
+		return err
+	}
+	a.mapRoot = doc
+	return a.apply(operations)
+}
+
+// ApplyValue applies operations to a document with an arbitrary JSON root: an
+// object, an array, or a scalar. Unlike Apply, the root itself may be replaced
+// or removed (leaving nil), so callers must use the returned document. The
+// input may be modified in place.
+func ApplyValue(doc any, operations []map[string]any) (any, error) {
+	return ApplyValueWithOptions(doc, operations, Options{})
+}
+
+// ApplyValueWithOptions is like ApplyValue but accepts Options. An Index may
+// only be used when the root is a map.
+func ApplyValueWithOptions(doc any, operations []map[string]any, opts Options) (any, error) {
+	ctx := context.Background()
+	if opts.DryRun {
+		return doc, dryRun(ctx, doc, operations, opts, false)
+	}
+	if opts.Atomic {
+		result, err := applyCopy(ctx, doc, operations, opts, false)
+		if err != nil {
+			return doc, err
 		}
+		return result, nil
+	}
+	a, err := newApplier(ctx, doc, opts, operations)
+	if err != nil {
+		return doc, err
+	}
+	err = a.apply(operations)
+	return a.root, err
+}
 
-		// Handle operations on the root document itself.
-		if pathRaw == "" {
-			switch opType {
-			case "replace", "add": // "add" on root is same as "replace" for a map document
-				newValue, valExists := op["value"]
-				if !valExists {
-					return fmt.Errorf("op %q on root path %q requires a %q field", opType, pathRaw, "value")
-				}
-				newMapValue, newIsMap := newValue.(map[string]any)
-				if !newIsMap {
-					return fmt.Errorf("op %q on root path %q with value of type %T; expected map[string]any", opType, pathRaw, newValue)
-				}
-				// Clear existing doc and replace with new content
-				for k := range doc {
-					delete(doc, k)
-				}
-				for k, v := range newMapValue {
-					doc[k] = v
-				}
-				continue // Next operation
-			case "remove":
-				// Removing the root means clearing the map.
-				for k := range doc {
-					delete(doc, k)
-				}
-				continue
-			default:
-				// Other ops like "inc", "str_ins", "str_del" are not meaningful for the root map itself.
-				return fmt.Errorf("op %q on root path %q is not supported or not meaningful for a map document", opType, pathRaw)
+// applier holds the state shared by the operations of a single patch.
+type applier struct {
+	root    any
+	mapRoot map[string]any // set when the root must remain this map (Apply)
+	opts    Options
+	cache   *pathCache
+	appends map[string]int
+	// cow, when set, copies the containers each op writes into before it
+	// runs, so that the document passed in is left untouched.
+	cow *copyOnWrite
+	// segments, when set, is the path of the op being applied as decoded by
+	// Compile, and is resolved instead of the path itself.
+	segments []pathSegment
+	// pointers holds the paths already decoded for Options.Trusted.
+	pointers map[string][]pathSegment
+	// ctx, when set, stops the patch once it is done.
+	ctx context.Context
+}
+
+func newApplier(ctx context.Context, doc any, opts Options, operations []map[string]any) (*applier, error) {
+	if opts.MaxOps > 0 && len(operations) > opts.MaxOps {
+		return nil, errorf(ErrLimitExceeded, "patch has %d operations (limit %d)", len(operations), opts.MaxOps)
+	}
+	a := &applier{root: doc, opts: opts, ctx: ctx}
+	if opts.Report != nil {
+		*opts.Report = ApplyReport{}
+	}
+	// Patches with several ops frequently touch the same deep subtree, so
+	// containers resolved by one op are reused by the following ones.
+	if opts.Index != nil {
+		docMap, ok := doc.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("index requires a map document, got %T", doc)
+		}
+		var err error
+		if a.cache, err = opts.Index.cacheFor(docMap); err != nil {
+			return nil, err
+		}
+	}
+	if len(operations) > 1 {
+		if a.cache == nil {
+			a.cache = newPathCache()
+		}
+		a.appends = countAppends(operations)
+	}
+	return a, nil
+}
+
+// canceled returns ctx.Err() once the applier's context is done.
+func (a *applier) canceled() error {
+	if a.ctx == nil {
+		return nil
+	}
+	return a.ctx.Err()
+}
+
+func (a *applier) apply(operations []map[string]any) error {
+	var partial *PartialError
+	for i, op := range operations {
+		if err := a.canceled(); err != nil {
+			return newOpError(i, op, err)
+		}
+		var err error
+		if pathRaw, _ := op["path"].(string); a.opts.JSONPath && isJSONPath(pathRaw) {
+			err = a.applyJSONPath(i, op, pathRaw)
+		} else {
+			err = a.applyTarget(i, op)
+		}
+		if err == nil {
+			if partial != nil {
+				partial.Applied = append(partial.Applied, i)
+			}
+			continue
+		}
+		if !a.opts.ContinueOnError {
+			return newOpError(i, op, err)
+		}
+		if partial == nil {
+			partial = &PartialError{Total: len(operations)}
+			for j := range i {
+				partial.Applied = append(partial.Applied, j)
 			}
 		}
+		partial.Errors = append(partial.Errors, newOpError(i, op, err))
+	}
+	if partial != nil {
+		return partial
+	}
+	if a.opts.ValidateDocument != nil {
+		if err := a.opts.ValidateDocument(a.root); err != nil {
+			return errorf(ErrInvalidDocument, "patched document is invalid: %w", err)
+		}
+	}
+	return nil
+}
+
+// applyTarget applies op, the operation at index i or one of the
+// operations its JSONPath expands to.
+func (a *applier) applyTarget(i int, op map[string]any) error {
+	if a.opts.MaxPathDepth > 0 {
+		if err := a.checkPathDepth(op); err != nil {
+			return err
+		}
+	}
+	var event OpEvent
+	if a.opts.BeforeOp != nil || a.opts.AfterOp != nil {
+		event = a.opEvent(i, op)
+		if a.opts.BeforeOp != nil {
+			if err := a.opts.BeforeOp(event); err != nil {
+				return errorf(ErrOpRejected, "%q op at path %q rejected: %w", event.Op["op"], event.Path, err)
+			}
+		}
+	}
+	var changes []Change
+	if a.opts.Report != nil || a.opts.Audit != nil {
+		changes = a.beforeChange(op)
+	}
+	if a.cow != nil {
+		a.cow.before(op)
+	}
+	var err error
+	if a.opts.Timings && a.opts.Report != nil {
+		err = a.timeOp(i, op)
+	} else {
+		err = a.applyOp(op)
+	}
+	if err != nil {
+		return err
+	}
+	if a.cow != nil {
+		a.cow.after(op)
+	}
+	if changes != nil {
+		changes = a.afterChange(i, changes)
+		if a.opts.Report != nil {
+			a.opts.Report.Changes = append(a.opts.Report.Changes, changes...)
+		}
+		if a.opts.Audit != nil {
+			a.audit(i, op, changes)
+		}
+	}
+	if a.opts.AfterOp != nil {
+		event.New, _ = a.valueAt(event.Path)
+		a.opts.AfterOp(event)
+	}
+	return nil
+}
+
+// checkPathDepth fails ops whose path or from is deeper than
+// Options.MaxPathDepth.
+func (a *applier) checkPathDepth(op map[string]any) error {
+	for _, member := range []string{"path", "from"} {
+		pointer, _ := op[member].(string)
+		if depth := strings.Count(absolutePointer(pointer), "/"); depth > a.opts.MaxPathDepth {
+			return errorf(ErrLimitExceeded, "%q %q has %d segments (limit %d)", member, pointer, depth, a.opts.MaxPathDepth)
+		}
+	}
+	return nil
+}
+
+// checkArrayLength fails an opType op inserting at pathRaw into an array of
+// length elements when that would exceed Options.MaxArrayLength.
+func (a *applier) checkArrayLength(opType, pathRaw string, length int) error {
+	if a.opts.MaxArrayLength > 0 && length >= a.opts.MaxArrayLength {
+		return errorf(ErrLimitExceeded, "%q at path %q would make the array %d long (limit %d)", opType, pathRaw, length+1, a.opts.MaxArrayLength)
+	}
+	return nil
+}
+
+// assignSlice stores an updated slice in its parent container, replacing the
+// root when the slice is the document itself.
+func (a *applier) assignSlice(parent any, key string, index int, updated []any, op string) error {
+	if parent == nil && a.mapRoot == nil {
+		a.root = updated
+		return nil
+	}
+	return assignSliceToParent(parent, key, index, updated, op)
+}
+
+// moveTarget returns the path a move from fromRaw to pathRaw inserts at,
+// resolved against the document after the removal. With
+// MoveIndexBeforeRemoval, a later index in the same array is shifted down
+// by the removal.
+func (a *applier) moveTarget(fromRaw, pathRaw string) string {
+	if a.opts.MoveIndex != MoveIndexBeforeRemoval {
+		return pathRaw
+	}
+	fromSlash, pathSlash := strings.LastIndexByte(fromRaw, '/'), strings.LastIndexByte(pathRaw, '/')
+	if fromSlash < 0 || pathSlash < 0 || fromRaw[:fromSlash] != pathRaw[:pathSlash] {
+		return pathRaw
+	}
+	from, fromErr := strconv.Atoi(fromRaw[fromSlash+1:])
+	to, toErr := strconv.Atoi(pathRaw[pathSlash+1:])
+	if fromErr != nil || toErr != nil || from >= to || strconv.Itoa(to) != pathRaw[pathSlash+1:] {
+		return pathRaw
+	}
+	if parent, err := a.valueAt(pathRaw[:pathSlash]); err != nil {
+		return pathRaw
+	} else if _, ok := parent.([]any); !ok {
+		return pathRaw
+	}
+	return pathRaw[:pathSlash+1] + strconv.Itoa(to-1)
+}
+
+// decodedPath returns the segments of pathRaw, decoding it only the first
+// time a Trusted patch uses it. It returns nil for pointers that do not
+// decode, which are left for resolvePathCached to reject.
+func (a *applier) decodedPath(pathRaw string) []pathSegment {
+	if segments, ok := a.pointers[pathRaw]; ok {
+		return segments
+	}
+	segments, err := decodeSegments(pathRaw)
+	if err != nil {
+		return nil
+	}
+	if a.pointers == nil {
+		a.pointers = make(map[string][]pathSegment)
+	}
+	a.pointers[pathRaw] = segments
+	return segments
+}
+
+// valueAt returns the value stored at pathRaw.
+func (a *applier) valueAt(pathRaw string) (any, error) {
+	if pathRaw == "" {
+		return a.root, nil
+	}
+	parent, key, idx, _, _, _, err := resolvePathCached(a.root, pathRaw, a.cache)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := parent.(map[string]any); ok {
+		v, exists := m[key]
+		if !exists {
+			return nil, errorf(ErrPathNotFound, "path segment %q not found in map for path %q", key, pathRaw)
+		}
+		return v, nil
+	} else if s, ok := parent.([]any); ok {
+		if idx < 0 || idx >= len(s) {
+			return nil, errorf(ErrOutOfBounds, "index %d out of bounds for slice (len %d) at segment %q in path %q", idx, len(s), key, pathRaw)
+		}
+		return s[idx], nil
+	}
+	return nil, errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parent)
+}
+
+// checkDefined applies a defined or undefined op, asserting that pathRaw
+// does or does not refer to a value. A path whose parent is missing, or
+// goes through a value that is not a container, is undefined; a malformed
+// path is an error either way.
+func (a *applier) checkDefined(opType, pathRaw string) error {
+	_, err := a.valueAt(pathRaw)
+	if errors.Is(err, ErrInvalidPointer) {
+		return err
+	}
+	if (err == nil) != (opType == "defined") {
+		return errorf(ErrTestFailed, "%s operation failed at path %q", opType, pathRaw)
+	}
+	return nil
+}
+
+// checkType applies a type op, asserting that the value at pathRaw has the
+// JSON type named by the op's "value" member. "integer" names numbers
+// without a fractional part, which are also of type "number".
+func (a *applier) checkType(pathRaw string, op map[string]any) error {
+	name, _ := op["value"].(string)
+	if !isJSONType(name) {
+		return errorf(ErrInvalidOperation, "op %q %q field must name a JSON type for path %q", "type", "value", pathRaw)
+	}
+	value, err := a.valueAt(pathRaw)
+	if err != nil {
+		return err
+	}
+	actual := jsonType(value)
+	if actual != name && !(name == "integer" && actual == "number" && isWholeNumber(value)) {
+		return errorf(ErrTestFailed, "type operation failed at path %q: value is %s, not %s", pathRaw, actual, name)
+	}
+	return nil
+}
+
+// checkString applies a contains, starts, ends or matches op, asserting
+// that the string at pathRaw contains, starts with, ends with or matches
+// the op's "value" member, a regular expression for matches. With the op's
+// "ignore_case" member set, case is ignored. A value that is not a string
+// fails the op.
+func (a *applier) checkString(opType, pathRaw string, op map[string]any) error {
+	pattern, ok := op["value"].(string)
+	if !ok {
+		return errorf(ErrInvalidOperation, "op %q %q field must be a string for path %q", opType, "value", pathRaw)
+	}
+	ignoreCase := false
+	if v, present := op["ignore_case"]; present {
+		if ignoreCase, ok = v.(bool); !ok {
+			return errorf(ErrInvalidOperation, "op %q %q field must be a boolean for path %q", opType, "ignore_case", pathRaw)
+		}
+	}
+	var re *regexp.Regexp
+	if opType == "matches" {
+		if ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return errorf(ErrInvalidOperation, "op %q at path %q has an invalid regular expression: %w", opType, pathRaw, err)
+		}
+	}
+	value, err := a.valueAt(pathRaw)
+	if err != nil {
+		return err
+	}
+	s, ok := jsonForm(value).(string)
+	if !ok {
+		return errorf(ErrTestFailed, "%s operation failed at path %q: value is %s, not a string", opType, pathRaw, jsonType(value))
+	}
+	if ignoreCase && re == nil {
+		s, pattern = strings.ToLower(s), strings.ToLower(pattern)
+	}
+	switch opType {
+	case "contains":
+		ok = strings.Contains(s, pattern)
+	case "starts":
+		ok = strings.HasPrefix(s, pattern)
+	case "ends":
+		ok = strings.HasSuffix(s, pattern)
+	case "matches":
+		ok = re.MatchString(s)
+	}
+	if !ok {
+		return errorf(ErrTestFailed, "%s operation failed at path %q", opType, pathRaw)
+	}
+	return nil
+}
+
+// documentRef splits a from pointer of the form "name#/pointer" when
+// Options.Documents is set. Plain JSON Pointers start with "/" or are empty,
+// so they are never taken for references.
+func (a *applier) documentRef(fromRaw string) (name, pointer string, ok bool) {
+	if a.opts.Documents == nil || fromRaw == "" || strings.HasPrefix(fromRaw, "/") {
+		return "", "", false
+	}
+	return strings.Cut(fromRaw, "#")
+}
+
+// fromDocument returns the value at pointer in the document registered as
+// name, removing it from that document when take is set. Copies are made by
+// the caller.
+func (a *applier) fromDocument(name, pointer string, take bool) (any, error) {
+	doc, ok := a.opts.Documents[name]
+	if !ok {
+		return nil, errorf(ErrPathNotFound, "unknown document %q", name)
+	}
+	value, err := (&applier{root: doc}).valueAt(pointer)
+	if err != nil {
+		return nil, fmt.Errorf("document %q: %w", name, err)
+	}
+	if take {
+		updated, err := ApplyValue(doc, []map[string]any{{"op": "remove", "path": pointer}})
+		if err != nil {
+			return nil, fmt.Errorf("document %q: %w", name, err)
+		}
+		a.opts.Documents[name] = updated
+	}
+	return value, nil
+}
 
-		parentContainer, finalKey, finalIndex, containerParent, containerParentKey, containerParentIndex, err := resolvePath(doc, pathRaw)
+// applyMapRoot handles operations targeting the root of a map document, which
+// is cleared and refilled in place so the caller's map stays valid.
+func (a *applier) applyMapRoot(opType, pathRaw string, op map[string]any) error {
+	doc := a.mapRoot
+	switch opType {
+	case "replace", "add": // "add" on root is same as "replace" for a map document
+		newValue, valExists := op["value"]
+		if !valExists {
+			return errorf(ErrInvalidOperation, "op %q on root path %q requires a %q field", opType, pathRaw, "value")
+		}
+		newValue, err := a.sanitize(pathRaw, newValue)
 		if err != nil {
 			return err
 		}
+		newMapValue, newIsMap := newValue.(map[string]any)
+		if !newIsMap {
+			return errorf(ErrTypeMismatch, "op %q on root path %q with value of type %T; expected map[string]any", opType, pathRaw, newValue)
+		}
+		// Clear existing doc and replace with new content
+		for k := range doc {
+			delete(doc, k)
+		}
+		for k, v := range newMapValue {
+			doc[k] = v
+		}
+		a.cache.invalidate("")
+		return nil
+	case "remove":
+		// Removing the root means clearing the map.
+		for k := range doc {
+			delete(doc, k)
+		}
+		a.cache.invalidate("")
+		return nil
+	case "extend":
+		if err := a.extend(doc, pathRaw, op); err != nil {
+			return err
+		}
+		a.cache.invalidate("")
+		return nil
+	default:
+		// Other ops like "inc", "str_ins", "str_del" are not meaningful for the root map itself.
+		return errorf(ErrUnsupportedOp, "op %q on root path %q is not supported or not meaningful for a map document", opType, pathRaw)
+	}
+}
+
+// upsert reports whether a replace op adds a missing object key: the op's
+// boolean "upsert" member if it has one, and Options.Upsert otherwise.
+func (a *applier) upsert(op map[string]any) bool {
+	if upsert, ok := op["upsert"].(bool); ok {
+		return upsert
+	}
+	return a.opts.Upsert
+}
+
+// maxStringLength returns the limit on the length of the string at pathRaw,
+// or 0 if there is none.
+func (a *applier) maxStringLength(pathRaw string) int {
+	limit := 0
+	for pattern, max := range a.opts.MaxStringLengths {
+		if max > 0 && matchPointer(pattern, pathRaw) && (limit == 0 || max < limit) {
+			limit = max
+		}
+	}
+	if limit == 0 {
+		limit = a.opts.MaxStringLength
+	}
+	return limit
+}
+
+// matchPointer reports whether pathRaw matches pattern, in which a "*"
+// segment matches any single segment.
+func matchPointer(pattern, pathRaw string) bool {
+	if pattern == pathRaw {
+		return true
+	}
+	if strings.Count(pattern, "/") != strings.Count(pathRaw, "/") {
+		return false
+	}
+	patternSegments, pathSegments := strings.Split(pattern, "/"), strings.Split(pathRaw, "/")
+	for i, segment := range patternSegments {
+		if segment != "*" && segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
 
-		switch opType {
-		case "add":
-			value, ok := op["value"]
-			if !ok {
-				return fmt.Errorf("op %q missing %q field for path %q", "add", "value", pathRaw)
+// sanitize passes value, about to be written at pathRaw, through
+// Options.Sanitize.
+func (a *applier) sanitize(pathRaw string, value any) (any, error) {
+	if a.opts.Sanitize == nil {
+		return value, nil
+	}
+	return sanitizeValue(a.opts.Sanitize, pathRaw, value)
+}
+
+// sanitizeValue applies hook to the values inside value and then to value
+// itself. Containers are rebuilt rather than modified, since value may be
+// shared with the op.
+func sanitizeValue(hook func(string, any) (any, error), pathRaw string, value any) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		sanitized := make(map[string]any, len(v))
+		// Sorted, so that the first rejected member is reported consistently.
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			child, err := sanitizeValue(hook, pathRaw+"/"+pointerEscaper.Replace(key), v[key])
+			if err != nil {
+				return nil, err
 			}
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				targetMap[finalKey] = value
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				if finalIndex < 0 || finalIndex > len(targetSlice) {
-					return fmt.Errorf("index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, "add", pathRaw, len(targetSlice))
-				}
-				updatedSlice := insertValueIntoSlice(targetSlice, finalIndex, value)
-				if err := assignSliceToParent(containerParent, containerParentKey, containerParentIndex, updatedSlice, "add"); err != nil {
-					return err
-				}
-			} else {
-				return fmt.Errorf("path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+			sanitized[key] = child
+		}
+		value = sanitized
+	case []any:
+		sanitized := make([]any, len(v))
+		for i, element := range v {
+			child, err := sanitizeValue(hook, pathRaw+"/"+strconv.Itoa(i), element)
+			if err != nil {
+				return nil, err
 			}
+			sanitized[i] = child
+		}
+		value = sanitized
+	}
+	value, err := hook(pathRaw, value)
+	if err != nil {
+		return nil, errorf(ErrValueRejected, "value at path %q rejected: %w", pathRaw, err)
+	}
+	return value, nil
+}
 
-		case "remove":
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				if _, exists := targetMap[finalKey]; !exists {
-					return fmt.Errorf("path segment %q not found in map for path %q", finalKey, pathRaw)
-				}
-				delete(targetMap, finalKey)
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				if finalIndex < 0 || finalIndex >= len(targetSlice) {
-					return fmt.Errorf("index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, "remove", pathRaw, len(targetSlice))
-				}
-				updatedSlice, _ := removeValueFromSlice(targetSlice, finalIndex)
-				if err := assignSliceToParent(containerParent, containerParentKey, containerParentIndex, updatedSlice, "remove"); err != nil {
-					return err
-				}
-			} else {
-				return fmt.Errorf("path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// applyValueRoot handles root operations that replace or remove the whole
+// document. It reports false for ops that act on the root value in place.
+func (a *applier) applyValueRoot(opType, pathRaw string, op map[string]any) (bool, error) {
+	switch opType {
+	case "add", "replace":
+		value, ok := op["value"]
+		if !ok {
+			return true, errorf(ErrInvalidOperation, "op %q on root path %q requires a %q field", opType, pathRaw, "value")
+		}
+		value, err := a.sanitize(pathRaw, value)
+		if err != nil {
+			return true, err
+		}
+		a.root = value
+	case "remove":
+		a.root = nil
+	case "copy", "move":
+		fromRaw, ok := op["from"].(string)
+		if !ok {
+			return true, errorf(ErrInvalidOperation, "op %q missing %q field for path %q", opType, "from", pathRaw)
+		}
+		var value any
+		var err error
+		if name, pointer, ok := a.documentRef(fromRaw); ok {
+			if value, err = a.fromDocument(name, pointer, opType == "move"); opType == "copy" {
+				value = deepCopyValue(value)
 			}
+		} else {
+			value, err = a.valueAt(fromRaw)
+		}
+		if err == nil && opType == "copy" {
+			value, err = a.sanitize(pathRaw, value)
+		}
+		if err != nil {
+			return true, err
+		}
+		a.root = value
+	default:
+		return false, nil
+	}
+	a.cache.invalidate("")
+	return true, nil
+}
+
+func (a *applier) applyOp(op map[string]any) error {
+	opType, opTypeOk := op["op"].(string)
+	pathRaw, pathRawOk := op["path"].(string)
+
+	if !opTypeOk || !pathRawOk {
+		return errorf(ErrInvalidOperation, "invalid op format: op missing or not a string, or path missing or not a string: %+v", op)
+	}
+
+	switch opType {
+	case "defined", "undefined":
+		return a.checkDefined(opType, pathRaw)
+	case "type":
+		return a.checkType(pathRaw, op)
+	case "contains", "starts", "ends", "matches":
+		return a.checkString(opType, pathRaw, op)
+	}
+
+	var parentContainer, containerParent any
+	var finalKey, containerParentKey string
+	var finalIndex, containerParentIndex int
+	var rootHolder []any
+
+	// Handle operations on the root document itself.
+	if pathRaw == "" {
+		if a.mapRoot != nil {
+			return a.applyMapRoot(opType, pathRaw, op)
+		}
+		if handled, err := a.applyValueRoot(opType, pathRaw, op); handled {
+			return err
+		}
+		// Remaining ops edit the root value itself, so it is wrapped in a
+		// single-element holder that the op cases below treat like any slice.
+		rootHolder = []any{a.root}
+		parentContainer = rootHolder
+	} else if opType != "move" {
+		// A move resolves its path once its value has left the source,
+		// which may shift the indices along the path.
+		var err error
+		segments := a.segments
+		if segments == nil && a.opts.Trusted {
+			segments = a.decodedPath(pathRaw)
+		}
+		if segments != nil {
+			parentContainer, finalKey, finalIndex, containerParent, containerParentKey, containerParentIndex, err = resolveSegments(a.root, pathRaw, segments)
+		} else {
+			parentContainer, finalKey, finalIndex, containerParent, containerParentKey, containerParentIndex, err = resolvePathCached(a.root, pathRaw, a.cache)
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-		case "replace":
-			value, valueExists := op["value"]
-			if !valueExists {
-				return fmt.Errorf("op %q missing %q field for path %q", "replace", "value", pathRaw)
+	switch opType {
+	case "add":
+		value, ok := op["value"]
+		if !ok {
+			return errorf(ErrInvalidOperation, "op %q missing %q field for path %q", "add", "value", pathRaw)
+		}
+		value, err := a.sanitize(pathRaw, value)
+		if err != nil {
+			return err
+		}
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			targetMap[finalKey] = value
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			if finalIndex < 0 || finalIndex > len(targetSlice) {
+				return errorf(ErrOutOfBounds, "index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, "add", pathRaw, len(targetSlice))
 			}
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				if _, exists := targetMap[finalKey]; !exists {
-					return fmt.Errorf("path segment %q not found in map for path %q", finalKey, pathRaw)
-				}
-				targetMap[finalKey] = value
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				if finalIndex < 0 || finalIndex >= len(targetSlice) {
-					return fmt.Errorf("index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, "replace", pathRaw, len(targetSlice))
-				}
-				targetSlice[finalIndex] = value
-			} else {
-				return fmt.Errorf("path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+			if err := a.checkArrayLength("add", pathRaw, len(targetSlice)); err != nil {
+				return err
 			}
-
-		case "str_ins":
-			posAny, posPresent := op["pos"]
-			strToInsert, strOk := op["str"].(string)
-			posFloat, posOk := getNumericValue(posAny)
-			if !posPresent || !posOk || !strOk {
-				return fmt.Errorf("invalid %q op parameters (pos/str missing or wrong type) for path %q", "str_ins", pathRaw)
+			if finalIndex == len(targetSlice) {
+				targetSlice = reserveAppends(targetSlice, a.appends, pathRaw)
 			}
-			var currentString string
-			var getStringOk bool
-			var valAtPathForError any
-
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				if val, exists := targetMap[finalKey]; exists {
-					currentString, getStringOk = val.(string)
-					valAtPathForError = val
-				} else {
-					return fmt.Errorf("target key %q for %q not found in map at path %q", finalKey, "str_ins", pathRaw)
-				}
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				if finalIndex >= 0 && finalIndex < len(targetSlice) {
-					currentString, getStringOk = targetSlice[finalIndex].(string)
-					valAtPathForError = targetSlice[finalIndex]
-				} else {
-					return fmt.Errorf("index %d out of bounds for %q (getting string) at path %q", finalIndex, "str_ins", pathRaw)
-				}
-			} else {
-				return fmt.Errorf("parent for %q op at path %q is not a map or slice (type %T)", "str_ins", pathRaw, parentContainer)
+			updatedSlice := insertValueIntoSlice(targetSlice, finalIndex, value)
+			if err := a.assignSlice(containerParent, containerParentKey, containerParentIndex, updatedSlice, "add"); err != nil {
+				return err
 			}
+		} else {
+			return errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+		}
 
-			if !getStringOk {
-				return fmt.Errorf("target of %q at path %q is not a string (actual type: %T, value: %+v)", "str_ins", pathRaw, valAtPathForError, valAtPathForError)
+	case "remove":
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			if _, exists := targetMap[finalKey]; !exists {
+				return errorf(ErrPathNotFound, "path segment %q not found in map for path %q", finalKey, pathRaw)
 			}
-
-			if int(posFloat) > utf16Length(currentString) {
-				return fmt.Errorf("invalid %q %d for %q (string len %d) on path %q", "pos", int(posFloat), "str_ins", utf16Length(currentString), pathRaw)
+			delete(targetMap, finalKey)
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			if finalIndex < 0 || finalIndex >= len(targetSlice) {
+				return errorf(ErrOutOfBounds, "index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, "remove", pathRaw, len(targetSlice))
 			}
-			pos := utf16OffsetToRuneIndex(currentString, int(posFloat))
-			runes := []rune(currentString)
-			if pos < 0 || pos > len(runes) {
-				return fmt.Errorf("invalid %q %d for %q (string len %d) on path %q", "pos", pos, "str_ins", len(runes), pathRaw)
+			updatedSlice, _ := removeValueFromSlice(targetSlice, finalIndex)
+			if err := a.assignSlice(containerParent, containerParentKey, containerParentIndex, updatedSlice, "remove"); err != nil {
+				return err
 			}
-			resultStr := string(runes[:pos]) + strToInsert + string(runes[pos:])
+		} else {
+			return errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+		}
 
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				targetMap[finalKey] = resultStr
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				targetSlice[finalIndex] = resultStr
+	case "replace":
+		value, valueExists := op["value"]
+		if !valueExists {
+			return errorf(ErrInvalidOperation, "op %q missing %q field for path %q", "replace", "value", pathRaw)
+		}
+		value, err := a.sanitize(pathRaw, value)
+		if err != nil {
+			return err
+		}
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			if _, exists := targetMap[finalKey]; !exists && !a.upsert(op) {
+				return errorf(ErrPathNotFound, "path segment %q not found in map for path %q", finalKey, pathRaw)
 			}
-
-		case "str_del":
-			posAny, posPresent := op["pos"]
-			strToDelete, strPresent := op["str"].(string)
-			lenAny, lenPresent := op["len"]
-			posFloat, posOk := getNumericValue(posAny)
-
-			if !posPresent || !posOk {
-				return fmt.Errorf("invalid %q op parameters (pos missing or wrong type) for path %q", "str_del", pathRaw)
+			targetMap[finalKey] = value
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			if finalIndex < 0 || finalIndex >= len(targetSlice) {
+				return errorf(ErrOutOfBounds, "index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, "replace", pathRaw, len(targetSlice))
 			}
+			targetSlice[finalIndex] = value
+		} else {
+			return errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+		}
 
-			var currentString string
-			var getStringOk bool
-			var valAtPathForError any
+	case "str_ins":
+		posAny, posPresent := op["pos"]
+		strToInsert, strOk := op["str"].(string)
+		posFloat, posOk := getNumericValue(posAny)
+		if !posPresent || !posOk || !strOk {
+			return errorf(ErrInvalidOperation, "invalid %q op parameters (pos/str missing or wrong type) for path %q", "str_ins", pathRaw)
+		}
+		var currentString string
+		var getStringOk bool
+		var valAtPathForError any
 
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				if val, exists := targetMap[finalKey]; exists {
-					currentString, getStringOk = val.(string)
-					valAtPathForError = val
-				} else {
-					return fmt.Errorf("target key %q for %q not found in map at path %q", finalKey, "str_del", pathRaw)
-				}
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				if finalIndex >= 0 && finalIndex < len(targetSlice) {
-					currentString, getStringOk = targetSlice[finalIndex].(string)
-					valAtPathForError = targetSlice[finalIndex]
-				} else {
-					return fmt.Errorf("index %d out of bounds for %q (getting string) at path %q", finalIndex, "str_del", pathRaw)
-				}
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			if val, exists := targetMap[finalKey]; exists {
+				currentString, getStringOk = val.(string)
+				valAtPathForError = val
 			} else {
-				return fmt.Errorf("parent for %q op at path %q is not a map or slice (type %T)", "str_del", pathRaw, parentContainer)
+				return errorf(ErrPathNotFound, "target key %q for %q not found in map at path %q", finalKey, "str_ins", pathRaw)
 			}
-
-			if !getStringOk {
-				return fmt.Errorf("target of %q at path %q is not a string (actual type: %T, value: %+v)", "str_del", pathRaw, valAtPathForError, valAtPathForError)
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			if finalIndex >= 0 && finalIndex < len(targetSlice) {
+				currentString, getStringOk = targetSlice[finalIndex].(string)
+				valAtPathForError = targetSlice[finalIndex]
+			} else {
+				return errorf(ErrOutOfBounds, "index %d out of bounds for %q (getting string) at path %q", finalIndex, "str_ins", pathRaw)
 			}
+		} else {
+			return errorf(ErrTypeMismatch, "parent for %q op at path %q is not a map or slice (type %T)", "str_ins", pathRaw, parentContainer)
+		}
+
+		if !getStringOk {
+			return errorf(ErrTypeMismatch, "target of %q at path %q is not a string (actual type: %T, value: %+v)", "str_ins", pathRaw, valAtPathForError, valAtPathForError)
+		}
 
-			if int(posFloat) > utf16Length(currentString) {
-				return fmt.Errorf("invalid %q %d or %q %v for %q (string len %d) on path %q", "pos", int(posFloat), "len", lenAny, "str_del", utf16Length(currentString), pathRaw)
+		indexing := a.indexing()
+		if int(posFloat) > indexing.Len(currentString) {
+			return errorf(ErrOutOfBounds, "invalid %q %d for %q (string len %d) on path %q", "pos", int(posFloat), "str_ins", indexing.Len(currentString), pathRaw)
+		}
+		if limit := a.opts.MaxInsertLength; limit > 0 && indexing.Len(strToInsert) > limit {
+			return errorf(ErrLimitExceeded, "%q at path %q inserts a string %d long (limit %d)", "str_ins", pathRaw, indexing.Len(strToInsert), limit)
+		}
+		if limit := a.maxStringLength(pathRaw); limit > 0 {
+			if length := indexing.Len(currentString) + indexing.Len(strToInsert); length > limit {
+				return errorf(ErrStringTooLong, "%q at path %q would make the string %d long (limit %d)", "str_ins", pathRaw, length, limit)
 			}
+		}
+		offset := indexing.Offset(currentString, int(posFloat))
+		resultStr := currentString[:offset] + strToInsert + currentString[offset:]
 
-			pos := utf16OffsetToRuneIndex(currentString, int(posFloat))
-			var length int
-			if strPresent {
-				length = len([]rune(strToDelete))
-			} else if lenPresent {
-				lenFloat, lenOk := getNumericValue(lenAny)
-				if !lenOk {
-					return fmt.Errorf("invalid %q op parameters (len wrong type) for path %q", "str_del", pathRaw)
-				}
-				length = utf16LenToRuneLen(currentString, int(posFloat), int(lenFloat))
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			targetMap[finalKey] = resultStr
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			targetSlice[finalIndex] = resultStr
+		}
+
+	case "str_del":
+		posAny, posPresent := op["pos"]
+		strToDelete, strPresent := op["str"].(string)
+		lenAny, lenPresent := op["len"]
+		posFloat, posOk := getNumericValue(posAny)
+
+		if !posPresent || !posOk {
+			return errorf(ErrInvalidOperation, "invalid %q op parameters (pos missing or wrong type) for path %q", "str_del", pathRaw)
+		}
+
+		var currentString string
+		var getStringOk bool
+		var valAtPathForError any
+
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			if val, exists := targetMap[finalKey]; exists {
+				currentString, getStringOk = val.(string)
+				valAtPathForError = val
 			} else {
-				return fmt.Errorf("invalid %q op parameters (str or len required) for path %q", "str_del", pathRaw)
+				return errorf(ErrPathNotFound, "target key %q for %q not found in map at path %q", finalKey, "str_del", pathRaw)
 			}
-
-			runes := []rune(currentString)
-			if pos < 0 || length < 0 || pos+length > len(runes) {
-				return fmt.Errorf("invalid %q %d or %q %d for %q (string len %d) on path %q", "pos", pos, "len", length, "str_del", len(runes), pathRaw)
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			if finalIndex >= 0 && finalIndex < len(targetSlice) {
+				currentString, getStringOk = targetSlice[finalIndex].(string)
+				valAtPathForError = targetSlice[finalIndex]
+			} else {
+				return errorf(ErrOutOfBounds, "index %d out of bounds for %q (getting string) at path %q", finalIndex, "str_del", pathRaw)
 			}
-			resultStr := string(runes[:pos]) + string(runes[pos+length:])
+		} else {
+			return errorf(ErrTypeMismatch, "parent for %q op at path %q is not a map or slice (type %T)", "str_del", pathRaw, parentContainer)
+		}
 
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				targetMap[finalKey] = resultStr
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				targetSlice[finalIndex] = resultStr
-			}
+		if !getStringOk {
+			return errorf(ErrTypeMismatch, "target of %q at path %q is not a string (actual type: %T, value: %+v)", "str_del", pathRaw, valAtPathForError, valAtPathForError)
+		}
+
+		indexing := a.indexing()
+		if int(posFloat) > indexing.Len(currentString) {
+			return errorf(ErrOutOfBounds, "invalid %q %d or %q %v for %q (string len %d) on path %q", "pos", int(posFloat), "len", lenAny, "str_del", indexing.Len(currentString), pathRaw)
+		}
 
-		case "inc":
-			incValueFromOp, incFieldExists := op["inc"]
-			if !incFieldExists {
-				return fmt.Errorf("op %q missing %q field for path %q", "inc", "inc", pathRaw)
+		start := indexing.Offset(currentString, int(posFloat))
+		end := start
+		if strPresent {
+			// The text to delete is counted in code points, whatever the
+			// indexing, and must fit in what follows pos.
+			var fits bool
+			if end, fits = advanceRunes(currentString, start, utf8.RuneCountInString(strToDelete)); !fits {
+				return errorf(ErrOutOfBounds, "invalid %q %d or %q %q for %q (string len %d) on path %q", "pos", int(posFloat), "str", strToDelete, "str_del", indexing.Len(currentString), pathRaw)
+			}
+		} else if lenPresent {
+			lenFloat, lenOk := getNumericValue(lenAny)
+			if !lenOk {
+				return errorf(ErrInvalidOperation, "invalid %q op parameters (len wrong type) for path %q", "str_del", pathRaw)
 			}
-			incOpValFloat, incOpValIsNumber := getNumericValue(incValueFromOp)
-			if !incOpValIsNumber {
-				return fmt.Errorf("op %q %q field is not a recognized number (got %T) for path %q", "inc", "inc", incValueFromOp, pathRaw)
+			if lenFloat > 0 {
+				end = indexing.Offset(currentString, int(posFloat)+int(lenFloat))
 			}
+		} else {
+			return errorf(ErrInvalidOperation, "invalid %q op parameters (str or len required) for path %q", "str_del", pathRaw)
+		}
+		resultStr := currentString[:start] + currentString[end:]
 
-			var currentValue any
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			targetMap[finalKey] = resultStr
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			targetSlice[finalIndex] = resultStr
+		}
 
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				val, exists := targetMap[finalKey]
-				if !exists {
-					return fmt.Errorf("target key %q for %q not found in map at path %q", finalKey, "inc", pathRaw)
-				}
-				currentValue = val
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				if finalIndex < 0 || finalIndex >= len(targetSlice) {
-					return fmt.Errorf("index %d out of bounds for %q at path %q (slice len %d)", finalIndex, "inc", pathRaw, len(targetSlice))
-				}
-				currentValue = targetSlice[finalIndex]
-			} else {
-				return fmt.Errorf("parent container for %q at path %q is neither a map nor a slice (type %T)", "inc", pathRaw, parentContainer)
+	case "inc":
+		incValueFromOp, incFieldExists := op["inc"]
+		if !incFieldExists {
+			return errorf(ErrInvalidOperation, "op %q missing %q field for path %q", "inc", "inc", pathRaw)
+		}
+		incOpValFloat, incOpValIsNumber := getNumericValue(incValueFromOp)
+		if !incOpValIsNumber {
+			return errorf(ErrInvalidOperation, "op %q %q field is not a recognized number (got %T) for path %q", "inc", "inc", incValueFromOp, pathRaw)
+		}
+
+		var currentValue any
+
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			val, exists := targetMap[finalKey]
+			if !exists {
+				return errorf(ErrPathNotFound, "target key %q for %q not found in map at path %q", finalKey, "inc", pathRaw)
 			}
+			currentValue = val
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			if finalIndex < 0 || finalIndex >= len(targetSlice) {
+				return errorf(ErrOutOfBounds, "index %d out of bounds for %q at path %q (slice len %d)", finalIndex, "inc", pathRaw, len(targetSlice))
+			}
+			currentValue = targetSlice[finalIndex]
+		} else {
+			return errorf(ErrTypeMismatch, "parent container for %q at path %q is neither a map nor a slice (type %T)", "inc", pathRaw, parentContainer)
+		}
 
-			currentNumAsFloat, successfullyReadCurrentValue := getNumericValue(currentValue)
-			if !successfullyReadCurrentValue {
-				var targetIdentifier string
-				if finalKey != "" {
-					targetIdentifier = fmt.Sprintf("key %q", finalKey)
-				} else {
-					targetIdentifier = fmt.Sprintf("index %d", finalIndex)
-				}
-				return fmt.Errorf("target %s of %q at path %q is not a number. Value: %+v, Type: %T", targetIdentifier, "inc", pathRaw, currentValue, currentValue)
+		currentNumAsFloat, successfullyReadCurrentValue := getNumericValue(currentValue)
+		if !successfullyReadCurrentValue {
+			var targetIdentifier string
+			if finalKey != "" {
+				targetIdentifier = fmt.Sprintf("key %q", finalKey)
+			} else {
+				targetIdentifier = fmt.Sprintf("index %d", finalIndex)
 			}
+			return errorf(ErrTypeMismatch, "target %s of %q at path %q is not a number. Value: %+v, Type: %T", targetIdentifier, "inc", pathRaw, currentValue, currentValue)
+		}
 
-			incrementedResult := currentNumAsFloat + incOpValFloat
-			finalValueToStore := int(incrementedResult)
+		finalValueToStore := incSum(currentValue, incValueFromOp, currentNumAsFloat+incOpValFloat, a.opts.IncTyping)
 
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				targetMap[finalKey] = finalValueToStore
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				targetSlice[finalIndex] = finalValueToStore
-			}
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			targetMap[finalKey] = finalValueToStore
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			targetSlice[finalIndex] = finalValueToStore
+		}
 
-		case "copy":
-			fromRaw, ok := op["from"].(string)
-			if !ok {
-				return fmt.Errorf("op %q missing %q field for path %q", "copy", "from", pathRaw)
+	case "copy":
+		fromRaw, ok := op["from"].(string)
+		if !ok {
+			return errorf(ErrInvalidOperation, "op %q missing %q field for path %q", "copy", "from", pathRaw)
+		}
+		var valToCopy any
+		var err error
+		if name, pointer, ok := a.documentRef(fromRaw); ok {
+			valToCopy, err = a.fromDocument(name, pointer, false)
+		} else {
+			valToCopy, err = a.valueAt(fromRaw)
+		}
+		if err != nil {
+			return err
+		}
+		// The copy must not share containers with its source, or later ops
+		// on either would show up in both (and copying a container into
+		// itself would create a cycle).
+		valToCopy = deepCopyValue(valToCopy)
+		if valToCopy, err = a.sanitize(pathRaw, valToCopy); err != nil {
+			return err
+		}
+
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			targetMap[finalKey] = valToCopy
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			if finalIndex < 0 || finalIndex > len(targetSlice) {
+				return errorf(ErrOutOfBounds, "index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, "copy", pathRaw, len(targetSlice))
 			}
-			fromParent, fromKey, fromIdx, _, _, _, err := resolvePath(doc, fromRaw)
-			if err != nil {
+			if err := a.checkArrayLength("copy", pathRaw, len(targetSlice)); err != nil {
 				return err
 			}
-			var valToCopy any
-			if fromMap, ok := fromParent.(map[string]any); ok {
-				v, exists := fromMap[fromKey]
-				if !exists {
-					return fmt.Errorf("path segment %q not found in map for path %q", fromKey, fromRaw)
-				}
-				valToCopy = v
-			} else if fromSlice, ok := fromParent.([]any); ok {
-				if fromIdx < 0 || fromIdx >= len(fromSlice) {
-					return fmt.Errorf("index %d out of bounds for slice (len %d) at segment %q in path %q", fromIdx, len(fromSlice), fromKey, fromRaw)
-				}
-				valToCopy = fromSlice[fromIdx]
-			} else {
-				return fmt.Errorf("path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", fromRaw, fromParent)
-			}
-
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				targetMap[finalKey] = valToCopy
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				if finalIndex < 0 || finalIndex > len(targetSlice) {
-					return fmt.Errorf("index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, "copy", pathRaw, len(targetSlice))
-				}
-				updatedSlice := insertValueIntoSlice(targetSlice, finalIndex, valToCopy)
-				if err := assignSliceToParent(containerParent, containerParentKey, containerParentIndex, updatedSlice, "copy"); err != nil {
-					return err
-				}
-			} else {
-				return fmt.Errorf("path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+			updatedSlice := insertValueIntoSlice(targetSlice, finalIndex, valToCopy)
+			if err := a.assignSlice(containerParent, containerParentKey, containerParentIndex, updatedSlice, "copy"); err != nil {
+				return err
 			}
+		} else {
+			return errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+		}
 
-		case "move":
-			fromRaw, ok := op["from"].(string)
-			if !ok {
-				return fmt.Errorf("op %q missing %q field for path %q", "move", "from", pathRaw)
+	case "move":
+		fromRaw, ok := op["from"].(string)
+		if !ok {
+			return errorf(ErrInvalidOperation, "op %q missing %q field for path %q", "move", "from", pathRaw)
+		}
+		var valToMove any
+		var err error
+		// undo puts a value taken from the document back, when it cannot be
+		// inserted at the target.
+		undo := func() {}
+		targetRaw := pathRaw
+		if name, pointer, ok := a.documentRef(fromRaw); ok {
+			if valToMove, err = a.fromDocument(name, pointer, true); err != nil {
+				return err
 			}
-			if strings.HasPrefix(pathRaw+"/", fromRaw+"/") {
-				return fmt.Errorf("from path %q is a proper prefix of path %q", fromRaw, pathRaw)
+		} else {
+			if fromRaw != pathRaw && strings.HasPrefix(pathRaw+"/", fromRaw+"/") {
+				return errorf(ErrInvalidOperation, "from path %q is a proper prefix of path %q", fromRaw, pathRaw)
 			}
-			fromParent, fromKey, fromIdx, fromContainerParent, fromContainerKey, fromContainerIndex, err := resolvePath(doc, fromRaw)
+			targetRaw = a.moveTarget(fromRaw, pathRaw)
+			fromParent, fromKey, fromIdx, fromContainerParent, fromContainerKey, fromContainerIndex, err := resolvePathCached(a.root, fromRaw, a.cache)
 			if err != nil {
 				return err
 			}
-			var valToMove any
 			if fromMap, ok := fromParent.(map[string]any); ok {
 				v, exists := fromMap[fromKey]
 				if !exists {
-					return fmt.Errorf("path segment %q not found in map for path %q", fromKey, fromRaw)
+					return errorf(ErrPathNotFound, "path segment %q not found in map for path %q", fromKey, fromRaw)
 				}
 				valToMove = v
 				delete(fromMap, fromKey)
+				undo = func() { fromMap[fromKey] = v }
 			} else if fromSlice, ok := fromParent.([]any); ok {
 				if fromIdx < 0 || fromIdx >= len(fromSlice) {
-					return fmt.Errorf("index %d out of bounds for slice (len %d) at segment %q in path %q", fromIdx, len(fromSlice), fromKey, fromRaw)
+					return errorf(ErrOutOfBounds, "index %d out of bounds for slice (len %d) at segment %q in path %q", fromIdx, len(fromSlice), fromKey, fromRaw)
 				}
 				updatedFrom, removed := removeValueFromSlice(fromSlice, fromIdx)
 				valToMove = removed
-				if err := assignSliceToParent(fromContainerParent, fromContainerKey, fromContainerIndex, updatedFrom, "move"); err != nil {
+				if err := a.assignSlice(fromContainerParent, fromContainerKey, fromContainerIndex, updatedFrom, "move"); err != nil {
 					return err
 				}
+				undo = func() {
+					a.assignSlice(fromContainerParent, fromContainerKey, fromContainerIndex, insertValueIntoSlice(updatedFrom, fromIdx, removed), "move")
+					a.cache.invalidateTarget(fromRaw, fromParent)
+				}
 			} else {
-				return fmt.Errorf("path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", fromRaw, fromParent)
+				return errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", fromRaw, fromParent)
 			}
+			a.cache.invalidateTarget(fromRaw, fromParent)
+		}
 
-			parentContainer, finalKey, finalIndex, containerParent, containerParentKey, containerParentIndex, err = resolvePath(doc, pathRaw)
-			if err != nil {
+		parentContainer, finalKey, finalIndex, containerParent, containerParentKey, containerParentIndex, err = resolvePathCached(a.root, targetRaw, a.cache)
+		if err != nil {
+			undo()
+			return err
+		}
+
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			targetMap[finalKey] = valToMove
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			if finalIndex < 0 || finalIndex > len(targetSlice) {
+				undo()
+				return errorf(ErrOutOfBounds, "index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, "move", pathRaw, len(targetSlice))
+			}
+			if err := a.checkArrayLength("move", pathRaw, len(targetSlice)); err != nil {
+				undo()
 				return err
 			}
-
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				targetMap[finalKey] = valToMove
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				if finalIndex < 0 || finalIndex > len(targetSlice) {
-					return fmt.Errorf("index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, "move", pathRaw, len(targetSlice))
-				}
-				updatedSlice := insertValueIntoSlice(targetSlice, finalIndex, valToMove)
-				if err := assignSliceToParent(containerParent, containerParentKey, containerParentIndex, updatedSlice, "move"); err != nil {
-					return err
-				}
-			} else {
-				return fmt.Errorf("path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+			updatedSlice := insertValueIntoSlice(targetSlice, finalIndex, valToMove)
+			if err := a.assignSlice(containerParent, containerParentKey, containerParentIndex, updatedSlice, "move"); err != nil {
+				undo()
+				return err
 			}
+		} else {
+			undo()
+			return errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+		}
 
-		case "test":
-			value, ok := op["value"]
-			if !ok {
-				return fmt.Errorf("op %q missing %q field for path %q", "test", "value", pathRaw)
+	case "test", "less", "more", "in":
+		value, ok := op["value"]
+		if !ok {
+			return errorf(ErrInvalidOperation, "op %q missing %q field for path %q", opType, "value", pathRaw)
+		}
+		values, isArray := value.([]any)
+		if opType == "in" && !isArray {
+			return errorf(ErrInvalidOperation, "op %q %q field must be an array for path %q", opType, "value", pathRaw)
+		}
+		var currentVal any
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			v, exists := targetMap[finalKey]
+			if !exists {
+				return errorf(ErrPathNotFound, "path segment %q not found in map for path %q", finalKey, pathRaw)
 			}
-			var currentVal any
-			if targetMap, ok := parentContainer.(map[string]any); ok {
-				v, exists := targetMap[finalKey]
-				if !exists {
-					return fmt.Errorf("path segment %q not found in map for path %q", finalKey, pathRaw)
-				}
-				currentVal = v
-			} else if targetSlice, ok := parentContainer.([]any); ok {
-				if finalIndex < 0 || finalIndex >= len(targetSlice) {
-					return fmt.Errorf("index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, "test", pathRaw, len(targetSlice))
-				}
-				currentVal = targetSlice[finalIndex]
-			} else {
-				return fmt.Errorf("path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+			currentVal = v
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			if finalIndex < 0 || finalIndex >= len(targetSlice) {
+				return errorf(ErrOutOfBounds, "index %d out of bounds for %q op at path %q (slice len %d)", finalIndex, opType, pathRaw, len(targetSlice))
+			}
+			currentVal = targetSlice[finalIndex]
+		} else {
+			return errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+		}
+		eq := equality{timestamps: a.opts.Timestamps, numbers: a.opts.Numbers}
+		if opType == "test" {
+			if !eq.equal(currentVal, value) {
+				return errorf(ErrTestFailed, "test operation failed at path %q", pathRaw)
 			}
-			if !jsonEqual(currentVal, value) {
-				return fmt.Errorf("test operation failed at path %q", pathRaw)
+			break
+		}
+		if opType == "in" {
+			if !slices.ContainsFunc(values, func(v any) bool { return eq.equal(currentVal, v) }) {
+				return errorf(ErrTestFailed, "in operation failed at path %q", pathRaw)
 			}
+			break
+		}
+		order, ok := compareValues(currentVal, value, a.opts.Timestamps)
+		if !ok {
+			return errorf(ErrTypeMismatch, "%q op at path %q cannot order %T and %T", opType, pathRaw, currentVal, value)
+		}
+		if (opType == "less" && order >= 0) || (opType == "more" && order <= 0) {
+			return errorf(ErrTestFailed, "%s operation failed at path %q", opType, pathRaw)
+		}
 
-		default:
-			return fmt.Errorf("unhandled op type %q for path %q", opType, pathRaw)
+	case "extend":
+		var target any
+		if targetMap, ok := parentContainer.(map[string]any); ok {
+			val, exists := targetMap[finalKey]
+			if !exists {
+				return errorf(ErrPathNotFound, "target key %q for %q not found in map at path %q", finalKey, "extend", pathRaw)
+			}
+			target = val
+		} else if targetSlice, ok := parentContainer.([]any); ok {
+			if finalIndex < 0 || finalIndex >= len(targetSlice) {
+				return errorf(ErrOutOfBounds, "index %d out of bounds for %q at path %q (slice len %d)", finalIndex, "extend", pathRaw, len(targetSlice))
+			}
+			target = targetSlice[finalIndex]
+		} else {
+			return errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) before final segment; parent is type %T", pathRaw, parentContainer)
+		}
+		targetObject, ok := target.(map[string]any)
+		if !ok {
+			return errorf(ErrTypeMismatch, "target of %q at path %q is not an object (actual type: %T)", "extend", pathRaw, target)
 		}
+		if err := a.extend(targetObject, pathRaw, op); err != nil {
+			return err
+		}
+
+	default:
+		return errorf(ErrUnsupportedOp, "unhandled op type %q for path %q", opType, pathRaw)
+	}
+
+	switch opType {
+	case "test", "less", "more", "in", "inc", "str_ins", "str_del":
+		// These ops never replace a container, so cached entries stay valid.
+	default:
+		a.cache.invalidateTarget(pathRaw, parentContainer)
+	}
+	if rootHolder != nil {
+		a.root = rootHolder[0]
 	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package jsonpatch
 
 import (
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -133,3 +134,117 @@ func BenchmarkApplyMixedOperations(b *testing.B) {
 
 	benchmarkApply(b, base, ops)
 }
+
+func BenchmarkApplyDeepSubtree(b *testing.B) {
+	const depth = 12
+	leaf := map[string]any{}
+	for i := 0; i < 8; i++ {
+		leaf["field"+strconv.Itoa(i)] = i
+	}
+	base := leaf
+	path := ""
+	for i := depth - 1; i >= 0; i-- {
+		base = map[string]any{"level" + strconv.Itoa(i): base}
+	}
+	for i := 0; i < depth; i++ {
+		path += "/level" + strconv.Itoa(i)
+	}
+
+	ops := make([]map[string]any, 0, 8)
+	for i := 0; i < 8; i++ {
+		ops = append(ops, map[string]any{"op": "inc", "path": path + "/field" + strconv.Itoa(i), "inc": 1})
+	}
+
+	benchmarkApply(b, base, ops)
+}
+
+func BenchmarkApplyBulkAppend(b *testing.B) {
+	base := map[string]any{
+		"list": []any{},
+	}
+
+	ops := make([]map[string]any, 0, 256)
+	for i := 0; i < 256; i++ {
+		ops = append(ops, map[string]any{"op": "add", "path": "/list/-", "value": i})
+	}
+
+	benchmarkApply(b, base, ops)
+}
+
+func BenchmarkApplyIndexedDeepDocument(b *testing.B) {
+	doc, path := deepDoc(24)
+	ops := []map[string]any{{"op": "inc", "path": path + "/count", "inc": 1}}
+
+	b.Run("without index", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := Apply(doc, ops); err != nil {
+				b.Fatalf("Apply returned error: %v", err)
+			}
+		}
+	})
+
+	b.Run("with index", func(b *testing.B) {
+		opts := Options{Index: NewIndex(doc)}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := ApplyWithOptions(doc, ops, opts); err != nil {
+				b.Fatalf("ApplyWithOptions returned error: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkApplyTrusted(b *testing.B) {
+	base := map[string]any{
+		"doc": map[string]any{"sections": []any{map[string]any{"a/b": "Hello", "c~d": 0}}},
+	}
+	var ops []map[string]any
+	for i := range 64 {
+		ops = append(ops,
+			map[string]any{"op": "replace", "path": "/doc/sections/0/a~1b", "value": i},
+			map[string]any{"op": "inc", "path": "/doc/sections/0/c~0d", "inc": 1},
+		)
+	}
+
+	for _, trusted := range []bool{false, true} {
+		name := "validated"
+		if trusted {
+			name = "trusted"
+		}
+		b.Run(name, func(b *testing.B) {
+			opts := Options{Trusted: trusted}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				doc := cloneMap(base)
+				if err := ApplyWithOptions(doc, ops, opts); err != nil {
+					b.Fatalf("ApplyWithOptions returned error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCompiledPatchApply(b *testing.B) {
+	base := map[string]any{
+		"settings": map[string]any{"theme": map[string]any{"colors": map[string]any{"primary": "#000"}}},
+		"items":    []any{map[string]any{"qty": 1.0}, map[string]any{"qty": 2.0}},
+	}
+	ops := []map[string]any{
+		{"op": "replace", "path": "/settings/theme/colors/primary", "value": "#fff"},
+		{"op": "inc", "path": "/items/1/qty", "inc": 1.0},
+		{"op": "add", "path": "/items/-", "value": map[string]any{"qty": 0.0}},
+		{"op": "test", "path": "/settings/theme/colors/primary", "value": "#fff"},
+	}
+	compiled, err := Compile(ops)
+	if err != nil {
+		b.Fatalf("Compile returned error: %v", err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		doc := cloneMap(base)
+		if err := compiled.Apply(doc); err != nil {
+			b.Fatalf("Apply returned error: %v", err)
+		}
+	}
+}
@@ -1,9 +1,15 @@
 package jsonpatch
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
+	"unicode"
 )
 
 // Helper to make deep copies of docs for testing, as Apply mutates the doc.
@@ -430,6 +436,12 @@ func TestApply(t *testing.T) {
 			ops:         []map[string]interface{}{{"op": "move", "from": "/arr/0", "path": "/arr/2"}},
 			expectedDoc: map[string]any{"arr": []interface{}{2, 3, 1}},
 		},
+		{
+			name:        "move into an element after the one moved",
+			initialDoc:  map[string]any{"arr": []interface{}{1, 2, []interface{}{3}}},
+			ops:         []map[string]interface{}{{"op": "move", "from": "/arr/0", "path": "/arr/1/0"}},
+			expectedDoc: map[string]any{"arr": []interface{}{2, []interface{}{1, 3}}},
+		},
 		{
 			name:        "test success",
 			initialDoc:  map[string]any{"a": map[string]any{"b": 1}},
@@ -551,6 +563,67 @@ func TestApply(t *testing.T) {
 	}
 }
 
+// TestApplyCopyDoesNotAlias checks that copy writes a copy of its source
+// rather than the source itself, so that later writes to either do not
+// show up in both.
+func TestApplyCopyDoesNotAlias(t *testing.T) {
+	tests := []struct {
+		name        string
+		initialDoc  map[string]any
+		ops         []map[string]any
+		expectedDoc map[string]any
+	}{
+		{
+			name:       "write to the copy",
+			initialDoc: map[string]any{"a": map[string]any{"b": 1}},
+			ops: []map[string]any{
+				{"op": "copy", "from": "/a", "path": "/c"},
+				{"op": "replace", "path": "/c/b", "value": 2},
+			},
+			expectedDoc: map[string]any{"a": map[string]any{"b": 1}, "c": map[string]any{"b": 2}},
+		},
+		{
+			name:       "write to the source",
+			initialDoc: map[string]any{"a": map[string]any{"b": []any{"x"}}},
+			ops: []map[string]any{
+				{"op": "copy", "from": "/a", "path": "/c"},
+				{"op": "add", "path": "/a/b/-", "value": "y"},
+				{"op": "str_ins", "path": "/a/b/0", "pos": 1, "str": "!"},
+			},
+			expectedDoc: map[string]any{
+				"a": map[string]any{"b": []any{"x!", "y"}},
+				"c": map[string]any{"b": []any{"x"}},
+			},
+		},
+		{
+			name:       "copy into an array",
+			initialDoc: map[string]any{"arr": []any{map[string]any{"n": 1}}},
+			ops: []map[string]any{
+				{"op": "copy", "from": "/arr/0", "path": "/arr/-"},
+				{"op": "inc", "path": "/arr/1/n", "inc": 1},
+			},
+			expectedDoc: map[string]any{"arr": []any{map[string]any{"n": 1}, map[string]any{"n": 2}}},
+		},
+		{
+			name:        "copy root into a child",
+			initialDoc:  map[string]any{"count": 1},
+			ops:         []map[string]any{{"op": "copy", "from": "", "path": "/count"}},
+			expectedDoc: map[string]any{"count": map[string]any{"count": 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := deepCopyDoc(tt.initialDoc)
+			if err := Apply(doc, tt.ops); err != nil {
+				t.Fatalf("Apply returned error: %v", err)
+			}
+			if !reflect.DeepEqual(doc, tt.expectedDoc) {
+				t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", doc, tt.expectedDoc)
+			}
+		})
+	}
+}
+
 func TestResolvePath(t *testing.T) {
 	baseDoc := map[string]any{
 		"settings": map[string]any{"theme": "dark"},
@@ -723,3 +796,1200 @@ func TestUTF16LenToRuneLen(t *testing.T) {
 		t.Fatalf("expected rune length 1, got %d", got)
 	}
 }
+
+func TestReserveAppends(t *testing.T) {
+	ops := []map[string]any{
+		{"op": "add", "path": "/list/-", "value": 1},
+		{"op": "replace", "path": "/other", "value": 2},
+		{"op": "add", "path": "/list/-", "value": 3},
+		{"op": "add", "path": "/list/-", "value": 4},
+		{"op": "add", "path": "/single/-", "value": 5},
+	}
+	appends := countAppends(ops)
+	if appends["/list"] != 3 || appends["/single"] != 1 {
+		t.Fatalf("unexpected append counts: %v", appends)
+	}
+	if countAppends(ops[:2]) != nil {
+		t.Fatalf("expected nil counts when no slice receives repeated appends")
+	}
+
+	grown := reserveAppends([]any{0}, appends, "/list/-")
+	if len(grown) != 1 || cap(grown) < 4 {
+		t.Fatalf("expected room for 3 appends, got len %d cap %d", len(grown), cap(grown))
+	}
+	if appends["/list"] != 2 {
+		t.Fatalf("expected remaining count 2, got %d", appends["/list"])
+	}
+
+	doc := map[string]any{"list": []any{}, "other": 0, "single": []any{}}
+	if err := Apply(doc, ops); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if !reflect.DeepEqual(doc["list"], []any{1, 3, 4}) {
+		t.Fatalf("unexpected list after appends: %v", doc["list"])
+	}
+}
+
+func TestApplyErrorKinds(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       map[string]any
+		expected error
+	}{
+		{"missing key", map[string]any{"op": "remove", "path": "/missing"}, ErrPathNotFound},
+		{"failed test", map[string]any{"op": "test", "path": "/n", "value": 2}, ErrTestFailed},
+		{"index past the end", map[string]any{"op": "replace", "path": "/list/5", "value": 1}, ErrOutOfBounds},
+		{"string position past the end", map[string]any{"op": "str_ins", "path": "/s", "pos": 9, "str": "x"}, ErrOutOfBounds},
+		{"bad escape", map[string]any{"op": "remove", "path": "/a~2"}, ErrInvalidPointer},
+		{"non-index array segment", map[string]any{"op": "replace", "path": "/list/x", "value": 1}, ErrInvalidPointer},
+		{"unknown op", map[string]any{"op": "frobnicate", "path": "/n"}, ErrUnsupportedOp},
+		{"missing value", map[string]any{"op": "add", "path": "/n"}, ErrInvalidOperation},
+		{"string op on a number", map[string]any{"op": "str_ins", "path": "/n", "pos": 0, "str": "x"}, ErrTypeMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{"n": float64(1), "s": "abc", "list": []any{1}}
+			err := Apply(doc, []map[string]any{tt.op})
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, err)
+			}
+			if strings.Contains(err.Error(), tt.expected.Error()+":") {
+				t.Fatalf("the sentinel must not change the message, got %q", err)
+			}
+			var opErr *OpError
+			if !errors.As(err, &opErr) || opErr.Kind != tt.expected || opErr.Path != tt.op["path"] {
+				t.Fatalf("expected an *OpError of kind %v at %v, got %+v", tt.expected, tt.op["path"], opErr)
+			}
+		})
+	}
+}
+
+func TestApplyOpError(t *testing.T) {
+	doc := map[string]any{"n": float64(1), "s": "abc"}
+	err := Apply(doc, []map[string]any{
+		{"op": "str_ins", "path": "/s", "pos": 0, "str": "secret"},
+		{"op": "test", "path": "/n", "value": map[string]any{"token": "hunter2"}},
+	})
+	var opErr *OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("expected an *OpError, got %v", err)
+	}
+	if opErr.Index != 1 || opErr.Op["op"] != "test" || opErr.Path != "/n" || opErr.Kind != ErrTestFailed {
+		t.Fatalf("expected the second operation, got %+v", opErr)
+	}
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("expected the sentinel through OpError, got %v", err)
+	}
+	expected := `op 1 {"op": "test", "path": "/n", "value": <object, 1 keys>}: `
+	if !strings.HasPrefix(err.Error(), expected) || strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("expected a redacted message starting with %q, got %q", expected, err)
+	}
+
+	err = Apply(map[string]any{"s": "abc"}, []map[string]any{{"op": "str_ins", "path": "/s", "pos": 9, "str": "secret"}})
+	expected = `op 0 {"op": "str_ins", "path": "/s", "pos": 9, "str": <string, 6 chars>}: `
+	if err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Fatalf("expected a message starting with %q, got %v", expected, err)
+	}
+	if errors.As(err, &opErr); opErr.ID != nil {
+		t.Fatalf("expected no ID, got %v", opErr.ID)
+	}
+}
+
+func TestApplyOpIDs(t *testing.T) {
+	doc := map[string]any{"n": float64(1)}
+	ops := []map[string]any{
+		{"op": "replace", "path": "/n", "value": float64(2), "id": "local-1"},
+		{"op": "remove", "path": "/missing", "id": float64(7)},
+	}
+	// The id member does not change what an op does.
+	if err := Apply(doc, ops[:1]); err != nil || doc["n"] != float64(2) {
+		t.Fatalf("expected the op to apply, got %v (%v)", doc, err)
+	}
+	err := Apply(doc, ops)
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.ID != float64(7) {
+		t.Fatalf("expected an *OpError with ID 7, got %v", err)
+	}
+	expected := `op 1 {"op": "remove", "path": "/missing", "id": 7}: `
+	if !strings.HasPrefix(err.Error(), expected) {
+		t.Fatalf("expected a message starting with %q, got %q", expected, err)
+	}
+}
+
+func TestApplyTrusted(t *testing.T) {
+	ops := []map[string]any{
+		{"op": "str_ins", "path": "/a/b~1c/0", "pos": 2, "str": "!"},
+		{"op": "str_ins", "path": "/a/b~1c/0", "pos": 0, "str": "<"},
+		{"op": "add", "path": "/a/b~1c/-", "value": "x"},
+		{"op": "str_del", "path": "/a/b~1c/0", "pos": 0, "len": 1},
+		{"op": "move", "from": "/a/b~1c/1", "path": "/a/d"},
+	}
+	doc := map[string]any{"a": map[string]any{"b/c": []any{"hi"}}}
+	if err := ApplyWithOptions(doc, ops, Options{Trusted: true}); err != nil {
+		t.Fatalf("ApplyWithOptions returned error: %v", err)
+	}
+	expected := map[string]any{"a": map[string]any{"b/c": []any{"hi!"}, "d": "x"}}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("Documents not equal.\nGot:      %v\nExpected: %v", doc, expected)
+	}
+
+	rejected := []struct {
+		name string
+		op   map[string]any
+		err  error
+	}{
+		{"str_ins past the end", map[string]any{"op": "str_ins", "path": "/text", "pos": 99, "str": "!"}, ErrOutOfBounds},
+		{"str_del past the end", map[string]any{"op": "str_del", "path": "/text", "pos": 99, "len": 1}, ErrOutOfBounds},
+		{"move into own child", map[string]any{"op": "move", "from": "/a", "path": "/a/b/c"}, ErrInvalidOperation},
+		{"bad escape", map[string]any{"op": "replace", "path": "/a/~2", "value": 1}, ErrInvalidPointer},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{"text": "hi", "a": map[string]any{"b": map[string]any{}}}
+			ops := []map[string]any{tt.op, tt.op}
+			if err := ApplyWithOptions(doc, ops, Options{Trusted: true}); !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// fieldErrors stands in for the errors of a struct-tag validator.
+type fieldErrors []string
+
+func (e fieldErrors) Error() string { return strings.Join(e, "; ") }
+
+type profile struct {
+	Name  string `json:"name"`
+	Seats int    `json:"seats"`
+}
+
+func checkProfile(v any) error {
+	if p := v.(*profile); p.Seats < 1 {
+		return fieldErrors{"seats must be at least 1"}
+	}
+	return nil
+}
+
+func TestApplyValidateDocument(t *testing.T) {
+	validate := ValidateAs[profile](checkProfile)
+	invalid := []map[string]any{
+		{"op": "replace", "path": "/name", "value": "beta"},
+		{"op": "replace", "path": "/seats", "value": 0},
+	}
+
+	doc := map[string]any{"name": "acme", "seats": float64(2)}
+	err := ApplyWithOptions(doc, invalid, Options{Atomic: true, ValidateDocument: validate})
+	var fields fieldErrors
+	if !errors.Is(err, ErrInvalidDocument) || !errors.As(err, &fields) {
+		t.Fatalf("expected field errors wrapped in ErrInvalidDocument, got %v", err)
+	}
+	expected := map[string]any{"name": "acme", "seats": float64(2)}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", doc, expected)
+	}
+
+	// Without Atomic, the document keeps the changes.
+	err = ApplyWithOptions(doc, invalid, Options{ValidateDocument: validate})
+	if !errors.Is(err, ErrInvalidDocument) {
+		t.Fatalf("expected ErrInvalidDocument, got %v", err)
+	}
+	expected = map[string]any{"name": "beta", "seats": 0}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", doc, expected)
+	}
+
+	// A document that does not decode into the type is invalid too.
+	ops := []map[string]any{{"op": "replace", "path": "/seats", "value": "many"}}
+	if err := ApplyWithOptions(doc, ops, Options{Atomic: true, ValidateDocument: validate}); !errors.Is(err, ErrInvalidDocument) {
+		t.Fatalf("expected ErrInvalidDocument, got %v", err)
+	}
+	ops = []map[string]any{{"op": "replace", "path": "/seats", "value": 3}}
+	if err := ApplyWithOptions(doc, ops, Options{Atomic: true, ValidateDocument: validate}); err != nil {
+		t.Fatalf("valid patch rejected: %v", err)
+	}
+}
+
+func TestApplyUpsert(t *testing.T) {
+	tests := []struct {
+		name          string
+		op            map[string]any
+		opts          Options
+		expected      map[string]any
+		expectedError string
+	}{
+		{"missing key fails by default", map[string]any{"op": "replace", "path": "/b", "value": 2}, Options{}, nil, "path segment \"b\" not found"},
+		{"option adds missing key", map[string]any{"op": "replace", "path": "/b", "value": 2}, Options{Upsert: true}, map[string]any{"a": 1, "b": 2, "list": []any{1}}, ""},
+		{"op flag adds missing key", map[string]any{"op": "replace", "path": "/b", "value": 2, "upsert": true}, Options{}, map[string]any{"a": 1, "b": 2, "list": []any{1}}, ""},
+		{"op flag overrides option", map[string]any{"op": "replace", "path": "/b", "value": 2, "upsert": false}, Options{Upsert: true}, nil, "path segment \"b\" not found"},
+		{"existing key is replaced", map[string]any{"op": "replace", "path": "/a", "value": 3}, Options{Upsert: true}, map[string]any{"a": 3, "list": []any{1}}, ""},
+		{"missing index still fails", map[string]any{"op": "replace", "path": "/list/1", "value": 2}, Options{Upsert: true}, nil, "index 1 out of bounds"},
+		{"missing parent still fails", map[string]any{"op": "replace", "path": "/x/y", "value": 2}, Options{Upsert: true}, nil, "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{"a": 1, "list": []any{1}}
+			err := ApplyWithOptions(doc, []map[string]any{tt.op}, tt.opts)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyWithOptions returned error: %v", err)
+			}
+			if !reflect.DeepEqual(doc, tt.expected) {
+				t.Fatalf("Documents not equal.\nGot:      %v\nExpected: %v", doc, tt.expected)
+			}
+		})
+	}
+}
+
+func TestApplyMoveIndex(t *testing.T) {
+	tests := []struct {
+		name          string
+		from, path    string
+		after, before []any
+	}{
+		{"forward", "/a/0", "/a/2", []any{"y", "z", "x"}, []any{"y", "x", "z"}},
+		{"forward to the end", "/a/0", "/a/3", nil, []any{"y", "z", "x"}},
+		{"forward to -", "/a/0", "/a/-", []any{"y", "z", "x"}, []any{"y", "z", "x"}},
+		{"backward", "/a/2", "/a/0", []any{"z", "x", "y"}, []any{"z", "x", "y"}},
+		{"adjacent", "/a/0", "/a/1", []any{"y", "x", "z"}, []any{"x", "y", "z"}},
+		{"to another array", "/a/0", "/b/1", []any{"y", "z"}, []any{"y", "z"}},
+	}
+	for _, tt := range tests {
+		for _, mode := range []MoveIndexing{MoveIndexAfterRemoval, MoveIndexBeforeRemoval} {
+			expected := tt.after
+			if mode == MoveIndexBeforeRemoval {
+				expected = tt.before
+			}
+			t.Run(fmt.Sprintf("%s/%d", tt.name, mode), func(t *testing.T) {
+				doc := map[string]any{"a": []any{"x", "y", "z"}, "b": []any{"p", "q"}}
+				var report ApplyReport
+				err := ApplyWithOptions(doc, []map[string]any{{"op": "move", "from": tt.from, "path": tt.path}}, Options{MoveIndex: mode, Report: &report})
+				if expected == nil {
+					if !errors.Is(err, ErrOutOfBounds) {
+						t.Fatalf("expected ErrOutOfBounds, got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("ApplyWithOptions returned error: %v", err)
+				}
+				if !reflect.DeepEqual(doc["a"], expected) {
+					t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", doc["a"], expected)
+				}
+				// The report points at where the value ended up.
+				added := report.Changes[len(report.Changes)-1]
+				if at, err := (&applier{root: doc}).valueAt(added.Path); err != nil || at != added.New {
+					t.Fatalf("report says %v was added at %q, which holds %v", added.New, added.Path, at)
+				}
+			})
+		}
+	}
+}
+
+func TestApplyAtomic(t *testing.T) {
+	newDoc := func() map[string]any {
+		return map[string]any{
+			"a":    map[string]any{"b": float64(1), "list": []any{"x"}},
+			"s":    "hello",
+			"keep": map[string]any{"deep": []any{float64(1)}},
+		}
+	}
+	writes := []map[string]any{
+		{"op": "replace", "path": "/a/b", "value": 2},
+		{"op": "add", "path": "/a/list/0", "value": "w"},
+		{"op": "add", "path": "/a/list/-", "value": "y"},
+		{"op": "str_ins", "path": "/s", "pos": 5, "str": "!"},
+		{"op": "move", "from": "/a/list/0", "path": "/moved"},
+		{"op": "remove", "path": "/keep"},
+	}
+
+	// A failing patch changes nothing.
+	doc := newDoc()
+	var report ApplyReport
+	failing := append(append([]map[string]any{}, writes...), map[string]any{"op": "test", "path": "/s", "value": "nope"})
+	err := ApplyWithOptions(doc, failing, Options{Atomic: true, Report: &report})
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("expected ErrTestFailed, got %v", err)
+	}
+	if !reflect.DeepEqual(doc, newDoc()) {
+		t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", doc, newDoc())
+	}
+	if report.Changed() {
+		t.Fatalf("expected no changes reported, got %v", report.Changes)
+	}
+
+	// So does one whose writes follow a test, which only reads the
+	// containers along its path.
+	nested := func() map[string]any {
+		return map[string]any{"a": map[string]any{
+			"b": []any{map[string]any{"c": []any{float64(1), float64(2)}}, map[string]any{"d": "x"}},
+			"e": map[string]any{"f": map[string]any{"g": float64(1)}},
+		}}
+	}
+	tested := nested()
+	err = ApplyWithOptions(tested, []map[string]any{
+		{"op": "test", "path": "/a/e/f/g", "value": 1},
+		{"op": "add", "path": "/a/b/-", "value": "v"},
+		{"op": "inc", "path": "/a/b/1", "inc": 1},
+	}, Options{Atomic: true})
+	if err == nil || !reflect.DeepEqual(tested, nested()) {
+		t.Fatalf("expected the document to be unchanged, got %v (%v)", tested, err)
+	}
+
+	// A patch replacing the root fails just as cleanly.
+	err = ApplyWithOptions(doc, []map[string]any{
+		{"op": "replace", "path": "", "value": map[string]any{"other": true}},
+		{"op": "remove", "path": "/missing"},
+	}, Options{Atomic: true})
+	if err == nil || !reflect.DeepEqual(doc, newDoc()) {
+		t.Fatalf("expected the document to be unchanged, got %v (%v)", doc, err)
+	}
+
+	// A succeeding patch gives the same result as without Atomic.
+	expected := newDoc()
+	if err := Apply(expected, writes); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	index := NewIndex(doc)
+	if err := ApplyWithOptions(doc, writes, Options{Atomic: true, Index: index}); err != nil {
+		t.Fatalf("ApplyWithOptions returned error: %v", err)
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", doc, expected)
+	}
+	if err := ApplyWithOptions(doc, []map[string]any{{"op": "add", "path": "/a/list/-", "value": "z"}}, Options{Index: index}); err != nil {
+		t.Fatalf("index unusable after an atomic apply: %v", err)
+	}
+	if !reflect.DeepEqual(doc["a"].(map[string]any)["list"], []any{"x", "y", "z"}) {
+		t.Fatalf("unexpected list after an atomic apply: %v", doc["a"])
+	}
+
+	// ApplyValueWithOptions returns the document it was given on failure.
+	root := []any{float64(1), []any{float64(2)}}
+	result, err := ApplyValueWithOptions(root, []map[string]any{
+		{"op": "add", "path": "/1/-", "value": 3},
+		{"op": "remove", "path": "/5"},
+	}, Options{Atomic: true})
+	if err == nil || !reflect.DeepEqual(result, []any{float64(1), []any{float64(2)}}) || !reflect.DeepEqual(root, result) {
+		t.Fatalf("expected the original document back, got %v (%v)", result, err)
+	}
+}
+
+func TestApplyContinueOnError(t *testing.T) {
+	newDoc := func() map[string]any {
+		return map[string]any{"n": float64(1), "list": []any{"a", "b"}, "o": map[string]any{"k": "v"}}
+	}
+	ops := []map[string]any{
+		{"op": "replace", "path": "/n", "value": float64(2)},
+		{"op": "remove", "path": "/missing"},
+		{"op": "move", "from": "/list/0", "path": "/nowhere/x"},
+		{"op": "move", "from": "/o/k", "path": "/list/9"},
+		{"op": "add", "path": "/list/-", "value": "c"},
+		{"op": "test", "path": "/n", "value": float64(1), "id": "guard"},
+	}
+
+	doc := newDoc()
+	err := ApplyWithOptions(doc, ops, Options{ContinueOnError: true})
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected a *PartialError, got %v", err)
+	}
+	if !reflect.DeepEqual(partial.Applied, []int{0, 4}) || partial.Total != len(ops) {
+		t.Fatalf("expected ops 0 and 4 of %d applied, got %v of %d", len(ops), partial.Applied, partial.Total)
+	}
+	var failed []int
+	for _, opErr := range partial.Errors {
+		failed = append(failed, opErr.Index)
+	}
+	if !reflect.DeepEqual(failed, []int{1, 2, 3, 5}) || partial.Errors[3].ID != "guard" {
+		t.Fatalf("expected ops 1, 2, 3 and 5 to fail, got %v", partial.Errors)
+	}
+	if !errors.Is(err, ErrPathNotFound) || !errors.Is(err, ErrTestFailed) || !errors.Is(err, ErrOutOfBounds) {
+		t.Fatalf("expected the sentinels of every failure, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "4 of 6 operations failed\nop 1 ") {
+		t.Fatalf("unexpected message %q", err)
+	}
+	// The failed moves put their values back.
+	expected := map[string]any{"n": float64(2), "list": []any{"a", "b", "c"}, "o": map[string]any{"k": "v"}}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", doc, expected)
+	}
+
+	// Without failures, there is no error.
+	doc = newDoc()
+	if err := ApplyWithOptions(doc, ops[:1], Options{ContinueOnError: true}); err != nil {
+		t.Fatalf("ApplyWithOptions returned error: %v", err)
+	}
+
+	// Atomic still changes nothing when an operation fails.
+	doc = newDoc()
+	err = ApplyWithOptions(doc, ops, Options{ContinueOnError: true, Atomic: true})
+	if !errors.As(err, &partial) || len(partial.Errors) != 4 || !reflect.DeepEqual(doc, newDoc()) {
+		t.Fatalf("expected every failure and an unchanged document, got %v (%v)", doc, err)
+	}
+}
+
+func TestApplyContext(t *testing.T) {
+	ops := []map[string]any{
+		{"op": "replace", "path": "/n", "value": float64(2)},
+		{"op": "add", "path": "/s", "value": "x"},
+	}
+	doc := map[string]any{"n": float64(1)}
+	if err := ApplyContext(context.Background(), doc, ops); err != nil || doc["s"] != "x" {
+		t.Fatalf("expected the patch to apply, got %v (%v)", doc, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	doc = map[string]any{"n": float64(1)}
+	err := ApplyContext(ctx, doc, ops)
+	var opErr *OpError
+	if !errors.Is(err, context.Canceled) || !errors.As(err, &opErr) || opErr.Index != 0 {
+		t.Fatalf("expected op 0 to be canceled, got %v", err)
+	}
+	if !reflect.DeepEqual(doc, map[string]any{"n": float64(1)}) {
+		t.Fatalf("a canceled patch changed the document: %v", doc)
+	}
+}
+
+func TestApplyContextJSONPath(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var written int
+	opts := Options{JSONPath: true, Sanitize: func(path string, value any) (any, error) {
+		// Cancel while the op is applied to the first of its values.
+		written++
+		cancel()
+		return value, nil
+	}}
+	doc := map[string]any{"items": []any{map[string]any{}, map[string]any{}, map[string]any{}}}
+	ops := []map[string]any{{"op": "add", "path": "$.items[*].seen", "value": true}}
+	err := ApplyContextWithOptions(ctx, doc, ops, opts)
+	var opErr *OpError
+	if !errors.Is(err, context.Canceled) || !errors.As(err, &opErr) || opErr.Index != 0 {
+		t.Fatalf("expected op 0 to be canceled, got %v", err)
+	}
+	if written != 1 {
+		t.Fatalf("expected the op to stop after its first value, wrote %d", written)
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	newDoc := func() map[string]any {
+		return map[string]any{"a": map[string]any{"b": float64(1)}, "list": []any{"x"}}
+	}
+	doc := newDoc()
+	other := map[string]any{"v": "from other"}
+	var report ApplyReport
+	err := ApplyWithOptions(doc, []map[string]any{
+		{"op": "replace", "path": "/a/b", "value": 2},
+		{"op": "add", "path": "/list/-", "value": "y"},
+		{"op": "move", "from": "other#/v", "path": "/a/c"},
+		{"op": "replace", "path": "/a/b", "value": 3},
+	}, Options{DryRun: true, Report: &report, Documents: map[string]any{"other": other}})
+	if err != nil {
+		t.Fatalf("ApplyWithOptions returned error: %v", err)
+	}
+	if !reflect.DeepEqual(doc, newDoc()) || !reflect.DeepEqual(other, map[string]any{"v": "from other"}) {
+		t.Fatalf("dry run changed the documents: %v, %v", doc, other)
+	}
+	if paths := report.Paths(); !reflect.DeepEqual(paths, []string{"/a/b", "/list/1", "/a/c"}) {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+
+	// A failing dry run reports the error and the changes before it.
+	err = ApplyWithOptions(doc, []map[string]any{
+		{"op": "remove", "path": "/list/0"},
+		{"op": "test", "path": "/a/b", "value": 5},
+	}, Options{DryRun: true, Report: &report})
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Index != 1 || !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("expected op 1 to fail its test, got %v", err)
+	}
+	if !reflect.DeepEqual(doc, newDoc()) || !reflect.DeepEqual(report.Paths(), []string{"/list/0"}) {
+		t.Fatalf("unexpected dry run result %v with paths %v", doc, report.Paths())
+	}
+
+	// Writes after a test, which only reads the containers along its path,
+	// still go into copies.
+	nested := map[string]any{"a": map[string]any{"e": map[string]any{"f": map[string]any{"g": float64(1)}}}}
+	err = ApplyWithOptions(nested, []map[string]any{
+		{"op": "test", "path": "/a/e/f/g", "value": 1},
+		{"op": "add", "path": "/a/e/f", "value": []any{2}},
+	}, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("ApplyWithOptions returned error: %v", err)
+	}
+	if expected := map[string]any{"a": map[string]any{"e": map[string]any{"f": map[string]any{"g": float64(1)}}}}; !reflect.DeepEqual(nested, expected) {
+		t.Fatalf("dry run changed the document: %v", nested)
+	}
+
+	root := []any{float64(1)}
+	result, err := ApplyValueWithOptions(root, []map[string]any{{"op": "replace", "path": "", "value": "scalar"}}, Options{DryRun: true})
+	if err != nil || !reflect.DeepEqual(result, []any{float64(1)}) {
+		t.Fatalf("expected the original document back, got %v (%v)", result, err)
+	}
+}
+
+func TestApplyMaxStringLength(t *testing.T) {
+	opts := Options{
+		MaxStringLength:  5,
+		MaxStringLengths: map[string]int{"/posts/*/body": 10, "/posts/0/body": 8},
+	}
+	tests := []struct {
+		name          string
+		op            map[string]any
+		expectedError string
+	}{
+		{"within the global limit", map[string]any{"op": "str_ins", "path": "/title", "pos": 2, "str": "🌍"}, ""},
+		{"past the global limit", map[string]any{"op": "str_ins", "path": "/title", "pos": 0, "str": "abcd"}, "would make the string 6 long (limit 5)"},
+		{"within a path limit", map[string]any{"op": "str_ins", "path": "/posts/1/body", "pos": 0, "str": "abcdefg"}, ""},
+		{"past a path limit", map[string]any{"op": "str_ins", "path": "/posts/1/body", "pos": 0, "str": "abcdefgh"}, "limit 10"},
+		{"smallest matching limit", map[string]any{"op": "str_ins", "path": "/posts/0/body", "pos": 0, "str": "abcdefg"}, "limit 8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{"title": "ab", "posts": []any{map[string]any{"body": "xyz"}, map[string]any{"body": "xyz"}}}
+			err := ApplyWithOptions(doc, []map[string]any{tt.op}, opts)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("ApplyWithOptions returned error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrStringTooLong) || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Fatalf("expected ErrStringTooLong containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+// graphemeIndexing counts a base character and the combining marks after it
+// as one position, standing in for a real grapheme cluster segmenter.
+type graphemeIndexing struct{}
+
+func (graphemeIndexing) Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if !unicode.Is(unicode.Mn, r) {
+			n++
+		}
+	}
+	return n
+}
+
+func (graphemeIndexing) Offset(s string, pos int) int {
+	n := 0
+	for i, r := range s {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if n == pos {
+			return i
+		}
+		n++
+	}
+	return len(s)
+}
+
+func TestApplyLimits(t *testing.T) {
+	tests := []struct {
+		name          string
+		ops           []map[string]any
+		opts          Options
+		expectedError string
+	}{
+		{"ops within limit", []map[string]any{{"op": "test", "path": "/s", "value": "ab"}, {"op": "remove", "path": "/list/0"}}, Options{MaxOps: 2}, ""},
+		{"too many ops", []map[string]any{{"op": "test", "path": "/s", "value": "ab"}, {"op": "remove", "path": "/list/0"}}, Options{MaxOps: 1}, "patch has 2 operations (limit 1)"},
+		{"path within depth", []map[string]any{{"op": "replace", "path": "/o/a/b", "value": 1}}, Options{MaxPathDepth: 3}, ""},
+		{"path too deep", []map[string]any{{"op": "add", "path": "/o/a/b/c", "value": 1}}, Options{MaxPathDepth: 3}, "\"path\" \"/o/a/b/c\" has 4 segments (limit 3)"},
+		{"from too deep", []map[string]any{{"op": "copy", "from": "/o/a/b", "path": "/x"}}, Options{MaxPathDepth: 2}, "\"from\" \"/o/a/b\" has 3 segments"},
+		{"insert within limit", []map[string]any{{"op": "str_ins", "path": "/s", "pos": 0, "str": "xyz"}}, Options{MaxInsertLength: 3}, ""},
+		{"insert too long", []map[string]any{{"op": "str_ins", "path": "/s", "pos": 0, "str": "wxyz"}}, Options{MaxInsertLength: 3}, "inserts a string 4 long (limit 3)"},
+		{"array within limit", []map[string]any{{"op": "add", "path": "/list/-", "value": 3}}, Options{MaxArrayLength: 3}, ""},
+		{"array too long", []map[string]any{{"op": "add", "path": "/list/-", "value": 3}, {"op": "add", "path": "/list/0", "value": 0}}, Options{MaxArrayLength: 3}, "\"add\" at path \"/list/0\" would make the array 4 long (limit 3)"},
+		{"copy into a full array", []map[string]any{{"op": "copy", "from": "/s", "path": "/list/-"}}, Options{MaxArrayLength: 2}, "would make the array 3 long"},
+		{"move into a full array", []map[string]any{{"op": "move", "from": "/s", "path": "/list/1"}}, Options{MaxArrayLength: 2}, "would make the array 3 long"},
+		{"move within a full array", []map[string]any{{"op": "move", "from": "/list/0", "path": "/list/1"}}, Options{MaxArrayLength: 2}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{"s": "ab", "list": []any{1, 2}, "o": map[string]any{"a": map[string]any{"b": 0}}}
+			err := ApplyWithOptions(doc, tt.ops, tt.opts)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("ApplyWithOptions returned error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrLimitExceeded) || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Fatalf("expected ErrLimitExceeded containing %q, got %v", tt.expectedError, err)
+			}
+			if _, ok := doc["s"]; !ok {
+				t.Fatalf("a failed move lost its value: %v", doc)
+			}
+		})
+	}
+}
+
+func TestApplyStringIndexing(t *testing.T) {
+	tests := []struct {
+		name          string
+		indexing      StringIndexing
+		op            map[string]any
+		expected      string
+		expectedError string
+	}{
+		{"utf16 by default", nil, map[string]any{"op": "str_ins", "path": "/s", "pos": 3, "str": "!"}, "a🌍!e\u0301b", ""},
+		{"utf16 past the end", nil, map[string]any{"op": "str_ins", "path": "/s", "pos": 7, "str": "!"}, "", `invalid "pos" 7`},
+		{"runes insert", RuneIndexing, map[string]any{"op": "str_ins", "path": "/s", "pos": 2, "str": "!"}, "a🌍!e\u0301b", ""},
+		{"runes delete by len", RuneIndexing, map[string]any{"op": "str_del", "path": "/s", "pos": 1, "len": 1}, "ae\u0301b", ""},
+		{"runes past the end", RuneIndexing, map[string]any{"op": "str_del", "path": "/s", "pos": 6, "len": 1}, "", `invalid "pos" 6`},
+		{"bytes insert", ByteIndexing, map[string]any{"op": "str_ins", "path": "/s", "pos": 5, "str": "!"}, "a🌍!e\u0301b", ""},
+		{"bytes delete by str", ByteIndexing, map[string]any{"op": "str_del", "path": "/s", "pos": 1, "str": "🌍"}, "ae\u0301b", ""},
+		{"custom graphemes", graphemeIndexing{}, map[string]any{"op": "str_del", "path": "/s", "pos": 2, "len": 1}, "a🌍b", ""},
+		{"custom graphemes insert at end", graphemeIndexing{}, map[string]any{"op": "str_ins", "path": "/s", "pos": 4, "str": "!"}, "a🌍e\u0301b!", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{"s": "a🌍e\u0301b"}
+			err := ApplyWithOptions(doc, []map[string]any{tt.op}, Options{StringIndexing: tt.indexing})
+			if tt.expectedError != "" {
+				if !errors.Is(err, ErrOutOfBounds) || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected ErrOutOfBounds containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyWithOptions returned error: %v", err)
+			}
+			if doc["s"] != tt.expected {
+				t.Errorf("Documents not equal.\nGot: %q\nExpected: %q", doc["s"], tt.expected)
+			}
+		})
+	}
+}
+
+func TestApplySanitize(t *testing.T) {
+	var paths []string
+	opts := Options{Sanitize: func(path string, value any) (any, error) {
+		paths = append(paths, path)
+		switch v := value.(type) {
+		case string:
+			return strings.TrimSpace(v), nil
+		case map[string]any:
+			if status, ok := v["status"]; ok && status != "open" && status != "done" {
+				return nil, fmt.Errorf("unknown status %v", status)
+			}
+		}
+		return value, nil
+	}}
+
+	value := map[string]any{"title": "  hi ", "tags": []any{" a", "b "}}
+	doc := map[string]any{"items": []any{}, "template": map[string]any{"note": " x "}}
+	ops := []map[string]any{
+		{"op": "add", "path": "/items/-", "value": value},
+		{"op": "replace", "path": "/template/note", "value": "  y  "},
+		{"op": "copy", "from": "/template", "path": "/copy"},
+	}
+	if err := ApplyWithOptions(doc, ops, opts); err != nil {
+		t.Fatalf("ApplyWithOptions returned error: %v", err)
+	}
+	expected := map[string]any{
+		"items":    []any{map[string]any{"title": "hi", "tags": []any{"a", "b"}}},
+		"template": map[string]any{"note": "y"},
+		"copy":     map[string]any{"note": "y"},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("Documents not equal.\nGot:      %v\nExpected: %v", doc, expected)
+	}
+	if value["title"] != "  hi " {
+		t.Fatalf("the op's value must not be modified, got %v", value)
+	}
+	expectedPaths := []string{"/items/-/tags/0", "/items/-/tags/1", "/items/-/tags", "/items/-/title", "/items/-", "/template/note", "/copy/note", "/copy"}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Fatalf("expected the hook at %v, got %v", expectedPaths, paths)
+	}
+
+	err := ApplyWithOptions(doc, []map[string]any{
+		{"op": "add", "path": "/items/0", "value": map[string]any{"sub": map[string]any{"status": "lost"}}},
+	}, opts)
+	if !errors.Is(err, ErrValueRejected) || !strings.Contains(err.Error(), `value at path "/items/0/sub" rejected: unknown status lost`) {
+		t.Fatalf("expected the nested value to be rejected, got %v", err)
+	}
+
+	root, err := ApplyValueWithOptions("old", []map[string]any{{"op": "replace", "path": "", "value": " new "}}, opts)
+	if err != nil || root != "new" {
+		t.Fatalf("expected the root value to be sanitized, got %v (%v)", root, err)
+	}
+}
+
+func TestApplyOrderingOps(t *testing.T) {
+	tests := []struct {
+		name          string
+		op            map[string]any
+		opts          Options
+		expectedError string
+	}{
+		{"less number", map[string]any{"op": "less", "path": "/n", "value": 3}, Options{}, ""},
+		{"less number fails", map[string]any{"op": "less", "path": "/n", "value": 2}, Options{}, "less operation failed at path \"/n\""},
+		{"more number", map[string]any{"op": "more", "path": "/n", "value": 1.5}, Options{}, ""},
+		{"more string", map[string]any{"op": "more", "path": "/name", "value": "alice"}, Options{}, ""},
+		{"mixed types", map[string]any{"op": "less", "path": "/n", "value": "3"}, Options{}, "cannot order float64 and string"},
+		{"missing value", map[string]any{"op": "more", "path": "/n"}, Options{}, "op \"more\" missing \"value\" field"},
+		// Lexically "2024-05-01T09:00:00Z" > "2024-05-01T08:30:00-01:00".
+		{"lexical timestamps", map[string]any{"op": "less", "path": "/updatedAt", "value": "2024-05-01T08:30:00-01:00"}, Options{}, "less operation failed"},
+		{"chronological less", map[string]any{"op": "less", "path": "/updatedAt", "value": "2024-05-01T08:30:00-01:00"}, Options{Timestamps: true}, ""},
+		{"chronological more fails", map[string]any{"op": "more", "path": "/updatedAt", "value": "2024-05-01T08:30:00-01:00"}, Options{Timestamps: true}, "more operation failed"},
+		{"test same instant", map[string]any{"op": "test", "path": "/updatedAt", "value": "2024-05-01T11:00:00.000+02:00"}, Options{Timestamps: true}, ""},
+		{"test same instant lexically", map[string]any{"op": "test", "path": "/updatedAt", "value": "2024-05-01T11:00:00.000+02:00"}, Options{}, "test operation failed"},
+		{"in", map[string]any{"op": "in", "path": "/n", "value": []any{1, 2}}, Options{}, ""},
+		{"in fails", map[string]any{"op": "in", "path": "/name", "value": []any{"alice", 2}}, Options{}, "in operation failed at path \"/name\""},
+		{"in empty", map[string]any{"op": "in", "path": "/n", "value": []any{}}, Options{}, "in operation failed"},
+		{"in timestamps", map[string]any{"op": "in", "path": "/updatedAt", "value": []any{"2024-05-01T11:00:00+02:00"}}, Options{Timestamps: true}, ""},
+		{"in not an array", map[string]any{"op": "in", "path": "/n", "value": 2}, Options{}, "\"value\" field must be an array"},
+		{"defined", map[string]any{"op": "defined", "path": "/log/0"}, Options{}, ""},
+		{"defined fails", map[string]any{"op": "defined", "path": "/missing"}, Options{}, "defined operation failed at path \"/missing\""},
+		{"defined root", map[string]any{"op": "defined", "path": ""}, Options{}, ""},
+		{"undefined", map[string]any{"op": "undefined", "path": "/log/1"}, Options{}, ""},
+		{"undefined under a missing parent", map[string]any{"op": "undefined", "path": "/missing/a/b"}, Options{}, ""},
+		{"undefined inside a scalar", map[string]any{"op": "undefined", "path": "/n/a"}, Options{}, ""},
+		{"undefined fails", map[string]any{"op": "undefined", "path": "/name"}, Options{}, "undefined operation failed at path \"/name\""},
+		{"undefined malformed", map[string]any{"op": "undefined", "path": "/log/01"}, Options{}, "not a valid integer index"},
+		{"test nested instant", map[string]any{"op": "test", "path": "/log", "value": []any{"2024-05-01T10:00:00+01:00"}}, Options{Timestamps: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{"n": float64(2), "name": "bob", "updatedAt": "2024-05-01T09:00:00Z", "log": []any{"2024-05-01T09:00:00Z"}}
+			err := ApplyWithOptions(doc, []map[string]any{tt.op}, tt.opts)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("ApplyWithOptions returned error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+			}
+			if strings.Contains(tt.expectedError, "operation failed") && !errors.Is(err, ErrTestFailed) {
+				t.Fatalf("expected ErrTestFailed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestApplyExtend(t *testing.T) {
+	tests := []struct {
+		name          string
+		op            map[string]any
+		opts          Options
+		expected      map[string]any
+		expectedError string
+	}{
+		{"merge", map[string]any{"op": "extend", "path": "/user", "props": map[string]any{"name": "bob", "age": float64(30)}}, Options{},
+			map[string]any{"user": map[string]any{"name": "bob", "email": "a@example.com", "age": float64(30)}, "list": []any{map[string]any{}}}, ""},
+		{"null stored", map[string]any{"op": "extend", "path": "/user", "props": map[string]any{"email": nil}}, Options{},
+			map[string]any{"user": map[string]any{"name": "alice", "email": nil}, "list": []any{map[string]any{}}}, ""},
+		{"null deletes", map[string]any{"op": "extend", "path": "/user", "props": map[string]any{"email": nil, "missing": nil}, "deleteNull": true}, Options{},
+			map[string]any{"user": map[string]any{"name": "alice"}, "list": []any{map[string]any{}}}, ""},
+		{"root", map[string]any{"op": "extend", "path": "", "props": map[string]any{"list": nil}, "deleteNull": true}, Options{},
+			map[string]any{"user": map[string]any{"name": "alice", "email": "a@example.com"}}, ""},
+		{"array element", map[string]any{"op": "extend", "path": "/list/0", "props": map[string]any{"x": true}}, Options{},
+			map[string]any{"user": map[string]any{"name": "alice", "email": "a@example.com"}, "list": []any{map[string]any{"x": true}}}, ""},
+		{"not an object", map[string]any{"op": "extend", "path": "/list", "props": map[string]any{"x": true}}, Options{}, nil, "target of \"extend\" at path \"/list\" is not an object"},
+		{"missing target", map[string]any{"op": "extend", "path": "/nope", "props": map[string]any{}}, Options{}, nil, "not found"},
+		{"missing props", map[string]any{"op": "extend", "path": "/user"}, Options{}, nil, "\"props\" field must be an object"},
+		{"bad deleteNull", map[string]any{"op": "extend", "path": "/user", "props": map[string]any{}, "deleteNull": "yes"}, Options{}, nil, "\"deleteNull\" field must be a boolean"},
+		{"sanitize rejects", map[string]any{"op": "extend", "path": "/user", "props": map[string]any{"age": float64(1), "bad": "<script>"}}, Options{Sanitize: func(path string, value any) (any, error) {
+			if value == "<script>" {
+				return nil, errors.New("no scripts")
+			}
+			return value, nil
+		}}, nil, "/user/bad"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{"user": map[string]any{"name": "alice", "email": "a@example.com"}, "list": []any{map[string]any{}}}
+			err := ApplyWithOptions(doc, []map[string]any{tt.op}, tt.opts)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				if user := doc["user"].(map[string]any); len(user) != 2 {
+					t.Fatalf("failed extend modified the target: %v", user)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyWithOptions returned error: %v", err)
+			}
+			if !reflect.DeepEqual(doc, tt.expected) {
+				t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", doc, tt.expected)
+			}
+		})
+	}
+}
+
+func TestApplyTypeOp(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		typ           any
+		expectedError error
+	}{
+		{"string", "/s", "string", nil},
+		{"float number", "/f", "number", nil},
+		{"whole float is an integer", "/i", "integer", nil},
+		{"json.Number integer", "/big", "integer", nil},
+		{"integer is a number", "/big", "number", nil},
+		{"fraction is not an integer", "/f", "integer", ErrTestFailed},
+		{"boolean", "/b", "boolean", nil},
+		{"object", "/o", "object", nil},
+		{"array", "/a", "array", nil},
+		{"null", "/n", "null", nil},
+		{"root", "", "object", nil},
+		{"marshaler", "/t", "string", nil},
+		{"mismatch", "/s", "number", ErrTestFailed},
+		{"missing path", "/missing", "null", ErrPathNotFound},
+		{"unknown type", "/s", "text", ErrInvalidOperation},
+		{"type not a string", "/s", 1, ErrInvalidOperation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{
+				"s": "x", "f": 1.5, "i": float64(2), "big": json.Number("9007199254740993"),
+				"b": false, "o": map[string]any{}, "a": []any{}, "n": nil,
+				"t": time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			}
+			err := Apply(doc, []map[string]any{{"op": "type", "path": tt.path, "value": tt.typ}})
+			if tt.expectedError == nil {
+				if err != nil {
+					t.Fatalf("Apply returned error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("expected %v, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestApplyStringPredicates(t *testing.T) {
+	tests := []struct {
+		name          string
+		op            map[string]any
+		expectedError error
+	}{
+		{"contains", map[string]any{"op": "contains", "path": "/s", "value": "lo Wo"}, nil},
+		{"contains fails", map[string]any{"op": "contains", "path": "/s", "value": "lo wo"}, ErrTestFailed},
+		{"contains ignoring case", map[string]any{"op": "contains", "path": "/s", "value": "lo wo", "ignore_case": true}, nil},
+		{"starts", map[string]any{"op": "starts", "path": "/s", "value": "Hello"}, nil},
+		{"starts fails", map[string]any{"op": "starts", "path": "/s", "value": "World"}, ErrTestFailed},
+		{"ends ignoring case", map[string]any{"op": "ends", "path": "/s", "value": "WORLD", "ignore_case": true}, nil},
+		{"ends fails", map[string]any{"op": "ends", "path": "/s", "value": "Hello"}, ErrTestFailed},
+		{"matches", map[string]any{"op": "matches", "path": "/s", "value": `^H\w+ W`}, nil},
+		{"matches fails", map[string]any{"op": "matches", "path": "/s", "value": `^world`}, ErrTestFailed},
+		{"matches ignoring case", map[string]any{"op": "matches", "path": "/s", "value": `^hello`, "ignore_case": true}, nil},
+		{"not a string", map[string]any{"op": "contains", "path": "/n", "value": "1"}, ErrTestFailed},
+		{"missing path", map[string]any{"op": "starts", "path": "/missing", "value": ""}, ErrPathNotFound},
+		{"bad regexp", map[string]any{"op": "matches", "path": "/s", "value": "("}, ErrInvalidOperation},
+		{"value not a string", map[string]any{"op": "ends", "path": "/s", "value": 1}, ErrInvalidOperation},
+		{"ignore_case not a boolean", map[string]any{"op": "contains", "path": "/s", "value": "", "ignore_case": "yes"}, ErrInvalidOperation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{"s": "Hello World", "n": float64(1)}
+			err := Apply(doc, []map[string]any{tt.op})
+			if tt.expectedError == nil {
+				if err != nil {
+					t.Fatalf("Apply returned error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("expected %v, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestApplyNumberComparison(t *testing.T) {
+	doc := map[string]any{"f": float64(1), "i": 1, "n": json.Number("1.0"), "nested": []any{json.Number("2")}}
+	tests := []struct {
+		path    string
+		value   any
+		numbers NumberComparison
+		equal   bool
+	}{
+		{"/f", 1, NumbersByValue, true},
+		{"/f", 1, NumbersByType, false},
+		{"/f", float64(1), NumbersByType, true},
+		{"/i", 1, NumbersByType, true},
+		{"/n", json.Number("1"), NumbersByType, true},
+		{"/n", json.Number("1"), NumbersByText, false},
+		{"/n", json.Number("1.0"), NumbersByText, true},
+		{"/f", json.Number("1"), NumbersByText, true},
+		{"/i", float64(1), NumbersByText, true},
+		{"/f", "1", NumbersByText, false},
+		{"/nested", []any{json.Number("2.0")}, NumbersByText, false},
+		{"/nested", []any{json.Number("2")}, NumbersByText, true},
+	}
+	for _, tt := range tests {
+		err := ApplyWithOptions(doc, []map[string]any{{"op": "test", "path": tt.path, "value": tt.value}}, Options{Numbers: tt.numbers})
+		if (err == nil) != tt.equal {
+			t.Errorf("test %s == %#v with policy %d: expected equal %v, got %v", tt.path, tt.value, tt.numbers, tt.equal, err)
+		}
+	}
+}
+
+// cents is a fixed-point amount that marshals as a JSON number.
+func TestApplyIncTyping(t *testing.T) {
+	tests := []struct {
+		typing   IncTyping
+		current  any
+		inc      any
+		expected any
+	}{
+		{IncInteger, 10.5, 1.0, 11},
+		{IncInteger, 10, 1, 11},
+		{IncFloat, 10.5, 1.0, 11.5},
+		{IncFloat, 10, 1, 11.0},
+		{IncKeepType, 10.5, 1, 11.5},
+		{IncKeepType, 10, 1.5, 11},
+		{IncKeepType, int64(10), 1, int64(11)},
+		{IncKeepType, int32(10), 1, int32(11)},
+		{IncKeepType, json.Number("10.5"), 1, json.Number("11.5")},
+		{IncKeepType, json.Number("9007199254740993"), json.Number("2"), json.Number("9007199254740995")},
+	}
+	for _, tt := range tests {
+		doc := map[string]any{"n": tt.current}
+		err := ApplyWithOptions(doc, []map[string]any{{"op": "inc", "path": "/n", "inc": tt.inc}}, Options{IncTyping: tt.typing})
+		if err != nil {
+			t.Fatalf("inc %#v by %#v: %v", tt.current, tt.inc, err)
+		}
+		if !reflect.DeepEqual(doc["n"], tt.expected) {
+			t.Errorf("inc %#v by %#v with policy %d: got %#v, expected %#v", tt.current, tt.inc, tt.typing, doc["n"], tt.expected)
+		}
+	}
+}
+
+func TestApplyLargeIntegers(t *testing.T) {
+	out, err := ApplyBytes(
+		[]byte(`{"id": 9007199254740993, "n": 9007199254740993, "big": 9223372036854775806}`),
+		[]byte(`[
+			{"op": "test", "path": "/id", "value": 9007199254740993},
+			{"op": "less", "path": "/id", "value": 9007199254740994},
+			{"op": "inc", "path": "/n", "inc": 2},
+			{"op": "inc", "path": "/big", "inc": 1}
+		]`),
+	)
+	if err != nil {
+		t.Fatalf("ApplyBytes returned error: %v", err)
+	}
+	expected := `{"big":9223372036854775807,"id":9007199254740993,"n":9007199254740995}`
+	if string(out) != expected {
+		t.Fatalf("Documents not equal.\nGot: %s\nExpected: %s", out, expected)
+	}
+
+	// 2^53+1 and 2^53 are the same float64, but different integers.
+	doc := map[string]any{"id": json.Number("9007199254740993"), "i": int64(1) << 60}
+	for _, op := range []map[string]any{
+		{"op": "test", "path": "/id", "value": json.Number("9007199254740992")},
+		{"op": "test", "path": "/id", "value": int64(9007199254740992)},
+		{"op": "more", "path": "/id", "value": json.Number("9007199254740993")},
+		{"op": "test", "path": "/i", "value": int64(1)<<60 + 1},
+	} {
+		if err := Apply(doc, []map[string]any{op}); !errors.Is(err, ErrTestFailed) {
+			t.Errorf("%v: expected ErrTestFailed, got %v", op, err)
+		}
+	}
+	if err := Apply(doc, []map[string]any{{"op": "test", "path": "/id", "value": int64(9007199254740993)}}); err != nil {
+		t.Errorf("expected equal integers, got %v", err)
+	}
+}
+
+type cents int64
+
+func (c cents) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d.%02d", c/100, c%100)), nil
+}
+
+func TestApplyMarshalerLeaves(t *testing.T) {
+	when := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	var missing *time.Time
+	doc := map[string]any{"price": cents(1250), "at": when, "none": missing, "log": []any{when}}
+	ops := []map[string]any{
+		{"op": "test", "path": "/price", "value": 12.5},
+		{"op": "test", "path": "/at", "value": "2024-05-01T09:00:00Z"},
+		{"op": "test", "path": "/none", "value": nil},
+		{"op": "less", "path": "/price", "value": cents(1300)},
+		{"op": "test", "path": "/log", "value": []any{"2024-05-01T09:00:00Z"}},
+		{"op": "replace", "path": "/price", "value": cents(99)},
+	}
+	if err := Apply(doc, ops); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if doc["price"] != cents(99) {
+		t.Fatalf("expected the leaf to be stored as is, got %#v", doc["price"])
+	}
+	err := Apply(doc, []map[string]any{{"op": "test", "path": "/at", "value": "2024-05-01T10:00:00Z"}})
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("expected the test to fail, got %v", err)
+	}
+}
+
+func TestApplyDocuments(t *testing.T) {
+	profiles := map[string]any{"alice": map[string]any{"name": "Alice", "tags": []any{"admin"}}}
+	inbox := []any{"hello", "bye"}
+	opts := Options{Documents: map[string]any{"profiles": profiles, "inbox": inbox}}
+
+	doc := map[string]any{"messages": []any{}}
+	ops := []map[string]any{
+		{"op": "copy", "from": "profiles#/alice", "path": "/author"},
+		{"op": "move", "from": "inbox#/0", "path": "/messages/-"},
+		{"op": "add", "path": "/author/tags/-", "value": "editor"},
+	}
+	if err := ApplyWithOptions(doc, ops, opts); err != nil {
+		t.Fatalf("ApplyWithOptions returned error: %v", err)
+	}
+	expected := map[string]any{
+		"author":   map[string]any{"name": "Alice", "tags": []any{"admin", "editor"}},
+		"messages": []any{"hello"},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("Documents not equal.\nGot:      %v\nExpected: %v", doc, expected)
+	}
+	if tags := profiles["alice"].(map[string]any)["tags"]; !reflect.DeepEqual(tags, []any{"admin"}) {
+		t.Fatalf("copy shares containers with its source: %v", tags)
+	}
+	if got := opts.Documents["inbox"]; !reflect.DeepEqual(got, []any{"bye"}) {
+		t.Fatalf("expected the moved value to be removed from its document, got %v", got)
+	}
+
+	root, err := ApplyValueWithOptions(nil, []map[string]any{{"op": "copy", "from": "profiles#", "path": ""}}, opts)
+	if err != nil || !reflect.DeepEqual(root, profiles) {
+		t.Fatalf("unexpected root copy %v, %v", root, err)
+	}
+
+	for _, tc := range []struct {
+		from          string
+		expectedError string
+	}{
+		{from: "missing#/a", expectedError: "unknown document \"missing\""},
+		{from: "profiles#/bob", expectedError: "document \"profiles\": path segment \"bob\" not found"},
+		{from: "profiles/alice", expectedError: "path segment \"profiles\" not found"},
+	} {
+		err := ApplyWithOptions(map[string]any{}, []map[string]any{{"op": "copy", "from": tc.from, "path": "/x"}}, opts)
+		if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+			t.Fatalf("from %q: expected error containing %q, got %v", tc.from, tc.expectedError, err)
+		}
+	}
+}
+
+func TestApplyValue(t *testing.T) {
+	testCases := []struct {
+		name          string
+		initialDoc    any
+		ops           []map[string]any
+		expectedDoc   any
+		expectedError string
+	}{
+		{
+			name:        "append to array root",
+			initialDoc:  []any{1, 2},
+			ops:         []map[string]any{{"op": "add", "path": "/-", "value": 3}},
+			expectedDoc: []any{1, 2, 3},
+		},
+		{
+			name:        "insert and remove at array root",
+			initialDoc:  []any{"a", "c"},
+			ops:         []map[string]any{{"op": "add", "path": "/1", "value": "b"}, {"op": "remove", "path": "/0"}},
+			expectedDoc: []any{"b", "c"},
+		},
+		{
+			name:        "move within array root",
+			initialDoc:  []any{1, 2, 3},
+			ops:         []map[string]any{{"op": "move", "from": "/0", "path": "/2"}},
+			expectedDoc: []any{2, 3, 1},
+		},
+		{
+			name:        "nested array inside array root",
+			initialDoc:  []any{[]any{1}},
+			ops:         []map[string]any{{"op": "add", "path": "/0/-", "value": 2}},
+			expectedDoc: []any{[]any{1, 2}},
+		},
+		{
+			name:        "replace scalar root",
+			initialDoc:  "old",
+			ops:         []map[string]any{{"op": "replace", "path": "", "value": 42}},
+			expectedDoc: 42,
+		},
+		{
+			name:        "replace object root with array",
+			initialDoc:  map[string]any{"a": 1},
+			ops:         []map[string]any{{"op": "add", "path": "", "value": []any{"x"}}},
+			expectedDoc: []any{"x"},
+		},
+		{
+			name:        "remove root",
+			initialDoc:  []any{1},
+			ops:         []map[string]any{{"op": "remove", "path": ""}},
+			expectedDoc: nil,
+		},
+		{
+			name:        "string ops on string root",
+			initialDoc:  "world",
+			ops:         []map[string]any{{"op": "str_ins", "path": "", "pos": 0, "str": "hello "}, {"op": "str_del", "path": "", "pos": 5, "len": 1}},
+			expectedDoc: "helloworld",
+		},
+		{
+			name:        "inc number root",
+			initialDoc:  1,
+			ops:         []map[string]any{{"op": "inc", "path": "", "inc": 2}},
+			expectedDoc: 3,
+		},
+		{
+			name:        "test and copy onto root",
+			initialDoc:  map[string]any{"a": []any{1}},
+			ops:         []map[string]any{{"op": "test", "path": "", "value": map[string]any{"a": []any{1}}}, {"op": "copy", "from": "/a", "path": ""}},
+			expectedDoc: []any{1},
+		},
+		{
+			name:          "failed test on scalar root",
+			initialDoc:    true,
+			ops:           []map[string]any{{"op": "test", "path": "", "value": false}},
+			expectedError: "test operation failed at path \"\"",
+		},
+		{
+			name:          "pointer into scalar root",
+			initialDoc:    "text",
+			ops:           []map[string]any{{"op": "add", "path": "/a", "value": 1}},
+			expectedError: "traverses a non-container",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ApplyValue(tc.initialDoc, tc.ops)
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					t.Fatalf("Expected error containing %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, but got: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expectedDoc) {
+				t.Fatalf("Documents not equal.\nGot:      %#v\nExpected: %#v", got, tc.expectedDoc)
+			}
+		})
+	}
+}
@@ -0,0 +1,469 @@
+package jsonpatch
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// With Options.JSONPath, the path of an op may be a JSONPath expression
+// starting with "$" instead of a JSON Pointer. The supported selectors are
+// .name and ['name'], [n] with negative indices counting from the end, .*
+// and [*], and filters such as [?(@.id == 'x')] or [?@.done], which compare
+// a value below the element with ==, !=, <, <=, > or >= against a string,
+// number, boolean or null, or check that it exists, and can be combined
+// with && and ||.
+
+// pathSelector is one step of a JSONPath expression.
+type pathSelector struct {
+	kind   selectorKind
+	name   string
+	index  int
+	filter [][]pathCondition // conditions or-ed over and-ed groups
+}
+
+type selectorKind int
+
+const (
+	selectName selectorKind = iota
+	selectIndex
+	selectAll
+	selectFilter
+)
+
+// pathCondition is a comparison in a filter. Without op, it checks that the
+// value at path exists.
+type pathCondition struct {
+	path  []pathSelector
+	op    string
+	value any
+}
+
+// pathMatch is a value selected by a JSONPath expression.
+type pathMatch struct {
+	pointer string
+	value   any
+}
+
+// isJSONPath reports whether pathRaw is a JSONPath expression rather than a
+// JSON Pointer.
+func isJSONPath(pathRaw string) bool {
+	return strings.HasPrefix(pathRaw, "$")
+}
+
+// applyJSONPath applies op, the operation at index i, whose path is the
+// JSONPath expression pathRaw, to every value the expression selects. They
+// are taken last first, so that removing array elements does not shift the
+// ones still to come.
+func (a *applier) applyJSONPath(i int, op map[string]any, pathRaw string) error {
+	selectors, err := parseJSONPath(pathRaw)
+	if err != nil {
+		return err
+	}
+	pointers := a.selectPointers(selectors)
+	if len(pointers) == 0 {
+		if op["op"] == "undefined" {
+			// Nothing is selected, so nothing is defined.
+			return nil
+		}
+		return errorf(ErrPathNotFound, "JSONPath %q matches nothing", pathRaw)
+	}
+	for _, pointer := range slices.Backward(pointers) {
+		// A JSONPath can select every element of a huge array.
+		if err := a.canceled(); err != nil {
+			return err
+		}
+		target := maps.Clone(op)
+		target["path"] = pointer
+		if err := a.applyTarget(i, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectPointers returns the pointers selectors lead to in document order.
+// The last selector, when it names a single member or index, does not need
+// to exist, so that add can create it.
+func (a *applier) selectPointers(selectors []pathSelector) []string {
+	if len(selectors) == 0 {
+		return []string{""}
+	}
+	matches := []pathMatch{{pointer: "", value: a.root}}
+	for _, selector := range selectors[:len(selectors)-1] {
+		matches = a.selectChildren(matches, selector)
+	}
+	last := selectors[len(selectors)-1]
+	var pointers []string
+	switch last.kind {
+	case selectName:
+		for _, m := range matches {
+			pointers = append(pointers, m.pointer+"/"+pointerEscaper.Replace(last.name))
+		}
+	case selectIndex:
+		for _, m := range matches {
+			index := last.index
+			if index < 0 {
+				s, ok := m.value.([]any)
+				if !ok || len(s)+index < 0 {
+					continue
+				}
+				index += len(s)
+			}
+			pointers = append(pointers, m.pointer+"/"+strconv.Itoa(index))
+		}
+	default:
+		for _, m := range a.selectChildren(matches, last) {
+			pointers = append(pointers, m.pointer)
+		}
+	}
+	return pointers
+}
+
+// selectChildren applies selector to each of matches.
+func (a *applier) selectChildren(matches []pathMatch, selector pathSelector) []pathMatch {
+	var out []pathMatch
+	for _, m := range matches {
+		switch selector.kind {
+		case selectName, selectIndex:
+			if v, ok := selectOne(m.value, selector); ok {
+				out = append(out, pathMatch{m.pointer + "/" + selectorSegment(m.value, selector), v})
+			}
+		default:
+			switch container := m.value.(type) {
+			case map[string]any:
+				for _, k := range slices.Sorted(maps.Keys(container)) {
+					if selector.kind == selectAll || a.matchesFilter(container[k], selector.filter) {
+						out = append(out, pathMatch{m.pointer + "/" + pointerEscaper.Replace(k), container[k]})
+					}
+				}
+			case []any:
+				for i, v := range container {
+					if selector.kind == selectAll || a.matchesFilter(v, selector.filter) {
+						out = append(out, pathMatch{m.pointer + "/" + strconv.Itoa(i), v})
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// selectOne returns the member or element a name or index selector picks
+// from v.
+func selectOne(v any, selector pathSelector) (any, bool) {
+	switch container := v.(type) {
+	case map[string]any:
+		if selector.kind == selectName {
+			child, ok := container[selector.name]
+			return child, ok
+		}
+	case []any:
+		if selector.kind == selectIndex {
+			index := selector.index
+			if index < 0 {
+				index += len(container)
+			}
+			if index >= 0 && index < len(container) {
+				return container[index], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// selectorSegment returns the pointer segment of the member or element
+// selectOne picked from v.
+func selectorSegment(v any, selector pathSelector) string {
+	if selector.kind == selectName {
+		return pointerEscaper.Replace(selector.name)
+	}
+	index := selector.index
+	if s, ok := v.([]any); ok && index < 0 {
+		index += len(s)
+	}
+	return strconv.Itoa(index)
+}
+
+// matchesFilter reports whether v satisfies one of the groups of
+// conditions.
+func (a *applier) matchesFilter(v any, filter [][]pathCondition) bool {
+	for _, group := range filter {
+		matched := true
+		for _, c := range group {
+			if !a.matchesCondition(v, c) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *applier) matchesCondition(v any, c pathCondition) bool {
+	for _, selector := range c.path {
+		var ok bool
+		if v, ok = selectOne(v, selector); !ok {
+			return false
+		}
+	}
+	eq := equality{timestamps: a.opts.Timestamps, numbers: a.opts.Numbers}
+	switch c.op {
+	case "":
+		return true
+	case "==":
+		return eq.equal(v, c.value)
+	case "!=":
+		return !eq.equal(v, c.value)
+	}
+	order, ok := compareValues(v, c.value, a.opts.Timestamps)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+// jsonPathParser parses the JSONPath subset described above.
+type jsonPathParser struct {
+	src string
+	pos int
+}
+
+func parseJSONPath(src string) ([]pathSelector, error) {
+	p := &jsonPathParser{src: src, pos: 1}
+	selectors, err := p.selectors(false)
+	if err == nil && p.pos < len(p.src) {
+		err = p.fail("unexpected %q", p.src[p.pos:])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return selectors, nil
+}
+
+func (p *jsonPathParser) fail(format string, args ...any) error {
+	return errorf(ErrInvalidPointer, "invalid JSONPath %q at offset %d: "+format, append([]any{p.src, p.pos}, args...)...)
+}
+
+// selectors parses selectors up to the end of the expression or, in
+// filters, up to anything that cannot continue one. Filters only allow
+// names and indices.
+func (p *jsonPathParser) selectors(inFilter bool) ([]pathSelector, error) {
+	var selectors []pathSelector
+	for p.pos < len(p.src) {
+		var selector pathSelector
+		var err error
+		switch p.src[p.pos] {
+		case '.':
+			p.pos++
+			selector, err = p.dotSelector(inFilter)
+		case '[':
+			p.pos++
+			selector, err = p.bracketSelector(inFilter)
+		default:
+			if inFilter {
+				return selectors, nil
+			}
+			return nil, p.fail("expected \".\" or \"[\"")
+		}
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+func (p *jsonPathParser) dotSelector(inFilter bool) (pathSelector, error) {
+	if !inFilter && strings.HasPrefix(p.src[p.pos:], "*") {
+		p.pos++
+		return pathSelector{kind: selectAll}, nil
+	}
+	start := p.pos
+	for p.pos < len(p.src) && isNameByte(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return pathSelector{}, p.fail("expected a member name")
+	}
+	return pathSelector{kind: selectName, name: p.src[start:p.pos]}, nil
+}
+
+func (p *jsonPathParser) bracketSelector(inFilter bool) (pathSelector, error) {
+	p.skipSpace()
+	var selector pathSelector
+	switch {
+	case p.pos >= len(p.src):
+		return selector, p.fail("unterminated \"[\"")
+	case p.src[p.pos] == '\'' || p.src[p.pos] == '"':
+		name, err := p.stringLiteral()
+		if err != nil {
+			return selector, err
+		}
+		selector = pathSelector{kind: selectName, name: name}
+	case p.src[p.pos] == '*' && !inFilter:
+		p.pos++
+		selector = pathSelector{kind: selectAll}
+	case p.src[p.pos] == '?' && !inFilter:
+		p.pos++
+		filter, err := p.filter()
+		if err != nil {
+			return selector, err
+		}
+		selector = pathSelector{kind: selectFilter, filter: filter}
+	default:
+		start := p.pos
+		if p.src[p.pos] == '-' {
+			p.pos++
+		}
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		index, err := strconv.Atoi(p.src[start:p.pos])
+		if err != nil {
+			p.pos = start
+			return selector, p.fail("expected an index, a quoted name, \"*\" or a filter")
+		}
+		selector = pathSelector{kind: selectIndex, index: index}
+	}
+	p.skipSpace()
+	if !p.consume("]") {
+		return selector, p.fail("expected \"]\"")
+	}
+	return selector, nil
+}
+
+// filter parses the conditions of a filter selector, with or without
+// parentheses around them.
+func (p *jsonPathParser) filter() ([][]pathCondition, error) {
+	p.skipSpace()
+	parenthesized := p.consume("(")
+	var filter [][]pathCondition
+	var group []pathCondition
+	for {
+		c, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		group = append(group, c)
+		p.skipSpace()
+		if p.consume("&&") {
+			continue
+		}
+		filter = append(filter, group)
+		group = nil
+		if !p.consume("||") {
+			break
+		}
+	}
+	if parenthesized && !p.consume(")") {
+		return nil, p.fail("expected \")\"")
+	}
+	return filter, nil
+}
+
+func (p *jsonPathParser) condition() (pathCondition, error) {
+	p.skipSpace()
+	if !p.consume("@") {
+		return pathCondition{}, p.fail("expected \"@\"")
+	}
+	path, err := p.selectors(true)
+	if err != nil {
+		return pathCondition{}, err
+	}
+	c := pathCondition{path: path}
+	p.skipSpace()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			c.op = op
+			break
+		}
+	}
+	if c.op == "" {
+		return c, nil
+	}
+	p.skipSpace()
+	c.value, err = p.literal()
+	return c, err
+}
+
+// literal parses a string, number, boolean or null to compare against.
+func (p *jsonPathParser) literal() (any, error) {
+	if p.pos < len(p.src) && (p.src[p.pos] == '\'' || p.src[p.pos] == '"') {
+		return p.stringLiteral()
+	}
+	switch {
+	case p.consume("true"):
+		return true, nil
+	case p.consume("false"):
+		return false, nil
+	case p.consume("null"):
+		return nil, nil
+	}
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte("+-.0123456789eE", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	n, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.fail("expected a string, number, boolean or null")
+	}
+	return n, nil
+}
+
+// stringLiteral parses a single- or double-quoted string, in which a
+// backslash escapes the next character.
+func (p *jsonPathParser) stringLiteral() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var builder strings.Builder
+	for p.pos < len(p.src) {
+		ch := p.src[p.pos]
+		p.pos++
+		switch {
+		case ch == quote:
+			return builder.String(), nil
+		case ch == '\\' && p.pos < len(p.src):
+			builder.WriteByte(p.src[p.pos])
+			p.pos++
+		default:
+			builder.WriteByte(ch)
+		}
+	}
+	return "", p.fail("unterminated string")
+}
+
+func (p *jsonPathParser) consume(token string) bool {
+	if strings.HasPrefix(p.src[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *jsonPathParser) skipSpace() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// isNameByte reports whether b can appear in a member name written after
+// a ".".
+func isNameByte(b byte) bool {
+	return b == '_' || b == '-' || b >= 0x80 ||
+		(b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
@@ -0,0 +1,103 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestApplyJSONPath(t *testing.T) {
+	const src = `{"items": [{"id": "x", "name": "a", "qty": 1}, {"id": "y", "name": "b", "qty": 5}, {"id": "x", "name": "c", "qty": 9}], "meta": {"a.b": 1, "n": 2}}`
+	tests := []struct {
+		name     string
+		ops      []Operation
+		expected string
+		err      error
+	}{
+		{
+			name:     "replace by filter",
+			ops:      []Operation{{"op": "replace", "path": "$.items[?(@.id=='x')].name", "value": "z"}},
+			expected: `{"items": [{"id": "x", "name": "z", "qty": 1}, {"id": "y", "name": "b", "qty": 5}, {"id": "x", "name": "z", "qty": 9}], "meta": {"a.b": 1, "n": 2}}`,
+		},
+		{
+			name:     "filter without parentheses and with a number",
+			ops:      []Operation{{"op": "add", "path": "$.items[?@.qty >= 5].big", "value": true}},
+			expected: `{"items": [{"id": "x", "name": "a", "qty": 1}, {"id": "y", "name": "b", "qty": 5, "big": true}, {"id": "x", "name": "c", "qty": 9, "big": true}], "meta": {"a.b": 1, "n": 2}}`,
+		},
+		{
+			name:     "remove several array elements",
+			ops:      []Operation{{"op": "remove", "path": "$.items[?(@.id == \"x\" || @.qty < 2)]"}},
+			expected: `{"items": [{"id": "y", "name": "b", "qty": 5}], "meta": {"a.b": 1, "n": 2}}`,
+		},
+		{
+			name:     "and",
+			ops:      []Operation{{"op": "inc", "path": "$.items[?(@.id == 'x' && @.qty > 1)].qty", "inc": 1}},
+			expected: `{"items": [{"id": "x", "name": "a", "qty": 1}, {"id": "y", "name": "b", "qty": 5}, {"id": "x", "name": "c", "qty": 10}], "meta": {"a.b": 1, "n": 2}}`,
+		},
+		{
+			name:     "wildcard, negative index and quoted name",
+			ops:      []Operation{{"op": "replace", "path": "$.items[*].qty", "value": 0}, {"op": "remove", "path": "$.items[-1]"}, {"op": "remove", "path": "$.meta['a.b']"}},
+			expected: `{"items": [{"id": "x", "name": "a", "qty": 0}, {"id": "y", "name": "b", "qty": 0}], "meta": {"n": 2}}`,
+		},
+		{
+			name: "test every match",
+			ops:  []Operation{{"op": "test", "path": "$.items[?(@.name)].id", "value": "x"}},
+			err:  ErrTestFailed,
+		},
+		{
+			name: "no match",
+			ops:  []Operation{{"op": "remove", "path": "$.items[?(@.id == 'none')]"}},
+			err:  ErrPathNotFound,
+		},
+		{
+			name:     "undefined with no match",
+			ops:      []Operation{{"op": "undefined", "path": "$.items[?(@.id == 'none')]"}, {"op": "defined", "path": "$.items[*].qty"}},
+			expected: src,
+		},
+		{
+			name: "undefined with a match",
+			ops:  []Operation{{"op": "undefined", "path": "$.items[?(@.id == 'y')]"}},
+			err:  ErrTestFailed,
+		},
+		{
+			name: "malformed",
+			ops:  []Operation{{"op": "remove", "path": "$.items[?(@.id == 'x']"}},
+			err:  ErrInvalidPointer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc map[string]any
+			if err := json.Unmarshal([]byte(src), &doc); err != nil {
+				t.Fatal(err)
+			}
+			err := ApplyWithOptions(doc, tt.ops, Options{JSONPath: true})
+			if tt.err != nil {
+				var opErr *OpError
+				if !errors.Is(err, tt.err) || !errors.As(err, &opErr) || opErr.Index != 0 {
+					t.Fatalf("expected %v from op 0, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyWithOptions returned error: %v", err)
+			}
+			var expected map[string]any
+			if err := json.Unmarshal([]byte(tt.expected), &expected); err != nil {
+				t.Fatal(err)
+			}
+			if !jsonEqual(doc, expected) {
+				t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", doc, expected)
+			}
+		})
+	}
+
+	// Without the option, "$" is an ordinary member name.
+	doc := map[string]any{}
+	if err := Apply(doc, []Operation{{"op": "add", "path": "$.a", "value": 1}}); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if _, ok := doc["$.a"]; !ok {
+		t.Fatalf("expected member \"$.a\", got %v", doc)
+	}
+}
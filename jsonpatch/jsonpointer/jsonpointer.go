@@ -0,0 +1,269 @@
+// Package jsonpointer resolves and edits RFC 6901 JSON Pointers in documents
+// decoded by encoding/json, for code that needs pointers outside of
+// patching. It is the pointer handling jsonpatch uses, and its errors wrap
+// the same sentinels, so jsonpatch.ErrPathNotFound and ErrNotFound are one
+// error.
+//
+// Pointers must be empty, referring to the whole document, or start with
+// "/". Array indices are "0" or digits without a leading zero; "-" names
+// the element after the last one, which only Set accepts, to append.
+// Functions that modify a document do so in place, like jsonpatch.Apply,
+// and return its root, which changes only when the pointer is empty.
+package jsonpointer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Errors returned by this package wrap one of these, so that callers can
+// tell failures apart with errors.Is.
+var (
+	// ErrNotFound is returned when a pointer refers to a member that does
+	// not exist.
+	ErrNotFound = errors.New("path not found")
+	// ErrOutOfBounds is returned for array indices past the end of the
+	// array.
+	ErrOutOfBounds = errors.New("index out of bounds")
+	// ErrInvalid is returned for malformed pointers, including array
+	// segments that are not indices.
+	ErrInvalid = errors.New("invalid JSON pointer")
+	// ErrTypeMismatch is returned when a pointer traverses a value that is
+	// neither an object nor an array.
+	ErrTypeMismatch = errors.New("type mismatch")
+)
+
+// pointerError is an error wrapping one of the sentinel errors above. Its
+// message is that of err alone, so the sentinel does not show up in it.
+type pointerError struct {
+	kind error
+	err  error
+}
+
+func (e *pointerError) Error() string   { return e.err.Error() }
+func (e *pointerError) Unwrap() []error { return []error{e.kind, e.err} }
+
+func errorf(kind error, format string, args ...any) error {
+	return &pointerError{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+var escaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// Escape escapes "~" and "/" in a member name so that it can be used as a
+// pointer segment.
+func Escape(token string) string {
+	return escaper.Replace(token)
+}
+
+// Unescape decodes the "~0" and "~1" escapes of a pointer segment.
+func Unescape(segment string) (string, error) {
+	if strings.IndexByte(segment, '~') == -1 {
+		return segment, nil
+	}
+	var builder strings.Builder
+	builder.Grow(len(segment))
+	for i := 0; i < len(segment); i++ {
+		ch := segment[i]
+		if ch != '~' {
+			builder.WriteByte(ch)
+			continue
+		}
+		if i+1 >= len(segment) {
+			return "", errorf(ErrInvalid, "invalid escape sequence \"~\" at end of segment %q", segment)
+		}
+		switch segment[i+1] {
+		case '0':
+			builder.WriteByte('~')
+		case '1':
+			builder.WriteByte('/')
+		default:
+			return "", errorf(ErrInvalid, "invalid escape sequence \"~%c\" in segment %q", segment[i+1], segment)
+		}
+		i++
+	}
+	return builder.String(), nil
+}
+
+// Parse splits pointer into its unescaped segments. The empty pointer has
+// none.
+func Parse(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errorf(ErrInvalid, "pointer %q must be empty or start with \"/\"", pointer)
+	}
+	segments := strings.Split(pointer[1:], "/")
+	for i, segment := range segments {
+		decoded, err := Unescape(segment)
+		if err != nil {
+			return nil, errorf(ErrInvalid, "invalid JSON pointer %q: %w", pointer, err)
+		}
+		segments[i] = decoded
+	}
+	return segments, nil
+}
+
+// Format returns the pointer made of segments, the inverse of Parse.
+func Format(segments []string) string {
+	var builder strings.Builder
+	for _, segment := range segments {
+		builder.WriteByte('/')
+		builder.WriteString(escaper.Replace(segment))
+	}
+	return builder.String()
+}
+
+// ParseIndex parses an array index segment. RFC 6901 only allows "0" or
+// digits without a leading zero, so forms like "01" or "+1" are rejected.
+func ParseIndex(segment string) (int, error) {
+	if segment == "" || (len(segment) > 1 && segment[0] == '0') {
+		return 0, strconv.ErrSyntax
+	}
+	for i := 0; i < len(segment); i++ {
+		if segment[i] < '0' || segment[i] > '9' {
+			return 0, strconv.ErrSyntax
+		}
+	}
+	return strconv.Atoi(segment)
+}
+
+// Get returns the value at pointer in doc.
+func Get(doc any, pointer string) (any, error) {
+	segments, err := Parse(pointer)
+	if err != nil {
+		return nil, err
+	}
+	current := doc
+	for _, segment := range segments {
+		if current, err = child(current, segment, pointer); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+// Exists reports whether pointer refers to a value in doc.
+func Exists(doc any, pointer string) bool {
+	_, err := Get(doc, pointer)
+	return err == nil
+}
+
+// Set stores value at pointer in doc, adding the member if the object does
+// not have it, replacing the element at an existing array index, or
+// appending to the array for "-". The objects and arrays the pointer goes
+// through must exist. It returns the root of the document.
+func Set(doc any, pointer string, value any) (any, error) {
+	segments, err := Parse(pointer)
+	if err != nil {
+		return nil, err
+	}
+	return set(doc, segments, pointer, value)
+}
+
+func set(current any, segments []string, pointer string, value any) (any, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	segment := segments[0]
+	if len(segments) == 1 {
+		switch container := current.(type) {
+		case map[string]any:
+			container[segment] = value
+			return container, nil
+		case []any:
+			if segment == "-" {
+				return append(container, value), nil
+			}
+		}
+	}
+	next, err := child(current, segment, pointer)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := set(next, segments[1:], pointer, value)
+	if err != nil {
+		return nil, err
+	}
+	replace(current, segment, updated)
+	return current, nil
+}
+
+// Delete removes the value at pointer from doc, shifting the array elements
+// after it down. The whole document cannot be deleted. It returns the root
+// of the document.
+func Delete(doc any, pointer string) (any, error) {
+	segments, err := Parse(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return nil, errorf(ErrInvalid, "cannot delete the whole document")
+	}
+	return remove(doc, segments, pointer)
+}
+
+func remove(current any, segments []string, pointer string) (any, error) {
+	segment := segments[0]
+	next, err := child(current, segment, pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 1 {
+		switch container := current.(type) {
+		case map[string]any:
+			delete(container, segment)
+			return container, nil
+		case []any:
+			index, _ := ParseIndex(segment)
+			copy(container[index:], container[index+1:])
+			container[len(container)-1] = nil
+			return container[:len(container)-1], nil
+		}
+	}
+	updated, err := remove(next, segments[1:], pointer)
+	if err != nil {
+		return nil, err
+	}
+	replace(current, segment, updated)
+	return current, nil
+}
+
+// child returns the member or element segment names in current.
+func child(current any, segment, pointer string) (any, error) {
+	switch container := current.(type) {
+	case map[string]any:
+		value, ok := container[segment]
+		if !ok {
+			return nil, errorf(ErrNotFound, "path segment %q not found in map for path %q", segment, pointer)
+		}
+		return value, nil
+	case []any:
+		if segment == "-" {
+			return nil, errorf(ErrOutOfBounds, "index \"-\" refers past the end of the slice (len %d) in path %q", len(container), pointer)
+		}
+		index, err := ParseIndex(segment)
+		if err != nil {
+			return nil, errorf(ErrInvalid, "path segment %q is not a valid integer index for slice in path %q", segment, pointer)
+		}
+		if index >= len(container) {
+			return nil, errorf(ErrOutOfBounds, "index %d out of bounds for slice (len %d) at segment %q in path %q", index, len(container), segment, pointer)
+		}
+		return container[index], nil
+	}
+	return nil, errorf(ErrTypeMismatch, "path %q traverses a non-container (neither map nor slice) at segment %q (value type: %T)", pointer, segment, current)
+}
+
+// replace stores value as the member or element segment names in current,
+// which child has already found.
+func replace(current any, segment string, value any) {
+	switch container := current.(type) {
+	case map[string]any:
+		container[segment] = value
+	case []any:
+		index, _ := ParseIndex(segment)
+		container[index] = value
+	}
+}
@@ -0,0 +1,131 @@
+package jsonpointer
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, src string) any {
+	t.Helper()
+	var doc any
+	if err := json.Unmarshal([]byte(src), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		pointer  string
+		expected []string
+		err      error
+	}{
+		{"", []string{}, nil},
+		{"/", []string{""}, nil},
+		{"/a~1b/c~0d/0", []string{"a/b", "c~d", "0"}, nil},
+		{"a", nil, ErrInvalid},
+		{"/a~2", nil, ErrInvalid},
+		{"/a~", nil, ErrInvalid},
+	}
+	for _, tt := range tests {
+		segments, err := Parse(tt.pointer)
+		if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+			t.Fatalf("Parse(%q) error = %v, expected %v", tt.pointer, err, tt.err)
+		}
+		if !reflect.DeepEqual(segments, tt.expected) {
+			t.Fatalf("Parse(%q) = %q, expected %q", tt.pointer, segments, tt.expected)
+		}
+		if err == nil && Format(segments) != tt.pointer {
+			t.Fatalf("Format(%q) = %q, expected %q", segments, Format(segments), tt.pointer)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	// The examples of RFC 6901, section 5.
+	doc := decode(t, `{"foo": ["bar", "baz"], "": 0, "a/b": 1, "c%d": 2, "e^f": 3, "g|h": 4, "i\\j": 5, "k\"l": 6, " ": 7, "m~n": 8}`)
+	tests := []struct {
+		pointer  string
+		expected any
+		err      error
+	}{
+		{"", doc, nil},
+		{"/foo", []any{"bar", "baz"}, nil},
+		{"/foo/0", "bar", nil},
+		{"/", float64(0), nil},
+		{"/a~1b", float64(1), nil},
+		{"/c%d", float64(2), nil},
+		{"/i\\j", float64(5), nil},
+		{"/ ", float64(7), nil},
+		{"/m~0n", float64(8), nil},
+		{"/missing", nil, ErrNotFound},
+		{"/foo/2", nil, ErrOutOfBounds},
+		{"/foo/-", nil, ErrOutOfBounds},
+		{"/foo/01", nil, ErrInvalid},
+		{"/foo/0/x", nil, ErrTypeMismatch},
+	}
+	for _, tt := range tests {
+		value, err := Get(doc, tt.pointer)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Get(%q) error = %v, expected %v", tt.pointer, err, tt.err)
+			}
+			if Exists(doc, tt.pointer) {
+				t.Fatalf("Exists(%q) = true", tt.pointer)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Get(%q) returned error: %v", tt.pointer, err)
+		}
+		if !reflect.DeepEqual(value, tt.expected) {
+			t.Fatalf("Get(%q) = %v, expected %v", tt.pointer, value, tt.expected)
+		}
+		if !Exists(doc, tt.pointer) {
+			t.Fatalf("Exists(%q) = false", tt.pointer)
+		}
+	}
+}
+
+func TestSetAndDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     func(doc any) (any, error)
+		expected string
+		err      error
+	}{
+		{"add member", func(doc any) (any, error) { return Set(doc, "/a/new", true) }, `{"a": {"b": [1, 2], "new": true}, "c": "d"}`, nil},
+		{"replace element", func(doc any) (any, error) { return Set(doc, "/a/b/1", "x") }, `{"a": {"b": [1, "x"]}, "c": "d"}`, nil},
+		{"append", func(doc any) (any, error) { return Set(doc, "/a/b/-", 3) }, `{"a": {"b": [1, 2, 3]}, "c": "d"}`, nil},
+		{"replace root", func(doc any) (any, error) { return Set(doc, "", []any{}) }, `[]`, nil},
+		{"set past the end", func(doc any) (any, error) { return Set(doc, "/a/b/2", 3) }, "", ErrOutOfBounds},
+		{"set under a missing member", func(doc any) (any, error) { return Set(doc, "/x/y", 1) }, "", ErrNotFound},
+		{"set under a string", func(doc any) (any, error) { return Set(doc, "/c/0", 1) }, "", ErrTypeMismatch},
+		{"delete member", func(doc any) (any, error) { return Delete(doc, "/c") }, `{"a": {"b": [1, 2]}}`, nil},
+		{"delete element", func(doc any) (any, error) { return Delete(doc, "/a/b/0") }, `{"a": {"b": [2]}, "c": "d"}`, nil},
+		{"delete missing member", func(doc any) (any, error) { return Delete(doc, "/a/x") }, "", ErrNotFound},
+		{"delete root", func(doc any) (any, error) { return Delete(doc, "") }, "", ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := decode(t, `{"a": {"b": [1, 2]}, "c": "d"}`)
+			result, err := tt.edit(doc)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("returned error: %v", err)
+			}
+			got, _ := json.Marshal(result)
+			want, _ := json.Marshal(decode(t, tt.expected))
+			if string(got) != string(want) {
+				t.Fatalf("Documents not equal.\nGot: %s\nExpected: %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Package live provides a JSON document that many goroutines can read and
+// patch safely.
+//
+// Writers are serialized internally and readers never wait for them: every
+// successful patch publishes a new immutable snapshot. Patching copies only
+// the containers on the paths an operation touches and shares everything else
+// with the previous snapshot, so snapshots are cheap to keep around.
+package live
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// Snapshot is the document as of a revision. Doc must not be modified; it
+// stays valid after later patches.
+type Snapshot struct {
+	Rev int64
+	Doc any
+}
+
+// Document is a JSON document safe for concurrent use.
+type Document struct {
+	writer  sync.Mutex
+	current atomic.Pointer[Snapshot]
+}
+
+// New returns a document at revision 0 holding doc. The document takes
+// ownership of doc, which must not be modified afterwards.
+func New(doc any) *Document {
+	d := &Document{}
+	d.current.Store(&Snapshot{Doc: doc})
+	return d
+}
+
+// Snapshot returns the latest snapshot.
+func (d *Document) Snapshot() Snapshot {
+	return *d.current.Load()
+}
+
+// Rev returns the latest revision.
+func (d *Document) Rev() int64 {
+	return d.current.Load().Rev
+}
+
+// Read calls fn with the latest document. fn must not modify it, but may keep
+// it: later patches leave it unchanged.
+func (d *Document) Read(fn func(doc any)) {
+	fn(d.current.Load().Doc)
+}
+
+// Patch applies ops to the latest document and returns the new revision.
+// Patches are applied one at a time, each to the result of the previous one.
+// A patch that fails leaves the document unchanged and returns the current
+// revision with the error.
+func (d *Document) Patch(ops []jsonpatch.Operation) (int64, error) {
+	d.writer.Lock()
+	defer d.writer.Unlock()
+
+	current := d.current.Load()
+	c := cow{owned: map[unsafe.Pointer]bool{}}
+	doc := current.Doc
+	for _, op := range ops {
+		// Operation values become part of the document, so they are copied
+		// to keep the caller from changing a published snapshot.
+		op = clone(op).(map[string]any)
+		for _, key := range []string{"path", "from"} {
+			if raw, ok := op[key].(string); ok {
+				doc = c.prepare(doc, splitPointer(raw))
+			}
+		}
+		var err error
+		if doc, err = jsonpatch.ApplyValue(doc, []jsonpatch.Operation{op}); err != nil {
+			return current.Rev, err
+		}
+	}
+	next := &Snapshot{Rev: current.Rev + 1, Doc: doc}
+	d.current.Store(next)
+	return next.Rev, nil
+}
+
+// cow tracks the containers copied during one patch, which may be modified
+// in place; all others are shared with published snapshots.
+type cow struct {
+	owned map[unsafe.Pointer]bool
+}
+
+// prepare copies the containers from root to the parent of path that are
+// not owned yet and returns the possibly copied root.
+func (c *cow) prepare(root any, path []string) any {
+	root = c.own(root)
+	current := root
+	for _, segment := range path[:max(len(path)-1, 0)] {
+		switch container := current.(type) {
+		case map[string]any:
+			child, ok := container[segment]
+			if !ok {
+				return root
+			}
+			child = c.own(child)
+			container[segment] = child
+			current = child
+		case []any:
+			i, ok := arrayIndex(segment, len(container))
+			if !ok {
+				return root
+			}
+			child := c.own(container[i])
+			container[i] = child
+			current = child
+		default:
+			return root
+		}
+	}
+	return root
+}
+
+// own returns v if it was copied during this patch, and a shallow copy of it
+// otherwise. Scalars are returned as they are.
+func (c *cow) own(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		if c.owned[reflect.ValueOf(v).UnsafePointer()] {
+			return v
+		}
+		copied := make(map[string]any, len(v))
+		for k, child := range v {
+			copied[k] = child
+		}
+		c.owned[reflect.ValueOf(copied).UnsafePointer()] = true
+		return copied
+	case []any:
+		if len(v) > 0 && c.owned[reflect.ValueOf(v).UnsafePointer()] {
+			return v
+		}
+		// The copy's capacity is its length, so appending to it never writes
+		// into an array a snapshot still uses.
+		copied := make([]any, len(v))
+		copy(copied, v)
+		if len(copied) > 0 {
+			c.owned[reflect.ValueOf(copied).UnsafePointer()] = true
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+func arrayIndex(segment string, length int) (int, bool) {
+	i, err := strconv.Atoi(segment)
+	if err != nil || i < 0 || i >= length || strconv.Itoa(i) != segment {
+		return 0, false
+	}
+	return i, true
+}
+
+// splitPointer splits a JSON Pointer into unescaped segments. Like Apply, it
+// accepts pointers without the leading "/". Malformed escapes are left for
+// ApplyValue to reject.
+func splitPointer(pointer string) []string {
+	if pointer == "" {
+		return nil
+	}
+	segments := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+	}
+	return segments
+}
+
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, child := range v {
+			m[k] = clone(child)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, child := range v {
+			s[i] = clone(child)
+		}
+		return s
+	default:
+		return v
+	}
+}
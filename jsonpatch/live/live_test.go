@@ -0,0 +1,151 @@
+package live
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		patch         []jsonpatch.Operation
+		expected      any
+		expectedError string
+	}{
+		{
+			name:     "add to nested array",
+			patch:    []jsonpatch.Operation{{"op": "add", "path": "/a/list/-", "value": 3}},
+			expected: map[string]any{"a": map[string]any{"list": []any{1, 2, 3}}, "b": map[string]any{"x": "y"}},
+		},
+		{
+			name:     "move between subtrees",
+			patch:    []jsonpatch.Operation{{"op": "move", "from": "/b/x", "path": "/a/x"}},
+			expected: map[string]any{"a": map[string]any{"list": []any{1, 2}, "x": "y"}, "b": map[string]any{}},
+		},
+		{
+			name:     "replace root",
+			patch:    []jsonpatch.Operation{{"op": "replace", "path": "", "value": map[string]any{"c": 1}}},
+			expected: map[string]any{"c": 1},
+		},
+		{
+			name: "several ops on the same container",
+			patch: []jsonpatch.Operation{
+				{"op": "remove", "path": "/a/list/0"},
+				{"op": "add", "path": "/a/list/0", "value": 0},
+				{"op": "str_ins", "path": "/b/x", "pos": 1, "str": "es"},
+			},
+			expected: map[string]any{"a": map[string]any{"list": []any{0, 2}}, "b": map[string]any{"x": "yes"}},
+		},
+		{
+			name: "failed patch changes nothing",
+			patch: []jsonpatch.Operation{
+				{"op": "remove", "path": "/a/list/0"},
+				{"op": "remove", "path": "/missing"},
+			},
+			expectedError: "missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := func() any {
+				return map[string]any{"a": map[string]any{"list": []any{1, 2}}, "b": map[string]any{"x": "y"}}
+			}
+			d := New(original())
+			before := d.Snapshot()
+
+			rev, err := d.Patch(tt.patch)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				if rev != 0 || d.Rev() != 0 {
+					t.Fatalf("expected revision 0, got %d and %d", rev, d.Rev())
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if rev != 1 || d.Rev() != 1 {
+					t.Fatalf("expected revision 1, got %d and %d", rev, d.Rev())
+				}
+				d.Read(func(doc any) {
+					if !reflect.DeepEqual(doc, tt.expected) {
+						t.Fatalf("expected %v, got %v", tt.expected, doc)
+					}
+				})
+			}
+			if !reflect.DeepEqual(before.Doc, original()) {
+				t.Fatalf("earlier snapshot changed: %v", before.Doc)
+			}
+		})
+	}
+}
+
+func TestPatchSharesUntouchedSubtrees(t *testing.T) {
+	d := New(map[string]any{"a": map[string]any{"n": 1}, "b": map[string]any{"n": 2}})
+	before := d.Snapshot().Doc.(map[string]any)
+	if _, err := d.Patch([]jsonpatch.Operation{{"op": "replace", "path": "/a/n", "value": 3}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after := d.Snapshot().Doc.(map[string]any)
+	if reflect.ValueOf(after["b"]).UnsafePointer() != reflect.ValueOf(before["b"]).UnsafePointer() {
+		t.Fatalf("untouched subtree was copied")
+	}
+	if before["a"].(map[string]any)["n"] != 1 {
+		t.Fatalf("earlier snapshot changed: %v", before)
+	}
+}
+
+func TestPatchCopiesOperationValues(t *testing.T) {
+	d := New(map[string]any{})
+	value := map[string]any{"n": 1}
+	if _, err := d.Patch([]jsonpatch.Operation{{"op": "add", "path": "/v", "value": value}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	value["n"] = 2
+	if got := d.Snapshot().Doc.(map[string]any)["v"].(map[string]any)["n"]; got != 1 {
+		t.Fatalf("document changed with the operation value: %v", got)
+	}
+}
+
+func TestConcurrentPatchAndRead(t *testing.T) {
+	const writers, appends = 8, 50
+	d := New(map[string]any{"list": []any{}})
+
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range appends {
+				if _, err := d.Patch([]jsonpatch.Operation{{"op": "add", "path": "/list/-", "value": 1}}); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range appends {
+				snap := d.Snapshot()
+				if n := len(snap.Doc.(map[string]any)["list"].([]any)); int64(n) != snap.Rev {
+					t.Errorf("revision %d has %d elements", snap.Rev, n)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if rev := d.Rev(); rev != writers*appends {
+		t.Fatalf("expected revision %d, got %d", writers*appends, rev)
+	}
+	d.Read(func(doc any) {
+		if n := len(doc.(map[string]any)["list"].([]any)); n != writers*appends {
+			t.Fatalf("expected %d elements, got %d", writers*appends, n)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package jsonpatch
+
+import "sort"
+
+// MergePatchToPatch returns the JSON Patch that has the effect on doc of
+// the RFC 7396 merge patch mergePatch, so that changes sent in either
+// format can be handled as JSON Patch. Members set to null become removes,
+// of members doc has; other members become adds or replaces, and objects
+// merged into objects are converted member by member. A merge patch that is
+// not an object replaces the whole document.
+func MergePatchToPatch(doc, mergePatch any) ([]Operation, error) {
+	ops := []Operation{}
+	patch, ok := mergePatch.(map[string]any)
+	if !ok {
+		if jsonEqual(doc, mergePatch) {
+			return ops, nil
+		}
+		return append(ops, Operation{"op": "replace", "path": "", "value": deepCopyValue(mergePatch)}), nil
+	}
+	target, ok := doc.(map[string]any)
+	if !ok {
+		// Merging into anything but an object starts from an empty one.
+		return append(ops, Operation{"op": "replace", "path": "", "value": mergeInto(nil, patch)}), nil
+	}
+	return mergeOps("", target, patch, ops), nil
+}
+
+// mergeOps appends the operations merging patch into target, the object at
+// pathRaw.
+func mergeOps(pathRaw string, target, patch map[string]any, ops []Operation) []Operation {
+	keys := make([]string, 0, len(patch))
+	for k := range patch {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := pathRaw + "/" + pointerEscaper.Replace(k)
+		old, exists := target[k]
+		switch value := patch[k].(type) {
+		case nil:
+			if exists {
+				ops = append(ops, Operation{"op": "remove", "path": child})
+			}
+		case map[string]any:
+			if oldObject, ok := old.(map[string]any); ok {
+				ops = mergeOps(child, oldObject, value, ops)
+			} else if exists {
+				ops = append(ops, Operation{"op": "replace", "path": child, "value": mergeInto(nil, value)})
+			} else {
+				ops = append(ops, Operation{"op": "add", "path": child, "value": mergeInto(nil, value)})
+			}
+		default:
+			if !exists {
+				ops = append(ops, Operation{"op": "add", "path": child, "value": deepCopyValue(value)})
+			} else if !jsonEqual(old, value) {
+				ops = append(ops, Operation{"op": "replace", "path": child, "value": deepCopyValue(value)})
+			}
+		}
+	}
+	return ops
+}
+
+// mergeInto returns a copy of target with patch merged into it as RFC 7396
+// describes.
+func mergeInto(target, patch map[string]any) map[string]any {
+	out := make(map[string]any, len(target)+len(patch))
+	for k, v := range target {
+		out[k] = deepCopyValue(v)
+	}
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(out, k)
+		case map[string]any:
+			old, _ := out[k].(map[string]any)
+			out[k] = mergeInto(old, v)
+		default:
+			out[k] = deepCopyValue(v)
+		}
+	}
+	return out
+}
+
+// PatchToMergePatch returns the RFC 7396 merge patch that has the effect on
+// doc of ops, for clients that only accept merge patches. Changed arrays
+// are sent whole, as merge patches cannot edit them. A merge patch cannot
+// set a member to null, since null removes it, so a patch that does is an
+// error wrapping ErrNotMergeable. A patch that does not apply to doc
+// returns the error Apply would.
+func PatchToMergePatch(doc any, ops []Operation) (any, error) {
+	after, err := ApplyNew(doc, ops)
+	if err != nil {
+		return nil, err
+	}
+	return mergeDiff("", doc, after)
+}
+
+// mergeDiff returns the merge patch turning before into after at pathRaw.
+func mergeDiff(pathRaw string, before, after any) (any, error) {
+	b, bok := before.(map[string]any)
+	a, aok := after.(map[string]any)
+	if !bok || !aok {
+		if err := checkMergeable(pathRaw, after); err != nil {
+			return nil, err
+		}
+		return deepCopyValue(after), nil
+	}
+	patch := map[string]any{}
+	for k := range b {
+		if _, exists := a[k]; !exists {
+			patch[k] = nil
+		}
+	}
+	for k, value := range a {
+		child := pathRaw + "/" + pointerEscaper.Replace(k)
+		old, exists := b[k]
+		if exists && jsonEqual(old, value) {
+			continue
+		}
+		if value == nil {
+			return nil, errorf(ErrNotMergeable, "merge patch cannot set %q to null", child)
+		}
+		var err error
+		if patch[k], err = mergeDiff(child, old, value); err != nil {
+			return nil, err
+		}
+	}
+	return patch, nil
+}
+
+// checkMergeable rejects values whose objects have null members, which a
+// merge patch would apply as removals.
+func checkMergeable(pathRaw string, v any) error {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	for k, value := range obj {
+		child := pathRaw + "/" + pointerEscaper.Replace(k)
+		if value == nil {
+			return errorf(ErrNotMergeable, "merge patch cannot set %q to null", child)
+		}
+		if err := checkMergeable(child, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
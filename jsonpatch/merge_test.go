@@ -0,0 +1,134 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatchToPatch(t *testing.T) {
+	const src = `{"title": "Hello", "author": {"givenName": "John", "familyName": "Doe"}, "tags": ["example", "sample"], "content": "This will be unchanged", "n": 1}`
+	tests := []struct {
+		name     string
+		patch    string
+		expected []Operation
+	}{
+		{"RFC 7396 example", `{"title": "Hello!", "phoneNumber": "+01-123-456-7890", "author": {"familyName": null}, "tags": ["example"]}`, []Operation{
+			{"op": "remove", "path": "/author/familyName"},
+			{"op": "add", "path": "/phoneNumber", "value": "+01-123-456-7890"},
+			{"op": "replace", "path": "/tags", "value": []any{"example"}},
+			{"op": "replace", "path": "/title", "value": "Hello!"},
+		}},
+		{"unchanged and missing members", `{"title": "Hello", "missing": null}`, []Operation{}},
+		{"object over a value", `{"n": {"a": 1, "b": null}}`, []Operation{
+			{"op": "replace", "path": "/n", "value": map[string]any{"a": float64(1)}},
+		}},
+		{"new object", `{"x/y": {"a": {"b": null, "c": true}}}`, []Operation{
+			{"op": "add", "path": "/x~1y", "value": map[string]any{"a": map[string]any{"c": true}}},
+		}},
+		{"non-object patch", `["a"]`, []Operation{{"op": "replace", "path": "", "value": []any{"a"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc, patch any
+			if err := json.Unmarshal([]byte(src), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatal(err)
+			}
+			ops, err := MergePatchToPatch(doc, patch)
+			if err != nil {
+				t.Fatalf("MergePatchToPatch returned error: %v", err)
+			}
+			if !reflect.DeepEqual(ops, tt.expected) {
+				t.Fatalf("Patches not equal.\nGot: %v\nExpected: %v", ops, tt.expected)
+			}
+			if _, err := ApplyValue(doc, ops); err != nil {
+				t.Fatalf("patch does not apply: %v", err)
+			}
+		})
+	}
+}
+
+func TestMergePatchToPatchNonObjectDoc(t *testing.T) {
+	ops, err := MergePatchToPatch([]any{float64(1)}, map[string]any{"a": map[string]any{"b": nil, "c": "d"}})
+	if err != nil {
+		t.Fatalf("MergePatchToPatch returned error: %v", err)
+	}
+	expected := []Operation{{"op": "replace", "path": "", "value": map[string]any{"a": map[string]any{"c": "d"}}}}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Fatalf("Patches not equal.\nGot: %v\nExpected: %v", ops, expected)
+	}
+}
+
+func TestPatchToMergePatch(t *testing.T) {
+	doc := map[string]any{"title": "Hello", "author": map[string]any{"givenName": "John", "familyName": "Doe"}, "tags": []any{"example", "sample"}}
+	ops := []Operation{
+		{"op": "replace", "path": "/title", "value": "Hello!"},
+		{"op": "remove", "path": "/author/familyName"},
+		{"op": "remove", "path": "/tags/1"},
+		{"op": "add", "path": "/phoneNumber", "value": "+01-123-456-7890"},
+		{"op": "test", "path": "/author/givenName", "value": "John"},
+	}
+	original := deepCopyValue(doc)
+	merge, err := PatchToMergePatch(doc, ops)
+	if err != nil {
+		t.Fatalf("PatchToMergePatch returned error: %v", err)
+	}
+	if !reflect.DeepEqual(doc, original) {
+		t.Fatalf("PatchToMergePatch modified its input: %v", doc)
+	}
+	expected := map[string]any{
+		"title":       "Hello!",
+		"author":      map[string]any{"familyName": nil},
+		"tags":        []any{"example"},
+		"phoneNumber": "+01-123-456-7890",
+	}
+	if !reflect.DeepEqual(merge, expected) {
+		t.Fatalf("Patches not equal.\nGot: %v\nExpected: %v", merge, expected)
+	}
+
+	// Converting back gives a patch with the same effect.
+	back, err := MergePatchToPatch(doc, merge)
+	if err != nil {
+		t.Fatalf("MergePatchToPatch returned error: %v", err)
+	}
+	want, _ := ApplyNew(doc, ops)
+	got, err := ApplyNew(doc, back)
+	if err != nil {
+		t.Fatalf("converted patch does not apply: %v", err)
+	}
+	if !jsonEqual(got, want) {
+		t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", got, want)
+	}
+}
+
+func TestPatchToMergePatchErrors(t *testing.T) {
+	doc := map[string]any{"a": float64(1)}
+	tests := []struct {
+		name   string
+		ops    []Operation
+		target error
+	}{
+		{"null member", []Operation{{"op": "replace", "path": "/a", "value": nil}}, ErrNotMergeable},
+		{"nested null member", []Operation{{"op": "add", "path": "/b", "value": map[string]any{"c": nil}}}, ErrNotMergeable},
+		{"null root", []Operation{{"op": "replace", "path": "", "value": nil}}, nil},
+		{"failing patch", []Operation{{"op": "test", "path": "/a", "value": 2}}, ErrTestFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := PatchToMergePatch(doc, tt.ops)
+			if tt.target == nil {
+				if err != nil {
+					t.Fatalf("PatchToMergePatch returned error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.target) {
+				t.Fatalf("expected %v, got %v", tt.target, err)
+			}
+		})
+	}
+}
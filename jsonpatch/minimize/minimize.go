@@ -0,0 +1,263 @@
+// Package minimize shrinks a failing (document, patch) pair to a small
+// reproducer with delta debugging.
+//
+// A Predicate decides what "failing" means: Fails matches an apply error,
+// Diverges compares the result against a reference implementation, and any
+// other function works too. Minimize then repeatedly removes operations,
+// object members, array elements, and string characters, keeping every
+// reduction for which the predicate still holds, until no single reduction
+// does.
+package minimize
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// Predicate reports whether a candidate still reproduces the failure being
+// minimized. It receives private copies and may modify them.
+type Predicate func(doc any, patch []map[string]any) bool
+
+// ErrNotReproducible is returned when the input pair does not satisfy the
+// predicate to begin with.
+var ErrNotReproducible = errors.New("the input does not reproduce the failure")
+
+// Fails returns a Predicate that holds when applying the patch with
+// jsonpatch.ApplyValue fails with an error containing substr. An empty substr
+// matches any error.
+func Fails(substr string) Predicate {
+	return func(doc any, patch []map[string]any) bool {
+		_, err := jsonpatch.ApplyValue(doc, patch)
+		return err != nil && strings.Contains(err.Error(), substr)
+	}
+}
+
+// Diverges returns a Predicate that holds when jsonpatch.ApplyValue and
+// reference disagree on whether the patch applies or on the resulting
+// document. Documents are compared after a round trip through JSON, so
+// number types do not matter.
+func Diverges(reference func(doc any, patch []map[string]any) (any, error)) Predicate {
+	return func(doc any, patch []map[string]any) bool {
+		want, wantErr := reference(clone(doc), cloneOps(patch))
+		got, gotErr := jsonpatch.ApplyValue(doc, patch)
+		if (gotErr != nil) != (wantErr != nil) {
+			return true
+		}
+		return gotErr == nil && !sameJSON(got, want)
+	}
+}
+
+// Minimize returns the smallest document and patch it can find for which
+// interesting still holds. The inputs are not modified. It returns
+// ErrNotReproducible if interesting does not hold for the inputs.
+func Minimize(doc any, patch []map[string]any, interesting Predicate) (any, []map[string]any, error) {
+	m := &minimizer{interesting: interesting, doc: clone(doc), patch: cloneOps(patch)}
+	if !m.test(m.doc, m.patch) {
+		return nil, nil, ErrNotReproducible
+	}
+	for size := m.size(); ; {
+		m.patch = ddmin(m.patch, func(ops []map[string]any) bool {
+			return m.test(m.doc, ops)
+		})
+		m.doc = shrinkValue(m.doc, func(doc any) bool {
+			return m.test(doc, m.patch)
+		})
+		for i := range m.patch {
+			m.shrinkOpValue(i)
+		}
+		next := m.size()
+		if next >= size {
+			if m.patch == nil {
+				m.patch = []map[string]any{}
+			}
+			return m.doc, m.patch, nil
+		}
+		size = next
+	}
+}
+
+type minimizer struct {
+	interesting Predicate
+	doc         any
+	patch       []map[string]any
+}
+
+// test runs the predicate on copies, so candidates can share structure with
+// the current best pair.
+func (m *minimizer) test(doc any, patch []map[string]any) bool {
+	return m.interesting(clone(doc), cloneOps(patch))
+}
+
+// shrinkOpValue shrinks the JSON-valued members of operation i: the "value"
+// of add, replace, and test, and the "str" of str_ins.
+func (m *minimizer) shrinkOpValue(i int) {
+	for _, field := range []string{"value", "str"} {
+		value, ok := m.patch[i][field]
+		if !ok {
+			continue
+		}
+		with := func(v any) []map[string]any {
+			ops := slices.Clone(m.patch)
+			ops[i] = maps.Clone(ops[i])
+			ops[i][field] = v
+			return ops
+		}
+		value = shrinkValue(value, func(v any) bool {
+			return m.test(m.doc, with(v))
+		})
+		m.patch = with(value)
+	}
+}
+
+// size measures progress: a pass that does not shrink the encoded pair ends
+// the search.
+func (m *minimizer) size() int {
+	data, err := json.Marshal([]any{m.doc, m.patch})
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// shrinkValue returns a reduced form of v for which ok holds, assuming it
+// holds for v. Containers lose members and elements before their remaining
+// children are shrunk in turn; strings lose characters and numbers become 0.
+func shrinkValue(v any, ok func(any) bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		build := func(keys []string) map[string]any {
+			m := make(map[string]any, len(keys))
+			for _, k := range keys {
+				m[k] = v[k]
+			}
+			return m
+		}
+		keys = ddmin(keys, func(keys []string) bool { return ok(build(keys)) })
+		result := build(keys)
+		for _, k := range keys {
+			result[k] = shrinkValue(result[k], func(child any) bool {
+				candidate := maps.Clone(result)
+				candidate[k] = child
+				return ok(candidate)
+			})
+		}
+		return result
+	case []any:
+		// Copy candidates so an empty array is never passed on as nil.
+		result := ddmin(v, func(elems []any) bool { return ok(append([]any{}, elems...)) })
+		result = append([]any{}, result...)
+		for i := range result {
+			result[i] = shrinkValue(result[i], func(child any) bool {
+				candidate := append([]any(nil), result...)
+				candidate[i] = child
+				return ok(candidate)
+			})
+		}
+		return result
+	case string:
+		runes := ddmin([]rune(v), func(r []rune) bool { return ok(string(r)) })
+		return string(runes)
+	case float64:
+		if v != 0 && ok(float64(0)) {
+			return float64(0)
+		}
+		return v
+	case int:
+		if v != 0 && ok(0) {
+			return 0
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// ddmin is Zeller's delta debugging algorithm restricted to complements: it
+// removes ever smaller chunks of items while test still holds, and returns a
+// subsequence from which no single element can be removed.
+func ddmin[T any](items []T, test func([]T) bool) []T {
+	if len(items) == 0 {
+		return items
+	}
+	if test(nil) {
+		return nil
+	}
+	for n := 2; len(items) >= 2; {
+		chunk := (len(items) + n - 1) / n
+		reduced := false
+		for start := 0; start < len(items); start += chunk {
+			end := min(start+chunk, len(items))
+			complement := make([]T, 0, len(items)-(end-start))
+			complement = append(complement, items[:start]...)
+			complement = append(complement, items[end:]...)
+			if test(complement) {
+				items = complement
+				n = max(n-1, 2)
+				reduced = true
+				break
+			}
+		}
+		if !reduced {
+			if n >= len(items) {
+				break
+			}
+			n = min(n*2, len(items))
+		}
+	}
+	return items
+}
+
+func sameJSON(a, b any) bool {
+	var na, nb any
+	if !normalize(a, &na) || !normalize(b, &nb) {
+		return false
+	}
+	return reflect.DeepEqual(na, nb)
+}
+
+func normalize(v any, out *any) bool {
+	data, err := json.Marshal(v)
+	return err == nil && json.Unmarshal(data, out) == nil
+}
+
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, child := range v {
+			m[k] = clone(child)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, child := range v {
+			s[i] = clone(child)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func cloneOps(ops []map[string]any) []map[string]any {
+	if ops == nil {
+		return nil
+	}
+	out := make([]map[string]any, len(ops))
+	for i, op := range ops {
+		out[i] = clone(op).(map[string]any)
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package minimize
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+func TestMinimizeFailingPatch(t *testing.T) {
+	doc := map[string]any{}
+	var patch []map[string]any
+	for i := range 50 {
+		key := fmt.Sprintf("k%d", i)
+		doc[key] = map[string]any{"n": float64(i), "tags": []any{"a", "b", "c"}, "name": "some long name"}
+		patch = append(patch, map[string]any{"op": "replace", "path": "/" + key + "/n", "value": float64(i + 1)})
+	}
+	patch = append(patch[:20], append([]map[string]any{
+		{"op": "str_ins", "path": "/k7/name", "pos": float64(100), "str": "inserted text"},
+	}, patch[20:]...)...)
+
+	gotDoc, gotPatch, err := Minimize(doc, patch, Fails(`invalid "pos"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDoc := map[string]any{"k7": map[string]any{"name": ""}}
+	wantPatch := []map[string]any{{"op": "str_ins", "path": "/k7/name", "pos": float64(100), "str": ""}}
+	if !reflect.DeepEqual(gotDoc, wantDoc) || !reflect.DeepEqual(gotPatch, wantPatch) {
+		t.Fatalf("got %v %v, want %v %v", gotDoc, gotPatch, wantDoc, wantPatch)
+	}
+	if len(doc) != 50 || len(patch) != 51 {
+		t.Fatal("inputs were modified")
+	}
+}
+
+func TestMinimizeDivergence(t *testing.T) {
+	// A reference that disagrees whenever an added value is a string
+	// containing "x".
+	reference := func(doc any, patch []map[string]any) (any, error) {
+		for _, op := range patch {
+			if s, ok := op["value"].(string); ok && strings.Contains(s, "x") {
+				return nil, errors.New("rejected")
+			}
+		}
+		return jsonpatch.ApplyValue(doc, patch)
+	}
+	doc := []any{float64(1), float64(2), map[string]any{"a": "b"}}
+	patch := []map[string]any{
+		{"op": "add", "path": "/-", "value": float64(3)},
+		{"op": "add", "path": "/0", "value": "abcxyz"},
+		{"op": "remove", "path": "/1"},
+	}
+	gotDoc, gotPatch, err := Minimize(doc, patch, Diverges(reference))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPatch := []map[string]any{{"op": "add", "path": "/0", "value": "x"}}
+	if !reflect.DeepEqual(gotDoc, []any{}) || !reflect.DeepEqual(gotPatch, wantPatch) {
+		t.Fatalf("got %#v %v", gotDoc, gotPatch)
+	}
+}
+
+func TestMinimizeNotReproducible(t *testing.T) {
+	_, _, err := Minimize(map[string]any{}, []map[string]any{{"op": "add", "path": "/a", "value": 1}}, Fails(""))
+	if !errors.Is(err, ErrNotReproducible) {
+		t.Fatalf("expected ErrNotReproducible, got %v", err)
+	}
+}
+
+func TestDDMin(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	got := ddmin(items, func(s []int) bool {
+		has := map[int]bool{}
+		for _, v := range s {
+			has[v] = true
+		}
+		return has[3] && has[7]
+	})
+	if !reflect.DeepEqual(got, []int{3, 7}) {
+		t.Fatalf("got %v", got)
+	}
+}
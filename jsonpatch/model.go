@@ -0,0 +1,42 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// ApplyTyped applies operations to a Go value, such as a struct a service
+// stores its model in: doc is encoded as JSON, patched, and decoded back
+// into a new T, which is returned. doc is not modified, and the result
+// shares nothing with it.
+//
+// The patched document must still fit T: members T has no field for, and
+// values of the wrong type for their field, fail with an error wrapping
+// ErrTypeMismatch, as does a doc that cannot be encoded. Numbers pass
+// through as json.Number, so large integers are not rounded, and inc adds
+// whole numbers exactly up to the int64 range. On error, doc is returned
+// unchanged.
+func ApplyTyped[T any](doc T, operations []Operation) (T, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return doc, errorf(ErrTypeMismatch, "cannot encode %T: %w", doc, err)
+	}
+	var value any
+	if err := decodeWithNumbers(data, &value); err != nil {
+		return doc, errorf(ErrTypeMismatch, "cannot decode %T: %w", doc, err)
+	}
+	value, err = ApplyValue(value, operations)
+	if err != nil {
+		return doc, err
+	}
+	if data, err = json.Marshal(value); err != nil {
+		return doc, errorf(ErrTypeMismatch, "cannot encode patched %T: %w", doc, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var result T
+	if err := dec.Decode(&result); err != nil {
+		return doc, errorf(ErrTypeMismatch, "patched document does not fit %T: %w", doc, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,66 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testModel struct {
+	Name  string            `json:"name"`
+	Count int64             `json:"count"`
+	Tags  []string          `json:"tags"`
+	Meta  map[string]string `json:"meta,omitempty"`
+}
+
+func TestApplyTyped(t *testing.T) {
+	doc := testModel{Name: "a", Count: 1 << 60, Tags: []string{"x"}}
+	got, err := ApplyTyped(doc, []Operation{
+		{"op": "replace", "path": "/name", "value": "b"},
+		{"op": "add", "path": "/tags/-", "value": "y"},
+		{"op": "add", "path": "/meta", "value": map[string]any{"k": "v"}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyTyped returned error: %v", err)
+	}
+	expected := testModel{Name: "b", Count: 1 << 60, Tags: []string{"x", "y"}, Meta: map[string]string{"k": "v"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Documents not equal.\nGot: %+v\nExpected: %+v", got, expected)
+	}
+	if !reflect.DeepEqual(doc.Tags, []string{"x"}) {
+		t.Fatalf("ApplyTyped modified its input: %+v", doc)
+	}
+
+	doc = testModel{Count: 41}
+	ptr, err := ApplyTyped(&doc, []Operation{{"op": "inc", "path": "/count", "inc": 1}})
+	if err != nil {
+		t.Fatalf("ApplyTyped returned error: %v", err)
+	}
+	if ptr == &doc || ptr.Count != 42 || doc.Count != 41 {
+		t.Fatalf("unexpected result %+v for input %+v", ptr, doc)
+	}
+}
+
+func TestApplyTypedErrors(t *testing.T) {
+	doc := testModel{Name: "a"}
+	tests := []struct {
+		name   string
+		ops    []Operation
+		target error
+	}{
+		{"unknown member", []Operation{{"op": "add", "path": "/extra", "value": 1}}, ErrTypeMismatch},
+		{"wrong type", []Operation{{"op": "replace", "path": "/name", "value": 1}}, ErrTypeMismatch},
+		{"failing op", []Operation{{"op": "test", "path": "/name", "value": "b"}}, ErrTestFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyTyped(doc, tt.ops)
+			if !errors.Is(err, tt.target) {
+				t.Fatalf("expected %v, got %v", tt.target, err)
+			}
+			if !reflect.DeepEqual(got, doc) {
+				t.Fatalf("expected the original document, got %+v", got)
+			}
+		})
+	}
+}
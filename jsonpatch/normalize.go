@@ -0,0 +1,388 @@
+package jsonpatch
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// Normalize returns a shorter patch with the same effect as operations, for
+// compacting patches recorded one small edit at a time before they are
+// stored. It combines operations on the same path:
+//
+//   - a replace after an add or replace of the same path sets the value of
+//     the first, and a remove after a replace takes its place;
+//   - an add followed by a remove of an object member becomes an extend of
+//     the object that deletes the member, which removes any member the add
+//     replaced and does nothing otherwise;
+//   - a str_ins at the start or end of the text the previous str_ins
+//     inserted joins it, and a str_del that deletes only text the previous
+//     str_ins inserted takes it out of the insertion;
+//   - a str_del that continues the range the previous str_del deleted,
+//     forwards or backwards, joins it when both give a str or both a len.
+//
+// The operations need not be next to each other: an operation is moved
+// back past the ones between that touch other values, shifting string
+// positions as it goes, for instance past a str_ins into the same string at
+// a different place. Documents are not consulted, so a numeric path segment
+// may be an array index or an object member; an operation is not moved past
+// an add or remove whose path differs from its own first at such a segment,
+// as that would shift it in an array but not in an object.
+//
+// String positions count UTF-16 code units, as Transform does. An add and a
+// remove at a numeric segment are not combined: the add may have inserted
+// an array element, leaving nothing to do, or replaced an object member,
+// which must still be removed. Combined operations can also exceed limits,
+// such as Options.MaxInsertLength, that the ones they replace were within.
+//
+// Operations with members beyond the ones their type needs, such as an id,
+// are not combined, and JSONPath operations and moves and copies are never
+// moved past. The operations passed in are not modified.
+func Normalize(operations []Operation) []Operation {
+	ops := make([]normOp, 0, len(operations))
+	paths := map[string]int{}
+	for _, op := range operations {
+		ops = appendNormalized(ops, paths, newNormOp(op))
+	}
+	out := make([]Operation, len(ops))
+	for i, n := range ops {
+		out[i] = n.op
+	}
+	return out
+}
+
+// Compose returns a single patch with the effect of applying a and then b,
+// for squashing patches, such as one per keystroke into one per save. The
+// operations of b are combined with those of a, and with each other, as
+// Normalize does.
+func Compose(a, b []Operation) []Operation {
+	return Normalize(slices.Concat(a, b))
+}
+
+// normOp is an operation with the parts Normalize reads to move it back
+// past others parsed once.
+type normOp struct {
+	op      Operation
+	typ     string
+	pathRaw string
+	// path is nil for operations that are never moved.
+	path []string
+}
+
+func newNormOp(op Operation) normOp {
+	n := normOp{op: op}
+	n.typ, _ = op["op"].(string)
+	pathRaw, ok := op["path"].(string)
+	n.pathRaw = pathRaw
+	if !ok || strings.HasPrefix(pathRaw, "$") {
+		return n
+	}
+	switch n.typ {
+	case "add", "remove", "replace", "inc", "extend":
+	case "str_ins", "str_del":
+		if _, _, err := stringRange(op); err != nil {
+			return n
+		}
+	default:
+		if !isPredicate(n.typ) {
+			return n
+		}
+	}
+	if path, err := splitPointer(pathRaw); err == nil {
+		n.path = path
+	}
+	return n
+}
+
+func (n normOp) isStringOp() bool {
+	return n.typ == "str_ins" || n.typ == "str_del"
+}
+
+// shiftsAt reports whether n adds or removes the value at segment k of its
+// path, which shifts the elements after it if the parent is an array.
+func (n normOp) shiftsAt(k int) bool {
+	return len(n.path) == k+1 && (n.typ == "add" || n.typ == "remove")
+}
+
+// withPos returns string operation n with its pos set to pos.
+func (n normOp) withPos(pos int) normOp {
+	if p, _, _ := stringRange(n.op); p == pos {
+		return n
+	}
+	n.op = withNumber(n.op, "pos", pos)
+	return n
+}
+
+// appendNormalized appends y to ops, combining it with the last operation it
+// can be moved back to and combined with. paths counts the operations in
+// ops by path.
+func appendNormalized(ops []normOp, paths map[string]int, y normOp) []normOp {
+	switch y.typ {
+	case "replace", "remove", "str_ins", "str_del":
+	default:
+		// Nothing combines with an earlier operation.
+		paths[y.pathRaw]++
+		return append(ops, y)
+	}
+	// Find the operation to combine with before adjusting any, as most
+	// operations have none. It can only be one with the same path, which
+	// moving does not change.
+	j, moving := len(ops)-1, y
+	if paths[y.pathRaw] == 0 {
+		j = -1
+	}
+	for ; j >= 0; j-- {
+		if ops[j].pathRaw == moving.pathRaw {
+			if _, ok := combineOps(ops[j].op, moving.op); ok {
+				break
+			}
+		}
+		var ok bool
+		if moving, _, ok = swapOps(ops[j], moving); !ok {
+			j = -1
+			break
+		}
+	}
+	if j < 0 {
+		paths[y.pathRaw]++
+		return append(ops, y)
+	}
+	for i := len(ops) - 1; i > j; i-- {
+		y, ops[i], _ = swapOps(ops[i], y)
+	}
+	combined, _ := combineOps(ops[j].op, y.op)
+	paths[y.pathRaw]--
+	if combined == nil {
+		return slices.Delete(ops, j, j+1)
+	}
+	ops[j] = newNormOp(combined)
+	paths[ops[j].pathRaw]++
+	return ops
+}
+
+// swapOps returns y and z adjusted so that applying y and then z has the
+// effect of applying z and then y, and false if they cannot be swapped.
+func swapOps(z, y normOp) (normOp, normOp, bool) {
+	if z.path == nil || y.path == nil {
+		return y, z, false
+	}
+	k := 0
+	for k < len(z.path) && k < len(y.path) && z.path[k] == y.path[k] {
+		k++
+	}
+	if k == len(z.path) || k == len(y.path) {
+		// One operation touches a value inside the other's.
+		if len(z.path) == len(y.path) && z.isStringOp() && y.isStringOp() {
+			return swapStringOps(z, y)
+		}
+		return y, z, false
+	}
+	if z.path[k] == "-" || y.path[k] == "-" {
+		return y, z, false
+	}
+	_, zErr := parseArrayIndex(z.path[k])
+	_, yErr := parseArrayIndex(y.path[k])
+	if zErr != nil || yErr != nil {
+		// Different members of an object.
+		return y, z, true
+	}
+	// Different elements of an array, or members of an object named by
+	// numbers. Either way they are independent unless one is added or
+	// removed, which would shift the other only in an array.
+	if z.shiftsAt(k) || y.shiftsAt(k) {
+		return y, z, false
+	}
+	return y, z, true
+}
+
+// swapStringOps is swapOps for string operations on the same string, which
+// can be swapped if they edit different parts of it.
+func swapStringOps(z, y normOp) (normOp, normOp, bool) {
+	i, zLen, _ := stringRange(z.op)
+	j, yLen, _ := stringRange(y.op)
+	zDelta, yDelta := zLen, yLen
+	// Where each edit ends in the text z left.
+	zEnd, yEnd := i+zLen, j
+	if z.typ == "str_del" {
+		zDelta, zEnd = -zLen, i
+	}
+	if y.typ == "str_del" {
+		yDelta, yEnd = -yLen, j+yLen
+	}
+	switch {
+	case yEnd <= i:
+		return y, z.withPos(i + yDelta), true
+	case j >= zEnd:
+		return y.withPos(j - zDelta), z, true
+	}
+	return y, z, false
+}
+
+// combineOps returns the operation with the effect of prev followed by next,
+// nil if together they have none, and false if they cannot be combined.
+func combineOps(prev, next Operation) (Operation, bool) {
+	prevType, nextType, ok := combinable(prev, next)
+	if !ok {
+		return nil, false
+	}
+	switch {
+	case (prevType == "add" || prevType == "replace") && nextType == "replace":
+		combined := maps.Clone(prev)
+		combined["value"] = next["value"]
+		return combined, true
+	case prevType == "replace" && nextType == "remove":
+		return next, true
+	case prevType == "add" && nextType == "remove":
+		return deleteMember(prev)
+	case prevType == "str_ins" && nextType == "str_ins":
+		return combineStrIns(prev, next)
+	case prevType == "str_ins" && nextType == "str_del":
+		return shrinkStrIns(prev, next)
+	case prevType == "str_del" && nextType == "str_del":
+		return combineStrDel(prev, next)
+	}
+	return nil, false
+}
+
+// deleteMember returns an extend deleting the object member that add adds,
+// and false if add's path does not end in a member name.
+func deleteMember(add Operation) (Operation, bool) {
+	path, err := splitPointer(add["path"].(string))
+	if err != nil || len(path) == 0 {
+		return nil, false
+	}
+	name := path[len(path)-1]
+	if _, err := parseArrayIndex(name); err == nil {
+		return nil, false
+	}
+	return Operation{"op": "extend", "path": joinPointer(path[:len(path)-1]), "props": map[string]any{name: nil}, "deleteNull": true}, true
+}
+
+// combinable returns the types of prev and next if both are well-formed
+// operations on the same JSON Pointer with only the members Normalize
+// knows how to combine.
+func combinable(prev, next Operation) (string, string, bool) {
+	prevType, _ := prev["op"].(string)
+	nextType, _ := next["op"].(string)
+	path, ok := prev["path"].(string)
+	// A replace or remove cannot refer to an append, so an add to "-" is
+	// never combined with one.
+	if !ok || path != next["path"] || strings.HasPrefix(path, "$") || strings.HasSuffix(path, "/-") {
+		return "", "", false
+	}
+	if !onlyMembers(prev, prevType) || !onlyMembers(next, nextType) {
+		return "", "", false
+	}
+	return prevType, nextType, true
+}
+
+// onlyMembers reports whether op has no members beyond the ones an
+// operation of type opType needs.
+func onlyMembers(op Operation, opType string) bool {
+	var members []string
+	switch opType {
+	case "add", "replace":
+		members = []string{"value"}
+	case "remove":
+	case "str_ins":
+		members = []string{"pos", "str"}
+	case "str_del":
+		members = []string{"pos", "str", "len"}
+	default:
+		return false
+	}
+	for k := range op {
+		if k != "op" && k != "path" && !slices.Contains(members, k) {
+			return false
+		}
+	}
+	switch opType {
+	case "add", "replace":
+		_, ok := op["value"]
+		return ok
+	case "str_ins", "str_del":
+		_, _, err := stringRange(op)
+		_, hasLen := op["len"]
+		return err == nil && !(hasStr(op) && hasLen)
+	}
+	return true
+}
+
+func hasStr(op Operation) bool {
+	_, ok := op["str"].(string)
+	return ok
+}
+
+// combineStrIns joins next into prev when it inserts right before or right
+// after the text prev inserted.
+func combineStrIns(prev, next Operation) (Operation, bool) {
+	prevPos, prevLen, _ := stringRange(prev)
+	nextPos, _, _ := stringRange(next)
+	prevStr, nextStr := prev["str"].(string), next["str"].(string)
+	combined := maps.Clone(prev)
+	switch nextPos {
+	case prevPos + prevLen:
+		combined["str"] = prevStr + nextStr
+	case prevPos:
+		combined["str"] = nextStr + prevStr
+	default:
+		return nil, false
+	}
+	return combined, true
+}
+
+// shrinkStrIns takes the text next deletes out of the text prev inserted,
+// when next deletes nothing else.
+func shrinkStrIns(prev, next Operation) (Operation, bool) {
+	prevPos, _, _ := stringRange(prev)
+	nextPos, nextLen, _ := stringRange(next)
+	units := utf16.Encode([]rune(prev["str"].(string)))
+	start, end := nextPos-prevPos, nextPos-prevPos+nextLen
+	if start < 0 || end > len(units) || splitsPair(units, start) || splitsPair(units, end) {
+		return nil, false
+	}
+	if s, ok := next["str"].(string); ok && s != string(utf16.Decode(units[start:end])) {
+		// next would fail; keep it that way.
+		return nil, false
+	}
+	if start == 0 && end == len(units) {
+		return nil, true
+	}
+	combined := maps.Clone(prev)
+	combined["str"] = string(utf16.Decode(append(units[:start:start], units[end:]...)))
+	return combined, true
+}
+
+// combineStrDel joins next into prev when it deletes the text right after
+// or right before the range prev deleted, and both give the text or both
+// its length.
+func combineStrDel(prev, next Operation) (Operation, bool) {
+	if hasStr(prev) != hasStr(next) {
+		return nil, false
+	}
+	prevPos, prevLen, _ := stringRange(prev)
+	nextPos, nextLen, _ := stringRange(next)
+	var combined Operation
+	var first, second Operation
+	switch {
+	case nextPos == prevPos:
+		combined, first, second = maps.Clone(prev), prev, next
+	case nextPos+nextLen == prevPos:
+		combined, first, second = withNumber(prev, "pos", nextPos), next, prev
+	default:
+		return nil, false
+	}
+	if hasStr(prev) {
+		combined["str"] = first["str"].(string) + second["str"].(string)
+	} else {
+		combined = withNumber(combined, "len", prevLen+nextLen)
+	}
+	return combined, true
+}
+
+// splitsPair reports whether UTF-16 offset i falls between the halves of a
+// surrogate pair.
+func splitsPair(units []uint16, i int) bool {
+	return i > 0 && i < len(units) && units[i] >= 0xDC00 && units[i] <= 0xDFFF
+}
@@ -0,0 +1,272 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc        map[string]any
+		ops        []Operation
+		expectedOp []Operation
+	}{
+		{
+			name: "replace then replace",
+			doc:  map[string]any{"a": 1},
+			ops: []Operation{
+				{"op": "replace", "path": "/a", "value": 2},
+				{"op": "replace", "path": "/a", "value": 3},
+				{"op": "replace", "path": "/a", "value": 4},
+			},
+			expectedOp: []Operation{{"op": "replace", "path": "/a", "value": 4}},
+		},
+		{
+			name: "add then replace then remove",
+			doc:  map[string]any{"a": 1},
+			ops: []Operation{
+				{"op": "add", "path": "/b", "value": 2},
+				{"op": "replace", "path": "/b", "value": 3},
+				{"op": "remove", "path": "/b"},
+			},
+			expectedOp: []Operation{{"op": "extend", "path": "", "props": map[string]any{"b": nil}, "deleteNull": true}},
+		},
+		{
+			name: "add over a member then remove",
+			doc:  map[string]any{"a": 1},
+			ops: []Operation{
+				{"op": "add", "path": "/a", "value": 2},
+				{"op": "remove", "path": "/a"},
+			},
+			expectedOp: []Operation{{"op": "extend", "path": "", "props": map[string]any{"a": nil}, "deleteNull": true}},
+		},
+		{
+			name: "insert then remove",
+			doc:  map[string]any{"l": []any{"a"}},
+			ops: []Operation{
+				{"op": "add", "path": "/l/0", "value": "x"},
+				{"op": "remove", "path": "/l/0"},
+			},
+			expectedOp: []Operation{
+				{"op": "add", "path": "/l/0", "value": "x"},
+				{"op": "remove", "path": "/l/0"},
+			},
+		},
+		{
+			name: "add over a member named by a number then remove",
+			doc:  map[string]any{"m": map[string]any{"0": "a"}},
+			ops: []Operation{
+				{"op": "add", "path": "/m/0", "value": "x"},
+				{"op": "remove", "path": "/m/0"},
+			},
+			expectedOp: []Operation{
+				{"op": "add", "path": "/m/0", "value": "x"},
+				{"op": "remove", "path": "/m/0"},
+			},
+		},
+		{
+			name: "replace then remove",
+			doc:  map[string]any{"a": 1},
+			ops: []Operation{
+				{"op": "replace", "path": "/a", "value": 2},
+				{"op": "remove", "path": "/a"},
+			},
+			expectedOp: []Operation{{"op": "remove", "path": "/a"}},
+		},
+		{
+			name: "typing",
+			doc:  map[string]any{"s": "ac"},
+			ops: []Operation{
+				{"op": "str_ins", "path": "/s", "pos": 1, "str": "b"},
+				{"op": "str_ins", "path": "/s", "pos": 2, "str": "bb"},
+				{"op": "str_ins", "path": "/s", "pos": 1, "str": "x"},
+				{"op": "str_del", "path": "/s", "pos": 4, "len": 1},
+			},
+			expectedOp: []Operation{{"op": "str_ins", "path": "/s", "pos": 1, "str": "xbb"}},
+		},
+		{
+			name: "typing then deleting it all",
+			doc:  map[string]any{"s": "ac"},
+			ops: []Operation{
+				{"op": "str_ins", "path": "/s", "pos": 1, "str": "b😀"},
+				{"op": "str_del", "path": "/s", "pos": 1, "str": "b😀"},
+			},
+			expectedOp: []Operation{},
+		},
+		{
+			name: "deleting into a surrogate pair",
+			doc:  map[string]any{"s": "ac"},
+			ops: []Operation{
+				{"op": "str_ins", "path": "/s", "pos": 1, "str": "b😀"},
+				{"op": "str_del", "path": "/s", "pos": 1, "len": 2},
+			},
+			expectedOp: []Operation{
+				{"op": "str_ins", "path": "/s", "pos": 1, "str": "b😀"},
+				{"op": "str_del", "path": "/s", "pos": 1, "len": 2},
+			},
+		},
+		{
+			name: "delete and backspace",
+			doc:  map[string]any{"s": "abcdef"},
+			ops: []Operation{
+				{"op": "str_del", "path": "/s", "pos": 3, "len": 1},
+				{"op": "str_del", "path": "/s", "pos": 3, "len": 1},
+				{"op": "str_del", "path": "/s", "pos": 2, "len": 1},
+				{"op": "str_del", "path": "/s", "pos": 0, "str": "ab"},
+			},
+			expectedOp: []Operation{
+				{"op": "str_del", "path": "/s", "pos": 2, "len": 3},
+				{"op": "str_del", "path": "/s", "pos": 0, "str": "ab"},
+			},
+		},
+		{
+			name: "delete text forwards",
+			doc:  map[string]any{"s": "abcdef"},
+			ops: []Operation{
+				{"op": "str_del", "path": "/s", "pos": 1, "str": "b"},
+				{"op": "str_del", "path": "/s", "pos": 1, "str": "cd"},
+			},
+			expectedOp: []Operation{{"op": "str_del", "path": "/s", "pos": 1, "str": "bcd"}},
+		},
+		{
+			name: "past other members",
+			doc:  map[string]any{"a": 1, "b": 1},
+			ops: []Operation{
+				{"op": "replace", "path": "/a", "value": 2},
+				{"op": "replace", "path": "/b", "value": 2},
+				{"op": "test", "path": "/b", "value": 2},
+				{"op": "replace", "path": "/a", "value": 3},
+			},
+			expectedOp: []Operation{
+				{"op": "replace", "path": "/a", "value": 3},
+				{"op": "replace", "path": "/b", "value": 2},
+				{"op": "test", "path": "/b", "value": 2},
+			},
+		},
+		{
+			name: "extra members and appends kept",
+			doc:  map[string]any{"a": 1, "l": []any{}},
+			ops: []Operation{
+				{"op": "replace", "path": "/a", "value": 2},
+				{"op": "replace", "path": "/a", "value": 3, "id": "x"},
+				{"op": "add", "path": "/l/-", "value": 1},
+				{"op": "replace", "path": "/l/0", "value": 2},
+			},
+			expectedOp: []Operation{
+				{"op": "replace", "path": "/a", "value": 2},
+				{"op": "replace", "path": "/a", "value": 3, "id": "x"},
+				{"op": "add", "path": "/l/-", "value": 1},
+				{"op": "replace", "path": "/l/0", "value": 2},
+			},
+		},
+		{
+			name: "past other elements",
+			doc:  map[string]any{"l": []any{map[string]any{"k": 0}, map[string]any{"k": 1}}},
+			ops: []Operation{
+				{"op": "replace", "path": "/l/0/k", "value": 1},
+				{"op": "replace", "path": "/l/1", "value": 2},
+				{"op": "replace", "path": "/l/0/k", "value": 3},
+			},
+			expectedOp: []Operation{
+				{"op": "replace", "path": "/l/0/k", "value": 3},
+				{"op": "replace", "path": "/l/1", "value": 2},
+			},
+		},
+		{
+			name: "not past an add of a member named by a number",
+			doc:  map[string]any{"m": map[string]any{"0": "a", "1": "b"}},
+			ops: []Operation{
+				{"op": "replace", "path": "/m/0", "value": "x"},
+				{"op": "add", "path": "/m/0", "value": "y"},
+				{"op": "replace", "path": "/m/1", "value": "z"},
+			},
+			expectedOp: []Operation{
+				{"op": "replace", "path": "/m/0", "value": "x"},
+				{"op": "add", "path": "/m/0", "value": "y"},
+				{"op": "replace", "path": "/m/1", "value": "z"},
+			},
+		},
+		{
+			name: "not past an insert into an array",
+			doc:  map[string]any{"m": []any{"a", "b"}},
+			ops: []Operation{
+				{"op": "replace", "path": "/m/0", "value": "x"},
+				{"op": "add", "path": "/m/0", "value": "y"},
+				{"op": "replace", "path": "/m/1", "value": "z"},
+			},
+			expectedOp: []Operation{
+				{"op": "replace", "path": "/m/0", "value": "x"},
+				{"op": "add", "path": "/m/0", "value": "y"},
+				{"op": "replace", "path": "/m/1", "value": "z"},
+			},
+		},
+		{
+			name: "past edits elsewhere in the same string",
+			doc:  map[string]any{"s": "0123456789"},
+			ops: []Operation{
+				{"op": "str_ins", "path": "/s", "pos": 2, "str": "a"},
+				{"op": "str_ins", "path": "/s", "pos": 10, "str": "x"},
+				{"op": "str_del", "path": "/s", "pos": 6, "len": 2},
+				{"op": "str_ins", "path": "/s", "pos": 3, "str": "b"},
+				{"op": "str_del", "path": "/s", "pos": 0, "len": 1},
+				{"op": "str_ins", "path": "/s", "pos": 3, "str": "c"},
+			},
+			expectedOp: []Operation{
+				{"op": "str_ins", "path": "/s", "pos": 2, "str": "abc"},
+				{"op": "str_ins", "path": "/s", "pos": 12, "str": "x"},
+				{"op": "str_del", "path": "/s", "pos": 8, "len": 2},
+				{"op": "str_del", "path": "/s", "pos": 0, "len": 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Normalize(tt.ops)
+			if !reflect.DeepEqual(got, tt.expectedOp) {
+				t.Fatalf("Operations not equal.\nGot: %v\nExpected: %v", got, tt.expectedOp)
+			}
+			original, err := ApplyValue(deepCopyValue(tt.doc), tt.ops)
+			if err != nil {
+				t.Fatalf("Apply of original returned error: %v", err)
+			}
+			normalized, err := ApplyValue(deepCopyValue(tt.doc), got)
+			if err != nil {
+				t.Fatalf("Apply of normalized returned error: %v", err)
+			}
+			if !reflect.DeepEqual(normalized, original) {
+				t.Errorf("Documents not equal.\nGot: %v\nExpected: %v", normalized, original)
+			}
+		})
+	}
+}
+
+func TestCompose(t *testing.T) {
+	doc := map[string]any{"title": "Hello", "tags": []any{"a", "b"}}
+	a := []Operation{
+		{"op": "str_ins", "path": "/title", "pos": 5, "str": " w"},
+		{"op": "add", "path": "/tags/0", "value": "new"},
+	}
+	b := []Operation{
+		{"op": "str_ins", "path": "/title", "pos": 7, "str": "orld"},
+		{"op": "replace", "path": "/tags/0", "value": "first"},
+	}
+	got := Compose(a, b)
+	expected := []Operation{
+		{"op": "str_ins", "path": "/title", "pos": 5, "str": " world"},
+		{"op": "add", "path": "/tags/0", "value": "first"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Operations not equal.\nGot: %v\nExpected: %v", got, expected)
+	}
+	if err := Apply(doc, got); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	expectedDoc := map[string]any{"title": "Hello world", "tags": []any{"first", "a", "b"}}
+	if !reflect.DeepEqual(doc, expectedDoc) {
+		t.Errorf("Documents not equal.\nGot: %v\nExpected: %v", doc, expectedDoc)
+	}
+	if len(a) != 2 || len(b) != 2 || a[1]["value"] != "new" {
+		t.Error("Compose modified its input")
+	}
+}
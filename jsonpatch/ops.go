@@ -0,0 +1,125 @@
+package jsonpatch
+
+// Names of the operations Apply supports, for the "op" member.
+const (
+	OpAdd       = "add"
+	OpRemove    = "remove"
+	OpReplace   = "replace"
+	OpMove      = "move"
+	OpCopy      = "copy"
+	OpTest      = "test"
+	OpLess      = "less"
+	OpMore      = "more"
+	OpIn        = "in"
+	OpDefined   = "defined"
+	OpUndefined = "undefined"
+	OpType      = "type"
+	OpContains  = "contains"
+	OpStarts    = "starts"
+	OpEnds      = "ends"
+	OpMatches   = "matches"
+	OpStrIns    = "str_ins"
+	OpStrDel    = "str_del"
+	OpInc       = "inc"
+	OpExtend    = "extend"
+)
+
+// isPredicate reports whether opType names an operation that only reads
+// the document, such as test.
+func isPredicate(opType any) bool {
+	switch opType {
+	case OpTest, OpLess, OpMore, OpIn, OpDefined, OpUndefined, OpType, OpContains, OpStarts, OpEnds, OpMatches:
+		return true
+	}
+	return false
+}
+
+// The constructors below return operations in the map form that Apply
+// takes, so that callers need not spell out member names. Optional members
+// such as "ignore_case" or "deleteNull" can be set on the result, or built
+// with the typed forms, such as Matches.
+
+// NewAdd returns an add of value at path.
+func NewAdd(path string, value any) Operation { return Add{Path: path, Value: value}.Operation() }
+
+// NewRemove returns a remove of the value at path.
+func NewRemove(path string) Operation { return Remove{Path: path}.Operation() }
+
+// NewReplace returns a replace of the value at path with value.
+func NewReplace(path string, value any) Operation {
+	return Replace{Path: path, Value: value}.Operation()
+}
+
+// NewMove returns a move of the value at from to path.
+func NewMove(from, path string) Operation { return Move{From: from, Path: path}.Operation() }
+
+// NewCopy returns a copy of the value at from to path.
+func NewCopy(from, path string) Operation { return Copy{From: from, Path: path}.Operation() }
+
+// NewTest returns a test that the value at path equals value.
+func NewTest(path string, value any) Operation { return Test{Path: path, Value: value}.Operation() }
+
+// NewLess returns a less asserting the value at path is less than value.
+func NewLess(path string, value any) Operation { return Less{Path: path, Value: value}.Operation() }
+
+// NewMore returns a more asserting the value at path is greater than value.
+func NewMore(path string, value any) Operation { return More{Path: path, Value: value}.Operation() }
+
+// NewIn returns an in asserting the value at path equals one of values.
+func NewIn(path string, values ...any) Operation {
+	if values == nil {
+		values = []any{}
+	}
+	return In{Path: path, Values: values}.Operation()
+}
+
+// NewDefined returns a defined asserting path refers to a value.
+func NewDefined(path string) Operation { return Defined{Path: path}.Operation() }
+
+// NewUndefined returns an undefined asserting path refers to no value.
+func NewUndefined(path string) Operation { return Undefined{Path: path}.Operation() }
+
+// NewType returns a type asserting the value at path has the JSON type
+// typ, such as "string" or "integer".
+func NewType(path, typ string) Operation { return Type{Path: path, Value: typ}.Operation() }
+
+// NewContains returns a contains asserting the string at path contains s.
+func NewContains(path, s string) Operation { return Contains{Path: path, Value: s}.Operation() }
+
+// NewStarts returns a starts asserting the string at path starts with s.
+func NewStarts(path, s string) Operation { return Starts{Path: path, Value: s}.Operation() }
+
+// NewEnds returns an ends asserting the string at path ends with s.
+func NewEnds(path, s string) Operation { return Ends{Path: path, Value: s}.Operation() }
+
+// NewMatches returns a matches asserting the string at path matches the
+// regular expression pattern.
+func NewMatches(path, pattern string) Operation {
+	return Matches{Path: path, Value: pattern}.Operation()
+}
+
+// NewStrIns returns a str_ins inserting str at pos in the string at path.
+func NewStrIns(path string, pos int, str string) Operation {
+	return StrIns{Path: path, Pos: pos, Str: str}.Operation()
+}
+
+// NewStrDel returns a str_del deleting str, which must be the text found
+// at pos, from the string at path.
+func NewStrDel(path string, pos int, str string) Operation {
+	return StrDel{Path: path, Pos: pos, Str: str}.Operation()
+}
+
+// NewStrDelLen returns a str_del deleting n characters at pos from the
+// string at path.
+func NewStrDelLen(path string, pos, n int) Operation {
+	return StrDel{Path: path, Pos: pos, Len: n}.Operation()
+}
+
+// NewInc returns an inc adding inc to the number at path.
+func NewInc(path string, inc float64) Operation { return Inc{Path: path, Inc: inc}.Operation() }
+
+// NewExtend returns an extend setting the members of props in the object
+// at path.
+func NewExtend(path string, props map[string]any) Operation {
+	return Extend{Path: path, Props: props}.Operation()
+}
@@ -0,0 +1,46 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOpConstructors(t *testing.T) {
+	doc := map[string]any{"title": "Draft", "count": float64(1), "tags": []any{"a"}}
+	ops := []Operation{
+		NewTest("/title", "Draft"),
+		NewDefined("/title"),
+		NewUndefined("/missing"),
+		NewType("/count", "integer"),
+		NewIn("/title", "Draft", "Final"),
+		NewLess("/count", 2),
+		NewMore("/count", 0),
+		NewStarts("/title", "Dr"),
+		NewEnds("/title", "ft"),
+		NewContains("/title", "raf"),
+		NewMatches("/title", "^D"),
+		NewStrDel("/title", 0, "Draft"),
+		NewStrIns("/title", 0, "Final draft"),
+		NewStrDelLen("/title", 5, 6),
+		NewInc("/count", 2),
+		NewAdd("/tags/-", "b"),
+		NewCopy("/tags/0", "/first"),
+		NewMove("/first", "/primary"),
+		NewReplace("/primary", "z"),
+		NewRemove("/tags/0"),
+		NewExtend("", map[string]any{"done": true}),
+	}
+	if err := Validate(ops); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+	if err := Apply(doc, ops); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	expected := map[string]any{"title": "Final", "count": 3, "tags": []any{"b"}, "primary": "z", "done": true}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Documents not equal.\nGot: %#v\nExpected: %#v", doc, expected)
+	}
+	if op := NewStrIns("/s", 1, "x"); op["op"] != OpStrIns {
+		t.Errorf("NewStrIns op = %v, expected %q", op["op"], OpStrIns)
+	}
+}
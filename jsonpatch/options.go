@@ -0,0 +1,201 @@
+package jsonpatch
+
+// Options configures ApplyWithOptions. The zero value behaves like Apply.
+type Options struct {
+	// Index, when set, lets the patch reuse containers resolved by earlier
+	// applies against the same document. See NewIndex.
+	Index *Index
+
+	// Trusted decodes the path of each op only the first time the patch
+	// uses it, as Compile does, instead of splitting and unescaping it again
+	// for every op, for patches that edit the same values many times. Ops
+	// are checked as without it, and patches apply the same way.
+	Trusted bool
+
+	// Documents registers other documents by name. The from pointer of a copy
+	// or move op may then reference one of them as "name#/pointer", so that a
+	// patch can compose documents. A move removes the value from the other
+	// document, in place, and stores the updated document back in the map; a
+	// patch that fails later does not undo it.
+	Documents map[string]any
+
+	// Atomic makes a patch all or nothing, as RFC 6902 requires: the
+	// operations are applied to a copy of the objects and arrays they write
+	// into, which replaces them in the document only once every operation
+	// has succeeded. Subtrees the patch does not touch are shared rather
+	// than copied. When the patch fails, the document is left as it was
+	// and Report holds no changes. An Index is reset after an atomic apply,
+	// and values moved out of Documents are not put back.
+	Atomic bool
+
+	// ContinueOnError applies every operation of a patch even when some
+	// fail, skipping the failed ones, for best-effort imports. The error is
+	// then a *PartialError listing every failure and the operations that
+	// were applied. A failed operation leaves the document as it was,
+	// except that an op with a JSONPath path may have been applied to some
+	// of the values it selects. With Atomic, a patch with failures still
+	// changes nothing, and with DryRun, the error reports all of them.
+	ContinueOnError bool
+
+	// DryRun checks a patch without changing anything: the operations are
+	// applied to a copy, as with Atomic, which is then discarded. The error
+	// is the one the patch would fail with, and Report, when set, lists the
+	// changes it would make, up to the failing operation. Documents are
+	// copied too, so a move out of them is simulated as well.
+	DryRun bool
+
+	// Upsert makes replace on a missing object key add it instead of
+	// failing, for documents written before the key existed. An op can set
+	// its own "upsert" member to true or false to override this. Missing
+	// array indices and intermediate keys are still errors.
+	Upsert bool
+
+	// MaxStringLength, when positive, fails a str_ins that would make the
+	// string longer than this many units of StringIndexing, UTF-16 code
+	// units by default, with ErrStringTooLong, so that repeated inserts
+	// cannot balloon a document.
+	MaxStringLength int
+	// MaxStringLengths sets limits for particular paths instead, keyed by
+	// JSON Pointers in which a "*" segment matches any key or index, such as
+	// "/messages/*/text". When several match a path, the smallest applies.
+	MaxStringLengths map[string]int
+
+	// MaxOps, when positive, rejects patches with more operations than this
+	// with ErrLimitExceeded before any is applied.
+	MaxOps int
+	// MaxPathDepth, when positive, fails operations whose path or from has
+	// more segments than this with ErrLimitExceeded.
+	MaxPathDepth int
+	// MaxInsertLength, when positive, fails a str_ins inserting a string
+	// longer than this many units of StringIndexing with ErrLimitExceeded.
+	MaxInsertLength int
+	// MaxArrayLength, when positive, fails an add, copy or move inserting
+	// into an array that already has this many elements with
+	// ErrLimitExceeded. Arrays written whole, as the value of an add or
+	// replace, are not checked.
+	MaxArrayLength int
+
+	// Sanitize, when set, is called with every value an add, replace, copy
+	// or extend op is about to write, before it is written, and the value it
+	// returns is written instead. An error rejects the op with
+	// ErrValueRejected.
+	// Values inside objects and arrays are passed first, each with its own
+	// path, and then the container holding the sanitized values, so a hook
+	// can trim strings or check enum members wherever they are nested. The
+	// path is the op's path, which may end in "-" for appends.
+	Sanitize func(path string, value any) (any, error)
+
+	// BeforeOp, when set, is called before each operation is applied, and
+	// an error from it rejects the operation with ErrOpRejected, for
+	// authorizing writes path by path. AfterOp, when set, is called after
+	// each operation that succeeded, for invalidating caches or capturing
+	// changes. An op with a JSONPath path is reported once for each value
+	// it applies to.
+	BeforeOp func(event OpEvent) error
+	AfterOp  func(event OpEvent)
+
+	// ValidateDocument, when set, is called with the patched document once
+	// every operation has been applied, to enforce invariants the patch
+	// must keep. An error fails the patch with ErrInvalidDocument, wrapping
+	// the error so that field-level errors can be recovered with errors.As.
+	// With Atomic or DryRun, the document is then left as it was; otherwise
+	// it keeps the changes. See ValidateAs for checking struct tags.
+	ValidateDocument func(doc any) error
+
+	// Timestamps makes test, less and more compare strings that are both
+	// RFC 3339 timestamps chronologically, so that "2024-01-01T01:00:00+01:00"
+	// equals "2024-01-01T00:00:00Z" and precedes "2024-01-01T00:30:00Z".
+	// Other strings still compare lexically.
+	Timestamps bool
+
+	// Numbers chooses how test compares numbers. The zero value,
+	// NumbersByValue, treats 1 and 1.0 as equal.
+	Numbers NumberComparison
+
+	// IncTyping chooses the type of the number inc stores. The zero value,
+	// IncInteger, stores whole numbers, so 10.5 incremented by 1 becomes 11.
+	IncTyping IncTyping
+
+	// MoveIndex chooses which state of an array the index in the path of a
+	// move within that array refers to. The zero value,
+	// MoveIndexAfterRemoval, follows RFC 6902.
+	MoveIndex MoveIndexing
+
+	// StringIndexing decides how the pos and len of str_ins and str_del
+	// count characters. Nil means UTF16Indexing. Transform and Rebase always
+	// count UTF-16 code units.
+	StringIndexing StringIndexing
+
+	// JSONPath lets the path of an op be a JSONPath expression starting
+	// with "$", such as "$.items[?(@.id == 'x')].name", instead of a JSON
+	// Pointer. The op is applied to every value the expression selects,
+	// last first, so that removals from an array do not shift the elements
+	// still to come, and fails with ErrPathNotFound if it selects none. A
+	// final name or index need not exist yet, so add can create it. The
+	// from of move and copy is always a JSON Pointer.
+	JSONPath bool
+
+	// Report, when set, is reset and filled with the changes the patch
+	// makes, with copies of the values before and after each one.
+	Report *ApplyReport
+	// Audit, when set, has an entry appended for every value the patch
+	// adds, removes or replaces, with the time, the actor set on the
+	// context by WithActor, and copies of the values before and after.
+	// A patch applied with Atomic that fails, or with DryRun, adds none.
+	Audit *AuditLog
+	// Timings, together with Report, records how long each operation took
+	// and how much it allocated in Report.Ops. Reading the allocation
+	// counters briefly stops the world twice per operation.
+	Timings bool
+}
+
+// NumberComparison is a policy for comparing numbers in test operations, to
+// match the semantics of other JSON Patch implementations.
+type NumberComparison int
+
+const (
+	// NumbersByValue compares numbers by numeric value, whatever their Go
+	// type, so 1 and 1.0 are equal.
+	NumbersByValue NumberComparison = iota
+	// NumbersByType also requires both numbers to have the same Go type,
+	// such as float64 from encoding/json or int from hand-built documents.
+	NumbersByType
+	// NumbersByText compares the JSON text of numbers, as kept by
+	// json.Number when decoding with UseNumber, so 1 and 1.0 differ. Other
+	// numbers are compared in the form encoding/json writes them.
+	NumbersByText
+)
+
+// IncTyping is a policy for the type of the result of inc, so that both
+// counters and floating-point gauges can be incremented.
+type IncTyping int
+
+const (
+	// IncInteger stores the sum as an int, truncated toward zero. Whole
+	// numbers are added exactly, up to the int64 range.
+	IncInteger IncTyping = iota
+	// IncFloat stores the sum as a float64, as encoding/json decodes
+	// numbers, so 10.5 incremented by 1 becomes 11.5.
+	IncFloat
+	// IncKeepType stores the sum with the type of the number it replaces:
+	// float64 and json.Number keep fractions, while int, int32 and int64
+	// truncate toward zero. json.Number sums of whole numbers are exact.
+	IncKeepType
+)
+
+// MoveIndexing is a policy for interpreting the path index of a move whose
+// from and path are in the same array, to match other JSON Patch
+// implementations.
+type MoveIndexing int
+
+const (
+	// MoveIndexAfterRemoval resolves the path against the array after the
+	// value has been removed from it, as RFC 6902 specifies, so moving
+	// "/a/0" to "/a/2" in [x, y, z] gives [y, z, x].
+	MoveIndexAfterRemoval MoveIndexing = iota
+	// MoveIndexBeforeRemoval resolves the path against the array as it was
+	// before the move, so the value ends up in front of the element the
+	// index named: moving "/a/0" to "/a/2" in [x, y, z] gives [y, x, z].
+	// Transform and Rebase assume MoveIndexAfterRemoval.
+	MoveIndexBeforeRemoval
+)
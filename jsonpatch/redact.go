@@ -0,0 +1,124 @@
+package jsonpatch
+
+import (
+	"maps"
+	"strconv"
+	"strings"
+)
+
+// defaultPlaceholder replaces redacted values when RedactRules.Placeholder
+// is nil.
+const defaultPlaceholder = "[REDACTED]"
+
+// RedactRules says which values Redact hides.
+type RedactRules struct {
+	// Paths are JSON Pointers to sensitive values, in which a "*" segment
+	// matches any key or index, such as "/users/*/password". Everything
+	// below a matching path is sensitive too.
+	Paths []string
+	// Keys are object member names whose values are sensitive wherever they
+	// appear, such as "token" or "ssn", compared without regard to case.
+	Keys []string
+	// Placeholder is written in place of sensitive values. Nil means the
+	// string "[REDACTED]".
+	Placeholder any
+}
+
+// Redact returns a copy of ops, for logging, in which the values written or
+// tested at sensitive paths are replaced with the rules' placeholder. The
+// value of add, replace, test, less and more, the str of str_ins and
+// str_del and the inc of inc are redacted when the op's path is sensitive.
+// Objects and arrays are redacted member by member, so a value added at
+// "/users/-" still shows which fields it had. Every op keeps its other
+// members, and ops is not modified.
+func Redact(ops []Operation, rules RedactRules) []Operation {
+	placeholder := rules.Placeholder
+	if placeholder == nil {
+		placeholder = defaultPlaceholder
+	}
+	redacted := make([]Operation, len(ops))
+	for i, op := range ops {
+		pathRaw, _ := op["path"].(string)
+		sensitive := rules.sensitiveBelow(pathRaw)
+		out := maps.Clone(op)
+		for _, member := range []string{"value", "str", "inc"} {
+			value, ok := op[member]
+			if !ok {
+				continue
+			}
+			if sensitive {
+				out[member] = placeholder
+			} else if member == "value" {
+				out[member] = rules.redactValue(pathRaw, value, placeholder)
+			}
+		}
+		redacted[i] = out
+	}
+	return redacted
+}
+
+// sensitiveBelow reports whether pathRaw or one of its ancestors is
+// sensitive.
+func (r RedactRules) sensitiveBelow(pathRaw string) bool {
+	for end := 1; end <= len(pathRaw); end++ {
+		if end == len(pathRaw) || pathRaw[end] == '/' {
+			if r.sensitiveAt(pathRaw[:end]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sensitiveAt reports whether pathRaw matches a rule, not counting its
+// ancestors.
+func (r RedactRules) sensitiveAt(pathRaw string) bool {
+	for _, pattern := range r.Paths {
+		if matchPointer(pattern, pathRaw) {
+			return true
+		}
+	}
+	if len(r.Keys) == 0 || pathRaw == "" {
+		return false
+	}
+	key, err := decodePointerSegment(pathRaw[strings.LastIndexByte(pathRaw, '/')+1:])
+	if err != nil {
+		return false
+	}
+	for _, k := range r.Keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue returns a copy of value, found at pathRaw, with the sensitive
+// values inside it replaced.
+func (r RedactRules) redactValue(pathRaw string, value any, placeholder any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, child := range v {
+			childPath := pathRaw + "/" + pointerEscaper.Replace(key)
+			if r.sensitiveAt(childPath) {
+				out[key] = placeholder
+			} else {
+				out[key] = r.redactValue(childPath, child, placeholder)
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			childPath := pathRaw + "/" + strconv.Itoa(i)
+			if r.sensitiveAt(childPath) {
+				out[i] = placeholder
+			} else {
+				out[i] = r.redactValue(childPath, child, placeholder)
+			}
+		}
+		return out
+	}
+	return value
+}
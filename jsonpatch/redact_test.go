@@ -0,0 +1,72 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	rules := RedactRules{Paths: []string{"/users/*/password", "/secrets"}, Keys: []string{"Token"}}
+	tests := []struct {
+		name     string
+		op       Operation
+		expected Operation
+	}{
+		{
+			"sensitive path",
+			Operation{"op": "replace", "path": "/users/0/password", "value": "hunter2", "id": "a"},
+			Operation{"op": "replace", "path": "/users/0/password", "value": "[REDACTED]", "id": "a"},
+		},
+		{
+			"below a sensitive path",
+			Operation{"op": "add", "path": "/secrets/api/key", "value": map[string]any{"v": 1}},
+			Operation{"op": "add", "path": "/secrets/api/key", "value": "[REDACTED]"},
+		},
+		{
+			"nested values keep their shape",
+			Operation{"op": "add", "path": "/users/-", "value": map[string]any{"name": "ann", "password": "x", "auth": []any{map[string]any{"token": "t"}}}},
+			Operation{"op": "add", "path": "/users/-", "value": map[string]any{"name": "ann", "password": "[REDACTED]", "auth": []any{map[string]any{"token": "[REDACTED]"}}}},
+		},
+		{
+			"key anywhere",
+			Operation{"op": "test", "path": "/session/token", "value": "abc"},
+			Operation{"op": "test", "path": "/session/token", "value": "[REDACTED]"},
+		},
+		{
+			"string edits",
+			Operation{"op": "str_ins", "path": "/users/1/password", "pos": 0, "str": "pw"},
+			Operation{"op": "str_ins", "path": "/users/1/password", "pos": 0, "str": "[REDACTED]"},
+		},
+		{
+			"other paths untouched",
+			Operation{"op": "replace", "path": "/users/0/name", "value": "bob"},
+			Operation{"op": "replace", "path": "/users/0/name", "value": "bob"},
+		},
+		{
+			"ops without values",
+			Operation{"op": "move", "from": "/secrets", "path": "/old"},
+			Operation{"op": "move", "from": "/secrets", "path": "/old"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := deepCopyValue(map[string]any(tt.op))
+			got := Redact([]Operation{tt.op}, rules)
+			if !reflect.DeepEqual(got, []Operation{tt.expected}) {
+				t.Fatalf("Patches not equal.\nGot: %v\nExpected: %v", got, tt.expected)
+			}
+			if !reflect.DeepEqual(map[string]any(tt.op), original) {
+				t.Fatalf("Redact modified its input: %v", tt.op)
+			}
+		})
+	}
+
+	got := Redact([]Operation{{"op": "replace", "path": "/secrets", "value": "s"}}, RedactRules{Paths: []string{"/secrets"}})
+	if got[0]["value"] != "[REDACTED]" {
+		t.Fatalf("expected the default placeholder, got %v", got[0]["value"])
+	}
+	got = Redact([]Operation{{"op": "replace", "path": "/secrets", "value": "s"}}, RedactRules{Paths: []string{"/secrets"}, Placeholder: "***"})
+	if got[0]["value"] != "***" {
+		t.Fatalf("expected a custom placeholder, got %v", got[0]["value"])
+	}
+}
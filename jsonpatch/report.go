@@ -0,0 +1,257 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"maps"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChangeKind tells what an operation did to the value at a path.
+type ChangeKind int
+
+const (
+	// ChangeAdded is a new object member or array element.
+	ChangeAdded ChangeKind = iota
+	// ChangeRemoved is a member or element that was removed.
+	ChangeRemoved
+	// ChangeReplaced is a value that was overwritten or edited in place,
+	// such as by replace, inc or str_ins.
+	ChangeReplaced
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeReplaced:
+		return "replaced"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is one value an operation added, removed or replaced.
+type Change struct {
+	// Index is the position of the operation in the patch.
+	Index int
+	// Path is the pointer to the value, with a trailing "-" resolved to the
+	// index the value was appended at.
+	Path string
+	Kind ChangeKind
+	// Element is set when the value is an array element rather than an
+	// object member or the root.
+	Element bool
+	// Old and New are copies of the value before and after the operation.
+	// Old is nil for additions and New for removals.
+	Old, New any
+}
+
+// ApplyReport describes what a patch did to a document. Pass one in
+// Options.Report to have it filled in.
+type ApplyReport struct {
+	// Changes lists the values the patch changed, in operation order. A
+	// move is reported as a removal followed by an addition, and tests
+	// change nothing. Writes that leave a value equal to what it was, such
+	// as a replace with the same value, an inc by 0 or an empty str_ins,
+	// are left out. When the patch fails, it holds the changes made by the
+	// operations before the failing one.
+	Changes []Change
+	// Ops holds the cost of each operation applied, including a failing
+	// one, when Options.Timings is set.
+	Ops []OpStats
+}
+
+// OpStats is the cost of applying one operation, for finding pathological
+// operations such as huge array inserts in production.
+type OpStats struct {
+	Index    int
+	Duration time.Duration
+	// AllocBytes and Allocs are the heap allocations made while the
+	// operation was applied. They are read from process-wide counters, so
+	// they include allocations by other goroutines running at the time.
+	AllocBytes, Allocs uint64
+}
+
+// timeOp applies op and records its cost in the report. Reading the
+// allocation counters briefly stops the world, which is why timings are
+// opt-in.
+func (a *applier) timeOp(index int, op map[string]any) error {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	err := a.applyOp(op)
+
+	duration := time.Since(start)
+	runtime.ReadMemStats(&after)
+	a.opts.Report.Ops = append(a.opts.Report.Ops, OpStats{
+		Index:      index,
+		Duration:   duration,
+		AllocBytes: after.TotalAlloc - before.TotalAlloc,
+		Allocs:     after.Mallocs - before.Mallocs,
+	})
+	return err
+}
+
+// Changed reports whether the patch changed the document, so that callers
+// can skip persisting and broadcasting patches without effect. Operations
+// are judged one at a time: a patch whose operations undo each other still
+// counts as a change.
+func (r ApplyReport) Changed() bool {
+	return len(r.Changes) > 0
+}
+
+// Paths returns the paths the patch changed, each once, in the order they
+// were first changed.
+func (r ApplyReport) Paths() []string {
+	var paths []string
+	seen := map[string]bool{}
+	for _, c := range r.Changes {
+		if !seen[c.Path] {
+			seen[c.Path] = true
+			paths = append(paths, c.Path)
+		}
+	}
+	return paths
+}
+
+// beforeChange returns the changes op is about to make, without their new
+// values, or nil if op does not write or cannot be resolved.
+func (a *applier) beforeChange(op map[string]any) []Change {
+	pathRaw, _ := op["path"].(string)
+	switch op["op"] {
+	case "add", "copy":
+		if c, ok := a.pendingChange(pathRaw, true); ok {
+			return []Change{c}
+		}
+	case "move":
+		fromRaw, _ := op["from"].(string)
+		if fromRaw == pathRaw {
+			return nil
+		}
+		if _, _, ok := a.documentRef(fromRaw); ok {
+			// The value comes from another document.
+			if c, ok := a.pendingChange(pathRaw, true); ok {
+				return []Change{c}
+			}
+			return nil
+		}
+		removed, ok := a.pendingChange(fromRaw, false)
+		if !ok {
+			return nil
+		}
+		removed.Kind = ChangeRemoved
+		added, ok := a.pendingChange(a.moveTarget(fromRaw, pathRaw), true)
+		if !ok {
+			return nil
+		}
+		if added.Element && strings.HasSuffix(pathRaw, "/-") {
+			// The removal may shorten the array, so the index is only
+			// known afterwards.
+			added.Path = pathRaw
+		}
+		return []Change{removed, added}
+	case "remove":
+		if c, ok := a.pendingChange(pathRaw, false); ok {
+			c.Kind = ChangeRemoved
+			return []Change{c}
+		}
+	case "replace", "inc", "str_ins", "str_del":
+		if c, ok := a.pendingChange(pathRaw, false); ok {
+			return []Change{c}
+		}
+	case "extend":
+		props, deleteNull, err := extendMembers(pathRaw, op)
+		target, _ := a.valueAt(pathRaw)
+		object, ok := target.(map[string]any)
+		if err != nil || !ok {
+			return nil
+		}
+		var changes []Change
+		for _, k := range slices.Sorted(maps.Keys(props)) {
+			_, exists := object[k]
+			c := Change{Path: pathRaw + "/" + pointerEscaper.Replace(k), Kind: ChangeReplaced, Old: deepCopyValue(object[k])}
+			switch {
+			case props[k] == nil && deleteNull:
+				if !exists {
+					continue
+				}
+				c.Kind = ChangeRemoved
+			case !exists:
+				c.Kind = ChangeAdded
+			}
+			changes = append(changes, c)
+		}
+		return changes
+	}
+	return nil
+}
+
+// pendingChange describes a write at pathRaw before it happens. inserts is
+// set for ops that insert into arrays rather than overwrite elements.
+func (a *applier) pendingChange(pathRaw string, inserts bool) (Change, bool) {
+	c := Change{Path: pathRaw, Kind: ChangeReplaced}
+	if pathRaw == "" {
+		c.Old = deepCopyValue(a.root)
+		return c, true
+	}
+	parent, key, idx, _, _, _, err := resolvePathCached(a.root, pathRaw, a.cache)
+	if err != nil {
+		return Change{}, false
+	}
+	switch parent := parent.(type) {
+	case map[string]any:
+		old, exists := parent[key]
+		if !exists {
+			c.Kind = ChangeAdded
+		}
+		c.Old = deepCopyValue(old)
+	case []any:
+		c.Element = true
+		if inserts {
+			c.Kind = ChangeAdded
+			if idx == len(parent) {
+				c.Path = pathRaw[:strings.LastIndexByte(pathRaw, '/')+1] + strconv.Itoa(idx)
+			}
+		} else if idx >= 0 && idx < len(parent) {
+			c.Old = deepCopyValue(parent[idx])
+		}
+	default:
+		return Change{}, false
+	}
+	return c, true
+}
+
+// afterChange completes the changes returned by beforeChange once op has
+// been applied, and returns those that changed a value.
+func (a *applier) afterChange(index int, changes []Change) []Change {
+	kept := changes[:0]
+	for i := range changes {
+		c := &changes[i]
+		c.Index = index
+		if c.Kind == ChangeRemoved {
+			kept = append(kept, *c)
+			continue
+		}
+		if parentRaw, ok := strings.CutSuffix(c.Path, "/-"); ok {
+			if parent, err := a.valueAt(parentRaw); err == nil {
+				if s, ok := parent.([]any); ok {
+					c.Path = parentRaw + "/" + strconv.Itoa(len(s)-1)
+				}
+			}
+		}
+		if value, err := a.valueAt(c.Path); err == nil {
+			c.New = deepCopyValue(value)
+		}
+		if c.Kind == ChangeReplaced && jsonEqual(c.Old, c.New) {
+			continue
+		}
+		kept = append(kept, *c)
+	}
+	return kept
+}
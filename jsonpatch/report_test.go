@@ -0,0 +1,141 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyReport(t *testing.T) {
+	doc := map[string]any{
+		"settings": map[string]any{"theme": "dark", "lang": "en"},
+		"tags":     []any{"a"},
+		"count":    float64(1),
+	}
+	var report ApplyReport
+	ops := []map[string]any{
+		{"op": "replace", "path": "/settings/theme", "value": "light"},
+		{"op": "add", "path": "/settings/font", "value": "mono"},
+		{"op": "add", "path": "/tags/-", "value": "b"},
+		{"op": "test", "path": "/count", "value": 1},
+		{"op": "inc", "path": "/count", "inc": float64(2)},
+		{"op": "move", "from": "/tags/0", "path": "/tags/-"},
+		{"op": "remove", "path": "/settings/lang"},
+		{"op": "extend", "path": "/settings", "props": map[string]any{"theme": nil, "size": float64(12)}, "deleteNull": true},
+	}
+	if err := ApplyWithOptions(doc, ops, Options{Report: &report}); err != nil {
+		t.Fatalf("ApplyWithOptions returned error: %v", err)
+	}
+	expected := []Change{
+		{Index: 0, Path: "/settings/theme", Kind: ChangeReplaced, Old: "dark", New: "light"},
+		{Index: 1, Path: "/settings/font", Kind: ChangeAdded, New: "mono"},
+		{Index: 2, Path: "/tags/1", Kind: ChangeAdded, Element: true, New: "b"},
+		{Index: 4, Path: "/count", Kind: ChangeReplaced, Old: float64(1), New: 3},
+		{Index: 5, Path: "/tags/0", Kind: ChangeRemoved, Element: true, Old: "a"},
+		{Index: 5, Path: "/tags/1", Kind: ChangeAdded, Element: true, New: "a"},
+		{Index: 6, Path: "/settings/lang", Kind: ChangeRemoved, Old: "en"},
+		{Index: 7, Path: "/settings/size", Kind: ChangeAdded, New: float64(12)},
+		{Index: 7, Path: "/settings/theme", Kind: ChangeRemoved, Old: "light"},
+	}
+	if !reflect.DeepEqual(report.Changes, expected) {
+		t.Fatalf("Changes not equal.\nGot:      %+v\nExpected: %+v", report.Changes, expected)
+	}
+
+	// A failing patch reports the changes made before the failing op, and
+	// the report is reset on reuse.
+	err := ApplyWithOptions(doc, []map[string]any{
+		{"op": "replace", "path": "/count", "value": 0},
+		{"op": "remove", "path": "/missing"},
+	}, Options{Report: &report})
+	if err == nil || len(report.Changes) != 1 || report.Changes[0].Path != "/count" {
+		t.Fatalf("expected one change and an error, got %+v (%v)", report.Changes, err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	doc := map[string]any{"settings": map[string]any{"a": 1, "b": 2, "c": 3}, "tags": []any{}}
+	var report ApplyReport
+	ops := []map[string]any{
+		{"op": "replace", "path": "/settings/a", "value": 10},
+		{"op": "add", "path": "/tags/-", "value": "x"},
+		{"op": "replace", "path": "/settings/b", "value": 20},
+		{"op": "add", "path": "/tags/-", "value": "y"},
+		{"op": "replace", "path": "/settings/c", "value": 30},
+		{"op": "remove", "path": "/settings/a"},
+		{"op": "add", "path": "/a~1b", "value": true},
+	}
+	if err := ApplyWithOptions(doc, ops, Options{Report: &report}); err != nil {
+		t.Fatalf("ApplyWithOptions returned error: %v", err)
+	}
+	summary := Summarize(report)
+	expected := "3 fields changed in settings, 1 field removed from settings, 2 items added to tags, 1 field added to a/b"
+	if got := summary.String(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	if g := summary.Groups[0]; g.Key != "settings" || len(g.Examples) != maxSummaryExamples || g.Examples[0].New != 10 {
+		t.Fatalf("unexpected settings group: %+v", g)
+	}
+	if got := Summarize(ApplyReport{}).String(); got != "no changes" {
+		t.Fatalf("expected no changes, got %q", got)
+	}
+}
+
+func TestApplyReportNoOps(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      map[string]any
+		changed bool
+	}{
+		{"replace with equal value", map[string]any{"op": "replace", "path": "/obj", "value": map[string]any{"n": 1.0}}, false},
+		{"replace with other value", map[string]any{"op": "replace", "path": "/s", "value": "x"}, true},
+		{"inc by 0", map[string]any{"op": "inc", "path": "/n", "inc": 0}, false},
+		{"empty str_ins", map[string]any{"op": "str_ins", "path": "/s", "pos": 1, "str": ""}, false},
+		{"str_del of nothing", map[string]any{"op": "str_del", "path": "/s", "pos": 1, "len": 0}, false},
+		{"add over equal value", map[string]any{"op": "add", "path": "/s", "value": "abc"}, false},
+		{"copy onto equal value", map[string]any{"op": "copy", "from": "/s", "path": "/t"}, false},
+		{"move onto itself", map[string]any{"op": "move", "from": "/s", "path": "/s"}, false},
+		{"test", map[string]any{"op": "test", "path": "/n", "value": 5}, false},
+		{"append", map[string]any{"op": "add", "path": "/list/-", "value": 1}, true},
+		{"remove", map[string]any{"op": "remove", "path": "/t"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := map[string]any{"obj": map[string]any{"n": 1}, "s": "abc", "t": "abc", "n": float64(5), "list": []any{}}
+			var report ApplyReport
+			if err := ApplyWithOptions(doc, []map[string]any{tt.op}, Options{Report: &report}); err != nil {
+				t.Fatalf("ApplyWithOptions returned error: %v", err)
+			}
+			if report.Changed() != tt.changed {
+				t.Fatalf("expected Changed() = %v, got changes %+v", tt.changed, report.Changes)
+			}
+		})
+	}
+}
+
+func TestApplyReportTimings(t *testing.T) {
+	doc := map[string]any{"list": []any{}, "n": float64(1)}
+	ops := []map[string]any{
+		{"op": "test", "path": "/n", "value": 1},
+		{"op": "add", "path": "/list/-", "value": map[string]any{"big": make([]any, 1000)}},
+		{"op": "remove", "path": "/missing"},
+	}
+	var report ApplyReport
+	if err := ApplyWithOptions(doc, ops, Options{Report: &report, Timings: true}); err == nil {
+		t.Fatal("expected the last op to fail")
+	}
+	if len(report.Ops) != 3 {
+		t.Fatalf("expected stats for every op tried, got %+v", report.Ops)
+	}
+	for i, stats := range report.Ops {
+		if stats.Index != i || stats.Duration < 0 {
+			t.Fatalf("unexpected stats for op %d: %+v", i, stats)
+		}
+	}
+	// The failing op allocates its error.
+	if report.Ops[2].Allocs == 0 || report.Ops[2].AllocBytes == 0 {
+		t.Fatalf("expected allocations to be counted, got %+v", report.Ops[2])
+	}
+
+	if err := ApplyWithOptions(doc, ops[:1], Options{Report: &report}); err != nil || report.Ops != nil {
+		t.Fatalf("expected no stats without Timings, got %+v (%v)", report.Ops, err)
+	}
+}
@@ -0,0 +1,110 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+)
+
+// OpStatus tells what became of an operation applied by ApplyWithResults.
+type OpStatus int
+
+const (
+	// OpChanged is an operation that changed the document.
+	OpChanged OpStatus = iota
+	// OpUnchanged is an operation that succeeded without changing the
+	// document, such as a test, or a replace with the value already there.
+	OpUnchanged
+	// OpFailed is an operation that failed.
+	OpFailed
+	// OpSkipped is an operation that was not applied because one before it
+	// failed.
+	OpSkipped
+)
+
+func (s OpStatus) String() string {
+	switch s {
+	case OpChanged:
+		return "changed"
+	case OpUnchanged:
+		return "unchanged"
+	case OpFailed:
+		return "failed"
+	case OpSkipped:
+		return "skipped"
+	}
+	return fmt.Sprintf("OpStatus(%d)", int(s))
+}
+
+// OpResult is what one operation of a patch did.
+type OpResult struct {
+	// Index is the position of the operation in the patch.
+	Index int
+	// Op is the operation as it was passed in.
+	Op     Operation
+	Status OpStatus
+	// Path is the pointer to the value the operation changed, with a
+	// trailing "-" resolved to the index the value was appended at, or the
+	// operation's path if it changed nothing.
+	Path string
+	// Old and New are copies of the value at Path before and after the
+	// operation, nil where there was none. They are only set when the
+	// operation changed a single value, or for a move, the value at its
+	// target; see Changes for operations such as extend that change
+	// several.
+	Old, New any
+	// Changes are the values the operation changed, as listed by
+	// ApplyReport.
+	Changes []Change
+	// Err is the error the operation failed with.
+	Err error
+}
+
+// ApplyWithResults is like ApplyWithOptions but also returns the result of
+// each operation, in patch order, so that callers can emit change events
+// without diffing the document. It uses opts.Report, or a report of its
+// own when that is nil. With Atomic, the operations before a failing one
+// are reported unchanged, as nothing they did is kept.
+func ApplyWithResults(doc map[string]any, operations []map[string]any, opts Options) ([]OpResult, error) {
+	if opts.Report == nil {
+		opts.Report = &ApplyReport{}
+	}
+	err := ApplyWithOptions(doc, operations, opts)
+
+	results := make([]OpResult, len(operations))
+	for i, op := range operations {
+		path, _ := op["path"].(string)
+		results[i] = OpResult{Index: i, Op: op, Status: OpUnchanged, Path: path}
+	}
+	for _, c := range opts.Report.Changes {
+		r := &results[c.Index]
+		r.Status = OpChanged
+		r.Changes = append(r.Changes, c)
+	}
+	var partial *PartialError
+	var opErr *OpError
+	switch {
+	case errors.As(err, &partial):
+		for _, e := range partial.Errors {
+			results[e.Index].Status, results[e.Index].Err = OpFailed, e.Err
+		}
+	case errors.As(err, &opErr):
+		results[opErr.Index].Status, results[opErr.Index].Err = OpFailed, opErr.Err
+		for i := opErr.Index + 1; i < len(results); i++ {
+			results[i].Status = OpSkipped
+		}
+	}
+	for i := range results {
+		r := &results[i]
+		var target *Change
+		switch {
+		case len(r.Changes) == 1:
+			target = &r.Changes[0]
+		case len(r.Changes) == 2 && r.Op["op"] == "move":
+			target = &r.Changes[1]
+		}
+		if target != nil {
+			r.Path, r.Old, r.New = target.Path, target.Old, target.New
+		}
+	}
+	return results, err
+}
@@ -0,0 +1,65 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApplyWithResults(t *testing.T) {
+	doc := map[string]any{"n": float64(1), "list": []any{"a"}, "o": map[string]any{"k": "v"}}
+	ops := []map[string]any{
+		{"op": "inc", "path": "/n", "inc": 2},
+		{"op": "add", "path": "/list/-", "value": "b"},
+		{"op": "test", "path": "/n", "value": 3},
+		{"op": "move", "from": "/o/k", "path": "/moved"},
+		{"op": "replace", "path": "/moved", "value": "v"},
+		{"op": "extend", "path": "/o", "props": map[string]any{"x": 1, "y": 2}},
+		{"op": "remove", "path": "/missing"},
+		{"op": "remove", "path": "/n"},
+	}
+	results, err := ApplyWithResults(doc, ops, Options{})
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Index != 6 {
+		t.Fatalf("expected op 6 to fail, got %v", err)
+	}
+	type summary struct {
+		Status   OpStatus
+		Path     string
+		Old, New any
+		Changes  int
+	}
+	expected := []summary{
+		{OpChanged, "/n", float64(1), 3, 1},
+		{OpChanged, "/list/1", nil, "b", 1},
+		{OpUnchanged, "/n", nil, nil, 0},
+		{OpChanged, "/moved", nil, "v", 2},
+		{OpUnchanged, "/moved", nil, nil, 0},
+		{OpChanged, "/o", nil, nil, 2},
+		{OpFailed, "/missing", nil, nil, 0},
+		{OpSkipped, "/n", nil, nil, 0},
+	}
+	var got []summary
+	for i, r := range results {
+		if r.Index != i || r.Op["op"] != ops[i]["op"] {
+			t.Fatalf("result %d is for op %d %v", i, r.Index, r.Op)
+		}
+		got = append(got, summary{r.Status, r.Path, r.Old, r.New, len(r.Changes)})
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Results not equal.\nGot:      %v\nExpected: %v", got, expected)
+	}
+	if !errors.Is(results[6].Err, ErrPathNotFound) {
+		t.Fatalf("expected the failure on op 6, got %v", results[6].Err)
+	}
+
+	// With ContinueOnError, operations after a failure still run.
+	doc = map[string]any{"n": float64(1)}
+	results, err = ApplyWithResults(doc, []map[string]any{
+		{"op": "remove", "path": "/missing"},
+		{"op": "replace", "path": "/n", "value": float64(2)},
+	}, Options{ContinueOnError: true})
+	if err == nil || results[0].Status != OpFailed || results[1].Status != OpChanged || results[1].New != float64(2) {
+		t.Fatalf("expected a failure then a change, got %+v (%v)", results, err)
+	}
+}
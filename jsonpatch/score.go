@@ -0,0 +1,131 @@
+package jsonpatch
+
+import "strings"
+
+// Complexity estimates what applying a patch costs, without a document to
+// apply it to. Cost is in arbitrary units meant for comparing patches and
+// setting budgets, such as rate-limiting expensive patches per tenant.
+type Complexity struct {
+	// Ops is the number of operations.
+	Ops int
+	// Nodes is the number of JSON values the patch writes, counting every
+	// element and member of container values.
+	Nodes int
+	// StringVolume is the number of UTF-16 code units str_ins inserts and
+	// str_del removes.
+	StringVolume int
+	// ArrayShifts counts operations that insert into or remove from the
+	// middle of an array, which moves the elements after it.
+	ArrayShifts int
+	// Cost is the weighted total.
+	Cost int
+}
+
+// Base costs of operations by type. copy and move are weighted up because
+// the size of what they copy depends on the document.
+var opCosts = map[string]int{
+	"test":      1,
+	"less":      1,
+	"more":      1,
+	"in":        1,
+	"defined":   1,
+	"undefined": 1,
+	"type":      1,
+	"contains":  1,
+	"starts":    1,
+	"ends":      1,
+	"matches":   2,
+	"inc":       1,
+	"add":       2,
+	"remove":    2,
+	"replace":   2,
+	"str_ins":   2,
+	"str_del":   2,
+	"extend":    2,
+	"copy":      8,
+	"move":      8,
+}
+
+const (
+	// unknownOpCost is the cost of an operation whose type is not known.
+	unknownOpCost = 2
+	// arrayShiftCost is added for an insert or removal inside an array,
+	// whose length is not known, so the shift is assumed to be long.
+	arrayShiftCost = 4
+	// nodesPerCost and unitsPerCost are how many written values and string
+	// code units cost one unit.
+	nodesPerCost = 16
+	unitsPerCost = 64
+)
+
+// Score estimates the cost of applying ops. It only looks at the patch, so
+// the sizes of arrays and of values copied or moved are guessed.
+func Score(ops []Operation) Complexity {
+	var c Complexity
+	for _, op := range ops {
+		c.Ops++
+		name, _ := op["op"].(string)
+		cost, ok := opCosts[name]
+		if !ok {
+			cost = unknownOpCost
+		}
+		c.Cost += cost
+		switch name {
+		case "add", "replace":
+			c.Nodes += countNodes(op["value"])
+		case "extend":
+			if props, ok := op["props"].(map[string]any); ok {
+				c.Nodes += countNodes(props) - 1
+			}
+		case "str_ins":
+			str, _ := op["str"].(string)
+			c.StringVolume += utf16Length(str)
+		case "str_del":
+			if str, ok := op["str"].(string); ok {
+				c.StringVolume += utf16Length(str)
+			} else if n, ok := getNumericValue(op["len"]); ok && n > 0 {
+				c.StringVolume += int(n)
+			}
+		}
+		if shiftsArray(name, op) {
+			c.ArrayShifts++
+			c.Cost += arrayShiftCost
+		}
+	}
+	c.Cost += c.Nodes/nodesPerCost + c.StringVolume/unitsPerCost
+	return c
+}
+
+// shiftsArray reports whether op looks like it inserts into or removes from
+// the middle of an array: its path, or the from of a move, ends in an index
+// other than "-". A numeric key of an object is counted as well.
+func shiftsArray(name string, op Operation) bool {
+	endsInIndex := func(member string) bool {
+		pathRaw, _ := op[member].(string)
+		segment := pathRaw[strings.LastIndexByte(pathRaw, '/')+1:]
+		return pathRaw != "" && segment != "" && strings.Trim(segment, "0123456789") == ""
+	}
+	switch name {
+	case "add", "copy", "remove":
+		return endsInIndex("path")
+	case "move":
+		return endsInIndex("path") || endsInIndex("from")
+	}
+	return false
+}
+
+// countNodes returns the number of JSON values in v, including v itself.
+func countNodes(v any) int {
+	n := 1
+	switch v := v.(type) {
+	case map[string]any:
+		for _, child := range v {
+			n += countNodes(child)
+		}
+	case []any:
+		for _, child := range v {
+			n += countNodes(child)
+		}
+	}
+	return n
+}
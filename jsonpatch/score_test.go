@@ -0,0 +1,47 @@
+package jsonpatch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		ops      []Operation
+		expected Complexity
+	}{
+		{"empty", nil, Complexity{}},
+		{
+			"mixed",
+			[]Operation{
+				{"op": "test", "path": "/a", "value": 1},
+				{"op": "add", "path": "/items/3", "value": map[string]any{"x": 1, "y": []any{1, 2}}},
+				{"op": "add", "path": "/items/-", "value": "s"},
+				{"op": "str_ins", "path": "/s", "pos": 0, "str": "héllo🌍"},
+				{"op": "str_del", "path": "/s", "pos": 0, "len": 5},
+				{"op": "move", "from": "/items/0", "path": "/x"},
+				{"op": "copy", "from": "/x", "path": "/y"},
+			},
+			Complexity{Ops: 7, Nodes: 6, StringVolume: 12, ArrayShifts: 2, Cost: 33},
+		},
+		{
+			"string volume",
+			[]Operation{{"op": "str_ins", "path": "/s", "pos": 0, "str": strings.Repeat("a", 640)}},
+			Complexity{Ops: 1, StringVolume: 640, Cost: 12},
+		},
+		{
+			"large value",
+			[]Operation{{"op": "replace", "path": "/list", "value": make([]any, 159)}},
+			Complexity{Ops: 1, Nodes: 160, Cost: 12},
+		},
+		{"unknown op", []Operation{{"op": "frobnicate", "path": "/a"}}, Complexity{Ops: 1, Cost: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Score(tt.ops); got != tt.expected {
+				t.Fatalf("Complexity not equal.\nGot:      %+v\nExpected: %+v", got, tt.expected)
+			}
+		})
+	}
+}
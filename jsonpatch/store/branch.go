@@ -0,0 +1,175 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// ErrMergeConflict is returned by MergeBranch when the branch and the store
+// changed the same value in different ways.
+var ErrMergeConflict = errors.New("merge conflict")
+
+// Branch is an independent line of patches starting from a revision of a
+// Store, such as a draft that is published by merging it back. It is safe
+// for concurrent use.
+type Branch struct {
+	mu sync.Mutex
+	// base is the store revision the branch was last in sync with and
+	// baseDoc the document at that revision.
+	base    int64
+	baseDoc any
+	head    any
+	entries []Entry
+	now     func() time.Time
+}
+
+// Conflict is a value that the store and a branch both changed since the
+// branch's base, to different results. Each side's value is absent, such as
+// after a remove, when its In flag is false.
+type Conflict struct {
+	Path                     string
+	Base, Ours, Theirs       any
+	InBase, InOurs, InTheirs bool
+}
+
+// Branch starts a branch from revision rev.
+func (s *Store) Branch(rev int64) (*Branch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, err := s.at(rev)
+	if err != nil {
+		return nil, err
+	}
+	return &Branch{base: rev, baseDoc: doc, head: clone(doc), now: s.opts.Now}, nil
+}
+
+// Base returns the store revision the branch started from, or was last
+// merged at.
+func (b *Branch) Base() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.base
+}
+
+// Append applies patch to the branch and logs it, returning the number of
+// patches on the branch. A patch that fails to apply leaves the branch
+// unchanged.
+func (b *Branch) Append(patch []jsonpatch.Operation) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	patch = clonePatch(patch)
+	head, err := jsonpatch.ApplyValue(clone(b.head), clonePatch(patch))
+	if err != nil {
+		return int64(len(b.entries)), err
+	}
+	b.head = head
+	rev := int64(len(b.entries)) + 1
+	b.entries = append(b.entries, Entry{Rev: rev, Time: b.now(), Patch: patch})
+	return rev, nil
+}
+
+// Head returns a copy of the branch's document.
+func (b *Branch) Head() any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return clone(b.head)
+}
+
+// Entries returns the patches on the branch, numbered from 1.
+func (b *Branch) Entries() []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entries := append([]Entry(nil), b.entries...)
+	for i := range entries {
+		entries[i].Patch = clonePatch(entries[i].Patch)
+	}
+	return entries
+}
+
+// MergeBranch merges the changes made on b since its base into the store,
+// three-way: values changed only on the branch take the branch's value,
+// values changed only in the store keep theirs, and values changed on both
+// sides to different results are conflicts. Objects are merged key by key;
+// arrays and strings are merged as whole values.
+//
+// Without conflicts the merge is appended as one patch and the new revision
+// is returned, and the branch continues from it. With conflicts nothing
+// changes: the conflicts are returned with an error wrapping
+// ErrMergeConflict, and can be settled by appending patches to the branch
+// and merging again.
+func (s *Store) MergeBranch(b *Branch) (int64, []Conflict, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.base > s.rev {
+		return s.rev, nil, fmt.Errorf("branch base %d is newer than the latest revision %d", b.base, s.rev)
+	}
+	var conflicts []Conflict
+	merged, _ := merge("", b.baseDoc, s.head, b.head, true, true, true, &conflicts)
+	if len(conflicts) > 0 {
+		return s.rev, conflicts, fmt.Errorf("%w: %d conflicting paths", ErrMergeConflict, len(conflicts))
+	}
+	if patch := diff("", s.head, merged, []jsonpatch.Operation{}); len(patch) > 0 {
+		if _, err := s.appendLocked(patch); err != nil {
+			return s.rev, nil, fmt.Errorf("apply merge: %w", err)
+		}
+	}
+	b.base, b.baseDoc, b.head = s.rev, clone(s.head), clone(s.head)
+	return s.rev, nil, nil
+}
+
+// merge returns the three-way merge of the values at path, and whether the
+// merged value exists. Conflicting values keep ours and are recorded.
+func merge(path string, base, ours, theirs any, inBase, inOurs, inTheirs bool, conflicts *[]Conflict) (any, bool) {
+	same := func(a any, inA bool, b any, inB bool) bool {
+		return inA == inB && (!inA || reflect.DeepEqual(a, b))
+	}
+	switch {
+	case same(ours, inOurs, theirs, inTheirs), same(base, inBase, theirs, inTheirs):
+		return ours, inOurs
+	case same(base, inBase, ours, inOurs):
+		return clone(theirs), inTheirs
+	}
+
+	b, bOk := base.(map[string]any)
+	o, oOk := ours.(map[string]any)
+	t, tOk := theirs.(map[string]any)
+	if !bOk || !oOk || !tOk {
+		*conflicts = append(*conflicts, Conflict{
+			Path: path, Base: clone(base), Ours: clone(ours), Theirs: clone(theirs),
+			InBase: inBase, InOurs: inOurs, InTheirs: inTheirs,
+		})
+		return ours, inOurs
+	}
+	keys := map[string]bool{}
+	for _, m := range []map[string]any{b, o, t} {
+		for k := range m {
+			keys[k] = true
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	result := make(map[string]any, len(o))
+	for _, k := range sorted {
+		bv, inB := b[k]
+		ov, inO := o[k]
+		tv, inT := t[k]
+		child := path + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(k)
+		if v, ok := merge(child, bv, ov, tv, inB, inO, inT, conflicts); ok {
+			result[k] = v
+		}
+	}
+	return result, true
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// diff appends to ops the operations that turn before into after at path.
+// Objects are compared key by key and arrays of equal length element by
+// element; an array that only grew gets its new elements appended, and any
+// other change replaces the value.
+func diff(path string, before, after any, ops []jsonpatch.Operation) []jsonpatch.Operation {
+	switch b := before.(type) {
+	case map[string]any:
+		a, ok := after.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(b)+len(a))
+		for k := range b {
+			keys = append(keys, k)
+		}
+		for k := range a {
+			if _, ok := b[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(k)
+			bv, inBefore := b[k]
+			av, inAfter := a[k]
+			switch {
+			case !inAfter:
+				ops = append(ops, jsonpatch.Operation{"op": "remove", "path": child})
+			case !inBefore:
+				ops = append(ops, jsonpatch.Operation{"op": "add", "path": child, "value": clone(av)})
+			default:
+				ops = diff(child, bv, av, ops)
+			}
+		}
+		return ops
+	case []any:
+		a, ok := after.([]any)
+		if !ok {
+			break
+		}
+		if len(a) == len(b) {
+			for i := range b {
+				ops = diff(path+"/"+strconv.Itoa(i), b[i], a[i], ops)
+			}
+			return ops
+		}
+		if len(a) > len(b) && reflect.DeepEqual(b, a[:len(b)]) {
+			for _, v := range a[len(b):] {
+				ops = append(ops, jsonpatch.Operation{"op": "add", "path": path + "/-", "value": clone(v)})
+			}
+			return ops
+		}
+	}
+	if reflect.DeepEqual(before, after) {
+		return ops
+	}
+	return append(ops, jsonpatch.Operation{"op": "replace", "path": path, "value": clone(after)})
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// ErrCorrupt is returned by Reduce when the patch log does not reproduce the
+// expected document: a revision is missing or out of order, or a document
+// hash does not match.
+var ErrCorrupt = errors.New("corrupt patch log")
+
+// Checkpoint is the hash of the document as of a revision, with the document
+// itself when it is handed to a ReduceOptions.Checkpoint callback.
+type Checkpoint struct {
+	Rev  int64
+	Hash string
+	Doc  any
+}
+
+// ReduceOptions configures Reduce. The zero value replays the log without
+// checkpoints or verification.
+type ReduceOptions struct {
+	// From is the revision of the base document. Entries must continue from
+	// From+1 without gaps.
+	From int64
+	// Every takes a checkpoint every Every revisions (at revisions that are
+	// multiples of Every). Zero disables checkpoints.
+	Every int
+	// Checkpoint, if set, is called with each checkpoint. The document must
+	// not be modified; an error stops the reduction and is returned.
+	Checkpoint func(Checkpoint) error
+	// Expected maps revisions to the hashes the document must have there,
+	// such as the checkpoints of an earlier reduction.
+	Expected map[int64]string
+}
+
+// Reduce replays entries over base, which is not modified, and returns the
+// resulting document and its revision. It is meant for rebuilding
+// projections from a patch event store: checkpoints let the caller persist
+// progress, and document hashes detect a log that no longer reproduces what
+// it did.
+func Reduce(base map[string]any, entries iter.Seq[Entry], opts ReduceOptions) (map[string]any, int64, error) {
+	doc := clone(base).(map[string]any)
+	rev := opts.From
+	for e := range entries {
+		if e.Rev != rev+1 {
+			return nil, rev, fmt.Errorf("%w: expected revision %d, got %d", ErrCorrupt, rev+1, e.Rev)
+		}
+		if err := jsonpatch.Apply(doc, clonePatch(e.Patch)); err != nil {
+			return nil, rev, fmt.Errorf("revision %d: %w", e.Rev, err)
+		}
+		rev = e.Rev
+
+		expected, verify := opts.Expected[rev]
+		checkpoint := opts.Every > 0 && rev%int64(opts.Every) == 0
+		if !verify && !checkpoint {
+			continue
+		}
+		hash, err := Hash(doc)
+		if err != nil {
+			return nil, rev, fmt.Errorf("revision %d: %w", rev, err)
+		}
+		if verify && hash != expected {
+			return nil, rev, fmt.Errorf("%w: document hash at revision %d is %s, expected %s", ErrCorrupt, rev, hash, expected)
+		}
+		if checkpoint && opts.Checkpoint != nil {
+			if err := opts.Checkpoint(Checkpoint{Rev: rev, Hash: hash, Doc: doc}); err != nil {
+				return nil, rev, err
+			}
+		}
+	}
+	return doc, rev, nil
+}
+
+// Hash returns a content hash of doc: the hex SHA-256 of its JSON encoding,
+// in which object keys are sorted. Documents that are equal as JSON have the
+// same hash.
+func Hash(doc any) (string, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("hash document: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
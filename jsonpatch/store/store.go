@@ -0,0 +1,468 @@
+// Package store keeps a document together with the log of patches applied
+// to it.
+//
+// Every patch appended to a Store gets the next revision number. Snapshots of
+// the document are materialized as the log grows, according to a
+// CompactionPolicy, and log entries older than the oldest snapshot kept are
+// truncated, so the cost of reconstructing past revisions stays bounded for
+// long-lived documents. GC drops history by age or count instead, according
+// to a RetentionPolicy, and tagged revisions survive both.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// Entry is one patch in the log.
+type Entry struct {
+	// Rev is the revision the patch produced. The first patch has Rev 1.
+	Rev  int64
+	Time time.Time
+	// Patch is kept as appended, including members Apply ignores such as
+	// per-op "id"s, so the log records which client edits produced Rev.
+	Patch []jsonpatch.Operation
+}
+
+// Snapshot is the document as of a revision.
+type Snapshot struct {
+	Rev  int64
+	Time time.Time
+	Doc  any
+}
+
+// CompactionPolicy decides when snapshots are taken and how much history is
+// kept. The zero value never compacts.
+type CompactionPolicy struct {
+	// SnapshotEvery materializes a snapshot once this many entries have been
+	// appended since the last one. Zero disables automatic snapshots.
+	SnapshotEvery int
+	// KeepSnapshots is the number of snapshots retained. Older snapshots are
+	// dropped along with the entries before the oldest one kept. Zero keeps
+	// every snapshot and the whole log.
+	KeepSnapshots int
+}
+
+// RetentionPolicy decides how much history GC keeps. Revisions that are
+// required by any rule are kept, and so are tagged revisions (see Store.Tag).
+// The zero value keeps everything.
+type RetentionPolicy struct {
+	// KeepRevisions keeps the latest KeepRevisions revisions, including the
+	// latest one, available.
+	KeepRevisions int
+	// KeepFor keeps every revision that was the latest one within KeepFor
+	// of now available.
+	KeepFor time.Duration
+}
+
+// Options configures a Store. The zero value keeps the whole log.
+type Options struct {
+	Compaction CompactionPolicy
+	Retention  RetentionPolicy
+	// CheckpointEvery records a Checkpoint with the document's content hash
+	// at every revision that is a multiple of it. Replicas replaying the same
+	// log can compare checkpoints to detect divergence (see
+	// FindDivergence). Zero disables checkpoints.
+	CheckpointEvery int
+	// OnCheckpoint, if set, is called with each checkpoint recorded, without
+	// its document. It is called with the store locked and must not use the
+	// store.
+	OnCheckpoint func(Checkpoint)
+	// Validate, if set, is passed to jsonpatch.Options.ValidateDocument when
+	// applying each patch, so it is called with the document the patch
+	// produces before the patch is logged. An error rejects the patch,
+	// leaving the store unchanged, and is returned wrapped in
+	// jsonpatch.ErrInvalidDocument. See jsonpatch.ValidateAs for checking
+	// struct tags. Patches to a Branch are checked when the branch is merged.
+	Validate func(doc any) error
+	// Now returns the time recorded for entries and snapshots. It defaults to
+	// time.Now.
+	Now func() time.Time
+}
+
+// ErrCompacted is returned when a revision's entries have been truncated.
+var ErrCompacted = errors.New("revision has been compacted")
+
+var storeIDs atomic.Uint64
+
+// Store is a document with its patch log. It is safe for concurrent use.
+type Store struct {
+	// id orders stores for locking in transactions.
+	id   uint64
+	mu   sync.RWMutex
+	opts Options
+	head any
+	rev  int64
+	// snapshots is ordered by Rev and never empty. entries holds every patch
+	// after snapshots[0].Rev, in order.
+	snapshots []Snapshot
+	entries   []Entry
+	// checkpoints is ordered by Rev and holds the checkpoints from
+	// snapshots[0].Rev on.
+	checkpoints []Checkpoint
+	// tags maps tag names to revisions, and pinned holds the documents of
+	// tagged revisions older than snapshots[0].Rev.
+	tags   map[string]int64
+	pinned map[int64]Snapshot
+}
+
+// New returns a store whose revision 0 is doc.
+func New(doc any, opts Options) *Store {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Store{
+		id:        storeIDs.Add(1),
+		opts:      opts,
+		head:      clone(doc),
+		snapshots: []Snapshot{{Rev: 0, Time: opts.Now(), Doc: clone(doc)}},
+		tags:      map[string]int64{},
+		pinned:    map[int64]Snapshot{},
+	}
+}
+
+// Append applies patch to the latest revision and logs it, returning the new
+// revision. A patch that fails to apply, or whose result Options.Validate
+// rejects, is not logged and leaves the document unchanged.
+func (s *Store) Append(patch []jsonpatch.Operation) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appendLocked(patch)
+}
+
+func (s *Store) appendLocked(patch []jsonpatch.Operation) (int64, error) {
+	patch = clonePatch(patch)
+	head, err := jsonpatch.ApplyValueWithOptions(clone(s.head), clonePatch(patch), s.applyOptions())
+	if err != nil {
+		return s.rev, err
+	}
+	s.commitLocked(patch, head)
+	return s.rev, nil
+}
+
+// applyOptions returns the options patches to the store are applied with.
+func (s *Store) applyOptions() jsonpatch.Options {
+	return jsonpatch.Options{ValidateDocument: s.opts.Validate}
+}
+
+// commitLocked logs patch, which turned the latest revision into head.
+func (s *Store) commitLocked(patch []jsonpatch.Operation, head any) {
+	s.head = head
+	s.rev++
+	s.entries = append(s.entries, Entry{Rev: s.rev, Time: s.opts.Now(), Patch: patch})
+
+	if every := s.opts.CheckpointEvery; every > 0 && s.rev%int64(every) == 0 {
+		// Documents decoded from JSON always encode, so a hash error only
+		// skips the checkpoint.
+		if hash, err := Hash(s.head); err == nil {
+			c := Checkpoint{Rev: s.rev, Hash: hash}
+			s.checkpoints = append(s.checkpoints, c)
+			if s.opts.OnCheckpoint != nil {
+				s.opts.OnCheckpoint(c)
+			}
+		}
+	}
+	if every := s.opts.Compaction.SnapshotEvery; every > 0 && s.rev-s.snapshots[len(s.snapshots)-1].Rev >= int64(every) {
+		s.compact()
+	}
+}
+
+// Head returns a copy of the latest document and its revision.
+func (s *Store) Head() (any, int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return clone(s.head), s.rev
+}
+
+// Entries returns the log entries after revision since.
+func (s *Store) Entries(since int64) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	first := s.snapshots[0].Rev
+	switch {
+	case since < first:
+		return nil, fmt.Errorf("%w: entries after revision %d (oldest available is %d)", ErrCompacted, since, first)
+	case since > s.rev:
+		return nil, fmt.Errorf("revision %d is newer than the latest revision %d", since, s.rev)
+	}
+	entries := append([]Entry(nil), s.entries[since-first:]...)
+	for i := range entries {
+		entries[i].Patch = clonePatch(entries[i].Patch)
+	}
+	return entries, nil
+}
+
+// At returns the document as of revision rev, reconstructed from the nearest
+// snapshot at or before it by replaying the log.
+func (s *Store) At(rev int64) (any, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.at(rev)
+}
+
+// AtTime returns the document as it was at time t, along with its revision:
+// the latest revision appended at or before t.
+func (s *Store) AtTime(t time.Time) (any, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rev := int64(-1)
+	if first := s.snapshots[0]; !first.Time.After(t) {
+		rev = first.Rev
+	}
+	for _, e := range s.entries {
+		if e.Time.After(t) {
+			break
+		}
+		rev = e.Rev
+	}
+	if rev < 0 {
+		if s.snapshots[0].Rev == 0 {
+			return nil, 0, fmt.Errorf("no revision at %v: the document was created at %v", t, s.snapshots[0].Time)
+		}
+		return nil, 0, fmt.Errorf("%w: revisions at %v (oldest available is %d from %v)", ErrCompacted, t, s.snapshots[0].Rev, s.snapshots[0].Time)
+	}
+	doc, err := s.at(rev)
+	return doc, rev, err
+}
+
+// DiffBetween returns a patch that turns the document as of revision from
+// into the document as of revision to. It describes the net change rather
+// than replaying each entry, so values changed back and forth do not appear,
+// and from may be newer than to.
+func (s *Store) DiffBetween(from, to int64) ([]jsonpatch.Operation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	before, err := s.at(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.at(to)
+	if err != nil {
+		return nil, err
+	}
+	return diff("", before, after, []jsonpatch.Operation{}), nil
+}
+
+func (s *Store) at(rev int64) (any, error) {
+	first := s.snapshots[0].Rev
+	if snap, ok := s.pinned[rev]; ok && rev < first {
+		return clone(snap.Doc), nil
+	}
+	switch {
+	case rev < first:
+		return nil, fmt.Errorf("%w: revision %d (oldest available is %d)", ErrCompacted, rev, first)
+	case rev > s.rev:
+		return nil, fmt.Errorf("revision %d is newer than the latest revision %d", rev, s.rev)
+	case rev == s.rev:
+		return clone(s.head), nil
+	}
+	snap := s.snapshots[0]
+	for _, candidate := range s.snapshots[1:] {
+		if candidate.Rev > rev {
+			break
+		}
+		snap = candidate
+	}
+	doc := clone(snap.Doc)
+	for _, e := range s.entries[snap.Rev-first : rev-first] {
+		var err error
+		if doc, err = jsonpatch.ApplyValue(doc, clonePatch(e.Patch)); err != nil {
+			return nil, fmt.Errorf("replay revision %d: %w", e.Rev, err)
+		}
+	}
+	return doc, nil
+}
+
+// Snapshots returns the revisions and times of the retained snapshots, oldest
+// first, without their documents.
+func (s *Store) Snapshots() []Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshots := make([]Snapshot, len(s.snapshots))
+	for i, snap := range s.snapshots {
+		snapshots[i] = Snapshot{Rev: snap.Rev, Time: snap.Time}
+	}
+	return snapshots
+}
+
+// Compact materializes a snapshot of the latest revision, unless one exists,
+// and truncates history according to the compaction policy.
+func (s *Store) Compact() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compact()
+}
+
+func (s *Store) compact() {
+	if s.snapshots[len(s.snapshots)-1].Rev != s.rev {
+		s.snapshots = append(s.snapshots, Snapshot{Rev: s.rev, Time: s.opts.Now(), Doc: clone(s.head)})
+	}
+	keep := s.opts.Compaction.KeepSnapshots
+	if keep <= 0 || len(s.snapshots) <= keep {
+		return
+	}
+	s.truncate(len(s.snapshots) - keep)
+}
+
+// GC drops the history that the retention policy does not require and
+// returns the oldest revision left available, tagged revisions aside. A
+// snapshot is materialized at that revision when none exists, so every
+// revision from it to the latest can still be replayed.
+func (s *Store) GC() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first := s.snapshots[0].Rev
+	r := s.opts.Retention
+	if r.KeepRevisions <= 0 && r.KeepFor <= 0 {
+		return first, nil
+	}
+	oldest := s.rev
+	if r.KeepRevisions > 0 {
+		oldest = min(oldest, s.rev-int64(r.KeepRevisions)+1)
+	}
+	if r.KeepFor > 0 {
+		cutoff := s.opts.Now().Add(-r.KeepFor)
+		latest := first
+		for _, e := range s.entries {
+			if e.Time.After(cutoff) {
+				break
+			}
+			latest = e.Rev
+		}
+		oldest = min(oldest, latest)
+	}
+	if oldest <= first {
+		return first, nil
+	}
+
+	i := 0
+	for i+1 < len(s.snapshots) && s.snapshots[i+1].Rev <= oldest {
+		i++
+	}
+	if s.snapshots[i].Rev != oldest {
+		doc, err := s.at(oldest)
+		if err != nil {
+			return first, err
+		}
+		i++
+		s.snapshots = slices.Insert(s.snapshots, i, Snapshot{Rev: oldest, Time: s.timeOf(oldest), Doc: doc})
+	}
+	s.truncate(i)
+	return oldest, nil
+}
+
+// Tag names revision rev, which must be available. A tagged revision stays
+// available to At after the history around it is compacted or collected.
+// Tagging another revision with the same name moves the tag.
+func (s *Store) Tag(name string, rev int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, pinned := s.pinned[rev]; !pinned {
+		if first := s.snapshots[0].Rev; rev < first {
+			return fmt.Errorf("%w: revision %d (oldest available is %d)", ErrCompacted, rev, first)
+		} else if rev > s.rev {
+			return fmt.Errorf("revision %d is newer than the latest revision %d", rev, s.rev)
+		}
+	}
+	old, retagged := s.tags[name]
+	s.tags[name] = rev
+	if retagged {
+		s.unpin(old)
+	}
+	return nil
+}
+
+// Untag removes a tag. The revision it named may then be collected.
+func (s *Store) Untag(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rev, ok := s.tags[name]; ok {
+		delete(s.tags, name)
+		s.unpin(rev)
+	}
+}
+
+// Tags returns the revision of every tag.
+func (s *Store) Tags() map[string]int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.tags)
+}
+
+// unpin drops the pinned document of rev unless a tag still names it.
+func (s *Store) unpin(rev int64) {
+	for _, tagged := range s.tags {
+		if tagged == rev {
+			return
+		}
+	}
+	delete(s.pinned, rev)
+}
+
+// truncate drops the snapshots before snapshots[i] and the history before
+// it, pinning the tagged revisions that are dropped.
+func (s *Store) truncate(i int) {
+	oldFirst, first := s.snapshots[0].Rev, s.snapshots[i].Rev
+	for _, rev := range s.tags {
+		if _, ok := s.pinned[rev]; ok || rev >= first {
+			continue
+		}
+		if doc, err := s.at(rev); err == nil {
+			s.pinned[rev] = Snapshot{Rev: rev, Time: s.timeOf(rev), Doc: doc}
+		}
+	}
+	s.snapshots = append([]Snapshot(nil), s.snapshots[i:]...)
+	s.entries = append([]Entry(nil), s.entries[first-oldFirst:]...)
+	kept := 0
+	for kept < len(s.checkpoints) && s.checkpoints[kept].Rev < first {
+		kept++
+	}
+	s.checkpoints = append([]Checkpoint(nil), s.checkpoints[kept:]...)
+}
+
+// timeOf returns the time revision rev, which must be available in the log,
+// was appended.
+func (s *Store) timeOf(rev int64) time.Time {
+	first := s.snapshots[0].Rev
+	if rev == first {
+		return s.snapshots[0].Time
+	}
+	return s.entries[rev-first-1].Time
+}
+
+func clonePatch(patch []jsonpatch.Operation) []jsonpatch.Operation {
+	if patch == nil {
+		return nil
+	}
+	out := make([]jsonpatch.Operation, len(patch))
+	for i, op := range patch {
+		out[i] = clone(op).(map[string]any)
+	}
+	return out
+}
+
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, child := range v {
+			m[k] = clone(child)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, child := range v {
+			s[i] = clone(child)
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -0,0 +1,580 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+func set(path string, value float64) []jsonpatch.Operation {
+	return []jsonpatch.Operation{{"op": "replace", "path": path, "value": value}}
+}
+
+func TestStoreAppend(t *testing.T) {
+	s := New(map[string]any{"n": float64(0)}, Options{})
+	for i := 1; i <= 3; i++ {
+		if rev, err := s.Append(set("/n", float64(i))); err != nil || rev != int64(i) {
+			t.Fatalf("append %d: rev %d, %v", i, rev, err)
+		}
+	}
+	if _, err := s.Append(set("/missing", 1)); err == nil {
+		t.Fatal("expected an error for a patch that does not apply")
+	}
+	doc, rev := s.Head()
+	if rev != 3 || !reflect.DeepEqual(doc, map[string]any{"n": float64(3)}) {
+		t.Fatalf("unexpected head %v at %d", doc, rev)
+	}
+	entries, err := s.Entries(1)
+	if err != nil || len(entries) != 2 || entries[0].Rev != 2 {
+		t.Fatalf("unexpected entries %v, %v", entries, err)
+	}
+	if _, err := s.Entries(4); err == nil {
+		t.Fatal("expected an error for a future revision")
+	}
+}
+
+func TestStoreCompaction(t *testing.T) {
+	s := New(map[string]any{"n": float64(0)}, Options{Compaction: CompactionPolicy{SnapshotEvery: 4, KeepSnapshots: 2}})
+	for i := range 10 {
+		if _, err := s.Append(set("/n", float64(i+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Snapshots were taken at 4 and 8; the one at 0 was dropped with the
+	// entries up to 4.
+	var revs []int64
+	for _, snap := range s.Snapshots() {
+		revs = append(revs, snap.Rev)
+	}
+	if fmt.Sprint(revs) != "[4 8]" {
+		t.Fatalf("unexpected snapshots %v", revs)
+	}
+	if _, err := s.Entries(3); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("expected ErrCompacted, got %v", err)
+	}
+	entries, err := s.Entries(4)
+	if err != nil || len(entries) != 6 || entries[0].Rev != 5 {
+		t.Fatalf("unexpected entries %v, %v", entries, err)
+	}
+
+	s.Compact()
+	revs = revs[:0]
+	for _, snap := range s.Snapshots() {
+		revs = append(revs, snap.Rev)
+	}
+	if fmt.Sprint(revs) != "[8 10]" {
+		t.Fatalf("unexpected snapshots after Compact %v", revs)
+	}
+	if entries, err := s.Entries(8); err != nil || len(entries) != 2 {
+		t.Fatalf("unexpected entries %v, %v", entries, err)
+	}
+}
+
+func TestStoreGC(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := New(map[string]any{"n": float64(0)}, Options{
+		Compaction: CompactionPolicy{SnapshotEvery: 4},
+		Retention:  RetentionPolicy{KeepRevisions: 5, KeepFor: time.Hour},
+		Now:        func() time.Time { return now },
+	})
+	for i := 1; i <= 10; i++ {
+		now = now.Add(time.Minute)
+		if _, err := s.Append(set("/n", float64(i))); err != nil {
+			t.Fatal(err)
+		}
+		if i == 2 {
+			if err := s.Tag("release", 2); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Every revision is less than an hour old.
+	if oldest, err := s.GC(); err != nil || oldest != 0 {
+		t.Fatalf("expected nothing to be collected, got %d, %v", oldest, err)
+	}
+
+	// Revision 7 was the latest one an hour ago; the last five are 6 to 10.
+	now = now.Add(time.Hour - 3*time.Minute)
+	oldest, err := s.GC()
+	if err != nil || oldest != 6 {
+		t.Fatalf("expected revisions from 6 on to be kept, got %d, %v", oldest, err)
+	}
+	var revs []int64
+	for _, snap := range s.Snapshots() {
+		revs = append(revs, snap.Rev)
+	}
+	if fmt.Sprint(revs) != "[6 8]" {
+		t.Fatalf("unexpected snapshots %v", revs)
+	}
+	if doc, err := s.At(6); err != nil || !reflect.DeepEqual(doc, map[string]any{"n": float64(6)}) {
+		t.Fatalf("unexpected revision 6: %v, %v", doc, err)
+	}
+	if _, err := s.At(5); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("expected ErrCompacted, got %v", err)
+	}
+	if doc, err := s.At(2); err != nil || !reflect.DeepEqual(doc, map[string]any{"n": float64(2)}) {
+		t.Fatalf("expected the tagged revision to be kept, got %v, %v", doc, err)
+	}
+	if doc, rev, err := s.AtTime(now); err != nil || rev != 10 || !reflect.DeepEqual(doc, map[string]any{"n": float64(10)}) {
+		t.Fatalf("unexpected latest revision %d: %v, %v", rev, doc, err)
+	}
+
+	s.Untag("release")
+	if _, err := s.At(2); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("expected ErrCompacted after Untag, got %v", err)
+	}
+	if err := s.Tag("release", 3); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("expected ErrCompacted tagging a collected revision, got %v", err)
+	}
+	if len(s.Tags()) != 0 {
+		t.Fatalf("unexpected tags %v", s.Tags())
+	}
+}
+
+// clock returns a time source that starts at start and advances by one
+// minute on every call.
+func clock(start time.Time) func() time.Time {
+	now := start.Add(-time.Minute)
+	return func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+}
+
+func TestStoreAt(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := New(map[string]any{"n": float64(0)}, Options{
+		Compaction: CompactionPolicy{SnapshotEvery: 3, KeepSnapshots: 2},
+		Now:        clock(start),
+	})
+	for i := 1; i <= 8; i++ {
+		if _, err := s.Append(set("/n", float64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Snapshots are kept at 3 and 6.
+	for rev := int64(3); rev <= 8; rev++ {
+		doc, err := s.At(rev)
+		if err != nil || !reflect.DeepEqual(doc, map[string]any{"n": float64(rev)}) {
+			t.Fatalf("At(%d) = %v, %v", rev, doc, err)
+		}
+	}
+	if _, err := s.At(2); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("expected ErrCompacted, got %v", err)
+	}
+	if _, err := s.At(9); err == nil {
+		t.Fatal("expected an error for a future revision")
+	}
+
+	doc, _ := s.At(5)
+	doc.(map[string]any)["n"] = "changed"
+	if doc, _ := s.At(5); doc.(map[string]any)["n"] != float64(5) {
+		t.Fatalf("At returned a shared document: %v", doc)
+	}
+}
+
+func TestStoreAtTime(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// The store is created at start and revision i is appended i minutes
+	// later.
+	s := New(map[string]any{"n": float64(0)}, Options{Now: clock(start)})
+	for i := 1; i <= 3; i++ {
+		if _, err := s.Append(set("/n", float64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name          string
+		at            time.Time
+		expectedRev   int64
+		expectedError string
+	}{
+		{name: "creation", at: start, expectedRev: 0},
+		{name: "exactly at an append", at: start.Add(2 * time.Minute), expectedRev: 2},
+		{name: "between appends", at: start.Add(150 * time.Second), expectedRev: 2},
+		{name: "after the last append", at: start.Add(time.Hour), expectedRev: 3},
+		{name: "before creation", at: start.Add(-time.Second), expectedError: "the document was created at"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, rev, err := s.AtTime(tt.at)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rev != tt.expectedRev || !reflect.DeepEqual(doc, map[string]any{"n": float64(tt.expectedRev)}) {
+				t.Fatalf("expected revision %d, got %v at %d", tt.expectedRev, doc, rev)
+			}
+		})
+	}
+}
+
+func TestStoreDiffBetween(t *testing.T) {
+	s := New(map[string]any{"n": float64(0), "list": []any{"a"}, "obj": map[string]any{"x": "y"}}, Options{})
+	patches := [][]jsonpatch.Operation{
+		set("/n", 1),
+		{{"op": "add", "path": "/list/-", "value": "b"}},
+		{{"op": "add", "path": "/obj/z", "value": map[string]any{"deep": true}}},
+		set("/n", 0),
+		{{"op": "remove", "path": "/obj/x"}},
+		{{"op": "remove", "path": "/list/0"}},
+	}
+	for _, patch := range patches {
+		if _, err := s.Append(patch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	patch, err := s.DiffBetween(0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// n changed and changed back, so only the list and object remain.
+	expected := []jsonpatch.Operation{
+		{"op": "add", "path": "/list/-", "value": "b"},
+		{"op": "add", "path": "/obj/z", "value": map[string]any{"deep": true}},
+	}
+	if !reflect.DeepEqual(patch, expected) {
+		t.Fatalf("expected %v, got %v", expected, patch)
+	}
+
+	for _, revs := range [][2]int64{{0, 6}, {6, 0}, {2, 5}, {3, 3}} {
+		patch, err := s.DiffBetween(revs[0], revs[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		from, _ := s.At(revs[0])
+		to, _ := s.At(revs[1])
+		got, err := jsonpatch.ApplyValue(from, patch)
+		if err != nil || !reflect.DeepEqual(got, to) {
+			t.Fatalf("diff %d..%d %v gives %v, %v; expected %v", revs[0], revs[1], patch, got, err, to)
+		}
+	}
+}
+
+func TestStoreMergeBranch(t *testing.T) {
+	s := New(map[string]any{
+		"title": "draft",
+		"body":  "text",
+		"meta":  map[string]any{"a": float64(1), "b": float64(2)},
+	}, Options{})
+	if _, err := s.Append(set("/meta/b", 3)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.Branch(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, patch := range [][]jsonpatch.Operation{
+		{{"op": "replace", "path": "/body", "value": "new text"}},
+		set("/meta/a", 10),
+		{{"op": "remove", "path": "/meta/b"}},
+	} {
+		if _, err := b.Append(patch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Append([]jsonpatch.Operation{{"op": "replace", "path": "/title", "value": "published"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rev, conflicts, err := s.MergeBranch(b)
+	if err != nil || len(conflicts) != 0 || rev != 3 {
+		t.Fatalf("unexpected merge result %d, %v, %v", rev, conflicts, err)
+	}
+	want := map[string]any{"title": "published", "body": "new text", "meta": map[string]any{"a": float64(10)}}
+	if doc, _ := s.Head(); !reflect.DeepEqual(doc, want) {
+		t.Fatalf("expected %v, got %v", want, doc)
+	}
+	if b.Base() != 3 || !reflect.DeepEqual(b.Head(), want) || len(b.Entries()) != 3 {
+		t.Fatalf("branch did not continue from the merge: base %d, head %v", b.Base(), b.Head())
+	}
+
+	// Both sides change the title.
+	if _, err := b.Append([]jsonpatch.Operation{{"op": "replace", "path": "/title", "value": "branch"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Append([]jsonpatch.Operation{{"op": "replace", "path": "/title", "value": "store"}}); err != nil {
+		t.Fatal(err)
+	}
+	rev, conflicts, err = s.MergeBranch(b)
+	if !errors.Is(err, ErrMergeConflict) || rev != 4 {
+		t.Fatalf("expected ErrMergeConflict at 4, got %d, %v", rev, err)
+	}
+	expected := []Conflict{{Path: "/title", Base: "published", Ours: "store", Theirs: "branch", InBase: true, InOurs: true, InTheirs: true}}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Fatalf("expected %v, got %v", expected, conflicts)
+	}
+
+	// Settling the conflict on the branch lets the merge through.
+	if _, err := b.Append([]jsonpatch.Operation{{"op": "replace", "path": "/title", "value": "store"}}); err != nil {
+		t.Fatal(err)
+	}
+	if rev, conflicts, err = s.MergeBranch(b); err != nil || len(conflicts) != 0 || rev != 4 {
+		t.Fatalf("unexpected merge result %d, %v, %v", rev, conflicts, err)
+	}
+
+	if _, err := s.Branch(5); err == nil {
+		t.Fatal("expected an error for a future revision")
+	}
+}
+
+func TestReduce(t *testing.T) {
+	base := map[string]any{"n": float64(0)}
+	var entries []Entry
+	for i := 1; i <= 6; i++ {
+		entries = append(entries, Entry{Rev: int64(i), Patch: set("/n", float64(i))})
+	}
+
+	var checkpoints []Checkpoint
+	doc, rev, err := Reduce(base, slices.Values(entries), ReduceOptions{
+		Every: 2,
+		Checkpoint: func(c Checkpoint) error {
+			checkpoints = append(checkpoints, Checkpoint{Rev: c.Rev, Hash: c.Hash})
+			return nil
+		},
+	})
+	if err != nil || rev != 6 || !reflect.DeepEqual(doc, map[string]any{"n": float64(6)}) {
+		t.Fatalf("unexpected result %v at %d, %v", doc, rev, err)
+	}
+	if base["n"] != float64(0) {
+		t.Fatalf("base was modified: %v", base)
+	}
+	if len(checkpoints) != 3 || checkpoints[2].Rev != 6 {
+		t.Fatalf("unexpected checkpoints %v", checkpoints)
+	}
+	if hash, _ := Hash(map[string]any{"n": 4}); hash != checkpoints[1].Hash {
+		t.Fatalf("checkpoint hash %s does not match the document", checkpoints[1].Hash)
+	}
+
+	expected := map[int64]string{}
+	for _, c := range checkpoints {
+		expected[c.Rev] = c.Hash
+	}
+	tests := []struct {
+		name          string
+		entries       []Entry
+		opts          ReduceOptions
+		expectedRev   int64
+		expectedError string
+	}{
+		{
+			name:        "verified replay",
+			entries:     entries,
+			opts:        ReduceOptions{Expected: expected},
+			expectedRev: 6,
+		},
+		{
+			name:        "resumed from a checkpoint",
+			entries:     entries[4:],
+			opts:        ReduceOptions{From: 4, Expected: expected},
+			expectedRev: 6,
+		},
+		{
+			name:          "tampered entry",
+			entries:       append(append(slices.Clone(entries[:3]), Entry{Rev: 4, Patch: set("/n", 40)}), entries[4:]...),
+			opts:          ReduceOptions{Expected: expected},
+			expectedRev:   4,
+			expectedError: "document hash at revision 4",
+		},
+		{
+			name:          "missing entry",
+			entries:       append(slices.Clone(entries[:2]), entries[3:]...),
+			expectedRev:   2,
+			expectedError: "expected revision 3, got 4",
+		},
+		{
+			name:          "entry that does not apply",
+			entries:       []Entry{{Rev: 1, Patch: set("/missing", 1)}},
+			expectedError: "revision 1:",
+		},
+		{
+			name:    "checkpoint error stops the reduction",
+			entries: entries,
+			opts: ReduceOptions{Every: 3, Checkpoint: func(Checkpoint) error {
+				return errors.New("disk full")
+			}},
+			expectedRev:   3,
+			expectedError: "disk full",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, rev, err := Reduce(base, slices.Values(tt.entries), tt.opts)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rev != tt.expectedRev {
+				t.Fatalf("expected revision %d, got %d", tt.expectedRev, rev)
+			}
+		})
+	}
+}
+
+func TestFindDivergence(t *testing.T) {
+	var emitted []Checkpoint
+	opts := Options{CheckpointEvery: 4}
+	ours := New(map[string]any{"n": float64(0)}, Options{
+		CheckpointEvery: 4,
+		OnCheckpoint:    func(c Checkpoint) { emitted = append(emitted, c) },
+	})
+	theirs := New(map[string]any{"n": float64(0)}, opts)
+	same := New(map[string]any{"n": float64(0)}, opts)
+	for i := 1; i <= 10; i++ {
+		patch := set("/n", float64(i))
+		if _, err := ours.Append(patch); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := same.Append(patch); err != nil {
+			t.Fatal(err)
+		}
+		if i == 6 {
+			// theirs applies a different patch at 6 and stays diverged.
+			patch = append(patch, jsonpatch.Operation{"op": "add", "path": "/extra", "value": true})
+		}
+		if _, err := theirs.Append(patch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(emitted) != 2 || emitted[0].Rev != 4 || emitted[1].Rev != 8 || emitted[0].Doc != nil {
+		t.Fatalf("unexpected checkpoints %v", emitted)
+	}
+	if !reflect.DeepEqual(ours.Checkpoints(), emitted) {
+		t.Fatalf("expected stored checkpoints %v, got %v", emitted, ours.Checkpoints())
+	}
+
+	if d, found, err := FindDivergence(ours, same); err != nil || found {
+		t.Fatalf("expected no divergence, got %v, %v", d, err)
+	}
+	d, found, err := FindDivergence(ours, theirs)
+	if err != nil || !found {
+		t.Fatalf("expected a divergence, got %v", err)
+	}
+	if d.Rev != 6 {
+		t.Fatalf("expected divergence at revision 6, got %d", d.Rev)
+	}
+	if hash, _ := ours.HashAt(6); d.Ours != hash {
+		t.Fatalf("expected our hash %s, got %s", hash, d.Ours)
+	}
+
+	ours.opts.Compaction = CompactionPolicy{KeepSnapshots: 1}
+	ours.Compact()
+	if checkpoints := ours.Checkpoints(); len(checkpoints) != 0 {
+		t.Fatalf("expected checkpoints before the oldest snapshot to be dropped, got %v", checkpoints)
+	}
+	if _, err := ours.HashAt(3); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("expected ErrCompacted, got %v", err)
+	}
+}
+
+func TestTxCommit(t *testing.T) {
+	users := New(map[string]any{"alice": map[string]any{"email": "a@old"}}, Options{})
+	index := New(map[string]any{"a@old": "alice"}, Options{})
+
+	var tx Tx
+	tx.Add(users, []jsonpatch.Operation{{"op": "replace", "path": "/alice/email", "value": "a@new"}})
+	tx.Add(index, []jsonpatch.Operation{{"op": "move", "from": "/a@old", "path": "/a@new"}})
+	tx.Add(users, []jsonpatch.Operation{{"op": "add", "path": "/alice/verified", "value": false}})
+	revs, err := tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(revs, []int64{1, 1, 2}) {
+		t.Fatalf("unexpected revisions %v", revs)
+	}
+	if doc, _ := index.Head(); !reflect.DeepEqual(doc, map[string]any{"a@new": "alice"}) {
+		t.Fatalf("unexpected index %v", doc)
+	}
+	if doc, _ := users.At(1); !reflect.DeepEqual(doc, map[string]any{"alice": map[string]any{"email": "a@new"}}) {
+		t.Fatalf("unexpected users at revision 1: %v", doc)
+	}
+
+	var failing Tx
+	failing.Add(users, []jsonpatch.Operation{{"op": "replace", "path": "/alice/email", "value": "a@newer"}})
+	failing.Add(index, []jsonpatch.Operation{{"op": "move", "from": "/a@missing", "path": "/a@newer"}})
+	if _, err := failing.Commit(); err == nil || !strings.Contains(err.Error(), "patch 1:") {
+		t.Fatalf("expected the second patch to fail, got %v", err)
+	}
+	if _, rev := users.Head(); rev != 2 {
+		t.Fatalf("expected users to stay at revision 2, got %d", rev)
+	}
+	if _, rev := index.Head(); rev != 1 {
+		t.Fatalf("expected index to stay at revision 1, got %d", rev)
+	}
+}
+
+// fieldErrors stands in for the errors of a struct-tag validator.
+type fieldErrors []string
+
+func (e fieldErrors) Error() string { return strings.Join(e, "; ") }
+
+type profile struct {
+	Name  string `json:"name"`
+	Seats int    `json:"seats"`
+}
+
+func checkProfile(v any) error {
+	p := v.(*profile)
+	var errs fieldErrors
+	if p.Name == "" {
+		errs = append(errs, "name is required")
+	}
+	if p.Seats < 1 {
+		errs = append(errs, "seats must be at least 1")
+	}
+	if errs != nil {
+		return errs
+	}
+	return nil
+}
+
+func TestStoreValidate(t *testing.T) {
+	s := New(map[string]any{"name": "acme", "seats": float64(2)}, Options{Validate: jsonpatch.ValidateAs[profile](checkProfile)})
+	if _, err := s.Append(set("/seats", 3)); err != nil {
+		t.Fatalf("valid patch rejected: %v", err)
+	}
+
+	_, err := s.Append([]jsonpatch.Operation{
+		{"op": "replace", "path": "/name", "value": ""},
+		{"op": "replace", "path": "/seats", "value": 0},
+	})
+	var fields fieldErrors
+	if !errors.Is(err, jsonpatch.ErrInvalidDocument) || !errors.As(err, &fields) || len(fields) != 2 {
+		t.Fatalf("expected two field errors wrapped in ErrInvalidDocument, got %v", err)
+	}
+	if _, err := s.Append([]jsonpatch.Operation{{"op": "replace", "path": "/seats", "value": "many"}}); !errors.Is(err, jsonpatch.ErrInvalidDocument) {
+		t.Fatalf("expected a document that does not decode to be invalid, got %v", err)
+	}
+	doc, rev := s.Head()
+	if rev != 1 || !reflect.DeepEqual(doc, map[string]any{"name": "acme", "seats": float64(3)}) {
+		t.Fatalf("rejected patches changed the store: %v at %d", doc, rev)
+	}
+
+	// A transaction is rolled back when any of its patches is invalid.
+	other := New(map[string]any{"n": float64(0)}, Options{})
+	var tx Tx
+	tx.Add(other, set("/n", 1))
+	tx.Add(s, set("/seats", 0))
+	if _, err := tx.Commit(); !errors.Is(err, jsonpatch.ErrInvalidDocument) {
+		t.Fatalf("expected the transaction to fail validation, got %v", err)
+	}
+	if _, rev := other.Head(); rev != 0 {
+		t.Fatalf("transaction partly committed: other store at %d", rev)
+	}
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// Tx is a set of patches to one or more stores that are appended all or
+// nothing, such as an edit to a user document together with the matching
+// change to an index document. The zero value is an empty transaction.
+type Tx struct {
+	patches []txPatch
+}
+
+type txPatch struct {
+	store *Store
+	patch []jsonpatch.Operation
+}
+
+// Add adds patch to the transaction, to be appended to s. Patches to the same
+// store are appended in the order they were added.
+func (tx *Tx) Add(s *Store, patch []jsonpatch.Operation) {
+	tx.patches = append(tx.patches, txPatch{store: s, patch: clonePatch(patch)})
+}
+
+// Commit appends the transaction's patches. It locks every store involved,
+// then applies each patch to a copy of its store's latest revision; only if
+// they all apply, and pass their store's Validate hook, are they logged. It
+// returns the revision each patch produced, in the order they were added. If
+// a patch fails, no store changes and the error names the failing patch.
+func (tx *Tx) Commit() ([]int64, error) {
+	stores := make([]*Store, 0, len(tx.patches))
+	for _, p := range tx.patches {
+		if !slices.Contains(stores, p.store) {
+			stores = append(stores, p.store)
+		}
+	}
+	// Stores are locked in a fixed order so that concurrent transactions
+	// cannot deadlock.
+	slices.SortFunc(stores, func(a, b *Store) int { return cmp.Compare(a.id, b.id) })
+	for _, s := range stores {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	heads := make(map[*Store]any, len(stores))
+	for _, s := range stores {
+		heads[s] = s.head
+	}
+	results := make([]any, len(tx.patches))
+	for i, p := range tx.patches {
+		head, err := jsonpatch.ApplyValueWithOptions(clone(heads[p.store]), clonePatch(p.patch), p.store.applyOptions())
+		if err != nil {
+			return nil, fmt.Errorf("patch %d: %w", i, err)
+		}
+		heads[p.store], results[i] = head, head
+	}
+
+	revs := make([]int64, len(tx.patches))
+	for i, p := range tx.patches {
+		p.store.commitLocked(p.patch, results[i])
+		revs[i] = p.store.rev
+	}
+	return revs, nil
+}
@@ -0,0 +1,83 @@
+package store
+
+import "fmt"
+
+// Replica is a copy of a document replaying a patch log, such as a Store, or
+// a client for a remote one.
+type Replica interface {
+	// Checkpoints returns the replica's checkpoints, ordered by Rev.
+	Checkpoints() []Checkpoint
+	// HashAt returns the content hash of the document as of rev.
+	HashAt(rev int64) (string, error)
+}
+
+// Divergence is the first revision at which two replicas hold different
+// documents, with each replica's hash there.
+type Divergence struct {
+	Rev          int64
+	Ours, Theirs string
+}
+
+// Checkpoints returns the retained checkpoints, oldest first.
+func (s *Store) Checkpoints() []Checkpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Checkpoint(nil), s.checkpoints...)
+}
+
+// HashAt returns the content hash of the document as of revision rev.
+func (s *Store) HashAt(rev int64) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, err := s.at(rev)
+	if err != nil {
+		return "", err
+	}
+	return Hash(doc)
+}
+
+// FindDivergence compares the checkpoints two replicas have in common and,
+// at the first one that differs, narrows the divergence down to the first
+// revision after the previous common checkpoint whose hashes differ. It
+// reports false when every common checkpoint matches; revisions after the
+// last one are not compared.
+func FindDivergence(ours, theirs Replica) (Divergence, bool, error) {
+	theirHashes := map[int64]string{}
+	for _, c := range theirs.Checkpoints() {
+		theirHashes[c.Rev] = c.Hash
+	}
+	var lastMatch int64 = -1
+	for _, c := range ours.Checkpoints() {
+		hash, ok := theirHashes[c.Rev]
+		if !ok {
+			continue
+		}
+		if hash == c.Hash {
+			lastMatch = c.Rev
+			continue
+		}
+		for rev := lastMatch + 1; rev <= c.Rev; rev++ {
+			a, err := ours.HashAt(rev)
+			if err != nil {
+				if lastMatch < 0 {
+					// Older revisions may be compacted away.
+					continue
+				}
+				return Divergence{}, false, fmt.Errorf("hash revision %d: %w", rev, err)
+			}
+			b, err := theirs.HashAt(rev)
+			if err != nil {
+				if lastMatch < 0 {
+					continue
+				}
+				return Divergence{}, false, fmt.Errorf("hash revision %d: %w", rev, err)
+			}
+			if a != b {
+				return Divergence{Rev: rev, Ours: a, Theirs: b}, true, nil
+			}
+		}
+		// The revisions in between could not all be compared.
+		return Divergence{Rev: c.Rev, Ours: c.Hash, Theirs: hash}, true, nil
+	}
+	return Divergence{}, false, nil
+}
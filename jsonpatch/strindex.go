@@ -0,0 +1,89 @@
+package jsonpatch
+
+import "unicode/utf8"
+
+// StringIndexing decides how the pos and len of str_ins and str_del count
+// characters. Options.StringIndexing sets it for one apply, so clients
+// that measure text differently, such as editors counting terminal cells,
+// can plug in their own.
+type StringIndexing interface {
+	// Len returns the length of s in the units positions count.
+	Len(s string) int
+	// Offset returns the byte offset in s of position pos. Positions are
+	// clamped to the range from 0 to Len(s), and a position inside a
+	// character, such as between the two halves of a surrogate pair, is
+	// rounded down to its start.
+	Offset(s string, pos int) int
+}
+
+var (
+	// UTF16Indexing counts UTF-16 code units, as JavaScript strings do. It
+	// is the default.
+	UTF16Indexing StringIndexing = utf16Indexing{}
+	// RuneIndexing counts Unicode code points.
+	RuneIndexing StringIndexing = runeIndexing{}
+	// ByteIndexing counts bytes of the UTF-8 encoding. Positions inside a
+	// multi-byte character are not rounded, so edits can split it.
+	ByteIndexing StringIndexing = byteIndexing{}
+)
+
+type utf16Indexing struct{}
+
+func (utf16Indexing) Len(s string) int { return utf16Length(s) }
+
+func (utf16Indexing) Offset(s string, pos int) int {
+	units := 0
+	for i, r := range s {
+		unit := 1
+		if r > 0xFFFF {
+			unit = 2
+		}
+		if units+unit > pos {
+			return i
+		}
+		units += unit
+	}
+	return len(s)
+}
+
+type runeIndexing struct{}
+
+func (runeIndexing) Len(s string) int { return utf8.RuneCountInString(s) }
+
+func (runeIndexing) Offset(s string, pos int) int {
+	n := 0
+	for i := range s {
+		if n >= pos {
+			return i
+		}
+		n++
+	}
+	return len(s)
+}
+
+type byteIndexing struct{}
+
+func (byteIndexing) Len(s string) int { return len(s) }
+
+func (byteIndexing) Offset(s string, pos int) int { return min(max(pos, 0), len(s)) }
+
+// indexing returns the StringIndexing set in the options, or the default.
+func (a *applier) indexing() StringIndexing {
+	if a.opts.StringIndexing != nil {
+		return a.opts.StringIndexing
+	}
+	return UTF16Indexing
+}
+
+// advanceRunes returns the byte offset count code points after offset in s,
+// and false if s ends before that.
+func advanceRunes(s string, offset, count int) (int, bool) {
+	for ; count > 0; count-- {
+		if offset >= len(s) {
+			return offset, false
+		}
+		_, size := utf8.DecodeRuneInString(s[offset:])
+		offset += size
+	}
+	return offset, true
+}
@@ -0,0 +1,66 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flitsinc/go-jsonpatch/internal/casegen"
+)
+
+// FuzzStructuredApply generates a (doc, patch) pair and then mutates the patch
+// at the op and field level with casegen.Mutate. Go's fuzzing engine has no
+// custom mutator hook, so the mutations are driven by the fuzz input itself:
+// byte-level changes select different structured mutations, which reaches
+// index, offset, and op-type edge cases much sooner than fuzzing raw JSON.
+//
+// It checks invariants that need no reference implementation: Apply never
+// panics, results are deterministic and serializable, and Trusted mode agrees
+// with validated mode on every patch that validation accepts.
+//
+//	go test -fuzz FuzzStructuredApply
+func FuzzStructuredApply(f *testing.F) {
+	f.Add([]byte("seed"))
+	f.Add([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+	f.Add([]byte("\x01\x02\x05text\x06\x02\x07\x02\x00\x02\x01"))
+	f.Add([]byte("\xff\x10\x80\x07str_ins\x03\x02\x01\x02\x02\x02"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		src := casegen.NewByteSource(data)
+		cfg := casegen.DefaultConfig
+		doc := cfg.Document(src)
+		ops := cfg.Mutate(src, doc, cfg.Patch(src, doc))
+
+		got, err := ApplyValue(cloneValue(doc), cloneOps(ops))
+		again, againErr := ApplyValue(cloneValue(doc), cloneOps(ops))
+		if (err == nil) != (againErr == nil) || canonicalJSON(got) != canonicalJSON(again) {
+			t.Fatalf("non-deterministic result\ndoc: %s\nops: %s\nfirst: %s (%v)\nsecond: %s (%v)",
+				canonicalJSON(doc), canonicalJSON(ops), canonicalJSON(got), err, canonicalJSON(again), againErr)
+		}
+		if err != nil {
+			return
+		}
+		if _, err := json.Marshal(got); err != nil {
+			t.Fatalf("result is not serializable: %v\ndoc: %s\nops: %s", err, canonicalJSON(doc), canonicalJSON(ops))
+		}
+
+		trusted, err := ApplyValueWithOptions(cloneValue(doc), cloneOps(ops), Options{Trusted: true})
+		if err != nil {
+			t.Fatalf("trusted apply failed where validated apply succeeded: %v\ndoc: %s\nops: %s",
+				err, canonicalJSON(doc), canonicalJSON(ops))
+		}
+		if canonicalJSON(trusted) != canonicalJSON(got) {
+			t.Fatalf("trusted result differs\ndoc: %s\nops: %s\nvalidated: %s\ntrusted: %s",
+				canonicalJSON(doc), canonicalJSON(ops), canonicalJSON(got), canonicalJSON(trusted))
+		}
+	})
+}
+
+// cloneOps copies ops deeply, since values inserted by one apply may be
+// modified by later ops of the same patch.
+func cloneOps(ops []map[string]any) []map[string]any {
+	out := make([]map[string]any, len(ops))
+	for i, op := range ops {
+		out[i] = cloneMap(op)
+	}
+	return out
+}
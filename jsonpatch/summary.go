@@ -0,0 +1,116 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxSummaryExamples is the number of changes kept per group as
+// representative values.
+const maxSummaryExamples = 3
+
+// Summary groups the changes of an ApplyReport by the top-level key they
+// are under, for notifications such as "3 fields changed in settings, 2
+// items added to tags".
+type Summary struct {
+	// Groups are in the order their first change was made.
+	Groups []SummaryGroup
+}
+
+// SummaryGroup counts the changes under one top-level key. Changes to
+// object members, including the key itself, count as fields and changes to
+// array elements as items.
+type SummaryGroup struct {
+	// Key is the top-level key, or "" for changes to the whole document.
+	Key string
+
+	FieldsAdded, FieldsRemoved, FieldsChanged int
+	ItemsAdded, ItemsRemoved, ItemsChanged    int
+
+	// Examples are the first few changes of the group, with their values.
+	Examples []Change
+}
+
+// Summarize groups the changes in report by top-level key.
+func Summarize(report ApplyReport) Summary {
+	var summary Summary
+	groups := map[string]int{}
+	for _, c := range report.Changes {
+		key := topLevelKey(c.Path)
+		i, ok := groups[key]
+		if !ok {
+			i = len(summary.Groups)
+			groups[key] = i
+			summary.Groups = append(summary.Groups, SummaryGroup{Key: key})
+		}
+		g := &summary.Groups[i]
+		var count *int
+		switch {
+		case c.Element && c.Kind == ChangeAdded:
+			count = &g.ItemsAdded
+		case c.Element && c.Kind == ChangeRemoved:
+			count = &g.ItemsRemoved
+		case c.Element:
+			count = &g.ItemsChanged
+		case c.Kind == ChangeAdded:
+			count = &g.FieldsAdded
+		case c.Kind == ChangeRemoved:
+			count = &g.FieldsRemoved
+		default:
+			count = &g.FieldsChanged
+		}
+		*count++
+		if len(g.Examples) < maxSummaryExamples {
+			g.Examples = append(g.Examples, c)
+		}
+	}
+	return summary
+}
+
+// topLevelKey returns the unescaped first segment of pathRaw.
+func topLevelKey(pathRaw string) string {
+	if pathRaw == "" {
+		return ""
+	}
+	segment, _, _ := strings.Cut(strings.TrimPrefix(pathRaw, "/"), "/")
+	if decoded, err := decodePointerSegment(segment); err == nil {
+		return decoded
+	}
+	return segment
+}
+
+// String describes the summary in a sentence fragment, such as "3 fields
+// changed in settings, 2 items added to tags".
+func (s Summary) String() string {
+	var parts []string
+	for _, g := range s.Groups {
+		if g.Key == "" {
+			parts = append(parts, "document replaced")
+			continue
+		}
+		for _, count := range []struct {
+			n            int
+			noun, action string
+		}{
+			{g.FieldsChanged, "field", "changed in"},
+			{g.FieldsAdded, "field", "added to"},
+			{g.FieldsRemoved, "field", "removed from"},
+			{g.ItemsChanged, "item", "changed in"},
+			{g.ItemsAdded, "item", "added to"},
+			{g.ItemsRemoved, "item", "removed from"},
+		} {
+			if count.n == 0 {
+				continue
+			}
+			noun := count.noun
+			if count.n != 1 {
+				noun += "s"
+			}
+			parts = append(parts, fmt.Sprintf("%d %s %s %s", count.n, noun, count.action, g.Key))
+		}
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,107 @@
+package syncclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/collab"
+)
+
+// ErrClosed is returned by the connections of a HubTransport once they are
+// closed.
+var ErrClosed = errors.New("connection closed")
+
+// HubTransport connects clients to a collab.Hub in the same process, such as
+// a service following documents it also serves, or a test. It is also the
+// reference for what a network transport does at the server end: connect
+// through Hub.Connect, submit updates through Hub.Submit, and acknowledge
+// the commits the client received.
+type HubTransport struct {
+	Hub *collab.Hub
+}
+
+// Dial connects clientID to the hub, resuming after version.
+func (t HubTransport) Dial(ctx context.Context, clientID string, version int64) (Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	conn := &hubConn{hub: t.Hub, clientID: clientID}
+	conn.ready = sync.NewCond(&conn.mu)
+	if err := t.Hub.Connect(clientID, version, conn.deliver); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+type hubConn struct {
+	hub      *collab.Hub
+	clientID string
+
+	mu     sync.Mutex
+	ready  *sync.Cond // signaled when queue grows or closed is set
+	queue  []Message
+	closed bool
+}
+
+func (c *hubConn) deliver(commit collab.Commit) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	c.queue = append(c.queue, Message{Commit: &commit})
+	c.ready.Signal()
+	return nil
+}
+
+func (c *hubConn) Send(u collab.Update) error {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	_, err := c.hub.Submit(u)
+	switch {
+	case err == nil, errors.Is(err, collab.ErrStaleUpdate):
+		// Stale updates are retries of updates committed since.
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queue = append(c.queue, Message{Rejected: u.ID})
+	c.ready.Signal()
+	return nil
+}
+
+func (c *hubConn) Receive() (Message, error) {
+	c.mu.Lock()
+	for len(c.queue) == 0 && !c.closed {
+		c.ready.Wait()
+	}
+	if c.closed {
+		c.mu.Unlock()
+		return Message{}, ErrClosed
+	}
+	m := c.queue[0]
+	c.queue = c.queue[1:]
+	c.mu.Unlock()
+	if m.Commit != nil {
+		c.hub.Ack(c.clientID, m.Commit.Seq)
+	}
+	return m, nil
+}
+
+func (c *hubConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.ready.Broadcast()
+	c.mu.Unlock()
+	c.hub.Disconnect(c.clientID)
+	return nil
+}
@@ -0,0 +1,222 @@
+// Package syncclient keeps a local mirror of a document served by a
+// collab.Hub, for Go services that follow documents the way browser clients
+// do.
+//
+// A Client wraps a collab.Session and a pluggable Transport. Run connects,
+// resumes from the last version received, and reconnects with exponential
+// backoff whenever the connection fails; local patches made meanwhile are
+// queued and resubmitted. The package does no networking itself: a
+// Transport for WebSocket, gRPC or any other protocol only has to move
+// Updates to the server and Messages back.
+package syncclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/collab"
+)
+
+// Message is sent from the server to a client: a commit to apply, or the ID
+// of one of the client's updates that the server rejected.
+type Message struct {
+	Commit   *collab.Commit `json:"commit,omitempty"`
+	Rejected uint64         `json:"rejected,omitempty"`
+}
+
+// Conn is a connection to the server. Send and Receive are called from
+// different goroutines, and Close may be called at any time to make a
+// pending Receive return.
+type Conn interface {
+	// Send delivers an update to the server. An error means the connection
+	// is gone.
+	Send(collab.Update) error
+	// Receive blocks until the server sends a message. An error means the
+	// connection is gone.
+	Receive() (Message, error)
+	Close() error
+}
+
+// Transport opens connections to the server. The server sends the commits
+// after version first, then every new commit.
+type Transport interface {
+	Dial(ctx context.Context, clientID string, version int64) (Conn, error)
+}
+
+// Backoff is the delay between reconnection attempts, which starts at
+// Initial and is multiplied by Multiplier after every failed attempt, up to
+// Max. It is reset once a connection succeeds. Zero fields take the values
+// of DefaultBackoff.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+// DefaultBackoff is used for the zero fields of Options.Backoff.
+var DefaultBackoff = Backoff{Initial: 100 * time.Millisecond, Max: 30 * time.Second, Multiplier: 2}
+
+// Options configures a Client. The zero value is usable.
+type Options struct {
+	Backoff Backoff
+	// OnChange, if set, is called with a copy of the document and its
+	// version after every commit received.
+	OnChange func(doc any, version int64)
+	// OnError, if set, is called with the error that ended each connection
+	// attempt, and with the IDs of rejected updates wrapped in ErrRejected.
+	OnError func(error)
+}
+
+// ErrRejected is reported to Options.OnError for an update the server
+// rejected. The local patches in it, and those made after it, are discarded.
+var ErrRejected = errors.New("update rejected")
+
+// Client mirrors a document from the server and submits local patches to
+// it. It is safe for concurrent use.
+type Client struct {
+	clientID  string
+	session   *collab.Session
+	transport Transport
+	opts      Options
+
+	mu   sync.Mutex
+	conn Conn // nil while disconnected
+}
+
+// New returns a client for clientID that starts from doc at version, such as
+// a snapshot fetched from the server, or version 0 and the initial document.
+func New(clientID string, doc any, version int64, transport Transport, opts Options) *Client {
+	if opts.Backoff.Initial <= 0 {
+		opts.Backoff.Initial = DefaultBackoff.Initial
+	}
+	if opts.Backoff.Max <= 0 {
+		opts.Backoff.Max = DefaultBackoff.Max
+	}
+	if opts.Backoff.Multiplier < 1 {
+		opts.Backoff.Multiplier = DefaultBackoff.Multiplier
+	}
+	c := &Client{clientID: clientID, transport: transport, opts: opts}
+	c.session = collab.NewSession(clientID, doc, version, c.send)
+	// The session sends nothing until Run connects.
+	c.session.Disconnect()
+	return c
+}
+
+// Document returns a copy of the local document, with local patches that
+// the server has not acknowledged yet applied.
+func (c *Client) Document() any {
+	return c.session.Document()
+}
+
+// Version returns the version of the last commit received.
+func (c *Client) Version() int64 {
+	return c.session.Version()
+}
+
+// Pending reports whether local patches are waiting for acknowledgement.
+func (c *Client) Pending() bool {
+	return c.session.Pending()
+}
+
+// Apply applies patch to the local document and submits it, or queues it
+// until the client is connected. It fails only if patch does not apply.
+func (c *Client) Apply(patch []jsonpatch.Operation) error {
+	return c.session.Apply(patch)
+}
+
+// Run connects to the server and keeps the document in sync until ctx is
+// done, reconnecting after failures. It returns the context's error.
+func (c *Client) Run(ctx context.Context) error {
+	delay := c.opts.Backoff.Initial
+	for {
+		conn, err := c.transport.Dial(ctx, c.clientID, c.session.Version())
+		if err == nil {
+			delay = c.opts.Backoff.Initial
+			err = c.serve(ctx, conn)
+		} else {
+			err = fmt.Errorf("dial: %w", err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.report(err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay = min(time.Duration(float64(delay)*c.opts.Backoff.Multiplier), c.opts.Backoff.Max)
+	}
+}
+
+// serve handles one connection until it fails.
+func (c *Client) serve(ctx context.Context, conn Conn) error {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		c.session.Disconnect()
+		conn.Close()
+	}()
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	// The connection delivers the missed commits itself, so there is
+	// nothing to fetch; the queued patches are resubmitted right away.
+	noCommits := func(int64) ([]collab.Commit, error) { return nil, nil }
+	if err := c.session.Reconnect(noCommits); err != nil {
+		return err
+	}
+
+	for {
+		m, err := conn.Receive()
+		if err != nil {
+			return err
+		}
+		if m.Rejected != 0 {
+			c.session.Reject(m.Rejected)
+			c.report(fmt.Errorf("%w: update %d", ErrRejected, m.Rejected))
+		}
+		if m.Commit == nil {
+			continue
+		}
+		// A commit that does not follow the last one received ends the
+		// connection; the next one resumes from the last version.
+		if err := c.session.Receive(*m.Commit); err != nil {
+			return err
+		}
+		if c.opts.OnChange != nil {
+			c.opts.OnChange(c.session.Document(), c.session.Version())
+		}
+	}
+}
+
+// send is the session's send function. Failing connections are closed, so
+// that Run reconnects, and the update is resent then.
+func (c *Client) send(u collab.Update) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		if err := conn.Send(u); err != nil {
+			conn.Close()
+		}
+	}
+	return nil
+}
+
+func (c *Client) report(err error) {
+	if c.opts.OnError != nil {
+		c.opts.OnError(err)
+	}
+}
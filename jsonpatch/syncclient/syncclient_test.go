@@ -0,0 +1,151 @@
+package syncclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/collab"
+)
+
+// flakyTransport fails every other dial and lets each connection carry a
+// few messages before dropping it.
+type flakyTransport struct {
+	HubTransport
+	dials atomic.Int64
+}
+
+func (t *flakyTransport) Dial(ctx context.Context, clientID string, version int64) (Conn, error) {
+	if t.dials.Add(1)%2 == 0 {
+		return nil, errors.New("connection refused")
+	}
+	conn, err := t.HubTransport.Dial(ctx, clientID, version)
+	if err != nil {
+		return nil, err
+	}
+	return &flakyConn{Conn: conn, left: 3}, nil
+}
+
+type flakyConn struct {
+	Conn
+	left int // Receive is only called by the client's Run goroutine
+}
+
+func (c *flakyConn) Receive() (Message, error) {
+	if c.left--; c.left < 0 {
+		c.Close()
+		return Message{}, errors.New("connection reset")
+	}
+	return c.Conn.Receive()
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClientsConvergeOverFlakyTransport(t *testing.T) {
+	doc := map[string]any{"items": []any{}}
+	server := collab.NewServer(doc)
+	transport := &flakyTransport{HubTransport: HubTransport{Hub: collab.NewHub(server)}}
+	opts := Options{Backoff: Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	clients := make([]*Client, 3)
+	for i := range clients {
+		clients[i] = New(fmt.Sprintf("client-%d", i), doc, 0, transport, opts)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := clients[i].Run(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("Run returned %v", err)
+			}
+		}()
+	}
+
+	for round := range 10 {
+		for i, c := range clients {
+			// Concrete indices, since concurrent appends with "-" are not
+			// ordered by the transform.
+			patch := []jsonpatch.Operation{{"op": "add", "path": "/items/0", "value": fmt.Sprintf("%d-%d", i, round)}}
+			if err := c.Apply(patch); err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	waitFor(t, "convergence", func() bool {
+		expected, version := server.Snapshot()
+		for _, c := range clients {
+			if c.Pending() || c.Version() != version || !reflect.DeepEqual(c.Document(), expected) {
+				return false
+			}
+		}
+		return true
+	})
+	final, _ := server.Snapshot()
+	if items := final.(map[string]any)["items"].([]any); len(items) != 30 {
+		t.Fatalf("expected every patch to be committed once, got %d items", len(items))
+	}
+	cancel()
+	wg.Wait()
+}
+
+func TestClientRejectedUpdate(t *testing.T) {
+	server := collab.NewServer(map[string]any{"n": float64(0)})
+	var rejected atomic.Bool
+	var changes atomic.Int64
+	c := New("a", map[string]any{"n": float64(0)}, 0, HubTransport{Hub: collab.NewHub(server)}, Options{
+		OnChange: func(any, int64) { changes.Add(1) },
+		OnError: func(err error) {
+			if errors.Is(err, ErrRejected) {
+				rejected.Store(true)
+			}
+		},
+	})
+
+	// Patches made before connecting are queued.
+	if err := c.Apply([]jsonpatch.Operation{{"op": "replace", "path": "/n", "value": float64(1)}}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+	waitFor(t, "the queued patch", func() bool { return !c.Pending() && c.Version() == 1 })
+	if changes.Load() != 1 {
+		t.Fatalf("expected one change notification, got %d", changes.Load())
+	}
+
+	// Another writer changes /n behind the hub's back, so a test against the
+	// old value fails on the server.
+	if _, err := server.Submit(collab.Update{ClientID: "b", ID: 1, Base: 1, Patch: []jsonpatch.Operation{{"op": "replace", "path": "/n", "value": float64(5)}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Apply([]jsonpatch.Operation{{"op": "test", "path": "/n", "value": float64(1)}}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the rejection", func() bool { return rejected.Load() && !c.Pending() })
+	if doc := c.Document(); !reflect.DeepEqual(doc, map[string]any{"n": float64(1)}) {
+		t.Fatalf("expected the confirmed document, got %v", doc)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
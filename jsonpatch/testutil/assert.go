@@ -0,0 +1,70 @@
+package testutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// AssertPatched applies patch to a copy of before and reports a test error
+// listing every pointer-level difference if the result is not after. before is
+// left unmodified. It returns whether the assertion held.
+func AssertPatched(t testing.TB, before any, patch []map[string]any, after any) bool {
+	t.Helper()
+	got, err := jsonpatch.ApplyValue(clone(before), patch)
+	if err != nil {
+		t.Errorf("patch failed to apply: %v\npatch: %s", err, encode(patch))
+		return false
+	}
+	if diff := Diff(got, after); len(diff) > 0 {
+		t.Errorf("patched document differs from expected:\n  %s", strings.Join(diff, "\n  "))
+		return false
+	}
+	return true
+}
+
+// AssertPatchEquivalent applies a and b to separate copies of doc and reports a
+// test error if the results differ. Two patches that both fail to apply are
+// considered equivalent; one failing while the other applies is not. doc is
+// left unmodified. It returns whether the assertion held.
+func AssertPatchEquivalent(t testing.TB, a, b []map[string]any, doc any) bool {
+	t.Helper()
+	gotA, errA := jsonpatch.ApplyValue(clone(doc), a)
+	gotB, errB := jsonpatch.ApplyValue(clone(doc), b)
+	switch {
+	case errA != nil && errB != nil:
+		return true
+	case errA != nil:
+		t.Errorf("first patch failed to apply but the second applied: %v", errA)
+		return false
+	case errB != nil:
+		t.Errorf("second patch failed to apply but the first applied: %v", errB)
+		return false
+	}
+	if diff := Diff(gotA, gotB); len(diff) > 0 {
+		t.Errorf("patches produce different documents (got is the first patch, want the second):\n  %s", strings.Join(diff, "\n  "))
+		return false
+	}
+	return true
+}
+
+// clone deep-copies a JSON value so helpers never modify their inputs.
+func clone(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, child := range val {
+			out[k] = clone(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, child := range val {
+			out[i] = clone(child)
+		}
+		return out
+	default:
+		return val
+	}
+}
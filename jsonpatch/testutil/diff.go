@@ -0,0 +1,106 @@
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Diff compares two JSON documents and describes every difference as a line
+// prefixed with the JSON Pointer where it occurs. Numbers are compared by
+// value, so an int and a float64 holding the same number are equal. An empty
+// result means the documents are equal.
+func Diff(got, want any) []string {
+	var lines []string
+	diffValues("", normalize(got), normalize(want), &lines)
+	return lines
+}
+
+func diffValues(path string, got, want any, lines *[]string) {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(g)+len(w))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		for k := range g {
+			if _, exists := w[k]; !exists {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			child := path + "/" + escape(k)
+			gv, gok := g[k]
+			wv, wok := w[k]
+			switch {
+			case !gok:
+				*lines = append(*lines, fmt.Sprintf("%s: missing, want %s", display(child), encode(wv)))
+			case !wok:
+				*lines = append(*lines, fmt.Sprintf("%s: unexpected %s", display(child), encode(gv)))
+			default:
+				diffValues(child, gv, wv, lines)
+			}
+		}
+		return
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			break
+		}
+		for i := 0; i < max(len(g), len(w)); i++ {
+			child := path + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(g):
+				*lines = append(*lines, fmt.Sprintf("%s: missing, want %s", display(child), encode(w[i])))
+			case i >= len(w):
+				*lines = append(*lines, fmt.Sprintf("%s: unexpected %s", display(child), encode(g[i])))
+			default:
+				diffValues(child, g[i], w[i], lines)
+			}
+		}
+		return
+	}
+	if encode(got) != encode(want) {
+		*lines = append(*lines, fmt.Sprintf("%s: got %s, want %s", display(path), encode(got), encode(want)))
+	}
+}
+
+// normalize round-trips v through encoding/json so that only JSON-visible
+// differences remain.
+func normalize(v any) any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func encode(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+func display(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+func escape(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,85 @@
+// Package testutil provides helpers for testing code that produces or applies
+// JSON Patches.
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/corpus"
+)
+
+// Update makes RunGolden rewrite expected.json files with the actual results
+// instead of comparing against them. Enable it with "go test -update".
+var Update = flag.Bool("update", false, "rewrite golden expected.json files with actual results")
+
+// ApplyFunc applies ops to doc and returns the patched document.
+type ApplyFunc func(doc any, ops []map[string]any) (any, error)
+
+// RunGolden loads the corpus below dir (see package corpus for the layout) and
+// runs each case as a subtest named after its directory. A nil apply uses
+// jsonpatch.ApplyValue. Mismatches are reported as pointer-level differences;
+// with -update the expected.json of every case that applies is rewritten
+// instead. Cases disabled in their meta.json are skipped.
+func RunGolden(t *testing.T, dir string, apply ApplyFunc) {
+	t.Helper()
+	if apply == nil {
+		apply = jsonpatch.ApplyValue
+	}
+	cases, err := corpus.Load(dir)
+	if err != nil {
+		t.Fatalf("load golden cases: %v", err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("no golden cases found in %q", dir)
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if c.Meta.Disabled {
+				t.Skip("disabled in meta.json")
+			}
+			got, err := apply(c.Original, c.Patch)
+			if c.Error != "" {
+				if err == nil {
+					t.Fatalf("expected error containing %q, but the patch applied:\n%s", c.Error, indent(got))
+				}
+				if !strings.Contains(err.Error(), c.Error) {
+					t.Fatalf("expected error containing %q, got %q", c.Error, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply failed: %v", err)
+			}
+			expectedPath := filepath.Join(dir, c.Name, corpus.ExpectedFile)
+			if *Update {
+				if err := corpus.WriteJSON(expectedPath, got); err != nil {
+					t.Fatalf("update golden: %v", err)
+				}
+				return
+			}
+			if !c.HasExpected {
+				t.Fatalf("case has neither %s nor %s; run with -update to create it", corpus.ExpectedFile, corpus.ErrorFile)
+			}
+			if diff := Diff(got, c.Expected); len(diff) > 0 {
+				t.Fatalf("result differs from %s:\n  %s", expectedPath, strings.Join(diff, "\n  "))
+			}
+		})
+	}
+}
+
+func indent(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprintf("%v\n", v)
+	}
+	return buf.String()
+}
@@ -0,0 +1,130 @@
+package testutil
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunGolden(t *testing.T) {
+	RunGolden(t, "testdata/golden", nil)
+}
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		got      any
+		want     any
+		expected []string
+	}{
+		{
+			name:     "equal with mixed number types",
+			got:      map[string]any{"n": 1, "list": []any{int64(2)}},
+			want:     map[string]any{"n": 1.0, "list": []any{2.0}},
+			expected: nil,
+		},
+		{
+			name: "changed, missing, and unexpected keys",
+			got:  map[string]any{"a": 1, "extra": true, "a/b": "x"},
+			want: map[string]any{"a": 2, "missing": nil, "a/b": "y"},
+			expected: []string{
+				`/a: got 1, want 2`,
+				`/a~1b: got "x", want "y"`,
+				`/extra: unexpected true`,
+				`/missing: missing, want null`,
+			},
+		},
+		{
+			name:     "array length mismatch",
+			got:      []any{1},
+			want:     []any{1, "two"},
+			expected: []string{`/1: missing, want "two"`},
+		},
+		{
+			name:     "type mismatch at root",
+			got:      "text",
+			want:     map[string]any{},
+			expected: []string{`(root): got "text", want {}`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Diff(tc.got, tc.want); !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("Diff mismatch.\nGot:      %q\nExpected: %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+// recorder captures assertion failures instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertPatched(t *testing.T) {
+	before := map[string]any{"a": 1, "list": []any{"x"}}
+	patch := []map[string]any{
+		{"op": "replace", "path": "/a", "value": 2},
+		{"op": "add", "path": "/list/-", "value": "y"},
+	}
+
+	if !AssertPatched(t, before, patch, map[string]any{"a": 2, "list": []any{"x", "y"}}) {
+		t.Fatal("expected assertion to hold")
+	}
+	if !reflect.DeepEqual(before, map[string]any{"a": 1, "list": []any{"x"}}) {
+		t.Fatalf("AssertPatched modified its input: %v", before)
+	}
+
+	r := &recorder{TB: t}
+	if AssertPatched(r, before, patch, map[string]any{"a": 3, "list": []any{"x"}}) {
+		t.Fatal("expected assertion to fail")
+	}
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "/a: got 2, want 3") || !strings.Contains(r.errors[0], `/list/1: unexpected "y"`) {
+		t.Fatalf("unexpected failure message: %q", r.errors)
+	}
+
+	r = &recorder{TB: t}
+	AssertPatched(r, before, []map[string]any{{"op": "remove", "path": "/missing"}}, before)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "patch failed to apply") {
+		t.Fatalf("unexpected failure message: %q", r.errors)
+	}
+}
+
+func TestAssertPatchEquivalent(t *testing.T) {
+	doc := map[string]any{"a": 1, "b": 2}
+	moveOp := []map[string]any{{"op": "move", "from": "/a", "path": "/c"}}
+	copyRemove := []map[string]any{
+		{"op": "copy", "from": "/a", "path": "/c"},
+		{"op": "remove", "path": "/a"},
+	}
+
+	if !AssertPatchEquivalent(t, moveOp, copyRemove, doc) {
+		t.Fatal("expected move and copy+remove to be equivalent")
+	}
+	if !reflect.DeepEqual(doc, map[string]any{"a": 1, "b": 2}) {
+		t.Fatalf("AssertPatchEquivalent modified its input: %v", doc)
+	}
+
+	r := &recorder{TB: t}
+	if AssertPatchEquivalent(r, moveOp, []map[string]any{{"op": "remove", "path": "/a"}}, doc) {
+		t.Fatal("expected assertion to fail")
+	}
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "/c: unexpected 1") {
+		t.Fatalf("unexpected failure message: %q", r.errors)
+	}
+
+	r = &recorder{TB: t}
+	AssertPatchEquivalent(r, moveOp, []map[string]any{{"op": "remove", "path": "/missing"}}, doc)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "second patch failed") {
+		t.Fatalf("unexpected failure message: %q", r.errors)
+	}
+}
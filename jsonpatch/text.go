@@ -0,0 +1,390 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ApplyText applies operations to a JSON document given as text and returns
+// the patched text. Only the spans the operations edit are rewritten: the
+// whitespace, key order and number formatting everywhere else are kept, so
+// patching a hand-maintained config file leaves a minimal diff.
+//
+// Operations behave as with ApplyValue. Values they write are formatted
+// like encoding/json does, indented to match the surrounding lines when the
+// document is indented. New object members are added after the last one,
+// with the same separators as their siblings.
+func ApplyText(src []byte, operations []map[string]any) ([]byte, error) {
+	var doc any
+	if err := json.Unmarshal(src, &doc); err != nil {
+		return nil, err
+	}
+	text := append([]byte(nil), src...)
+	indentUnit := detectIndent(src)
+	for i, op := range operations {
+		root, err := parseText(text)
+		if err != nil {
+			return nil, err
+		}
+		// The tree resolves paths against the document before the op.
+		edit := planTextEdit(root, op)
+		if doc, err = ApplyValue(doc, []map[string]any{op}); err != nil {
+			var opErr *OpError
+			if errors.As(err, &opErr) {
+				err = opErr.Err
+			}
+			return nil, newOpError(i, op, err)
+		}
+		if text, err = edit(text, doc, indentUnit); err != nil {
+			return nil, newOpError(i, op, err)
+		}
+	}
+	return text, nil
+}
+
+// textEdit rewrites text once the op it was planned for has been applied to
+// doc, which holds the values to write.
+type textEdit func(text []byte, doc any, indentUnit string) ([]byte, error)
+
+// planTextEdit decides how op changes the text of the document root. Ops
+// that Apply would reject get an edit that is never run.
+func planTextEdit(root *textNode, op map[string]any) textEdit {
+	pathRaw, _ := op["path"].(string)
+	none := func(text []byte, _ any, _ string) ([]byte, error) { return text, nil }
+	switch op["op"] {
+	case "add", "copy":
+		return planInsert(root, pathRaw)
+	case "move":
+		fromRaw, _ := op["from"].(string)
+		if fromRaw == pathRaw {
+			return none
+		}
+		return func(text []byte, doc any, indentUnit string) ([]byte, error) {
+			text, err := planRemove(root, fromRaw)(text, doc, indentUnit)
+			if err != nil {
+				return nil, err
+			}
+			// The target is resolved after the removal, as move does.
+			root, err := parseText(text)
+			if err != nil {
+				return nil, err
+			}
+			return planInsert(root, pathRaw)(text, doc, indentUnit)
+		}
+	case "remove":
+		return planRemove(root, pathRaw)
+	case "replace", "inc", "str_ins", "str_del", "extend":
+		return func(text []byte, doc any, indentUnit string) ([]byte, error) {
+			node, _, _ := root.find(pathRaw)
+			if node == nil {
+				return nil, errorf(ErrPathNotFound, "path %q not found in text", pathRaw)
+			}
+			return replaceValue(text, node, doc, pathRaw, indentUnit)
+		}
+	}
+	return none
+}
+
+// planInsert writes the value at pathRaw, inserting it into an array or
+// object, or replacing an existing member.
+func planInsert(root *textNode, pathRaw string) textEdit {
+	return func(text []byte, doc any, indentUnit string) ([]byte, error) {
+		node, parent, segment := root.find(pathRaw)
+		if pathRaw == "" || (node != nil && parent.object) {
+			return replaceValue(text, node, doc, pathRaw, indentUnit)
+		}
+		if parent == nil {
+			return nil, errorf(ErrPathNotFound, "path %q not found in text", pathRaw)
+		}
+		index := len(parent.children)
+		if parent.array && segment != "-" {
+			index, _ = strconv.Atoi(segment)
+		}
+		concrete := pathRaw
+		if parent.array {
+			concrete = pathRaw[:strings.LastIndexByte(pathRaw, '/')+1] + strconv.Itoa(index)
+		}
+		value, err := (&applier{root: doc}).valueAt(concrete)
+		if err != nil {
+			return nil, err
+		}
+		return parent.insert(text, index, segment, value, indentUnit)
+	}
+}
+
+func planRemove(root *textNode, pathRaw string) textEdit {
+	return func(text []byte, _ any, _ string) ([]byte, error) {
+		node, parent, _ := root.find(pathRaw)
+		if node == nil {
+			return nil, errorf(ErrPathNotFound, "path %q not found in text", pathRaw)
+		}
+		if parent == nil {
+			// Removing the root leaves null, as ApplyValue returns nil.
+			return splice(text, node.start, node.end, []byte("null")), nil
+		}
+		return parent.remove(text, node), nil
+	}
+}
+
+func replaceValue(text []byte, node *textNode, doc any, pathRaw, indentUnit string) ([]byte, error) {
+	value, err := (&applier{root: doc}).valueAt(pathRaw)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := renderValue(value, lineIndent(text, node.start), indentUnit)
+	if err != nil {
+		return nil, err
+	}
+	return splice(text, node.start, node.end, rendered), nil
+}
+
+// textNode is the span of a value in the document text.
+type textNode struct {
+	start, end    int
+	object, array bool
+	children      []*textNode
+	// For objects, the member names and the spans of their quoted keys.
+	keys               []string
+	keyStarts, keyEnds []int
+}
+
+// find returns the node at pathRaw, its parent, and the last segment of the
+// path. node is nil when the parent exists but the child does not.
+func (n *textNode) find(pathRaw string) (node, parent *textNode, segment string) {
+	segments, err := splitPointer(pathRaw)
+	if err != nil {
+		return nil, nil, ""
+	}
+	node = n
+	for i, s := range segments {
+		parent, node, segment = node, node.child(s), s
+		if node == nil {
+			if i < len(segments)-1 {
+				return nil, nil, ""
+			}
+			break
+		}
+	}
+	return node, parent, segment
+}
+
+func (n *textNode) child(segment string) *textNode {
+	if n.object {
+		for i := len(n.keys) - 1; i >= 0; i-- {
+			// The last duplicate wins, as with encoding/json.
+			if n.keys[i] == segment {
+				return n.children[i]
+			}
+		}
+	} else if n.array {
+		if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(n.children) {
+			return n.children[i]
+		}
+	}
+	return nil
+}
+
+// childStart returns where child i starts, including its key.
+func (n *textNode) childStart(i int) int {
+	if n.object {
+		return n.keyStarts[i]
+	}
+	return n.children[i].start
+}
+
+// separator returns the text between two children, copied from the
+// existing ones.
+func (n *textNode) separator(text []byte) string {
+	if len(n.children) >= 2 {
+		return string(text[n.children[0].end:n.childStart(1)])
+	}
+	return "," + string(text[n.start+1:n.childStart(0)])
+}
+
+func (n *textNode) insert(text []byte, index int, key string, value any, indentUnit string) ([]byte, error) {
+	var at int
+	var indent string
+	if len(n.children) > 0 {
+		i := min(index, len(n.children)-1)
+		at, indent = n.childStart(i), lineIndent(text, n.childStart(i))
+	} else {
+		at, indent = n.start+1, lineIndent(text, n.start)+indentUnit
+	}
+	rendered, err := renderValue(value, indent, indentUnit)
+	if err != nil {
+		return nil, err
+	}
+	if n.object {
+		colon := ": "
+		if len(n.children) > 0 {
+			colon = string(text[n.keyEnds[0]:n.children[0].start])
+		} else if indentUnit == "" {
+			colon = ":"
+		}
+		quoted, _ := marshalNoEscape(key)
+		rendered = append(append(quoted, colon...), rendered...)
+	}
+	switch {
+	case len(n.children) == 0:
+		if indentUnit != "" {
+			rendered = append(append([]byte("\n"+indent), rendered...), "\n"+lineIndent(text, n.start)...)
+		}
+		return splice(text, at, n.end-1, rendered), nil
+	case index < len(n.children):
+		return splice(text, at, at, append(rendered, n.separator(text)...)), nil
+	default:
+		end := n.children[len(n.children)-1].end
+		return splice(text, end, end, append([]byte(n.separator(text)), rendered...)), nil
+	}
+}
+
+func (n *textNode) remove(text []byte, child *textNode) []byte {
+	i := 0
+	for n.children[i] != child {
+		i++
+	}
+	switch {
+	case len(n.children) == 1:
+		return splice(text, n.start+1, n.end-1, nil)
+	case i < len(n.children)-1:
+		return splice(text, n.childStart(i), n.childStart(i+1), nil)
+	default:
+		return splice(text, n.children[i-1].end, child.end, nil)
+	}
+}
+
+func splice(text []byte, start, end int, insert []byte) []byte {
+	out := make([]byte, 0, len(text)-(end-start)+len(insert))
+	out = append(out, text[:start]...)
+	out = append(out, insert...)
+	return append(out, text[end:]...)
+}
+
+// lineIndent returns the whitespace at the start of the line holding pos.
+func lineIndent(text []byte, pos int) string {
+	start := bytes.LastIndexByte(text[:pos], '\n') + 1
+	end := start
+	for end < len(text) && (text[end] == ' ' || text[end] == '\t') {
+		end++
+	}
+	return string(text[start:end])
+}
+
+// detectIndent returns the indentation of the first indented line, taken
+// as one level, or "" for documents on a single line.
+func detectIndent(src []byte) string {
+	for i := bytes.IndexByte(src, '\n'); i >= 0 && i+1 < len(src); {
+		if indent := lineIndent(src, i+1); indent != "" {
+			return indent
+		}
+		next := bytes.IndexByte(src[i+1:], '\n')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return ""
+}
+
+// renderValue formats value for insertion at a line indented by indent.
+func renderValue(value any, indent, indentUnit string) ([]byte, error) {
+	out, err := marshalNoEscape(value)
+	if err != nil || indentUnit == "" {
+		return out, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, out, indent, indentUnit); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func marshalNoEscape(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// parseText returns the span tree of a valid JSON text.
+func parseText(text []byte) (*textNode, error) {
+	if !json.Valid(text) {
+		return nil, errors.New("invalid JSON document")
+	}
+	p := &textParser{text: text}
+	p.skipSpace()
+	return p.value()
+}
+
+type textParser struct {
+	text []byte
+	pos  int
+}
+
+func (p *textParser) skipSpace() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *textParser) value() (*textNode, error) {
+	n := &textNode{start: p.pos}
+	switch p.text[p.pos] {
+	case '{', '[':
+		n.object, n.array = p.text[p.pos] == '{', p.text[p.pos] == '['
+		p.pos++
+		p.skipSpace()
+		for p.text[p.pos] != '}' && p.text[p.pos] != ']' {
+			if n.object {
+				keyStart := p.pos
+				p.skipString()
+				var key string
+				if err := json.Unmarshal(p.text[keyStart:p.pos], &key); err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key)
+				n.keyStarts = append(n.keyStarts, keyStart)
+				n.keyEnds = append(n.keyEnds, p.pos)
+				p.skipSpace()
+				p.pos++ // :
+				p.skipSpace()
+			}
+			child, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, child)
+			p.skipSpace()
+			if p.text[p.pos] == ',' {
+				p.pos++
+				p.skipSpace()
+			}
+		}
+		p.pos++
+	case '"':
+		p.skipString()
+	default:
+		for p.pos < len(p.text) && strings.IndexByte(",]} \t\r\n", p.text[p.pos]) < 0 {
+			p.pos++
+		}
+	}
+	n.end = p.pos
+	return n, nil
+}
+
+func (p *textParser) skipString() {
+	p.pos++
+	for p.text[p.pos] != '"' {
+		if p.text[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	p.pos++
+}
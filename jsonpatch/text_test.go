@@ -0,0 +1,112 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyText(t *testing.T) {
+	src := `{
+  "name":   "service",
+  "port": 8080.0,
+  "tags": [ "a", "b" ],
+  "limits": {
+    "cpu": 1e3,
+    "mem": "2G"
+  },
+  "empty": {}
+}
+`
+	tests := []struct {
+		name     string
+		ops      []map[string]any
+		expected string
+	}{
+		{
+			"replace keeps the rest",
+			[]map[string]any{{"op": "replace", "path": "/name", "value": "api"}},
+			strings.Replace(src, `"service"`, `"api"`, 1),
+		},
+		{
+			"add member after the last one",
+			[]map[string]any{{"op": "add", "path": "/limits/disk", "value": map[string]any{"max": 10}}},
+			strings.Replace(src, `"mem": "2G"`, "\"mem\": \"2G\",\n    \"disk\": {\n      \"max\": 10\n    }", 1),
+		},
+		{
+			"insert and append array elements",
+			[]map[string]any{
+				{"op": "add", "path": "/tags/0", "value": "z"},
+				{"op": "add", "path": "/tags/-", "value": "c"},
+			},
+			strings.Replace(src, `[ "a", "b" ]`, `[ "z", "a", "b", "c" ]`, 1),
+		},
+		{
+			"remove first and last members",
+			[]map[string]any{
+				{"op": "remove", "path": "/name"},
+				{"op": "remove", "path": "/empty"},
+			},
+			strings.Replace(strings.Replace(src, "\n  \"name\":   \"service\",", "", 1), ",\n  \"empty\": {}", "", 1),
+		},
+		{
+			"add to an empty object",
+			[]map[string]any{{"op": "add", "path": "/empty/on", "value": true}},
+			strings.Replace(src, `"empty": {}`, "\"empty\": {\n    \"on\": true\n  }", 1),
+		},
+		{
+			"move and string edit",
+			[]map[string]any{
+				{"op": "move", "from": "/tags/0", "path": "/tags/-"},
+				{"op": "str_ins", "path": "/limits/mem", "pos": 1, "str": "0"},
+				{"op": "test", "path": "/port", "value": 8080},
+			},
+			strings.Replace(strings.Replace(src, `[ "a", "b" ]`, `[ "b", "a" ]`, 1), `"2G"`, `"20G"`, 1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ApplyText([]byte(src), tt.ops)
+			if err != nil {
+				t.Fatalf("ApplyText returned error: %v", err)
+			}
+			if string(out) != tt.expected {
+				t.Fatalf("Texts not equal.\nGot:\n%s\nExpected:\n%s", out, tt.expected)
+			}
+			// The text must hold the same document as ApplyValue produces.
+			var doc, got any
+			json.Unmarshal([]byte(src), &doc)
+			expected, _ := ApplyValue(doc, tt.ops)
+			if err := json.Unmarshal(out, &got); err != nil || !reflect.DeepEqual(got, roundTrip(expected)) {
+				t.Fatalf("expected %v, got %v (%v)", expected, got, err)
+			}
+		})
+	}
+}
+
+func TestApplyTextErrors(t *testing.T) {
+	_, err := ApplyText([]byte(`{"a": 1}`), []map[string]any{
+		{"op": "add", "path": "/b", "value": 2},
+		{"op": "remove", "path": "/missing"},
+	})
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Index != 1 || !errors.Is(err, ErrPathNotFound) {
+		t.Fatalf("expected an *OpError for op 1, got %v", err)
+	}
+	if _, err := ApplyText([]byte(`{"a": `), nil); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+	out, err := ApplyText([]byte(`{"a":[1,2]}`), []map[string]any{{"op": "add", "path": "/b", "value": []any{3}}})
+	if err != nil || string(out) != `{"a":[1,2],"b":[3]}` {
+		t.Fatalf("expected compact output for a compact document, got %s (%v)", out, err)
+	}
+}
+
+func roundTrip(v any) any {
+	data, _ := json.Marshal(v)
+	var out any
+	json.Unmarshal(data, &out)
+	return out
+}
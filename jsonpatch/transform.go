@@ -0,0 +1,709 @@
+package jsonpatch
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/jsonpointer"
+)
+
+// Operation is a single JSON Patch operation, in the form Apply accepts.
+type Operation = map[string]any
+
+// TransformOp adjusts a, which was created against the same document as b,
+// so that it has the same intent when applied after b. It returns no
+// operations when b made a redundant or inapplicable (for example, b removed
+// the element a edits), and two when b inserted text into the middle of a
+// str_del range.
+//
+// Array indices shift around elements b inserted, removed, or moved, and
+// str_ins/str_del offsets (in UTF-16 code units) shift around text b inserted
+// or deleted in the same string. A move is taken to remove its source and
+// then insert at its path. When a and b insert at the same array index or
+// string offset, b's insertion ends up first, except that a value added or
+// copied there always goes before a value moved there. When both set the same
+// value, by replacing it, adding the same object member, or moving or
+// copying to the same place, b's write wins and a's is dropped; so is a move
+// of the value b moved. Operations that b replaced or removed the target of
+// are dropped, except that a move that has lost its target still removes
+// its source. When a move or copy loses its source, what it wrote over at
+// an object member is still removed. When a removes or overwrites a value b
+// moved or copied, it is removed wherever b put it, and edits a makes inside
+// a value b copied are made to the copy too.
+//
+// Documents are not consulted, so numeric path segments are taken to be array
+// indices. Where the outcome depends on the document, TransformOp returns an
+// error wrapping ErrNotTransformable: for two appends to the same array with
+// "-", a move or copy with "-" of a value a changes, a copy into itself, a
+// move or copy over a container of the value it takes, a move or copy into or
+// out of a value b copied, and a move or copy onto a place b moved a value
+// away from, either into an array or to where the first one came from.
+func TransformOp(a, b Operation) ([]Operation, error) {
+	return transformOp(a, b, false)
+}
+
+// Rebase adjusts patch, which was created against the same document as onto,
+// so that it can be applied after onto. Concurrent writers that each rebase
+// their pending operations onto the ones committed before them converge on
+// the same document, unless Rebase returns ErrNotTransformable. See
+// TransformOp for how individual operations change.
+func Rebase(patch, onto []Operation) ([]Operation, error) {
+	rebased, _, err := Transform(patch, onto)
+	return rebased, err
+}
+
+// Transform rebases two concurrent patches over each other: aAfterB is
+// Rebase(a, b), and bAfterA is b adjusted to apply after a, breaking ties the
+// same way, so applying b then aAfterB and a then bAfterA give the same
+// document.
+func Transform(a, b []Operation) (aAfterB, bAfterA []Operation, err error) {
+	return transformPatches(a, b, false)
+}
+
+// transformPatches returns xs adjusted to apply after ys and ys adjusted to
+// apply after xs. left decides ties between insertions, and between writes
+// to the same place, in favor of xs.
+func transformPatches(xs, ys []Operation, left bool) ([]Operation, []Operation, error) {
+	switch {
+	case len(xs) == 0 || len(ys) == 0:
+		return xs, ys, nil
+	case len(xs) == 1 && len(ys) == 1:
+		x, err := transformOp(xs[0], ys[0], left)
+		if err != nil {
+			return nil, nil, err
+		}
+		y, err := transformOp(ys[0], xs[0], !left)
+		if err != nil {
+			return nil, nil, err
+		}
+		return x, y, nil
+	case len(xs) > 1:
+		x1, y1, err := transformPatches(xs[:1], ys, left)
+		if err != nil {
+			return nil, nil, err
+		}
+		x2, y2, err := transformPatches(xs[1:], y1, left)
+		if err != nil {
+			return nil, nil, err
+		}
+		return append(x1, x2...), y2, nil
+	default:
+		x1, y1, err := transformPatches(xs, ys[:1], left)
+		if err != nil {
+			return nil, nil, err
+		}
+		x2, y2, err := transformPatches(x1, ys[1:], left)
+		if err != nil {
+			return nil, nil, err
+		}
+		return x2, append(y1, y2...), nil
+	}
+}
+
+// transformInfo is the part of an operation that transforms look at.
+type transformInfo struct {
+	op   string
+	path []string
+	from []string // nil unless op is "copy" or "move"
+}
+
+func parseTransformInfo(op Operation) (transformInfo, error) {
+	opType, opTypeOk := op["op"].(string)
+	pathRaw, pathRawOk := op["path"].(string)
+	if !opTypeOk || !pathRawOk {
+		return transformInfo{}, errorf(ErrInvalidOperation, "invalid op format: op missing or not a string, or path missing or not a string: %+v", op)
+	}
+	path, err := splitPointer(pathRaw)
+	if err != nil {
+		return transformInfo{}, err
+	}
+	info := transformInfo{op: opType, path: path}
+	if opType == "copy" || opType == "move" {
+		fromRaw, ok := op["from"].(string)
+		if !ok {
+			return transformInfo{}, errorf(ErrInvalidOperation, "op %q missing %q field for path %q", opType, "from", pathRaw)
+		}
+		if info.from, err = splitPointer(fromRaw); err != nil {
+			return transformInfo{}, err
+		}
+	}
+	return info, nil
+}
+
+// pointerUse is how an operation uses the value at one of its pointers.
+type pointerUse struct {
+	// inserts is set when the operation inserts a new array element there,
+	// shifting the one at that index up.
+	inserts bool
+	// writes is set when the operation sets the value there, replacing any
+	// value already present.
+	writes bool
+	// edits is set when the operation changes the value there in place, so
+	// that it means nothing for any other value.
+	edits bool
+	// moves is set along with inserts when the inserted value is moved from
+	// elsewhere in the document.
+	moves bool
+}
+
+// pathUse returns how the operation uses the value at its path. Like the
+// rest of the transforms, it takes numeric segments to be array indices.
+func (t transformInfo) pathUse() pointerUse {
+	switch t.op {
+	case "add", "copy", "move":
+		if n := len(t.path); n > 0 && isArrayIndex(t.path[n-1]) {
+			return pointerUse{inserts: true, moves: t.op == "move"}
+		}
+		return pointerUse{writes: true}
+	case "replace":
+		return pointerUse{writes: true}
+	case "str_ins", "str_del", "inc":
+		return pointerUse{edits: true}
+	}
+	return pointerUse{}
+}
+
+// target returns the operation's path in the document it applies to. The
+// path of a move points into the document without the moved value.
+func (t transformInfo) target() []string {
+	if t.op == "move" {
+		return beforeRemove(t.path, t.from)
+	}
+	return t.path
+}
+
+func (t transformInfo) isStringOp() bool {
+	return t.op == "str_ins" || t.op == "str_del"
+}
+
+// isNoopMove reports whether the operation moves a value onto itself.
+func (t transformInfo) isNoopMove() bool {
+	return t.op == "move" && slices.Equal(t.from, t.path)
+}
+
+// isArrayIndex reports whether segment is an array index or "-".
+func isArrayIndex(segment string) bool {
+	if segment == "-" {
+		return true
+	}
+	_, err := parseArrayIndex(segment)
+	return err == nil
+}
+
+func transformOp(a, b Operation, left bool) ([]Operation, error) {
+	ai, err := parseTransformInfo(a)
+	if err != nil {
+		return nil, err
+	}
+	bi, err := parseTransformInfo(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTransformable(ai, bi); err != nil {
+		return nil, err
+	}
+	if err := checkTransformable(bi, ai); err != nil {
+		return nil, err
+	}
+	ops, err := adjustOp(a, b, ai, bi, left)
+	if err != nil {
+		return nil, err
+	}
+	follow, err := followValue(ops, ai, bi, left)
+	if err != nil {
+		return nil, err
+	}
+	return append(ops, follow...), nil
+}
+
+// adjustOp adjusts a for the effects of b, without regard for a value b
+// moved or copied.
+func adjustOp(a, b Operation, ai, bi transformInfo, left bool) ([]Operation, error) {
+	// String offsets are compared on the original paths, before either
+	// operation's path is adjusted.
+	ops := []Operation{a}
+	if ai.isStringOp() && bi.isStringOp() && slices.Equal(ai.path, bi.path) {
+		var err error
+		if ops, err = transformString(a, b, left); err != nil {
+			return nil, err
+		}
+	}
+
+	// Of two moves of the same value, only the left one happens, but the
+	// other still clears the member it overwrote.
+	if !left && ai.op == "move" && bi.op == "move" && slices.Equal(ai.from, bi.from) && !ai.isNoopMove() && !bi.isNoopMove() {
+		return afterLostSource(ai, bi, left)
+	}
+
+	var from []string
+	fromKept := true
+	if ai.from != nil {
+		from, fromKept = transformPointer(ai.from, pointerUse{}, bi, left)
+	}
+	var path []string
+	var keep bool
+	switch {
+	case ai.isNoopMove():
+		// A move onto itself stays one, wherever its target ends up.
+		path, keep = from, fromKept
+	case ai.op == "move" && fromKept:
+		path, keep = transformMovePath(ai, from, bi, left)
+	default:
+		path, keep = transformPointer(ai.path, ai.pathUse(), bi, left)
+	}
+	if !fromKept && !ai.isNoopMove() {
+		return afterLostSource(ai, bi, left)
+	}
+	if !keep {
+		if ai.op == "move" && !ai.isNoopMove() {
+			// The value still leaves its source, as it did when a was applied
+			// first and b then dropped or overwrote it.
+			return []Operation{{"op": "remove", "path": joinPointer(from)}}, nil
+		}
+		return nil, nil
+	}
+	if ai.op == "move" && !ai.isNoopMove() && slices.Equal(from, path) {
+		// b already moved the value where a moves it.
+		return nil, nil
+	}
+	if ai.op == "move" && !ai.isNoopMove() && len(path) > len(from) && slices.Equal(path[:len(from)], from) {
+		// b moved the value's new container to where the value was, and a
+		// move cannot go into itself.
+		return nil, notTransformable(ai, bi)
+	}
+	pathChanged := !slices.Equal(path, ai.path)
+	fromChanged := ai.from != nil && !slices.Equal(from, ai.from)
+	// An add of the value b moved away follows it, and must not insert a
+	// second value when b moved it into an array.
+	addToReplace := ai.op == "add" && ai.pathUse().writes && bi.op == "move" && !bi.isNoopMove() && bi.pathUse().inserts && slices.Equal(ai.path, bi.from)
+	if pathChanged || fromChanged || addToReplace {
+		for i, op := range ops {
+			op = maps.Clone(op)
+			if pathChanged {
+				op["path"] = joinPointer(path)
+			}
+			if fromChanged {
+				op["from"] = joinPointer(from)
+			}
+			if addToReplace {
+				op["op"] = "replace"
+			}
+			ops[i] = op
+		}
+	}
+	if left && ai.op == "move" && !ai.isNoopMove() && !bi.isNoopMove() && ai.pathUse().writes && bi.pathUse().writes && slices.Equal(ai.target(), bi.target()) && !isPrefix(path, from) {
+		// a's move wins the place b wrote to. Removing b's value first,
+		// rather than leaving the move to overwrite it, keeps it removed
+		// when a later operation removes a's source and so drops the move.
+		// That is unless a moves the value out of b's.
+		ops = append([]Operation{{"op": "remove", "path": joinPointer(beforeRemove(path, from))}}, ops...)
+	}
+	return ops, nil
+}
+
+// isPrefix reports whether p is q or one of its ancestors.
+func isPrefix(p, q []string) bool {
+	return len(p) <= len(q) && slices.Equal(p, q[:len(p)])
+}
+
+// afterLostSource returns what is left of move or copy a once b has removed
+// its source, or overwritten a container of it: nothing, except that a
+// value a wrote over at an object member is gone.
+func afterLostSource(a, b transformInfo, left bool) ([]Operation, error) {
+	use := a.pathUse()
+	if !use.writes {
+		return nil, nil
+	}
+	p := a.path
+	if a.op == "move" {
+		p = beforeRemove(p, a.from)
+	}
+	p, keep := transformPointer(p, use, b, left)
+	if !keep {
+		return nil, nil
+	}
+	if len(p) == 0 {
+		return nil, notTransformable(a, b)
+	}
+	// Adding first makes the removal succeed whether or not the member
+	// was there.
+	pathRaw := joinPointer(p)
+	return []Operation{{"op": "add", "path": pathRaw, "value": nil}, {"op": "remove", "path": pathRaw}}, nil
+}
+
+// followValue returns the operations that carry a's effect over to the
+// value b moved or copied, given that ops are a adjusted for b. When a
+// removed or overwrote the value b moved or copied, that value goes too,
+// and when a changed the value b copied, the copy changes with it. A move
+// of the value a changed needs nothing more, since a follows it there.
+func followValue(ops []Operation, a, b transformInfo, left bool) ([]Operation, error) {
+	if (b.op != "move" && b.op != "copy") || b.isNoopMove() {
+		return nil, nil
+	}
+	destroyed := a.destroys(b.from)
+	if destroyed && b.op == "move" && slices.Equal(a.target(), b.from) {
+		// a removed the value itself, so it followed the value to b's path.
+		return nil, nil
+	}
+	if !destroyed && (b.op != "copy" || !a.changesInside(b.from)) {
+		return nil, nil
+	}
+
+	// Where b's source and value are once ops are applied.
+	from, _ := transformPointer(b.from, pointerUse{}, b, !left)
+	path := b.path
+	for _, op := range ops {
+		info, err := parseTransformInfo(op)
+		if err != nil {
+			return nil, err
+		}
+		var keep bool
+		if path, keep = transformPointer(path, pointerUse{}, info, !left); !keep {
+			return nil, nil
+		}
+	}
+	if destroyed {
+		return []Operation{{"op": "remove", "path": joinPointer(path)}}, nil
+	}
+
+	var copied []Operation
+	for _, op := range ops {
+		info, err := parseTransformInfo(op)
+		if err != nil {
+			return nil, err
+		}
+		if !hasPointerPrefix(info.path, from) {
+			continue
+		}
+		op = deepCopyValue(op).(Operation)
+		op["path"] = joinPointer(append(append([]string{}, path...), info.path[len(from):]...))
+		if op["op"] == "add" && len(info.path) == len(from) {
+			// The copy is there to be replaced, even in an array.
+			op["op"] = "replace"
+		}
+		copied = append(copied, op)
+	}
+	return copied, nil
+}
+
+// checkTransformable returns an error wrapping ErrNotTransformable when
+// the outcome of a and b depends on the document: when both append to the
+// same array with "-", and when carrying a's effect over to the value move
+// or copy b took does. That is when b moved or copied the value to the end
+// of an array with "-", copied it into itself, or moved or copied it over a
+// container of itself; when a moved or copied a value into, or moved one
+// out of, the value b copied; and when a moved or copied a value onto the
+// place b moved it from, and b moved it into an array or to a's source.
+func checkTransformable(a, b transformInfo) error {
+	if at, bt := a.target(), b.target(); a.pathUse().inserts && b.pathUse().inserts && at[len(at)-1] == "-" && bt[len(bt)-1] == "-" && slices.Equal(at[:len(at)-1], bt[:len(bt)-1]) {
+		// Which value ends up last depends on the array's length.
+		return notTransformable(a, b)
+	}
+	if (b.op != "move" && b.op != "copy") || b.isNoopMove() {
+		return nil
+	}
+	var reaches bool
+	if b.op == "move" {
+		reaches = a.destroys(b.from) || a.pointsInto(b.from)
+	} else {
+		reaches = a.destroys(b.from) || a.changesInside(b.from)
+	}
+	if !reaches {
+		return nil
+	}
+	switch {
+	case len(b.path) > 0 && b.path[len(b.path)-1] == "-",
+		b.op == "copy" && (hasPointerPrefix(b.path, b.from) || hasPointerPrefix(b.from, b.path)),
+		b.op == "move" && hasPointerPrefix(b.from, b.target()),
+		b.op == "copy" && (a.op == "move" || a.op == "copy") && a.changesInside(b.from),
+		b.op == "move" && (a.op == "move" || a.op == "copy") && a.pathUse().writes && slices.Equal(a.target(), b.from) && (b.pathUse().inserts || slices.Equal(a.from, b.target())):
+		return notTransformable(a, b)
+	}
+	return nil
+}
+
+func notTransformable(a, b transformInfo) error {
+	return errorf(ErrNotTransformable, "cannot transform %q at %q against concurrent %q at %q without the document", a.op, joinPointer(a.path), b.op, joinPointer(b.path))
+}
+
+// destroys reports whether the operation removes the value at p, or
+// removes or overwrites a container of it.
+func (t transformInfo) destroys(p []string) bool {
+	_, kept := transformPointer(p, pointerUse{}, t, false)
+	return !kept
+}
+
+// pointsInto reports whether one of the operation's pointers refers to the
+// value at p or into it, other than to insert before it.
+func (t transformInfo) pointsInto(p []string) bool {
+	if target := t.target(); hasPointerPrefix(target, p) && !(t.pathUse().inserts && len(target) == len(p)) {
+		return true
+	}
+	return t.from != nil && hasPointerPrefix(t.from, p)
+}
+
+// changesInside reports whether the operation changes the value at p or
+// something inside it, other than by removing or moving it whole.
+func (t transformInfo) changesInside(p []string) bool {
+	if isPredicate(t.op) {
+		return false
+	}
+	if target := t.target(); hasPointerPrefix(target, p) && !(t.pathUse().inserts && len(target) == len(p)) {
+		return true
+	}
+	return t.op == "move" && len(t.from) > len(p) && hasPointerPrefix(t.from, p)
+}
+
+// transformMovePath adjusts the path of move a for the effects of b, given
+// that a's source ends up at from. a's path points into the document without
+// the moved value, so it is first adjusted to the document b applies to, then
+// for b, and then back around the moved value's place after b.
+func transformMovePath(a transformInfo, from []string, b transformInfo, left bool) ([]string, bool) {
+	p, keep := transformPointer(beforeRemove(a.path, a.from), a.pathUse(), b, left)
+	if !keep {
+		return nil, false
+	}
+	return afterRemove(p, true, from)
+}
+
+// transformPointer adjusts pointer p of an operation for the effects of b. It
+// returns false when the operation no longer applies. use says what the
+// operation does with the value at p.
+func transformPointer(p []string, use pointerUse, b transformInfo, left bool) ([]string, bool) {
+	switch b.op {
+	case "add", "copy":
+		return afterAdd(p, use, b.path, false, left)
+	case "remove":
+		return afterRemove(p, use.inserts, b.path)
+	case "replace":
+		return p, !overwrittenBy(p, use, b.path, left)
+	case "move":
+		if b.isNoopMove() {
+			return p, true
+		}
+		if hasPointerPrefix(p, b.from) && !(use.inserts && len(p) == len(b.from)) {
+			return append(append([]string{}, b.path...), p[len(b.from):]...), true
+		}
+		p, keep := afterRemove(p, use.inserts, b.from)
+		if !keep {
+			return nil, false
+		}
+		return afterAdd(p, use, b.path, true, left)
+	default:
+		return p, true
+	}
+}
+
+// afterAdd adjusts p for a value added at path, or moved there if moved is
+// set: later elements of the same array shift up, and anything the added
+// value replaced is gone.
+func afterAdd(p []string, use pointerUse, path []string, moved, left bool) ([]string, bool) {
+	if len(path) == 0 {
+		return p, !overwrittenBy(p, use, path, left)
+	}
+	last := len(path) - 1
+	index, err := parseArrayIndex(path[last])
+	if err != nil {
+		if path[last] == "-" {
+			return p, true
+		}
+		return p, !overwrittenBy(p, use, path, left)
+	}
+	parent := path[:last]
+	if len(p) <= last || !hasPointerPrefix(p, parent) {
+		return p, true
+	}
+	j, err := parseArrayIndex(p[last])
+	if err != nil {
+		return p, true
+	}
+	if j > index || (j == index && !(use.inserts && len(p) == len(path) && insertsFirst(use, moved, left))) {
+		return withIndex(p, last, j+1), true
+	}
+	return p, true
+}
+
+// insertsFirst reports whether an insertion described by use goes before a
+// concurrent insertion at the same index, which moved a value there if moved
+// is set. Added and copied values go before moved ones; otherwise the left
+// insertion goes first.
+func insertsFirst(use pointerUse, moved, left bool) bool {
+	if use.moves != moved {
+		return moved
+	}
+	return left
+}
+
+// afterRemove adjusts p for the value at path being removed: later elements
+// of the same array shift down, and anything inside the removed value is gone.
+func afterRemove(p []string, inserts bool, path []string) ([]string, bool) {
+	if hasPointerPrefix(p, path) {
+		// Inserting where a value was removed still makes sense.
+		return p, inserts && len(p) == len(path)
+	}
+	if len(path) == 0 {
+		return p, true
+	}
+	last := len(path) - 1
+	index, err := parseArrayIndex(path[last])
+	if err != nil || len(p) <= last || !hasPointerPrefix(p, path[:last]) {
+		return p, true
+	}
+	if j, err := parseArrayIndex(p[last]); err == nil && j > index {
+		return withIndex(p, last, j-1), true
+	}
+	return p, true
+}
+
+// beforeRemove undoes afterRemove for a pointer p outside path: it adjusts p
+// from the document without the value at path to the one that still has it.
+// An insertion at the removed index stays before the value.
+func beforeRemove(p, path []string) []string {
+	if len(path) == 0 {
+		return p
+	}
+	last := len(path) - 1
+	index, err := parseArrayIndex(path[last])
+	if err != nil || len(p) <= last || !hasPointerPrefix(p, path[:last]) {
+		return p
+	}
+	if j, err := parseArrayIndex(p[last]); err == nil && (j > index || (j == index && len(p) > len(path))) {
+		return withIndex(p, last, j+1)
+	}
+	return p
+}
+
+// overwrittenBy reports whether an operation at p loses its target when the
+// value at path is set: everything below path is gone, in-place edits such
+// as string offsets into the old value are meaningless, and of two writes to
+// path only the left one is kept.
+func overwrittenBy(p []string, use pointerUse, path []string, left bool) bool {
+	if !hasPointerPrefix(p, path) {
+		return false
+	}
+	return len(p) > len(path) || use.edits || (use.writes && !left)
+}
+
+// transformString adjusts the offsets of string operation a for string
+// operation b on the same string.
+func transformString(a, b Operation, left bool) ([]Operation, error) {
+	aPos, aLen, err := stringRange(a)
+	if err != nil {
+		return nil, err
+	}
+	bPos, bLen, err := stringRange(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if b["op"] == "str_ins" {
+		if a["op"] == "str_ins" {
+			if aPos > bPos || (aPos == bPos && !left) {
+				return []Operation{withNumber(a, "pos", aPos+bLen)}, nil
+			}
+			return []Operation{a}, nil
+		}
+		switch {
+		case aPos >= bPos:
+			return []Operation{withNumber(a, "pos", aPos+bLen)}, nil
+		case aPos+aLen <= bPos:
+			return []Operation{a}, nil
+		default:
+			// b inserted inside the range a deletes; a deletes around it.
+			before, after := splitStringDel(a, bPos-aPos)
+			return []Operation{before, withNumber(after, "pos", aPos+bLen)}, nil
+		}
+	}
+
+	// b is a str_del of [bPos, bPos+bLen). Offsets inside the deleted range
+	// collapse to its start.
+	shift := func(x int) int { return afterStringDelete(x, bPos, bLen) }
+	if a["op"] == "str_ins" {
+		return []Operation{withNumber(a, "pos", shift(aPos))}, nil
+	}
+	start, end := shift(aPos), shift(aPos+aLen)
+	if start == end {
+		return nil, nil
+	}
+	op := withNumber(a, "pos", start)
+	if _, ok := op["str"].(string); ok {
+		// Remove the text b already deleted from a's expected text.
+		overlapStart := max(aPos, bPos) - aPos
+		overlapEnd := min(aPos+aLen, bPos+bLen) - aPos
+		if overlapStart < overlapEnd {
+			units := utf16.Encode([]rune(op["str"].(string)))
+			op["str"] = string(utf16.Decode(append(units[:overlapStart:overlapStart], units[overlapEnd:]...)))
+		}
+	} else {
+		op = withNumber(op, "len", end-start)
+	}
+	return []Operation{op}, nil
+}
+
+// stringRange returns the UTF-16 offset and length of a str_ins (the
+// inserted length) or str_del (the deleted length).
+func stringRange(op Operation) (int, int, error) {
+	opType := op["op"].(string)
+	pos, ok := getNumericValue(op["pos"])
+	if !ok {
+		return 0, 0, errorf(ErrInvalidOperation, "invalid %q op parameters (pos missing or wrong type) for path %q", opType, op["path"])
+	}
+	if s, ok := op["str"].(string); ok {
+		return int(pos), utf16Length(s), nil
+	}
+	if opType == "str_del" {
+		if n, ok := getNumericValue(op["len"]); ok {
+			return int(pos), int(n), nil
+		}
+		return 0, 0, errorf(ErrInvalidOperation, "invalid %q op parameters (str or len required) for path %q", opType, op["path"])
+	}
+	return 0, 0, errorf(ErrInvalidOperation, "invalid %q op parameters (pos/str missing or wrong type) for path %q", opType, op["path"])
+}
+
+// splitStringDel splits str_del op at UTF-16 offset n into the deletion of
+// its first n units and of the rest, both starting at the original position.
+func splitStringDel(op Operation, n int) (Operation, Operation) {
+	before, after := maps.Clone(op), maps.Clone(op)
+	if s, ok := op["str"].(string); ok {
+		units := utf16.Encode([]rune(s))
+		before["str"] = string(utf16.Decode(units[:n]))
+		after["str"] = string(utf16.Decode(units[n:]))
+		return before, after
+	}
+	total, _ := getNumericValue(op["len"])
+	return withNumber(before, "len", n), withNumber(after, "len", int(total)-n)
+}
+
+// withNumber returns a copy of op with key set to n, keeping the numeric type
+// the operation used.
+func withNumber(op Operation, key string, n int) Operation {
+	op = maps.Clone(op)
+	if _, isInt := op[key].(int); isInt {
+		op[key] = n
+	} else {
+		op[key] = float64(n)
+	}
+	return op
+}
+
+func withIndex(p []string, i, index int) []string {
+	p = append([]string{}, p...)
+	p[i] = strconv.Itoa(index)
+	return p
+}
+
+// splitPointer splits a JSON Pointer into unescaped segments. Like Apply, it
+// accepts pointers without the leading "/".
+func splitPointer(pointer string) ([]string, error) {
+	return jsonpointer.Parse(absolutePointer(pointer))
+}
+
+func joinPointer(segments []string) string {
+	return jsonpointer.Format(segments)
+}
+
+func hasPointerPrefix(p, prefix []string) bool {
+	return len(p) >= len(prefix) && slices.Equal(p[:len(prefix)], prefix)
+}
@@ -0,0 +1,706 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTransformOp(t *testing.T) {
+	tests := []struct {
+		name          string
+		a, b          Operation
+		expected      []Operation
+		expectedError string
+	}{
+		{
+			name:     "add after an earlier insert shifts up",
+			a:        Operation{"op": "add", "path": "/list/2", "value": "x"},
+			b:        Operation{"op": "add", "path": "/list/0", "value": "y"},
+			expected: []Operation{{"op": "add", "path": "/list/3", "value": "x"}},
+		},
+		{
+			name:     "insert at the same index goes after",
+			a:        Operation{"op": "add", "path": "/list/1", "value": "x"},
+			b:        Operation{"op": "add", "path": "/list/1", "value": "y"},
+			expected: []Operation{{"op": "add", "path": "/list/2", "value": "x"}},
+		},
+		{
+			name:     "earlier index is unchanged",
+			a:        Operation{"op": "replace", "path": "/list/0", "value": "x"},
+			b:        Operation{"op": "add", "path": "/list/1", "value": "y"},
+			expected: []Operation{{"op": "replace", "path": "/list/0", "value": "x"}},
+		},
+		{
+			name:     "nested path shifts with its ancestor",
+			a:        Operation{"op": "replace", "path": "/list/1/name", "value": "x"},
+			b:        Operation{"op": "remove", "path": "/list/0"},
+			expected: []Operation{{"op": "replace", "path": "/list/0/name", "value": "x"}},
+		},
+		{
+			name:     "edit of a removed element is dropped",
+			a:        Operation{"op": "replace", "path": "/list/1/name", "value": "x"},
+			b:        Operation{"op": "remove", "path": "/list/1"},
+			expected: nil,
+		},
+		{
+			name:     "insert where an element was removed is kept",
+			a:        Operation{"op": "add", "path": "/list/1", "value": "x"},
+			b:        Operation{"op": "remove", "path": "/list/1"},
+			expected: []Operation{{"op": "add", "path": "/list/1", "value": "x"}},
+		},
+		{
+			name:     "edit below a replaced value is dropped",
+			a:        Operation{"op": "add", "path": "/obj/a", "value": 1},
+			b:        Operation{"op": "replace", "path": "/obj", "value": map[string]any{}},
+			expected: nil,
+		},
+		{
+			name:     "append is unaffected by inserts",
+			a:        Operation{"op": "add", "path": "/list/-", "value": "x"},
+			b:        Operation{"op": "add", "path": "/list/0", "value": "y"},
+			expected: []Operation{{"op": "add", "path": "/list/-", "value": "x"}},
+		},
+		{
+			name:     "edit follows a moved value",
+			a:        Operation{"op": "str_ins", "path": "/a/s", "pos": 0, "str": "x"},
+			b:        Operation{"op": "move", "from": "/a", "path": "/b"},
+			expected: []Operation{{"op": "str_ins", "path": "/b/s", "pos": 0, "str": "x"}},
+		},
+		{
+			name:     "move within an array shifts the elements in between",
+			a:        Operation{"op": "replace", "path": "/list/2", "value": "x"},
+			b:        Operation{"op": "move", "from": "/list/0", "path": "/list/3"},
+			expected: []Operation{{"op": "replace", "path": "/list/1", "value": "x"}},
+		},
+		{
+			name:     "copy source follows a removal",
+			a:        Operation{"op": "copy", "from": "/list/2", "path": "/c"},
+			b:        Operation{"op": "remove", "path": "/list/0"},
+			expected: []Operation{{"op": "copy", "from": "/list/1", "path": "/c"}},
+		},
+		{
+			name:     "move of a removed value into an array is dropped",
+			a:        Operation{"op": "move", "from": "/obj/a", "path": "/list/0"},
+			b:        Operation{"op": "remove", "path": "/obj/a"},
+			expected: nil,
+		},
+		{
+			name: "move of a removed value still clears the member it wrote",
+			a:    Operation{"op": "move", "from": "/list/0", "path": "/c"},
+			b:    Operation{"op": "remove", "path": "/list/0"},
+			expected: []Operation{
+				{"op": "add", "path": "/c", "value": nil},
+				{"op": "remove", "path": "/c"},
+			},
+		},
+		{
+			name:     "escaped segments survive",
+			a:        Operation{"op": "replace", "path": "/a~1b/1", "value": "x"},
+			b:        Operation{"op": "add", "path": "/a~1b/0", "value": "y"},
+			expected: []Operation{{"op": "replace", "path": "/a~1b/2", "value": "x"}},
+		},
+		{
+			name:     "str_ins after an earlier str_ins",
+			a:        Operation{"op": "str_ins", "path": "/s", "pos": 5, "str": "x"},
+			b:        Operation{"op": "str_ins", "path": "/s", "pos": 2, "str": "abc"},
+			expected: []Operation{{"op": "str_ins", "path": "/s", "pos": 8, "str": "x"}},
+		},
+		{
+			name:     "str_ins offsets count UTF-16 units",
+			a:        Operation{"op": "str_ins", "path": "/s", "pos": float64(3), "str": "x"},
+			b:        Operation{"op": "str_ins", "path": "/s", "pos": float64(0), "str": "😀"},
+			expected: []Operation{{"op": "str_ins", "path": "/s", "pos": float64(5), "str": "x"}},
+		},
+		{
+			name:     "str_ins on another string is unchanged",
+			a:        Operation{"op": "str_ins", "path": "/t", "pos": 5, "str": "x"},
+			b:        Operation{"op": "str_ins", "path": "/s", "pos": 0, "str": "abc"},
+			expected: []Operation{{"op": "str_ins", "path": "/t", "pos": 5, "str": "x"}},
+		},
+		{
+			name:     "str_ins inside a deleted range moves to its start",
+			a:        Operation{"op": "str_ins", "path": "/s", "pos": 4, "str": "x"},
+			b:        Operation{"op": "str_del", "path": "/s", "pos": 2, "len": 5},
+			expected: []Operation{{"op": "str_ins", "path": "/s", "pos": 2, "str": "x"}},
+		},
+		{
+			name: "str_del around an insertion is split",
+			a:    Operation{"op": "str_del", "path": "/s", "pos": 1, "len": 4},
+			b:    Operation{"op": "str_ins", "path": "/s", "pos": 3, "str": "xy"},
+			expected: []Operation{
+				{"op": "str_del", "path": "/s", "pos": 1, "len": 2},
+				{"op": "str_del", "path": "/s", "pos": 3, "len": 2},
+			},
+		},
+		{
+			name: "str_del by text is split by text",
+			a:    Operation{"op": "str_del", "path": "/s", "pos": 0, "str": "abcd"},
+			b:    Operation{"op": "str_ins", "path": "/s", "pos": 1, "str": "x"},
+			expected: []Operation{
+				{"op": "str_del", "path": "/s", "pos": 0, "str": "a"},
+				{"op": "str_del", "path": "/s", "pos": 1, "str": "bcd"},
+			},
+		},
+		{
+			name:     "overlapping str_del shrinks",
+			a:        Operation{"op": "str_del", "path": "/s", "pos": 2, "len": 4},
+			b:        Operation{"op": "str_del", "path": "/s", "pos": 4, "len": 4},
+			expected: []Operation{{"op": "str_del", "path": "/s", "pos": 2, "len": 2}},
+		},
+		{
+			name:     "overlapping str_del by text drops the shared text",
+			a:        Operation{"op": "str_del", "path": "/s", "pos": 2, "str": "cdef"},
+			b:        Operation{"op": "str_del", "path": "/s", "pos": 0, "len": 4},
+			expected: []Operation{{"op": "str_del", "path": "/s", "pos": 0, "str": "ef"}},
+		},
+		{
+			name:     "str_del inside a deleted range is dropped",
+			a:        Operation{"op": "str_del", "path": "/s", "pos": 3, "len": 1},
+			b:        Operation{"op": "str_del", "path": "/s", "pos": 2, "len": 4},
+			expected: nil,
+		},
+		{
+			name:     "string edit of a replaced string is dropped",
+			a:        Operation{"op": "str_ins", "path": "/s", "pos": 1, "str": "x"},
+			b:        Operation{"op": "replace", "path": "/s", "value": "new"},
+			expected: nil,
+		},
+		{
+			name:     "replace of a value b replaced is dropped",
+			a:        Operation{"op": "replace", "path": "/list/0", "value": "A"},
+			b:        Operation{"op": "replace", "path": "/list/0", "value": "B"},
+			expected: nil,
+		},
+		{
+			name:     "add of a member b added is dropped",
+			a:        Operation{"op": "add", "path": "/obj/k", "value": "A"},
+			b:        Operation{"op": "add", "path": "/obj/k", "value": "B"},
+			expected: nil,
+		},
+		{
+			name:     "add of a member b removed is dropped",
+			a:        Operation{"op": "add", "path": "/obj/k", "value": "A"},
+			b:        Operation{"op": "remove", "path": "/obj/k"},
+			expected: nil,
+		},
+		{
+			name:     "add of a member b moved away follows it",
+			a:        Operation{"op": "add", "path": "/obj/k", "value": "A"},
+			b:        Operation{"op": "move", "from": "/obj/k", "path": "/obj/j"},
+			expected: []Operation{{"op": "add", "path": "/obj/j", "value": "A"}},
+		},
+		{
+			name:     "move to the place b moved to removes its source",
+			a:        Operation{"op": "move", "from": "/x", "path": "/t"},
+			b:        Operation{"op": "move", "from": "/y", "path": "/t"},
+			expected: []Operation{{"op": "remove", "path": "/x"}},
+		},
+		{
+			name:     "move into a removed value removes its source",
+			a:        Operation{"op": "move", "from": "/x", "path": "/obj/t"},
+			b:        Operation{"op": "remove", "path": "/obj"},
+			expected: []Operation{{"op": "remove", "path": "/x"}},
+		},
+		{
+			name:     "move of the value b moved only clears its target",
+			a:        Operation{"op": "move", "from": "/x", "path": "/t"},
+			b:        Operation{"op": "move", "from": "/x", "path": "/u"},
+			expected: []Operation{{"op": "add", "path": "/t", "value": nil}, {"op": "remove", "path": "/t"}},
+		},
+		{
+			name:     "inc of a replaced number is dropped",
+			a:        Operation{"op": "inc", "path": "/n", "inc": 1},
+			b:        Operation{"op": "replace", "path": "/n", "value": 5},
+			expected: nil,
+		},
+		{
+			name:          "missing path",
+			a:             Operation{"op": "add", "value": 1},
+			b:             Operation{"op": "remove", "path": "/a"},
+			expectedError: "path missing or not a string",
+		},
+		{
+			name:          "bad escape",
+			a:             Operation{"op": "remove", "path": "/a~2"},
+			b:             Operation{"op": "remove", "path": "/a"},
+			expectedError: "invalid escape sequence",
+		},
+		{
+			name:          "str_del without len or str",
+			a:             Operation{"op": "str_del", "path": "/s", "pos": 1},
+			b:             Operation{"op": "str_ins", "path": "/s", "pos": 0, "str": "x"},
+			expectedError: "str or len required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TransformOp(tt.a, tt.b)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestRebaseConverges applies two concurrent patches in both orders, each
+// rebased onto the other, and checks that the documents agree.
+func TestRebaseConverges(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []Operation
+	}{
+		{
+			name: "array inserts and removes",
+			a: []Operation{
+				{"op": "add", "path": "/list/1", "value": "a1"},
+				{"op": "remove", "path": "/list/3"},
+			},
+			b: []Operation{
+				{"op": "remove", "path": "/list/0"},
+				{"op": "add", "path": "/list/1", "value": "b1"},
+				{"op": "replace", "path": "/list/2", "value": "b2"},
+			},
+		},
+		{
+			name: "concurrent text edits",
+			a: []Operation{
+				{"op": "str_ins", "path": "/text", "pos": 5, "str": ", dear"},
+				{"op": "str_del", "path": "/text", "pos": 0, "len": 1},
+				{"op": "str_ins", "path": "/text", "pos": 0, "str": "H"},
+			},
+			b: []Operation{
+				{"op": "str_del", "path": "/text", "pos": 3, "len": 5},
+				{"op": "str_ins", "path": "/text", "pos": 3, "str": "p, w"},
+			},
+		},
+		{
+			name: "inserts at the same position",
+			a:    []Operation{{"op": "add", "path": "/list/2", "value": "a"}, {"op": "str_ins", "path": "/text", "pos": 2, "str": "A"}},
+			b:    []Operation{{"op": "add", "path": "/list/2", "value": "b"}, {"op": "str_ins", "path": "/text", "pos": 2, "str": "B"}},
+		},
+		{
+			name: "edits inside moved and removed elements",
+			a: []Operation{
+				{"op": "str_ins", "path": "/list/3/name", "pos": 0, "str": ">"},
+				{"op": "replace", "path": "/list/1/name", "value": "gone"},
+			},
+			b: []Operation{
+				{"op": "move", "from": "/list/3", "path": "/list/0"},
+				{"op": "remove", "path": "/list/2"},
+			},
+		},
+		{
+			name: "replaces of the same element",
+			a:    []Operation{{"op": "replace", "path": "/list/0", "value": "A"}},
+			b:    []Operation{{"op": "replace", "path": "/list/0", "value": "B"}},
+		},
+		{
+			name: "adds of the same member",
+			a:    []Operation{{"op": "add", "path": "/list/1/nick", "value": "A"}},
+			b:    []Operation{{"op": "add", "path": "/list/1/nick", "value": "B"}, {"op": "str_ins", "path": "/list/1/nick", "pos": 1, "str": "!"}},
+		},
+		{
+			name: "moves to the same member",
+			a:    []Operation{{"op": "move", "from": "/list/1/name", "path": "/list/1/title"}},
+			b:    []Operation{{"op": "move", "from": "/list/2/name", "path": "/list/1/title"}, {"op": "remove", "path": "/list/1/name"}},
+		},
+		{
+			name: "array move and an insertion at its destination",
+			a:    []Operation{{"op": "move", "from": "/list/1", "path": "/list/2"}},
+			b:    []Operation{{"op": "add", "path": "/list/3", "value": "v"}},
+		},
+		{
+			name: "array move to the end and a removal",
+			a:    []Operation{{"op": "move", "from": "/list/0", "path": "/list/4"}},
+			b:    []Operation{{"op": "remove", "path": "/list/4"}},
+		},
+		{
+			name: "array move onto itself",
+			a:    []Operation{{"op": "add", "path": "/list/2", "value": "v"}, {"op": "add", "path": "/list/1", "value": "w"}},
+			b:    []Operation{{"op": "move", "from": "/list/1", "path": "/list/1"}},
+		},
+		{
+			name: "deletion split by an insertion",
+			a:    []Operation{{"op": "str_del", "path": "/text", "pos": 1, "str": "ello w"}},
+			b:    []Operation{{"op": "str_ins", "path": "/text", "pos": 4, "str": "🙂"}, {"op": "str_del", "path": "/text", "pos": 8, "len": 3}},
+		},
+	}
+
+	base := map[string]any{
+		"text": "hello world",
+		"list": []any{
+			map[string]any{"name": "zero"},
+			map[string]any{"name": "one"},
+			map[string]any{"name": "two"},
+			map[string]any{"name": "three"},
+			map[string]any{"name": "four"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aAfterB, bAfterA, err := Transform(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("transform: %v", err)
+			}
+			if rebased, err := Rebase(tt.a, tt.b); err != nil || !reflect.DeepEqual(rebased, aAfterB) {
+				t.Fatalf("Rebase disagrees with Transform: %v, %v", rebased, err)
+			}
+
+			first := deepCopyDoc(base)
+			if err := Apply(first, append(append([]Operation{}, tt.b...), aAfterB...)); err != nil {
+				t.Fatalf("b then rebased a: %v", err)
+			}
+			second := deepCopyDoc(base)
+			if err := Apply(second, append(append([]Operation{}, tt.a...), bAfterA...)); err != nil {
+				t.Fatalf("a then rebased b: %v", err)
+			}
+			if !reflect.DeepEqual(first, second) {
+				t.Fatalf("documents diverged:\nb, a': %v\na, b': %v", first, second)
+			}
+		})
+	}
+}
+
+// TestTransformConvergesRandomly transforms random concurrent patches over
+// each other and checks that both orders give the same document.
+func TestTransformConvergesRandomly(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := map[string]any{
+		"text": "hello",
+		"obj":  map[string]any{"a": "x", "b": map[string]any{"c": "y"}},
+		"list": []any{"zero", map[string]any{"a": "one"}, "two"},
+	}
+	for i := range 5000 {
+		a, b := randomPatch(rng, base), randomPatch(rng, base)
+		if err := checkConverges(base, a, b); err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+	}
+}
+
+// TestTransformConvergesWithArrayMoves is TestTransformConvergesRandomly on a
+// document of arrays, where most operations insert, remove, or move elements.
+func TestTransformConvergesWithArrayMoves(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := map[string]any{
+		"list":  []any{"a", "b", "c", "d", "e"},
+		"lists": []any{[]any{"f", "g"}, []any{"h"}, map[string]any{"i": []any{"j", "k"}}},
+	}
+	for i := range 5000 {
+		a, b := randomPatch(rng, base), randomPatch(rng, base)
+		if err := checkConverges(base, a, b); err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+	}
+}
+
+func TestTransformConvergesAcrossContainers(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []Operation
+	}{
+		{
+			name: "move of a removed element over an object member",
+			a:    []Operation{{"op": "move", "from": "/arr/1", "path": "/m/x"}},
+			b:    []Operation{{"op": "remove", "path": "/arr/1"}},
+		},
+		{
+			name: "add of a member moved into an array",
+			a:    []Operation{{"op": "add", "path": "/m/x", "value": 7.0}},
+			b:    []Operation{{"op": "move", "from": "/m/x", "path": "/arr/2"}},
+		},
+		{
+			name: "move out of a replaced array",
+			a:    []Operation{{"op": "move", "from": "/arr/1", "path": "/m/q"}},
+			b:    []Operation{{"op": "replace", "path": "/arr", "value": map[string]any{"z": 1.0}}},
+		},
+		{
+			name: "move out of a removed object",
+			a:    []Operation{{"op": "move", "from": "/m/x", "path": "/arr/0"}},
+			b:    []Operation{{"op": "remove", "path": "/m"}},
+		},
+		{
+			name: "copy of an object that gains a member",
+			a:    []Operation{{"op": "copy", "from": "/m", "path": "/c"}},
+			b:    []Operation{{"op": "add", "path": "/m/y", "value": 2.0}},
+		},
+		{
+			name: "copy of a removed member",
+			a:    []Operation{{"op": "copy", "from": "/m/x", "path": "/c"}},
+			b:    []Operation{{"op": "remove", "path": "/m/x"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			base := map[string]any{"arr": []any{"a", "b", "c", "d"}, "m": map[string]any{"x": 1.0}}
+			if err := checkConverges(base, tc.a, tc.b); err != nil {
+				t.Fatal(err)
+			}
+			if err := checkConverges(base, tc.b, tc.a); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestTransformNotTransformable(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Operation
+	}{
+		{
+			name: "moves swapping two members",
+			a:    Operation{"op": "move", "from": "/q", "path": "/p"},
+			b:    Operation{"op": "move", "from": "/p", "path": "/q"},
+		},
+		{
+			name: "appends to the same array",
+			a:    Operation{"op": "add", "path": "/list/-", "value": 1},
+			b:    Operation{"op": "move", "from": "/x", "path": "/list/-"},
+		},
+		{
+			name: "copy into itself",
+			a:    Operation{"op": "add", "path": "/m/y", "value": 1},
+			b:    Operation{"op": "copy", "from": "/m", "path": "/m/c"},
+		},
+		{
+			name: "move into a copied value",
+			a:    Operation{"op": "move", "from": "/x", "path": "/m/y"},
+			b:    Operation{"op": "copy", "from": "/m", "path": "/c"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := TransformOp(tc.a, tc.b); !errors.Is(err, ErrNotTransformable) {
+				t.Errorf("expected ErrNotTransformable, got %v", err)
+			}
+			if _, err := TransformOp(tc.b, tc.a); !errors.Is(err, ErrNotTransformable) {
+				t.Errorf("expected ErrNotTransformable the other way, got %v", err)
+			}
+		})
+	}
+}
+
+// TestTransformConvergesWithMovesAndCopies is TestTransformConvergesRandomly
+// with moves and copies between any two places, which Transform either
+// carries through or rejects with ErrNotTransformable.
+func TestTransformConvergesWithMovesAndCopies(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := map[string]any{
+		"arr": []any{"a", "b", "c", "d"},
+		"m":   map[string]any{"x": "1", "n": map[string]any{"y": "2"}},
+		"l":   []any{map[string]any{"k": "v"}, []any{"e"}},
+	}
+	var rejected int
+	const cases = 10000
+	for i := range cases {
+		a, b := randomPatchOf(rng, base, randomMoveOrCopy), randomPatchOf(rng, base, randomMoveOrCopy)
+		err := checkConverges(base, a, b)
+		if errors.Is(err, ErrNotTransformable) {
+			rejected++
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+	}
+	if rejected > cases/4 {
+		t.Fatalf("%d of %d cases rejected", rejected, cases)
+	}
+}
+
+// checkConverges transforms a and b over each other and checks that
+// applying b then a's rebase and a then b's rebase to base give the same
+// document.
+func checkConverges(base map[string]any, a, b []Operation) error {
+	aAfterB, bAfterA, err := Transform(a, b)
+	if err != nil {
+		return fmt.Errorf("transform %v over %v: %w", a, b, err)
+	}
+	first := deepCopyDoc(base)
+	if err := Apply(first, copyOps(b, aAfterB)); err != nil {
+		return fmt.Errorf("b then rebased a: %v\na: %v\nb: %v\na': %v", err, a, b, aAfterB)
+	}
+	second := deepCopyDoc(base)
+	if err := Apply(second, copyOps(a, bAfterA)); err != nil {
+		return fmt.Errorf("a then rebased b: %v\na: %v\nb: %v\nb': %v", err, a, b, bAfterA)
+	}
+	if !reflect.DeepEqual(first, second) {
+		return fmt.Errorf("documents diverged:\na: %v\nb: %v\na': %v\nb': %v\nb, a': %v\na, b': %v", a, b, aAfterB, bAfterA, first, second)
+	}
+	return nil
+}
+
+// copyOps concatenates patches into deep copies of their operations, so
+// that applying them leaves the originals alone.
+func copyOps(patches ...[]Operation) []Operation {
+	var ops []Operation
+	for _, patch := range patches {
+		for _, op := range patch {
+			ops = append(ops, deepCopyValue(op).(Operation))
+		}
+	}
+	return ops
+}
+
+// randomPatch returns one to four operations that apply to doc in turn.
+// Moves rename an object member to a key the object does not have, or move
+// an array element within its array.
+func randomPatch(rng *rand.Rand, doc map[string]any) []Operation {
+	return randomPatchOf(rng, doc, randomOp)
+}
+
+// randomPatchOf is randomPatch with operations made by newOp.
+func randomPatchOf(rng *rand.Rand, doc map[string]any, newOp func(*rand.Rand, map[string]any) Operation) []Operation {
+	doc = deepCopyDoc(doc)
+	var patch []Operation
+	for range 1 + rng.Intn(4) {
+		op := newOp(rng, doc)
+		if err := Apply(doc, copyOps([]Operation{op})); err != nil {
+			panic(fmt.Sprintf("random op %v does not apply: %v", op, err))
+		}
+		patch = append(patch, op)
+	}
+	return patch
+}
+
+// location is a value in a document, with its pointer.
+type location struct {
+	path  string
+	value any
+}
+
+// documentLocations returns every value in doc, sorted by pointer.
+func documentLocations(doc map[string]any) []location {
+	var locations []location
+	var walk func(path string, v any)
+	walk = func(path string, v any) {
+		locations = append(locations, location{path, v})
+		switch v := v.(type) {
+		case map[string]any:
+			for k, child := range v {
+				walk(path+"/"+k, child)
+			}
+		case []any:
+			for i, child := range v {
+				walk(fmt.Sprintf("%s/%d", path, i), child)
+			}
+		}
+	}
+	walk("", doc)
+	// Map iteration order is random; sort for reproducible cases.
+	slices.SortFunc(locations, func(x, y location) int { return strings.Compare(x.path, y.path) })
+	return locations
+}
+
+// randomMoveOrCopy returns, half the time, a move or copy of any value in
+// doc to any place an add could write, and otherwise, or when it finds
+// none, a randomOp.
+func randomMoveOrCopy(rng *rand.Rand, doc map[string]any) Operation {
+	if rng.Intn(2) == 0 {
+		return randomOp(rng, doc)
+	}
+	locations := documentLocations(doc)
+	keys := []string{"a", "b", "x", "y"}
+	for range 20 {
+		from, to := locations[rng.Intn(len(locations))], locations[rng.Intn(len(locations))]
+		var path string
+		switch v := to.value.(type) {
+		case map[string]any:
+			path = to.path + "/" + keys[rng.Intn(len(keys))]
+		case []any:
+			path = fmt.Sprintf("%s/%d", to.path, rng.Intn(len(v)+1))
+			if rng.Intn(10) == 0 {
+				path = to.path + "/-"
+			}
+		default:
+			continue
+		}
+		op := Operation{"op": "copy", "from": from.path, "path": path}
+		if rng.Intn(2) == 0 {
+			op["op"] = "move"
+		}
+		if from.path == "" || Apply(deepCopyDoc(doc), copyOps([]Operation{op})) != nil {
+			continue
+		}
+		return op
+	}
+	return randomOp(rng, doc)
+}
+
+func randomOp(rng *rand.Rand, doc map[string]any) Operation {
+	locations := documentLocations(doc)
+	keys := []string{"a", "b", "c", "d"}
+	value := func() any {
+		if rng.Intn(4) == 0 {
+			return map[string]any{"a": fmt.Sprint(rng.Intn(10))}
+		}
+		return fmt.Sprint(rng.Intn(10))
+	}
+
+	for {
+		loc := locations[rng.Intn(len(locations))]
+		switch rng.Intn(7) {
+		case 0:
+			if loc.path != "" {
+				return Operation{"op": "replace", "path": loc.path, "value": value()}
+			}
+		case 1:
+			if _, ok := loc.value.(map[string]any); ok {
+				return Operation{"op": "add", "path": loc.path + "/" + keys[rng.Intn(len(keys))], "value": value()}
+			}
+			if arr, ok := loc.value.([]any); ok {
+				return Operation{"op": "add", "path": fmt.Sprintf("%s/%d", loc.path, rng.Intn(len(arr)+1)), "value": value()}
+			}
+		case 2:
+			if loc.path != "" {
+				return Operation{"op": "remove", "path": loc.path}
+			}
+		case 3:
+			obj, ok := loc.value.(map[string]any)
+			if !ok {
+				continue
+			}
+			from := slices.Sorted(maps.Keys(obj))
+			var to []string
+			for _, k := range keys {
+				if _, ok := obj[k]; !ok {
+					to = append(to, k)
+				}
+			}
+			if len(from) == 0 || len(to) == 0 {
+				continue
+			}
+			return Operation{"op": "move", "from": loc.path + "/" + from[rng.Intn(len(from))], "path": loc.path + "/" + to[rng.Intn(len(to))]}
+		case 4:
+			if s, ok := loc.value.(string); ok {
+				return Operation{"op": "str_ins", "path": loc.path, "pos": rng.Intn(len(s) + 1), "str": "+"}
+			}
+		case 5:
+			if s, ok := loc.value.(string); ok && s != "" {
+				pos := rng.Intn(len(s))
+				return Operation{"op": "str_del", "path": loc.path, "pos": pos, "len": 1 + rng.Intn(len(s)-pos)}
+			}
+		case 6:
+			if arr, ok := loc.value.([]any); ok && len(arr) > 0 {
+				return Operation{"op": "move", "from": fmt.Sprintf("%s/%d", loc.path, rng.Intn(len(arr))), "path": fmt.Sprintf("%s/%d", loc.path, rng.Intn(len(arr)))}
+			}
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// Op is one operation of a Patch: Add, Remove, Replace, Move, Copy, Test,
+// Less, More, In, Defined, Undefined, Type, Contains, Starts, Ends, Matches,
+// StrIns, StrDel, Inc or Extend.
+type Op interface {
+	// Operation returns the op in the map form that Apply takes.
+	Operation() Operation
+}
+
+// Patch is a JSON Patch built from typed operations, for callers that would
+// rather not assemble maps by hand:
+//
+//	patch := jsonpatch.Patch{
+//		jsonpatch.Test{Path: "/version", Value: 3},
+//		jsonpatch.Replace{Path: "/title", Value: "Final"},
+//		jsonpatch.StrIns{Path: "/body", Pos: 0, Str: "Hello "},
+//	}
+//	err := patch.Apply(doc)
+//
+// A Patch marshals to the usual JSON array and unmarshals from it, checking
+// that every operation has the members its type needs, with the right
+// types, so malformed patches are rejected at decode time rather than
+// halfway through an apply. Members an operation does not use, such as
+// "id", are dropped; use DecodePatch to keep them.
+type Patch []Op
+
+// Add adds Value at Path, inserting it when Path is an array index.
+type Add struct {
+	Path  string
+	Value any
+}
+
+// Remove removes the value at Path.
+type Remove struct {
+	Path string
+}
+
+// Replace overwrites the value at Path with Value.
+type Replace struct {
+	Path  string
+	Value any
+}
+
+// Move removes the value at From and adds it at Path.
+type Move struct {
+	From, Path string
+}
+
+// Copy adds a copy of the value at From at Path.
+type Copy struct {
+	From, Path string
+}
+
+// Test fails the patch unless the value at Path equals Value.
+type Test struct {
+	Path  string
+	Value any
+}
+
+// Less fails the patch unless the value at Path is less than Value.
+type Less struct {
+	Path  string
+	Value any
+}
+
+// More fails the patch unless the value at Path is greater than Value.
+type More struct {
+	Path  string
+	Value any
+}
+
+// In fails the patch unless the value at Path equals one of Values.
+type In struct {
+	Path   string
+	Values []any
+}
+
+// Defined fails the patch unless Path refers to a value.
+type Defined struct {
+	Path string
+}
+
+// Undefined fails the patch if Path refers to a value.
+type Undefined struct {
+	Path string
+}
+
+// Type fails the patch unless the value at Path has the JSON type Value:
+// "string", "number", "integer", "boolean", "object", "array" or "null".
+type Type struct {
+	Path  string
+	Value string
+}
+
+// Contains fails the patch unless the string at Path contains Value,
+// ignoring case with IgnoreCase.
+type Contains struct {
+	Path       string
+	Value      string
+	IgnoreCase bool
+}
+
+// Starts fails the patch unless the string at Path starts with Value,
+// ignoring case with IgnoreCase.
+type Starts struct {
+	Path       string
+	Value      string
+	IgnoreCase bool
+}
+
+// Ends fails the patch unless the string at Path ends with Value, ignoring
+// case with IgnoreCase.
+type Ends struct {
+	Path       string
+	Value      string
+	IgnoreCase bool
+}
+
+// Matches fails the patch unless the string at Path matches the regular
+// expression Value, in the syntax of package regexp, ignoring case with
+// IgnoreCase.
+type Matches struct {
+	Path       string
+	Value      string
+	IgnoreCase bool
+}
+
+// StrIns inserts Str into the string at Path at position Pos.
+type StrIns struct {
+	Path string
+	Pos  int
+	Str  string
+}
+
+// StrDel deletes from the string at Path, starting at position Pos, either
+// the text Str or, when Str is empty, Len characters.
+type StrDel struct {
+	Path string
+	Pos  int
+	Str  string
+	Len  int
+}
+
+// Inc adds Inc to the number at Path. Int, when not zero, is added
+// instead, exactly, for whole numbers beyond the 2^53 a float64 holds.
+type Inc struct {
+	Path string
+	Inc  float64
+	Int  int64
+}
+
+// Extend sets the members of Props in the object at Path, leaving its
+// other members alone. With DeleteNull, null props delete the member.
+type Extend struct {
+	Path       string
+	Props      map[string]any
+	DeleteNull bool
+}
+
+func (o Add) Operation() Operation {
+	return Operation{"op": "add", "path": o.Path, "value": o.Value}
+}
+
+func (o Remove) Operation() Operation {
+	return Operation{"op": "remove", "path": o.Path}
+}
+
+func (o Replace) Operation() Operation {
+	return Operation{"op": "replace", "path": o.Path, "value": o.Value}
+}
+
+func (o Move) Operation() Operation {
+	return Operation{"op": "move", "from": o.From, "path": o.Path}
+}
+
+func (o Copy) Operation() Operation {
+	return Operation{"op": "copy", "from": o.From, "path": o.Path}
+}
+
+func (o Test) Operation() Operation {
+	return Operation{"op": "test", "path": o.Path, "value": o.Value}
+}
+
+func (o Less) Operation() Operation {
+	return Operation{"op": "less", "path": o.Path, "value": o.Value}
+}
+
+func (o More) Operation() Operation {
+	return Operation{"op": "more", "path": o.Path, "value": o.Value}
+}
+
+func (o In) Operation() Operation {
+	return Operation{"op": "in", "path": o.Path, "value": o.Values}
+}
+
+func (o Defined) Operation() Operation {
+	return Operation{"op": "defined", "path": o.Path}
+}
+
+func (o Undefined) Operation() Operation {
+	return Operation{"op": "undefined", "path": o.Path}
+}
+
+func (o Type) Operation() Operation {
+	return Operation{"op": "type", "path": o.Path, "value": o.Value}
+}
+
+func (o Contains) Operation() Operation {
+	return stringPredicate("contains", o.Path, o.Value, o.IgnoreCase)
+}
+
+func (o Starts) Operation() Operation {
+	return stringPredicate("starts", o.Path, o.Value, o.IgnoreCase)
+}
+
+func (o Ends) Operation() Operation {
+	return stringPredicate("ends", o.Path, o.Value, o.IgnoreCase)
+}
+
+func (o Matches) Operation() Operation {
+	return stringPredicate("matches", o.Path, o.Value, o.IgnoreCase)
+}
+
+func stringPredicate(name, path, value string, ignoreCase bool) Operation {
+	op := Operation{"op": name, "path": path, "value": value}
+	if ignoreCase {
+		op["ignore_case"] = true
+	}
+	return op
+}
+
+func (o StrIns) Operation() Operation {
+	return Operation{"op": "str_ins", "path": o.Path, "pos": o.Pos, "str": o.Str}
+}
+
+func (o StrDel) Operation() Operation {
+	if o.Str != "" {
+		return Operation{"op": "str_del", "path": o.Path, "pos": o.Pos, "str": o.Str}
+	}
+	return Operation{"op": "str_del", "path": o.Path, "pos": o.Pos, "len": o.Len}
+}
+
+func (o Inc) Operation() Operation {
+	if o.Int != 0 {
+		return Operation{"op": "inc", "path": o.Path, "inc": o.Int}
+	}
+	return Operation{"op": "inc", "path": o.Path, "inc": o.Inc}
+}
+
+func (o Extend) Operation() Operation {
+	op := Operation{"op": "extend", "path": o.Path, "props": o.Props}
+	if o.DeleteNull {
+		op["deleteNull"] = true
+	}
+	return op
+}
+
+// Operations returns the patch in the map form that Apply takes.
+func (p Patch) Operations() []Operation {
+	ops := make([]Operation, len(p))
+	for i, op := range p {
+		ops[i] = op.Operation()
+	}
+	return ops
+}
+
+// Apply applies the patch to doc, like Apply.
+func (p Patch) Apply(doc map[string]any) error {
+	return ApplyWithOptions(doc, p.Operations(), Options{})
+}
+
+// ApplyWithOptions applies the patch to doc, like ApplyWithOptions.
+func (p Patch) ApplyWithOptions(doc map[string]any, opts Options) error {
+	return ApplyWithOptions(doc, p.Operations(), opts)
+}
+
+// ApplyValue applies the patch to a document with any root, like
+// ApplyValue.
+func (p Patch) ApplyValue(doc any) (any, error) {
+	return ApplyValueWithOptions(doc, p.Operations(), Options{})
+}
+
+func (p Patch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Operations())
+}
+
+func (p *Patch) UnmarshalJSON(data []byte) error {
+	var ops []Operation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return err
+	}
+	// Numbers decode as float64, which rounds whole increments beyond 2^53,
+	// so those are read again from the text.
+	var incs []struct {
+		Inc json.RawMessage `json:"inc"`
+	}
+	if err := json.Unmarshal(data, &incs); err != nil {
+		return err
+	}
+	patch := make(Patch, len(ops))
+	for i, op := range ops {
+		if n, err := strconv.ParseInt(string(incs[i].Inc), 10, 64); err == nil && op["op"] == "inc" && int64(float64(n)) != n {
+			op["inc"] = json.Number(incs[i].Inc)
+		}
+		var err error
+		if patch[i], err = parseOp(i, op); err != nil {
+			return err
+		}
+	}
+	*p = patch
+	return nil
+}
+
+// parseOp turns the op at index i of a decoded patch into its typed form.
+func parseOp(i int, op Operation) (Op, error) {
+	if op == nil {
+		return nil, &ValidationError{Index: i, Err: errors.New("not an object")}
+	}
+	m := opMembers{index: i, op: op}
+	m.name, _ = op["op"].(string)
+	path := m.pointer("path")
+	var typed Op
+	switch m.name {
+	case "add":
+		typed = Add{Path: path, Value: m.value()}
+	case "remove":
+		typed = Remove{Path: path}
+	case "replace":
+		typed = Replace{Path: path, Value: m.value()}
+	case "move":
+		typed = Move{From: m.pointer("from"), Path: path}
+	case "copy":
+		typed = Copy{From: m.pointer("from"), Path: path}
+	case "test":
+		typed = Test{Path: path, Value: m.value()}
+	case "less":
+		typed = Less{Path: path, Value: m.value()}
+	case "more":
+		typed = More{Path: path, Value: m.value()}
+	case "in":
+		values, ok := m.value().([]any)
+		if _, present := op["value"]; present && !ok {
+			m.fail("value", "%q must be an array", "value")
+		}
+		typed = In{Path: path, Values: values}
+	case "defined":
+		typed = Defined{Path: path}
+	case "undefined":
+		typed = Undefined{Path: path}
+	case "type":
+		name := m.string("value")
+		if _, ok := op["value"].(string); ok && !isJSONType(name) {
+			m.fail("value", "%q must name a JSON type", "value")
+		}
+		typed = Type{Path: path, Value: name}
+	case "contains", "starts", "ends", "matches":
+		value := m.string("value")
+		ignoreCase, ok := op["ignore_case"].(bool)
+		if _, present := op["ignore_case"]; present && !ok {
+			m.fail("ignore_case", "%q must be a boolean", "ignore_case")
+		}
+		if m.name == "matches" {
+			if _, err := regexp.Compile(value); err != nil {
+				m.fail("value", "%q is not a valid regular expression: %v", "value", err)
+			}
+		}
+		switch m.name {
+		case "contains":
+			typed = Contains{Path: path, Value: value, IgnoreCase: ignoreCase}
+		case "starts":
+			typed = Starts{Path: path, Value: value, IgnoreCase: ignoreCase}
+		case "ends":
+			typed = Ends{Path: path, Value: value, IgnoreCase: ignoreCase}
+		default:
+			typed = Matches{Path: path, Value: value, IgnoreCase: ignoreCase}
+		}
+	case "str_ins":
+		typed = StrIns{Path: path, Pos: m.position("pos"), Str: m.string("str")}
+	case "str_del":
+		del := StrDel{Path: path, Pos: m.position("pos")}
+		if _, ok := op["str"]; ok {
+			del.Str = m.string("str")
+		} else {
+			del.Len = m.position("len")
+		}
+		typed = del
+	case "inc":
+		inc, ok := getNumericValue(op["inc"])
+		if !ok {
+			m.fail("inc", "%q must be a number", "inc")
+		}
+		if _, isFloat := op["inc"].(float64); !isFloat {
+			if n, ok := getIntegerValue(op["inc"]); ok {
+				typed = Inc{Path: path, Int: n}
+				break
+			}
+		}
+		typed = Inc{Path: path, Inc: inc}
+	case "extend":
+		props, ok := op["props"].(map[string]any)
+		if !ok {
+			m.fail("props", "%q must be an object", "props")
+		}
+		deleteNull, ok := op["deleteNull"].(bool)
+		if _, present := op["deleteNull"]; present && !ok {
+			m.fail("deleteNull", "%q must be a boolean", "deleteNull")
+		}
+		typed = Extend{Path: path, Props: props, DeleteNull: deleteNull}
+	default:
+		return nil, &ValidationError{Index: i, Op: m.name, Member: "op", Err: fmt.Errorf("unknown type %q", m.name)}
+	}
+	return typed, errors.Join(m.errs...)
+}
+
+// opMembers reads the members of a decoded op, keeping every problem
+// found.
+type opMembers struct {
+	index int
+	name  string
+	op    Operation
+	errs  []error
+}
+
+func (m *opMembers) fail(member, format string, args ...any) {
+	m.errs = append(m.errs, &ValidationError{Index: m.index, Op: m.name, Member: member, Err: fmt.Errorf(format, args...)})
+}
+
+func (m *opMembers) string(member string) string {
+	s, ok := m.op[member].(string)
+	if !ok {
+		m.fail(member, "%q must be a string", member)
+	}
+	return s
+}
+
+func (m *opMembers) pointer(member string) string {
+	s := m.string(member)
+	if _, err := splitPointer(s); err != nil {
+		m.fail(member, "%q is not a valid JSON Pointer: %w", member, err)
+	}
+	return s
+}
+
+func (m *opMembers) value() any {
+	v, ok := m.op["value"]
+	if !ok {
+		m.fail("value", "%q is missing", "value")
+	}
+	return v
+}
+
+func (m *opMembers) position(member string) int {
+	n, ok := getNumericValue(m.op[member])
+	if !ok || n < 0 || n != math.Trunc(n) || n > math.MaxInt32 {
+		m.fail(member, "%q must be a non-negative integer", member)
+		return 0
+	}
+	return int(n)
+}
@@ -0,0 +1,151 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPatchApply(t *testing.T) {
+	doc := map[string]any{"title": "Draft", "body": "world", "views": float64(1), "tags": []any{"a"}}
+	patch := Patch{
+		Test{Path: "/title", Value: "Draft"},
+		Replace{Path: "/title", Value: "Final"},
+		StrIns{Path: "/body", Pos: 0, Str: "hello "},
+		StrDel{Path: "/body", Pos: 5, Len: 1},
+		Inc{Path: "/views", Inc: 2},
+		Add{Path: "/tags/-", Value: "b"},
+		Copy{From: "/tags/0", Path: "/first"},
+		Move{From: "/first", Path: "/primary"},
+		Remove{Path: "/tags/0"},
+		Less{Path: "/views", Value: 10},
+		More{Path: "/views", Value: 0},
+		Defined{Path: "/primary"},
+		Undefined{Path: "/tags/1"},
+		Type{Path: "/views", Value: "integer"},
+		In{Path: "/views", Values: []any{1, 3}},
+		Contains{Path: "/title", Value: "ina"},
+		Starts{Path: "/title", Value: "fi", IgnoreCase: true},
+		Ends{Path: "/title", Value: "l"},
+		Matches{Path: "/title", Value: "^F.n"},
+		Extend{Path: "", Props: map[string]any{"body": nil, "draft": false}, DeleteNull: true},
+	}
+	if err := patch.Apply(doc); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	expected := map[string]any{"title": "Final", "views": 3, "tags": []any{"b"}, "primary": "a", "draft": false}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Fatalf("Documents not equal.\nGot: %v\nExpected: %v", doc, expected)
+	}
+}
+
+func TestPatchJSON(t *testing.T) {
+	src := `[
+		{"op": "add", "path": "/a", "value": {"b": [1]}},
+		{"op": "remove", "path": "/a/b/0"},
+		{"op": "replace", "path": "/c", "value": null},
+		{"op": "move", "from": "/a", "path": "/d"},
+		{"op": "copy", "from": "/d", "path": "/e"},
+		{"op": "test", "path": "/e", "value": {"b": []}},
+		{"op": "str_ins", "path": "/s", "pos": 1, "str": "x"},
+		{"op": "str_del", "path": "/s", "pos": 0, "str": "a"},
+		{"op": "str_del", "path": "/s", "pos": 0, "len": 2},
+		{"op": "inc", "path": "/n", "inc": -1.5, "id": "dropped"},
+		{"op": "extend", "path": "/a", "props": {"x": null}, "deleteNull": true},
+		{"op": "defined", "path": "/a"},
+		{"op": "undefined", "path": "/a/x"},
+		{"op": "type", "path": "/a", "value": "object"},
+		{"op": "in", "path": "/a", "value": [1, "x"]},
+		{"op": "matches", "path": "/s", "value": "^a", "ignore_case": true}
+	]`
+	var patch Patch
+	if err := json.Unmarshal([]byte(src), &patch); err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+	expected := Patch{
+		Add{Path: "/a", Value: map[string]any{"b": []any{float64(1)}}},
+		Remove{Path: "/a/b/0"},
+		Replace{Path: "/c"},
+		Move{From: "/a", Path: "/d"},
+		Copy{From: "/d", Path: "/e"},
+		Test{Path: "/e", Value: map[string]any{"b": []any{}}},
+		StrIns{Path: "/s", Pos: 1, Str: "x"},
+		StrDel{Path: "/s", Str: "a"},
+		StrDel{Path: "/s", Len: 2},
+		Inc{Path: "/n", Inc: -1.5},
+		Extend{Path: "/a", Props: map[string]any{"x": nil}, DeleteNull: true},
+		Defined{Path: "/a"},
+		Undefined{Path: "/a/x"},
+		Type{Path: "/a", Value: "object"},
+		In{Path: "/a", Values: []any{float64(1), "x"}},
+		Matches{Path: "/s", Value: "^a", IgnoreCase: true},
+	}
+	if !reflect.DeepEqual(patch, expected) {
+		t.Fatalf("Patches not equal.\nGot: %#v\nExpected: %#v", patch, expected)
+	}
+
+	// Marshaling and decoding again gives the same patch.
+	data, err := json.Marshal(patch)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	var again Patch
+	if err := json.Unmarshal(data, &again); err != nil || !reflect.DeepEqual(again, patch) {
+		t.Fatalf("round trip changed the patch: %s (%v)", data, err)
+	}
+}
+
+func TestPatchIncPrecision(t *testing.T) {
+	var patch Patch
+	if err := json.Unmarshal([]byte(`[{"op": "inc", "path": "/n", "inc": 9007199254740993}]`), &patch); err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+	if expected := (Patch{Inc{Path: "/n", Int: 9007199254740993}}); !reflect.DeepEqual(patch, expected) {
+		t.Fatalf("Patches not equal.\nGot: %#v\nExpected: %#v", patch, expected)
+	}
+	data, err := json.Marshal(patch)
+	if err != nil || !strings.Contains(string(data), `"inc":9007199254740993`) {
+		t.Fatalf("expected the increment to marshal exactly, got %s (%v)", data, err)
+	}
+	doc := map[string]any{"n": json.Number("1")}
+	if err := patch.Apply(doc); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if n, _ := getIntegerValue(doc["n"]); n != 9007199254740994 {
+		t.Fatalf("expected 9007199254740994, got %v", doc["n"])
+	}
+}
+
+func TestPatchUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		src           string
+		expectedError string
+	}{
+		{"unknown op", `[{"op": "frobnicate", "path": "/a"}]`, `op 0 has unknown type "frobnicate"`},
+		{"missing op", `[{"path": "/a"}]`, `op 0 has unknown type ""`},
+		{"missing value", `[{"op": "test", "path": "/a"}, {"op": "add", "path": "/a"}]`, `op 0 ("test"): "value" is missing`},
+		{"path type", `[{"op": "remove", "path": 1}]`, `op 0 ("remove"): "path" must be a string`},
+		{"bad pointer", `[{"op": "remove", "path": "/a~2"}]`, `"path" is not a valid JSON Pointer`},
+		{"missing from", `[{"op": "move", "path": "/a"}]`, `"from" must be a string`},
+		{"negative pos", `[{"op": "str_ins", "path": "/s", "pos": -1, "str": "x"}]`, `"pos" must be a non-negative integer`},
+		{"fractional len", `[{"op": "str_del", "path": "/s", "pos": 0, "len": 1.5}]`, `"len" must be a non-negative integer`},
+		{"inc type", `[{"op": "remove", "path": "/a"}, {"op": "inc", "path": "/n", "inc": "1"}]`, `op 1 ("inc"): "inc" must be a number`},
+		{"unknown type", `[{"op": "type", "path": "/a", "value": "text"}]`, `"value" must name a JSON type`},
+		{"in not an array", `[{"op": "in", "path": "/a", "value": 1}]`, `"value" must be an array`},
+		{"bad regexp", `[{"op": "matches", "path": "/a", "value": "("}]`, `"value" is not a valid regular expression`},
+		{"extend props", `[{"op": "extend", "path": "/a", "props": [1]}]`, `"props" must be an object`},
+		{"extend deleteNull", `[{"op": "extend", "path": "/a", "props": {}, "deleteNull": 1}]`, `"deleteNull" must be a boolean`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch Patch
+			err := json.Unmarshal([]byte(tt.src), &patch)
+			if !errors.Is(err, ErrInvalidOperation) || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Fatalf("expected ErrInvalidOperation containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Validate checks operations without a document: that every operation has
+// a known type, the members its type needs with the right types, and paths
+// and from pointers that are valid JSON Pointers. It does the checks
+// Patch.UnmarshalJSON and Compile do, for rejecting a malformed patch
+// before anything is read or written. Operations that pass can still fail
+// to apply, for instance when a path does not exist in the document.
+//
+// The error joins a *ValidationError for every problem, each wrapping
+// ErrInvalidOperation and naming the operation's index and the member at
+// fault, so that all the problems are reported at once. Validate returns
+// nil if there are none.
+func Validate(operations []Operation) error {
+	var errs []error
+	for i, op := range operations {
+		if _, err := parseOp(i, op); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateAs returns a hook for Options.ValidateDocument that decodes the
+// patched document into a new T with encoding/json and passes a *T to
+// check. A document that does not decode into T is invalid too.
+//
+// check fits the Struct method of a struct-tag validator, so that
+// invariants declared on a Go type are enforced at the patch boundary:
+//
+//	v := validator.New()
+//	err := jsonpatch.ApplyWithOptions(doc, ops, jsonpatch.Options{
+//		Atomic:           true,
+//		ValidateDocument: jsonpatch.ValidateAs[Profile](v.Struct),
+//	})
+//
+// The error check returns stays in the chain, so field-level errors can be
+// recovered with errors.As.
+func ValidateAs[T any](check func(any) error) func(doc any) error {
+	return func(doc any) error {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		v := new(T)
+		if err := json.Unmarshal(data, v); err != nil {
+			return err
+		}
+		if check == nil {
+			return nil
+		}
+		return check(v)
+	}
+}
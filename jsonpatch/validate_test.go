@@ -0,0 +1,72 @@
+package jsonpatch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name           string
+		ops            []Operation
+		expectedErrors []string
+	}{
+		{"valid", []Operation{
+			{"op": "add", "path": "/a", "value": 1},
+			{"op": "move", "from": "/a", "path": "/b"},
+			{"op": "str_del", "path": "/s", "pos": 0, "len": 2},
+			{"op": "extend", "path": "", "props": map[string]any{"x": nil}},
+		}, nil},
+		{"empty", []Operation{}, nil},
+		{"unknown op", []Operation{{"op": "frobnicate", "path": "/a"}}, []string{`op 0 has unknown type "frobnicate"`}},
+		{"missing value", []Operation{{"op": "test", "path": "/a"}}, []string{`op 0 ("test"): "value" is missing`}},
+		{"bad pointer", []Operation{{"op": "remove", "path": "/a~2"}}, []string{`op 0 ("remove"): "path" is not a valid JSON Pointer`}},
+		{"parameter type", []Operation{{"op": "inc", "path": "/n", "inc": "1"}}, []string{`op 0 ("inc"): "inc" must be a number`}},
+		{"every malformed op", []Operation{
+			{"op": "copy", "path": "/a"},
+			{"op": "add", "path": "/a", "value": nil},
+			{"op": "str_ins", "path": "/s", "pos": -1, "str": "x"},
+		}, []string{`op 0 ("copy"): "from" must be a string`, `op 2 ("str_ins"): "pos" must be a non-negative integer`}},
+		{"every problem of an op", []Operation{{"op": "str_ins", "path": "/a~2", "pos": "1"}}, []string{
+			`op 0 ("str_ins"): "path" is not a valid JSON Pointer`,
+			`op 0 ("str_ins"): "pos" must be a non-negative integer`,
+			`op 0 ("str_ins"): "str" must be a string`,
+		}},
+		{"not an object", []Operation{nil}, []string{`op 0 is not an object`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.ops)
+			if tt.expectedErrors == nil {
+				if err != nil {
+					t.Fatalf("Validate returned error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidOperation) {
+				t.Fatalf("expected ErrInvalidOperation, got %v", err)
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.expectedErrors) {
+				t.Fatalf("expected %d errors, got %q", len(tt.expectedErrors), lines)
+			}
+			for i, expected := range tt.expectedErrors {
+				if !strings.Contains(lines[i], expected) {
+					t.Fatalf("expected error %d to contain %q, got %q", i, expected, lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateErrorMembers(t *testing.T) {
+	err := Validate([]Operation{{"op": "add", "path": "/a"}, {"op": "bogus"}})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a *ValidationError, got %v", err)
+	}
+	if validationErr.Index != 0 || validationErr.Op != "add" || validationErr.Member != "value" {
+		t.Errorf("unexpected error %+v", validationErr)
+	}
+}
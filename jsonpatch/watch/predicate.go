@@ -0,0 +1,245 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+// predicate is a parsed filter expression, evaluated against one operation.
+//
+// The grammar is:
+//
+//	expr  = and { "||" and }
+//	and   = unary { "&&" unary }
+//	unary = "!" unary | "(" expr ")" | field [ cmp literal ]
+//	cmp   = "==" | "!=" | "<" | "<=" | ">" | ">="
+//
+// A field names a member of the operation, such as op, path or value, and
+// may descend into object values with dots, as in value.status. Literals are
+// JSON strings, numbers, true, false and null. A field alone is true when its
+// value is true.
+type predicate func(op jsonpatch.Operation) bool
+
+func parsePredicate(src string) (predicate, error) {
+	if strings.TrimSpace(src) == "" {
+		return func(jsonpatch.Operation) bool { return true }, nil
+	}
+	p := &predicateParser{src: src}
+	p.next()
+	pred, err := p.expr()
+	if err == nil && p.tok != "" {
+		err = fmt.Errorf("unexpected %q", p.tok)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid predicate %q: %w", src, err)
+	}
+	return pred, nil
+}
+
+type predicateParser struct {
+	src string
+	pos int
+	tok string // current token, "" at the end
+}
+
+// next advances to the next token.
+func (p *predicateParser) next() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+	start := p.pos
+	if start == len(p.src) {
+		p.tok = ""
+		return
+	}
+	switch c := p.src[start]; {
+	case c == '"':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		p.pos = min(p.pos+1, len(p.src))
+	case strings.HasPrefix(p.src[start:], "&&"), strings.HasPrefix(p.src[start:], "||"),
+		strings.HasPrefix(p.src[start:], "=="), strings.HasPrefix(p.src[start:], "!="),
+		strings.HasPrefix(p.src[start:], "<="), strings.HasPrefix(p.src[start:], ">="):
+		p.pos += 2
+	case strings.ContainsRune("!()<>", rune(c)):
+		p.pos++
+	default:
+		for p.pos < len(p.src) && isWordChar(rune(p.src[p.pos])) {
+			p.pos++
+		}
+		if p.pos == start {
+			p.pos++
+		}
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-+", r)
+}
+
+func (p *predicateParser) expr() (predicate, error) {
+	left, err := p.and()
+	for err == nil && p.tok == "||" {
+		p.next()
+		var right predicate
+		if right, err = p.and(); err == nil {
+			l := left
+			left = func(op jsonpatch.Operation) bool { return l(op) || right(op) }
+		}
+	}
+	return left, err
+}
+
+func (p *predicateParser) and() (predicate, error) {
+	left, err := p.unary()
+	for err == nil && p.tok == "&&" {
+		p.next()
+		var right predicate
+		if right, err = p.unary(); err == nil {
+			l := left
+			left = func(op jsonpatch.Operation) bool { return l(op) && right(op) }
+		}
+	}
+	return left, err
+}
+
+func (p *predicateParser) unary() (predicate, error) {
+	switch {
+	case p.tok == "!":
+		p.next()
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(op jsonpatch.Operation) bool { return !inner(op) }, nil
+	case p.tok == "(":
+		p.next()
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("expected \")\" at offset %d", p.pos)
+		}
+		p.next()
+		return inner, nil
+	case p.tok == "" || !unicode.IsLetter(rune(p.tok[0])):
+		return nil, fmt.Errorf("expected a field at offset %d", p.pos-len(p.tok))
+	}
+	field := strings.Split(p.tok, ".")
+	p.next()
+	cmp := p.tok
+	switch cmp {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return func(op jsonpatch.Operation) bool { return fieldValue(op, field) == true }, nil
+	}
+	p.next()
+	var literal any
+	if err := json.Unmarshal([]byte(p.tok), &literal); err != nil || p.tok == "" {
+		return nil, fmt.Errorf("expected a literal after %q, got %q", cmp, p.tok)
+	}
+	p.next()
+	return func(op jsonpatch.Operation) bool { return compare(fieldValue(op, field), cmp, literal) }, nil
+}
+
+// fieldValue returns the member of op named by field, or nil.
+func fieldValue(op jsonpatch.Operation, field []string) any {
+	var current any = map[string]any(op)
+	for _, name := range field {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = m[name]
+	}
+	return current
+}
+
+func compare(value any, cmp string, literal any) bool {
+	switch cmp {
+	case "==":
+		return equal(value, literal)
+	case "!=":
+		return !equal(value, literal)
+	}
+	var order int
+	if a, ok := number(value); ok {
+		b, ok := number(literal)
+		if !ok {
+			return false
+		}
+		order = compareOrdered(a, b)
+	} else if a, ok := value.(string); ok {
+		b, ok := literal.(string)
+		if !ok {
+			return false
+		}
+		order = strings.Compare(a, b)
+	} else {
+		return false
+	}
+	switch cmp {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
+
+func compareOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	switch a.(type) {
+	case map[string]any, []any:
+		return false
+	}
+	return a == b
+}
+
+// number converts the numeric types found in decoded and hand-built
+// operations to float64.
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,226 @@
+package watch
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/jsonpointer"
+)
+
+// Router decides which subscribers a patch is delivered to from the paths
+// its operations write, without looking at the document, which keeps fan-out
+// cheap with many subscribers. Subscriptions are indexed by pattern, so
+// routing an operation costs a walk down the index rather than a check of
+// every subscription.
+//
+// A subscription matches an operation that writes at, inside, or around a
+// path matching its pattern, or that shifts the array elements it watches,
+// and whose fields satisfy its predicate. Matching is conservative: an
+// operation that leaves the watched values equal, such as a replace with the
+// same value, is still delivered. It is safe for concurrent use.
+type Router struct {
+	mu   sync.RWMutex
+	root *routeNode
+	// subs maps each subscriber to its routes, for Remove.
+	subs map[string][]*route
+}
+
+type route struct {
+	subscriber string
+	pattern    []string
+	match      predicate
+}
+
+type routeNode struct {
+	children map[string]*routeNode
+	routes   []*route // patterns ending here
+}
+
+// NewRouter returns a router without subscriptions.
+func NewRouter() *Router {
+	return &Router{root: &routeNode{}, subs: map[string][]*route{}}
+}
+
+// Add subscribes subscriber to the operations writing to paths that match
+// pattern and satisfy predicate. A subscriber may add several subscriptions
+// and receives a patch if any of them matches.
+//
+// The predicate is an expression over the operation's members, such as
+// `op == "replace" && value.status == "done"` or `inc > 0`: comparisons of
+// a member with a JSON literal, combined with &&, || and !, and grouped with
+// parentheses. Members of object values are reached with dots. An empty
+// predicate matches every operation.
+func (r *Router) Add(subscriber, pattern, predicate string) error {
+	segments, err := jsonpointer.Parse(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	match, err := parsePredicate(predicate)
+	if err != nil {
+		return err
+	}
+	rt := &route{subscriber: subscriber, pattern: segments, match: match}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	node := r.root
+	for _, segment := range segments {
+		child, ok := node.children[segment]
+		if !ok {
+			if node.children == nil {
+				node.children = map[string]*routeNode{}
+			}
+			child = &routeNode{}
+			node.children[segment] = child
+		}
+		node = child
+	}
+	node.routes = append(node.routes, rt)
+	r.subs[subscriber] = append(r.subs[subscriber], rt)
+	return nil
+}
+
+// Remove drops every subscription of subscriber.
+func (r *Router) Remove(subscriber string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rt := range r.subs[subscriber] {
+		r.remove(rt)
+	}
+	delete(r.subs, subscriber)
+}
+
+func (r *Router) remove(rt *route) {
+	nodes := []*routeNode{r.root}
+	for _, segment := range rt.pattern {
+		nodes = append(nodes, nodes[len(nodes)-1].children[segment])
+	}
+	node := nodes[len(nodes)-1]
+	for i, other := range node.routes {
+		if other == rt {
+			node.routes = append(node.routes[:i:i], node.routes[i+1:]...)
+			break
+		}
+	}
+	// Prune the branches left empty.
+	for i := len(nodes) - 1; i > 0; i-- {
+		if len(nodes[i].routes) > 0 || len(nodes[i].children) > 0 {
+			break
+		}
+		delete(nodes[i-1].children, rt.pattern[i-1])
+	}
+}
+
+// Route returns the subscribers patch is delivered to, sorted.
+func (r *Router) Route(patch []jsonpatch.Operation) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	matched := map[string]bool{}
+	for _, op := range patch {
+		for _, w := range writes(op) {
+			r.root.collect(w.path, 0, w.shift, func(rt *route) {
+				if !matched[rt.subscriber] && rt.match(op) {
+					matched[rt.subscriber] = true
+				}
+			})
+		}
+	}
+	subscribers := make([]string, 0, len(matched))
+	for s := range matched {
+		subscribers = append(subscribers, s)
+	}
+	sort.Strings(subscribers)
+	return subscribers
+}
+
+// write is a path an operation writes to. When the operation inserts or
+// removes an array element, shift is the first index of the elements it
+// moves, and -1 otherwise.
+type write struct {
+	path  []string
+	shift int
+}
+
+// writes returns the paths op writes to. Tests, including less and more,
+// write nothing, and malformed operations are left for ApplyValue to reject.
+func writes(op jsonpatch.Operation) []write {
+	var out []write
+	add := func(key string, shifts bool) {
+		raw, ok := op[key].(string)
+		if !ok {
+			return
+		}
+		if raw != "" && !strings.HasPrefix(raw, "/") {
+			raw = "/" + raw
+		}
+		path, err := jsonpointer.Parse(raw)
+		if err != nil {
+			return
+		}
+		w := write{path: path, shift: -1}
+		if n := len(path); shifts && n > 0 {
+			if path[n-1] == "-" {
+				// The end index is unknown without the document.
+				w.shift = 0
+			} else if i, err := strconv.Atoi(path[n-1]); err == nil && i >= 0 {
+				w.shift = i
+			}
+		}
+		out = append(out, w)
+	}
+	switch op["op"] {
+	case "test", "less", "more", "in", "defined", "undefined", "type", "contains", "starts", "ends", "matches":
+	case "add", "copy", "remove":
+		add("path", true)
+	case "move":
+		add("from", true)
+		add("path", true)
+	default:
+		add("path", false)
+	}
+	return out
+}
+
+// collect visits the routes affected by a write at path, from the node for
+// path[:i].
+func (n *routeNode) collect(path []string, i, shift int, visit func(*route)) {
+	// The write is inside the values watched here.
+	for _, rt := range n.routes {
+		visit(rt)
+	}
+	if i == len(path) {
+		// The write replaces everything watched below.
+		for _, child := range n.children {
+			child.all(visit)
+		}
+		return
+	}
+	if i == len(path)-1 && shift >= 0 {
+		// Elements from shift on move to other indices.
+		for segment, child := range n.children {
+			if j, err := strconv.Atoi(segment); segment == "*" || (err == nil && j >= shift) {
+				child.all(visit)
+			}
+		}
+	}
+	if child, ok := n.children[path[i]]; ok {
+		child.collect(path, i+1, shift, visit)
+	}
+	if child, ok := n.children["*"]; ok && path[i] != "*" {
+		child.collect(path, i+1, shift, visit)
+	}
+}
+
+// all visits every route at or below n.
+func (n *routeNode) all(visit func(*route)) {
+	for _, rt := range n.routes {
+		visit(rt)
+	}
+	for _, child := range n.children {
+		child.all(visit)
+	}
+}
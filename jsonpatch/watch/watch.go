@@ -0,0 +1,327 @@
+// Package watch notifies subscribers when applied patches change the values
+// at paths they care about.
+//
+// Patterns are JSON Pointers in which a "*" segment matches any single key or
+// index, such as "/users/*/status". A subscription is notified when an
+// operation touches a matching path, a value inside one, or a container
+// holding one, with the old and new value at each matching path whose value
+// changed and the operation that changed it. This replaces diffing whole
+// documents after every apply.
+//
+// A Router uses the same patterns on a sync server, where it decides from a
+// patch alone which of many subscribers to deliver it to.
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+	"github.com/flitsinc/go-jsonpatch/jsonpatch/jsonpointer"
+)
+
+// Change describes how one operation changed the value at a watched path.
+type Change struct {
+	// Path is the concrete pointer that matched the pattern.
+	Path string
+	// Old and New are the values before and after the operation. OldExists
+	// and NewExists are false when the path was absent, such as for an add
+	// to a new key or a remove.
+	Old, New             any
+	OldExists, NewExists bool
+	// Op is the operation that caused the change.
+	Op jsonpatch.Operation
+}
+
+// Watcher applies patches and notifies the subscriptions they affect. It is
+// safe for concurrent use, though concurrent Apply calls must not share a
+// document.
+type Watcher struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]subscription
+}
+
+type subscription struct {
+	id      int
+	pattern []string
+	notify  func(Change)
+}
+
+// New returns a Watcher without subscriptions.
+func New() *Watcher {
+	return &Watcher{subs: map[int]subscription{}}
+}
+
+// Subscribe registers notify for changes at paths matching pattern and
+// returns a function that cancels the subscription. notify is called
+// synchronously by Apply.
+func (w *Watcher) Subscribe(pattern string, notify func(Change)) (func(), error) {
+	segments, err := jsonpointer.Parse(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := w.next
+	w.next++
+	w.subs[id] = subscription{id: id, pattern: segments, notify: notify}
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subs, id)
+	}, nil
+}
+
+// watchKey identifies a concrete path watched by one subscription.
+type watchKey struct {
+	sub  int
+	path string
+}
+
+type watchedValue struct {
+	sub    subscription
+	path   []string
+	old    any
+	exists bool
+}
+
+// Apply applies patch to doc like jsonpatch.ApplyValue and then notifies the
+// affected subscriptions in operation order. Nothing is notified when the
+// patch fails. The document may be modified in place.
+func (w *Watcher) Apply(doc any, patch []jsonpatch.Operation) (any, error) {
+	subs := w.subscriptions()
+	if len(subs) == 0 {
+		return jsonpatch.ApplyValue(doc, patch)
+	}
+
+	type pending struct {
+		notify func(Change)
+		change Change
+	}
+	var changes []pending
+	for i, op := range patch {
+		touched := touchedPaths(doc, op)
+
+		// Values at watched paths the operation may change are recorded
+		// before it is applied, since the document is modified in place.
+		var keys []watchKey
+		watched := map[watchKey]watchedValue{}
+		for _, sub := range subs {
+			for _, path := range candidates(doc, sub.pattern, touched) {
+				key := watchKey{sub.id, jsonpointer.Format(path)}
+				value, exists := lookup(doc, path)
+				watched[key] = watchedValue{sub, path, clone(value), exists}
+				keys = append(keys, key)
+			}
+		}
+
+		var err error
+		if doc, err = jsonpatch.ApplyValue(doc, []jsonpatch.Operation{op}); err != nil {
+			// Report the operation's index in patch, not in the one-op patch.
+			var opErr *jsonpatch.OpError
+			if errors.As(err, &opErr) {
+				opErr.Index = i
+			}
+			return doc, err
+		}
+
+		// The operation may also have created matching paths.
+		for _, sub := range subs {
+			for _, path := range candidates(doc, sub.pattern, touched) {
+				key := watchKey{sub.id, jsonpointer.Format(path)}
+				if _, seen := watched[key]; !seen {
+					watched[key] = watchedValue{sub: sub, path: path}
+					keys = append(keys, key)
+				}
+			}
+		}
+
+		for _, key := range keys {
+			before := watched[key]
+			value, exists := lookup(doc, before.path)
+			if exists == before.exists && reflect.DeepEqual(value, before.old) {
+				continue
+			}
+			changes = append(changes, pending{before.sub.notify, Change{
+				Path: key.path, Old: before.old, New: clone(value),
+				OldExists: before.exists, NewExists: exists, Op: op,
+			}})
+		}
+	}
+	for _, c := range changes {
+		c.notify(c.change)
+	}
+	return doc, nil
+}
+
+// subscriptions returns the current subscriptions in the order they were
+// made.
+func (w *Watcher) subscriptions() []subscription {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	subs := make([]subscription, 0, len(w.subs))
+	for _, sub := range w.subs {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].id < subs[j].id })
+	return subs
+}
+
+// touchedPaths returns the paths op writes to: its path, and its source for
+// a move. An append index ("-") is resolved against doc. Malformed operations
+// touch nothing and are left for ApplyValue to reject.
+func touchedPaths(doc any, op jsonpatch.Operation) [][]string {
+	var touched [][]string
+	keys := []string{"path"}
+	if op["op"] == "move" {
+		keys = append(keys, "from")
+	}
+	for _, key := range keys {
+		raw, ok := op[key].(string)
+		if !ok {
+			continue
+		}
+		if raw != "" && !strings.HasPrefix(raw, "/") {
+			// ApplyValue resolves such paths from the root.
+			raw = "/" + raw
+		}
+		path, err := jsonpointer.Parse(raw)
+		if err != nil {
+			continue
+		}
+		if n := len(path); n > 0 && path[n-1] == "-" {
+			if arr, ok := lookupArray(doc, path[:n-1]); ok {
+				path[n-1] = strconv.Itoa(len(arr))
+			}
+		}
+		touched = append(touched, path)
+	}
+	return touched
+}
+
+// candidates returns the concrete paths matching pattern whose values may
+// change when the touched paths are written: a matching ancestor of a touched
+// path, or every matching path in doc below one.
+func candidates(doc any, pattern []string, touched [][]string) [][]string {
+	var paths [][]string
+	seen := map[string]bool{}
+	add := func(path []string) {
+		if key := jsonpointer.Format(path); !seen[key] {
+			seen[key] = true
+			paths = append(paths, path)
+		}
+	}
+	for _, t := range touched {
+		if len(t) >= len(pattern) {
+			if matches(pattern, t[:len(pattern)]) {
+				add(t[:len(pattern)])
+			}
+		} else if matches(pattern[:len(t)], t) {
+			expand(doc, t, pattern[len(t):], add)
+		}
+	}
+	return paths
+}
+
+// expand calls add with every path in doc below prefix that matches rest.
+func expand(doc any, prefix, rest []string, add func([]string)) {
+	value, ok := lookup(doc, prefix)
+	if !ok {
+		return
+	}
+	if len(rest) == 0 {
+		add(prefix)
+		return
+	}
+	child := func(segment string) {
+		expand(doc, append(append([]string{}, prefix...), segment), rest[1:], add)
+	}
+	if rest[0] != "*" {
+		child(rest[0])
+		return
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child(k)
+		}
+	case []any:
+		for i := range v {
+			child(strconv.Itoa(i))
+		}
+	}
+}
+
+func matches(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i, segment := range pattern {
+		if segment != "*" && segment != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func lookup(doc any, path []string) (any, bool) {
+	current := doc
+	for _, segment := range path {
+		switch v := current.(type) {
+		case map[string]any:
+			child, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			current = child
+		case []any:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) || strconv.Itoa(i) != segment {
+				return nil, false
+			}
+			current = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func lookupArray(doc any, path []string) ([]any, bool) {
+	value, ok := lookup(doc, path)
+	if !ok {
+		return nil, false
+	}
+	arr, ok := value.([]any)
+	return arr, ok
+}
+
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, child := range v {
+			m[k] = clone(child)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, child := range v {
+			s[i] = clone(child)
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -0,0 +1,244 @@
+package watch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flitsinc/go-jsonpatch/jsonpatch"
+)
+
+func newDoc() map[string]any {
+	return map[string]any{
+		"users": map[string]any{
+			"ann": map[string]any{"status": "online", "name": "Ann"},
+			"bob": map[string]any{"status": "away", "name": "Bob"},
+		},
+		"list": []any{"a", "b"},
+	}
+}
+
+func TestWatcherNotifies(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		patch    []jsonpatch.Operation
+		expected []Change
+	}{
+		{
+			name:    "matching path",
+			pattern: "/users/*/status",
+			patch:   []jsonpatch.Operation{{"op": "replace", "path": "/users/ann/status", "value": "away"}},
+			expected: []Change{
+				{Path: "/users/ann/status", Old: "online", New: "away", OldExists: true, NewExists: true},
+			},
+		},
+		{
+			name:     "other paths are ignored",
+			pattern:  "/users/*/status",
+			patch:    []jsonpatch.Operation{{"op": "replace", "path": "/users/ann/name", "value": "Anne"}},
+			expected: nil,
+		},
+		{
+			name:     "unchanged value is ignored",
+			pattern:  "/users/*/status",
+			patch:    []jsonpatch.Operation{{"op": "replace", "path": "/users/bob/status", "value": "away"}},
+			expected: nil,
+		},
+		{
+			name:    "edit inside a matching value",
+			pattern: "/users/*/status",
+			patch:   []jsonpatch.Operation{{"op": "str_ins", "path": "/users/bob/status", "pos": 4, "str": "!"}},
+			expected: []Change{
+				{Path: "/users/bob/status", Old: "away", New: "away!", OldExists: true, NewExists: true},
+			},
+		},
+		{
+			name:    "container holding matching paths",
+			pattern: "/users/*/status",
+			patch: []jsonpatch.Operation{
+				{"op": "remove", "path": "/users/bob"},
+				{"op": "add", "path": "/users/cy", "value": map[string]any{"status": "new"}},
+			},
+			expected: []Change{
+				{Path: "/users/bob/status", Old: "away", OldExists: true},
+				{Path: "/users/cy/status", New: "new", NewExists: true},
+			},
+		},
+		{
+			name:    "move reports both ends",
+			pattern: "/users/*",
+			patch:   []jsonpatch.Operation{{"op": "move", "from": "/users/bob", "path": "/users/rob"}},
+			expected: []Change{
+				{Path: "/users/rob", New: map[string]any{"status": "away", "name": "Bob"}, NewExists: true},
+				{Path: "/users/bob", Old: map[string]any{"status": "away", "name": "Bob"}, OldExists: true},
+			},
+		},
+		{
+			name:    "append resolves the index",
+			pattern: "/list/*",
+			patch:   []jsonpatch.Operation{{"op": "add", "path": "/list/-", "value": "c"}},
+			expected: []Change{
+				{Path: "/list/2", New: "c", NewExists: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := New()
+			var got []Change
+			if _, err := w.Subscribe(tt.pattern, func(c Change) { got = append(got, c) }); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Apply(newDoc(), tt.patch); err != nil {
+				t.Fatal(err)
+			}
+			for i := range got {
+				got[i].Op = nil
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWatcherCausingOpAndUnsubscribe(t *testing.T) {
+	w := New()
+	var got []Change
+	cancel, err := w.Subscribe("/users/ann/status", func(c Change) { got = append(got, c) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := jsonpatch.Operation{"op": "replace", "path": "/users/ann/status", "value": "away"}
+	doc, err := w.Apply(newDoc(), []jsonpatch.Operation{op})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Op, op) {
+		t.Fatalf("expected the causing op, got %+v", got)
+	}
+
+	cancel()
+	if _, err := w.Apply(doc, []jsonpatch.Operation{{"op": "replace", "path": "/users/ann/status", "value": "online"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("notified after unsubscribing: %+v", got)
+	}
+}
+
+func TestWatcherFailedPatch(t *testing.T) {
+	w := New()
+	notified := false
+	if _, err := w.Subscribe("/users/*/status", func(Change) { notified = true }); err != nil {
+		t.Fatal(err)
+	}
+	_, err := w.Apply(newDoc(), []jsonpatch.Operation{
+		{"op": "replace", "path": "/users/ann/status", "value": "away"},
+		{"op": "remove", "path": "/missing"},
+	})
+	if err == nil || notified {
+		t.Fatalf("expected an error and no notification, got %v, %v", err, notified)
+	}
+}
+
+func TestSubscribeInvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"users", "/a~2"} {
+		if _, err := New().Subscribe(pattern, func(Change) {}); err == nil {
+			t.Errorf("expected an error for %q", pattern)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	r := NewRouter()
+	subscriptions := []struct{ subscriber, pattern, predicate string }{
+		{"statuses", "/users/*/status", ""},
+		{"ann", "/users/ann", ""},
+		{"third", "/list/2", ""},
+		{"done", "/tasks/*", `op == "add" && value.status == "done"`},
+		{"big", "/counters/*", `inc >= 10 || (op == "replace" && !(value < 100))`},
+	}
+	for _, s := range subscriptions {
+		if err := r.Add(s.subscriber, s.pattern, s.predicate); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		patch    []jsonpatch.Operation
+		expected []string
+	}{
+		{
+			name:     "write at a watched path",
+			patch:    []jsonpatch.Operation{{"op": "replace", "path": "/users/bob/status", "value": "online"}},
+			expected: []string{"statuses"},
+		},
+		{
+			name:     "write inside a watched value",
+			patch:    []jsonpatch.Operation{{"op": "str_ins", "path": "/users/ann/name", "pos": 0, "str": "J"}},
+			expected: []string{"ann"},
+		},
+		{
+			name:     "write around watched values",
+			patch:    []jsonpatch.Operation{{"op": "remove", "path": "/users"}},
+			expected: []string{"ann", "statuses"},
+		},
+		{
+			name:     "insert shifting a watched element",
+			patch:    []jsonpatch.Operation{{"op": "add", "path": "/list/1", "value": "x"}},
+			expected: []string{"third"},
+		},
+		{
+			name:     "insert after a watched element",
+			patch:    []jsonpatch.Operation{{"op": "add", "path": "/list/3", "value": "x"}},
+			expected: []string{},
+		},
+		{
+			name:     "move from a watched path",
+			patch:    []jsonpatch.Operation{{"op": "move", "from": "/users/ann", "path": "/archive/ann"}},
+			expected: []string{"ann", "statuses"},
+		},
+		{
+			name:     "tests write nothing",
+			patch:    []jsonpatch.Operation{{"op": "test", "path": "/users/ann", "value": nil}},
+			expected: []string{},
+		},
+		{
+			name: "predicates on values",
+			patch: []jsonpatch.Operation{
+				{"op": "add", "path": "/tasks/1", "value": map[string]any{"status": "open"}},
+				{"op": "inc", "path": "/counters/a", "inc": 1},
+			},
+			expected: []string{},
+		},
+		{
+			name: "predicates satisfied",
+			patch: []jsonpatch.Operation{
+				{"op": "add", "path": "/tasks/2", "value": map[string]any{"status": "done"}},
+				{"op": "replace", "path": "/counters/a", "value": 250},
+			},
+			expected: []string{"big", "done"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Route(tt.patch); !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	r.Remove("statuses")
+	if got := r.Route([]jsonpatch.Operation{{"op": "remove", "path": "/users"}}); !reflect.DeepEqual(got, []string{"ann"}) {
+		t.Fatalf("expected only ann after Remove, got %v", got)
+	}
+
+	for _, predicate := range []string{`op ==`, `(op == "add"`, `value > `, `op == add`, `== 1`} {
+		if err := r.Add("x", "/a", predicate); err == nil {
+			t.Errorf("expected an error for predicate %q", predicate)
+		}
+	}
+}